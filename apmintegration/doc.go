@@ -0,0 +1,24 @@
+// Package apmintegration provides a harness for end-to-end testing of the
+// agent and its instrumentation modules against a real APM Server, which
+// indexes events into a real Elasticsearch. The servers are run in Docker
+// containers, so the docker command must be available.
+//
+// A typical test starts a stack, sends events with a tracer connected to
+// it, and then queries the indexed documents:
+//
+//	func TestIntegration(t *testing.T) {
+//		stack := apmintegration.Start(t)
+//		defer stack.Close()
+//
+//		tracer := stack.NewTracer(t, "integration_test")
+//		defer tracer.Close()
+//		tracer.StartTransaction("name", "type").End()
+//		tracer.Flush(nil)
+//
+//		docs, err := stack.WaitForDocuments(context.Background(), "transaction", nil, 1)
+//		...
+//	}
+//
+// Integration tests are slow, so Start skips the test unless the
+// ELASTIC_APM_INTEGRATION_TEST environment variable is set to "true".
+package apmintegration
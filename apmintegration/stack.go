@@ -0,0 +1,326 @@
+package apmintegration
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/transport"
+)
+
+const (
+	envIntegrationTest = "ELASTIC_APM_INTEGRATION_TEST"
+	envStackVersion    = "ELASTIC_STACK_VERSION"
+
+	// defaultStackVersion is the default version of APM Server and
+	// Elasticsearch to run. The agent sends events with the v1 intake
+	// API, so the APM Server must be a 6.x release.
+	defaultStackVersion = "6.8.23"
+
+	elasticsearchImage = "docker.elastic.co/elasticsearch/elasticsearch"
+	apmServerImage     = "docker.elastic.co/apm/apm-server"
+
+	// startTimeout is the maximum amount of time to wait
+	// for the servers to become ready.
+	startTimeout = 3 * time.Minute
+)
+
+// Stack is a running APM Server and Elasticsearch.
+type Stack struct {
+	// Version holds the version of APM Server and Elasticsearch.
+	Version string
+
+	// ServerURL holds the base URL of the APM Server.
+	ServerURL string
+
+	// ElasticsearchURL holds the base URL of Elasticsearch.
+	ElasticsearchURL string
+
+	network       string
+	elasticsearch string
+	apmServer     string
+}
+
+// Start starts an APM Server and Elasticsearch, returning a Stack with
+// which events may be sent and queried. The version of the servers is
+// taken from the ELASTIC_STACK_VERSION environment variable, defaulting
+// to a 6.x release supporting the agent's intake API.
+//
+// Start skips the test if ELASTIC_APM_INTEGRATION_TEST is not "true",
+// or if the docker command is not available; it fails the test if the
+// servers cannot be started. The caller must call Close to stop the
+// servers.
+func Start(t testing.TB) *Stack {
+	if os.Getenv(envIntegrationTest) != "true" {
+		t.Skipf("integration tests are disabled; set %s=true to enable", envIntegrationTest)
+	}
+	if _, err := exec.LookPath("docker"); err != nil {
+		t.Skip("docker is not available")
+	}
+	version := os.Getenv(envStackVersion)
+	if version == "" {
+		version = defaultStackVersion
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), startTimeout)
+	defer cancel()
+	stack, err := NewStack(ctx, version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stack
+}
+
+// NewStack starts an APM Server and Elasticsearch with the given version,
+// and waits for them to become ready or for ctx to be canceled. The
+// caller must call Close to stop the servers.
+func NewStack(ctx context.Context, version string) (_ *Stack, resultErr error) {
+	suffix, err := randomSuffix()
+	if err != nil {
+		return nil, err
+	}
+	s := &Stack{Version: version}
+	defer func() {
+		if resultErr != nil {
+			s.Close()
+		}
+	}()
+
+	network := "apmintegration-" + suffix
+	if _, err := docker(ctx, "network", "create", network); err != nil {
+		return nil, errors.Wrap(err, "failed to create docker network")
+	}
+	s.network = network
+
+	s.elasticsearch = "apmintegration-elasticsearch-" + suffix
+	if _, err := docker(ctx, "run", "-d",
+		"--name", s.elasticsearch,
+		"--network", s.network,
+		"--network-alias", "elasticsearch",
+		"-p", "127.0.0.1::9200",
+		"-e", "discovery.type=single-node",
+		"-e", "xpack.security.enabled=false",
+		"-e", "ES_JAVA_OPTS=-Xms512m -Xmx512m",
+		elasticsearchImage+":"+version,
+	); err != nil {
+		return nil, errors.Wrap(err, "failed to start Elasticsearch")
+	}
+	if s.ElasticsearchURL, err = containerURL(ctx, s.elasticsearch, 9200); err != nil {
+		return nil, err
+	}
+	if err := waitReady(ctx, s.ElasticsearchURL+"/_cluster/health?wait_for_status=yellow&timeout=1s"); err != nil {
+		return nil, errors.Wrap(err, "Elasticsearch did not become ready")
+	}
+
+	s.apmServer = "apmintegration-apm-server-" + suffix
+	if _, err := docker(ctx, "run", "-d",
+		"--name", s.apmServer,
+		"--network", s.network,
+		"-p", "127.0.0.1::8200",
+		apmServerImage+":"+version,
+		"-e",
+		"-E", "apm-server.host=0.0.0.0:8200",
+		"-E", `output.elasticsearch.hosts=["elasticsearch:9200"]`,
+	); err != nil {
+		return nil, errors.Wrap(err, "failed to start APM Server")
+	}
+	if s.ServerURL, err = containerURL(ctx, s.apmServer, 8200); err != nil {
+		return nil, err
+	}
+	if err := waitReady(ctx, s.ServerURL+"/"); err != nil {
+		return nil, errors.Wrap(err, "APM Server did not become ready")
+	}
+	return s, nil
+}
+
+// Close stops and removes the servers' containers and network.
+func (s *Stack) Close() error {
+	ctx := context.Background()
+	var firstErr error
+	for _, container := range []string{s.apmServer, s.elasticsearch} {
+		if container == "" {
+			continue
+		}
+		if _, err := docker(ctx, "rm", "-f", "-v", container); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if s.network != "" {
+		if _, err := docker(ctx, "network", "rm", s.network); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// NewTracer returns a new Tracer with the given service name, which
+// sends events to the stack's APM Server. The test fails if the tracer
+// cannot be created.
+func (s *Stack) NewTracer(t testing.TB, serviceName string) *elasticapm.Tracer {
+	tracer, err := elasticapm.NewTracer(serviceName, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpTransport, err := transport.NewHTTPTransport(s.ServerURL, "")
+	if err != nil {
+		tracer.Close()
+		t.Fatal(err)
+	}
+	tracer.Transport = httpTransport
+	return tracer
+}
+
+// Search returns the source of the documents of the given event type,
+// such as "transaction", "span", "error", or "metric", which match the
+// Elasticsearch query. If query is nil, all documents of the event type
+// are returned, up to a maximum of 1000.
+func (s *Stack) Search(ctx context.Context, eventType string, query interface{}) ([]map[string]interface{}, error) {
+	index := "apm-*-" + eventType + "*"
+	if err := s.elasticsearchRequest(ctx, "POST", "/"+index+"/_refresh", nil, nil); err != nil {
+		return nil, err
+	}
+	if query == nil {
+		query = map[string]interface{}{"match_all": map[string]interface{}{}}
+	}
+	var result struct {
+		Hits struct {
+			Hits []struct {
+				Source map[string]interface{} `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	body := map[string]interface{}{
+		"query": query,
+		"size":  1000,
+		"sort":  []interface{}{map[string]interface{}{"@timestamp": "asc"}},
+	}
+	if err := s.elasticsearchRequest(ctx, "POST", "/"+index+"/_search", body, &result); err != nil {
+		return nil, err
+	}
+	docs := make([]map[string]interface{}, len(result.Hits.Hits))
+	for i, hit := range result.Hits.Hits {
+		docs[i] = hit.Source
+	}
+	return docs, nil
+}
+
+// WaitForDocuments calls Search until at least n documents are found,
+// or until ctx is canceled, and returns the documents found. Events are
+// indexed asynchronously, so tests should use WaitForDocuments rather
+// than Search after sending events.
+func (s *Stack) WaitForDocuments(ctx context.Context, eventType string, query interface{}, n int) ([]map[string]interface{}, error) {
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		docs, err := s.Search(ctx, eventType, query)
+		if err == nil && len(docs) >= n {
+			return docs, nil
+		}
+		select {
+		case <-ctx.Done():
+			if err == nil {
+				err = errors.Errorf("found %d %s documents, expected %d", len(docs), eventType, n)
+			}
+			return docs, errors.Wrap(err, "timed out waiting for documents")
+		case <-ticker.C:
+		}
+	}
+}
+
+// elasticsearchRequest sends a request to Elasticsearch with the JSON
+// encoding of body, if non-nil, and decodes the response into out, if
+// non-nil.
+func (s *Stack) elasticsearchRequest(ctx context.Context, method, path string, body, out interface{}) error {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, s.ElasticsearchURL+path, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrapf(err, "%s %s failed", method, path)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("%s %s failed with %s", method, path, resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return errors.Wrapf(json.NewDecoder(resp.Body).Decode(out), "decoding %s %s response failed", method, path)
+}
+
+// containerURL returns the HTTP URL of the host port
+// to which the container's port is published.
+func containerURL(ctx context.Context, container string, port int) (string, error) {
+	out, err := docker(ctx, "port", container, strconv.Itoa(port))
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to get published port of %s", container)
+	}
+	// The output may include one line for each address
+	// family; the first is the IPv4 address we bound.
+	hostPort := strings.TrimSpace(strings.SplitN(out, "\n", 2)[0])
+	return "http://" + hostPort, nil
+}
+
+// waitReady waits for GET requests to url to succeed,
+// or for ctx to be canceled.
+func waitReady(ctx context.Context, url string) error {
+	for {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// docker runs the docker command with the given arguments,
+// returning its standard output.
+func docker(ctx context.Context, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "docker", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("docker %s failed: %s: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+func randomSuffix() (string, error) {
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
@@ -0,0 +1,46 @@
+package apmintegration_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go/apmintegration"
+)
+
+func TestStack(t *testing.T) {
+	stack := apmintegration.Start(t)
+	defer stack.Close()
+
+	tracer := stack.NewTracer(t, "apmintegration_test")
+	defer tracer.Close()
+	tx := tracer.StartTransaction("GET /", "request")
+	txID := tx.ID()
+	tx.StartSpan("SELECT FROM foo", "db.sql.query", nil).End()
+	e := tracer.NewError(errors.New("boom"))
+	e.Transaction = tx
+	e.Send()
+	tx.End()
+	tracer.Flush(nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	transactions, err := stack.WaitForDocuments(ctx, "transaction", nil, 1)
+	require.NoError(t, err)
+	require.Len(t, transactions, 1)
+	assert.Equal(t, "GET /", transactions[0]["transaction"].(map[string]interface{})["name"])
+
+	spans, err := stack.WaitForDocuments(ctx, "span", nil, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT FROM foo", spans[0]["span"].(map[string]interface{})["name"])
+
+	errs, err := stack.WaitForDocuments(ctx, "error", map[string]interface{}{
+		"term": map[string]interface{}{"transaction.id": txID},
+	}, 1)
+	require.NoError(t, err)
+	assert.Len(t, errs, 1)
+}
@@ -0,0 +1,100 @@
+// +build elasticapm_audit
+
+package elasticapm
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/elastic/apm-agent-go/stacktrace"
+)
+
+// auditEnabled reports whether the agent was built with the
+// elasticapm_audit build tag, enabling auditing of context
+// propagation. When auditing is enabled, transactions and
+// spans are not reused, so that stale references to them
+// can be identified.
+const auditEnabled = true
+
+// transactionAudit holds audit state for a transaction. The
+// transaction's name is recorded when it ends, as the transaction
+// is reset once it has been sent.
+type transactionAudit struct {
+	ended int32 // accessed atomically
+	name  string
+}
+
+// spanAudit holds audit state for a span. The span's name is
+// recorded when it ends, as the span is reset once its transaction
+// has been sent.
+type spanAudit struct {
+	ended     int32 // accessed atomically
+	goroutine uint64
+	tracer    *Tracer
+	name      string
+}
+
+// auditStartSpan is called before starting a span with the given name,
+// transaction, and parent. Diagnostics are logged if the transaction or
+// parent span have already ended.
+func auditStartSpan(tx *Transaction, name string, parent *Span) {
+	if tx != nil && atomic.LoadInt32(&tx.audit.ended) != 0 {
+		auditf(tx.tracer, "span %q started after its transaction %q ended", name, tx.audit.name)
+	}
+	// Dropped spans are never audited, so their ended flag is never set.
+	// The parent span is not checked with Dropped, as an ended span is
+	// reset, and appears dropped, once its transaction has been sent.
+	if parent != nil && atomic.LoadInt32(&parent.audit.ended) != 0 {
+		auditf(
+			parent.audit.tracer,
+			"span %q started on goroutine %d after its parent span %q, started on goroutine %d, ended",
+			name, goroutineID(), parent.audit.name, parent.audit.goroutine,
+		)
+	}
+}
+
+// auditSpanStarted is called after a non-dropped span is started.
+func auditSpanStarted(s *Span) {
+	s.audit.goroutine = goroutineID()
+	s.audit.tracer = s.tx.tracer
+}
+
+// auditSpanEnded is called when a non-dropped span is ended.
+func auditSpanEnded(s *Span) {
+	s.audit.name = s.Name
+	atomic.StoreInt32(&s.audit.ended, 1)
+}
+
+// auditTransactionEnded is called when a transaction is ended or discarded.
+func auditTransactionEnded(tx *Transaction) {
+	tx.audit.name = tx.Name
+	atomic.StoreInt32(&tx.audit.ended, 1)
+}
+
+// auditf logs an audit diagnostic message with the tracer's Logger,
+// along with the stack trace of the caller of the audit function.
+// Nothing is logged if the tracer has no Logger.
+func auditf(t *Tracer, format string, args ...interface{}) {
+	logger := t.loadTransactionConfig().logger
+	if logger == nil {
+		return
+	}
+	stack := stacktrace.AppendStacktrace(nil, 2, -1)
+	args = append(args, formatStacktrace(stack))
+	logger.Errorf("audit: "+format+", at:\n%s", args...)
+}
+
+// goroutineID returns the ID of the calling goroutine, parsed from
+// the first line of its stack trace: "goroutine <id> [running]:".
+func goroutineID() uint64 {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	b = bytes.TrimPrefix(b, []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i >= 0 {
+		b = b[:i]
+	}
+	id, _ := strconv.ParseUint(string(b), 10, 64)
+	return id
+}
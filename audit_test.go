@@ -0,0 +1,105 @@
+// +build elasticapm_audit
+
+package elasticapm_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestAuditSpanAfterTransactionEnded(t *testing.T) {
+	tracer, _ := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	var logger recordingLogger
+	tracer.SetLogger(&logger)
+
+	tx := tracer.StartTransaction("name", "type")
+	ctx := elasticapm.ContextWithTransaction(context.Background(), tx)
+	tx.End()
+	tracer.Flush(nil) // the transaction is reset once it has been sent
+
+	span, _ := elasticapm.StartSpan(ctx, "orphan", "type")
+	span.End()
+	assert.Contains(t, strings.Join(logger.messages(), "\n"), `audit: span "orphan" started after its transaction "name" ended`)
+}
+
+func TestAuditSpanAfterParentEnded(t *testing.T) {
+	tracer, _ := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	var logger recordingLogger
+	tracer.SetLogger(&logger)
+
+	tx := tracer.StartTransaction("name", "type")
+	defer tx.End()
+	parent, ctx := elasticapm.StartSpan(
+		elasticapm.ContextWithTransaction(context.Background(), tx),
+		"parent", "type",
+	)
+	parent.End()
+
+	done := make(chan struct{})
+	go func(ctx context.Context) {
+		defer close(done)
+		span, _ := elasticapm.StartSpan(ctx, "child", "type")
+		span.End()
+	}(elasticapm.DetachedContext(ctx))
+	<-done
+	messages := strings.Join(logger.messages(), "\n")
+	assert.Contains(t, messages, `audit: span "child" started on goroutine`)
+	assert.Contains(t, messages, `after its parent span "parent"`)
+}
+
+func TestAuditSpanAfterParentReset(t *testing.T) {
+	tracer, _ := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	var logger recordingLogger
+	tracer.SetLogger(&logger)
+
+	tx := tracer.StartTransaction("name", "type")
+	parent, ctx := elasticapm.StartSpan(
+		elasticapm.ContextWithTransaction(context.Background(), tx),
+		"parent", "type",
+	)
+	parent.End()
+	tx.End()
+	tracer.Flush(nil) // the span is reset once its transaction has been sent
+
+	span, _ := elasticapm.StartSpan(ctx, "child", "type")
+	span.End()
+	messages := strings.Join(logger.messages(), "\n")
+	assert.Contains(t, messages, `audit: span "child" started after its transaction "name" ended`)
+	assert.Contains(t, messages, `after its parent span "parent"`)
+}
+
+func TestAuditNoLogger(t *testing.T) {
+	tracer, _ := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	tx := tracer.StartTransaction("name", "type")
+	ctx := elasticapm.ContextWithTransaction(context.Background(), tx)
+	tx.End()
+
+	span, _ := elasticapm.StartSpan(ctx, "orphan", "type")
+	span.End()
+}
+
+func TestAuditNoDiagnostics(t *testing.T) {
+	tracer, _ := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	var logger recordingLogger
+	tracer.SetLogger(&logger)
+
+	tx := tracer.StartTransaction("name", "type")
+	span, ctx := elasticapm.StartSpan(elasticapm.ContextWithTransaction(context.Background(), tx), "parent", "type")
+	child, _ := elasticapm.StartSpan(ctx, "child", "type")
+	child.End()
+	span.End()
+	tx.End()
+	assert.Empty(t, logger.messages())
+}
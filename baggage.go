@@ -0,0 +1,191 @@
+package elasticapm
+
+import (
+	"context"
+	"net/url"
+	"strings"
+)
+
+const (
+	// BaggageTagPrefix is the prefix of the tags with which baggage
+	// members are recorded in transactions. See Tracer.SetBaggageTags.
+	BaggageTagPrefix = "baggage_"
+
+	// maxBaggageMembers is the maximum number of members parsed
+	// from a baggage header, as recommended by the W3C Baggage
+	// specification. Additional members are ignored.
+	maxBaggageMembers = 180
+)
+
+type contextBaggageKey struct{}
+
+// BaggageMember holds a W3C Baggage member.
+type BaggageMember struct {
+	// Key holds the member's key, which must be a token as defined
+	// by RFC 7230. Members with invalid keys are ignored.
+	Key string
+
+	// Value holds the member's decoded value.
+	Value string
+}
+
+// Baggage holds W3C Baggage members propagated with a request, in the
+// order in which they were propagated. Baggage is used for propagating
+// application-defined values, such as a tenant ID, to downstream services.
+type Baggage []BaggageMember
+
+// ParseBaggage parses the value of a W3C "baggage" header. Invalid
+// members, including those whose keys are not RFC 7230 tokens, are
+// ignored, as are member properties.
+func ParseBaggage(header string) Baggage {
+	var b Baggage
+	for _, member := range strings.Split(header, ",") {
+		if len(b) >= maxBaggageMembers {
+			break
+		}
+		if i := strings.IndexRune(member, ';'); i >= 0 {
+			member = member[:i]
+		}
+		i := strings.IndexRune(member, '=')
+		if i < 0 {
+			continue
+		}
+		key := strings.TrimSpace(member[:i])
+		value, err := url.PathUnescape(strings.TrimSpace(member[i+1:]))
+		if !validBaggageKey(key) || err != nil {
+			continue
+		}
+		b = b.set(key, value)
+	}
+	return b
+}
+
+// Get returns the value of the member with the given key, and
+// whether or not there is such a member.
+func (b Baggage) Get(key string) (string, bool) {
+	for _, m := range b {
+		if m.Key == key {
+			return m.Value, true
+		}
+	}
+	return "", false
+}
+
+// Merge returns the members of b and other, with members of other
+// replacing members of b with the same key. Members of other with
+// invalid keys are ignored. Neither b nor other are modified.
+func (b Baggage) Merge(other Baggage) Baggage {
+	if len(other) == 0 {
+		return b
+	}
+	merged := make(Baggage, len(b), len(b)+len(other))
+	copy(merged, b)
+	for _, m := range other {
+		merged = merged.set(m.Key, m.Value)
+	}
+	return merged
+}
+
+// String returns b formatted as the value of a W3C "baggage" header.
+// Members with invalid keys are omitted.
+func (b Baggage) String() string {
+	members := make([]string, 0, len(b))
+	for _, m := range b {
+		if validBaggageKey(m.Key) {
+			members = append(members, m.Key+"="+url.PathEscape(m.Value))
+		}
+	}
+	return strings.Join(members, ",")
+}
+
+// set sets the member with the given key to value, adding a member
+// if there is none, and returns the updated baggage. Invalid keys are
+// ignored.
+func (b Baggage) set(key, value string) Baggage {
+	if !validBaggageKey(key) {
+		return b
+	}
+	for i, m := range b {
+		if m.Key == key {
+			b[i].Value = value
+			return b
+		}
+	}
+	return append(b, BaggageMember{Key: key, Value: value})
+}
+
+// validBaggageKey reports whether key is a valid baggage member key:
+// a non-empty token, as defined by RFC 7230.
+func validBaggageKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// ContextWithBaggage returns a copy of parent which holds the given
+// baggage, for propagation to downstream services. Instrumentation
+// modules add the baggage of incoming requests to their contexts,
+// and propagate the baggage in the context with outgoing requests.
+func ContextWithBaggage(parent context.Context, b Baggage) context.Context {
+	return context.WithValue(parent, contextBaggageKey{}, b)
+}
+
+// BaggageFromContext returns the baggage held by ctx, as added with
+// ContextWithBaggage. The returned Baggage must not be modified.
+func BaggageFromContext(ctx context.Context) Baggage {
+	b, _ := ctx.Value(contextBaggageKey{}).(Baggage)
+	return b
+}
+
+// SetBaggageTags sets the keys of the baggage members which are recorded
+// as tags in transactions started with WithBaggage, e.g. by instrumentation
+// modules for incoming requests. Each member is recorded in the tag named
+// BaggageTagPrefix+key; the key "*" matches all members. By default, no
+// baggage members are recorded.
+//
+// The keys may also be set with the ELASTIC_APM_BAGGAGE_TO_TAGS environment
+// variable, a comma-separated list.
+func (t *Tracer) SetBaggageTags(keys []string) {
+	t.updateTransactionConfig(func(cfg *transactionConfig) {
+		cfg.baggageTags = keys
+	})
+}
+
+// WithBaggage returns a TransactionOption which records the members of
+// the given baggage in the transaction as tags, if they are configured
+// with Tracer.SetBaggageTags.
+func WithBaggage(b Baggage) TransactionOption {
+	return func(o *transactionOptions) {
+		o.baggage = b
+	}
+}
+
+// setBaggageTags records the members of b whose keys are in keys
+// as tags in the transaction.
+func (tx *Transaction) setBaggageTags(b Baggage, keys []string) {
+	for _, key := range keys {
+		if key == "*" {
+			for _, m := range b {
+				if validBaggageKey(m.Key) {
+					tx.Context.SetTag(BaggageTagPrefix+m.Key, m.Value)
+				}
+			}
+			return
+		}
+	}
+	for _, key := range keys {
+		if value, ok := b.Get(key); ok {
+			tx.Context.SetTag(BaggageTagPrefix+key, value)
+		}
+	}
+}
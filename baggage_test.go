@@ -0,0 +1,89 @@
+package elasticapm_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestParseBaggage(t *testing.T) {
+	b := elasticapm.ParseBaggage(" a=1 , b = x%20y;prop=1,invalid, =2,c=%zz,a=3")
+	assert.Equal(t, elasticapm.Baggage{
+		{Key: "a", Value: "3"},
+		{Key: "b", Value: "x y"},
+	}, b)
+	assert.Equal(t, "a=3,b=x%20y", b.String())
+	assert.Nil(t, elasticapm.ParseBaggage(""))
+}
+
+func TestParseBaggageInvalidKeys(t *testing.T) {
+	b := elasticapm.ParseBaggage(`tenant_id=1,a b=2,k(1)=3,"q"=4,ké=5,x-y.z~!=6`)
+	assert.Equal(t, elasticapm.Baggage{
+		{Key: "tenant_id", Value: "1"},
+		{Key: "x-y.z~!", Value: "6"},
+	}, b)
+}
+
+func TestBaggageInvalidKeys(t *testing.T) {
+	b := elasticapm.Baggage{{Key: "a", Value: "1"}}
+	merged := b.Merge(elasticapm.Baggage{{Key: "b=c", Value: "2"}, {Key: "", Value: "3"}, {Key: "d", Value: "4"}})
+	assert.Equal(t, elasticapm.Baggage{{Key: "a", Value: "1"}, {Key: "d", Value: "4"}}, merged)
+
+	// Members of directly constructed baggage with invalid
+	// keys are not propagated.
+	b = elasticapm.Baggage{{Key: "a,b", Value: "1"}, {Key: "c", Value: "2"}}
+	assert.Equal(t, "c=2", b.String())
+}
+
+func TestBaggageMerge(t *testing.T) {
+	b := elasticapm.Baggage{{Key: "a", Value: "1"}, {Key: "b", Value: "2"}}
+	merged := b.Merge(elasticapm.Baggage{{Key: "b", Value: "3"}, {Key: "c", Value: "4"}})
+	assert.Equal(t, "a=1,b=3,c=4", merged.String())
+	assert.Equal(t, "a=1,b=2", b.String()) // unmodified
+
+	value, ok := merged.Get("c")
+	assert.True(t, ok)
+	assert.Equal(t, "4", value)
+	_, ok = merged.Get("d")
+	assert.False(t, ok)
+}
+
+func TestContextWithBaggage(t *testing.T) {
+	ctx := context.Background()
+	assert.Nil(t, elasticapm.BaggageFromContext(ctx))
+	b := elasticapm.Baggage{{Key: "a", Value: "1"}}
+	assert.Equal(t, b, elasticapm.BaggageFromContext(elasticapm.ContextWithBaggage(ctx, b)))
+}
+
+func TestTransactionBaggageTags(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	b := elasticapm.Baggage{{Key: "tenant", Value: "acme"}, {Key: "region", Value: "eu"}}
+
+	tracer.StartTransaction("none", "type", elasticapm.WithBaggage(b)).End()
+	tracer.SetBaggageTags([]string{"tenant"})
+	tracer.StartTransaction("tenant", "type", elasticapm.WithBaggage(b)).End()
+	tracer.SetBaggageTags([]string{"*"})
+	tracer.StartTransaction("all", "type", elasticapm.WithBaggage(b)).End()
+	tracer.Flush(nil)
+
+	tags := make(map[string]map[string]string)
+	for _, p := range transport.Payloads() {
+		for _, tx := range p.Transactions() {
+			if tx.Context != nil {
+				tags[tx.Name] = tx.Context.Tags
+			} else {
+				tags[tx.Name] = nil
+			}
+		}
+	}
+	assert.Equal(t, map[string]map[string]string{
+		"none":   nil,
+		"tenant": {"baggage_tenant": "acme"},
+		"all":    {"baggage_tenant": "acme", "baggage_region": "eu"},
+	}, tags)
+}
@@ -0,0 +1,194 @@
+package elasticapm
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// breakdownMetricsLimit is the maximum number of distinct groups for
+// which span self-time metrics are recorded in each metrics interval.
+// Spans in further groups are not recorded.
+const breakdownMetricsLimit = 1000
+
+// appSpanType is the span type under which the self-time of
+// transactions, i.e. time not spent in any span, is recorded.
+const appSpanType = "app"
+
+// BreakdownMetricsMode holds a value indicating how a tracer should
+// record span self-time ("breakdown") metrics.
+type BreakdownMetricsMode int
+
+const (
+	// BreakdownMetricsOff disables breakdown metrics. This is the
+	// default mode.
+	BreakdownMetricsOff BreakdownMetricsMode = iota
+
+	// BreakdownMetricsSpanType records the self-time of spans grouped
+	// by transaction name and type, and span type and subtype, e.g.
+	// "db.postgresql".
+	BreakdownMetricsSpanType
+
+	// BreakdownMetricsDestination is like BreakdownMetricsSpanType,
+	// but additionally splits the self-time of database spans by
+	// destination service resource, e.g. "postgresql/orders", so that
+	// the time spent in each database instance can be told apart.
+	BreakdownMetricsDestination
+)
+
+// SetBreakdownMetrics sets the mode with which the tracer records span
+// self-time ("breakdown") metrics, reported as "span.self_time" summary
+// metrics when metrics are sent. The self-time of a span is its duration
+// less the time spent in its child spans; the self-time of transactions
+// themselves is recorded with the span type "app".
+//
+// Breakdown metrics are computed from the spans of sampled transactions,
+// so do not include unsampled transactions, or spans dropped due to the
+// max spans limit. Breakdown metrics are disabled by default, and may
+// also be configured with the ELASTIC_APM_BREAKDOWN_METRICS environment
+// variable.
+func (t *Tracer) SetBreakdownMetrics(mode BreakdownMetricsMode) {
+	t.updateTransactionConfig(func(cfg *transactionConfig) {
+		cfg.breakdownMetricsMode = mode
+	})
+}
+
+// breakdownMetrics aggregates the self-time of spans in ended
+// transactions between metrics gatherings.
+type breakdownMetrics struct {
+	mu     sync.Mutex
+	groups map[breakdownGroupKey]*breakdownGroup
+}
+
+type breakdownGroupKey struct {
+	transactionName string
+	transactionType string
+	spanType        string
+	destination     string
+}
+
+type breakdownGroup struct {
+	count uint64
+	sum   time.Duration
+}
+
+// record records the self-time of the ended transaction tx and its spans.
+func (m *breakdownMetrics) record(tx *Transaction, mode BreakdownMetricsMode) {
+	if mode == BreakdownMetricsOff || !tx.sampled {
+		return
+	}
+	children := make(map[int64][]spanInterval)
+	for _, s := range tx.spans {
+		children[s.parent] = append(children[s.parent], spanInterval{
+			start: s.Timestamp,
+			end:   s.Timestamp.Add(s.Duration),
+		})
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	txEnd := tx.Timestamp.Add(tx.Duration)
+	m.add(breakdownGroupKey{
+		transactionName: tx.Name,
+		transactionType: tx.Type,
+		spanType:        appSpanType,
+	}, selfTime(tx.Timestamp, txEnd, children[-1]))
+	for _, s := range tx.spans {
+		key := breakdownGroupKey{
+			transactionName: tx.Name,
+			transactionType: tx.Type,
+			spanType:        breakdownSpanType(s.Type),
+		}
+		if mode == BreakdownMetricsDestination && strings.HasPrefix(key.spanType, "db.") {
+			if d := s.Context.model.Destination; d != nil && d.Service != nil {
+				key.destination = d.Service.Resource
+			}
+		}
+		m.add(key, selfTime(s.Timestamp, s.Timestamp.Add(s.Duration), children[s.id]))
+	}
+}
+
+// add adds d to the group with the given key. m.mu must be held.
+func (m *breakdownMetrics) add(key breakdownGroupKey, d time.Duration) {
+	g, ok := m.groups[key]
+	if !ok {
+		if len(m.groups) >= breakdownMetricsLimit {
+			return
+		}
+		if m.groups == nil {
+			m.groups = make(map[breakdownGroupKey]*breakdownGroup)
+		}
+		g = &breakdownGroup{}
+		m.groups[key] = g
+	}
+	g.count++
+	g.sum += d
+}
+
+// gather adds a "span.self_time" summary metric to out for each group
+// of spans recorded since the last call to gather, and then resets the
+// groups.
+func (m *breakdownMetrics) gather(out *Metrics) {
+	m.mu.Lock()
+	groups := m.groups
+	m.groups = nil
+	m.mu.Unlock()
+
+	for key, g := range groups {
+		labels := make([]MetricLabel, 0, 4)
+		if key.destination != "" {
+			labels = append(labels, MetricLabel{Name: "span_destination", Value: key.destination})
+		}
+		labels = append(labels,
+			MetricLabel{Name: "span_type", Value: key.spanType},
+			MetricLabel{Name: "transaction_name", Value: key.transactionName},
+			MetricLabel{Name: "transaction_type", Value: key.transactionType},
+		)
+		out.AddSummary("span.self_time", "sec", labels, SummaryMetric{
+			Count: g.count,
+			Sum:   g.sum.Seconds(),
+		})
+	}
+}
+
+// breakdownSpanType returns the type and subtype of a span type,
+// e.g. "db.postgresql" for "db.postgresql.query".
+func breakdownSpanType(spanType string) string {
+	if i := strings.IndexRune(spanType, '.'); i >= 0 {
+		if j := strings.IndexRune(spanType[i+1:], '.'); j >= 0 {
+			return spanType[:i+1+j]
+		}
+	}
+	return spanType
+}
+
+type spanInterval struct {
+	start, end time.Time
+}
+
+// selfTime returns the time between start and end not
+// covered by any of the children's intervals.
+func selfTime(start, end time.Time, children []spanInterval) time.Duration {
+	self := end.Sub(start)
+	if len(children) == 0 || self <= 0 {
+		return self
+	}
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].start.Before(children[j].start)
+	})
+	covered := start
+	for _, c := range children {
+		if c.start.After(covered) {
+			covered = c.start
+		}
+		if c.end.After(end) {
+			c.end = end
+		}
+		if c.end.After(covered) {
+			self -= c.end.Sub(covered)
+			covered = c.end
+		}
+	}
+	return self
+}
@@ -5,12 +5,19 @@ import (
 	"runtime"
 	"runtime/debug"
 	"time"
+
+	"github.com/elastic/apm-agent-go/transport"
 )
 
 // builtinMetricsGatherer is an MetricsGatherer which gathers builtin metrics:
 //   - memstats (allocations, usage, GC, etc.)
 //   - goroutines
 //   - tracer stats (number of transactions/errors sent, dropped, etc.)
+//   - transport stats, if the transport implements transport.StatsReporter
+//   - transaction durations, by transaction name and type, with the
+//     longest sampled transaction in each group as an exemplar
+//   - span self-time, if enabled with Tracer.SetBreakdownMetrics
+//   - process and system CPU/memory, on supported platforms
 type builtinMetricsGatherer struct {
 	tracer *Tracer
 }
@@ -18,9 +25,15 @@ type builtinMetricsGatherer struct {
 // GatherMetrics gathers mem metrics into m.
 func (g *builtinMetricsGatherer) GatherMetrics(ctx context.Context, m *Metrics) error {
 	m.AddGauge("go.goroutines", "", nil, float64(runtime.NumGoroutine()))
+	m.AddGauge("go.gomaxprocs", "", nil, float64(runtime.GOMAXPROCS(0)))
+	if quota := g.tracer.system.CPUQuota; quota > 0 {
+		m.AddGauge("system.cpu.quota", "", nil, quota)
+	}
 	g.gatherMemStatsMetrics(m)
 	g.gatherTracerStatsMetrics(m)
-	return nil
+	g.tracer.transactionMetrics.gather(m)
+	g.tracer.breakdownMetrics.gather(m)
+	return g.gatherProcessMetrics(m)
 }
 
 func (*builtinMetricsGatherer) gatherMemStatsMetrics(m *Metrics) {
@@ -81,8 +94,31 @@ func (g *builtinMetricsGatherer) gatherTracerStatsMetrics(m *Metrics) {
 	const p = "elasticapm"
 	m.AddCounter(p+".transactions.sent", "", nil, float64(stats.TransactionsSent))
 	m.AddCounter(p+".transactions.dropped", "", nil, float64(stats.TransactionsDropped))
+	m.AddCounter(p+".transactions.spooled", "", nil, float64(stats.TransactionsSpooled))
 	m.AddCounter(p+".transactions.send_errors", "", nil, float64(stats.Errors.SendTransactions))
 	m.AddCounter(p+".errors.sent", "", nil, float64(stats.ErrorsSent))
 	m.AddCounter(p+".errors.dropped", "", nil, float64(stats.ErrorsDropped))
+	m.AddCounter(p+".errors.spooled", "", nil, float64(stats.ErrorsSpooled))
 	m.AddCounter(p+".errors.send_errors", "", nil, float64(stats.Errors.SendErrors))
+
+	if reporter, ok := g.tracer.Transport.(transport.StatsReporter); ok {
+		stats := reporter.TransportStats()
+		m.AddCounter(p+".transport.bytes_sent", "byte", nil, float64(stats.BytesSent))
+		m.AddCounter(p+".transport.requests", "", nil, float64(stats.Requests))
+		m.AddCounter(p+".transport.request_failures", "", nil, float64(stats.RequestFailures))
+		m.AddCounter(p+".transport.retries", "", nil, float64(stats.Retries))
+		m.AddCounter(p+".transport.failovers", "", nil, float64(stats.Failovers))
+		m.AddCounter(p+".transport.payloads_failed", "", nil, float64(stats.PayloadsFailed))
+	}
+
+	if used, limit := g.tracer.memory.usage(); limit > 0 {
+		m.AddGauge(p+".memory.usage", "byte", nil, float64(used))
+		m.AddGauge(p+".memory.budget", "byte", nil, float64(limit))
+	}
+
+	if g.tracer.leaks.enabled() {
+		transactions, spans := g.tracer.leaks.check(nil)
+		m.AddGauge(p+".transactions.leaked", "", nil, float64(transactions))
+		m.AddGauge(p+".spans.leaked", "", nil, float64(spans))
+	}
 }
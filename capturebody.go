@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"io"
 	"io/ioutil"
+	"mime"
 	"net/http"
 	"net/url"
 
@@ -35,29 +36,56 @@ const (
 // BodyCapturer which can later be passed to Context.SetHTTPRequestBody
 // for setting the request body in a transaction or error context. If the
 // tracer is not configured to capture HTTP request bodies, then req.Body
-// is left alone and nil is returned.
+// is left alone and nil is returned. Likewise if the tracer's memory
+// budget has been exhausted.
 //
 // This must be called before the request body is read.
 func (t *Tracer) CaptureHTTPRequestBody(req *http.Request) *BodyCapturer {
-	if req.Body == nil {
+	return t.CaptureHTTPRequestBodyFunc(req, nil)
+}
+
+// CaptureBodyFunc is the type of a function for use in
+// Tracer.CaptureHTTPRequestBodyFunc. The function is passed
+// the request and the tracer's configured CaptureBodyMode,
+// and returns the CaptureBodyMode to use for the request.
+type CaptureBodyFunc func(req *http.Request, mode CaptureBodyMode) CaptureBodyMode
+
+// CaptureHTTPRequestBodyFunc is like CaptureHTTPRequestBody, but calls f
+// to decide whether or not to capture the body of this specific request,
+// e.g. only for certain content types, or when a debug header is present.
+// If f is nil, the tracer's configured CaptureBodyMode is used.
+func (t *Tracer) CaptureHTTPRequestBodyFunc(req *http.Request, f CaptureBodyFunc) *BodyCapturer {
+	if !bodyCaptureEnabled || req.Body == nil {
 		return nil
 	}
 	t.captureBodyMu.RLock()
 	captureBody := t.captureBody
 	t.captureBodyMu.RUnlock()
-	if captureBody == CaptureBodyOff {
+	if f != nil {
+		captureBody = f(req, captureBody)
+	}
+	if captureBody == CaptureBodyOff || t.memory.exceeded() {
 		return nil
 	}
 
-	type readerCloser struct {
-		io.Reader
-		io.Closer
-	}
 	bc := BodyCapturer{
 		captureBody:  captureBody,
 		request:      req,
 		originalBody: req.Body,
 	}
+	if isMultipartForm(req) {
+		// Multipart form bodies are not buffered, as they may
+		// contain large files. Instead, the form fields and
+		// file metadata are taken from req.MultipartForm, if
+		// the handler parses the form.
+		bc.multipart = true
+		return &bc
+	}
+
+	type readerCloser struct {
+		io.Reader
+		io.Closer
+	}
 	req.Body = &readerCloser{
 		Reader: io.TeeReader(req.Body, &bc.buffer),
 		Closer: req.Body,
@@ -72,22 +100,39 @@ type BodyCapturer struct {
 	originalBody io.ReadCloser
 	buffer       bytes.Buffer
 	request      *http.Request
+	multipart    bool
 }
 
 func (bc *BodyCapturer) setContext(out *model.RequestBody) bool {
+	if bc.multipart {
+		form := bc.request.MultipartForm
+		if form == nil {
+			return false
+		}
+		out.Form = copyValues(form.Value)
+		if len(form.File) != 0 {
+			out.Files = make(map[string][]model.RequestBodyFile, len(form.File))
+			for k, headers := range form.File {
+				files := make([]model.RequestBodyFile, len(headers))
+				for i, h := range headers {
+					files[i] = model.RequestBodyFile{
+						Filename:    truncateString(h.Filename),
+						Size:        multipartFileSize(h),
+						ContentType: truncateString(h.Header.Get("Content-Type")),
+					}
+				}
+				out.Files[k] = files
+			}
+		}
+		return true
+	}
 	if bc.request.PostForm != nil {
 		// We must copy the map in case we need to
 		// sanitize the values. Ideally we should only
 		// copy if sanitization is necessary, but body
 		// capture shouldn't typically be enabled so
 		// we don't currently optimize this.
-		postForm := make(url.Values, len(bc.request.PostForm))
-		for k, v := range bc.request.PostForm {
-			vcopy := make([]string, len(v))
-			copy(vcopy, v)
-			postForm[k] = vcopy
-		}
-		out.Form = postForm
+		out.Form = copyValues(bc.request.PostForm)
 		return true
 	}
 
@@ -101,3 +146,18 @@ func (bc *BodyCapturer) setContext(out *model.RequestBody) bool {
 	out.Raw = string(all)
 	return true
 }
+
+func copyValues(values url.Values) url.Values {
+	out := make(url.Values, len(values))
+	for k, v := range values {
+		vcopy := make([]string, len(v))
+		copy(vcopy, v)
+		out[k] = vcopy
+	}
+	return out
+}
+
+func isMultipartForm(req *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	return err == nil && mediaType == "multipart/form-data"
+}
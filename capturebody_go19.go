@@ -0,0 +1,9 @@
+// +build go1.9
+
+package elasticapm
+
+import "mime/multipart"
+
+func multipartFileSize(h *multipart.FileHeader) int64 {
+	return h.Size
+}
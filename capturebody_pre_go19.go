@@ -0,0 +1,23 @@
+// +build !go1.9
+
+package elasticapm
+
+import (
+	"io"
+	"mime/multipart"
+)
+
+// multipartFileSize returns the size of the file by seeking to its
+// end, as multipart.FileHeader.Size does not exist before Go 1.9.
+func multipartFileSize(h *multipart.FileHeader) int64 {
+	f, err := h.Open()
+	if err != nil {
+		return -1
+	}
+	defer f.Close()
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return -1
+	}
+	return size
+}
@@ -0,0 +1,94 @@
+package elasticapm
+
+import "time"
+
+const defaultCircuitBreakerOpenDuration = 30 * time.Second
+
+// SetCircuitBreaker configures the tracer's circuit breaker for sending
+// to the APM server. After threshold consecutive attempts to send
+// transactions or errors have failed, the circuit is opened: for the
+// following openDuration, the tracer makes no attempt to send, and
+// discards events instead of queueing them, counting them in
+// TracerStats.TransactionsDropped and TracerStats.ErrorsDropped.
+// Metrics gathered while the circuit is open are discarded.
+//
+// Once openDuration has elapsed, the tracer attempts to send again.
+// If the attempt succeeds, the circuit is closed; otherwise, it is
+// opened for another openDuration.
+//
+// If threshold is less than or equal to zero, which is the default,
+// or openDuration is less than or equal to zero, the circuit breaker
+// is disabled, and failed sends are retried at
+// the flush interval until the events are dropped from the queue.
+//
+// The circuit breaker may also be configured with the
+// ELASTIC_APM_CIRCUIT_BREAKER_THRESHOLD and
+// ELASTIC_APM_CIRCUIT_BREAKER_OPEN_DURATION environment variables.
+func (t *Tracer) SetCircuitBreaker(threshold int, openDuration time.Duration) {
+	t.sendConfigCommand(func(cfg *tracerConfig) {
+		cfg.circuitThreshold = threshold
+		cfg.circuitOpenDuration = openDuration
+	})
+}
+
+// circuitBreaker tracks consecutive send failures, owned by the
+// tracer's loop.
+type circuitBreaker struct {
+	tracer    *Tracer
+	failures  int
+	openUntil time.Time
+}
+
+// open reports whether the circuit is open, and sends should not
+// be attempted.
+func (b *circuitBreaker) open() bool {
+	return !b.openUntil.IsZero() && time.Now().Before(b.openUntil)
+}
+
+// record updates the circuit breaker with the outcome of the sends
+// recorded in stats, opening or closing the circuit as necessary.
+func (b *circuitBreaker) record(cfg *tracerConfig, stats *TracerStats) {
+	if cfg.circuitThreshold <= 0 || cfg.circuitOpenDuration <= 0 {
+		if !b.openUntil.IsZero() {
+			b.close(cfg)
+		}
+		b.failures = 0
+		return
+	}
+	switch {
+	case stats.Errors.SendTransactions != 0 || stats.Errors.SendErrors != 0:
+		b.failures++
+		if b.failures >= cfg.circuitThreshold {
+			if cfg.logger != nil {
+				cfg.logger.Debugf(
+					"sending failed %d consecutive times, not sending for %s",
+					b.failures, cfg.circuitOpenDuration,
+				)
+			}
+			if b.openUntil.IsZero() {
+				stats.CircuitBreakerOpened++
+				b.setOpen(true)
+			}
+			b.openUntil = time.Now().Add(cfg.circuitOpenDuration)
+		}
+	case stats.TransactionsSent != 0 || stats.ErrorsSent != 0:
+		if !b.openUntil.IsZero() {
+			b.close(cfg)
+		}
+		b.failures = 0
+	}
+}
+
+func (b *circuitBreaker) close(cfg *tracerConfig) {
+	if cfg.logger != nil {
+		cfg.logger.Debugf("closing circuit")
+	}
+	b.openUntil = time.Time{}
+	b.setOpen(false)
+}
+
+func (b *circuitBreaker) setOpen(open bool) {
+	b.tracer.statsMu.Lock()
+	b.tracer.stats.CircuitBreakerOpen = open
+	b.tracer.statsMu.Unlock()
+}
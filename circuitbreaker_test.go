@@ -0,0 +1,120 @@
+package elasticapm_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/model"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestTracerCircuitBreaker(t *testing.T) {
+	tracer, err := elasticapm.NewTracer("tracer_testing", "")
+	require.NoError(t, err)
+	defer tracer.Close()
+	tracer.SetFlushInterval(10 * time.Millisecond)
+	tracer.SetCircuitBreaker(2, 100*time.Millisecond)
+
+	var mu sync.Mutex
+	var fail = true
+	var attempts int
+	tracer.Transport = transporttest.CallbackTransport{
+		Transactions: func(ctx context.Context, p *model.TransactionsPayload) error {
+			mu.Lock()
+			defer mu.Unlock()
+			attempts++
+			if fail {
+				return errors.New("nope")
+			}
+			return nil
+		},
+	}
+	getAttempts := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return attempts
+	}
+
+	// The circuit is opened after two consecutive failures,
+	// and the queued transaction is dropped.
+	tracer.StartTransaction("first", "type").End()
+	tracer.Flush(nil)
+	assert.Equal(t, 2, getAttempts())
+	stats := tracer.Stats()
+	assert.True(t, stats.CircuitBreakerOpen)
+	assert.Equal(t, uint64(1), stats.CircuitBreakerOpened)
+	assert.Equal(t, uint64(1), stats.TransactionsDropped)
+
+	// While the circuit is open, no attempt is made to send.
+	tracer.StartTransaction("second", "type").End()
+	tracer.Flush(nil)
+	assert.Equal(t, 2, getAttempts())
+	assert.Equal(t, uint64(2), tracer.Stats().TransactionsDropped)
+
+	// Once the open duration has elapsed, a successful send
+	// closes the circuit.
+	mu.Lock()
+	fail = false
+	mu.Unlock()
+	time.Sleep(100 * time.Millisecond)
+	tracer.StartTransaction("third", "type").End()
+	tracer.Flush(nil)
+	assert.Equal(t, 3, getAttempts())
+	stats = tracer.Stats()
+	assert.False(t, stats.CircuitBreakerOpen)
+	assert.Equal(t, uint64(1), stats.TransactionsSent)
+}
+
+func TestTracerCircuitBreakerZeroOpenDuration(t *testing.T) {
+	tracer, err := elasticapm.NewTracer("tracer_testing", "")
+	require.NoError(t, err)
+	defer tracer.Close()
+	tracer.SetFlushInterval(10 * time.Millisecond)
+	tracer.SetCircuitBreaker(1, 0)
+
+	var mu sync.Mutex
+	var attempts int
+	tracer.Transport = transporttest.CallbackTransport{
+		Transactions: func(ctx context.Context, p *model.TransactionsPayload) error {
+			mu.Lock()
+			defer mu.Unlock()
+			attempts++
+			return errors.New("nope")
+		},
+	}
+
+	// With a zero open duration the circuit breaker is disabled,
+	// so sends continue to be attempted, and nothing is dropped.
+	tracer.StartTransaction("first", "type").End()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		mu.Lock()
+		n := attempts
+		mu.Unlock()
+		if n >= 3 {
+			break
+		}
+		require.True(t, time.Now().Before(deadline), "timed out waiting for send attempts")
+		time.Sleep(10 * time.Millisecond)
+	}
+	stats := tracer.Stats()
+	assert.False(t, stats.CircuitBreakerOpen)
+	assert.Equal(t, uint64(0), stats.CircuitBreakerOpened)
+	assert.Equal(t, uint64(0), stats.TransactionsDropped)
+}
+
+func TestTracerCircuitBreakerEnvInvalid(t *testing.T) {
+	os.Setenv("ELASTIC_APM_CIRCUIT_BREAKER_THRESHOLD", "many")
+	defer os.Unsetenv("ELASTIC_APM_CIRCUIT_BREAKER_THRESHOLD")
+
+	_, err := elasticapm.NewTracer("tracer_testing", "")
+	assert.EqualError(t, err, `failed to parse ELASTIC_APM_CIRCUIT_BREAKER_THRESHOLD: strconv.Atoi: parsing "many": invalid syntax`)
+}
@@ -0,0 +1,82 @@
+package elasticapm
+
+import (
+	"time"
+)
+
+// Clock provides the current time, for recording the timestamps and
+// durations of transactions, spans, and errors.
+type Clock interface {
+	// Now returns the current time.
+	//
+	// Durations are computed by subtracting times returned by Now.
+	// Times returned by time.Now carry a monotonic clock reading, so
+	// durations computed from them are unaffected by changes to the
+	// wall clock. Clocks which do not return monotonic readings may
+	// produce inaccurate durations if the wall clock is stepped.
+	Now() time.Time
+}
+
+// ClockFunc is a function type implementing Clock.
+type ClockFunc func() time.Time
+
+// Now returns f().
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// systemClock is the default Clock, using time.Now.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// SetClock sets the Clock used by the tracer for recording the
+// timestamps and durations of transactions, spans, and errors. This
+// may be used for deterministic tests. If c is nil, the system clock
+// is used, which is the default.
+//
+// SetClock affects only transactions and errors created after it is
+// called; spans use the clock of their transaction.
+func (t *Tracer) SetClock(c Clock) {
+	if c == nil {
+		c = systemClock{}
+	}
+	t.updateTransactionConfig(func(cfg *transactionConfig) {
+		cfg.clock = c
+	})
+}
+
+// elapsed returns the time elapsed since start according to clock.
+//
+// Durations are never negative: if the clock reports a time before
+// start, e.g. because the wall clock was stepped backwards and start
+// has no monotonic clock reading, zero is returned.
+func elapsed(clock Clock, start time.Time) time.Duration {
+	return nonNegative(clock.Now().Sub(start))
+}
+
+// nonNegative returns d, or zero if d is negative.
+func nonNegative(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// Elapsed returns the time elapsed since tx.Timestamp, according to
+// the tracer's Clock when the transaction was started. Elapsed never
+// returns a negative duration.
+func (tx *Transaction) Elapsed() time.Duration {
+	return elapsed(tx.clock, tx.Timestamp)
+}
+
+// now returns the current time according to tx's clock, or
+// the system clock if tx is nil.
+func (tx *Transaction) now() time.Time {
+	if tx == nil {
+		return time.Now()
+	}
+	return tx.clock.Now()
+}
@@ -0,0 +1,68 @@
+package elasticapm_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/model"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestTracerSetClock(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	now := time.Unix(1000, 0).UTC()
+	tracer.SetClock(elasticapm.ClockFunc(func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}))
+
+	tx := tracer.StartTransaction("name", "type") // 1001
+	span := tx.StartSpan("name", "type", nil)     // 1002
+	span.End()                                    // 1003
+	tx.Mark("phases", "auth")                     // 1004
+	tracer.NewError(errors.New("boom")).Send()    // 1005
+	tx.End()                                      // 1006
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads, 2)
+	assert.Equal(t, model.Time(time.Unix(1005, 0).UTC()), payloads[0].Errors()[0].Timestamp)
+
+	transaction := payloads[1].Transactions()[0]
+	assert.Equal(t, model.Time(time.Unix(1001, 0).UTC()), transaction.Timestamp)
+	assert.Equal(t, float64(5000), transaction.Duration)
+	assert.Equal(t, model.TransactionMarks{"phases": {"auth": 3000}}, transaction.Marks)
+	require.Len(t, transaction.Spans, 1)
+	assert.Equal(t, float64(1000), transaction.Spans[0].Start)
+	assert.Equal(t, float64(1000), transaction.Spans[0].Duration)
+}
+
+func TestTracerClockSteppedBackwards(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	// Times without monotonic clock readings are subject
+	// to the wall clock being stepped backwards.
+	now := time.Unix(1000, 0)
+	tracer.SetClock(elasticapm.ClockFunc(func() time.Time {
+		now = now.Add(-time.Second)
+		return now
+	}))
+
+	tx := tracer.StartTransaction("name", "type")
+	tx.StartSpan("name", "type", nil).End()
+	tx.End()
+	tracer.Flush(nil)
+
+	transaction := transport.Payloads()[0].Transactions()[0]
+	assert.Equal(t, float64(0), transaction.Duration)
+	require.Len(t, transaction.Spans, 1)
+	assert.Equal(t, float64(0), transaction.Spans[0].Duration)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"sync/atomic"
 
 	"github.com/elastic/apm-agent-go/internal/apmhttputil"
 	"github.com/elastic/apm-agent-go/model"
@@ -19,7 +20,16 @@ type Context struct {
 	response        model.Response
 	responseHeaders model.ResponseHeaders
 	user            model.User
+	featureFlags    []featureFlag
 	captureBodyMask CaptureBodyMode
+	headerCapture   *headerCapture
+
+	// captureFailureBody records whether the request body should
+	// be captured as for errors, due to the transaction failing.
+	// See FailureCaptureBody.
+	captureFailureBody uint32 // accessed atomically
+
+	userAgentParsing UserAgentParsingMode
 }
 
 func (c *Context) build() *model.Context {
@@ -62,17 +72,11 @@ func (c *Context) SetCustom(key string, value interface{}) {
 }
 
 // SetTag sets a tag in the context. If the key is invalid
-// (contains '.', '*', or '"'), the call is a no-op.
+// (contains '.', '*', or '"'), or the context already has
+// MaxTags tags and key is not one of them, the call is a no-op.
+// Keys and values longer than 1024 characters are truncated.
 func (c *Context) SetTag(key, value string) {
-	if !validTagKey(key) {
-		return
-	}
-	value = truncateString(value)
-	if c.model.Tags == nil {
-		c.model.Tags = map[string]string{key: value}
-	} else {
-		c.model.Tags[key] = value
-	}
+	c.model.Tags = setTag(c.model.Tags, key, value)
 }
 
 // SetHTTPRequest sets details of the HTTP request in the context.
@@ -108,19 +112,31 @@ func (c *Context) SetHTTPRequest(req *http.Request) {
 	}
 	c.request = model.Request{
 		Body:        c.request.Body,
+		Trailers:    c.request.Trailers,
 		URL:         apmhttputil.RequestURL(req, forwarded),
 		Method:      truncateString(req.Method),
 		HTTPVersion: httpVersion,
-		Cookies:     req.Cookies(),
 	}
 	c.model.Request = &c.request
 
-	c.requestHeaders = model.RequestHeaders{
-		ContentType: req.Header.Get("Content-Type"),
-		Cookie:      strings.Join(req.Header["Cookie"], ";"),
-		UserAgent:   req.UserAgent(),
+	h := c.headerCapture
+	c.requestHeaders = model.RequestHeaders{}
+	if h.captureDefault("Content-Type") {
+		c.requestHeaders.ContentType = req.Header.Get("Content-Type")
 	}
-	if c.requestHeaders != (model.RequestHeaders{}) {
+	if h.captureDefault("Cookie") {
+		c.request.Cookies = req.Cookies()
+		c.requestHeaders.Cookie = strings.Join(req.Header["Cookie"], ";")
+	}
+	if h.captureDefault("User-Agent") || c.userAgentParsing == UserAgentParsingServer {
+		c.requestHeaders.UserAgent = req.UserAgent()
+	}
+	if c.userAgentParsing == UserAgentParsingClient {
+		c.setUserAgentTags(req.UserAgent())
+	}
+	c.requestHeaders.Other = h.appendOther(nil, req.Header)
+	if c.requestHeaders.ContentType != "" || c.requestHeaders.Cookie != "" ||
+		c.requestHeaders.UserAgent != "" || len(c.requestHeaders.Other) != 0 {
 		c.request.Headers = &c.requestHeaders
 	}
 
@@ -145,7 +161,11 @@ func (c *Context) SetHTTPRequest(req *http.Request) {
 // SetHTTPRequestBody sets the request body in context given a (possibly nil)
 // BodyCapturer returned by Tracer.CaptureHTTPRequestBody.
 func (c *Context) SetHTTPRequestBody(bc *BodyCapturer) {
-	if bc == nil || bc.captureBody&c.captureBodyMask == 0 {
+	mask := c.captureBodyMask
+	if atomic.LoadUint32(&c.captureFailureBody) != 0 {
+		mask |= CaptureBodyErrors
+	}
+	if bc == nil || bc.captureBody&mask == 0 {
 		return
 	}
 	if bc.setContext(&c.requestBody) {
@@ -153,10 +173,25 @@ func (c *Context) SetHTTPRequestBody(bc *BodyCapturer) {
 	}
 }
 
+// SetHTTPRequestTrailers sets the HTTP request trailers in the context.
+// Request trailers are only available once the request body has been
+// read in its entirety.
+func (c *Context) SetHTTPRequestTrailers(h http.Header) {
+	if len(h) == 0 {
+		return
+	}
+	c.request.Trailers = h
+	c.model.Request = &c.request
+}
+
 // SetHTTPResponseHeaders sets the HTTP response headers in the context.
 func (c *Context) SetHTTPResponseHeaders(h http.Header) {
-	c.responseHeaders.ContentType = h.Get("Content-Type")
-	if c.responseHeaders.ContentType != "" {
+	c.responseHeaders = model.ResponseHeaders{}
+	if c.headerCapture.captureDefault("Content-Type") {
+		c.responseHeaders.ContentType = h.Get("Content-Type")
+	}
+	c.responseHeaders.Other = c.headerCapture.appendOther(nil, h)
+	if c.responseHeaders.ContentType != "" || len(c.responseHeaders.Other) != 0 {
 		c.response.Headers = &c.responseHeaders
 		c.model.Response = &c.response
 	}
@@ -174,6 +209,15 @@ func (c *Context) SetHTTPResponseFinished(finished bool) {
 	c.model.Response = &c.response
 }
 
+// SetHTTPResponseTrailers sets the HTTP response trailers in the context.
+func (c *Context) SetHTTPResponseTrailers(h http.Header) {
+	if len(h) == 0 {
+		return
+	}
+	c.response.Trailers = h
+	c.model.Response = &c.response
+}
+
 // SetHTTPStatusCode records the HTTP response status code.
 func (c *Context) SetHTTPStatusCode(statusCode int) {
 	c.response.StatusCode = statusCode
@@ -0,0 +1,70 @@
+package elasticapm
+
+import "context"
+
+// CorrelationTagPrefix is the prefix of the tags with which correlation
+// IDs are recorded. Tag keys cannot contain '.', so a correlation ID
+// named "batch_id" is recorded in the tag "correlation_batch_id".
+const CorrelationTagPrefix = "correlation_"
+
+type contextCorrelationIDsKey struct{}
+
+// ContextWithCorrelationID returns a copy of parent which holds the
+// correlation ID with the given name and value, in addition to any
+// correlation IDs held by parent, and records the correlation ID in
+// the transaction in parent, if any. See Transaction.SetCorrelationID.
+//
+// Correlation IDs identify business operations spanning multiple
+// traces, such as batch jobs or workflow runs. Transactions started
+// for the operation should take the correlation IDs from the context
+// with WithCorrelationIDs:
+//
+//	ctx = elasticapm.ContextWithCorrelationID(ctx, "batch_id", batch.ID)
+//	for _, item := range batch.Items {
+//		tx := tracer.StartTransaction("process item", "batch",
+//			elasticapm.WithCorrelationIDs(elasticapm.CorrelationIDsFromContext(ctx)),
+//		)
+//		...
+//	}
+func ContextWithCorrelationID(parent context.Context, name, value string) context.Context {
+	if tx := TransactionFromContext(parent); tx != nil {
+		tx.SetCorrelationID(name, value)
+	}
+	parentIDs := CorrelationIDsFromContext(parent)
+	ids := make(map[string]string, len(parentIDs)+1)
+	for k, v := range parentIDs {
+		ids[k] = v
+	}
+	ids[name] = value
+	return context.WithValue(parent, contextCorrelationIDsKey{}, ids)
+}
+
+// CorrelationIDsFromContext returns the correlation IDs held by ctx,
+// keyed by name, as added with ContextWithCorrelationID. The returned
+// map must not be modified.
+func CorrelationIDsFromContext(ctx context.Context) map[string]string {
+	ids, _ := ctx.Value(contextCorrelationIDsKey{}).(map[string]string)
+	return ids
+}
+
+// SetCorrelationID records a correlation ID with the given name and
+// value in the transaction, in the tag named CorrelationTagPrefix+name,
+// so that all transactions for a business operation can be found.
+//
+// If name contains any of the characters '.', '*', or '"', or if the
+// transaction is not sampled, SetCorrelationID is a no-op.
+func (tx *Transaction) SetCorrelationID(name, value string) {
+	if !tx.Sampled() {
+		return
+	}
+	tx.Context.SetTag(CorrelationTagPrefix+name, value)
+}
+
+// WithCorrelationIDs returns a TransactionOption which records the
+// given correlation IDs, keyed by name, in the transaction. See
+// Transaction.SetCorrelationID.
+func WithCorrelationIDs(ids map[string]string) TransactionOption {
+	return func(o *transactionOptions) {
+		o.correlationIDs = ids
+	}
+}
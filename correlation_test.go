@@ -0,0 +1,40 @@
+package elasticapm_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestCorrelationIDs(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	batch := tracer.StartTransaction("batch", "type")
+	ctx := elasticapm.ContextWithTransaction(context.Background(), batch)
+	ctx = elasticapm.ContextWithCorrelationID(ctx, "batch_id", "b1")
+	ctx = elasticapm.ContextWithCorrelationID(ctx, "workflow_run", "w1")
+	assert.Equal(t, map[string]string{"batch_id": "b1", "workflow_run": "w1"}, elasticapm.CorrelationIDsFromContext(ctx))
+	assert.Nil(t, elasticapm.CorrelationIDsFromContext(context.Background()))
+
+	item := tracer.StartTransaction("item", "type",
+		elasticapm.WithCorrelationIDs(elasticapm.CorrelationIDsFromContext(ctx)),
+	)
+	item.SetCorrelationID("invalid.name", "ignored")
+	item.End()
+	batch.End()
+	tracer.Flush(nil)
+
+	transactions := transport.Payloads()[0].Transactions()
+	require.Len(t, transactions, 2)
+	expect := map[string]string{"correlation_batch_id": "b1", "correlation_workflow_run": "w1"}
+	for _, tx := range transactions {
+		require.NotNil(t, tx.Context)
+		assert.Equal(t, expect, tx.Context.Tags)
+	}
+}
@@ -0,0 +1,77 @@
+package elasticapm
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DeadlineRemainingTag is the span tag recording the number of
+	// milliseconds remaining until the context deadline when an exit
+	// span was started. See Tracer.SetSpanDeadlineBudget.
+	DeadlineRemainingTag = "deadline_remaining_ms"
+
+	// DeadlineBudgetExceededTag is the span tag recording whether an
+	// exit span consumed more than the configured fraction of the time
+	// remaining until the context deadline. See Tracer.SetSpanDeadlineBudget.
+	DeadlineBudgetExceededTag = "deadline_budget_exceeded"
+)
+
+// SetSpanDeadlineBudget sets the fraction of the remaining context
+// deadline which exit spans are expected to consume, in the range
+// (0,1.0], or disables deadline recording if fraction is zero.
+// Deadline recording is disabled by default.
+//
+// When enabled, exit spans (database and external spans) started with
+// StartSpan from a context with a deadline record the milliseconds
+// remaining until the deadline in the tag "deadline_remaining_ms", and
+// whether the span's duration exceeded fraction of that time in the tag
+// "deadline_budget_exceeded". This helps to identify the downstream
+// calls responsible for requests running out of time.
+//
+// SetSpanDeadlineBudget returns an error, leaving the configuration
+// unchanged, if fraction is outside the range [0,1.0].
+func (t *Tracer) SetSpanDeadlineBudget(fraction float64) error {
+	if !validSpanDeadlineBudget(fraction) {
+		return errors.Errorf("span deadline budget %v out of range [0,1.0]", fraction)
+	}
+	t.updateTransactionConfig(func(cfg *transactionConfig) {
+		cfg.spanDeadlineBudget = fraction
+	})
+	return nil
+}
+
+// validSpanDeadlineBudget reports whether fraction is a valid span
+// deadline budget, in the range [0,1.0]. NaN is not valid.
+func validSpanDeadlineBudget(fraction float64) bool {
+	return fraction >= 0 && fraction <= 1.0
+}
+
+// recordDeadline records the time remaining until the deadline of
+// ctx, if s is an exit span and deadline recording is enabled.
+func (s *Span) recordDeadline(ctx context.Context) {
+	if s.tx.spanDeadlineBudget <= 0 || !isExitSpanType(s.Type) {
+		return
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return
+	}
+	s.deadlineRemaining = deadline.Sub(s.Timestamp)
+	s.deadline = true
+}
+
+// setDeadlineTags sets the deadline tags for s, which must have
+// had its deadline recorded by recordDeadline.
+func (s *Span) setDeadlineTags() {
+	remaining := s.deadlineRemaining
+	if remaining < 0 {
+		remaining = 0
+	}
+	budget := time.Duration(float64(remaining) * s.tx.spanDeadlineBudget)
+	s.Context.SetTag(DeadlineRemainingTag, strconv.FormatInt(int64(remaining/time.Millisecond), 10))
+	s.Context.SetTag(DeadlineBudgetExceededTag, strconv.FormatBool(s.Duration > budget))
+}
@@ -0,0 +1,84 @@
+package elasticapm_test
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestTracerSpanDeadlineBudget(t *testing.T) {
+	tracer, r := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	require.NoError(t, tracer.SetSpanDeadlineBudget(0.5))
+
+	tx := tracer.StartTransaction("name", "type")
+	ctx := elasticapm.ContextWithTransaction(context.Background(), tx)
+	deadlineCtx, cancel := context.WithTimeout(ctx, time.Hour)
+	defer cancel()
+
+	span, _ := elasticapm.StartSpan(deadlineCtx, "slow", "db.postgresql.query")
+	span.Duration = 45 * time.Minute
+	span.End()
+	span, _ = elasticapm.StartSpan(deadlineCtx, "fast", "ext.http")
+	span.Duration = time.Millisecond
+	span.End()
+	span, _ = elasticapm.StartSpan(deadlineCtx, "internal", "template.html.render")
+	span.End()
+	span, _ = elasticapm.StartSpan(ctx, "nodeadline", "ext.http")
+	span.End()
+	tx.End()
+	tracer.Flush(nil)
+
+	payloads := r.Payloads()
+	require.Len(t, payloads, 1)
+	spans := payloads[0].Transactions()[0].Spans
+	require.Len(t, spans, 4)
+
+	for _, span := range spans[:2] {
+		require.NotNil(t, span.Context)
+		remaining, err := strconv.Atoi(span.Context.Tags["deadline_remaining_ms"])
+		require.NoError(t, err)
+		assert.InDelta(t, time.Hour/time.Millisecond, remaining, float64(time.Minute/time.Millisecond))
+	}
+	assert.Equal(t, "true", spans[0].Context.Tags["deadline_budget_exceeded"])
+	assert.Equal(t, "false", spans[1].Context.Tags["deadline_budget_exceeded"])
+	assert.Nil(t, spans[2].Context)
+	assert.Nil(t, spans[3].Context)
+}
+
+func TestTracerSpanDeadlineBudgetDisabled(t *testing.T) {
+	tracer, r := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	tx := tracer.StartTransaction("name", "type")
+	ctx := elasticapm.ContextWithTransaction(context.Background(), tx)
+	ctx, cancel := context.WithTimeout(ctx, time.Hour)
+	defer cancel()
+	span, _ := elasticapm.StartSpan(ctx, "name", "ext.http")
+	span.End()
+	tx.End()
+	tracer.Flush(nil)
+
+	spans := r.Payloads()[0].Transactions()[0].Spans
+	require.Len(t, spans, 1)
+	assert.Nil(t, spans[0].Context)
+}
+
+func TestTracerSpanDeadlineBudgetInvalid(t *testing.T) {
+	tracer, _ := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	assert.EqualError(t, tracer.SetSpanDeadlineBudget(-0.1), "span deadline budget -0.1 out of range [0,1.0]")
+	assert.EqualError(t, tracer.SetSpanDeadlineBudget(1.5), "span deadline budget 1.5 out of range [0,1.0]")
+	assert.EqualError(t, tracer.SetSpanDeadlineBudget(math.NaN()), "span deadline budget NaN out of range [0,1.0]")
+	assert.NoError(t, tracer.SetSpanDeadlineBudget(0))
+	assert.NoError(t, tracer.SetSpanDeadlineBudget(1))
+}
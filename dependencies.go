@@ -0,0 +1,40 @@
+package elasticapm
+
+import (
+	"sync"
+
+	"github.com/elastic/apm-agent-go/model"
+)
+
+var (
+	dependenciesOnce sync.Once
+	dependencies     []model.Dependency
+)
+
+// serviceDependencies returns the module dependencies of the
+// service, as recorded in the executable's build information.
+// If the build information is unavailable, e.g. because the
+// executable was not built in module mode, nil is returned.
+func serviceDependencies() []model.Dependency {
+	dependenciesOnce.Do(func() {
+		dependencies = readDependencies()
+	})
+	return dependencies
+}
+
+// setServiceDependencies sets service.Dependencies if dependency
+// reporting is enabled, and the dependencies have not yet been
+// reported.
+func (s *sender) setServiceDependencies(service *model.Service) {
+	if s.cfg.reportDependencies && !s.dependenciesReported {
+		service.Dependencies = serviceDependencies()
+	}
+}
+
+// serviceSent records that service was successfully sent to
+// the server, so dependencies are not reported again.
+func (s *sender) serviceSent(service *model.Service) {
+	if service.Dependencies != nil {
+		s.dependenciesReported = true
+	}
+}
@@ -0,0 +1,10 @@
+// +build !go1.12
+
+package elasticapm
+
+import "github.com/elastic/apm-agent-go/model"
+
+func readDependencies() []model.Dependency {
+	// Build information is only available in Go 1.12+.
+	return nil
+}
@@ -0,0 +1,30 @@
+// +build go1.12
+
+package elasticapm
+
+import (
+	"runtime/debug"
+
+	"github.com/elastic/apm-agent-go/model"
+)
+
+func readDependencies() []model.Dependency {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return nil
+	}
+	deps := make([]model.Dependency, len(info.Deps))
+	for i, dep := range info.Deps {
+		deps[i] = model.Dependency{
+			Path:    dep.Path,
+			Version: dep.Version,
+		}
+		if r := dep.Replace; r != nil {
+			deps[i].Replace = r.Path
+			if r.Version != "" {
+				deps[i].Replace += "@" + r.Version
+			}
+		}
+	}
+	return deps
+}
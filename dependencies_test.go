@@ -0,0 +1,60 @@
+// +build go1.12
+
+package elasticapm_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/model"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestTracerReportDependencies(t *testing.T) {
+	os.Setenv("ELASTIC_APM_REPORT_DEPENDENCIES", "true")
+	defer os.Unsetenv("ELASTIC_APM_REPORT_DEPENDENCIES")
+
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	for i := 0; i < 2; i++ {
+		tracer.StartTransaction("name", "type").End()
+		tracer.Flush(nil)
+	}
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads, 2)
+	service := payloads[0].Value.(*model.TransactionsPayload).Service
+	assert.Contains(t, dependencyPaths(service.Dependencies), "github.com/pkg/errors")
+	assert.Nil(t, payloads[1].Value.(*model.TransactionsPayload).Service.Dependencies)
+}
+
+func TestTracerReportDependenciesDefault(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.StartTransaction("name", "type").End()
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads, 1)
+	assert.Nil(t, payloads[0].Value.(*model.TransactionsPayload).Service.Dependencies)
+}
+
+func TestTracerReportDependenciesEnvInvalid(t *testing.T) {
+	os.Setenv("ELASTIC_APM_REPORT_DEPENDENCIES", "maybe")
+	defer os.Unsetenv("ELASTIC_APM_REPORT_DEPENDENCIES")
+
+	_, err := elasticapm.NewTracer("tracer_testing", "")
+	assert.EqualError(t, err, "failed to parse ELASTIC_APM_REPORT_DEPENDENCIES: strconv.ParseBool: parsing \"maybe\": invalid syntax")
+}
+
+func dependencyPaths(deps []model.Dependency) []string {
+	paths := make([]string, len(deps))
+	for i, dep := range deps {
+		paths[i] = dep.Path
+	}
+	return paths
+}
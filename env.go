@@ -12,6 +12,10 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
+
+	"github.com/elastic/apm-agent-go/internal/apmconfig"
+	"github.com/elastic/apm-agent-go/internal/apmstrings"
+	"github.com/elastic/apm-agent-go/model"
 )
 
 const (
@@ -19,14 +23,53 @@ const (
 	envMetricsInterval       = "ELASTIC_APM_METRICS_INTERVAL"
 	envMaxQueueSize          = "ELASTIC_APM_MAX_QUEUE_SIZE"
 	envMaxSpans              = "ELASTIC_APM_TRANSACTION_MAX_SPANS"
+	envSpanSamplingThreshold = "ELASTIC_APM_SPAN_SAMPLING_THRESHOLD"
 	envTransactionSampleRate = "ELASTIC_APM_TRANSACTION_SAMPLE_RATE"
 	envSanitizeFieldNames    = "ELASTIC_APM_SANITIZE_FIELD_NAMES"
 	envCaptureBody           = "ELASTIC_APM_CAPTURE_BODY"
+	envCaptureHeaders        = "ELASTIC_APM_CAPTURE_HEADERS"
+	envCaptureHeadersInclude = "ELASTIC_APM_CAPTURE_HEADERS_INCLUDE"
+	envCaptureHeadersExclude = "ELASTIC_APM_CAPTURE_HEADERS_EXCLUDE"
 	envServiceName           = "ELASTIC_APM_SERVICE_NAME"
 	envServiceVersion        = "ELASTIC_APM_SERVICE_VERSION"
 	envEnvironment           = "ELASTIC_APM_ENVIRONMENT"
 	envSpanFramesMinDuration = "ELASTIC_APM_SPAN_FRAMES_MIN_DURATION"
 	envActive                = "ELASTIC_APM_ACTIVE"
+	envMemoryBudget          = "ELASTIC_APM_MEMORY_BUDGET"
+	envDropUnsampled         = "ELASTIC_APM_DROP_UNSAMPLED_TRANSACTIONS"
+	envTagValueMaxLength     = "ELASTIC_APM_TAG_VALUE_MAX_LENGTH"
+	envTagValueMaxCard       = "ELASTIC_APM_TAG_VALUE_MAX_CARDINALITY"
+	envTagValueExactKeys     = "ELASTIC_APM_TAG_VALUE_EXACT_KEYS"
+	envSupervisorPid         = "ELASTIC_APM_SUPERVISOR_PID"
+	envSupervisorServiceName = "ELASTIC_APM_SUPERVISOR_SERVICE_NAME"
+	envReportDependencies    = "ELASTIC_APM_REPORT_DEPENDENCIES"
+	envMetricsWorkers        = "ELASTIC_APM_METRICS_WORKERS"
+	envLowPriority           = "ELASTIC_APM_LOW_PRIORITY"
+	envPipelineDepth         = "ELASTIC_APM_PIPELINE_DEPTH"
+	envQueueShedding         = "ELASTIC_APM_QUEUE_SHEDDING"
+	envCircuitThreshold      = "ELASTIC_APM_CIRCUIT_BREAKER_THRESHOLD"
+	envCircuitOpenDuration   = "ELASTIC_APM_CIRCUIT_BREAKER_OPEN_DURATION"
+	envForceSampleSecret     = "ELASTIC_APM_FORCE_SAMPLE_SECRET"
+	envTrustSamplingPriority = "ELASTIC_APM_TRUST_SAMPLING_PRIORITY"
+	envSyntheticUserAgents   = "ELASTIC_APM_SYNTHETIC_USER_AGENTS"
+	envSessionIDHeader       = "ELASTIC_APM_SESSION_ID_HEADER"
+	envSessionIDCookie       = "ELASTIC_APM_SESSION_ID_COOKIE"
+	envSchedulerLatency      = "ELASTIC_APM_SCHEDULER_LATENCY"
+	envBreakdownMetrics      = "ELASTIC_APM_BREAKDOWN_METRICS"
+	envUserAgentParsing      = "ELASTIC_APM_USER_AGENT_PARSING"
+	envSpanDeadlineBudget    = "ELASTIC_APM_SPAN_DEADLINE_BUDGET"
+	envTransactionResultMap  = "ELASTIC_APM_TRANSACTION_RESULT_MAP"
+	envSpanTypeOverrides     = "ELASTIC_APM_SPAN_TYPE_OVERRIDES"
+	envTimestampMaxAge       = "ELASTIC_APM_TIMESTAMP_MAX_AGE"
+	envTimestampMaxFuture    = "ELASTIC_APM_TIMESTAMP_MAX_FUTURE"
+	envClampTimestamps       = "ELASTIC_APM_CLAMP_TIMESTAMPS"
+	envClockSkewCorrection   = "ELASTIC_APM_CLOCK_SKEW_CORRECTION"
+	envSpanCompression       = "ELASTIC_APM_SPAN_COMPRESSION_ENABLED"
+	envExactMatchMaxDuration = "ELASTIC_APM_SPAN_COMPRESSION_EXACT_MATCH_MAX_DURATION"
+	envSameKindMaxDuration   = "ELASTIC_APM_SPAN_COMPRESSION_SAME_KIND_MAX_DURATION"
+	envFailureCapture        = "ELASTIC_APM_FAILURE_CAPTURE"
+	envBaggageToTags         = "ELASTIC_APM_BAGGAGE_TO_TAGS"
+	envRecentTransactions    = "ELASTIC_APM_RECENT_TRANSACTIONS"
 
 	defaultFlushInterval           = 10 * time.Second
 	defaultMetricsInterval         = 0 // disabled by default
@@ -34,6 +77,8 @@ const (
 	defaultMaxSpans                = 500
 	defaultCaptureBody             = CaptureBodyOff
 	defaultSpanFramesMinDuration   = 5 * time.Millisecond
+	defaultMemoryBudget            = 0 // unlimited by default
+	defaultRecentTransactions      = 0
 )
 
 var (
@@ -59,7 +104,7 @@ func initialMetricsInterval() (time.Duration, error) {
 }
 
 func initialMaxTransactionQueueSize() (int, error) {
-	value := os.Getenv(envMaxQueueSize)
+	value := apmconfig.Getenv(envMaxQueueSize)
 	if value == "" {
 		return defaultMaxTransactionQueueSize, nil
 	}
@@ -71,7 +116,7 @@ func initialMaxTransactionQueueSize() (int, error) {
 }
 
 func initialMaxSpans() (int, error) {
-	value := os.Getenv(envMaxSpans)
+	value := apmconfig.Getenv(envMaxSpans)
 	if value == "" {
 		return defaultMaxSpans, nil
 	}
@@ -82,9 +127,33 @@ func initialMaxSpans() (int, error) {
 	return max, nil
 }
 
+func initialRecentTransactions() (int, error) {
+	value := apmconfig.Getenv(envRecentTransactions)
+	if value == "" {
+		return defaultRecentTransactions, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to parse %s", envRecentTransactions)
+	}
+	return n, nil
+}
+
 // initialSampler returns a nil Sampler if all transactions should be sampled.
+func initialSpanSamplingThreshold() (int, error) {
+	value := apmconfig.Getenv(envSpanSamplingThreshold)
+	if value == "" {
+		return 0, nil
+	}
+	threshold, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to parse %s", envSpanSamplingThreshold)
+	}
+	return threshold, nil
+}
+
 func initialSampler() (Sampler, error) {
-	value := os.Getenv(envTransactionSampleRate)
+	value := apmconfig.Getenv(envTransactionSampleRate)
 	if value == "" || value == "1.0" {
 		return nil, nil
 	}
@@ -103,7 +172,7 @@ func initialSampler() (Sampler, error) {
 }
 
 func initialSanitizedFieldNamesRegexp() (*regexp.Regexp, error) {
-	value := os.Getenv(envSanitizeFieldNames)
+	value := apmconfig.Getenv(envSanitizeFieldNames)
 	if value == "" {
 		return defaultSanitizedFieldNames, nil
 	}
@@ -116,7 +185,7 @@ func initialSanitizedFieldNamesRegexp() (*regexp.Regexp, error) {
 }
 
 func initialCaptureBody() (CaptureBodyMode, error) {
-	value := os.Getenv(envCaptureBody)
+	value := apmconfig.Getenv(envCaptureBody)
 	if value == "" {
 		return defaultCaptureBody, nil
 	}
@@ -133,10 +202,99 @@ func initialCaptureBody() (CaptureBodyMode, error) {
 	return -1, errors.Errorf("invalid %s value %q", envCaptureBody, value)
 }
 
+func initialBreakdownMetrics() (BreakdownMetricsMode, error) {
+	value := apmconfig.Getenv(envBreakdownMetrics)
+	if value == "" {
+		return BreakdownMetricsOff, nil
+	}
+	switch strings.TrimSpace(strings.ToLower(value)) {
+	case "off":
+		return BreakdownMetricsOff, nil
+	case "type":
+		return BreakdownMetricsSpanType, nil
+	case "destination":
+		return BreakdownMetricsDestination, nil
+	}
+	return BreakdownMetricsOff, errors.Errorf("invalid %s value %q", envBreakdownMetrics, value)
+}
+
+func initialUserAgentParsing() (UserAgentParsingMode, error) {
+	value := apmconfig.Getenv(envUserAgentParsing)
+	if value == "" {
+		return UserAgentParsingOff, nil
+	}
+	switch strings.TrimSpace(strings.ToLower(value)) {
+	case "off":
+		return UserAgentParsingOff, nil
+	case "client":
+		return UserAgentParsingClient, nil
+	case "server":
+		return UserAgentParsingServer, nil
+	}
+	return UserAgentParsingOff, errors.Errorf("invalid %s value %q", envUserAgentParsing, value)
+}
+
+func initialQueueShedding() (QueueSheddingMode, error) {
+	value := apmconfig.Getenv(envQueueShedding)
+	if value == "" {
+		return QueueSheddingOldest, nil
+	}
+	switch strings.TrimSpace(strings.ToLower(value)) {
+	case "oldest":
+		return QueueSheddingOldest, nil
+	case "priority":
+		return QueueSheddingPriority, nil
+	}
+	return QueueSheddingOldest, errors.Errorf("invalid %s value %q", envQueueShedding, value)
+}
+
+func initialCaptureHeaders() (bool, error) {
+	value := apmconfig.Getenv(envCaptureHeaders)
+	if value == "" {
+		return true, nil
+	}
+	capture, err := strconv.ParseBool(value)
+	if err != nil {
+		return true, errors.Wrapf(err, "failed to parse %s", envCaptureHeaders)
+	}
+	return capture, nil
+}
+
+func initialHeaderCaptureFilter() HeaderCaptureFilter {
+	return HeaderCaptureFilter{
+		Include: splitEnvList(envCaptureHeadersInclude),
+		Exclude: splitEnvList(envCaptureHeadersExclude),
+	}
+}
+
+// splitEnvList returns the non-empty, comma-separated
+// items in the value of the given environment variable.
+func splitEnvList(envKey string) []string {
+	var items []string
+	for _, item := range strings.Split(apmconfig.Getenv(envKey), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func initialSyntheticUserAgents() []string {
+	if patterns := splitEnvList(envSyntheticUserAgents); len(patterns) != 0 {
+		return patterns
+	}
+	return defaultSyntheticUserAgents
+}
+
 func initialService() (name, version, environment string) {
-	name = os.Getenv(envServiceName)
-	version = os.Getenv(envServiceVersion)
-	environment = os.Getenv(envEnvironment)
+	name = apmconfig.Getenv(envServiceName)
+	version = apmconfig.Getenv(envServiceVersion)
+	environment = apmconfig.Getenv(envEnvironment)
+	if name == "" {
+		// Worker processes started by a supervisor report
+		// the supervisor's service name. See ChildProcessEnv.
+		name = apmconfig.Getenv(envSupervisorServiceName)
+	}
 	if name == "" {
 		name = filepath.Base(os.Args[0])
 		if runtime.GOOS == "windows" {
@@ -147,12 +305,310 @@ func initialService() (name, version, environment string) {
 	return name, version, environment
 }
 
+func initialForceSampleSecret() string {
+	return apmconfig.Getenv(envForceSampleSecret)
+}
+
+func initialSessionIDSource() (header, cookie string) {
+	return apmconfig.Getenv(envSessionIDHeader), apmconfig.Getenv(envSessionIDCookie)
+}
+
+// initialSpanDeadlineBudget returns zero if exit spans should
+// not record their context deadline.
+func initialSpanDeadlineBudget() (float64, error) {
+	value := apmconfig.Getenv(envSpanDeadlineBudget)
+	if value == "" {
+		return 0, nil
+	}
+	budget, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to parse %s", envSpanDeadlineBudget)
+	}
+	if !validSpanDeadlineBudget(budget) {
+		return 0, errors.Errorf(
+			"invalid %s value %s: out of range [0,1.0]",
+			envSpanDeadlineBudget, value,
+		)
+	}
+	return budget, nil
+}
+
+// initialFailureCapture returns FailureCaptureOff if no additional
+// detail should be captured for failed transactions.
+func initialFailureCapture() (FailureCaptureMode, error) {
+	items := splitEnvList(envFailureCapture)
+	var mode FailureCaptureMode
+	for _, item := range items {
+		switch strings.ToLower(item) {
+		case "off":
+		case "all":
+			mode |= FailureCaptureAll
+		case "body":
+			mode |= FailureCaptureBody
+		case "stacktraces":
+			mode |= FailureCaptureStacktraces
+		case "spans":
+			mode |= FailureCaptureSpans
+		default:
+			return FailureCaptureOff, errors.Errorf("invalid %s value %q", envFailureCapture, item)
+		}
+	}
+	return mode, nil
+}
+
+// initialResultMapper returns a nil ResultMapper if
+// transaction results should not be mapped.
+func initialResultMapper() (ResultMapper, error) {
+	items := splitEnvList(envTransactionResultMap)
+	if len(items) == 0 {
+		return nil, nil
+	}
+	m := make(map[string]string, len(items))
+	for _, item := range items {
+		i := strings.IndexRune(item, '=')
+		if i <= 0 {
+			return nil, errors.Errorf(
+				"invalid %s value %q: expected result=replacement",
+				envTransactionResultMap, item,
+			)
+		}
+		m[strings.TrimSpace(item[:i])] = strings.TrimSpace(item[i+1:])
+	}
+	return RenameResults(m), nil
+}
+
+func initialSpanTypeOverrides() ([]SpanTypeOverride, error) {
+	var overrides []SpanTypeOverride
+	for _, item := range splitEnvList(envSpanTypeOverrides) {
+		i := strings.LastIndex(item, "=")
+		if i <= 0 || strings.TrimSpace(item[i+1:]) == "" {
+			return nil, errors.Errorf(
+				"invalid %s value %q: expected destination=type",
+				envSpanTypeOverrides, item,
+			)
+		}
+		overrides = append(overrides, SpanTypeOverride{
+			Destination: strings.TrimSpace(item[:i]),
+			Type:        strings.TrimSpace(item[i+1:]),
+		})
+	}
+	return overrides, nil
+}
+
 func initialSpanFramesMinDuration() (time.Duration, error) {
 	return parseEnvDuration(envSpanFramesMinDuration, "", defaultSpanFramesMinDuration)
 }
 
+func initialMemoryBudget() (int64, error) {
+	value := apmconfig.Getenv(envMemoryBudget)
+	if value == "" {
+		return defaultMemoryBudget, nil
+	}
+	size, err := apmstrings.ParseSize(value)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to parse %s", envMemoryBudget)
+	}
+	return size, nil
+}
+
+func initialDropUnsampled() (dropUnsampledMode, error) {
+	value := apmconfig.Getenv(envDropUnsampled)
+	if value == "" || strings.EqualFold(value, "auto") {
+		return dropUnsampledAuto, nil
+	}
+	drop, err := strconv.ParseBool(value)
+	if err != nil {
+		return dropUnsampledAuto, errors.Wrapf(err, "failed to parse %s", envDropUnsampled)
+	}
+	if drop {
+		return dropUnsampledAlways, nil
+	}
+	return dropUnsampledNever, nil
+}
+
+func initialTagValueLimits() (TagValueLimits, error) {
+	var limits TagValueLimits
+	if value := apmconfig.Getenv(envTagValueMaxLength); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return TagValueLimits{}, errors.Wrapf(err, "failed to parse %s", envTagValueMaxLength)
+		}
+		limits.MaxLength = n
+	}
+	if value := apmconfig.Getenv(envTagValueMaxCard); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return TagValueLimits{}, errors.Wrapf(err, "failed to parse %s", envTagValueMaxCard)
+		}
+		limits.MaxCardinality = n
+	}
+	limits.ExactKeys = splitEnvList(envTagValueExactKeys)
+	return limits, nil
+}
+
+// initialSupervisor returns a nil ProcessSupervisor if the process
+// was not started by a supervisor process. See ChildProcessEnv.
+func initialSupervisor() (*model.ProcessSupervisor, error) {
+	value := apmconfig.Getenv(envSupervisorPid)
+	if value == "" {
+		return nil, nil
+	}
+	pid, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s", envSupervisorPid)
+	}
+	return &model.ProcessSupervisor{
+		Pid:         pid,
+		ServiceName: truncateString(apmconfig.Getenv(envSupervisorServiceName)),
+	}, nil
+}
+
+func initialReportDependencies() (bool, error) {
+	value := apmconfig.Getenv(envReportDependencies)
+	if value == "" {
+		return false, nil
+	}
+	report, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to parse %s", envReportDependencies)
+	}
+	return report, nil
+}
+
+func initialMetricsWorkers() (int, error) {
+	value := apmconfig.Getenv(envMetricsWorkers)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to parse %s", envMetricsWorkers)
+	}
+	return n, nil
+}
+
+func initialLowPriority() (bool, error) {
+	value := apmconfig.Getenv(envLowPriority)
+	if value == "" {
+		return false, nil
+	}
+	lowPriority, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to parse %s", envLowPriority)
+	}
+	return lowPriority, nil
+}
+
+func initialTrustSamplingPriority() (bool, error) {
+	value := apmconfig.Getenv(envTrustSamplingPriority)
+	if value == "" {
+		return false, nil
+	}
+	trust, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to parse %s", envTrustSamplingPriority)
+	}
+	return trust, nil
+}
+
+func initialSchedulerLatency() (bool, error) {
+	value := apmconfig.Getenv(envSchedulerLatency)
+	if value == "" {
+		return false, nil
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to parse %s", envSchedulerLatency)
+	}
+	return enabled, nil
+}
+
+func initialPipelineDepth() (int, error) {
+	value := apmconfig.Getenv(envPipelineDepth)
+	if value == "" {
+		return 1, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to parse %s", envPipelineDepth)
+	}
+	return n, nil
+}
+
+func initialCircuitBreakerThreshold() (int, error) {
+	value := apmconfig.Getenv(envCircuitThreshold)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to parse %s", envCircuitThreshold)
+	}
+	return n, nil
+}
+
+func initialCircuitBreakerOpenDuration() (time.Duration, error) {
+	return parseEnvDuration(envCircuitOpenDuration, "s", defaultCircuitBreakerOpenDuration)
+}
+
+func initialTimestampLimits() (TimestampLimits, error) {
+	var limits TimestampLimits
+	maxAge, err := parseEnvDuration(envTimestampMaxAge, "s", 0)
+	if err != nil {
+		return TimestampLimits{}, err
+	}
+	maxFuture, err := parseEnvDuration(envTimestampMaxFuture, "s", 0)
+	if err != nil {
+		return TimestampLimits{}, err
+	}
+	limits.MaxAge = maxAge
+	limits.MaxFuture = maxFuture
+	if value := apmconfig.Getenv(envClampTimestamps); value != "" {
+		clamp, err := strconv.ParseBool(value)
+		if err != nil {
+			return TimestampLimits{}, errors.Wrapf(err, "failed to parse %s", envClampTimestamps)
+		}
+		limits.Clamp = clamp
+	}
+	return limits, nil
+}
+
+func initialClockSkewCorrection() (bool, error) {
+	value := apmconfig.Getenv(envClockSkewCorrection)
+	if value == "" {
+		return false, nil
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to parse %s", envClockSkewCorrection)
+	}
+	return enabled, nil
+}
+
+func initialSpanCompression() (spanCompressionConfig, error) {
+	cfg := spanCompressionConfig{exactMatchMaxDuration: defaultSpanCompressionExactMatchMaxDuration}
+	if value := apmconfig.Getenv(envSpanCompression); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return cfg, errors.Wrapf(err, "failed to parse %s", envSpanCompression)
+		}
+		cfg.enabled = enabled
+	}
+	exactMatchMaxDuration, err := parseEnvDuration(envExactMatchMaxDuration, "ms", defaultSpanCompressionExactMatchMaxDuration)
+	if err != nil {
+		return cfg, err
+	}
+	sameKindMaxDuration, err := parseEnvDuration(envSameKindMaxDuration, "ms", 0)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.exactMatchMaxDuration = exactMatchMaxDuration
+	cfg.sameKindMaxDuration = sameKindMaxDuration
+	return cfg, nil
+}
+
 func initialActive() (bool, error) {
-	value := os.Getenv(envActive)
+	value := apmconfig.Getenv(envActive)
 	if value == "" {
 		return true, nil
 	}
@@ -164,7 +620,7 @@ func initialActive() (bool, error) {
 }
 
 func parseEnvDuration(envKey, defaultSuffix string, defaultDuration time.Duration) (time.Duration, error) {
-	value := os.Getenv(envKey)
+	value := apmconfig.Getenv(envKey)
 	if value == "" {
 		return defaultDuration, nil
 	}
@@ -2,6 +2,7 @@ package elasticapm_test
 
 import (
 	"context"
+	"math/rand"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -170,6 +171,9 @@ func testTracerServiceNameSanitization(t *testing.T, sanitizedServiceName string
 }
 
 func TestTracerCaptureBodyEnv(t *testing.T) {
+	if !elasticapm.BodyCaptureEnabled {
+		t.Skip("body capture is compiled out")
+	}
 	test := func(t *testing.T, envValue string) {
 		testTracerCaptureBodyEnv(t, envValue, true)
 	}
@@ -221,6 +225,9 @@ func testTracerCaptureBodyEnv(t *testing.T, envValue string, expectBody bool) {
 }
 
 func TestTracerSpanFramesMinDurationEnv(t *testing.T) {
+	if !elasticapm.StacktraceEnabled {
+		t.Skip("stack traces are compiled out")
+	}
 	os.Setenv("ELASTIC_APM_SPAN_FRAMES_MIN_DURATION", "10ms")
 	defer os.Unsetenv("ELASTIC_APM_SPAN_FRAMES_MIN_DURATION")
 
@@ -279,3 +286,274 @@ func TestTracerActiveInvalid(t *testing.T) {
 	_, err := elasticapm.NewTracer("tracer_testing", "")
 	assert.EqualError(t, err, "failed to parse ELASTIC_APM_ACTIVE: strconv.ParseBool: parsing \"yep\": invalid syntax")
 }
+
+func TestTracerMemoryBudgetEnv(t *testing.T) {
+	os.Setenv("ELASTIC_APM_MEMORY_BUDGET", "64KB")
+	defer os.Unsetenv("ELASTIC_APM_MEMORY_BUDGET")
+
+	tracer, err := elasticapm.NewTracer("tracer_testing", "")
+	require.NoError(t, err)
+	defer tracer.Close()
+	assert.Equal(t, int64(64*1024), tracer.Stats().MemoryBudget)
+}
+
+func TestTracerMemoryBudgetEnvInvalid(t *testing.T) {
+	os.Setenv("ELASTIC_APM_MEMORY_BUDGET", "lots")
+	defer os.Unsetenv("ELASTIC_APM_MEMORY_BUDGET")
+
+	_, err := elasticapm.NewTracer("tracer_testing", "")
+	assert.EqualError(t, err, "failed to parse ELASTIC_APM_MEMORY_BUDGET: strconv.ParseInt: parsing \"LOTS\": invalid syntax")
+}
+
+func TestTracerDropUnsampledTransactionsEnv(t *testing.T) {
+	os.Setenv("ELASTIC_APM_DROP_UNSAMPLED_TRANSACTIONS", "true")
+	defer os.Unsetenv("ELASTIC_APM_DROP_UNSAMPLED_TRANSACTIONS")
+
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetSampler(elasticapm.NewRatioSampler(0, rand.NewSource(0)))
+	tracer.StartTransaction("name", "type").End()
+	tracer.Flush(nil)
+	assert.Empty(t, transport.Payloads())
+	assert.Equal(t, uint64(1), tracer.Stats().TransactionsUnsent)
+}
+
+func TestTracerDropUnsampledTransactionsEnvInvalid(t *testing.T) {
+	os.Setenv("ELASTIC_APM_DROP_UNSAMPLED_TRANSACTIONS", "sometimes")
+	defer os.Unsetenv("ELASTIC_APM_DROP_UNSAMPLED_TRANSACTIONS")
+
+	_, err := elasticapm.NewTracer("tracer_testing", "")
+	assert.EqualError(t, err, "failed to parse ELASTIC_APM_DROP_UNSAMPLED_TRANSACTIONS: strconv.ParseBool: parsing \"sometimes\": invalid syntax")
+}
+
+func TestTracerTagValueLimitsEnv(t *testing.T) {
+	os.Setenv("ELASTIC_APM_TAG_VALUE_MAX_LENGTH", "8")
+	defer os.Unsetenv("ELASTIC_APM_TAG_VALUE_MAX_LENGTH")
+	os.Setenv("ELASTIC_APM_TAG_VALUE_EXACT_KEYS", "foo, bar")
+	defer os.Unsetenv("ELASTIC_APM_TAG_VALUE_EXACT_KEYS")
+
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tx := tracer.StartTransaction("name", "type")
+	tx.Context.SetTag("foo", "exactly-recorded")
+	tx.Context.SetTag("bar", "exactly-recorded")
+	tx.Context.SetTag("baz", "not-exactly-recorded")
+	tx.End()
+	tracer.Flush(nil)
+
+	tags := transport.Payloads()[0].Transactions()[0].Context.Tags
+	assert.Equal(t, "exactly-recorded", tags["foo"])
+	assert.Equal(t, "exactly-recorded", tags["bar"])
+	assert.Regexp(t, "^hash:[0-9a-f]{16}$", tags["baz"])
+}
+
+func TestTracerTagValueLimitsEnvInvalid(t *testing.T) {
+	os.Setenv("ELASTIC_APM_TAG_VALUE_MAX_CARDINALITY", "many")
+	defer os.Unsetenv("ELASTIC_APM_TAG_VALUE_MAX_CARDINALITY")
+
+	_, err := elasticapm.NewTracer("tracer_testing", "")
+	assert.EqualError(t, err, "failed to parse ELASTIC_APM_TAG_VALUE_MAX_CARDINALITY: strconv.Atoi: parsing \"many\": invalid syntax")
+}
+
+func TestTracerSpanDeadlineBudgetEnvInvalid(t *testing.T) {
+	os.Setenv("ELASTIC_APM_SPAN_DEADLINE_BUDGET", "1.5")
+	defer os.Unsetenv("ELASTIC_APM_SPAN_DEADLINE_BUDGET")
+
+	_, err := elasticapm.NewTracer("tracer_testing", "")
+	assert.EqualError(t, err, "invalid ELASTIC_APM_SPAN_DEADLINE_BUDGET value 1.5: out of range [0,1.0]")
+
+	os.Setenv("ELASTIC_APM_SPAN_DEADLINE_BUDGET", "-0.5")
+	_, err = elasticapm.NewTracer("tracer_testing", "")
+	assert.EqualError(t, err, "invalid ELASTIC_APM_SPAN_DEADLINE_BUDGET value -0.5: out of range [0,1.0]")
+
+	os.Setenv("ELASTIC_APM_SPAN_DEADLINE_BUDGET", "NaN")
+	_, err = elasticapm.NewTracer("tracer_testing", "")
+	assert.EqualError(t, err, "invalid ELASTIC_APM_SPAN_DEADLINE_BUDGET value NaN: out of range [0,1.0]")
+}
+
+func TestTracerCaptureHeadersEnv(t *testing.T) {
+	os.Setenv("ELASTIC_APM_CAPTURE_HEADERS_INCLUDE", "X-Request-Id")
+	defer os.Unsetenv("ELASTIC_APM_CAPTURE_HEADERS_INCLUDE")
+	os.Setenv("ELASTIC_APM_CAPTURE_HEADERS_EXCLUDE", "User-Agent")
+	defer os.Unsetenv("ELASTIC_APM_CAPTURE_HEADERS_EXCLUDE")
+
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("User-Agent", "test")
+	req.Header.Set("X-Request-Id", "abc")
+	tx := tracer.StartTransaction("name", "type")
+	tx.Context.SetHTTPRequest(req)
+	tx.End()
+	tracer.Flush(nil)
+
+	headers := transport.Payloads()[0].Transactions()[0].Context.Request.Headers
+	require.NotNil(t, headers)
+	assert.Equal(t, "", headers.UserAgent)
+	assert.Equal(t, model.StringMap{{Key: "x-request-id", Value: "abc"}}, headers.Other)
+}
+
+func TestTracerCaptureHeadersEnvInvalid(t *testing.T) {
+	os.Setenv("ELASTIC_APM_CAPTURE_HEADERS", "maybe")
+	defer os.Unsetenv("ELASTIC_APM_CAPTURE_HEADERS")
+
+	_, err := elasticapm.NewTracer("tracer_testing", "")
+	assert.EqualError(t, err, "failed to parse ELASTIC_APM_CAPTURE_HEADERS: strconv.ParseBool: parsing \"maybe\": invalid syntax")
+}
+
+func TestTracerTransactionResultMapEnv(t *testing.T) {
+	os.Setenv("ELASTIC_APM_TRANSACTION_RESULT_MAP", "HTTP 2xx=success, HTTP 3xx=success")
+	defer os.Unsetenv("ELASTIC_APM_TRANSACTION_RESULT_MAP")
+
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tx := tracer.StartTransaction("name", "type")
+	tx.SetResult(elasticapm.ResultInfo{Result: "HTTP 3xx"})
+	tx.End()
+	tracer.Flush(nil)
+
+	assert.Equal(t, "success", transport.Payloads()[0].Transactions()[0].Result)
+}
+
+func TestTracerTransactionResultMapEnvInvalid(t *testing.T) {
+	os.Setenv("ELASTIC_APM_TRANSACTION_RESULT_MAP", "HTTP 2xx")
+	defer os.Unsetenv("ELASTIC_APM_TRANSACTION_RESULT_MAP")
+
+	_, err := elasticapm.NewTracer("tracer_testing", "")
+	assert.EqualError(t, err, `invalid ELASTIC_APM_TRANSACTION_RESULT_MAP value "HTTP 2xx": expected result=replacement`)
+}
+
+func TestTracerFailureCaptureEnv(t *testing.T) {
+	os.Setenv("ELASTIC_APM_FAILURE_CAPTURE", "spans, stacktraces")
+	defer os.Unsetenv("ELASTIC_APM_FAILURE_CAPTURE")
+
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetMaxSpans(1)
+
+	tx := tracer.StartTransaction("name", "type")
+	tx.MarkFailed()
+	tx.StartSpan("one", "type", nil).End()
+	tx.StartSpan("two", "type", nil).End()
+	tx.End()
+	tracer.Flush(nil)
+
+	assert.Len(t, transport.Payloads()[0].Transactions()[0].Spans, 2)
+}
+
+func TestTracerFailureCaptureEnvInvalid(t *testing.T) {
+	os.Setenv("ELASTIC_APM_FAILURE_CAPTURE", "body,everything")
+	defer os.Unsetenv("ELASTIC_APM_FAILURE_CAPTURE")
+
+	_, err := elasticapm.NewTracer("tracer_testing", "")
+	assert.EqualError(t, err, `invalid ELASTIC_APM_FAILURE_CAPTURE value "everything"`)
+}
+
+func TestTracerBaggageToTagsEnv(t *testing.T) {
+	os.Setenv("ELASTIC_APM_BAGGAGE_TO_TAGS", "tenant, region")
+	defer os.Unsetenv("ELASTIC_APM_BAGGAGE_TO_TAGS")
+
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	b := elasticapm.ParseBaggage("tenant=acme,region=eu,user=bob")
+	tracer.StartTransaction("name", "type", elasticapm.WithBaggage(b)).End()
+	tracer.Flush(nil)
+
+	tags := transport.Payloads()[0].Transactions()[0].Context.Tags
+	assert.Equal(t, map[string]string{"baggage_tenant": "acme", "baggage_region": "eu"}, tags)
+}
+
+func TestTracerSpanTypeOverridesEnv(t *testing.T) {
+	os.Setenv("ELASTIC_APM_SPAN_TYPE_OVERRIDES", "billing.internal*=external.billing")
+	defer os.Unsetenv("ELASTIC_APM_SPAN_TYPE_OVERRIDES")
+
+	tracer, err := elasticapm.NewTracer("tracer_testing", "")
+	require.NoError(t, err)
+	defer tracer.Close()
+	tx := tracer.StartTransaction("name", "type")
+	ctx := elasticapm.ContextWithTransaction(context.Background(), tx)
+	assert.Equal(t, "external.billing", elasticapm.OverrideSpanType(ctx, "apmhttp", "ext.http", "billing.internal:8080"))
+	assert.Equal(t, "ext.http", elasticapm.OverrideSpanType(ctx, "apmhttp", "ext.http", "example.com"))
+}
+
+func TestTracerSpanTypeOverridesEnvInvalid(t *testing.T) {
+	os.Setenv("ELASTIC_APM_SPAN_TYPE_OVERRIDES", "billing.internal")
+	defer os.Unsetenv("ELASTIC_APM_SPAN_TYPE_OVERRIDES")
+
+	_, err := elasticapm.NewTracer("tracer_testing", "")
+	assert.EqualError(t, err, `invalid ELASTIC_APM_SPAN_TYPE_OVERRIDES value "billing.internal": expected destination=type`)
+}
+
+func TestTracerBreakdownMetricsEnvInvalid(t *testing.T) {
+	os.Setenv("ELASTIC_APM_BREAKDOWN_METRICS", "instance")
+	defer os.Unsetenv("ELASTIC_APM_BREAKDOWN_METRICS")
+
+	_, err := elasticapm.NewTracer("tracer_testing", "")
+	assert.EqualError(t, err, `invalid ELASTIC_APM_BREAKDOWN_METRICS value "instance"`)
+}
+
+func TestTracerProfile(t *testing.T) {
+	err := elasticapm.RegisterProfile("profile_testing", map[string]string{
+		"ELASTIC_APM_TRANSACTION_SAMPLE_RATE": "0",
+	})
+	require.NoError(t, err)
+	os.Setenv("ELASTIC_APM_PROFILE", "profile_testing")
+	defer os.Unsetenv("ELASTIC_APM_PROFILE")
+
+	tracer, err := elasticapm.NewTracer("tracer_testing", "")
+	require.NoError(t, err)
+	tx := tracer.StartTransaction("name", "type")
+	assert.False(t, tx.Sampled())
+	tx.Discard()
+	tracer.Close()
+
+	// Environment variables take precedence over the profile.
+	os.Setenv("ELASTIC_APM_TRANSACTION_SAMPLE_RATE", "1")
+	defer os.Unsetenv("ELASTIC_APM_TRANSACTION_SAMPLE_RATE")
+	tracer, err = elasticapm.NewTracer("tracer_testing", "")
+	require.NoError(t, err)
+	defer tracer.Close()
+	tx = tracer.StartTransaction("name", "type")
+	assert.True(t, tx.Sampled())
+	tx.Discard()
+}
+
+func TestRegisterProfileDefaultTracer(t *testing.T) {
+	os.Setenv("ELASTIC_APM_PROFILE", "profile_testing_default")
+	defer os.Unsetenv("ELASTIC_APM_PROFILE")
+	defer elasticapm.RegisterProfile("profile_testing_default", nil)
+
+	// The selected profile is applied to DefaultTracer in place,
+	// so references to it taken beforehand remain valid.
+	tracer := elasticapm.DefaultTracer
+	err := elasticapm.RegisterProfile("profile_testing_default", map[string]string{
+		"ELASTIC_APM_TRANSACTION_SAMPLE_RATE": "0",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, tracer, elasticapm.DefaultTracer)
+	tx := tracer.StartTransaction("name", "type")
+	assert.False(t, tx.Sampled())
+	tx.Discard()
+
+	err = elasticapm.RegisterProfile("profile_testing_default", map[string]string{
+		"ELASTIC_APM_TRANSACTION_SAMPLE_RATE": "2.0",
+	})
+	assert.EqualError(t, err, "invalid ELASTIC_APM_TRANSACTION_SAMPLE_RATE value 2.0: out of range [0,1.0]")
+	tx = tracer.StartTransaction("name", "type")
+	assert.False(t, tx.Sampled())
+	tx.Discard()
+}
+
+func TestTracerProfileUnknown(t *testing.T) {
+	os.Setenv("ELASTIC_APM_PROFILE", "unknown_profile")
+	defer os.Unsetenv("ELASTIC_APM_PROFILE")
+
+	_, err := elasticapm.NewTracer("tracer_testing", "")
+	assert.EqualError(t, err, `unknown ELASTIC_APM_PROFILE value "unknown_profile"`)
+}
+
+func TestRegisterProfileInvalidSetting(t *testing.T) {
+	assert.Panics(t, func() {
+		elasticapm.RegisterProfile("profile_testing", map[string]string{"FLUSH_INTERVAL": "1s"})
+	})
+}
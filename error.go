@@ -35,6 +35,15 @@ func (t *Tracer) Recover(tx *Transaction) {
 // fmt.Errorf("%v", v). The value v is expected to have
 // come from a panic.
 //
+// If v does not implement error, the exception module and
+// type will be set to the package and type name of v, and
+// the exception attributes will record the full type name,
+// the result of v's String method if it implements
+// fmt.Stringer, and the numeric value of v if it is a number.
+//
+// If the stacktrace was taken by NewError, it will be trimmed
+// such that it begins at the panic site.
+//
 // The resulting error's Transaction will be set to tx,
 func (t *Tracer) Recovered(v interface{}, tx *Transaction) *Error {
 	var e *Error
@@ -43,11 +52,60 @@ func (t *Tracer) Recovered(v interface{}, tx *Transaction) *Error {
 		e = t.NewError(v)
 	default:
 		e = t.NewError(fmt.Errorf("%v", v))
+		initPanicException(&e.model.Exception, v)
 	}
+	e.trimPanicStacktrace()
 	e.Transaction = tx
+	if tx != nil && tx.sessionID != "" {
+		e.Context.SetTag(SessionIDTag, tx.sessionID)
+	}
 	return e
 }
 
+// initPanicException sets the exception module, type, and attributes
+// based on the non-error panic value v.
+func initPanicException(e *model.Exception, v interface{}) {
+	e.Module, e.Type, e.Attributes = "", "", nil
+	if v == nil {
+		return
+	}
+	t := reflect.TypeOf(v)
+	e.Module = t.PkgPath()
+	e.Type = t.Name()
+	if e.Type == "" {
+		e.Type = t.String()
+	}
+	attrs := map[string]interface{}{"panic_value_type": t.String()}
+	if stringer, ok := v.(fmt.Stringer); ok {
+		attrs["panic_value_string"] = truncateString(stringer.String())
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		attrs["panic_value"] = rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		attrs["panic_value"] = rv.Uint()
+	case reflect.Float32, reflect.Float64:
+		attrs["panic_value"] = rv.Float()
+	}
+	e.Attributes = attrs
+}
+
+// trimPanicStacktrace removes the frames preceding and including
+// runtime.gopanic from the error's stacktrace, such that it begins
+// at the panic site. If there is no runtime.gopanic frame, e.g. if
+// the error was not recovered from a panic, or it was created with
+// its own stacktrace, the stacktrace is left unchanged.
+func (e *Error) trimPanicStacktrace() {
+	for i, frame := range e.stacktrace {
+		if frame.Function == "runtime.gopanic" {
+			n := copy(e.stacktrace, e.stacktrace[i+1:])
+			e.stacktrace = e.stacktrace[:n]
+			return
+		}
+	}
+}
+
 // NewError returns a new Error with details taken from err.
 // NewError will panic if called with a nil error.
 //
@@ -128,7 +186,10 @@ func (t *Tracer) newError() *Error {
 			},
 		}
 	}
-	e.Timestamp = time.Now()
+	cfg := t.loadTransactionConfig()
+	e.Timestamp = cfg.clock.Now()
+	e.Context.headerCapture = cfg.headerCapture
+	e.Context.userAgentParsing = cfg.userAgentParsing
 	return e
 }
 
@@ -139,6 +200,10 @@ type Error struct {
 	stacktrace      []stacktrace.Frame
 	modelStacktrace []model.StacktraceFrame
 
+	// memoryReserved holds the number of bytes reserved from
+	// the tracer's memory budget when the error was sent.
+	memoryReserved int64
+
 	// ID is the unique ID of the error. This is set by NewError,
 	// and can be used for correlating errors and logs records.
 	ID string
@@ -171,6 +236,7 @@ type Error struct {
 }
 
 func (e *Error) reset() {
+	e.tracer.memory.release(e.memoryReserved)
 	*e = Error{
 		tracer:          e.tracer,
 		stacktrace:      e.stacktrace[:0],
@@ -183,18 +249,30 @@ func (e *Error) reset() {
 // Send enqueues the error for sending to the Elastic APM server.
 // The Error must not be used after this.
 func (e *Error) Send() {
+	e.Transaction.MarkFailed()
+	reserved, ok := e.tracer.memory.reserve(e.estimateMemory())
+	if !ok {
+		e.drop()
+		return
+	}
+	e.memoryReserved = reserved
 	select {
 	case e.tracer.errors <- e:
 	default:
 		// Enqueuing an error should never block.
-		e.tracer.statsMu.Lock()
-		e.tracer.stats.ErrorsDropped++
-		e.tracer.statsMu.Unlock()
-		e.reset()
-		e.tracer.errorPool.Put(e)
+		e.drop()
 	}
 }
 
+// drop discards the error, recording it as dropped.
+func (e *Error) drop() {
+	e.tracer.statsMu.Lock()
+	e.tracer.stats.ErrorsDropped++
+	e.tracer.statsMu.Unlock()
+	e.reset()
+	e.tracer.errorPool.Put(e)
+}
+
 func (e *Error) setStacktrace() {
 	if len(e.stacktrace) == 0 {
 		return
@@ -294,6 +372,9 @@ func initException(e *model.Exception, err error) {
 }
 
 func initStacktrace(e *Error, err error) {
+	if !stacktraceEnabled {
+		return
+	}
 	type internalStackTracer interface {
 		StackTrace() []stacktrace.Frame
 	}
@@ -317,6 +398,9 @@ func initStacktrace(e *Error, err error) {
 // skipping the first skip number of frames, excluding
 // the SetStacktrace function.
 func (e *Error) SetStacktrace(skip int) {
+	if !stacktraceEnabled {
+		return
+	}
 	e.stacktrace = stacktrace.AppendStacktrace(e.stacktrace[:0], skip+1, -1)
 }
 
@@ -16,6 +16,9 @@ import (
 )
 
 func TestErrorsStackTrace(t *testing.T) {
+	if !elasticapm.StacktraceEnabled {
+		t.Skip("stack traces are compiled out")
+	}
 	modelError := sendError(t, &errorsStackTracer{
 		"zing", newErrorsStackTrace(0, 2),
 	})
@@ -30,6 +33,9 @@ func TestErrorsStackTrace(t *testing.T) {
 }
 
 func TestInternalStackTrace(t *testing.T) {
+	if !elasticapm.StacktraceEnabled {
+		t.Skip("stack traces are compiled out")
+	}
 	// Absolute path on both windows (UNC) and *nix
 	abspath := filepath.FromSlash("//abs/path/file.go")
 	modelError := sendError(t, &internalStackTracer{
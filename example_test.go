@@ -137,6 +137,12 @@ func (r *recorder) count() int {
 }
 
 func (r *recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method == "GET" {
+		// The tracer queries the server information
+		// to discover the server version.
+		w.Write([]byte(`{"version":"6.4.0"}`))
+		return
+	}
 	var body io.Reader = req.Body
 	if req.Header.Get("Content-Encoding") == "gzip" {
 		r, err := gzip.NewReader(body)
@@ -0,0 +1,89 @@
+package elasticapm
+
+import (
+	"strings"
+	"sync/atomic"
+)
+
+// FailureCaptureMode holds flags indicating which additional detail is
+// captured for the remainder of a transaction once it has failed.
+type FailureCaptureMode int
+
+const (
+	// FailureCaptureOff disables capturing additional detail for
+	// failed transactions. This is the default mode.
+	FailureCaptureOff FailureCaptureMode = 0
+
+	// FailureCaptureBody captures the HTTP request body for failed
+	// transactions, as well as for their errors. This takes effect
+	// only if request bodies are being captured for errors; see
+	// Tracer.SetCaptureBody.
+	FailureCaptureBody FailureCaptureMode = 1 << 0
+
+	// FailureCaptureStacktraces records stacktraces for all spans
+	// ended after the transaction failed, regardless of the tracer's
+	// span frames minimum duration.
+	FailureCaptureStacktraces FailureCaptureMode = 1 << 1
+
+	// FailureCaptureSpans records all spans started after the
+	// transaction failed, regardless of the tracer's max spans
+	// limit and span sampling threshold.
+	FailureCaptureSpans FailureCaptureMode = 1 << 2
+
+	// FailureCaptureAll enables all of the above.
+	FailureCaptureAll = FailureCaptureBody | FailureCaptureStacktraces | FailureCaptureSpans
+)
+
+// SetFailureCapture sets the additional detail captured for the
+// remainder of a transaction once it has failed. This allows the
+// capture of detail for successful transactions to be kept minimal,
+// while failures are still richly documented.
+//
+// A transaction fails when an error related to it is sent, e.g. one
+// returned by CaptureError; when it is given a result of an error or
+// an HTTP 5xx status with Transaction.SetResult; or when it is marked
+// failed with Transaction.MarkFailed.
+//
+// The mode may also be set with the ELASTIC_APM_FAILURE_CAPTURE
+// environment variable, either "off", "all", or a comma-separated
+// list of "body", "stacktraces", and "spans".
+func (t *Tracer) SetFailureCapture(mode FailureCaptureMode) {
+	t.updateTransactionConfig(func(cfg *transactionConfig) {
+		cfg.failureCapture = mode
+	})
+}
+
+// MarkFailed records that the transaction has failed, capturing
+// additional detail for the remainder of the transaction according
+// to the tracer's failure capture mode. See Tracer.SetFailureCapture.
+//
+// Transactions are marked failed automatically when related errors
+// are sent, so MarkFailed need only be called for failures which
+// are not otherwise reported. MarkFailed has no effect once the
+// transaction has ended.
+func (tx *Transaction) MarkFailed() {
+	if tx == nil || tx.failureCapture == FailureCaptureOff {
+		return
+	}
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.ended {
+		return
+	}
+	tx.failed = true
+	if tx.failureCapture&FailureCaptureBody != 0 {
+		atomic.StoreUint32(&tx.Context.captureFailureBody, 1)
+	}
+}
+
+// failureCaptured reports whether the transaction has failed, and
+// capture of the given detail has been escalated. tx.mu must be held.
+func (tx *Transaction) failureCaptured(mode FailureCaptureMode) bool {
+	return tx.failed && tx.failureCapture&mode != 0
+}
+
+// isFailureResult reports whether info describes a failed transaction:
+// one that completed with an error, or with an HTTP 5xx status.
+func isFailureResult(info ResultInfo) bool {
+	return info.Err != nil || strings.HasPrefix(info.Result, "HTTP 5")
+}
@@ -0,0 +1,151 @@
+package elasticapm_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/model"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestTracerFailureCaptureSpans(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetMaxSpans(1)
+	tracer.SetFailureCapture(elasticapm.FailureCaptureSpans)
+
+	tx := tracer.StartTransaction("name", "type")
+	ctx := elasticapm.ContextWithTransaction(context.Background(), tx)
+	tx.StartSpan("one", "type", nil).End()
+	span := tx.StartSpan("two", "type", nil)
+	assert.True(t, span.Dropped())
+	span.End()
+
+	elasticapm.CaptureError(ctx, errors.New("boom")).Send()
+	span = tx.StartSpan("three", "type", nil)
+	assert.False(t, span.Dropped())
+	span.End()
+	tx.End()
+	tracer.Flush(nil)
+
+	var transactions []model.Transaction
+	for _, p := range transport.Payloads() {
+		if payload, ok := p.Value.(*model.TransactionsPayload); ok {
+			transactions = append(transactions, payload.Transactions...)
+		}
+	}
+	require.Len(t, transactions, 1)
+	out := transactions[0]
+	require.Len(t, out.Spans, 2)
+	assert.Equal(t, "one", out.Spans[0].Name)
+	assert.Equal(t, "three", out.Spans[1].Name)
+	assert.Equal(t, 1, out.SpanCount.Dropped.Total)
+}
+
+func TestTracerFailureCaptureStacktraces(t *testing.T) {
+	if !elasticapm.StacktraceEnabled {
+		t.Skip("stack traces are compiled out")
+	}
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetSpanFramesMinDuration(time.Hour)
+	tracer.SetFailureCapture(elasticapm.FailureCaptureStacktraces)
+
+	tx := tracer.StartTransaction("name", "type")
+	tx.StartSpan("before", "type", nil).End()
+	span := tx.StartSpan("after", "type", nil)
+	tx.SetResult(elasticapm.ResultInfo{Result: "HTTP 5xx", StatusCode: 503})
+	span.End()
+	tx.End()
+	tracer.Flush(nil)
+
+	out := transport.Payloads()[0].Transactions()[0]
+	require.Len(t, out.Spans, 2)
+	assert.Empty(t, out.Spans[0].Stacktrace)
+	assert.NotEmpty(t, out.Spans[1].Stacktrace)
+}
+
+func TestTracerFailureCaptureBody(t *testing.T) {
+	if !elasticapm.BodyCaptureEnabled {
+		t.Skip("body capture is compiled out")
+	}
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetCaptureBody(elasticapm.CaptureBodyErrors)
+	tracer.SetFailureCapture(elasticapm.FailureCaptureBody)
+
+	sendTransaction := func(failed bool) {
+		req, _ := http.NewRequest("POST", "/", strings.NewReader("foo_bar"))
+		body := tracer.CaptureHTTPRequestBody(req)
+		tx := tracer.StartTransaction("name", "type")
+		if failed {
+			tx.MarkFailed()
+		}
+		tx.Context.SetHTTPRequest(req)
+		tx.Context.SetHTTPRequestBody(body)
+		tx.End()
+	}
+	sendTransaction(false)
+	sendTransaction(true)
+	tracer.Flush(nil)
+
+	var transactions []string
+	for _, p := range transport.Payloads() {
+		for _, tx := range p.Transactions() {
+			if tx.Context.Request.Body != nil {
+				transactions = append(transactions, tx.Context.Request.Body.Raw)
+			} else {
+				transactions = append(transactions, "")
+			}
+		}
+	}
+	assert.Equal(t, []string{"", "foo_bar"}, transactions)
+}
+
+func TestTracerFailureCaptureConcurrent(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetFailureCapture(elasticapm.FailureCaptureAll)
+
+	// Errors may be sent concurrently with the transaction's
+	// request body being set, and the transaction ending.
+	tx := tracer.StartTransaction("name", "type")
+	ctx := elasticapm.ContextWithTransaction(context.Background(), tx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		elasticapm.CaptureError(ctx, errors.New("boom")).Send()
+	}()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader("foo_bar"))
+	tx.Context.SetHTTPRequestBody(tracer.CaptureHTTPRequestBody(req))
+	<-done
+	tx.End()
+	tracer.Flush(nil)
+	assert.NotEmpty(t, transport.Payloads())
+}
+
+func TestTracerFailureCaptureOff(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetMaxSpans(1)
+
+	tx := tracer.StartTransaction("name", "type")
+	tx.StartSpan("one", "type", nil).End()
+	tx.MarkFailed()
+	span := tx.StartSpan("two", "type", nil)
+	assert.True(t, span.Dropped())
+	span.End()
+	tx.End()
+	tracer.Flush(nil)
+
+	out := transport.Payloads()[0].Transactions()[0]
+	assert.Len(t, out.Spans, 1)
+}
@@ -0,0 +1,93 @@
+package elasticapm
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxFeatureFlags is the maximum number of feature flags which
+	// may be recorded in a Context. Additional flags are ignored.
+	maxFeatureFlags = 32
+
+	// featureFlagTagPrefix is prepended to feature flag names
+	// to form the tag keys under which they are recorded.
+	featureFlagTagPrefix = "feature_flag_"
+)
+
+// featureFlag holds a feature flag or experiment assignment.
+type featureFlag struct {
+	name      string
+	value     string
+	propagate bool
+}
+
+// SetFeatureFlag records a feature flag or experiment assignment in the
+// context, as a tag with the key "feature_flag_<name>". Tags are indexed,
+// enabling transaction latency to be compared across assignments.
+//
+// The value must be a bool, string, int, int64, or float64; values of
+// other types are ignored, as are invalid names (see SetTag). At most
+// 32 feature flags may be set; setting an existing flag replaces its
+// value, and additional flags beyond the limit are ignored.
+func (c *Context) SetFeatureFlag(name string, value interface{}) {
+	c.setFeatureFlag(name, value, false)
+}
+
+// PropagateFeatureFlag is like SetFeatureFlag, but additionally marks
+// the feature flag for propagation to downstream services. Propagated
+// feature flags are returned by FeatureFlagBaggage.
+func (c *Context) PropagateFeatureFlag(name string, value interface{}) {
+	c.setFeatureFlag(name, value, true)
+}
+
+func (c *Context) setFeatureFlag(name string, value interface{}, propagate bool) {
+	key := featureFlagTagPrefix + name
+	if name == "" || !validTagKey(key) {
+		return
+	}
+	var formatted string
+	switch value := value.(type) {
+	case bool:
+		formatted = strconv.FormatBool(value)
+	case string:
+		formatted = value
+	case int:
+		formatted = strconv.Itoa(value)
+	case int64:
+		formatted = strconv.FormatInt(value, 10)
+	case float64:
+		formatted = strconv.FormatFloat(value, 'g', -1, 64)
+	default:
+		return
+	}
+	flag := featureFlag{name: name, value: truncateString(formatted), propagate: propagate}
+	for i, existing := range c.featureFlags {
+		if existing.name == name {
+			c.featureFlags[i] = flag
+			c.SetTag(key, flag.value)
+			return
+		}
+	}
+	if len(c.featureFlags) >= maxFeatureFlags {
+		return
+	}
+	c.featureFlags = append(c.featureFlags, flag)
+	c.SetTag(key, flag.value)
+}
+
+// FeatureFlagBaggage returns the feature flags marked for propagation
+// with PropagateFeatureFlag, formatted as a comma-separated list of
+// W3C Baggage members ("name=value"), or the empty string if there
+// are none. This may be used to set the "baggage" header of outgoing
+// requests; module/apmhttp does this automatically.
+func (c *Context) FeatureFlagBaggage() string {
+	var members []string
+	for _, flag := range c.featureFlags {
+		if flag.propagate {
+			members = append(members, url.PathEscape(flag.name)+"="+url.PathEscape(flag.value))
+		}
+	}
+	return strings.Join(members, ",")
+}
@@ -0,0 +1,48 @@
+package elasticapm_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestContextFeatureFlags(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	tx := tracer.StartTransaction("name", "type")
+	tx.Context.SetFeatureFlag("new_checkout", true)
+	tx.Context.SetFeatureFlag("variant", "a")
+	tx.Context.SetFeatureFlag("variant", "b") // replaces
+	tx.Context.PropagateFeatureFlag("ratio", 0.25)
+	tx.Context.SetFeatureFlag("invalid.name", 1)
+	tx.Context.SetFeatureFlag("unsupported", struct{}{})
+	assert.Equal(t, "ratio=0.25", tx.Context.FeatureFlagBaggage())
+	tx.End()
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	assert.Equal(t, map[string]string{
+		"feature_flag_new_checkout": "true",
+		"feature_flag_variant":      "b",
+		"feature_flag_ratio":        "0.25",
+	}, payloads[0].Transactions()[0].Context.Tags)
+}
+
+func TestContextFeatureFlagsLimit(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	tx := tracer.StartTransaction("name", "type")
+	for i := 0; i < 40; i++ {
+		tx.Context.SetFeatureFlag(fmt.Sprintf("flag%d", i), i)
+	}
+	tx.End()
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	assert.Len(t, payloads[0].Transactions()[0].Context.Tags, 32)
+}
@@ -0,0 +1,13 @@
+package elasticapm
+
+// MetricsEnabled, StacktraceEnabled and BodyCaptureEnabled report
+// whether metrics, stack traces and HTTP request body capture are
+// compiled in, i.e. whether the package was built without the
+// elasticapm_nometrics, elasticapm_nostacktrace and
+// elasticapm_nobodycapture build tags respectively. Tests may use
+// these to skip tests of features that have been compiled out.
+const (
+	MetricsEnabled     = metricsEnabled
+	StacktraceEnabled  = stacktraceEnabled
+	BodyCaptureEnabled = bodyCaptureEnabled
+)
@@ -0,0 +1,8 @@
+// +build !elasticapm_nobodycapture
+
+package elasticapm
+
+// bodyCaptureEnabled reports whether HTTP request body capture
+// is compiled in. Building with the elasticapm_nobodycapture
+// build tag disables body capture, regardless of configuration.
+const bodyCaptureEnabled = true
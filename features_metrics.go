@@ -0,0 +1,11 @@
+// +build !elasticapm_nometrics,!tinygo
+
+package elasticapm
+
+// metricsEnabled reports whether metrics support is compiled in.
+// Building with the elasticapm_nometrics build tag disables the
+// builtin metrics and periodic metrics gathering, and makes
+// Tracer.RegisterMetricsGatherer a no-op. Metrics are always disabled
+// when building with TinyGo, whose runtime does not provide the
+// statistics gathered by the builtin metrics.
+const metricsEnabled = true
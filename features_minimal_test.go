@@ -0,0 +1,58 @@
+// +build elasticapm_nometrics,elasticapm_nostacktrace,elasticapm_nobodycapture
+
+package elasticapm_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestMinimalBuildNoMetrics(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	deregister := tracer.RegisterMetricsGatherer(elasticapm.GatherMetricsFunc(
+		func(ctx context.Context, m *elasticapm.Metrics) error {
+			panic("unexpected call")
+		},
+	))
+	defer deregister()
+	tracer.SendMetrics(nil)
+	assert.Empty(t, transport.Payloads())
+}
+
+func TestMinimalBuildNoStacktrace(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	tracer.NewError(errors.New("boom")).Send()
+	tx := tracer.StartTransaction("name", "type")
+	span := tx.StartSpan("name", "type", nil)
+	span.SetStacktrace(0)
+	span.End()
+	tx.End()
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads, 2)
+	assert.Empty(t, payloads[0].Errors()[0].Exception.Stacktrace)
+	assert.Empty(t, payloads[1].Transactions()[0].Spans[0].Stacktrace)
+}
+
+func TestMinimalBuildNoBodyCapture(t *testing.T) {
+	tracer, _ := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetCaptureBody(elasticapm.CaptureBodyAll)
+
+	req, _ := http.NewRequest("POST", "/", strings.NewReader("foo"))
+	assert.Nil(t, tracer.CaptureHTTPRequestBody(req))
+}
@@ -0,0 +1,5 @@
+// +build elasticapm_nobodycapture
+
+package elasticapm
+
+const bodyCaptureEnabled = false
@@ -0,0 +1,5 @@
+// +build elasticapm_nometrics tinygo
+
+package elasticapm
+
+const metricsEnabled = false
@@ -0,0 +1,5 @@
+// +build elasticapm_nostacktrace tinygo
+
+package elasticapm
+
+const stacktraceEnabled = false
@@ -0,0 +1,10 @@
+// +build !elasticapm_nostacktrace,!tinygo
+
+package elasticapm
+
+// stacktraceEnabled reports whether stack trace collection is
+// compiled in. Building with the elasticapm_nostacktrace build
+// tag disables the collection of stack traces for errors and
+// spans. Stack traces are always disabled when building with TinyGo,
+// for which runtime.Callers does not report call frames.
+const stacktraceEnabled = true
@@ -0,0 +1,36 @@
+package elasticapm
+
+import "crypto/subtle"
+
+// SetForceSampleSecret sets the secret which, when presented with a
+// request, causes the request's transaction to be sampled regardless
+// of the tracer's sampler. This enables on-demand tracing of specific
+// requests in production, e.g. for support engineers reproducing an
+// issue. If secret is empty, which is the default, forced sampling is
+// disabled.
+//
+// The secret is checked by instrumentation modules using
+// ForceSampleSecretMatches. For example, module/apmhttp checks the
+// "Elastic-Apm-Force-Sample" request header.
+func (t *Tracer) SetForceSampleSecret(secret string) {
+	t.forceSampleSecretMu.Lock()
+	t.forceSampleSecret = secret
+	t.forceSampleSecretMu.Unlock()
+}
+
+// ForceSampleSecretMatches reports whether value matches the secret set
+// with SetForceSampleSecret, or the ELASTIC_APM_FORCE_SAMPLE_SECRET
+// environment variable. If there is no secret configured, then
+// ForceSampleSecretMatches returns false.
+//
+// Instrumentation modules should pass ForceSample to StartTransaction
+// if ForceSampleSecretMatches returns true.
+func (t *Tracer) ForceSampleSecretMatches(value string) bool {
+	t.forceSampleSecretMu.RLock()
+	secret := t.forceSampleSecret
+	t.forceSampleSecretMu.RUnlock()
+	if secret == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(value), []byte(secret)) == 1
+}
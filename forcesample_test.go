@@ -0,0 +1,49 @@
+package elasticapm_test
+
+import (
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go"
+)
+
+func TestTracerForceSample(t *testing.T) {
+	tracer, err := elasticapm.NewTracer("tracer_testing", "")
+	require.NoError(t, err)
+	defer tracer.Close()
+	tracer.SetSampler(elasticapm.NewRatioSampler(0, rand.NewSource(0)))
+
+	tx := tracer.StartTransaction("name", "type")
+	assert.False(t, tx.Sampled())
+	tx.Discard()
+
+	tx = tracer.StartTransaction("name", "type", elasticapm.ForceSample())
+	assert.True(t, tx.Sampled())
+	tx.Discard()
+}
+
+func TestTracerForceSampleSecretMatches(t *testing.T) {
+	tracer, err := elasticapm.NewTracer("tracer_testing", "")
+	require.NoError(t, err)
+	defer tracer.Close()
+
+	assert.False(t, tracer.ForceSampleSecretMatches(""))
+	tracer.SetForceSampleSecret("sesame")
+	assert.False(t, tracer.ForceSampleSecretMatches(""))
+	assert.False(t, tracer.ForceSampleSecretMatches("sesam"))
+	assert.True(t, tracer.ForceSampleSecretMatches("sesame"))
+}
+
+func TestTracerForceSampleSecretEnv(t *testing.T) {
+	os.Setenv("ELASTIC_APM_FORCE_SAMPLE_SECRET", "sesame")
+	defer os.Unsetenv("ELASTIC_APM_FORCE_SAMPLE_SECRET")
+
+	tracer, err := elasticapm.NewTracer("tracer_testing", "")
+	require.NoError(t, err)
+	defer tracer.Close()
+	assert.True(t, tracer.ForceSampleSecretMatches("sesame"))
+}
@@ -40,6 +40,24 @@ func StartSpan(ctx context.Context, name, spanType string) (*Span, context.Conte
 	tx := TransactionFromContext(ctx)
 	span := tx.StartSpan(name, spanType, SpanFromContext(ctx))
 	if !span.Dropped() {
+		span.recordDeadline(ctx)
+		ctx = context.WithValue(ctx, contextSpanKey{}, span)
+	}
+	return span, ctx
+}
+
+// StartExitSpan starts and returns a new exit span within the sampled
+// transaction and parent span in the context, if any, targeting the
+// specified service. See Transaction.StartExitSpan for details. If the
+// span isn't dropped, it will be stored in the resulting context.
+//
+// StartExitSpan always returns a non-nil Span. Its End method must be
+// called when the span completes.
+func StartExitSpan(ctx context.Context, name, spanType string, target ServiceTargetSpanContext) (*Span, context.Context) {
+	tx := TransactionFromContext(ctx)
+	span := tx.StartExitSpan(name, spanType, SpanFromContext(ctx), target)
+	if !span.Dropped() {
+		span.recordDeadline(ctx)
 		ctx = context.WithValue(ctx, contextSpanKey{}, span)
 	}
 	return span, ctx
@@ -64,8 +82,34 @@ func CaptureError(ctx context.Context, err error) *Error {
 	e := tx.tracer.NewError(err)
 	e.Handled = true
 	e.Transaction = tx
+	if tx.sessionID != "" {
+		e.Context.SetTag(SessionIDTag, tx.sessionID)
+	}
 	return e
 }
 
+// DetachedContext returns a new context detached from the lifetime
+// of ctx, but which still returns the values of ctx.
+//
+// DetachedContext can be used to maintain the trace context required
+// to correlate events, but where the operation should not be affected
+// by the deadline or cancellation of ctx. For example, work started by
+// an HTTP handler which must continue after the client disconnects
+// should use a detached context, to ensure that any spans it creates
+// are ended and reported.
+func DetachedContext(ctx context.Context) context.Context {
+	return &detachedContext{Context: context.Background(), orig: ctx}
+}
+
+type detachedContext struct {
+	context.Context
+	orig context.Context
+}
+
+// Value returns c.orig.Value(key).
+func (c *detachedContext) Value(key interface{}) interface{} {
+	return c.orig.Value(key)
+}
+
 type contextSpanKey struct{}
 type contextTransactionKey struct{}
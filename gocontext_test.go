@@ -0,0 +1,35 @@
+package elasticapm_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/apm-agent-go"
+)
+
+func TestDetachedContext(t *testing.T) {
+	tracer, err := elasticapm.NewTracer("tracer_testing", "")
+	assert.NoError(t, err)
+	defer tracer.Close()
+
+	tx := tracer.StartTransaction("name", "type")
+	defer tx.Discard()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	ctx = elasticapm.ContextWithTransaction(ctx, tx)
+	span, ctx := elasticapm.StartSpan(ctx, "name", "type")
+	defer span.End()
+	cancel()
+
+	detached := elasticapm.DetachedContext(ctx)
+	assert.Equal(t, context.Canceled, ctx.Err())
+	assert.NoError(t, detached.Err())
+	assert.Nil(t, detached.Done())
+	_, ok := detached.Deadline()
+	assert.False(t, ok)
+	assert.Equal(t, tx, elasticapm.TransactionFromContext(detached))
+	assert.Equal(t, span, elasticapm.SpanFromContext(detached))
+}
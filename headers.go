@@ -0,0 +1,148 @@
+package elasticapm
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/elastic/apm-agent-go/model"
+)
+
+// defaultCapturedHeaders holds the canonical names of the HTTP headers
+// which are captured by default. These are recorded in dedicated fields
+// of the request and response context.
+var defaultCapturedHeaders = []string{"Content-Type", "Cookie", "User-Agent"}
+
+// HeaderCaptureFilter holds the names of HTTP headers to capture in
+// addition to the default headers, and the names of headers to exclude.
+//
+// Header names are matched case-insensitively. A name ending with "*"
+// matches all headers with the preceding prefix, e.g. "X-Amz-*".
+type HeaderCaptureFilter struct {
+	// Include holds the names of headers to capture,
+	// in addition to Content-Type, Cookie, and User-Agent.
+	Include []string
+
+	// Exclude holds the names of headers not to capture.
+	// Exclude takes precedence over Include, and applies
+	// to the default headers too.
+	Exclude []string
+}
+
+// headerCapture is an immutable snapshot of the tracer's header
+// capture configuration, shared by transaction and error contexts.
+// A nil *headerCapture captures only the default headers.
+type headerCapture struct {
+	disabled bool
+	include  []string
+	exclude  []string
+}
+
+func newHeaderCapture(capture bool, filter HeaderCaptureFilter) *headerCapture {
+	if capture && len(filter.Include) == 0 && len(filter.Exclude) == 0 {
+		return nil
+	}
+	return &headerCapture{
+		disabled: !capture,
+		include:  lowerHeaderNames(filter.Include),
+		exclude:  lowerHeaderNames(filter.Exclude),
+	}
+}
+
+func lowerHeaderNames(names []string) []string {
+	lower := make([]string, 0, len(names))
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			lower = append(lower, strings.ToLower(name))
+		}
+	}
+	return lower
+}
+
+// captureDefault reports whether the default header with the given
+// canonical name should be captured.
+func (h *headerCapture) captureDefault(name string) bool {
+	if h == nil {
+		return true
+	}
+	return !h.disabled && !matchHeaderName(h.exclude, strings.ToLower(name))
+}
+
+// appendOther appends to other the values of the non-default headers
+// in header which should be captured, returning the extended map.
+func (h *headerCapture) appendOther(other model.StringMap, header http.Header) model.StringMap {
+	if h == nil || h.disabled || len(h.include) == 0 {
+		return other
+	}
+	offset := len(other)
+	for name, values := range header {
+		if isDefaultCapturedHeader(name) {
+			continue
+		}
+		lower := strings.ToLower(name)
+		if !matchHeaderName(h.include, lower) || matchHeaderName(h.exclude, lower) {
+			continue
+		}
+		other = append(other, model.StringMapItem{
+			Key:   lower,
+			Value: truncateString(strings.Join(values, ", ")),
+		})
+	}
+	added := other[offset:]
+	sort.Slice(added, func(i, j int) bool {
+		return added[i].Key < added[j].Key
+	})
+	return other
+}
+
+func isDefaultCapturedHeader(name string) bool {
+	for _, h := range defaultCapturedHeaders {
+		if strings.EqualFold(name, h) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchHeaderName reports whether the lower-case header
+// name matches any of the lower-case patterns.
+func matchHeaderName(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if strings.HasSuffix(p, "*") {
+			if strings.HasPrefix(name, p[:len(p)-1]) {
+				return true
+			}
+		} else if name == p {
+			return true
+		}
+	}
+	return false
+}
+
+// SetCaptureHeaders sets whether or not HTTP request and response
+// headers are captured in transaction and error context. Headers are
+// captured by default.
+//
+// If capture is false, no headers or cookies are captured. This may
+// also be configured with the ELASTIC_APM_CAPTURE_HEADERS environment
+// variable.
+func (t *Tracer) SetCaptureHeaders(capture bool) {
+	t.updateTransactionConfig(func(cfg *transactionConfig) {
+		cfg.captureHeaders = capture
+		cfg.headerCapture = newHeaderCapture(capture, cfg.headerCaptureFilter)
+	})
+}
+
+// SetHeaderCaptureFilter sets the names of HTTP headers to capture in
+// addition to the default headers, and of headers to exclude. Only the
+// Content-Type, Cookie, and User-Agent headers are captured by default.
+//
+// The filter may also be configured with the comma-separated
+// ELASTIC_APM_CAPTURE_HEADERS_INCLUDE and ELASTIC_APM_CAPTURE_HEADERS_EXCLUDE
+// environment variables.
+func (t *Tracer) SetHeaderCaptureFilter(filter HeaderCaptureFilter) {
+	t.updateTransactionConfig(func(cfg *transactionConfig) {
+		cfg.headerCaptureFilter = filter
+		cfg.headerCapture = newHeaderCapture(cfg.captureHeaders, filter)
+	})
+}
@@ -0,0 +1,81 @@
+package elasticapm_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/model"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestTracerHeaderCaptureFilter(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetHeaderCaptureFilter(elasticapm.HeaderCaptureFilter{
+		Include: []string{"X-Request-Id", "x-amz-*", "X-Api-Key"},
+		Exclude: []string{"cookie", "X-Amz-Security-Token"},
+	})
+
+	req, _ := http.NewRequest("GET", "http://server.testing/", nil)
+	req.Header.Set("User-Agent", "test")
+	req.Header.Set("Cookie", "foo=bar")
+	req.Header.Set("X-Request-Id", "abc")
+	req.Header.Set("X-Amz-Date", "20181012T000000Z")
+	req.Header.Set("X-Amz-Security-Token", "secret")
+	req.Header.Set("X-Api-Key", "secret")
+	req.Header.Set("Authorization", "Basic secret")
+
+	tx := tracer.StartTransaction("name", "type")
+	tx.Context.SetHTTPRequest(req)
+	tx.Context.SetHTTPResponseHeaders(http.Header{
+		"Content-Type": {"text/plain"},
+		"X-Request-Id": {"abc", "def"},
+		"Server":       {"testing"},
+	})
+	tx.End()
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads, 1)
+	context := payloads[0].Transactions()[0].Context
+	assert.Equal(t, &model.RequestHeaders{
+		UserAgent: "test",
+		Other: model.StringMap{
+			{Key: "x-amz-date", Value: "20181012T000000Z"},
+			{Key: "x-api-key", Value: "[REDACTED]"},
+			{Key: "x-request-id", Value: "abc"},
+		},
+	}, context.Request.Headers)
+	assert.Empty(t, context.Request.Cookies)
+	assert.Equal(t, &model.ResponseHeaders{
+		ContentType: "text/plain",
+		Other:       model.StringMap{{Key: "x-request-id", Value: "abc, def"}},
+	}, context.Response.Headers)
+}
+
+func TestTracerCaptureHeadersDisabled(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetHeaderCaptureFilter(elasticapm.HeaderCaptureFilter{Include: []string{"*"}})
+	tracer.SetCaptureHeaders(false)
+
+	req, _ := http.NewRequest("GET", "http://server.testing/", nil)
+	req.Header.Set("User-Agent", "test")
+	req.Header.Set("Cookie", "foo=bar")
+	req.Header.Set("X-Request-Id", "abc")
+
+	tx := tracer.StartTransaction("name", "type")
+	tx.Context.SetHTTPRequest(req)
+	tx.Context.SetHTTPResponseHeaders(http.Header{"Content-Type": {"text/plain"}})
+	tx.End()
+	tracer.Flush(nil)
+
+	context := transport.Payloads()[0].Transactions()[0].Context
+	assert.Nil(t, context.Request.Headers)
+	assert.Empty(t, context.Request.Cookies)
+	assert.Nil(t, context.Response)
+}
@@ -0,0 +1,55 @@
+package instrumentation
+
+import (
+	"net/http"
+	"strings"
+)
+
+// ForceSampleKey is the name of the header or metadata key which, if its
+// value matches the tracer's force-sample secret, causes the transaction
+// started by StartTransaction to be sampled. See
+// elasticapm.Tracer.SetForceSampleSecret.
+const ForceSampleKey = "Elastic-Apm-Force-Sample"
+
+// SamplingPriorityKey is the name of the header or metadata key with which
+// a transaction's sampling priority is propagated to downstream services.
+// See elasticapm.Transaction.SetSamplingPriority.
+const SamplingPriorityKey = "Elastic-Apm-Sampling-Priority"
+
+// SessionIDKey is the name of the header or metadata key with which
+// a transaction's session ID is propagated to downstream services.
+// See elasticapm.Transaction.SetSessionID.
+const SessionIDKey = "Elastic-Apm-Session-Id"
+
+// BaggageKey is the name of the header or metadata key with which W3C
+// Baggage is propagated. See elasticapm.Baggage.
+const BaggageKey = "Baggage"
+
+// Carrier is an interface for obtaining values propagated with an incoming
+// request, such as HTTP request headers or gRPC metadata.
+type Carrier interface {
+	// Get returns the first value associated with the key,
+	// or the empty string if there is no such value. Keys
+	// are case-insensitive.
+	Get(key string) string
+}
+
+// HTTPHeaderCarrier is a Carrier for HTTP headers.
+type HTTPHeaderCarrier http.Header
+
+// Get returns the first value of the header with the given name.
+func (c HTTPHeaderCarrier) Get(key string) string {
+	return http.Header(c).Get(key)
+}
+
+// MetadataCarrier is a Carrier for metadata with lower-case keys,
+// such as gRPC's metadata.MD.
+type MetadataCarrier map[string][]string
+
+// Get returns the first value associated with the lower-cased key.
+func (c MetadataCarrier) Get(key string) string {
+	if v := c[strings.ToLower(key)]; len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
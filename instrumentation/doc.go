@@ -0,0 +1,13 @@
+// Package instrumentation provides helpers for writing instrumentation
+// modules, such as those under the "module" directory of this repository,
+// or third-party modules for other frameworks and libraries.
+//
+// The helpers encapsulate the conventions followed by the modules in this
+// repository: how transactions are started from incoming requests, how
+// exit spans identify their destination, how panics are reported, and how
+// transactions and spans are named and typed. Modules using this package
+// will continue to follow these conventions as they evolve.
+//
+// The API of this package is stable: it will not be changed in
+// backwards-incompatible ways without a new major version of the agent.
+package instrumentation
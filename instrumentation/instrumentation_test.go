@@ -0,0 +1,218 @@
+package instrumentation_test
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/instrumentation"
+	"github.com/elastic/apm-agent-go/model"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestStartTransactionForceSample(t *testing.T) {
+	tracer, _ := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetSampler(elasticapm.NewRatioSampler(0, rand.NewSource(0)))
+	tracer.SetForceSampleSecret("sesame")
+
+	for _, carrier := range []instrumentation.Carrier{
+		instrumentation.HTTPHeaderCarrier(http.Header{"Elastic-Apm-Force-Sample": {"sesame"}}),
+		instrumentation.MetadataCarrier{"elastic-apm-force-sample": {"sesame"}},
+	} {
+		tx := instrumentation.StartTransaction(tracer, "name", instrumentation.TransactionTypeRequest, carrier)
+		assert.True(t, tx.Sampled())
+		tx.End()
+	}
+	for _, carrier := range []instrumentation.Carrier{
+		nil,
+		instrumentation.HTTPHeaderCarrier(http.Header{"Elastic-Apm-Force-Sample": {"wrong"}}),
+		instrumentation.MetadataCarrier{},
+	} {
+		tx := instrumentation.StartTransaction(tracer, "name", instrumentation.TransactionTypeRequest, carrier)
+		assert.False(t, tx.Sampled())
+		tx.End()
+	}
+}
+
+func TestStartTransactionSamplingPriority(t *testing.T) {
+	tracer, _ := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetSampler(elasticapm.NewRatioSampler(0, rand.NewSource(0)))
+	carrier := instrumentation.HTTPHeaderCarrier(http.Header{"Elastic-Apm-Sampling-Priority": {"1"}})
+
+	// Propagated sampling priorities are ignored unless trusted.
+	tx := instrumentation.StartTransaction(tracer, "name", instrumentation.TransactionTypeRequest, carrier)
+	assert.False(t, tx.Sampled())
+	assert.Equal(t, 0, tx.SamplingPriority())
+	tx.End()
+
+	tracer.SetTrustSamplingPriority(true)
+	tx = instrumentation.StartTransaction(tracer, "name", instrumentation.TransactionTypeRequest, carrier)
+	assert.True(t, tx.Sampled())
+	assert.Equal(t, 1, tx.SamplingPriority())
+	tx.End()
+
+	for _, carrier := range []instrumentation.Carrier{
+		instrumentation.HTTPHeaderCarrier(http.Header{"Elastic-Apm-Sampling-Priority": {"0"}}),
+		instrumentation.MetadataCarrier{"elastic-apm-sampling-priority": {"high"}},
+	} {
+		tx := instrumentation.StartTransaction(tracer, "name", instrumentation.TransactionTypeRequest, carrier)
+		assert.False(t, tx.Sampled())
+		tx.End()
+	}
+}
+
+func TestStartTransactionSessionID(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetSessionIDHeader("X-Session-Id")
+	tracer.SetSessionIDCookie("sid")
+
+	for _, test := range []struct {
+		carrier instrumentation.Carrier
+		expect  string
+	}{{
+		carrier: instrumentation.HTTPHeaderCarrier(http.Header{"Cookie": {"a=b; sid=from-cookie"}}),
+		expect:  "from-cookie",
+	}, {
+		carrier: instrumentation.HTTPHeaderCarrier(http.Header{
+			"Cookie":       {"sid=from-cookie"},
+			"X-Session-Id": {"from-header"},
+		}),
+		expect: "from-header",
+	}, {
+		carrier: instrumentation.MetadataCarrier{
+			"x-session-id":           {"from-header"},
+			"elastic-apm-session-id": {"propagated"},
+		},
+		expect: "propagated",
+	}, {
+		carrier: instrumentation.HTTPHeaderCarrier(http.Header{"Cookie": {"other=value"}}),
+		expect:  "",
+	}} {
+		tx := instrumentation.StartTransaction(tracer, "name", instrumentation.TransactionTypeRequest, test.carrier)
+		assert.Equal(t, test.expect, tx.SessionID())
+		tx.End()
+	}
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	var sessionIDs []string
+	for _, tx := range payloads[0].Transactions() {
+		var sessionID string
+		if tx.Context != nil {
+			sessionID = tx.Context.Tags[elasticapm.SessionIDTag]
+		}
+		sessionIDs = append(sessionIDs, sessionID)
+	}
+	assert.Equal(t, []string{"from-cookie", "from-header", "propagated", ""}, sessionIDs)
+}
+
+func TestStartTransactionSynthetic(t *testing.T) {
+	tracer, _ := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	tx := instrumentation.StartTransaction(tracer, "GET /healthz", instrumentation.TransactionTypeRequest,
+		instrumentation.HTTPHeaderCarrier(http.Header{"User-Agent": {"kube-probe/1.27"}}),
+	)
+	assert.Equal(t, instrumentation.TransactionTypeSynthetic, tx.Type)
+	tx.End()
+
+	tx = instrumentation.StartTransaction(tracer, "GET /", instrumentation.TransactionTypeRequest,
+		instrumentation.HTTPHeaderCarrier(http.Header{"User-Agent": {"Mozilla/5.0"}}),
+	)
+	assert.Equal(t, instrumentation.TransactionTypeRequest, tx.Type)
+	tx.End()
+}
+
+func TestRouteTransactionName(t *testing.T) {
+	assert.Equal(t, "GET /users/:id", instrumentation.RouteTransactionName("GET", "/users/:id"))
+}
+
+func TestSpanType(t *testing.T) {
+	assert.Equal(t, "db.postgresql", instrumentation.SpanType(instrumentation.SpanTypeDB, "PostgreSQL", ""))
+	assert.Equal(t, "external.http_2.get", instrumentation.SpanType(instrumentation.SpanTypeExternal, "http/2", "GET"))
+}
+
+func TestStartExitSpan(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	var issues []elasticapm.SpanLintIssue
+	tracer.SetSpanLinter(func(issue elasticapm.SpanLintIssue) {
+		issues = append(issues, issue)
+	})
+
+	tx := tracer.StartTransaction("name", "type")
+	ctx := elasticapm.ContextWithTransaction(context.Background(), tx)
+	span, _ := instrumentation.StartExitSpan(ctx, "SELECT FROM foo", "db.postgresql.query", elasticapm.ServiceTargetSpanContext{})
+	span.End()
+	span, _ = instrumentation.StartExitSpan(ctx, "GET orders", "external.http", elasticapm.ServiceTargetSpanContext{
+		Type: "http",
+		Name: "orders:8080",
+	})
+	span.End()
+	tx.End()
+	tracer.Flush(nil)
+	assert.Empty(t, issues)
+
+	spans := transport.Payloads()[0].Transactions()[0].Spans
+	require.Len(t, spans, 2)
+	assert.Equal(t, &model.ServiceTargetSpanContext{Type: "postgresql"}, spans[0].Context.Service.Target)
+	assert.Equal(t, "postgresql", spans[0].Context.Destination.Service.Resource)
+	assert.Equal(t, "http/orders:8080", spans[1].Context.Destination.Service.Resource)
+}
+
+func TestStartExitSpanDropped(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetMaxSpans(1)
+
+	tx := tracer.StartTransaction("name", "type")
+	ctx := elasticapm.ContextWithTransaction(context.Background(), tx)
+	tx.StartSpan("name", "custom", nil).End()
+	span, _ := instrumentation.StartExitSpan(ctx, "SELECT FROM foo", "db.postgresql.query", elasticapm.ServiceTargetSpanContext{})
+	assert.True(t, span.Dropped())
+	span.End()
+	tx.End()
+	tracer.Flush(nil)
+
+	transaction := transport.Payloads()[0].Transactions()[0]
+	require.Len(t, transaction.DroppedSpansStats, 1)
+	assert.Equal(t, []model.DroppedSpansStats{{
+		Type:                       "db.postgresql.query",
+		DestinationServiceResource: "postgresql",
+		Count:                      1,
+		Duration:                   transaction.DroppedSpansStats[0].Duration,
+	}}, transaction.DroppedSpansStats)
+}
+
+func TestReportPanic(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	tx := tracer.StartTransaction("name", "type")
+	func() {
+		defer func() {
+			if v := recover(); v != nil {
+				instrumentation.ReportPanic(tracer, tx, v, true)
+			}
+		}()
+		panic(errors.New("boom"))
+	}()
+	tx.End()
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads, 2)
+	e := payloads[0].Errors()[0]
+	assert.Equal(t, "boom", e.Exception.Message)
+	assert.True(t, e.Exception.Handled)
+	assert.Equal(t, payloads[1].Transactions()[0].ID, e.Transaction.ID)
+}
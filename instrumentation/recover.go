@@ -0,0 +1,26 @@
+package instrumentation
+
+import (
+	"github.com/elastic/apm-agent-go"
+)
+
+// ReportPanic reports v, a value recovered from a panic while tx was
+// active, as an error associated with tx. The error is marked handled
+// if the panic was recovered and not propagated.
+//
+// ReportPanic is intended to be called from a module's own deferred
+// recovery function, which decides whether to propagate the panic:
+//
+//	defer func() {
+//		if v := recover(); v != nil {
+//			instrumentation.ReportPanic(tracer, tx, v, !propagate)
+//			if propagate {
+//				panic(v)
+//			}
+//		}
+//	}()
+func ReportPanic(tracer *elasticapm.Tracer, tx *elasticapm.Transaction, v interface{}, handled bool) {
+	e := tracer.Recovered(v, tx)
+	e.Handled = handled
+	e.Send()
+}
@@ -0,0 +1,73 @@
+package instrumentation
+
+import (
+	"context"
+	"strings"
+
+	"github.com/elastic/apm-agent-go"
+)
+
+// Span types for exit spans, i.e. spans describing calls to other
+// services. These are the first component of the span type, as
+// returned by SpanType.
+const (
+	SpanTypeDB        = "db"
+	SpanTypeCache     = "cache"
+	SpanTypeExternal  = "external"
+	SpanTypeMessaging = "messaging"
+	SpanTypeStorage   = "storage"
+)
+
+// SpanType returns a span type of the form "type.subtype.action", or
+// "type.subtype" if action is empty, e.g. "db.postgresql.query". Each
+// component is lower-cased, and any characters other than letters,
+// digits, and underscores are replaced with underscores, so that the
+// type is accepted by the span linter. See elasticapm.Tracer.SetSpanLinter.
+func SpanType(spanType, subtype, action string) string {
+	s := spanTypeComponent(spanType) + "." + spanTypeComponent(subtype)
+	if action != "" {
+		s += "." + spanTypeComponent(action)
+	}
+	return s
+}
+
+func spanTypeComponent(c string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + ('a' - 'A')
+		}
+		return '_'
+	}, c)
+}
+
+// StartExitSpan starts and returns a new exit span within the transaction
+// and parent span in ctx, as with elasticapm.StartExitSpan, identifying
+// target as the service it calls.
+//
+// If target.Type is empty, the subtype of spanType is used instead; for
+// example, a span of type "db.postgresql.query" targets the "postgresql"
+// service. The target is recorded as both the service target and the
+// destination service resource.
+func StartExitSpan(ctx context.Context, name, spanType string, target elasticapm.ServiceTargetSpanContext) (*elasticapm.Span, context.Context) {
+	if target.Type == "" {
+		target.Type = spanSubtype(spanType)
+	}
+	return elasticapm.StartExitSpan(ctx, name, spanType, target)
+}
+
+// spanSubtype returns the second component of spanType,
+// or the empty string if it has fewer than two components.
+func spanSubtype(spanType string) string {
+	i := strings.IndexRune(spanType, '.')
+	if i < 0 {
+		return ""
+	}
+	subtype := spanType[i+1:]
+	if j := strings.IndexRune(subtype, '.'); j >= 0 {
+		subtype = subtype[:j]
+	}
+	return subtype
+}
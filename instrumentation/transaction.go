@@ -0,0 +1,98 @@
+package instrumentation
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/elastic/apm-agent-go"
+)
+
+const (
+	// TransactionTypeRequest is the transaction type for
+	// incoming requests, e.g. HTTP server requests.
+	TransactionTypeRequest = "request"
+
+	// TransactionTypeMessaging is the transaction type
+	// for consuming messages from a message queue.
+	TransactionTypeMessaging = "messaging"
+
+	// TransactionTypeSynthetic is the transaction type for
+	// synthetic requests, such as health probes. See
+	// elasticapm.Transaction.MarkSynthetic.
+	TransactionTypeSynthetic = elasticapm.SyntheticTransactionType
+)
+
+// StartTransaction starts and returns a new transaction with the given
+// name and type, for a request whose propagated values may be obtained
+// from carrier. If carrier is non-nil and holds a ForceSampleKey value
+// matching the tracer's force-sample secret, the transaction will be
+// sampled regardless of the tracer's sampler. Likewise, if the tracer
+// trusts propagated sampling priorities, the transaction takes the
+// carrier's SamplingPriorityKey value as its sampling priority.
+//
+// The transaction's session ID is taken from the carrier's SessionIDKey
+// value if any, or otherwise from the header or cookie configured with
+// elasticapm.Tracer.SetSessionIDHeader or SetSessionIDCookie.
+//
+// The carrier's BaggageKey value is recorded in the transaction's tags as
+// configured with elasticapm.Tracer.SetBaggageTags.
+//
+// If the carrier's "User-Agent" value matches the tracer's synthetic
+// user-agent patterns, the transaction is marked as synthetic, with
+// type TransactionTypeSynthetic.
+func StartTransaction(tracer *elasticapm.Tracer, name, transactionType string, carrier Carrier) *elasticapm.Transaction {
+	if carrier == nil {
+		return tracer.StartTransaction(name, transactionType)
+	}
+	var opts []elasticapm.TransactionOption
+	if v := carrier.Get(ForceSampleKey); v != "" && tracer.ForceSampleSecretMatches(v) {
+		opts = append(opts, elasticapm.ForceSample())
+	}
+	if v := carrier.Get(SamplingPriorityKey); v != "" && tracer.TrustSamplingPriority() {
+		if priority, err := strconv.Atoi(v); err == nil {
+			opts = append(opts, elasticapm.WithSamplingPriority(priority))
+		}
+	}
+	if id := sessionID(tracer, carrier); id != "" {
+		opts = append(opts, elasticapm.WithSessionID(id))
+	}
+	if b := elasticapm.ParseBaggage(carrier.Get(BaggageKey)); len(b) != 0 {
+		opts = append(opts, elasticapm.WithBaggage(b))
+	}
+	tx := tracer.StartTransaction(name, transactionType, opts...)
+	if ua := carrier.Get("User-Agent"); tracer.IsSyntheticUserAgent(ua) {
+		tx.MarkSynthetic(ua)
+	}
+	return tx
+}
+
+// sessionID returns the session ID propagated in carrier, or held in
+// the tracer's configured session ID header or cookie.
+func sessionID(tracer *elasticapm.Tracer, carrier Carrier) string {
+	if id := carrier.Get(SessionIDKey); id != "" {
+		return id
+	}
+	header, cookie := tracer.SessionIDSource()
+	if header != "" {
+		if id := carrier.Get(header); id != "" {
+			return id
+		}
+	}
+	if cookie != "" {
+		if value := carrier.Get("Cookie"); value != "" {
+			req := http.Request{Header: http.Header{"Cookie": {value}}}
+			if c, err := req.Cookie(cookie); err == nil {
+				return c.Value
+			}
+		}
+	}
+	return ""
+}
+
+// RouteTransactionName returns the name for a transaction handling
+// a request with the given method and route pattern, e.g.
+// "GET /users/:id". Using the route pattern rather than the request
+// path keeps the number of distinct transaction names bounded.
+func RouteTransactionName(method, route string) string {
+	return method + " " + route
+}
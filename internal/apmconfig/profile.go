@@ -0,0 +1,73 @@
+// Package apmconfig provides access to the agent's configuration
+// environment variables, with defaults taken from the selected
+// configuration profile.
+package apmconfig
+
+import (
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// EnvProfile is the environment variable naming the configuration
+// profile to use.
+const EnvProfile = "ELASTIC_APM_PROFILE"
+
+var (
+	mu       sync.RWMutex
+	profiles = make(map[string]map[string]string)
+)
+
+// RegisterProfile registers a profile with the given name, holding
+// default values for environment variables, keyed by variable name.
+// If a profile with the same name is already registered, it is
+// replaced.
+func RegisterProfile(name string, settings map[string]string) {
+	profile := make(map[string]string, len(settings))
+	for k, v := range settings {
+		profile[k] = v
+	}
+	mu.Lock()
+	profiles[name] = profile
+	mu.Unlock()
+}
+
+// Getenv returns the value of the environment variable named by key.
+// If the variable is unset or empty, the value from the selected
+// profile is returned, if any.
+func Getenv(key string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	name := os.Getenv(EnvProfile)
+	if name == "" {
+		return ""
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	return profiles[name][key]
+}
+
+// Profile returns the name of the profile selected by the
+// ELASTIC_APM_PROFILE environment variable, or the empty
+// string if none is selected.
+func Profile() string {
+	return os.Getenv(EnvProfile)
+}
+
+// CheckProfile returns an error if ELASTIC_APM_PROFILE names a
+// profile that has not been registered.
+func CheckProfile() error {
+	name := os.Getenv(EnvProfile)
+	if name == "" {
+		return nil
+	}
+	mu.RLock()
+	_, ok := profiles[name]
+	mu.RUnlock()
+	if !ok {
+		return errors.Errorf("unknown %s value %q", EnvProfile, name)
+	}
+	return nil
+}
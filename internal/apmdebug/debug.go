@@ -4,6 +4,9 @@ import (
 	"log"
 	"os"
 	"strings"
+	"time"
+
+	"github.com/elastic/apm-agent-go/internal/apmstrings"
 )
 
 var (
@@ -12,6 +15,34 @@ var (
 	// for each SendTransactions and SendErrors call, proceeded by
 	// the results.
 	TraceTransport bool
+
+	// LeakDetectionThreshold holds the duration after which started,
+	// but not ended, transactions and spans will be reported as leaked.
+	// If this is zero, leak detection is disabled.
+	LeakDetectionThreshold time.Duration
+
+	// SelfTracing reports whether or not the tracer should trace
+	// its own operations, reporting them as a separate service.
+	SelfTracing bool
+
+	// SpanLint holds the action to take for span taxonomy problems:
+	// "log" or "panic". If this is empty, span linting is disabled.
+	SpanLint string
+
+	// PayloadDumpDir holds the directory to which the HTTP transport
+	// should write the payloads it sends. If this is empty, payloads
+	// are not written.
+	PayloadDumpDir string
+
+	// PayloadRecordDir holds the directory to which the HTTP transport
+	// should write every request body it sends. If this is empty,
+	// requests are not recorded.
+	PayloadRecordDir string
+
+	// PayloadRecordSize holds the maximum total size of the files
+	// written to PayloadRecordDir. If this is zero, the transport's
+	// default is used.
+	PayloadRecordSize int64
 )
 
 func init() {
@@ -25,10 +56,44 @@ func init() {
 			invalidField(field)
 			continue
 		}
-		k, _ := field[:pos], field[pos+1:]
+		k, v := field[:pos], field[pos+1:]
 		switch k {
 		case "tracetransport":
 			TraceTransport = true
+		case "leakdetection":
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				invalidField(field)
+				continue
+			}
+			LeakDetectionThreshold = d
+		case "selftrace":
+			SelfTracing = true
+		case "spanlint":
+			if v != "log" && v != "panic" {
+				invalidField(field)
+				continue
+			}
+			SpanLint = v
+		case "payloaddump":
+			if v == "" {
+				invalidField(field)
+				continue
+			}
+			PayloadDumpDir = v
+		case "payloadrecord":
+			if v == "" {
+				invalidField(field)
+				continue
+			}
+			PayloadRecordDir = v
+		case "payloadrecordsize":
+			size, err := apmstrings.ParseSize(v)
+			if err != nil {
+				invalidField(field)
+				continue
+			}
+			PayloadRecordSize = size
 		default:
 			unknownKey(k)
 			continue
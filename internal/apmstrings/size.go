@@ -0,0 +1,43 @@
+package apmstrings
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ParseSize parses a size in bytes, with an optional case-insensitive
+// unit suffix: "B", "KB", "MB", or "GB". Units are powers of 1024.
+// Negative sizes, and sizes which overflow int64, are invalid.
+func ParseSize(value string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix     string
+		multiplier int64
+	}{
+		{"KB", 1 << 10},
+		{"MB", 1 << 20},
+		{"GB", 1 << 30},
+		{"B", 1},
+	} {
+		if strings.HasSuffix(s, unit.suffix) {
+			s = strings.TrimSpace(s[:len(s)-len(unit.suffix)])
+			multiplier = unit.multiplier
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, errors.Errorf("invalid size %q: must not be negative", value)
+	}
+	if n > math.MaxInt64/multiplier {
+		return 0, errors.Errorf("invalid size %q: too large", value)
+	}
+	return n * multiplier, nil
+}
@@ -0,0 +1,38 @@
+package apmstrings_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/apm-agent-go/internal/apmstrings"
+)
+
+func TestParseSize(t *testing.T) {
+	test := func(in string, expect int64) {
+		t.Run(in, func(t *testing.T) {
+			out, err := apmstrings.ParseSize(in)
+			assert.NoError(t, err)
+			assert.Equal(t, expect, out)
+		})
+	}
+	test("0", 0)
+	test("512", 512)
+	test("10B", 10)
+	test("2kb", 2048)
+	test(" 3 MB ", 3<<20)
+	test("1GB", 1<<30)
+}
+
+func TestParseSizeInvalid(t *testing.T) {
+	test := func(in, expect string) {
+		t.Run(in, func(t *testing.T) {
+			_, err := apmstrings.ParseSize(in)
+			assert.EqualError(t, err, expect)
+		})
+	}
+	test("-1", `invalid size "-1": must not be negative`)
+	test("-5MB", `invalid size "-5MB": must not be negative`)
+	test("9223372036854775807KB", `invalid size "9223372036854775807KB": too large`)
+	test("lots", `strconv.ParseInt: parsing "LOTS": invalid syntax`)
+}
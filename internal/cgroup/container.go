@@ -0,0 +1,125 @@
+package cgroup
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+var (
+	containerIDRegexp = regexp.MustCompile(
+		"^[[:xdigit:]]{64}$|" + // Docker, containerd, CRI-O
+			"^[[:xdigit:]]{32}-[[:digit:]]{10}$", // AWS ECS Fargate
+	)
+	mountinfoContainerIDRegexp = regexp.MustCompile("/(?:containers|sandboxes)/([[:xdigit:]]{64})/")
+	podUIDRegexp               = regexp.MustCompile("^[[:xdigit:]]{8}(?:-[[:xdigit:]]{4}){3}-[[:xdigit:]]{12}$")
+)
+
+// ContainerInfo holds information about the container in which
+// a process is running.
+type ContainerInfo struct {
+	// ID is the container ID.
+	ID string
+
+	// PodUID is the UID of the Kubernetes pod to which the
+	// container belongs, if any.
+	PodUID string
+}
+
+// Container returns information about the container in which the
+// process is running, given the files describing its cgroup membership
+// (normally "/proc/self/cgroup") and mounts (normally
+// "/proc/self/mountinfo").
+//
+// With cgroup v2 and a private cgroup namespace, the cgroup paths do
+// not identify the container, so the container ID is taken from the
+// mounts, e.g. of the container's /etc/hostname file. The Kubernetes
+// pod UID is only available from cgroup paths.
+//
+// If the process does not appear to be running in a container,
+// Container returns a zero ContainerInfo.
+func Container(procCgroup, procMountinfo string) (ContainerInfo, error) {
+	info, err := readCgroupContainerInfo(procCgroup)
+	if err != nil || info.ID != "" {
+		return info, err
+	}
+	id, err := readMountinfoContainerID(procMountinfo)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return info, err
+	}
+	info.ID = id
+	return info, nil
+}
+
+func readCgroupContainerInfo(procCgroup string) (ContainerInfo, error) {
+	f, err := os.Open(procCgroup)
+	if err != nil {
+		return ContainerInfo{}, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// Each line is of the form "hierarchy-ID:controller-list:cgroup-path".
+		fields := strings.SplitN(scanner.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		if info, ok := parseCgroupPath(fields[2]); ok {
+			return info, nil
+		}
+	}
+	return ContainerInfo{}, scanner.Err()
+}
+
+// parseCgroupPath parses the container ID, and pod UID, from a
+// cgroup path such as "/docker/<id>" or, with the systemd cgroup
+// driver, "/kubepods.slice/kubepods-pod<uid>.slice/cri-containerd-<id>.scope".
+func parseCgroupPath(cgroupPath string) (ContainerInfo, bool) {
+	dir, base := path.Split(cgroupPath)
+	base = strings.TrimSuffix(base, ".scope")
+	if i := strings.LastIndex(base, "-"); i >= 0 && !containerIDRegexp.MatchString(base) {
+		base = base[i+1:]
+	}
+	if !containerIDRegexp.MatchString(base) {
+		return ContainerInfo{}, false
+	}
+	info := ContainerInfo{ID: base}
+
+	parent := strings.TrimSuffix(path.Base(dir), ".slice")
+	if i := strings.LastIndex(parent, "pod"); i >= 0 {
+		uid := strings.Replace(parent[i+len("pod"):], "_", "-", -1)
+		if podUIDRegexp.MatchString(uid) {
+			info.PodUID = uid
+		}
+	}
+	return info, true
+}
+
+// readMountinfoContainerID returns the container ID found in the
+// mount roots listed in the mountinfo file, if any.
+func readMountinfoContainerID(procMountinfo string) (string, error) {
+	f, err := os.Open(procMountinfo)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// Each line is of the form "mount-ID parent-ID major:minor root mount-point ...".
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		if m := mountinfoContainerIDRegexp.FindStringSubmatch(fields[3]); m != nil {
+			return m[1], nil
+		}
+	}
+	return "", scanner.Err()
+}
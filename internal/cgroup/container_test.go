@@ -0,0 +1,63 @@
+package cgroup_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go/internal/cgroup"
+)
+
+const (
+	testContainerID = "2227daf62df6694645fee5df53c1f91271546a9560e8600a525690ae252b7f63"
+	testPodUID      = "90d81341-92de-11e7-8cf2-507b9d4141fa"
+)
+
+func TestContainer(t *testing.T) {
+	for _, test := range []struct {
+		cgroup string
+		expect cgroup.ContainerInfo
+	}{{
+		cgroup: "12:devices:/docker/" + testContainerID + "\n",
+		expect: cgroup.ContainerInfo{ID: testContainerID},
+	}, {
+		cgroup: "1:name=systemd:/system.slice/docker-" + testContainerID + ".scope\n",
+		expect: cgroup.ContainerInfo{ID: testContainerID},
+	}, {
+		cgroup: "3:cpu:/kubepods/besteffort/pod" + testPodUID + "/" + testContainerID + "\n",
+		expect: cgroup.ContainerInfo{ID: testContainerID, PodUID: testPodUID},
+	}, {
+		cgroup: "0::/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod90d81341_92de_11e7_8cf2_507b9d4141fa.slice/cri-containerd-" + testContainerID + ".scope\n",
+		expect: cgroup.ContainerInfo{ID: testContainerID, PodUID: testPodUID},
+	}, {
+		cgroup: "1:name=systemd:/ecs/46686c7c701cdfdf2549f88f7b9575e9/46686c7c701cdfdf2549f88f7b9575e9-2574839563\n",
+		expect: cgroup.ContainerInfo{ID: "46686c7c701cdfdf2549f88f7b9575e9-2574839563"},
+	}, {
+		cgroup: "1:name=systemd:/user.slice/user-1000.slice/session-2.scope\n0::/\n",
+	}} {
+		dir := tempDir(t)
+		defer os.RemoveAll(dir)
+		writeFile(t, filepath.Join(dir, "cgroup"), test.cgroup)
+
+		info, err := cgroup.Container(filepath.Join(dir, "cgroup"), filepath.Join(dir, "mountinfo"))
+		require.NoError(t, err)
+		assert.Equal(t, test.expect, info, test.cgroup)
+	}
+}
+
+func TestContainerMountinfo(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	writeFile(t, filepath.Join(dir, "cgroup"), "0::/\n")
+	writeFile(t, filepath.Join(dir, "mountinfo"), ""+
+		"652 587 0:58 / / rw,relatime master:285 - overlay overlay rw\n"+
+		"661 652 254:1 /docker/containers/"+testContainerID+"/hostname /etc/hostname rw,relatime - ext4 /dev/vda1 rw\n",
+	)
+
+	info, err := cgroup.Container(filepath.Join(dir, "cgroup"), filepath.Join(dir, "mountinfo"))
+	require.NoError(t, err)
+	assert.Equal(t, cgroup.ContainerInfo{ID: testContainerID}, info)
+}
@@ -0,0 +1,130 @@
+// Package cgroup provides functions for reading the resource
+// limits of Linux control groups, and identifying the container
+// to which a process belongs.
+package cgroup
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// CPUQuota returns the CPU quota, in cores, of the control group of
+// the process whose cgroup membership is described by the file at
+// procCgroup (normally "/proc/self/cgroup"), with control group file
+// systems mounted under root (normally "/sys/fs/cgroup"). Both cgroup
+// v1 (cpu.cfs_quota_us) and v2 (cpu.max) are supported.
+//
+// If the control group has no CPU quota, or the CPU controller's files
+// cannot be found, CPUQuota returns false.
+func CPUQuota(procCgroup, root string) (float64, bool, error) {
+	f, err := os.Open(procCgroup)
+	if err != nil {
+		return 0, false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// Each line is of the form "hierarchy-ID:controller-list:cgroup-path".
+		fields := strings.SplitN(scanner.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		controllers, path := fields[1], fields[2]
+		if fields[0] == "0" && controllers == "" {
+			quota, ok, err := readCgroup2CPUQuota([]string{
+				filepath.Join(root, path),
+				root,
+			})
+			if ok || err != nil {
+				return quota, ok, err
+			}
+			continue
+		}
+		for _, controller := range strings.Split(controllers, ",") {
+			if controller != "cpu" {
+				continue
+			}
+			quota, ok, err := readCgroup1CPUQuota([]string{
+				filepath.Join(root, controllers, path),
+				filepath.Join(root, "cpu", path),
+				filepath.Join(root, controllers),
+				filepath.Join(root, "cpu"),
+			})
+			if ok || err != nil {
+				return quota, ok, err
+			}
+		}
+	}
+	return 0, false, scanner.Err()
+}
+
+// readCgroup2CPUQuota reads the quota from the "cpu.max" file in the
+// first of dirs which has one. The file contains the quota and period
+// in microseconds, or "max" and the period if there is no quota.
+func readCgroup2CPUQuota(dirs []string) (float64, bool, error) {
+	for _, dir := range dirs {
+		data, err := ioutil.ReadFile(filepath.Join(dir, "cpu.max"))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return 0, false, err
+		}
+		fields := strings.Fields(string(data))
+		if len(fields) != 2 {
+			return 0, false, errors.Errorf("invalid cpu.max contents %q", data)
+		}
+		if fields[0] == "max" {
+			return 0, false, nil
+		}
+		return parseCPUQuota(fields[0], fields[1])
+	}
+	return 0, false, nil
+}
+
+// readCgroup1CPUQuota reads the quota from the "cpu.cfs_quota_us"
+// and "cpu.cfs_period_us" files in the first of dirs which has them.
+// A quota of -1 means there is no quota.
+func readCgroup1CPUQuota(dirs []string) (float64, bool, error) {
+	for _, dir := range dirs {
+		quota, err := ioutil.ReadFile(filepath.Join(dir, "cpu.cfs_quota_us"))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return 0, false, err
+		}
+		period, err := ioutil.ReadFile(filepath.Join(dir, "cpu.cfs_period_us"))
+		if err != nil {
+			return 0, false, err
+		}
+		q, p := strings.TrimSpace(string(quota)), strings.TrimSpace(string(period))
+		if q == "-1" {
+			return 0, false, nil
+		}
+		return parseCPUQuota(q, p)
+	}
+	return 0, false, nil
+}
+
+func parseCPUQuota(quota, period string) (float64, bool, error) {
+	q, err := strconv.ParseInt(quota, 10, 64)
+	if err != nil {
+		return 0, false, errors.Wrap(err, "invalid CPU quota")
+	}
+	p, err := strconv.ParseInt(period, 10, 64)
+	if err != nil {
+		return 0, false, errors.Wrap(err, "invalid CPU period")
+	}
+	if q <= 0 || p <= 0 {
+		return 0, false, nil
+	}
+	return float64(q) / float64(p), true, nil
+}
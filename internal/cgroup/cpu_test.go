@@ -0,0 +1,84 @@
+package cgroup_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go/internal/cgroup"
+)
+
+func TestCPUQuotaV2(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	writeFile(t, filepath.Join(dir, "cgroup"), "0::/kubepods/pod1\n")
+	writeFile(t, filepath.Join(dir, "fs", "kubepods", "pod1", "cpu.max"), "150000 100000\n")
+
+	quota, ok, err := cgroup.CPUQuota(filepath.Join(dir, "cgroup"), filepath.Join(dir, "fs"))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 1.5, quota)
+}
+
+func TestCPUQuotaV2Unlimited(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	writeFile(t, filepath.Join(dir, "cgroup"), "0::/\n")
+	writeFile(t, filepath.Join(dir, "fs", "cpu.max"), "max 100000\n")
+
+	_, ok, err := cgroup.CPUQuota(filepath.Join(dir, "cgroup"), filepath.Join(dir, "fs"))
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestCPUQuotaV1(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	writeFile(t, filepath.Join(dir, "cgroup"), "4:memory:/docker/abc\n3:cpu,cpuacct:/docker/abc\n")
+	// Within a container, the cgroup path is typically not
+	// visible; the container's own cgroup is mounted at the root.
+	writeFile(t, filepath.Join(dir, "fs", "cpu,cpuacct", "cpu.cfs_quota_us"), "200000\n")
+	writeFile(t, filepath.Join(dir, "fs", "cpu,cpuacct", "cpu.cfs_period_us"), "100000\n")
+
+	quota, ok, err := cgroup.CPUQuota(filepath.Join(dir, "cgroup"), filepath.Join(dir, "fs"))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 2.0, quota)
+}
+
+func TestCPUQuotaV1Unlimited(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	writeFile(t, filepath.Join(dir, "cgroup"), "1:cpu:/\n")
+	writeFile(t, filepath.Join(dir, "fs", "cpu", "cpu.cfs_quota_us"), "-1\n")
+	writeFile(t, filepath.Join(dir, "fs", "cpu", "cpu.cfs_period_us"), "100000\n")
+
+	_, ok, err := cgroup.CPUQuota(filepath.Join(dir, "cgroup"), filepath.Join(dir, "fs"))
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestCPUQuotaNotFound(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	writeFile(t, filepath.Join(dir, "cgroup"), "1:cpu:/\n0::/\n")
+
+	_, ok, err := cgroup.CPUQuota(filepath.Join(dir, "cgroup"), filepath.Join(dir, "fs"))
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "cgroup")
+	require.NoError(t, err)
+	return dir
+}
+
+func writeFile(t *testing.T, filename, content string) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(filename), 0755))
+	require.NoError(t, ioutil.WriteFile(filename, []byte(content), 0644))
+}
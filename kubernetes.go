@@ -0,0 +1,60 @@
+package elasticapm
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/elastic/apm-agent-go/model"
+)
+
+// Environment variables conventionally set with the Kubernetes
+// downward API, describing the pod in which the process is running.
+const (
+	envKubernetesNamespace = "KUBERNETES_NAMESPACE"
+	envKubernetesPodName   = "KUBERNETES_POD_NAME"
+	envKubernetesPodUID    = "KUBERNETES_POD_UID"
+	envKubernetesNodeName  = "KUBERNETES_NODE_NAME"
+)
+
+// kubernetesNamespaceFile holds the namespace of the pod's service
+// account, which is mounted into pods by default.
+var kubernetesNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// getKubernetesMetadata returns the Kubernetes metadata for the process,
+// or nil if it is not running in a Kubernetes pod. Values set in the
+// KUBERNETES_* environment variables take precedence; otherwise, if
+// podUID was found in the process's cgroup, the pod name is taken to
+// be the hostname, and the namespace that of the service account.
+func getKubernetesMetadata(podUID string) *model.Kubernetes {
+	namespace := os.Getenv(envKubernetesNamespace)
+	podName := os.Getenv(envKubernetesPodName)
+	nodeName := os.Getenv(envKubernetesNodeName)
+	if uid := os.Getenv(envKubernetesPodUID); uid != "" {
+		podUID = uid
+	}
+	if podUID != "" {
+		if podName == "" {
+			podName, _ = os.Hostname()
+		}
+		if namespace == "" {
+			if data, err := ioutil.ReadFile(kubernetesNamespaceFile); err == nil {
+				namespace = strings.TrimSpace(string(data))
+			}
+		}
+	}
+	if namespace == "" && podName == "" && podUID == "" && nodeName == "" {
+		return nil
+	}
+	k8s := &model.Kubernetes{Namespace: truncateString(namespace)}
+	if podName != "" || podUID != "" {
+		k8s.Pod = &model.KubernetesPod{
+			Name: truncateString(podName),
+			UID:  truncateString(podUID),
+		}
+	}
+	if nodeName != "" {
+		k8s.Node = &model.KubernetesNode{Name: truncateString(nodeName)}
+	}
+	return k8s
+}
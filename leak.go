@@ -0,0 +1,144 @@
+package elasticapm
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/elastic/apm-agent-go/stacktrace"
+)
+
+// leakDetector tracks live (started, but not yet ended) transactions
+// and spans, in order to identify those which are never ended.
+//
+// Tracking is disabled unless a positive threshold is set, as it
+// involves capturing a stack trace for each transaction and span.
+// The threshold is accessed atomically, so that tracking can be
+// skipped without locking while leak detection is disabled.
+type leakDetector struct {
+	threshold int64 // time.Duration, accessed atomically
+
+	mu   sync.Mutex
+	live map[interface{}]*liveEvent
+}
+
+// liveEvent holds details of a live transaction or span.
+type liveEvent struct {
+	kind     string // "transaction" or "span"
+	name     string
+	start    time.Time
+	stack    []stacktrace.Frame
+	reported bool
+}
+
+// setThreshold sets the leak detection threshold, clearing any
+// tracked events if leak detection is being disabled.
+func (d *leakDetector) setThreshold(threshold time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	atomic.StoreInt64(&d.threshold, int64(threshold))
+	if threshold <= 0 {
+		d.live = nil
+	}
+}
+
+// enabled reports whether leak detection is enabled.
+func (d *leakDetector) enabled() bool {
+	return atomic.LoadInt64(&d.threshold) > 0
+}
+
+// track records the start of a transaction or span, identified by
+// key, if leak detection is enabled. The creation stack trace will
+// be recorded, skipping skip frames, excluding track itself.
+func (d *leakDetector) track(key interface{}, kind, name string, skip int) {
+	if !d.enabled() {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.enabled() {
+		return
+	}
+	if d.live == nil {
+		d.live = make(map[interface{}]*liveEvent)
+	}
+	d.live[key] = &liveEvent{
+		kind:  kind,
+		name:  name,
+		start: time.Now(),
+		stack: stacktrace.AppendStacktrace(nil, skip+1, -1),
+	}
+}
+
+// untrack records the end of a transaction or span identified by key.
+func (d *leakDetector) untrack(key interface{}) {
+	if !d.enabled() {
+		// Tracked events are cleared when
+		// leak detection is disabled.
+		return
+	}
+	d.mu.Lock()
+	if d.live != nil {
+		delete(d.live, key)
+	}
+	d.mu.Unlock()
+}
+
+// check counts the transactions and spans which have been live for
+// longer than the threshold. If logger is non-nil, each one is logged
+// the first time it is identified as leaked.
+func (d *leakDetector) check(logger Logger) (transactions, spans int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	threshold := time.Duration(atomic.LoadInt64(&d.threshold))
+	if threshold <= 0 {
+		return 0, 0
+	}
+	now := time.Now()
+	for _, e := range d.live {
+		age := now.Sub(e.start)
+		if age < threshold {
+			continue
+		}
+		switch e.kind {
+		case "transaction":
+			transactions++
+		case "span":
+			spans++
+		}
+		if !e.reported && logger != nil {
+			logger.Errorf(
+				"%s %q has not been ended after %s, started at:\n%s",
+				e.kind, e.name, age, formatStacktrace(e.stack),
+			)
+			e.reported = true
+		}
+	}
+	return transactions, spans
+}
+
+// SetLeakDetectionThreshold enables tracking of transactions and spans
+// which have been started but not ended within the duration d. Each such
+// transaction or span will be logged, along with the stack trace of its
+// creation, and the number of them will be reported in the tracer's
+// builtin metrics.
+//
+// Leak detection is a debugging facility, and should not be enabled in
+// production: a stack trace is captured for every transaction and span.
+// If d is non-positive (the default), leak detection is disabled.
+func (t *Tracer) SetLeakDetectionThreshold(d time.Duration) {
+	t.leaks.setThreshold(d)
+	t.sendConfigCommand(func(cfg *tracerConfig) {
+		cfg.leakDetectionInterval = d
+	})
+}
+
+func formatStacktrace(frames []stacktrace.Frame) string {
+	var buf bytes.Buffer
+	for _, f := range frames {
+		fmt.Fprintf(&buf, "\t%s\n\t\t%s:%d\n", f.Function, f.File, f.Line)
+	}
+	return buf.String()
+}
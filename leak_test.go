@@ -0,0 +1,96 @@
+package elasticapm_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestTracerLeakDetection(t *testing.T) {
+	tracer, err := elasticapm.NewTracer("tracer_testing", "")
+	require.NoError(t, err)
+	defer tracer.Close()
+	tracer.Transport = transporttest.Discard
+
+	var logger recordingLogger
+	tracer.SetLogger(&logger)
+	tracer.SetLeakDetectionThreshold(10 * time.Millisecond)
+
+	tx := tracer.StartTransaction("leaky", "type")
+	span := tx.StartSpan("ended", "type", nil)
+	span.End()
+	tx.StartSpan("leaky_span", "type", nil)
+
+	deadline := time.After(10 * time.Second)
+	for {
+		if messages := logger.messages(); len(messages) == 2 {
+			assert.Contains(t, messages[0]+messages[1], `transaction "leaky" has not been ended`)
+			assert.Contains(t, messages[0]+messages[1], `span "leaky_span" has not been ended`)
+			assert.Contains(t, messages[0], "TestTracerLeakDetection")
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatal("timed out waiting for leaks to be logged")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	tx.End()
+}
+
+func TestTracerLeakDetectionMetricsBeforeLogger(t *testing.T) {
+	if !elasticapm.MetricsEnabled {
+		t.Skip("metrics are compiled out")
+	}
+	tracer, err := elasticapm.NewTracer("tracer_testing", "")
+	require.NoError(t, err)
+	defer tracer.Close()
+	tracer.Transport = transporttest.Discard
+	tracer.SetLeakDetectionThreshold(10 * time.Millisecond)
+
+	tx := tracer.StartTransaction("leaky", "type")
+	defer tx.End()
+	time.Sleep(20 * time.Millisecond)
+
+	// Gathering metrics counts leaks, but does
+	// not prevent them from being logged later.
+	tracer.SendMetrics(nil)
+	var logger recordingLogger
+	tracer.SetLogger(&logger)
+
+	deadline := time.After(10 * time.Second)
+	for len(logger.messages()) == 0 {
+		select {
+		case <-deadline:
+			t.Fatal("timed out waiting for leaks to be logged")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	assert.Contains(t, logger.messages()[0], `transaction "leaky" has not been ended`)
+}
+
+type recordingLogger struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (l *recordingLogger) Debugf(format string, args ...interface{}) {}
+
+func (l *recordingLogger) Errorf(format string, args ...interface{}) {
+	l.mu.Lock()
+	l.msgs = append(l.msgs, fmt.Sprintf(format, args...))
+	l.mu.Unlock()
+}
+
+func (l *recordingLogger) messages() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.msgs...)
+}
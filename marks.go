@@ -0,0 +1,61 @@
+package elasticapm
+
+import (
+	"time"
+
+	"github.com/elastic/apm-agent-go/model"
+)
+
+// Mark records a timing mark for the transaction, with the offset
+// set to the elapsed time since tx.Timestamp. Marks are grouped,
+// e.g. Mark("phases", "auth"), and can be used to break down the
+// duration of a transaction into phases without creating a span
+// for each phase.
+//
+// If either group or name contains any of the characters '.', '*',
+// or '"', or if the transaction is not sampled, Mark is a no-op.
+func (tx *Transaction) Mark(group, name string) {
+	tx.SetMark(group, name, elapsed(tx.clock, tx.Timestamp))
+}
+
+// SetMark records a timing mark for the transaction with the given
+// offset from tx.Timestamp. SetMark should be used in preference to
+// Mark when the timing has been measured by other means. Setting a
+// mark with the same group and name as an existing mark replaces it.
+//
+// The same restrictions on group and name apply as for Mark.
+func (tx *Transaction) SetMark(group, name string, offset time.Duration) {
+	if !tx.Sampled() || !validTagKey(group) || !validTagKey(name) {
+		return
+	}
+	group = truncateString(group)
+	name = truncateString(name)
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.marks == nil {
+		tx.marks = make(map[string]map[string]time.Duration)
+	}
+	marks, ok := tx.marks[group]
+	if !ok {
+		marks = make(map[string]time.Duration)
+		tx.marks[group] = marks
+	}
+	marks[name] = offset
+}
+
+// buildMarks returns the model representation of the transaction's
+// marks, with offsets in milliseconds.
+func (tx *Transaction) buildMarks() model.TransactionMarks {
+	if len(tx.marks) == 0 {
+		return nil
+	}
+	out := make(model.TransactionMarks, len(tx.marks))
+	for group, marks := range tx.marks {
+		m := make(model.TransactionMark, len(marks))
+		for name, offset := range marks {
+			m[name] = offset.Seconds() * 1000
+		}
+		out[group] = m
+	}
+	return out
+}
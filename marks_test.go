@@ -0,0 +1,56 @@
+package elasticapm_test
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/model"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestTransactionMarks(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	tx := tracer.StartTransaction("name", "type")
+	tx.SetMark("phases", "auth", 10*time.Millisecond)
+	tx.SetMark("phases", "fetch", 25*time.Millisecond)
+	tx.SetMark("phases", "fetch", 30*time.Millisecond)
+	tx.SetMark("other", "render", 1500*time.Microsecond)
+	tx.SetMark("in.valid", "name", time.Millisecond)
+	tx.SetMark("group", "in*valid", time.Millisecond)
+	tx.Mark("phases", "done")
+	tx.End()
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads, 1)
+	marks := payloads[0].Transactions()[0].Marks
+	require.Contains(t, marks, "phases")
+	assert.InDelta(t, 0, marks["phases"]["done"], float64(time.Second/time.Millisecond))
+	delete(marks["phases"], "done")
+	assert.Equal(t, model.TransactionMarks{
+		"phases": {"auth": 10, "fetch": 30},
+		"other":  {"render": 1.5},
+	}, marks)
+}
+
+func TestTransactionMarksUnsampled(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetSampler(elasticapm.NewRatioSampler(0, rand.NewSource(0)))
+
+	tx := tracer.StartTransaction("name", "type")
+	tx.SetMark("phases", "auth", 10*time.Millisecond)
+	tx.End()
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads, 1)
+	assert.Nil(t, payloads[0].Transactions()[0].Marks)
+}
@@ -0,0 +1,126 @@
+package elasticapm
+
+import (
+	"sync/atomic"
+
+	"github.com/elastic/apm-agent-go/stacktrace"
+)
+
+const (
+	// Approximate fixed overheads, in bytes, used for estimating
+	// the memory consumed by queued events. These need not be
+	// exact; they exist to ensure that events with little or no
+	// variable-length data are still accounted for.
+	transactionOverhead = 512
+	spanOverhead        = 256
+	errorOverhead       = 512
+	frameOverhead       = 64
+)
+
+// memoryBudget accounts for the estimated memory consumed by
+// events queued in the tracer, and enforces an upper limit.
+//
+// Accounting is disabled when the limit is non-positive.
+type memoryBudget struct {
+	limit int64 // accessed atomically
+	used  int64 // accessed atomically
+}
+
+// setLimit sets the memory budget limit, in bytes.
+func (b *memoryBudget) setLimit(limit int64) {
+	atomic.StoreInt64(&b.limit, limit)
+}
+
+// usage returns the estimated memory usage and limit, in bytes.
+func (b *memoryBudget) usage() (used, limit int64) {
+	return atomic.LoadInt64(&b.used), atomic.LoadInt64(&b.limit)
+}
+
+// exceeded reports whether the memory budget is enabled and has been
+// exhausted. This is used for shedding optional data, such as captured
+// request bodies and span stack traces.
+func (b *memoryBudget) exceeded() bool {
+	limit := atomic.LoadInt64(&b.limit)
+	return limit > 0 && atomic.LoadInt64(&b.used) >= limit
+}
+
+// reserve attempts to reserve n bytes, returning the number of bytes
+// reserved and a boolean indicating whether the reservation succeeded.
+// If the budget is disabled, reserve returns (0, true).
+func (b *memoryBudget) reserve(n int64) (int64, bool) {
+	for {
+		limit := atomic.LoadInt64(&b.limit)
+		if limit <= 0 {
+			return 0, true
+		}
+		used := atomic.LoadInt64(&b.used)
+		if used+n > limit {
+			return 0, false
+		}
+		if atomic.CompareAndSwapInt64(&b.used, used, used+n) {
+			return n, true
+		}
+	}
+}
+
+// release releases n bytes previously reserved.
+func (b *memoryBudget) release(n int64) {
+	if n != 0 {
+		atomic.AddInt64(&b.used, -n)
+	}
+}
+
+// SetMemoryBudget sets the approximate maximum number of bytes of
+// memory that the tracer may consume for queued transactions and
+// errors, including their spans, stack traces, and captured request
+// bodies. If set to a non-positive value, the memory budget is
+// unlimited.
+//
+// When the budget is exhausted, request bodies and span stack traces
+// will not be captured, and newly ended transactions and errors will
+// be dropped until queued events have been sent.
+func (t *Tracer) SetMemoryBudget(bytes int64) {
+	t.memory.setLimit(bytes)
+}
+
+// estimateMemory returns the approximate number of bytes consumed by tx.
+func (tx *Transaction) estimateMemory() int64 {
+	n := int64(transactionOverhead + len(tx.Name) + len(tx.Type) + len(tx.Result))
+	n += tx.Context.estimateMemory()
+	for _, s := range tx.spans {
+		n += spanOverhead + int64(len(s.Name)+len(s.Type))
+		n += int64(len(s.Context.database.Statement))
+		n += estimateStacktraceMemory(s.stacktrace)
+	}
+	return n
+}
+
+// estimateMemory returns the approximate number of bytes consumed by e.
+func (e *Error) estimateMemory() int64 {
+	n := int64(errorOverhead + len(e.ID) + len(e.Culprit))
+	n += int64(len(e.model.Exception.Message) + len(e.model.Log.Message))
+	n += e.Context.estimateMemory()
+	n += estimateStacktraceMemory(e.stacktrace)
+	return n
+}
+
+// estimateMemory returns the approximate number of variable-length
+// bytes consumed by the context, dominated by captured request bodies.
+func (c *Context) estimateMemory() int64 {
+	n := int64(len(c.requestBody.Raw))
+	for k, values := range c.requestBody.Form {
+		n += int64(len(k))
+		for _, v := range values {
+			n += int64(len(v))
+		}
+	}
+	return n
+}
+
+func estimateStacktraceMemory(frames []stacktrace.Frame) int64 {
+	var n int64
+	for _, f := range frames {
+		n += int64(frameOverhead + len(f.File) + len(f.Function))
+	}
+	return n
+}
@@ -5,6 +5,7 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/elastic/apm-agent-go/model"
 )
@@ -51,6 +52,26 @@ type SummaryMetric struct {
 	// Quantile holds the φ-quantiles. This is optional, and
 	// only reported if non-empty.
 	Quantiles map[float64]float64
+
+	// Exemplar holds an exemplar for the values. This is
+	// optional, and only reported if non-nil.
+	Exemplar *MetricExemplar
+}
+
+// MetricExemplar identifies a representative event which contributed
+// to a metric, e.g. a transaction, so that the metric may be linked to
+// the event.
+type MetricExemplar struct {
+	// Value holds the event's value, e.g. a duration in seconds.
+	Value float64
+
+	// Timestamp holds the time at which the event occurred.
+	Timestamp time.Time
+
+	// Labels holds labels identifying the event, e.g.
+	// "transaction_id". The labels are expected to be
+	// sorted lexicographically.
+	Labels []MetricLabel
 }
 
 // MetricsGatherer provides an interface for gathering metrics.
@@ -109,6 +130,14 @@ func (m *Metrics) AddSummary(name, unit string, labels []MetricLabel, summary Su
 			return quantiles[i].Quantile < quantiles[j].Quantile
 		})
 	}
+	var exemplar *model.Exemplar
+	if summary.Exemplar != nil {
+		exemplar = &model.Exemplar{
+			Value:     summary.Exemplar.Value,
+			Timestamp: model.Time(summary.Exemplar.Timestamp.UTC()),
+			Labels:    modelLabels(summary.Exemplar.Labels),
+		}
+	}
 	m.addMetric(name, labels, model.Metric{
 		Type:      "summary",
 		Unit:      unit,
@@ -118,6 +147,7 @@ func (m *Metrics) AddSummary(name, unit string, labels []MetricLabel, summary Su
 		Max:       summary.Max,
 		Stddev:    summary.Stddev,
 		Quantiles: quantiles,
+		Exemplar:  exemplar,
 	})
 }
 
@@ -135,17 +165,8 @@ func (m *Metrics) addMetric(name string, labels []MetricLabel, metric model.Metr
 		// labels are equal
 		metrics = m.metrics[i]
 	} else {
-		var modelLabels model.StringMap
-		if len(labels) > 0 {
-			modelLabels = make(model.StringMap, len(labels))
-			for i, l := range labels {
-				modelLabels[i] = model.StringMapItem{
-					Key: l.Name, Value: l.Value,
-				}
-			}
-		}
 		metrics = &model.Metrics{
-			Labels:  modelLabels,
+			Labels:  modelLabels(labels),
 			Samples: make(map[string]model.Metric),
 		}
 		if i == len(results) {
@@ -159,6 +180,17 @@ func (m *Metrics) addMetric(name string, labels []MetricLabel, metric model.Metr
 	metrics.Samples[name] = metric
 }
 
+func modelLabels(labels []MetricLabel) model.StringMap {
+	if len(labels) == 0 {
+		return nil
+	}
+	out := make(model.StringMap, len(labels))
+	for i, l := range labels {
+		out[i] = model.StringMapItem{Key: l.Name, Value: l.Value}
+	}
+	return out
+}
+
 func compareLabels(a model.StringMap, b []MetricLabel) int {
 	na, nb := len(a), len(b)
 	n := na
@@ -2,18 +2,25 @@ package elasticapm_test
 
 import (
 	"context"
+	"math/rand"
 	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/elastic/apm-agent-go"
 	"github.com/elastic/apm-agent-go/model"
+	"github.com/elastic/apm-agent-go/transport"
 	"github.com/elastic/apm-agent-go/transport/transporttest"
 )
 
 func TestTracerMetricsBuiltin(t *testing.T) {
+	if !elasticapm.MetricsEnabled {
+		t.Skip("metrics are compiled out")
+	}
 	tracer, transport := transporttest.NewRecorderTracer()
 	defer tracer.Close()
 
@@ -81,8 +88,9 @@ func TestTracerMetricsBuiltin(t *testing.T) {
 		},
 	}
 
-	assert.Equal(t, map[string]model.Metric{
+	expected := map[string]model.Metric{
 		"go.goroutines": gaugeMetric(""),
+		"go.gomaxprocs": gaugeMetric(""),
 
 		"go.mem.heap.mallocs":       counterMetric(""),
 		"go.mem.heap.frees":         counterMetric(""),
@@ -100,13 +108,33 @@ func TestTracerMetricsBuiltin(t *testing.T) {
 		"elasticapm.transactions.sent":        counterMetric(""),
 		"elasticapm.transactions.dropped":     counterMetric(""),
 		"elasticapm.transactions.send_errors": counterMetric(""),
+		"elasticapm.transactions.spooled":     counterMetric(""),
 		"elasticapm.errors.sent":              counterMetric(""),
 		"elasticapm.errors.dropped":           counterMetric(""),
 		"elasticapm.errors.send_errors":       counterMetric(""),
-	}, builtinMetrics.Samples)
+		"elasticapm.errors.spooled":           counterMetric(""),
+	}
+	switch runtime.GOOS {
+	case "linux", "windows":
+		expected["system.process.cpu.total"] = counterMetric("sec")
+		expected["system.process.memory.size"] = gaugeMetric("byte")
+		expected["system.process.memory.rss.bytes"] = gaugeMetric("byte")
+		expected["system.process.handles"] = gaugeMetric("")
+		expected["system.memory.total"] = gaugeMetric("byte")
+		expected["system.memory.actual.free"] = gaugeMetric("byte")
+	}
+	if _, ok := builtinMetrics.Samples["system.cpu.quota"]; ok {
+		// Only reported when running in a
+		// control group with a CPU quota.
+		expected["system.cpu.quota"] = gaugeMetric("")
+	}
+	assert.Equal(t, expected, builtinMetrics.Samples)
 }
 
 func TestTracerMetricsGatherer(t *testing.T) {
+	if !elasticapm.MetricsEnabled {
+		t.Skip("metrics are compiled out")
+	}
 	tracer, transport := transporttest.NewRecorderTracer()
 	defer tracer.Close()
 
@@ -151,6 +179,9 @@ func TestTracerMetricsGatherer(t *testing.T) {
 }
 
 func TestTracerMetricsDeregister(t *testing.T) {
+	if !elasticapm.MetricsEnabled {
+		t.Skip("metrics are compiled out")
+	}
 	tracer, transport := transporttest.NewRecorderTracer()
 	defer tracer.Close()
 
@@ -174,6 +205,180 @@ func TestTracerMetricsDeregister(t *testing.T) {
 	require.Len(t, metrics, 1) // just the builtin/unlabeled metrics
 }
 
+func TestTracerMetricsTransactionDuration(t *testing.T) {
+	if !elasticapm.MetricsEnabled {
+		t.Skip("metrics are compiled out")
+	}
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetMetricsInterval(time.Hour)
+	tracer.SetSampler(elasticapm.NewRatioSampler(0, rand.NewSource(0)))
+
+	var exemplarID string
+	for i, d := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second} {
+		var opts []elasticapm.TransactionOption
+		if i < 2 {
+			opts = append(opts, elasticapm.ForceSample())
+		}
+		tx := tracer.StartTransaction("GET /", "request", opts...)
+		if i == 1 {
+			exemplarID = tx.ID()
+		}
+		tx.Duration = d
+		tx.End()
+	}
+	tx := tracer.StartTransaction("consume", "messaging")
+	tx.Duration = time.Second
+	tx.End()
+	tracer.SendMetrics(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads, 1)
+	metrics := payloads[0].Metrics()
+	require.Len(t, metrics, 3)
+
+	// The longest sampled transaction is the exemplar;
+	// unsampled transactions are counted, but are not
+	// exemplars.
+	assert.Equal(t, model.StringMap{
+		{Key: "transaction_name", Value: "GET /"},
+		{Key: "transaction_type", Value: "request"},
+	}, metrics[1].Labels)
+	duration := metrics[1].Samples["transaction.duration"]
+	require.NotNil(t, duration.Exemplar)
+	assert.NotZero(t, duration.Exemplar.Timestamp)
+	duration.Exemplar.Timestamp = model.Time{}
+	assert.Equal(t, model.Metric{
+		Type:  "summary",
+		Unit:  "sec",
+		Count: newUint64(3),
+		Sum:   newFloat64(6),
+		Max:   newFloat64(3),
+		Exemplar: &model.Exemplar{
+			Value:  2,
+			Labels: model.StringMap{{Key: "transaction_id", Value: exemplarID}},
+		},
+	}, duration)
+
+	assert.Equal(t, model.StringMap{
+		{Key: "transaction_name", Value: "consume"},
+		{Key: "transaction_type", Value: "messaging"},
+	}, metrics[2].Labels)
+	assert.Nil(t, metrics[2].Samples["transaction.duration"].Exemplar)
+
+	// Durations are reset after each gathering.
+	tracer.SendMetrics(nil)
+	require.Len(t, transport.Payloads(), 2)
+	assert.Len(t, transport.Payloads()[1].Metrics(), 1)
+}
+
+func TestTracerMetricsTransactionDurationDisabled(t *testing.T) {
+	if !elasticapm.MetricsEnabled {
+		t.Skip("metrics are compiled out")
+	}
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetMetricsInterval(0)
+
+	tracer.StartTransaction("GET /", "request").End()
+	tracer.SendMetrics(nil)
+
+	// With a non-positive metrics interval, transaction
+	// durations are not recorded.
+	payloads := transport.Payloads()
+	require.Len(t, payloads, 1)
+	assert.Len(t, payloads[0].Metrics(), 1)
+}
+
+func TestTracerBreakdownMetrics(t *testing.T) {
+	if !elasticapm.MetricsEnabled {
+		t.Skip("metrics are compiled out")
+	}
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetMetricsInterval(time.Hour)
+	tracer.SetBreakdownMetrics(elasticapm.BreakdownMetricsDestination)
+
+	tx := tracer.StartTransaction("GET /", "request")
+	start := tx.Timestamp
+	startSpan := func(name, spanType, database string, offset, duration time.Duration, parent *elasticapm.Span) *elasticapm.Span {
+		span := tx.StartSpan(name, spanType, parent)
+		span.Timestamp = start.Add(offset)
+		span.Duration = duration
+		if database != "" {
+			span.Context.SetServiceTarget(elasticapm.ServiceTargetSpanContext{Type: "postgresql", Name: database})
+		}
+		return span
+	}
+	orders := startSpan("orders", "db.postgresql.query", "orders", time.Second, 4*time.Second, nil)
+	startSpan("child", "custom", "", 2*time.Second, time.Second, orders).End()
+	orders.End()
+	startSpan("users", "db.postgresql.query", "users", 3*time.Second, 2*time.Second, nil).End()
+	tx.Duration = 10 * time.Second
+	tx.End()
+	tracer.SendMetrics(nil)
+
+	selfTimes := make(map[string]float64)
+	for _, m := range transport.Payloads()[0].Metrics() {
+		sample, ok := m.Samples["span.self_time"]
+		if !ok {
+			continue
+		}
+		var key []string
+		for _, label := range m.Labels {
+			key = append(key, label.Value)
+		}
+		assert.Equal(t, uint64(1), *sample.Count)
+		selfTimes[strings.Join(key, ",")] = *sample.Sum
+	}
+	assert.Equal(t, map[string]float64{
+		"app,GET /,request":                             6,
+		"custom,GET /,request":                          1,
+		"postgresql/orders,db.postgresql,GET /,request": 3,
+		"postgresql/users,db.postgresql,GET /,request":  2,
+	}, selfTimes)
+}
+
+func TestTracerMetricsTransportStats(t *testing.T) {
+	if !elasticapm.MetricsEnabled {
+		t.Skip("metrics are compiled out")
+	}
+	tracer, recorder := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.Transport = statsTransport{
+		Transport: recorder,
+		stats: transport.Stats{
+			BytesSent:       1024,
+			Requests:        5,
+			RequestFailures: 2,
+			Retries:         1,
+			Failovers:       3,
+			PayloadsFailed:  1,
+		},
+	}
+	tracer.SendMetrics(nil)
+
+	samples := recorder.Payloads()[0].Metrics()[0].Samples
+	counter := func(unit string, value float64) model.Metric {
+		return model.Metric{Type: "counter", Unit: unit, Value: &value}
+	}
+	assert.Equal(t, counter("byte", 1024), samples["elasticapm.transport.bytes_sent"])
+	assert.Equal(t, counter("", 5), samples["elasticapm.transport.requests"])
+	assert.Equal(t, counter("", 2), samples["elasticapm.transport.request_failures"])
+	assert.Equal(t, counter("", 1), samples["elasticapm.transport.retries"])
+	assert.Equal(t, counter("", 3), samples["elasticapm.transport.failovers"])
+	assert.Equal(t, counter("", 1), samples["elasticapm.transport.payloads_failed"])
+}
+
+type statsTransport struct {
+	transport.Transport
+	stats transport.Stats
+}
+
+func (t statsTransport) TransportStats() transport.Stats {
+	return t.stats
+}
+
 func newUint64(v uint64) *uint64 {
 	return &v
 }
@@ -313,10 +313,34 @@ func (u *UserID) isZero() bool {
 }
 
 // MarshalFastJSON writes the JSON representation of b to w.
+//
+// Form fields and files are both encoded as object members, with files
+// encoded as objects holding their metadata.
 func (b *RequestBody) MarshalFastJSON(w *fastjson.Writer) {
 	if b.Form != nil {
 		w.RawByte('{')
 		first := true
+		for k, files := range b.Files {
+			if first {
+				first = false
+			} else {
+				w.RawByte(',')
+			}
+			w.String(k)
+			w.RawByte(':')
+			if len(files) == 1 {
+				files[0].MarshalFastJSON(w)
+			} else {
+				w.RawByte('[')
+				for i := range files {
+					if i != 0 {
+						w.RawByte(',')
+					}
+					files[i].MarshalFastJSON(w)
+				}
+				w.RawByte(']')
+			}
+		}
 		for k, v := range b.Form {
 			if first {
 				first = false
@@ -365,17 +389,25 @@ func (b *RequestBody) UnmarshalJSON(data []byte) error {
 			switch v := v.(type) {
 			case string:
 				form.Set(k, v)
+			case map[string]interface{}:
+				if err := b.addFile(k, v); err != nil {
+					return err
+				}
 			case []interface{}:
 				for _, v := range v {
 					switch v := v.(type) {
 					case string:
 						form.Add(k, v)
+					case map[string]interface{}:
+						if err := b.addFile(k, v); err != nil {
+							return err
+						}
 					default:
-						return errors.Errorf("expected string, got %T", v)
+						return errors.Errorf("expected string or object, got %T", v)
 					}
 				}
 			default:
-				return errors.Errorf("expected string or []string, got %T", v)
+				return errors.Errorf("expected string, object, or array, got %T", v)
 			}
 		}
 		b.Form = form
@@ -385,6 +417,110 @@ func (b *RequestBody) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// MarshalFastJSON writes the JSON representation of h to w.
+func (h *RequestHeaders) MarshalFastJSON(w *fastjson.Writer) {
+	w.RawByte('{')
+	first := marshalHeader(w, true, "content-type", h.ContentType)
+	first = marshalHeader(w, first, "cookie", h.Cookie)
+	first = marshalHeader(w, first, "user-agent", h.UserAgent)
+	marshalOtherHeaders(w, first, h.Other)
+	w.RawByte('}')
+}
+
+// UnmarshalJSON unmarshals the JSON data into h.
+func (h *RequestHeaders) UnmarshalJSON(data []byte) error {
+	var m map[string]string
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	*h = RequestHeaders{
+		ContentType: m["content-type"],
+		Cookie:      m["cookie"],
+		UserAgent:   m["user-agent"],
+	}
+	delete(m, "content-type")
+	delete(m, "cookie")
+	delete(m, "user-agent")
+	h.Other = otherHeaders(m)
+	return nil
+}
+
+// MarshalFastJSON writes the JSON representation of h to w.
+func (h *ResponseHeaders) MarshalFastJSON(w *fastjson.Writer) {
+	w.RawByte('{')
+	first := marshalHeader(w, true, "content-type", h.ContentType)
+	marshalOtherHeaders(w, first, h.Other)
+	w.RawByte('}')
+}
+
+// UnmarshalJSON unmarshals the JSON data into h.
+func (h *ResponseHeaders) UnmarshalJSON(data []byte) error {
+	var m map[string]string
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	*h = ResponseHeaders{ContentType: m["content-type"]}
+	delete(m, "content-type")
+	h.Other = otherHeaders(m)
+	return nil
+}
+
+// marshalHeader writes the header with the given name and value to w,
+// if value is non-empty, returning the new value of first.
+func marshalHeader(w *fastjson.Writer, first bool, name, value string) bool {
+	if value == "" {
+		return first
+	}
+	if !first {
+		w.RawByte(',')
+	}
+	w.String(name)
+	w.RawByte(':')
+	w.String(value)
+	return false
+}
+
+func marshalOtherHeaders(w *fastjson.Writer, first bool, other StringMap) {
+	for _, item := range other {
+		first = marshalHeader(w, first, item.Key, item.Value)
+	}
+}
+
+func otherHeaders(m map[string]string) StringMap {
+	if len(m) == 0 {
+		return nil
+	}
+	other := make(StringMap, 0, len(m))
+	for k, v := range m {
+		other = append(other, StringMapItem{Key: k, Value: v})
+	}
+	sort.Slice(other, func(i, j int) bool {
+		return other[i].Key < other[j].Key
+	})
+	return other
+}
+
+// addFile adds the file metadata, decoded as a generic JSON object,
+// to b.Files with the given form field name.
+func (b *RequestBody) addFile(field string, v map[string]interface{}) error {
+	var file RequestBodyFile
+	var ok bool
+	if file.Filename, ok = v["filename"].(string); !ok {
+		return errors.Errorf("expected string filename, got %T", v["filename"])
+	}
+	size, ok := v["size"].(float64)
+	if !ok {
+		return errors.Errorf("expected numeric size, got %T", v["size"])
+	}
+	file.Size = int64(size)
+	file.ContentType, _ = v["content_type"].(string)
+	if b.Files == nil {
+		b.Files = make(map[string][]RequestBodyFile)
+	}
+	b.Files[field] = append(b.Files[field], file)
+	return nil
+}
+
 func (m IfaceMap) isZero() bool {
 	return len(m) == 0
 }
@@ -533,3 +669,45 @@ func writeHex(w *fastjson.Writer, v []byte) {
 		w.RawByte(hextable[v&0x0f])
 	}
 }
+
+func (m TransactionMarks) isZero() bool {
+	return len(m) == 0
+}
+
+// MarshalFastJSON writes the JSON representation of m to w.
+func (m TransactionMarks) MarshalFastJSON(w *fastjson.Writer) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	w.RawByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			w.RawByte(',')
+		}
+		w.String(k)
+		w.RawByte(':')
+		m[k].MarshalFastJSON(w)
+	}
+	w.RawByte('}')
+}
+
+// MarshalFastJSON writes the JSON representation of m to w.
+func (m TransactionMark) MarshalFastJSON(w *fastjson.Writer) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	w.RawByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			w.RawByte(',')
+		}
+		w.String(k)
+		w.RawByte(':')
+		w.Float64(m[k])
+	}
+	w.RawByte('}')
+}
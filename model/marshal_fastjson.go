@@ -12,6 +12,17 @@ func (v *Service) MarshalFastJSON(w *fastjson.Writer) {
 	v.Agent.MarshalFastJSON(w)
 	w.RawString(",\"name\":")
 	w.String(v.Name)
+	if v.Dependencies != nil {
+		w.RawString(",\"dependencies\":")
+		w.RawByte('[')
+		for i, v := range v.Dependencies {
+			if i != 0 {
+				w.RawByte(',')
+			}
+			v.MarshalFastJSON(w)
+		}
+		w.RawByte(']')
+	}
 	if v.Environment != "" {
 		w.RawString(",\"environment\":")
 		w.String(v.Environment)
@@ -35,6 +46,21 @@ func (v *Service) MarshalFastJSON(w *fastjson.Writer) {
 	w.RawByte('}')
 }
 
+func (v *Dependency) MarshalFastJSON(w *fastjson.Writer) {
+	w.RawByte('{')
+	w.RawString("\"path\":")
+	w.String(v.Path)
+	if v.Replace != "" {
+		w.RawString(",\"replace\":")
+		w.String(v.Replace)
+	}
+	if v.Version != "" {
+		w.RawString(",\"version\":")
+		w.String(v.Version)
+	}
+	w.RawByte('}')
+}
+
 func (v *Agent) MarshalFastJSON(w *fastjson.Writer) {
 	w.RawByte('{')
 	w.RawString("\"name\":")
@@ -86,6 +112,36 @@ func (v *System) MarshalFastJSON(w *fastjson.Writer) {
 		}
 		w.String(v.Architecture)
 	}
+	if v.Container != nil {
+		const prefix = ",\"container\":"
+		if first {
+			first = false
+			w.RawString(prefix[1:])
+		} else {
+			w.RawString(prefix)
+		}
+		v.Container.MarshalFastJSON(w)
+	}
+	if v.CPUCount != 0 {
+		const prefix = ",\"cpu_count\":"
+		if first {
+			first = false
+			w.RawString(prefix[1:])
+		} else {
+			w.RawString(prefix)
+		}
+		w.Int64(int64(v.CPUCount))
+	}
+	if v.CPUQuota != 0 {
+		const prefix = ",\"cpu_quota\":"
+		if first {
+			first = false
+			w.RawString(prefix[1:])
+		} else {
+			w.RawString(prefix)
+		}
+		w.Float64(v.CPUQuota)
+	}
 	if v.Hostname != "" {
 		const prefix = ",\"hostname\":"
 		if first {
@@ -96,6 +152,16 @@ func (v *System) MarshalFastJSON(w *fastjson.Writer) {
 		}
 		w.String(v.Hostname)
 	}
+	if v.Kubernetes != nil {
+		const prefix = ",\"kubernetes\":"
+		if first {
+			first = false
+			w.RawString(prefix[1:])
+		} else {
+			w.RawString(prefix)
+		}
+		v.Kubernetes.MarshalFastJSON(w)
+	}
 	if v.Platform != "" {
 		const prefix = ",\"platform\":"
 		if first {
@@ -109,6 +175,84 @@ func (v *System) MarshalFastJSON(w *fastjson.Writer) {
 	w.RawByte('}')
 }
 
+func (v *Container) MarshalFastJSON(w *fastjson.Writer) {
+	w.RawByte('{')
+	w.RawString("\"id\":")
+	w.String(v.ID)
+	w.RawByte('}')
+}
+
+func (v *Kubernetes) MarshalFastJSON(w *fastjson.Writer) {
+	w.RawByte('{')
+	first := true
+	if v.Namespace != "" {
+		const prefix = ",\"namespace\":"
+		if first {
+			first = false
+			w.RawString(prefix[1:])
+		} else {
+			w.RawString(prefix)
+		}
+		w.String(v.Namespace)
+	}
+	if v.Node != nil {
+		const prefix = ",\"node\":"
+		if first {
+			first = false
+			w.RawString(prefix[1:])
+		} else {
+			w.RawString(prefix)
+		}
+		v.Node.MarshalFastJSON(w)
+	}
+	if v.Pod != nil {
+		const prefix = ",\"pod\":"
+		if first {
+			first = false
+			w.RawString(prefix[1:])
+		} else {
+			w.RawString(prefix)
+		}
+		v.Pod.MarshalFastJSON(w)
+	}
+	w.RawByte('}')
+}
+
+func (v *KubernetesNode) MarshalFastJSON(w *fastjson.Writer) {
+	w.RawByte('{')
+	if v.Name != "" {
+		w.RawString("\"name\":")
+		w.String(v.Name)
+	}
+	w.RawByte('}')
+}
+
+func (v *KubernetesPod) MarshalFastJSON(w *fastjson.Writer) {
+	w.RawByte('{')
+	first := true
+	if v.Name != "" {
+		const prefix = ",\"name\":"
+		if first {
+			first = false
+			w.RawString(prefix[1:])
+		} else {
+			w.RawString(prefix)
+		}
+		w.String(v.Name)
+	}
+	if v.UID != "" {
+		const prefix = ",\"uid\":"
+		if first {
+			first = false
+			w.RawString(prefix[1:])
+		} else {
+			w.RawString(prefix)
+		}
+		w.String(v.UID)
+	}
+	w.RawByte('}')
+}
+
 func (v *Process) MarshalFastJSON(w *fastjson.Writer) {
 	w.RawByte('{')
 	w.RawString("\"pid\":")
@@ -124,10 +268,22 @@ func (v *Process) MarshalFastJSON(w *fastjson.Writer) {
 		}
 		w.RawByte(']')
 	}
+	if v.Cwd != "" {
+		w.RawString(",\"cwd\":")
+		w.String(v.Cwd)
+	}
+	if v.GOMAXPROCS != 0 {
+		w.RawString(",\"gomaxprocs\":")
+		w.Int64(int64(v.GOMAXPROCS))
+	}
 	if v.Ppid != nil {
 		w.RawString(",\"ppid\":")
 		w.Int64(int64(*v.Ppid))
 	}
+	if v.Supervisor != nil {
+		w.RawString(",\"supervisor\":")
+		v.Supervisor.MarshalFastJSON(w)
+	}
 	if v.Title != "" {
 		w.RawString(",\"title\":")
 		w.String(v.Title)
@@ -135,6 +291,17 @@ func (v *Process) MarshalFastJSON(w *fastjson.Writer) {
 	w.RawByte('}')
 }
 
+func (v *ProcessSupervisor) MarshalFastJSON(w *fastjson.Writer) {
+	w.RawByte('{')
+	w.RawString("\"pid\":")
+	w.Int64(int64(v.Pid))
+	if v.ServiceName != "" {
+		w.RawString(",\"service_name\":")
+		w.String(v.ServiceName)
+	}
+	w.RawByte('}')
+}
+
 func (v *Transaction) MarshalFastJSON(w *fastjson.Writer) {
 	w.RawByte('{')
 	w.RawString("\"duration\":")
@@ -151,6 +318,21 @@ func (v *Transaction) MarshalFastJSON(w *fastjson.Writer) {
 		w.RawString(",\"context\":")
 		v.Context.MarshalFastJSON(w)
 	}
+	if v.DroppedSpansStats != nil {
+		w.RawString(",\"dropped_spans_stats\":")
+		w.RawByte('[')
+		for i, v := range v.DroppedSpansStats {
+			if i != 0 {
+				w.RawByte(',')
+			}
+			v.MarshalFastJSON(w)
+		}
+		w.RawByte(']')
+	}
+	if !v.Marks.isZero() {
+		w.RawString(",\"marks\":")
+		v.Marks.MarshalFastJSON(w)
+	}
 	if v.Result != "" {
 		w.RawString(",\"result\":")
 		w.String(v.Result)
@@ -193,6 +375,39 @@ func (v *SpanCountDropped) MarshalFastJSON(w *fastjson.Writer) {
 	w.RawByte('}')
 }
 
+func (v *DroppedSpansStats) MarshalFastJSON(w *fastjson.Writer) {
+	w.RawByte('{')
+	w.RawString("\"count\":")
+	w.Int64(int64(v.Count))
+	w.RawString(",\"type\":")
+	w.String(v.Type)
+	if v.DestinationServiceResource != "" {
+		w.RawString(",\"destination_service_resource\":")
+		w.String(v.DestinationServiceResource)
+	}
+	if v.Duration != nil {
+		w.RawString(",\"duration\":")
+		v.Duration.MarshalFastJSON(w)
+	}
+	w.RawByte('}')
+}
+
+func (v *DroppedSpansDuration) MarshalFastJSON(w *fastjson.Writer) {
+	w.RawByte('{')
+	w.RawString("\"count\":")
+	w.Int64(int64(v.Count))
+	w.RawString(",\"sum\":")
+	v.Sum.MarshalFastJSON(w)
+	w.RawByte('}')
+}
+
+func (v *DroppedSpansDurationSum) MarshalFastJSON(w *fastjson.Writer) {
+	w.RawByte('{')
+	w.RawString("\"us\":")
+	w.Int64(v.US)
+	w.RawByte('}')
+}
+
 func (v *Span) MarshalFastJSON(w *fastjson.Writer) {
 	w.RawByte('{')
 	w.RawString("\"duration\":")
@@ -203,6 +418,10 @@ func (v *Span) MarshalFastJSON(w *fastjson.Writer) {
 	w.Float64(v.Start)
 	w.RawString(",\"type\":")
 	w.String(v.Type)
+	if v.Composite != nil {
+		w.RawString(",\"composite\":")
+		v.Composite.MarshalFastJSON(w)
+	}
 	if v.Context != nil {
 		w.RawString(",\"context\":")
 		v.Context.MarshalFastJSON(w)
@@ -229,12 +448,137 @@ func (v *Span) MarshalFastJSON(w *fastjson.Writer) {
 	w.RawByte('}')
 }
 
+func (v *CompositeSpan) MarshalFastJSON(w *fastjson.Writer) {
+	w.RawByte('{')
+	w.RawString("\"compression_strategy\":")
+	w.String(v.CompressionStrategy)
+	w.RawString(",\"count\":")
+	w.Int64(int64(v.Count))
+	w.RawString(",\"sum\":")
+	w.Float64(v.Sum)
+	w.RawByte('}')
+}
+
 func (v *SpanContext) MarshalFastJSON(w *fastjson.Writer) {
 	w.RawByte('{')
+	first := true
 	if v.Database != nil {
-		w.RawString("\"db\":")
+		const prefix = ",\"db\":"
+		if first {
+			first = false
+			w.RawString(prefix[1:])
+		} else {
+			w.RawString(prefix)
+		}
 		v.Database.MarshalFastJSON(w)
 	}
+	if v.Destination != nil {
+		const prefix = ",\"destination\":"
+		if first {
+			first = false
+			w.RawString(prefix[1:])
+		} else {
+			w.RawString(prefix)
+		}
+		v.Destination.MarshalFastJSON(w)
+	}
+	if v.HTTP != nil {
+		const prefix = ",\"http\":"
+		if first {
+			first = false
+			w.RawString(prefix[1:])
+		} else {
+			w.RawString(prefix)
+		}
+		v.HTTP.MarshalFastJSON(w)
+	}
+	if v.Service != nil {
+		const prefix = ",\"service\":"
+		if first {
+			first = false
+			w.RawString(prefix[1:])
+		} else {
+			w.RawString(prefix)
+		}
+		v.Service.MarshalFastJSON(w)
+	}
+	if v.Tags != nil {
+		const prefix = ",\"tags\":"
+		if first {
+			first = false
+			w.RawString(prefix[1:])
+		} else {
+			w.RawString(prefix)
+		}
+		w.RawByte('{')
+		{
+			first := true
+			for k, v := range v.Tags {
+				if first {
+					first = false
+				} else {
+					w.RawByte(',')
+				}
+				w.String(k)
+				w.RawByte(':')
+				w.String(v)
+			}
+		}
+		w.RawByte('}')
+	}
+	w.RawByte('}')
+}
+
+func (v *DestinationSpanContext) MarshalFastJSON(w *fastjson.Writer) {
+	w.RawByte('{')
+	if v.Service != nil {
+		w.RawString("\"service\":")
+		v.Service.MarshalFastJSON(w)
+	}
+	w.RawByte('}')
+}
+
+func (v *DestinationServiceSpanContext) MarshalFastJSON(w *fastjson.Writer) {
+	w.RawByte('{')
+	if v.Resource != "" {
+		w.RawString("\"resource\":")
+		w.String(v.Resource)
+	}
+	w.RawByte('}')
+}
+
+func (v *ServiceSpanContext) MarshalFastJSON(w *fastjson.Writer) {
+	w.RawByte('{')
+	if v.Target != nil {
+		w.RawString("\"target\":")
+		v.Target.MarshalFastJSON(w)
+	}
+	w.RawByte('}')
+}
+
+func (v *ServiceTargetSpanContext) MarshalFastJSON(w *fastjson.Writer) {
+	w.RawByte('{')
+	first := true
+	if v.Name != "" {
+		const prefix = ",\"name\":"
+		if first {
+			first = false
+			w.RawString(prefix[1:])
+		} else {
+			w.RawString(prefix)
+		}
+		w.String(v.Name)
+	}
+	if v.Type != "" {
+		const prefix = ",\"type\":"
+		if first {
+			first = false
+			w.RawString(prefix[1:])
+		} else {
+			w.RawString(prefix)
+		}
+		w.String(v.Type)
+	}
 	w.RawByte('}')
 }
 
@@ -251,6 +595,16 @@ func (v *DatabaseSpanContext) MarshalFastJSON(w *fastjson.Writer) {
 		}
 		w.String(v.Instance)
 	}
+	if v.RowsAffected != nil {
+		const prefix = ",\"rows_affected\":"
+		if first {
+			first = false
+			w.RawString(prefix[1:])
+		} else {
+			w.RawString(prefix)
+		}
+		w.Int64(*v.RowsAffected)
+	}
 	if v.Statement != "" {
 		const prefix = ",\"statement\":"
 		if first {
@@ -284,6 +638,73 @@ func (v *DatabaseSpanContext) MarshalFastJSON(w *fastjson.Writer) {
 	w.RawByte('}')
 }
 
+func (v *HTTPSpanContext) MarshalFastJSON(w *fastjson.Writer) {
+	w.RawByte('{')
+	first := true
+	if v.HTTPVersion != "" {
+		const prefix = ",\"http_version\":"
+		if first {
+			first = false
+			w.RawString(prefix[1:])
+		} else {
+			w.RawString(prefix)
+		}
+		w.String(v.HTTPVersion)
+	}
+	if v.StatusCode != 0 {
+		const prefix = ",\"status_code\":"
+		if first {
+			first = false
+			w.RawString(prefix[1:])
+		} else {
+			w.RawString(prefix)
+		}
+		w.Int64(int64(v.StatusCode))
+	}
+	if v.Trailers != nil {
+		const prefix = ",\"trailers\":"
+		if first {
+			first = false
+			w.RawString(prefix[1:])
+		} else {
+			w.RawString(prefix)
+		}
+		w.RawByte('{')
+		{
+			first := true
+			for k, v := range v.Trailers {
+				if first {
+					first = false
+				} else {
+					w.RawByte(',')
+				}
+				w.String(k)
+				w.RawByte(':')
+				w.RawByte('[')
+				for i, v := range v {
+					if i != 0 {
+						w.RawByte(',')
+					}
+					w.String(v)
+				}
+				w.RawByte(']')
+			}
+		}
+		w.RawByte('}')
+	}
+	if v.URL != "" {
+		const prefix = ",\"url\":"
+		if first {
+			first = false
+			w.RawString(prefix[1:])
+		} else {
+			w.RawString(prefix)
+		}
+		w.String(v.URL)
+	}
+	w.RawByte('}')
+}
+
 func (v *Context) MarshalFastJSON(w *fastjson.Writer) {
 	w.RawByte('{')
 	first := true
@@ -625,42 +1046,44 @@ func (v *Request) MarshalFastJSON(w *fastjson.Writer) {
 		w.RawString(",\"socket\":")
 		v.Socket.MarshalFastJSON(w)
 	}
+	if v.Trailers != nil {
+		w.RawString(",\"trailers\":")
+		w.RawByte('{')
+		{
+			first := true
+			for k, v := range v.Trailers {
+				if first {
+					first = false
+				} else {
+					w.RawByte(',')
+				}
+				w.String(k)
+				w.RawByte(':')
+				w.RawByte('[')
+				for i, v := range v {
+					if i != 0 {
+						w.RawByte(',')
+					}
+					w.String(v)
+				}
+				w.RawByte(']')
+			}
+		}
+		w.RawByte('}')
+	}
 	w.RawByte('}')
 }
 
-func (v *RequestHeaders) MarshalFastJSON(w *fastjson.Writer) {
+func (v *RequestBodyFile) MarshalFastJSON(w *fastjson.Writer) {
 	w.RawByte('{')
-	first := true
+	w.RawString("\"filename\":")
+	w.String(v.Filename)
+	w.RawString(",\"size\":")
+	w.Int64(v.Size)
 	if v.ContentType != "" {
-		const prefix = ",\"content-type\":"
-		if first {
-			first = false
-			w.RawString(prefix[1:])
-		} else {
-			w.RawString(prefix)
-		}
+		w.RawString(",\"content_type\":")
 		w.String(v.ContentType)
 	}
-	if v.Cookie != "" {
-		const prefix = ",\"cookie\":"
-		if first {
-			first = false
-			w.RawString(prefix[1:])
-		} else {
-			w.RawString(prefix)
-		}
-		w.String(v.Cookie)
-	}
-	if v.UserAgent != "" {
-		const prefix = ",\"user-agent\":"
-		if first {
-			first = false
-			w.RawString(prefix[1:])
-		} else {
-			w.RawString(prefix)
-		}
-		w.String(v.UserAgent)
-	}
 	w.RawByte('}')
 }
 
@@ -733,14 +1156,36 @@ func (v *Response) MarshalFastJSON(w *fastjson.Writer) {
 		}
 		w.Int64(int64(v.StatusCode))
 	}
-	w.RawByte('}')
-}
-
-func (v *ResponseHeaders) MarshalFastJSON(w *fastjson.Writer) {
-	w.RawByte('{')
-	if v.ContentType != "" {
-		w.RawString("\"content-type\":")
-		w.String(v.ContentType)
+	if v.Trailers != nil {
+		const prefix = ",\"trailers\":"
+		if first {
+			first = false
+			w.RawString(prefix[1:])
+		} else {
+			w.RawString(prefix)
+		}
+		w.RawByte('{')
+		{
+			first := true
+			for k, v := range v.Trailers {
+				if first {
+					first = false
+				} else {
+					w.RawByte(',')
+				}
+				w.String(k)
+				w.RawByte(':')
+				w.RawByte('[')
+				for i, v := range v {
+					if i != 0 {
+						w.RawByte(',')
+					}
+					w.String(v)
+				}
+				w.RawByte(']')
+			}
+		}
+		w.RawByte('}')
 	}
 	w.RawByte('}')
 }
@@ -784,6 +1229,10 @@ func (v *Metric) MarshalFastJSON(w *fastjson.Writer) {
 		w.RawString(",\"count\":")
 		w.Uint64(*v.Count)
 	}
+	if v.Exemplar != nil {
+		w.RawString(",\"exemplar\":")
+		v.Exemplar.MarshalFastJSON(w)
+	}
 	if v.Max != nil {
 		w.RawString(",\"max\":")
 		w.Float64(*v.Max)
@@ -822,6 +1271,21 @@ func (v *Metric) MarshalFastJSON(w *fastjson.Writer) {
 	w.RawByte('}')
 }
 
+func (v *Exemplar) MarshalFastJSON(w *fastjson.Writer) {
+	w.RawByte('{')
+	w.RawString("\"labels\":")
+	if v.Labels == nil {
+		w.RawString("null")
+	} else {
+		v.Labels.MarshalFastJSON(w)
+	}
+	w.RawString(",\"timestamp\":")
+	v.Timestamp.MarshalFastJSON(w)
+	w.RawString(",\"value\":")
+	w.Float64(v.Value)
+	w.RawByte('}')
+}
+
 func (v *TransactionsPayload) MarshalFastJSON(w *fastjson.Writer) {
 	w.RawByte('{')
 	w.RawString("\"service\":")
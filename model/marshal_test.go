@@ -105,6 +105,16 @@ func TestMarshalTransaction(t *testing.T) {
 	assert.Equal(t, expect, in)
 }
 
+func TestMarshalTransactionMarks(t *testing.T) {
+	marks := model.TransactionMarks{
+		"phases": {"fetch": 30, "auth": 10.5},
+		"other":  {"render": 1},
+	}
+	var w fastjson.Writer
+	marks.MarshalFastJSON(&w)
+	assert.Equal(t, `{"other":{"render":1},"phases":{"auth":10.5,"fetch":30}}`, string(w.Bytes()))
+}
+
 func TestMarshalMetrics(t *testing.T) {
 	metrics := fakeMetrics()
 
@@ -145,6 +155,13 @@ func TestMarshalMetrics(t *testing.T) {
 					[]interface{}{float64(0.75), float64(100)},
 					[]interface{}{float64(1.00), float64(100)},
 				},
+				"exemplar": map[string]interface{}{
+					"value":     float64(150),
+					"timestamp": "1970-01-01T00:02:00Z",
+					"labels": map[string]interface{}{
+						"transaction_id": "abc",
+					},
+				},
 			},
 		},
 	}
@@ -289,6 +306,40 @@ func TestMarshalRequestBody(t *testing.T) {
 	assert.Equal(t, expect, in)
 }
 
+func TestMarshalRequestBodyFiles(t *testing.T) {
+	body := model.RequestBody{
+		Form: url.Values{"name": []string{"gopher"}},
+		Files: map[string][]model.RequestBodyFile{
+			"avatar": {{Filename: "gopher.png", Size: 123, ContentType: "image/png"}},
+			"attachments": {
+				{Filename: "a.txt", Size: 1},
+				{Filename: "b.txt", Size: 2},
+			},
+		},
+	}
+	var w fastjson.Writer
+	body.MarshalFastJSON(&w)
+
+	var in map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Bytes(), &in))
+	assert.Equal(t, map[string]interface{}{
+		"name": "gopher",
+		"avatar": map[string]interface{}{
+			"filename":     "gopher.png",
+			"size":         float64(123),
+			"content_type": "image/png",
+		},
+		"attachments": []interface{}{
+			map[string]interface{}{"filename": "a.txt", "size": float64(1)},
+			map[string]interface{}{"filename": "b.txt", "size": float64(2)},
+		},
+	}, in)
+
+	var out model.RequestBody
+	require.NoError(t, json.Unmarshal(w.Bytes(), &out))
+	assert.Equal(t, body, out)
+}
+
 func TestMarshalLog(t *testing.T) {
 	log := model.Log{
 		Message:      "foo",
@@ -612,6 +663,11 @@ func fakeMetrics() *model.Metrics {
 					{Quantile: 0.75, Value: 100},
 					{Quantile: 1, Value: 100},
 				},
+				Exemplar: &model.Exemplar{
+					Value:     150,
+					Timestamp: model.Time(time.Unix(120, 0).UTC()),
+					Labels:    model.StringMap{{Key: "transaction_id", Value: "abc"}},
+				},
 			},
 		},
 	}
@@ -688,3 +744,24 @@ func newUint64(v uint64) *uint64 {
 func newFloat64(v float64) *float64 {
 	return &v
 }
+
+func TestMarshalRequestHeadersOther(t *testing.T) {
+	in := model.RequestHeaders{
+		UserAgent: "test",
+		Other: model.StringMap{
+			{Key: "x-amz-date", Value: "20181012T000000Z"},
+			{Key: "x-request-id", Value: "abc"},
+		},
+	}
+	var w fastjson.Writer
+	in.MarshalFastJSON(&w)
+	assert.Equal(t,
+		`{"user-agent":"test","x-amz-date":"20181012T000000Z","x-request-id":"abc"}`,
+		string(w.Bytes()),
+	)
+
+	var out model.RequestHeaders
+	err := json.Unmarshal(w.Bytes(), &out)
+	require.NoError(t, err)
+	assert.Equal(t, in, out)
+}
@@ -32,6 +32,25 @@ type Service struct {
 	// Runtime holds information about the programming language runtime
 	// running this service.
 	Runtime *Runtime `json:"runtime,omitempty"`
+
+	// Dependencies holds the module dependencies of the service, if
+	// they are being reported. Dependencies are reported only once
+	// by each tracer.
+	Dependencies []Dependency `json:"dependencies,omitempty"`
+}
+
+// Dependency describes a module dependency of the service.
+type Dependency struct {
+	// Path is the module path, e.g. "github.com/pkg/errors".
+	Path string `json:"path"`
+
+	// Version is the module version, e.g. "v0.8.0".
+	Version string `json:"version,omitempty"`
+
+	// Replace holds the replacement for the module, if it has been
+	// replaced, in the form "path@version", or just "path" for local
+	// replacements.
+	Replace string `json:"replace,omitempty"`
 }
 
 // Agent holds information about the Elastic APM agent.
@@ -82,6 +101,55 @@ type System struct {
 
 	// Platform is the system's platform, or operating system name.
 	Platform string `json:"platform,omitempty"`
+
+	// CPUCount is the number of logical CPUs usable by the process,
+	// as reported by runtime.NumCPU.
+	CPUCount int `json:"cpu_count,omitempty"`
+
+	// CPUQuota is the CPU quota of the process's control group,
+	// in cores, if it has one.
+	CPUQuota float64 `json:"cpu_quota,omitempty"`
+
+	// Container describes the container in which the process
+	// is running, if any.
+	Container *Container `json:"container,omitempty"`
+
+	// Kubernetes describes the Kubernetes pod in which the
+	// process is running, if any.
+	Kubernetes *Kubernetes `json:"kubernetes,omitempty"`
+}
+
+// Container represents a container, e.g. a Docker container.
+type Container struct {
+	// ID is the container's ID.
+	ID string `json:"id"`
+}
+
+// Kubernetes holds Kubernetes metadata for a pod.
+type Kubernetes struct {
+	// Namespace is the namespace of the pod.
+	Namespace string `json:"namespace,omitempty"`
+
+	// Node describes the node on which the pod is running.
+	Node *KubernetesNode `json:"node,omitempty"`
+
+	// Pod describes the pod.
+	Pod *KubernetesPod `json:"pod,omitempty"`
+}
+
+// KubernetesNode holds Kubernetes node metadata.
+type KubernetesNode struct {
+	// Name is the name of the node.
+	Name string `json:"name,omitempty"`
+}
+
+// KubernetesPod holds Kubernetes pod metadata.
+type KubernetesPod struct {
+	// Name is the name of the pod.
+	Name string `json:"name,omitempty"`
+
+	// UID is the UID of the pod.
+	UID string `json:"uid,omitempty"`
 }
 
 // Process represents an operating system process.
@@ -97,6 +165,27 @@ type Process struct {
 
 	// Argv holds the command line arguments used to start the process.
 	Argv []string `json:"argv,omitempty"`
+
+	// Cwd is the working directory of the process, if known.
+	Cwd string `json:"cwd,omitempty"`
+
+	// GOMAXPROCS is the value of runtime.GOMAXPROCS for the
+	// process, when the tracer was created.
+	GOMAXPROCS int `json:"gomaxprocs,omitempty"`
+
+	// Supervisor holds details of the supervisor process which
+	// started this process, if any.
+	Supervisor *ProcessSupervisor `json:"supervisor,omitempty"`
+}
+
+// ProcessSupervisor holds details of a supervisor process, such as
+// the master process in a pre-fork server.
+type ProcessSupervisor struct {
+	// Pid is the process ID of the supervisor.
+	Pid int `json:"pid"`
+
+	// ServiceName is the service name of the supervisor, if known.
+	ServiceName string `json:"service_name,omitempty"`
 }
 
 // Transaction represents a transaction handled by the service.
@@ -136,10 +225,24 @@ type Transaction struct {
 	// SpanCount holds statistics on spans within a transaction.
 	SpanCount SpanCount `json:"span_count,omitempty"`
 
+	// DroppedSpansStats holds statistics on the spans dropped by
+	// the agent within the transaction, grouped by span type.
+	DroppedSpansStats []DroppedSpansStats `json:"dropped_spans_stats,omitempty"`
+
+	// Marks holds user-defined timing marks within the transaction.
+	Marks TransactionMarks `json:"marks,omitempty"`
+
 	// Spans holds the transaction's spans.
 	Spans []Span `json:"spans,omitempty"`
 }
 
+// TransactionMarks holds groups of timing marks, keyed by group name.
+type TransactionMarks map[string]TransactionMark
+
+// TransactionMark holds a group of timing marks, mapping each mark name
+// to its offset from the start of the transaction, in milliseconds.
+type TransactionMark map[string]float64
+
 // SpanCount holds statistics on spans within a transaction.
 type SpanCount struct {
 	// Dropped holds statistics on dropped spans within a transaction.
@@ -153,6 +256,40 @@ type SpanCountDropped struct {
 	Total int `json:"total"`
 }
 
+// DroppedSpansStats holds statistics on dropped spans of a type,
+// and for exit spans, of a destination service.
+type DroppedSpansStats struct {
+	// Type holds the type of the dropped spans, e.g. "db.postgresql.query".
+	Type string `json:"type"`
+
+	// DestinationServiceResource holds the destination service
+	// resource of dropped exit spans, e.g. "postgresql/orders-db".
+	DestinationServiceResource string `json:"destination_service_resource,omitempty"`
+
+	// Count holds the number of dropped spans of the type.
+	Count int `json:"count"`
+
+	// Duration holds the durations of the dropped spans, if known.
+	// Durations are recorded only for exit spans.
+	Duration *DroppedSpansDuration `json:"duration,omitempty"`
+}
+
+// DroppedSpansDuration holds the durations of dropped spans.
+type DroppedSpansDuration struct {
+	// Count holds the number of dropped spans whose durations
+	// are included in Sum.
+	Count int `json:"count"`
+
+	// Sum holds the sum of the dropped span durations.
+	Sum DroppedSpansDurationSum `json:"sum"`
+}
+
+// DroppedSpansDurationSum holds the sum of dropped span durations.
+type DroppedSpansDurationSum struct {
+	// US holds the sum in microseconds.
+	US int64 `json:"us"`
+}
+
 // Span represents a span within a transaction.
 type Span struct {
 	// Name holds the name of the span.
@@ -181,6 +318,26 @@ type Span struct {
 
 	// Stacktrace holds stack frames corresponding to the span.
 	Stacktrace []StacktraceFrame `json:"stacktrace,omitempty"`
+
+	// Composite holds details of the spans compressed into this
+	// span, if it is a composite span.
+	Composite *CompositeSpan `json:"composite,omitempty"`
+}
+
+// CompositeSpan holds details of a composite span, which represents
+// a sequence of consecutive, similar exit spans compressed into one.
+type CompositeSpan struct {
+	// Count holds the number of spans compressed into the composite span.
+	Count int `json:"count"`
+
+	// Sum holds the sum of the durations of the compressed
+	// spans, in milliseconds.
+	Sum float64 `json:"sum"`
+
+	// CompressionStrategy holds the strategy with which the spans were
+	// compressed: "exact_match" if they all have the same name, or
+	// "same_kind" if they only have the same type and destination.
+	CompressionStrategy string `json:"compression_strategy"`
 }
 
 // SpanContext holds contextual information relating to the span.
@@ -188,6 +345,53 @@ type SpanContext struct {
 	// Database holds contextual information for database
 	// operation spans.
 	Database *DatabaseSpanContext `json:"db,omitempty"`
+
+	// HTTP holds contextual information for HTTP client
+	// request spans.
+	HTTP *HTTPSpanContext `json:"http,omitempty"`
+
+	// Destination holds contextual information about the
+	// destination of exit spans.
+	Destination *DestinationSpanContext `json:"destination,omitempty"`
+
+	// Service holds contextual information about the service
+	// targeted by exit spans.
+	Service *ServiceSpanContext `json:"service,omitempty"`
+
+	// Tags holds user-defined key/value pairs.
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+// DestinationSpanContext holds contextual information about the
+// destination of an exit span.
+type DestinationSpanContext struct {
+	// Service holds the destination service.
+	Service *DestinationServiceSpanContext `json:"service,omitempty"`
+}
+
+// DestinationServiceSpanContext holds the legacy representation of
+// the destination service of an exit span.
+type DestinationServiceSpanContext struct {
+	// Resource holds the destination service resource, used for
+	// grouping dependencies, e.g. "postgresql/orders-db".
+	Resource string `json:"resource,omitempty"`
+}
+
+// ServiceSpanContext holds contextual information about the service
+// targeted by an exit span.
+type ServiceSpanContext struct {
+	// Target holds the target service.
+	Target *ServiceTargetSpanContext `json:"target,omitempty"`
+}
+
+// ServiceTargetSpanContext identifies the service targeted by an
+// exit span, by type and name.
+type ServiceTargetSpanContext struct {
+	// Type holds the target service type, e.g. "postgresql".
+	Type string `json:"type,omitempty"`
+
+	// Name holds the target service name, e.g. "orders-db".
+	Name string `json:"name,omitempty"`
 }
 
 // DatabaseSpanContext holds contextual information for database
@@ -206,6 +410,27 @@ type DatabaseSpanContext struct {
 
 	// User holds the username used for database access.
 	User string `json:"user,omitempty"`
+
+	// RowsAffected holds the number of rows affected by the
+	// database operation, if known.
+	RowsAffected *int64 `json:"rows_affected,omitempty"`
+}
+
+// HTTPSpanContext holds contextual information for HTTP client
+// request spans.
+type HTTPSpanContext struct {
+	// URL holds the URL of the HTTP request, excluding any password.
+	URL string `json:"url,omitempty"`
+
+	// StatusCode holds the HTTP response status code.
+	StatusCode int `json:"status_code,omitempty"`
+
+	// HTTPVersion holds the HTTP protocol version of the
+	// response, e.g. "2.0".
+	HTTPVersion string `json:"http_version,omitempty"`
+
+	// Trailers holds the HTTP response trailers, if any.
+	Trailers http.Header `json:"trailers,omitempty"`
 }
 
 // Context holds contextual information relating to a transaction or error.
@@ -399,6 +624,9 @@ type Request struct {
 
 	// Socket holds transport-level information.
 	Socket *RequestSocket `json:"socket,omitempty"`
+
+	// Trailers holds the HTTP request trailers, if any.
+	Trailers http.Header `json:"trailers,omitempty"`
 }
 
 // Cookies holds a collection of HTTP cookies.
@@ -406,13 +634,30 @@ type Cookies []*http.Cookie
 
 // RequestBody holds a request body.
 //
-// Exactly one of Raw or Form must be set.
+// Exactly one of Raw or Form must be set. Files may only be set if
+// Form is set.
 type RequestBody struct {
 	// Raw holds the raw body content.
 	Raw string
 
 	// Form holds the form data from POST, PATCH, or PUT body parameters.
 	Form url.Values
+
+	// Files holds metadata for the files in a multipart form,
+	// keyed by form field name. File contents are not recorded.
+	Files map[string][]RequestBodyFile
+}
+
+// RequestBodyFile holds metadata for a file in a multipart form.
+type RequestBodyFile struct {
+	// Filename holds the name of the file, as given by the client.
+	Filename string `json:"filename"`
+
+	// Size holds the size of the file in bytes.
+	Size int64 `json:"size"`
+
+	// ContentType holds the content-type of the file part, if specified.
+	ContentType string `json:"content_type,omitempty"`
 }
 
 // RequestHeaders holds a limited subset of HTTP request headers.
@@ -426,6 +671,10 @@ type RequestHeaders struct {
 
 	// UserAgent holds the user-agent header.
 	UserAgent string `json:"user-agent,omitempty"`
+
+	// Other holds any other captured headers, keyed by
+	// lower-case header name, and ordered by key.
+	Other StringMap `json:"-"`
 }
 
 // RequestSocket holds transport-level information relating to an HTTP request.
@@ -478,12 +727,19 @@ type Response struct {
 
 	// Finished indicates whether or not the response was finished.
 	Finished *bool `json:"finished,omitempty"`
+
+	// Trailers holds the HTTP response trailers, if any.
+	Trailers http.Header `json:"trailers,omitempty"`
 }
 
 // ResponseHeaders holds a limited subset of HTTP respponse headers.
 type ResponseHeaders struct {
 	// ContentType holds the content-type header.
 	ContentType string `json:"content-type,omitempty"`
+
+	// Other holds any other captured headers, keyed by
+	// lower-case header name, and ordered by key.
+	Other StringMap `json:"-"`
 }
 
 // Time is a timestamp, formatted as "YYYY-MM-DDTHH:mm:ss.sssZ".
@@ -533,6 +789,26 @@ type Metric struct {
 
 	// Quantiles holds φ-quantiles for summary metrics.
 	Quantiles []Quantile `json:"quantiles,omitempty"`
+
+	// Exemplar holds an optional exemplar for the metric,
+	// identifying a representative event which contributed
+	// to the metric value.
+	Exemplar *Exemplar `json:"exemplar,omitempty"`
+}
+
+// Exemplar holds an exemplar for a metric sample, following the
+// semantics of OpenMetrics exemplars.
+type Exemplar struct {
+	// Value holds the value of the exemplified event,
+	// e.g. a transaction's duration.
+	Value float64 `json:"value"`
+
+	// Timestamp holds the time at which the event occurred.
+	Timestamp Time `json:"timestamp"`
+
+	// Labels holds labels identifying the event,
+	// e.g. "transaction_id".
+	Labels StringMap `json:"labels"`
 }
 
 // Quantile represents a φ-quantile for a summary metric.
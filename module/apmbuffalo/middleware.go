@@ -17,26 +17,39 @@ import (
 // This middleware will report panics, but will propagate them back
 // up the stack to be handled by standard buffalo PanicHandler.
 //
-// By default, the middleware will use elasticapm.DefaultTracer.
-// Use WithTracer to specify an alternative tracer.
+// By default, the middleware will use the tracer returned by
+// elasticapm.TracerFromContext for each request's context, which
+// is elasticapm.DefaultTracer unless another tracer has been
+// selected. Use WithTracer to specify a fixed tracer.
+//
+// By default, CORS preflight requests and requests for static assets
+// are not traced; see apmhttp.DefaultIgnoreRules. Use WithIgnoreRules
+// to override this behaviour.
 func Middleware(o ...Option) buffalo.MiddlewareFunc {
-	opts := options{tracer: elasticapm.DefaultTracer}
+	opts := options{
+		ignoreRules: apmhttp.DefaultIgnoreRules(),
+	}
 	for _, o := range o {
 		o(&opts)
 	}
 	return func(h buffalo.Handler) buffalo.Handler {
-		m := &middleware{tracer: opts.tracer, handler: h}
+		m := &middleware{tracer: opts.tracer, ignoreRules: opts.ignoreRules, handler: h}
 		return m.handle
 	}
 }
 
 type middleware struct {
-	handler buffalo.Handler
-	tracer  *elasticapm.Tracer
+	handler     buffalo.Handler
+	tracer      *elasticapm.Tracer
+	ignoreRules apmhttp.IgnoreRules
 }
 
 func (m *middleware) handle(c buffalo.Context) (handlerErr error) {
-	if !m.tracer.Active() {
+	tracer := m.tracer
+	if tracer == nil {
+		tracer = elasticapm.TracerFromContext(c.Request().Context())
+	}
+	if !tracer.Active() || m.ignoreRules.Ignore(c.Request()) {
 		return m.handler(c)
 	}
 	routeInfo, ok := c.Data()["current_route"].(buffalo.RouteInfo)
@@ -46,13 +59,13 @@ func (m *middleware) handle(c buffalo.Context) (handlerErr error) {
 
 	req := c.Request()
 	name := req.Method + " " + routeInfo.Path
-	tx := m.tracer.StartTransaction(name, "request")
+	tx := apmhttp.StartTransaction(tracer, name, req)
 	defer tx.End()
 
 	ctx := elasticapm.ContextWithTransaction(c, tx)
 	req = apmhttp.RequestWithContext(ctx, req)
 
-	body := m.tracer.CaptureHTTPRequestBody(req)
+	body := tracer.CaptureHTTPRequestBody(req)
 	w, resp := apmhttp.WrapResponseWriter(c.Response())
 	overrideContext := overrideContext{
 		Context: c,
@@ -62,7 +75,7 @@ func (m *middleware) handle(c buffalo.Context) (handlerErr error) {
 	}
 	defer func() {
 		if v := recover(); v != nil {
-			e := m.tracer.Recovered(v, tx)
+			e := tracer.Recovered(v, tx)
 			e.Context.SetHTTPRequest(req)
 			e.Context.SetHTTPRequestBody(body)
 			e.Send()
@@ -70,7 +83,7 @@ func (m *middleware) handle(c buffalo.Context) (handlerErr error) {
 			panic(v) // defer to buffalo's PanicHandler
 		}
 		if handlerErr != nil {
-			e := m.tracer.NewError(handlerErr)
+			e := tracer.NewError(handlerErr)
 			e.Context.SetHTTPRequest(req)
 			e.Context.SetHTTPRequestBody(body)
 			e.Transaction = tx
@@ -86,7 +99,8 @@ func (m *middleware) handle(c buffalo.Context) (handlerErr error) {
 }
 
 type options struct {
-	tracer *elasticapm.Tracer
+	tracer      *elasticapm.Tracer
+	ignoreRules apmhttp.IgnoreRules
 }
 
 // Option sets options for tracing.
@@ -103,6 +117,14 @@ func WithTracer(t *elasticapm.Tracer) Option {
 	}
 }
 
+// WithIgnoreRules returns an Option which sets the built-in rules for
+// ignoring requests, overriding apmhttp.DefaultIgnoreRules.
+func WithIgnoreRules(rules apmhttp.IgnoreRules) Option {
+	return func(o *options) {
+		o.ignoreRules = rules
+	}
+}
+
 type overrideContext struct {
 	buffalo.Context
 	ctx context.Context
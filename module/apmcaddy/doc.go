@@ -0,0 +1,6 @@
+// Package apmcaddy provides a Caddy HTTP handler module which reports
+// requests handled by Caddy as transactions to Elastic APM.
+//
+// Importing this package registers the "http.handlers.elasticapm"
+// Caddy module, and the "elasticapm" Caddyfile directive.
+package apmcaddy
@@ -0,0 +1,180 @@
+package apmcaddy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/instrumentation"
+	"github.com/elastic/apm-agent-go/module/apmhttp"
+	"github.com/elastic/apm-agent-go/transport"
+)
+
+func init() {
+	caddy.RegisterModule(Middleware{})
+	httpcaddyfile.RegisterHandlerDirective("elasticapm", parseCaddyfile)
+}
+
+// Middleware is a Caddy HTTP handler module which reports each request
+// as a transaction to Elastic APM, before passing it to the next handler.
+//
+// If ServiceName is empty, the tracer will be configured using the
+// ELASTIC_APM_* environment variables, as with elasticapm.DefaultTracer.
+// Likewise for ServerURL and SecretToken.
+type Middleware struct {
+	ServiceName string `json:"service_name,omitempty"`
+	ServerURL   string `json:"server_url,omitempty"`
+	SecretToken string `json:"secret_token,omitempty"`
+
+	tracer      *elasticapm.Tracer
+	ignoreRules apmhttp.IgnoreRules
+}
+
+// CaddyModule returns the Caddy module information.
+func (Middleware) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.elasticapm",
+		New: func() caddy.Module { return new(Middleware) },
+	}
+}
+
+// Provision creates the tracer used by the middleware.
+func (m *Middleware) Provision(caddy.Context) error {
+	tracer, err := elasticapm.NewTracer(m.ServiceName, "")
+	if err != nil {
+		return err
+	}
+	if m.ServerURL != "" || m.SecretToken != "" {
+		transport, err := transport.NewHTTPTransport(m.ServerURL, m.SecretToken)
+		if err != nil {
+			tracer.Close()
+			return err
+		}
+		tracer.Transport = transport
+	}
+	m.tracer = tracer
+	m.ignoreRules = apmhttp.DefaultIgnoreRules()
+	return nil
+}
+
+// Cleanup flushes and closes the tracer.
+func (m *Middleware) Cleanup() error {
+	if m.tracer != nil {
+		m.tracer.Flush(nil)
+		m.tracer.Close()
+	}
+	return nil
+}
+
+// ServeHTTP reports the request as a transaction, passing it on to next.
+// The transaction result is taken from the status code of the response
+// written by next or, if next returns an error without writing the
+// response, from the error as Caddy will report it.
+func (m *Middleware) ServeHTTP(w http.ResponseWriter, req *http.Request, next caddyhttp.Handler) (err error) {
+	tracer := m.tracer
+	if !tracer.Active() || m.ignoreRules.Ignore(req) {
+		return next.ServeHTTP(w, req)
+	}
+	tx := apmhttp.StartTransaction(tracer, apmhttp.ServerRequestName(req), req)
+	ctx := elasticapm.ContextWithTransaction(req.Context(), tx)
+	if b := elasticapm.ParseBaggage(req.Header.Get(instrumentation.BaggageKey)); len(b) != 0 {
+		ctx = elasticapm.ContextWithBaggage(ctx, b)
+	}
+	req = apmhttp.RequestWithContext(ctx, req)
+	defer tx.End()
+	body := tracer.CaptureHTTPRequestBody(req)
+
+	w, resp := apmhttp.WrapResponseWriter(w)
+	defer func() {
+		if v := recover(); v != nil {
+			e := tracer.Recovered(v, tx)
+			e.Context.SetHTTPRequest(req)
+			e.Context.SetHTTPRequestBody(body)
+			e.Send()
+			recoveredErr, ok := v.(error)
+			if !ok {
+				recoveredErr = errors.New(fmt.Sprint(v))
+			}
+			err = caddyhttp.Error(http.StatusInternalServerError, recoveredErr)
+		}
+		// resp.HeadersWritten is only set if the response has any
+		// headers, so a written status code is also checked for.
+		written := resp.HeadersWritten || resp.StatusCode != http.StatusOK
+		statusCode := resp.StatusCode
+		if err != nil && !written {
+			statusCode = errorStatusCode(err)
+		}
+		tx.SetResult(elasticapm.ResultInfo{
+			Result:     apmhttp.StatusCodeResult(statusCode),
+			StatusCode: statusCode,
+			Err:        err,
+		})
+		if tx.Sampled() {
+			tx.Context.SetHTTPRequest(req)
+			tx.Context.SetHTTPRequestBody(body)
+			tx.Context.SetHTTPStatusCode(statusCode)
+			tx.Context.SetHTTPResponseHeaders(resp.Headers)
+			tx.Context.SetHTTPResponseHeadersSent(resp.HeadersWritten)
+		}
+	}()
+	return next.ServeHTTP(w, req)
+}
+
+// errorStatusCode returns the status code with which Caddy
+// responds to a request whose handler returned err.
+func errorStatusCode(err error) int {
+	if handlerErr, ok := err.(caddyhttp.HandlerError); ok && handlerErr.StatusCode != 0 {
+		return handlerErr.StatusCode
+	}
+	return http.StatusInternalServerError
+}
+
+// UnmarshalCaddyfile sets up the middleware from Caddyfile tokens:
+//
+//     elasticapm [<service_name>] {
+//         server_url   <url>
+//         secret_token <token>
+//     }
+func (m *Middleware) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	for d.Next() {
+		if d.NextArg() {
+			m.ServiceName = d.Val()
+		}
+		for d.NextBlock(0) {
+			var value *string
+			switch d.Val() {
+			case "server_url":
+				value = &m.ServerURL
+			case "secret_token":
+				value = &m.SecretToken
+			default:
+				return d.Errf("unrecognized subdirective %q", d.Val())
+			}
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			*value = d.Val()
+		}
+	}
+	return nil
+}
+
+func parseCaddyfile(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+	var m Middleware
+	err := m.UnmarshalCaddyfile(h.Dispenser)
+	return &m, err
+}
+
+// Interface guards
+var (
+	_ caddy.Provisioner           = (*Middleware)(nil)
+	_ caddy.CleanerUpper          = (*Middleware)(nil)
+	_ caddyhttp.MiddlewareHandler = (*Middleware)(nil)
+	_ caddyfile.Unmarshaler       = (*Middleware)(nil)
+)
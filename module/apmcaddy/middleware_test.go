@@ -0,0 +1,132 @@
+package apmcaddy_test
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go/model"
+	"github.com/elastic/apm-agent-go/module/apmcaddy"
+)
+
+func TestUnmarshalCaddyfile(t *testing.T) {
+	d := caddyfile.NewTestDispenser(`
+	elasticapm my-service {
+		server_url   http://localhost:8200
+		secret_token abc123
+	}`)
+	var m apmcaddy.Middleware
+	require.NoError(t, m.UnmarshalCaddyfile(d))
+	assert.Equal(t, "my-service", m.ServiceName)
+	assert.Equal(t, "http://localhost:8200", m.ServerURL)
+	assert.Equal(t, "abc123", m.SecretToken)
+}
+
+func TestUnmarshalCaddyfileInvalid(t *testing.T) {
+	for _, input := range []string{
+		"elasticapm {\n\tserver_url\n}",
+		"elasticapm {\n\tsample_rate 0.5\n}",
+	} {
+		var m apmcaddy.Middleware
+		assert.Error(t, m.UnmarshalCaddyfile(caddyfile.NewTestDispenser(input)), input)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	server, transactions := newServer(t)
+	defer server.Close()
+
+	m := &apmcaddy.Middleware{ServiceName: "caddy", ServerURL: server.URL}
+	require.NoError(t, m.Provision(caddy.Context{}))
+
+	nextErr := errors.New("upstream failed")
+	next := caddyhttp.HandlerFunc(func(w http.ResponseWriter, req *http.Request) error {
+		w.WriteHeader(http.StatusTeapot)
+		return nextErr
+	})
+	w := httptest.NewRecorder()
+	err := m.ServeHTTP(w, httptest.NewRequest("GET", "/foo", nil), next)
+	assert.Equal(t, nextErr, err)
+	assert.Equal(t, http.StatusTeapot, w.Code)
+
+	// Cleanup flushes the tracer, sending the
+	// transaction to the server.
+	require.NoError(t, m.Cleanup())
+	txs := transactions()
+	require.Len(t, txs, 1)
+	assert.Equal(t, "GET /foo", txs[0].Name)
+	assert.Equal(t, "HTTP 4xx", txs[0].Result)
+	assert.Equal(t, http.StatusTeapot, txs[0].Context.Response.StatusCode)
+}
+
+func TestMiddlewareHandlerError(t *testing.T) {
+	server, transactions := newServer(t)
+	defer server.Close()
+
+	m := &apmcaddy.Middleware{ServiceName: "caddy", ServerURL: server.URL}
+	require.NoError(t, m.Provision(caddy.Context{}))
+
+	// Caddy writes the error response after the middleware chain
+	// returns, so the status is taken from the returned error.
+	for _, nextErr := range []error{
+		caddyhttp.Error(http.StatusNotFound, errors.New("no such file")),
+		errors.New("upstream failed"),
+	} {
+		next := caddyhttp.HandlerFunc(func(w http.ResponseWriter, req *http.Request) error {
+			return nextErr
+		})
+		err := m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/foo", nil), next)
+		assert.Equal(t, nextErr, err)
+	}
+	require.NoError(t, m.Cleanup())
+
+	txs := transactions()
+	require.Len(t, txs, 2)
+	assert.Equal(t, "HTTP 4xx", txs[0].Result)
+	assert.Equal(t, http.StatusNotFound, txs[0].Context.Response.StatusCode)
+	assert.Equal(t, "HTTP 5xx", txs[1].Result)
+	assert.Equal(t, http.StatusInternalServerError, txs[1].Context.Response.StatusCode)
+}
+
+// newServer returns a server which records the transactions
+// sent to it, and a function returning those transactions.
+func newServer(t *testing.T) (*httptest.Server, func() []model.Transaction) {
+	var mu sync.Mutex
+	var transactions []model.Transaction
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v1/transactions" {
+			return
+		}
+		var body io.Reader = req.Body
+		if req.Header.Get("Content-Encoding") == "gzip" {
+			r, err := gzip.NewReader(body)
+			if !assert.NoError(t, err) {
+				return
+			}
+			body = r
+		}
+		var payload model.TransactionsPayload
+		if !assert.NoError(t, json.NewDecoder(body).Decode(&payload)) {
+			return
+		}
+		mu.Lock()
+		transactions = append(transactions, payload.Transactions...)
+		mu.Unlock()
+	}))
+	return server, func() []model.Transaction {
+		mu.Lock()
+		defer mu.Unlock()
+		return transactions
+	}
+}
@@ -16,40 +16,53 @@ import (
 // This middleware will recover and report panics, so it can
 // be used instead of echo/middleware.Recover.
 //
-// By default, the middleware will use elasticapm.DefaultTracer.
-// Use WithTracer to specify an alternative tracer.
+// By default, the middleware will use the tracer returned by
+// elasticapm.TracerFromContext for each request's context, which
+// is elasticapm.DefaultTracer unless another tracer has been
+// selected. Use WithTracer to specify a fixed tracer.
+//
+// By default, CORS preflight requests and requests for static assets
+// are not traced; see apmhttp.DefaultIgnoreRules. Use WithIgnoreRules
+// to override this behaviour.
 func Middleware(o ...Option) echo.MiddlewareFunc {
-	opts := options{tracer: elasticapm.DefaultTracer}
+	opts := options{
+		ignoreRules: apmhttp.DefaultIgnoreRules(),
+	}
 	for _, o := range o {
 		o(&opts)
 	}
 	return func(h echo.HandlerFunc) echo.HandlerFunc {
-		m := &middleware{tracer: opts.tracer, handler: h}
+		m := &middleware{tracer: opts.tracer, ignoreRules: opts.ignoreRules, handler: h}
 		return m.handle
 	}
 }
 
 type middleware struct {
-	handler echo.HandlerFunc
-	tracer  *elasticapm.Tracer
+	handler     echo.HandlerFunc
+	tracer      *elasticapm.Tracer
+	ignoreRules apmhttp.IgnoreRules
 }
 
 func (m *middleware) handle(c echo.Context) error {
-	if !m.tracer.Active() {
+	tracer := m.tracer
+	if tracer == nil {
+		tracer = elasticapm.TracerFromContext(c.Request().Context())
+	}
+	if !tracer.Active() || m.ignoreRules.Ignore(c.Request()) {
 		return m.handler(c)
 	}
 	req := c.Request()
 	name := req.Method + " " + c.Path()
-	tx := m.tracer.StartTransaction(name, "request")
+	tx := apmhttp.StartTransaction(tracer, name, req)
 	ctx := elasticapm.ContextWithTransaction(req.Context(), tx)
 	req = apmhttp.RequestWithContext(ctx, req)
 	c.SetRequest(req)
 	defer tx.End()
-	body := m.tracer.CaptureHTTPRequestBody(req)
+	body := tracer.CaptureHTTPRequestBody(req)
 
 	defer func() {
 		if v := recover(); v != nil {
-			e := m.tracer.Recovered(v, tx)
+			e := tracer.Recovered(v, tx)
 			e.Context.SetHTTPRequest(req)
 			e.Context.SetHTTPRequestBody(body)
 			err, ok := v.(error)
@@ -63,7 +76,11 @@ func (m *middleware) handle(c echo.Context) error {
 
 	resp := c.Response()
 	handlerErr := m.handler(c)
-	tx.Result = apmhttp.StatusCodeResult(resp.Status)
+	tx.SetResult(elasticapm.ResultInfo{
+		Result:     apmhttp.StatusCodeResult(resp.Status),
+		StatusCode: resp.Status,
+		Err:        handlerErr,
+	})
 	if tx.Sampled() {
 		tx.Context.SetHTTPRequest(req)
 		tx.Context.SetHTTPRequestBody(body)
@@ -72,7 +89,7 @@ func (m *middleware) handle(c echo.Context) error {
 		tx.Context.SetHTTPResponseHeadersSent(resp.Committed)
 	}
 	if handlerErr != nil {
-		e := m.tracer.NewError(handlerErr)
+		e := tracer.NewError(handlerErr)
 		e.Context.SetHTTPRequest(req)
 		e.Context.SetHTTPRequestBody(body)
 		e.Transaction = tx
@@ -84,7 +101,8 @@ func (m *middleware) handle(c echo.Context) error {
 }
 
 type options struct {
-	tracer *elasticapm.Tracer
+	tracer      *elasticapm.Tracer
+	ignoreRules apmhttp.IgnoreRules
 }
 
 // Option sets options for tracing.
@@ -100,3 +118,11 @@ func WithTracer(t *elasticapm.Tracer) Option {
 		o.tracer = t
 	}
 }
+
+// WithIgnoreRules returns an Option which sets the built-in rules for
+// ignoring requests, overriding apmhttp.DefaultIgnoreRules.
+func WithIgnoreRules(rules apmhttp.IgnoreRules) Option {
+	return func(o *options) {
+		o.ignoreRules = rules
+	}
+}
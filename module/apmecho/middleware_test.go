@@ -11,6 +11,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/elastic/apm-agent-go"
 	"github.com/elastic/apm-agent-go/model"
 	"github.com/elastic/apm-agent-go/module/apmecho"
 	"github.com/elastic/apm-agent-go/transport/transporttest"
@@ -97,7 +98,10 @@ func assertError(t *testing.T, payloads transporttest.Payloads, culprit, message
 	require.NotNil(t, error0.Context)
 	require.NotNil(t, error0.Exception)
 	assert.NotEmpty(t, error0.Transaction.ID)
-	assert.Equal(t, culprit, error0.Culprit)
+	if elasticapm.StacktraceEnabled {
+		// The culprit is derived from the stack trace.
+		assert.Equal(t, culprit, error0.Culprit)
+	}
 	assert.Equal(t, message, error0.Exception.Message)
 	assert.Equal(t, handled, error0.Exception.Handled)
 }
@@ -0,0 +1,160 @@
+package apmelasticsearch
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/elastic/apm-agent-go"
+)
+
+// BulkIndexerTracer traces the flushes of a go-elasticsearch
+// esutil.BulkIndexer. Its OnFlushStart and OnFlushEnd methods
+// should be set as the corresponding fields of the indexer's
+// esutil.BulkIndexerConfig, and the indexer's client should
+// send requests with a transport wrapped with WrapRoundTripper:
+//
+//	bt := apmelasticsearch.NewBulkIndexerTracer(nil)
+//	indexer, err := esutil.NewBulkIndexer(esutil.BulkIndexerConfig{
+//		Client:       client,
+//		OnFlushStart: bt.OnFlushStart,
+//		OnFlushEnd:   bt.OnFlushEnd,
+//	})
+//
+// Each flush is then reported with a span for its bulk request, tagged
+// with the number of documents, the request payload size in bytes, and
+// the number of failed items. If any items fail, an error describing the
+// first failure is reported.
+type BulkIndexerTracer struct {
+	tracer *elasticapm.Tracer
+}
+
+// NewBulkIndexerTracer returns a new BulkIndexerTracer, which reports
+// flushes to tracer. If tracer is nil, the tracer returned by
+// elasticapm.TracerFromContext for the flush context is used.
+func NewBulkIndexerTracer(tracer *elasticapm.Tracer) *BulkIndexerTracer {
+	return &BulkIndexerTracer{tracer: tracer}
+}
+
+type bulkFlushKey struct{}
+
+// bulkFlush holds the transaction or span started for a flush.
+type bulkFlush struct {
+	tx   *elasticapm.Transaction // if started by OnFlushStart
+	span *elasticapm.Span        // if ctx contained a transaction
+}
+
+// OnFlushStart starts tracing a flush. If ctx contains a transaction, a
+// span is started for the flush; otherwise, as is the case for flushes
+// made by the indexer's workers, a transaction of type "elasticsearch.bulk"
+// is started. The returned context contains the transaction or span.
+func (b *BulkIndexerTracer) OnFlushStart(ctx context.Context) context.Context {
+	var flush bulkFlush
+	if elasticapm.TransactionFromContext(ctx) != nil {
+		flush.span, ctx = elasticapm.StartSpan(ctx, "Elasticsearch: bulk flush", "db.elasticsearch.bulk")
+	} else {
+		tracer := b.tracer
+		if tracer == nil {
+			tracer = elasticapm.TracerFromContext(ctx)
+		}
+		flush.tx = tracer.StartTransaction("Elasticsearch bulk flush", "elasticsearch.bulk")
+		ctx = elasticapm.ContextWithTransaction(ctx, flush.tx)
+	}
+	return context.WithValue(ctx, bulkFlushKey{}, flush)
+}
+
+// OnFlushEnd ends the transaction or span started by OnFlushStart
+// for the flush, given the context returned by OnFlushStart.
+func (b *BulkIndexerTracer) OnFlushEnd(ctx context.Context) {
+	flush, ok := ctx.Value(bulkFlushKey{}).(bulkFlush)
+	if !ok {
+		return
+	}
+	if flush.span != nil {
+		flush.span.End()
+	}
+	if flush.tx != nil {
+		flush.tx.End()
+	}
+}
+
+// bulkItemsError describes the failed items of a bulk request.
+type bulkItemsError struct {
+	failed, total int
+	errorType     string
+	reason        string
+}
+
+func (e *bulkItemsError) Error() string {
+	msg := fmt.Sprintf("%d of %d bulk items failed", e.failed, e.total)
+	if e.errorType != "" {
+		msg += ": " + e.errorType
+		if e.reason != "" {
+			msg += ": " + e.reason
+		}
+	}
+	return msg
+}
+
+// countBulkDocuments returns the number of documents in the bulk request
+// body, by counting its action lines, if a copy of the body can be
+// obtained without consuming it.
+func countBulkDocuments(req *http.Request) (int, bool) {
+	if req.GetBody == nil {
+		return 0, false
+	}
+	rc, err := req.GetBody()
+	if err != nil {
+		return 0, false
+	}
+	defer rc.Close()
+	var r io.Reader = rc
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(rc)
+		if err != nil {
+			return 0, false
+		}
+		r = zr
+	}
+
+	// Each action line is followed by a source line,
+	// except for delete actions. Source lines may be
+	// arbitrarily long, and are skipped unread.
+	var count int
+	var source bool
+	br := bufio.NewReader(r)
+	for {
+		line, isPrefix, err := br.ReadLine()
+		if err != nil {
+			return count, err == io.EOF
+		}
+		if source {
+			for isPrefix && err == nil {
+				_, isPrefix, err = br.ReadLine()
+			}
+			source = false
+			continue
+		}
+		if isPrefix {
+			// Action lines are short; skip malformed ones.
+			for isPrefix && err == nil {
+				_, isPrefix, err = br.ReadLine()
+			}
+			continue
+		}
+		if len(line) == 0 {
+			continue
+		}
+		var action map[string]json.RawMessage
+		if err := json.Unmarshal(line, &action); err != nil {
+			continue
+		}
+		count++
+		_, isDelete := action["delete"]
+		source = !isDelete
+	}
+}
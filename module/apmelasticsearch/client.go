@@ -0,0 +1,118 @@
+package apmelasticsearch
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/module/apmhttp"
+)
+
+// WrapRoundTripper returns an http.RoundTripper wrapping r, reporting each
+// Elasticsearch request as a span to Elastic APM, if the request's context
+// contains a sampled transaction.
+//
+// Scroll searches, and searches using a point in time (PIT), are reported
+// as a parent span for the logical query with a child span for each page,
+// rather than as unrelated spans. The parent span is tagged with the number
+// of pages and the cumulative number of hits returned, and ends when the
+// scroll is cleared or the PIT is closed, or when a page with no hits is
+// returned. Otherwise, e.g. if the query is abandoned, or is no longer
+// tracked because there are too many queries in progress, the parent span
+// is left open, and is reported as truncated when the transaction ends.
+// Search responses are scanned as they are read by the client, so large
+// responses are never buffered.
+//
+// Bulk requests are tagged with the number of documents, the payload size
+// in bytes, and the number of failed items; if any items fail, an error is
+// reported. See BulkIndexerTracer for tracing esutil.BulkIndexer flushes.
+//
+// If r is nil, then http.DefaultTransport is wrapped.
+func WrapRoundTripper(r http.RoundTripper) http.RoundTripper {
+	if r == nil {
+		r = http.DefaultTransport
+	}
+	return &roundTripper{r: r}
+}
+
+type roundTripper struct {
+	r      http.RoundTripper
+	groups queryGroups
+}
+
+// RoundTrip delegates to r.r, emitting a span if req's context
+// contains a sampled transaction.
+func (r *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	tx := elasticapm.TransactionFromContext(ctx)
+	if tx == nil || !tx.Sampled() {
+		return r.r.RoundTrip(req)
+	}
+
+	esReq := parseRequest(req)
+	spanType := elasticapm.OverrideSpanType(ctx, "apmelasticsearch", "db.elasticsearch", req.URL.Host)
+	group := r.groups.start(ctx, tx, &esReq, spanType)
+	target := elasticapm.ServiceTargetSpanContext{Type: "elasticsearch"}
+	var span *elasticapm.Span
+	if group != nil {
+		span = tx.StartExitSpan(esReq.name, spanType, group.span, target)
+		if !span.Dropped() {
+			ctx = elasticapm.ContextWithSpan(ctx, span)
+		}
+	} else {
+		span, ctx = elasticapm.StartExitSpan(ctx, esReq.name, spanType, target)
+	}
+	var bulkDocuments int
+	var bulkCounted bool
+	if !span.Dropped() {
+		span.Context.SetDatabase(elasticapm.DatabaseSpanContext{Type: "elasticsearch"})
+		if esReq.kind == bulkRequest {
+			if req.ContentLength >= 0 {
+				span.Context.SetTag("bytes", strconv.FormatInt(req.ContentLength, 10))
+			}
+			if bulkDocuments, bulkCounted = countBulkDocuments(req); bulkCounted {
+				span.Context.SetTag("documents", strconv.Itoa(bulkDocuments))
+			}
+		}
+	}
+
+	resp, err := r.r.RoundTrip(apmhttp.RequestWithContext(ctx, req))
+	ok := err == nil && resp.StatusCode >= 200 && resp.StatusCode < 300
+	if !ok || !esReq.kind.scanResponse() || !strings.Contains(resp.Header.Get("Content-Type"), "json") {
+		if group != nil {
+			r.groups.end(group, &esReq, responseResult{}, ok)
+		}
+		span.End()
+		return resp, err
+	}
+	gzipped := resp.Header.Get("Content-Encoding") == "gzip"
+	resp.Body = newResponseBody(resp.Body, gzipped, func(result responseResult) {
+		if esReq.kind.paged() && !span.Dropped() {
+			span.Context.SetTag("hits", strconv.Itoa(result.hits))
+		}
+		if esReq.kind == bulkRequest {
+			if !span.Dropped() {
+				if !bulkCounted {
+					span.Context.SetTag("documents", strconv.Itoa(result.bulkItems))
+				}
+				span.Context.SetTag("failed", strconv.Itoa(result.bulkFailed))
+			}
+			if result.bulkFailed > 0 {
+				if e := elasticapm.CaptureError(ctx, &bulkItemsError{
+					failed:    result.bulkFailed,
+					total:     result.bulkItems,
+					errorType: result.bulkErrorType,
+					reason:    result.bulkErrorReason,
+				}); e != nil {
+					e.Send()
+				}
+			}
+		}
+		if group != nil {
+			r.groups.end(group, &esReq, result, true)
+		}
+		span.End()
+	})
+	return resp, nil
+}
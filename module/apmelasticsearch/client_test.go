@@ -0,0 +1,242 @@
+package apmelasticsearch_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/model"
+	"github.com/elastic/apm-agent-go/module/apmelasticsearch"
+	"github.com/elastic/apm-agent-go/module/apmhttp"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestScroll(t *testing.T) {
+	responses := []string{
+		`{"_scroll_id":"s1","hits":{"total":3,"hits":[{"_id":"1"},{"_id":"2","_source":{"hits":[1,2]}}]}}`,
+		`{"_scroll_id":"s2","hits":{"total":3,"hits":[{"_id":"3"}]}}`,
+		`{"_scroll_id":"s2","hits":{"total":3,"hits":[]}}`,
+		`{"succeeded":true,"num_freed":1}`,
+	}
+	server := newServer(t, responses)
+	defer server.Close()
+
+	spans := withTransaction(t, func(ctx context.Context, client *http.Client) {
+		doRequest(t, ctx, client, "POST", server.URL+"/index/_search?scroll=1m", `{"query":{"match_all":{}}}`)
+		doRequest(t, ctx, client, "POST", server.URL+"/_search/scroll", `{"scroll":"1m","scroll_id":"s1"}`)
+		doRequest(t, ctx, client, "GET", server.URL+"/_search/scroll/s2?scroll=1m", "")
+		doRequest(t, ctx, client, "DELETE", server.URL+"/_search/scroll", `{"scroll_id":["s2"]}`)
+	})
+	require.Len(t, spans, 5)
+
+	parent := spans[0]
+	assert.Equal(t, "Elasticsearch: scroll /index/_search", parent.Name)
+	assert.Equal(t, "db.elasticsearch", parent.Type)
+	assert.Nil(t, parent.Parent)
+	assert.Equal(t, map[string]string{"pages": "3", "hits": "3"}, parent.Context.Tags)
+
+	names := []string{
+		"Elasticsearch: POST /index/_search",
+		"Elasticsearch: POST /_search/scroll",
+		"Elasticsearch: GET /_search/scroll",
+	}
+	hits := []string{"2", "1", "0"}
+	for i, span := range spans[1:4] {
+		assert.Equal(t, names[i], span.Name)
+		assert.Equal(t, parent.ID, span.Parent)
+		assert.Equal(t, &model.SpanContext{
+			Database: &model.DatabaseSpanContext{Type: "elasticsearch"},
+			Destination: &model.DestinationSpanContext{
+				Service: &model.DestinationServiceSpanContext{Resource: "elasticsearch"},
+			},
+			Service: &model.ServiceSpanContext{
+				Target: &model.ServiceTargetSpanContext{Type: "elasticsearch"},
+			},
+			Tags: map[string]string{"hits": hits[i]},
+		}, span.Context)
+	}
+
+	// The scroll was exhausted by the empty page,
+	// so clearing it is reported separately.
+	assert.Equal(t, "Elasticsearch: DELETE /_search/scroll", spans[4].Name)
+	assert.Nil(t, spans[4].Parent)
+}
+
+func TestPointInTime(t *testing.T) {
+	responses := []string{
+		`{"id":"p1"}`,
+		`{"pit_id":"p2","hits":{"hits":[{"_id":"1","sort":[1]},{"_id":"2","sort":[2]}]}}`,
+		`{"pit_id":"p2","hits":{"hits":[{"_id":"3","sort":[3]}]}}`,
+		`{"succeeded":true,"num_freed":1}`,
+	}
+	server := newServer(t, responses)
+	defer server.Close()
+
+	spans := withTransaction(t, func(ctx context.Context, client *http.Client) {
+		doRequest(t, ctx, client, "POST", server.URL+"/index/_pit?keep_alive=1m", "")
+		doRequest(t, ctx, client, "POST", server.URL+"/_search", `{"size":2,"pit":{"id":"p1"}}`)
+		doRequest(t, ctx, client, "POST", server.URL+"/_search", `{"size":2,"pit":{"id":"p2"},"search_after":[2]}`)
+		doRequest(t, ctx, client, "DELETE", server.URL+"/_pit", `{"id":"p2"}`)
+	})
+	require.Len(t, spans, 5)
+
+	parent := spans[0]
+	assert.Equal(t, "Elasticsearch: point in time /index/_pit", parent.Name)
+	assert.Equal(t, map[string]string{"pages": "2", "hits": "3"}, parent.Context.Tags)
+
+	names := []string{
+		"Elasticsearch: POST /index/_pit",
+		"Elasticsearch: POST /_search",
+		"Elasticsearch: POST /_search",
+		"Elasticsearch: DELETE /_pit",
+	}
+	for i, span := range spans[1:] {
+		assert.Equal(t, names[i], span.Name)
+		assert.Equal(t, parent.ID, span.Parent)
+	}
+	assert.Equal(t, map[string]string{"hits": "2"}, spans[2].Context.Tags)
+}
+
+func TestScrollAbandoned(t *testing.T) {
+	responses := []string{
+		`{"_scroll_id":"s1","hits":{"total":3,"hits":[{"_id":"1"}]}}`,
+	}
+	server := newServer(t, responses)
+	defer server.Close()
+
+	spans := withTransaction(t, func(ctx context.Context, client *http.Client) {
+		doRequest(t, ctx, client, "POST", server.URL+"/index/_search?scroll=1m", `{"query":{"match_all":{}}}`)
+	})
+	require.Len(t, spans, 2)
+
+	// The scroll was neither exhausted nor cleared, so the
+	// parent span is truncated when the transaction ends.
+	assert.Equal(t, "Elasticsearch: scroll /index/_search", spans[0].Name)
+	assert.Equal(t, "db.elasticsearch.truncated", spans[0].Type)
+	assert.Equal(t, spans[0].ID, spans[1].Parent)
+}
+
+func TestScrollPartialRead(t *testing.T) {
+	responses := []string{
+		`{"_scroll_id":"s1","hits":{"hits":[{"_id":"1"},{"_id":"2"}]}}`,
+	}
+	server := newServer(t, responses)
+	defer server.Close()
+
+	spans := withTransaction(t, func(ctx context.Context, client *http.Client) {
+		req, err := http.NewRequest("POST", server.URL+"/index/_search?scroll=1m", nil)
+		require.NoError(t, err)
+		resp, err := client.Do(apmhttp.RequestWithContext(ctx, req))
+		require.NoError(t, err)
+		resp.Body.Close()
+	})
+	require.Len(t, spans, 2)
+	assert.Equal(t, "Elasticsearch: scroll /index/_search", spans[0].Name)
+	assert.Equal(t, spans[0].ID, spans[1].Parent)
+}
+
+func TestOtherRequest(t *testing.T) {
+	server := newServer(t, []string{`{"found":true}`})
+	defer server.Close()
+
+	spans := withTransaction(t, func(ctx context.Context, client *http.Client) {
+		doRequest(t, ctx, client, "GET", server.URL+"/index/_doc/1", "")
+	})
+	require.Len(t, spans, 1)
+	assert.Equal(t, "Elasticsearch: GET /index/_doc/1", spans[0].Name)
+	assert.Equal(t, "db.elasticsearch", spans[0].Type)
+	assert.Nil(t, spans[0].Parent)
+}
+
+func TestNoTransaction(t *testing.T) {
+	server := newServer(t, []string{`{"found":true}`})
+	defer server.Close()
+
+	client := &http.Client{Transport: apmelasticsearch.WrapRoundTripper(nil)}
+	doRequest(t, context.Background(), client, "GET", server.URL+"/index/_doc/1", "")
+}
+
+func newServer(t *testing.T, responses []string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		require.NotEmpty(t, responses)
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.Write([]byte(responses[0]))
+		responses = responses[1:]
+	}))
+}
+
+func withTransaction(t *testing.T, f func(context.Context, *http.Client)) []model.Span {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	client := &http.Client{Transport: apmelasticsearch.WrapRoundTripper(nil)}
+	tx := tracer.StartTransaction("name", "type")
+	f(elasticapm.ContextWithTransaction(context.Background(), tx), client)
+	tx.End()
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads, 1)
+	return payloads[0].Transactions()[0].Spans
+}
+
+func doRequest(t *testing.T, ctx context.Context, client *http.Client, method, url, body string) {
+	req, err := http.NewRequest(method, url, bytes.NewBufferString(body))
+	require.NoError(t, err)
+	resp, err := client.Do(apmhttp.RequestWithContext(ctx, req))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var v interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&v))
+	ioutil.ReadAll(resp.Body)
+}
+
+func TestBulkIndexerFlush(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	server := newServer(t, []string{`{"took":3,"errors":true,"items":[` +
+		`{"index":{"_index":"index","_id":"1","status":201}},` +
+		`{"index":{"_index":"index","_id":"2","status":400,"error":{"type":"mapper_parsing_exception","reason":"failed to parse field [n]"}}},` +
+		`{"delete":{"_index":"index","_id":"3","status":200}}]}`,
+	})
+	defer server.Close()
+
+	body := `{"index":{"_index":"index","_id":"1"}}` + "\n" + `{"n":1}` + "\n" +
+		`{"index":{"_index":"index","_id":"2"}}` + "\n" + `{"n":"two"}` + "\n" +
+		`{"delete":{"_index":"index","_id":"3"}}` + "\n"
+
+	// Emulate a flush by esutil.BulkIndexer.
+	bt := apmelasticsearch.NewBulkIndexerTracer(tracer)
+	client := &http.Client{Transport: apmelasticsearch.WrapRoundTripper(nil)}
+	ctx := bt.OnFlushStart(context.Background())
+	doRequest(t, ctx, client, "POST", server.URL+"/_bulk", body)
+	bt.OnFlushEnd(ctx)
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads, 2)
+	errors := payloads[0].Errors()
+	require.Len(t, errors, 1)
+	assert.Equal(t, "1 of 3 bulk items failed: mapper_parsing_exception: failed to parse field [n]", errors[0].Exception.Message)
+
+	tx := payloads[1].Transactions()[0]
+	assert.Equal(t, "Elasticsearch bulk flush", tx.Name)
+	assert.Equal(t, "elasticsearch.bulk", tx.Type)
+	require.Len(t, tx.Spans, 1)
+	assert.Equal(t, "Elasticsearch: POST /_bulk", tx.Spans[0].Name)
+	assert.Equal(t, map[string]string{
+		"bytes":     strconv.Itoa(len(body)),
+		"documents": "3",
+		"failed":    "1",
+	}, tx.Spans[0].Context.Tags)
+}
@@ -0,0 +1,3 @@
+// Package apmelasticsearch provides tracing for Elasticsearch clients,
+// by wrapping the http.RoundTripper used to send requests.
+package apmelasticsearch
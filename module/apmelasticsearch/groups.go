@@ -0,0 +1,160 @@
+package apmelasticsearch
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/elastic/apm-agent-go"
+)
+
+const (
+	// queryGroupsLimit is the maximum number of scroll and PIT
+	// queries tracked at once. Pages of further queries are
+	// reported as unrelated spans.
+	queryGroupsLimit = 1000
+
+	// queryGroupIdleTimeout is the period after which a query with
+	// no further requests may be forgotten to make room for others.
+	queryGroupIdleTimeout = 10 * time.Minute
+)
+
+// queryGroups tracks the scroll and PIT queries in progress,
+// keyed by their current scroll or PIT ID.
+type queryGroups struct {
+	mu     sync.Mutex
+	groups map[string]*queryGroup
+}
+
+// queryGroup holds the parent span for the pages of a scroll
+// or PIT query. The span belongs to the transaction tx, and
+// may only be used while tx, as identified by txID, is active.
+type queryGroup struct {
+	tx   *elasticapm.Transaction
+	txID string
+	span *elasticapm.Span
+
+	id       string
+	pages    int
+	hits     int
+	ended    bool
+	lastUsed time.Time
+}
+
+// start returns the query group for the request r within tx, starting
+// a new group if r starts a scroll or PIT query. If r is not part of a
+// tracked query, start returns nil.
+func (gs *queryGroups) start(ctx context.Context, tx *elasticapm.Transaction, r *esRequest, spanType string) *queryGroup {
+	switch r.kind {
+	case scrollRequest, clearScrollRequest, pitSearchRequest, closePITRequest:
+		if g := gs.find(tx, r.ids); g != nil {
+			return g
+		}
+		if r.kind != pitSearchRequest {
+			return nil
+		}
+		// The PIT was opened elsewhere, e.g. in another
+		// transaction; start a new group for its pages.
+	case scrollSearchRequest, openPITRequest:
+	default:
+		return nil
+	}
+	span := tx.StartSpan(r.groupName, spanType, elasticapm.SpanFromContext(ctx))
+	if span.Dropped() {
+		span.End()
+		return nil
+	}
+	return &queryGroup{tx: tx, txID: tx.ID(), span: span}
+}
+
+// find returns the active group within tx with one of the given IDs.
+func (gs *queryGroups) find(tx *elasticapm.Transaction, ids []string) *queryGroup {
+	if len(ids) == 0 {
+		return nil
+	}
+	txID := tx.ID()
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	for _, id := range ids {
+		if g := gs.groups[id]; g != nil && g.tx == tx && g.txID == txID && !g.ended {
+			return g
+		}
+	}
+	return nil
+}
+
+// end records the completion of the request r in group g, with the
+// scanned result of a successful response. If ok is false, the request
+// failed. The group's span is ended once the query is complete.
+func (gs *queryGroups) end(g *queryGroup, r *esRequest, result responseResult, ok bool) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	if g.ended {
+		return
+	}
+	g.lastUsed = time.Now()
+
+	var id string
+	var done bool
+	switch r.kind {
+	case scrollSearchRequest, scrollRequest, pitSearchRequest:
+		if ok {
+			g.pages++
+			g.hits += result.hits
+			g.span.Context.SetTag("pages", strconv.Itoa(g.pages))
+			g.span.Context.SetTag("hits", strconv.Itoa(g.hits))
+		}
+		id = result.scrollID
+		if r.kind == pitSearchRequest {
+			id = result.pitID
+		}
+		// A page with no hits means the results are exhausted.
+		done = ok && result.complete && result.hits == 0
+	case openPITRequest:
+		id = result.id
+	case clearScrollRequest, closePITRequest:
+		done = true
+	}
+	if id == "" && g.id == "" && r.kind == pitSearchRequest && len(r.ids) > 0 {
+		id = r.ids[0]
+	}
+	if !done && id != "" && id != g.id {
+		done = !gs.setID(g, id)
+	}
+	if done || g.id == "" {
+		// No further requests can be made for the query.
+		if gs.groups[g.id] == g {
+			delete(gs.groups, g.id)
+		}
+		g.ended = true
+		g.span.End()
+	}
+}
+
+// setID records id as the current ID of g, reporting whether
+// there is room for g to be tracked.
+func (gs *queryGroups) setID(g *queryGroup, id string) bool {
+	if gs.groups[g.id] == g {
+		delete(gs.groups, g.id)
+	}
+	g.id = ""
+	if len(gs.groups) >= queryGroupsLimit {
+		// Forget idle groups. Their spans are never touched,
+		// as their transactions may have ended.
+		for id, other := range gs.groups {
+			if g.lastUsed.Sub(other.lastUsed) > queryGroupIdleTimeout {
+				delete(gs.groups, id)
+			}
+		}
+		if len(gs.groups) >= queryGroupsLimit {
+			return false
+		}
+	}
+	if gs.groups == nil {
+		gs.groups = make(map[string]*queryGroup)
+	}
+	gs.groups[id] = g
+	g.id = id
+	return true
+}
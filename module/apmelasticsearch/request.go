@@ -0,0 +1,138 @@
+package apmelasticsearch
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxRequestBodySize is the maximum size of request bodies decoded
+// to find scroll and PIT IDs. Larger bodies are not decoded.
+const maxRequestBodySize = 1024 * 1024
+
+type requestKind int
+
+const (
+	otherRequest        requestKind = iota
+	scrollSearchRequest             // search opening a scroll
+	scrollRequest                   // next page of a scroll
+	clearScrollRequest              // clear scroll
+	openPITRequest                  // open point in time
+	pitSearchRequest                // search using a point in time
+	closePITRequest                 // close point in time
+	bulkRequest                     // bulk indexing
+)
+
+// paged reports whether requests of kind k return a page of hits.
+func (k requestKind) paged() bool {
+	return k == scrollSearchRequest || k == scrollRequest || k == pitSearchRequest
+}
+
+// scanResponse reports whether the responses to requests of kind k
+// must be scanned for hits, scroll or PIT IDs, or bulk item results.
+func (k requestKind) scanResponse() bool {
+	return k.paged() || k == openPITRequest || k == bulkRequest
+}
+
+// esRequest describes an Elasticsearch request.
+type esRequest struct {
+	kind requestKind
+
+	// name holds the name for the request span.
+	name string
+
+	// groupName holds the name for the parent span of
+	// a scroll or PIT query started by the request.
+	groupName string
+
+	// ids holds the scroll or PIT IDs in the request.
+	ids []string
+}
+
+// parseRequest returns an esRequest describing req.
+func parseRequest(req *http.Request) esRequest {
+	path := req.URL.Path
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	last := segments[len(segments)-1]
+	r := esRequest{kind: otherRequest}
+
+	switch {
+	case segments[0] == "_search" && len(segments) > 1 && segments[1] == "scroll":
+		// Scroll IDs may be specified in the path, which
+		// must not be included in the span name.
+		path = "/_search/scroll"
+		r.kind = scrollRequest
+		if req.Method == "DELETE" {
+			r.kind = clearScrollRequest
+		}
+		if len(segments) > 2 {
+			r.ids = strings.Split(segments[2], ",")
+		} else if id := req.URL.Query().Get("scroll_id"); id != "" {
+			r.ids = []string{id}
+		} else {
+			r.ids = readRequestBody(req).scrollIDs()
+		}
+	case last == "_search":
+		if req.URL.Query().Get("scroll") != "" {
+			r.kind = scrollSearchRequest
+			r.groupName = "Elasticsearch: scroll " + path
+		} else if body := readRequestBody(req); body.PIT != nil && body.PIT.ID != "" {
+			r.kind = pitSearchRequest
+			r.groupName = "Elasticsearch: point in time " + path
+			r.ids = []string{body.PIT.ID}
+		}
+	case last == "_bulk":
+		r.kind = bulkRequest
+	case last == "_pit":
+		if req.Method == "POST" && len(segments) > 1 {
+			r.kind = openPITRequest
+			r.groupName = "Elasticsearch: point in time " + path
+		} else if req.Method == "DELETE" && len(segments) == 1 {
+			r.kind = closePITRequest
+			if id := readRequestBody(req).ID; id != "" {
+				r.ids = []string{id}
+			}
+		}
+	}
+	r.name = "Elasticsearch: " + req.Method + " " + path
+	return r
+}
+
+// requestBody holds the fields of request bodies identifying
+// scroll and PIT queries.
+type requestBody struct {
+	ScrollID json.RawMessage `json:"scroll_id"`
+	ID       string          `json:"id"`
+	PIT      *struct {
+		ID string `json:"id"`
+	} `json:"pit"`
+}
+
+// readRequestBody decodes a copy of req's body, if one can be obtained
+// without consuming the body. Errors are ignored.
+func readRequestBody(req *http.Request) requestBody {
+	var body requestBody
+	if req.GetBody == nil || req.ContentLength <= 0 || req.ContentLength > maxRequestBodySize {
+		return body
+	}
+	rc, err := req.GetBody()
+	if err != nil {
+		return body
+	}
+	defer rc.Close()
+	json.NewDecoder(io.LimitReader(rc, maxRequestBodySize)).Decode(&body)
+	return body
+}
+
+// scrollIDs returns the scroll IDs in the body, which may
+// be specified as a single string or an array of strings.
+func (b requestBody) scrollIDs() []string {
+	var id string
+	if err := json.Unmarshal(b.ScrollID, &id); err == nil {
+		return []string{id}
+	}
+	var ids []string
+	json.Unmarshal(b.ScrollID, &ids)
+	return ids
+}
@@ -0,0 +1,186 @@
+package apmelasticsearch
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// responseResult holds the details scanned from a search,
+// scroll, open PIT, or bulk response body.
+type responseResult struct {
+	// hits holds the number of hits in the response.
+	hits int
+
+	// scrollID, pitID, and id hold the top-level "_scroll_id",
+	// "pit_id", and "id" fields of the response.
+	scrollID string
+	pitID    string
+	id       string
+
+	// bulkItems and bulkFailed hold the number of items, and the
+	// number of failed items, in a bulk response. bulkErrorType and
+	// bulkErrorReason describe the first failed item's error.
+	bulkItems       int
+	bulkFailed      int
+	bulkErrorType   string
+	bulkErrorReason string
+
+	// complete records whether the response was
+	// scanned in its entirety.
+	complete bool
+}
+
+// responseBody wraps a response body, scanning it as it is read by the
+// client, so that large responses need not be buffered. The scanned
+// result is passed to end once the body has been read to completion,
+// or closed.
+type responseBody struct {
+	io.ReadCloser
+	pw     *io.PipeWriter
+	done   chan struct{}
+	result responseResult
+	end    func(responseResult)
+	once   sync.Once
+}
+
+func newResponseBody(body io.ReadCloser, gzipped bool, end func(responseResult)) *responseBody {
+	pr, pw := io.Pipe()
+	b := &responseBody{
+		ReadCloser: body,
+		pw:         pw,
+		done:       make(chan struct{}),
+		end:        end,
+	}
+	go func() {
+		defer close(b.done)
+		var r io.Reader = pr
+		if gzipped {
+			if zr, err := gzip.NewReader(pr); err == nil {
+				r = zr
+			} else {
+				r = nil
+			}
+		}
+		if r != nil {
+			b.result = scanResponse(r)
+		}
+		// Drain the pipe, so that Read never blocks on the scanner.
+		io.Copy(ioutil.Discard, pr)
+	}()
+	return b
+}
+
+// Read reads from the wrapped body, passing the data read to the
+// scanner, and ending the scan on io.EOF.
+func (b *responseBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.pw.Write(p[:n])
+	}
+	if err == io.EOF {
+		b.finish()
+	}
+	return n, err
+}
+
+// Close closes the wrapped body, ending the scan if it has
+// not already been ended.
+func (b *responseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.finish()
+	return err
+}
+
+func (b *responseBody) finish() {
+	b.once.Do(func() {
+		b.pw.Close()
+		<-b.done
+		b.end(b.result)
+	})
+}
+
+// scanResponse scans the JSON response body in r, counting the
+// elements of "hits.hits", recording the top-level IDs, and
+// counting the items of a bulk response and their failures.
+func scanResponse(r io.Reader) responseResult {
+	type frame struct {
+		array     bool
+		key       string // most recent key, for objects
+		expectKey bool
+	}
+	var result responseResult
+	var stack []frame
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return result
+		}
+		n := len(stack)
+		inObject := n > 0 && !stack[n-1].array
+		switch tok := tok.(type) {
+		case json.Delim:
+			switch tok {
+			case '{', '[':
+				if n == 3 && stack[0].key == "hits" && stack[1].key == "hits" && stack[2].array {
+					result.hits++
+				}
+				if n == 2 && stack[0].key == "items" && stack[1].array {
+					result.bulkItems++
+				}
+				if inObject {
+					stack[n-1].expectKey = true
+				}
+				stack = append(stack, frame{array: tok == '[', expectKey: tok == '{'})
+			case '}', ']':
+				stack = stack[:n-1]
+				if len(stack) == 0 {
+					result.complete = true
+					return result
+				}
+			}
+			continue
+		case string:
+			if inObject && stack[n-1].expectKey {
+				stack[n-1].key = tok
+				stack[n-1].expectKey = false
+				continue
+			}
+			if n == 1 && inObject {
+				switch stack[0].key {
+				case "_scroll_id":
+					result.scrollID = tok
+				case "pit_id":
+					result.pitID = tok
+				case "id":
+					result.id = tok
+				}
+			}
+			// Record the error of the first failed bulk item:
+			// {"items":[{"index":{"error":{"type":...,"reason":...}}}]}
+			if n == 5 && stack[0].key == "items" && stack[3].key == "error" {
+				switch {
+				case stack[4].key == "type" && result.bulkErrorType == "":
+					result.bulkErrorType = tok
+				case stack[4].key == "reason" && result.bulkErrorReason == "":
+					result.bulkErrorReason = tok
+				}
+			}
+		case json.Number:
+			// Items with a status other than 200 OK or
+			// 201 Created have failed, as with esutil.
+			if n == 4 && stack[0].key == "items" && stack[3].key == "status" {
+				if status, err := tok.Int64(); err == nil && status > 201 {
+					result.bulkFailed++
+				}
+			}
+		}
+		if inObject {
+			stack[n-1].expectKey = true
+		}
+	}
+}
@@ -23,11 +23,23 @@ func init() {
 //
 // This middleware will recover and report panics, so it can
 // be used instead of the standard gin.Recovery middleware.
+// Use WithPanicPropagation to have panics propagated after
+// they have been reported.
 //
-// By default, the middleware will use elasticapm.DefaultTracer.
-// Use WithTracer to specify an alternative tracer.
+// By default, the middleware will use the tracer returned by
+// elasticapm.TracerFromContext for each request's context, which
+// is elasticapm.DefaultTracer unless another tracer has been
+// selected. Use WithTracer to specify a fixed tracer.
+//
+// By default, CORS preflight requests and requests for static assets
+// are not traced; see apmhttp.DefaultIgnoreRules. Use WithIgnoreRules
+// to override this behaviour.
 func Middleware(engine *gin.Engine, o ...Option) gin.HandlerFunc {
-	m := &middleware{engine: engine, tracer: elasticapm.DefaultTracer}
+	m := &middleware{
+		engine:         engine,
+		requestIgnorer: ignoreNone,
+		ignoreRules:    apmhttp.DefaultIgnoreRules(),
+	}
 	for _, o := range o {
 		o(m)
 	}
@@ -35,19 +47,28 @@ func Middleware(engine *gin.Engine, o ...Option) gin.HandlerFunc {
 }
 
 type middleware struct {
-	engine *gin.Engine
-	tracer *elasticapm.Tracer
+	engine           *gin.Engine
+	tracer           *elasticapm.Tracer
+	requestName      RequestNameFunc
+	requestIgnorer   RequestIgnorerFunc
+	ignoreRules      apmhttp.IgnoreRules
+	panicPropagation bool
 
 	setRouteMapOnce sync.Once
 	routeMap        map[string]map[string]routeInfo
 }
 
 type routeInfo struct {
+	path            string // e.g. "/foo"
 	transactionName string // e.g. "GET /foo"
 }
 
 func (m *middleware) handle(c *gin.Context) {
-	if !m.tracer.Active() {
+	tracer := m.tracer
+	if tracer == nil {
+		tracer = elasticapm.TracerFromContext(c.Request.Context())
+	}
+	if !tracer.Active() || m.ignoreRules.Ignore(c.Request) {
 		c.Next()
 		return
 	}
@@ -61,38 +82,60 @@ func (m *middleware) handle(c *gin.Context) {
 				rm[r.Method] = mm
 			}
 			mm[r.Handler] = routeInfo{
+				path:            r.Path,
 				transactionName: r.Method + " " + r.Path,
 			}
 		}
 		m.routeMap = rm
 	})
 
+	var route string
 	requestName := c.Request.Method
 	handlerName := c.HandlerName()
 	if routeInfo, ok := m.routeMap[c.Request.Method][handlerName]; ok {
+		route = routeInfo.path
 		requestName = routeInfo.transactionName
 	}
-	tx := m.tracer.StartTransaction(requestName, "request")
+	if m.requestIgnorer(c, route) {
+		c.Next()
+		return
+	}
+	if m.requestName != nil {
+		requestName = m.requestName(c, route)
+	}
+	tx := apmhttp.StartTransaction(tracer, requestName, c.Request)
 	ctx := elasticapm.ContextWithTransaction(c.Request.Context(), tx)
 	c.Request = apmhttp.RequestWithContext(ctx, c.Request)
 	defer tx.End()
 
-	body := m.tracer.CaptureHTTPRequestBody(c.Request)
+	body := tracer.CaptureHTTPRequestBody(c.Request)
 	ginContext := ginContext{Handler: handlerName}
 	defer func() {
-		if v := recover(); v != nil {
-			c.AbortWithStatus(http.StatusInternalServerError)
-			e := m.tracer.Recovered(v, tx)
+		statusCode := c.Writer.Status()
+		v := recover()
+		if v != nil {
+			if m.panicPropagation {
+				// The response will be written by a
+				// recovery handler further up the chain.
+				statusCode = http.StatusInternalServerError
+			} else {
+				c.AbortWithStatus(http.StatusInternalServerError)
+				statusCode = c.Writer.Status()
+			}
+			e := tracer.Recovered(v, tx)
 			e.Context.SetHTTPRequest(c.Request)
 			e.Context.SetHTTPRequestBody(body)
 			e.Send()
 		}
-		tx.Result = apmhttp.StatusCodeResult(c.Writer.Status())
+		tx.SetResult(elasticapm.ResultInfo{
+			Result:     apmhttp.StatusCodeResult(statusCode),
+			StatusCode: statusCode,
+		})
 
 		if tx.Sampled() {
 			tx.Context.SetHTTPRequest(c.Request)
 			tx.Context.SetHTTPRequestBody(body)
-			tx.Context.SetHTTPStatusCode(c.Writer.Status())
+			tx.Context.SetHTTPStatusCode(statusCode)
 			tx.Context.SetHTTPResponseHeaders(c.Writer.Header())
 			tx.Context.SetHTTPResponseHeadersSent(c.Writer.Written())
 			tx.Context.SetHTTPResponseFinished(!c.IsAborted())
@@ -100,7 +143,7 @@ func (m *middleware) handle(c *gin.Context) {
 		}
 
 		for _, err := range c.Errors {
-			e := m.tracer.NewError(err.Err)
+			e := tracer.NewError(err.Err)
 			e.Context.SetHTTPRequest(c.Request)
 			e.Context.SetHTTPRequestBody(body)
 			e.Context.SetCustom("gin", ginContext)
@@ -108,6 +151,10 @@ func (m *middleware) handle(c *gin.Context) {
 			e.Handled = true
 			e.Send()
 		}
+
+		if v != nil && m.panicPropagation {
+			panic(v)
+		}
 	}()
 	c.Next()
 }
@@ -129,3 +176,69 @@ func WithTracer(t *elasticapm.Tracer) Option {
 		m.tracer = t
 	}
 }
+
+// WithPanicPropagation returns an Option which enables panic propagation.
+// Any panics will be recovered and reported, and then re-panicked, so that
+// they may be handled by other middleware, such as gin.Recovery.
+//
+// By default, panics are recovered and reported, and the middleware
+// responds with status code 500, so it can be used in place of the
+// standard gin.Recovery middleware.
+func WithPanicPropagation() Option {
+	return func(m *middleware) {
+		m.panicPropagation = true
+	}
+}
+
+// RequestNameFunc is the type of a function for use in WithRequestName.
+//
+// The route parameter holds the path of the route matched by the request,
+// e.g. "/users/:id", or the empty string if no route matched.
+type RequestNameFunc func(c *gin.Context, route string) string
+
+// WithRequestName returns an Option which sets r as the function to use
+// to obtain the transaction name for the given request, e.g. to prefix
+// the name with a tenant identifier.
+//
+// By default, transactions are named "METHOD /route/path", or just
+// "METHOD" if no route matched.
+func WithRequestName(r RequestNameFunc) Option {
+	if r == nil {
+		panic("r == nil")
+	}
+	return func(m *middleware) {
+		m.requestName = r
+	}
+}
+
+// RequestIgnorerFunc is the type of a function for use in
+// WithRequestIgnorer. The route parameter is as described
+// for RequestNameFunc.
+type RequestIgnorerFunc func(c *gin.Context, route string) bool
+
+// WithRequestIgnorer returns an Option which sets r as the function to
+// use to determine whether or not a request should be ignored, e.g. for
+// health check routes, or for requests with the OPTIONS method. Ignored
+// requests are not traced, and panics are not recovered. If r is nil,
+// all requests will be reported.
+func WithRequestIgnorer(r RequestIgnorerFunc) Option {
+	if r == nil {
+		r = ignoreNone
+	}
+	return func(m *middleware) {
+		m.requestIgnorer = r
+	}
+}
+
+// WithIgnoreRules returns an Option which sets the built-in rules for
+// ignoring requests, overriding apmhttp.DefaultIgnoreRules. The rules
+// apply in addition to any function set with WithRequestIgnorer.
+func WithIgnoreRules(rules apmhttp.IgnoreRules) Option {
+	return func(m *middleware) {
+		m.ignoreRules = rules
+	}
+}
+
+func ignoreNone(*gin.Context, string) bool {
+	return false
+}
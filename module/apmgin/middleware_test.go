@@ -1,13 +1,18 @@
 package apmgin_test
 
 import (
+	"bytes"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
+	"github.com/elastic/apm-agent-go"
 	"github.com/elastic/apm-agent-go/model"
 	"github.com/elastic/apm-agent-go/module/apmgin"
 	"github.com/elastic/apm-agent-go/transport/transporttest"
@@ -74,3 +79,218 @@ func TestMiddleware(t *testing.T) {
 		},
 	}, transaction.Context)
 }
+
+func TestMiddlewareCaptureBodyMultipartForm(t *testing.T) {
+	if !elasticapm.BodyCaptureEnabled {
+		t.Skip("body capture is compiled out")
+	}
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetCaptureBody(elasticapm.CaptureBodyTransactions)
+
+	r := gin.New()
+	r.Use(apmgin.Middleware(r, apmgin.WithTracer(tracer)))
+	var form *multipart.Form
+	r.POST("/upload", func(c *gin.Context) {
+		if _, err := c.FormFile("upload"); err != nil {
+			panic(err)
+		}
+		form = c.Request.MultipartForm
+		c.String(200, c.PostForm("name"))
+	})
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("name", "gopher")
+	mw.WriteField("api_key", "hunter2")
+	fw, _ := mw.CreateFormFile("upload", "gopher.png")
+	fw.Write([]byte("not really a png"))
+	mw.Close()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "http://server.testing/upload", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	r.ServeHTTP(w, req)
+	defer form.RemoveAll()
+	assert.Equal(t, "gopher", w.Body.String())
+	tracer.Flush(nil)
+
+	transaction := transport.Payloads()[0].Transactions()[0]
+	assert.Equal(t, &model.RequestBody{
+		Form: url.Values{
+			"name":    []string{"gopher"},
+			"api_key": []string{"[REDACTED]"},
+		},
+		Files: map[string][]model.RequestBodyFile{
+			"upload": {{
+				Filename:    "gopher.png",
+				Size:        16,
+				ContentType: "application/octet-stream",
+			}},
+		},
+	}, transaction.Context.Request.Body)
+}
+
+func TestMiddlewareRequestName(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	r := gin.New()
+	r.Use(apmgin.Middleware(r,
+		apmgin.WithTracer(tracer),
+		apmgin.WithRequestName(func(c *gin.Context, route string) string {
+			return c.Request.Header.Get("X-Tenant") + " " + c.Request.Method + " " + route
+		}),
+	))
+	r.GET("/hello/:name", handleHello)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://server.testing/hello/isbel", nil)
+	req.Header.Set("X-Tenant", "acme")
+	r.ServeHTTP(w, req)
+	tracer.Flush(nil)
+
+	transactions := transport.Payloads()[0].Transactions()
+	require.Len(t, transactions, 1)
+	assert.Equal(t, "acme GET /hello/:name", transactions[0].Name)
+}
+
+func TestMiddlewareContextTracer(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	r := gin.New()
+	r.Use(apmgin.Middleware(r))
+	r.GET("/hello/:name", handleHello)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://server.testing/hello/isbel", nil)
+	req = req.WithContext(elasticapm.ContextWithTracer(req.Context(), tracer))
+	r.ServeHTTP(w, req)
+	tracer.Flush(nil)
+
+	transactions := transport.Payloads()[0].Transactions()
+	require.Len(t, transactions, 1)
+	assert.Equal(t, "GET /hello/:name", transactions[0].Name)
+}
+
+func TestMiddlewareRequestIgnorer(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	r := gin.New()
+	r.Use(apmgin.Middleware(r,
+		apmgin.WithTracer(tracer),
+		apmgin.WithRequestIgnorer(func(c *gin.Context, route string) bool {
+			return route == "/healthz" || c.Request.Method == "OPTIONS"
+		}),
+	))
+	r.GET("/healthz", func(c *gin.Context) {})
+	r.OPTIONS("/hello/:name", handleHello)
+	r.GET("/hello/:name", handleHello)
+
+	for _, req := range []struct{ method, url string }{
+		{"GET", "http://server.testing/healthz"},
+		{"OPTIONS", "http://server.testing/hello/isbel"},
+		{"GET", "http://server.testing/hello/isbel"},
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(req.method, req.url, nil)
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+	tracer.Flush(nil)
+
+	transactions := transport.Payloads()[0].Transactions()
+	require.Len(t, transactions, 1)
+	assert.Equal(t, "GET /hello/:name", transactions[0].Name)
+}
+
+func TestMiddlewareIgnoreRules(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	r := gin.New()
+	r.Use(apmgin.Middleware(r, apmgin.WithTracer(tracer)))
+	r.OPTIONS("/hello/:name", handleHello)
+	r.GET("/hello/:name", handleHello)
+	r.GET("/static/*path", func(c *gin.Context) {})
+
+	preflight, _ := http.NewRequest("OPTIONS", "http://server.testing/hello/isbel", nil)
+	preflight.Header.Set("Access-Control-Request-Method", "GET")
+	script, _ := http.NewRequest("GET", "http://server.testing/static/app.js", nil)
+	hello, _ := http.NewRequest("GET", "http://server.testing/hello/isbel", nil)
+	for _, req := range []*http.Request{preflight, script, hello} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+	tracer.Flush(nil)
+
+	transactions := transport.Payloads()[0].Transactions()
+	require.Len(t, transactions, 1)
+	assert.Equal(t, "GET /hello/:name", transactions[0].Name)
+}
+
+func TestMiddlewarePanic(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	r := gin.New()
+	r.Use(apmgin.Middleware(r, apmgin.WithTracer(tracer)))
+	r.GET("/panic", handlePanic)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://server.testing/panic", nil)
+	r.ServeHTTP(w, req)
+	tracer.Flush(nil)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assertPanicReported(t, transport)
+}
+
+func TestMiddlewarePanicPropagation(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	var recovered interface{}
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		defer func() {
+			recovered = recover()
+			c.AbortWithStatus(http.StatusTeapot)
+		}()
+		c.Next()
+	})
+	r.Use(apmgin.Middleware(r, apmgin.WithTracer(tracer), apmgin.WithPanicPropagation()))
+	r.GET("/panic", handlePanic)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://server.testing/panic", nil)
+	r.ServeHTTP(w, req)
+	tracer.Flush(nil)
+	assert.Equal(t, "boom", recovered)
+	assert.Equal(t, http.StatusTeapot, w.Code)
+	assertPanicReported(t, transport)
+}
+
+func assertPanicReported(t *testing.T, transport *transporttest.RecorderTransport) {
+	var errors []*model.Error
+	var transactions []model.Transaction
+	for _, p := range transport.Payloads() {
+		switch p := p.Value.(type) {
+		case *model.ErrorsPayload:
+			errors = append(errors, p.Errors...)
+		case *model.TransactionsPayload:
+			transactions = append(transactions, p.Transactions...)
+		}
+	}
+	require.Len(t, errors, 1)
+	require.Len(t, transactions, 1)
+	assert.Equal(t, "boom", errors[0].Exception.Message)
+	assert.Equal(t, "HTTP 5xx", transactions[0].Result)
+	assert.Equal(t, 500, transactions[0].Context.Response.StatusCode)
+}
+
+func handlePanic(c *gin.Context) {
+	panic("boom")
+}
@@ -16,19 +16,30 @@ import (
 // be used instead of the gorilla/middleware.RecoveryHandler
 // middleware.
 //
-// By default, the middleware will use elasticapm.DefaultTracer.
-// Use WithTracer to specify an alternative tracer.
+// By default, the middleware will use the tracer returned by
+// elasticapm.TracerFromContext for each request's context, which
+// is elasticapm.DefaultTracer unless another tracer has been
+// selected. Use WithTracer to specify a fixed tracer.
+//
+// By default, CORS preflight requests and requests for static assets
+// are not traced; see apmhttp.DefaultIgnoreRules. Use WithIgnoreRules
+// to override this behaviour.
 func Middleware(o ...Option) mux.MiddlewareFunc {
-	opts := options{tracer: elasticapm.DefaultTracer}
+	opts := options{
+		ignoreRules: apmhttp.DefaultIgnoreRules(),
+	}
 	for _, o := range o {
 		o(&opts)
 	}
+	serverOpts := []apmhttp.ServerOption{
+		apmhttp.WithServerRequestName(routeRequestName),
+		apmhttp.WithServerIgnoreRules(opts.ignoreRules),
+	}
+	if opts.tracer != nil {
+		serverOpts = append(serverOpts, apmhttp.WithTracer(opts.tracer))
+	}
 	return func(h http.Handler) http.Handler {
-		return apmhttp.Wrap(
-			h,
-			apmhttp.WithTracer(opts.tracer),
-			apmhttp.WithServerRequestName(routeRequestName),
-		)
+		return apmhttp.Wrap(h, serverOpts...)
 	}
 }
 
@@ -44,7 +55,8 @@ func routeRequestName(req *http.Request) string {
 }
 
 type options struct {
-	tracer *elasticapm.Tracer
+	tracer      *elasticapm.Tracer
+	ignoreRules apmhttp.IgnoreRules
 }
 
 // Option sets options for tracing.
@@ -60,3 +72,11 @@ func WithTracer(t *elasticapm.Tracer) Option {
 		o.tracer = t
 	}
 }
+
+// WithIgnoreRules returns an Option which sets the built-in rules for
+// ignoring requests, overriding apmhttp.DefaultIgnoreRules.
+func WithIgnoreRules(rules apmhttp.IgnoreRules) Option {
+	return func(o *options) {
+		o.ignoreRules = rules
+	}
+}
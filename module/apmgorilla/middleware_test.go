@@ -8,7 +8,9 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
+	"github.com/elastic/apm-agent-go"
 	"github.com/elastic/apm-agent-go/model"
 	"github.com/elastic/apm-agent-go/module/apmgorilla"
 	"github.com/elastic/apm-agent-go/transport/transporttest"
@@ -61,6 +63,26 @@ func TestMuxMiddleware(t *testing.T) {
 	}, transaction.Context)
 }
 
+func TestMuxMiddlewareContextTracer(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	r := mux.NewRouter()
+	r.Use(apmgorilla.Middleware())
+	r.Path("/articles/{category}/{id:[0-9]+}").Handler(http.HandlerFunc(articleHandler))
+	selectTracer := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := elasticapm.ContextWithTracer(req.Context(), tracer)
+		r.ServeHTTP(w, req.WithContext(ctx))
+	})
+
+	doRequest(selectTracer, "GET", "http://server.testing/articles/fiction/123")
+	tracer.Flush(nil)
+
+	transactions := transport.Payloads()[0].Transactions()
+	require.Len(t, transactions, 1)
+	assert.Equal(t, "GET /articles/{category}/{id}", transactions[0].Name)
+}
+
 func articleHandler(w http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
 	w.Write([]byte(fmt.Sprintf("%s:%s", vars["category"], vars["id"])))
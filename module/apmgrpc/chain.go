@@ -0,0 +1,61 @@
+package apmgrpc
+
+import (
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// TracedFunc is the type of a function which reports whether a request
+// with the given context is already being traced by other instrumentation,
+// such as otelgrpc. This is used to avoid reporting requests twice in
+// services which mix instrumentation.
+//
+// For example, to defer to otelgrpc, a TracedFunc may check for a valid
+// span context using go.opentelemetry.io/otel/trace.SpanContextFromContext.
+type TracedFunc func(ctx context.Context) bool
+
+// ChainUnaryServer returns a grpc.UnaryServerInterceptor which calls each
+// of the given interceptors in order, with the first being the outermost.
+// This may be used to compose the interceptor returned by
+// NewUnaryServerInterceptor with an existing chain of interceptors, for
+// versions of gRPC that accept only a single interceptor.
+func ChainUnaryServer(interceptors ...grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, next := interceptors[i], handler
+			handler = func(ctx context.Context, req interface{}) (interface{}, error) {
+				return interceptor(ctx, req, info, next)
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+// ChainUnaryClient returns a grpc.UnaryClientInterceptor which calls each
+// of the given interceptors in order, with the first being the outermost.
+// This may be used to compose the interceptor returned by
+// NewUnaryClientInterceptor with an existing chain of interceptors, for
+// versions of gRPC that accept only a single interceptor.
+func ChainUnaryClient(interceptors ...grpc.UnaryClientInterceptor) grpc.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		method string,
+		req, resp interface{},
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, next := interceptors[i], invoker
+			invoker = func(ctx context.Context, method string, req, resp interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+				return interceptor(ctx, method, req, resp, cc, next, opts...)
+			}
+		}
+		return invoker(ctx, method, req, resp, cc, opts...)
+	}
+}
@@ -0,0 +1,102 @@
+package apmgrpc_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/module/apmgrpc"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestChainUnaryServerOrder(t *testing.T) {
+	var calls []string
+	interceptor := func(name string) grpc.UnaryServerInterceptor {
+		return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			calls = append(calls, name)
+			return handler(ctx, req)
+		}
+	}
+	chain := apmgrpc.ChainUnaryServer(interceptor("a"), interceptor("b"))
+	resp, err := chain(context.Background(), "req", &grpc.UnaryServerInfo{}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		calls = append(calls, "handler")
+		return "resp", nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "resp", resp)
+	assert.Equal(t, []string{"a", "b", "handler"}, calls)
+}
+
+func TestServerInterceptorNested(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	chain := apmgrpc.ChainUnaryServer(
+		apmgrpc.NewUnaryServerInterceptor(apmgrpc.WithTracer(tracer)),
+		apmgrpc.NewUnaryServerInterceptor(apmgrpc.WithTracer(tracer)),
+	)
+	info := &grpc.UnaryServerInfo{FullMethod: "/foo.Bar/Baz"}
+	_, err := chain(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		assert.NotNil(t, elasticapm.TransactionFromContext(ctx))
+		return nil, nil
+	})
+	require.NoError(t, err)
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads, 1)
+	assert.Len(t, payloads[0].Transactions(), 1)
+}
+
+func TestServerInterceptorTracedFunc(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	interceptor := apmgrpc.NewUnaryServerInterceptor(
+		apmgrpc.WithTracer(tracer),
+		apmgrpc.WithServerTracedFunc(func(ctx context.Context) bool { return true }),
+	)
+	info := &grpc.UnaryServerInfo{FullMethod: "/foo.Bar/Baz"}
+	_, err := interceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		assert.Nil(t, elasticapm.TransactionFromContext(ctx))
+		return nil, nil
+	})
+	require.NoError(t, err)
+	tracer.Flush(nil)
+	assert.Empty(t, transport.Payloads())
+}
+
+func TestClientInterceptorNested(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	invoker := func(ctx context.Context, method string, req, resp interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return nil
+	}
+	nested := apmgrpc.ChainUnaryClient(
+		apmgrpc.NewUnaryClientInterceptor(),
+		apmgrpc.NewUnaryClientInterceptor(),
+	)
+	traced := apmgrpc.NewUnaryClientInterceptor(
+		apmgrpc.WithClientTracedFunc(func(ctx context.Context) bool { return true }),
+	)
+
+	tx := tracer.StartTransaction("name", "type")
+	ctx := elasticapm.ContextWithTransaction(context.Background(), tx)
+	require.NoError(t, nested(ctx, "/foo.Bar/Baz", nil, nil, nil, invoker))
+	require.NoError(t, nested(ctx, "/foo.Bar/Qux", nil, nil, nil, invoker))
+	require.NoError(t, traced(ctx, "/foo.Bar/Baz", nil, nil, nil, invoker))
+	tx.End()
+	tracer.Flush(nil)
+
+	transactions := transport.Payloads()[0].Transactions()
+	require.Len(t, transactions, 1)
+	spans := transactions[0].Spans
+	require.Len(t, spans, 2)
+	assert.Equal(t, "/foo.Bar/Baz", spans[0].Name)
+	assert.Equal(t, "/foo.Bar/Qux", spans[1].Name)
+}
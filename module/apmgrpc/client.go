@@ -1,8 +1,11 @@
 package apmgrpc
 
 import (
+	"strconv"
+
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 
 	"github.com/elastic/apm-agent-go"
 )
@@ -12,12 +15,21 @@ import (
 //
 // The interceptor will trace spans with the "grpc" type for each request
 // made, for any client method presented with a context containing a sampled
-// elasticapm.Transaction.
+// elasticapm.Transaction. The transaction's sampling priority, if any, is
+// propagated in the SamplingPriorityMetadataKey metadata key, and its
+// session ID, if any, in the SessionIDMetadataKey metadata key. Baggage
+// in the context is propagated in the BaggageMetadataKey metadata key.
+//
+// If another apmgrpc client interceptor has already started a span for
+// the call, no new span is started. Use WithClientTracedFunc to defer
+// to other instrumentation.
 func NewUnaryClientInterceptor(o ...ClientOption) grpc.UnaryClientInterceptor {
 	opts := clientOptions{}
 	for _, o := range o {
 		o(&opts)
 	}
+	traced := opts.traced
+	samplingPriority := opts.samplingPriority
 	return func(
 		ctx context.Context,
 		method string,
@@ -26,15 +38,74 @@ func NewUnaryClientInterceptor(o ...ClientOption) grpc.UnaryClientInterceptor {
 		invoker grpc.UnaryInvoker,
 		opts ...grpc.CallOption,
 	) error {
-		span, ctx := elasticapm.StartSpan(ctx, method, "grpc")
+		if m, ok := ctx.Value(clientSpanKey{}).(string); ok && m == method {
+			// A span has already been started for this call,
+			// e.g. by another apmgrpc interceptor in the chain.
+			return invoker(ctx, method, req, resp, cc, opts...)
+		}
+		if tx := elasticapm.TransactionFromContext(ctx); tx != nil {
+			priority := tx.SamplingPriority()
+			if priority < samplingPriority {
+				priority = samplingPriority
+			}
+			if priority > 0 {
+				ctx = metadata.AppendToOutgoingContext(
+					ctx, SamplingPriorityMetadataKey, strconv.Itoa(priority),
+				)
+			}
+			if sessionID := tx.SessionID(); sessionID != "" {
+				ctx = metadata.AppendToOutgoingContext(ctx, SessionIDMetadataKey, sessionID)
+			}
+		}
+		if b := elasticapm.BaggageFromContext(ctx); len(b) != 0 {
+			ctx = metadata.AppendToOutgoingContext(ctx, BaggageMetadataKey, b.String())
+		}
+		if traced != nil && traced(ctx) {
+			return invoker(ctx, method, req, resp, cc, opts...)
+		}
+		spanType := elasticapm.OverrideSpanType(ctx, "apmgrpc", "grpc", cc.Target())
+		target := elasticapm.ServiceTargetSpanContext{Type: "grpc", Name: cc.Target()}
+		span, ctx := elasticapm.StartExitSpan(ctx, method, spanType, target)
 		defer span.End()
+		ctx = context.WithValue(ctx, clientSpanKey{}, method)
 		return invoker(ctx, method, req, resp, cc, opts...)
 	}
 }
 
 type clientOptions struct {
-	tracer *elasticapm.Tracer
+	tracer           *elasticapm.Tracer
+	traced           TracedFunc
+	samplingPriority int
 }
 
+// clientSpanKey is the context key for the method of the
+// call for which a client interceptor has started a span.
+type clientSpanKey struct{}
+
 // ClientOption sets options for client-side tracing.
 type ClientOption func(*clientOptions)
+
+// WithClientSamplingPriority returns a ClientOption which sets the minimum
+// sampling priority propagated to the server in the
+// SamplingPriorityMetadataKey metadata key, regardless of the sampling
+// priority and sampling decision of the local transaction. This may be
+// used for connections to critical downstream services, so that their
+// requests are traced by services which trust propagated sampling
+// priorities even when the local transaction is not sampled.
+//
+// Calls whose context contains no transaction are not affected.
+func WithClientSamplingPriority(priority int) ClientOption {
+	return func(o *clientOptions) {
+		o.samplingPriority = priority
+	}
+}
+
+// WithClientTracedFunc returns a ClientOption which sets f as the function
+// used to determine whether an outgoing request is already being traced by
+// other instrumentation, such as otelgrpc. If f returns true, the
+// interceptor does not start a span for the request.
+func WithClientTracedFunc(f TracedFunc) ClientOption {
+	return func(o *clientOptions) {
+		o.traced = f
+	}
+}
@@ -1,13 +1,55 @@
 package apmgrpc
 
 import (
+	"strconv"
+	"strings"
+	"time"
+
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 
 	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/instrumentation"
+)
+
+// ForceSampleMetadataKey is the incoming metadata key which, if its value
+// matches the tracer's force-sample secret, causes the request's transaction
+// to be sampled regardless of the sampling rate. See
+// elasticapm.Tracer.SetForceSampleSecret.
+const ForceSampleMetadataKey = "elastic-apm-force-sample"
+
+// SamplingPriorityMetadataKey is the metadata key with which a transaction's
+// sampling priority is propagated by client interceptors, and honoured by
+// server interceptors if the tracer trusts propagated sampling priorities.
+// See elasticapm.Tracer.SetTrustSamplingPriority.
+const SamplingPriorityMetadataKey = "elastic-apm-sampling-priority"
+
+// SessionIDMetadataKey is the metadata key with which a transaction's
+// session ID is propagated by client interceptors, and recorded by
+// server interceptors. See elasticapm.Transaction.SetSessionID.
+const SessionIDMetadataKey = "elastic-apm-session-id"
+
+// BaggageMetadataKey is the metadata key with which W3C Baggage is
+// propagated by client interceptors, and added to the call context
+// by server interceptors. See elasticapm.Baggage.
+const BaggageMetadataKey = "baggage"
+
+const (
+	// DeadlineRemainingTag is the transaction tag recording the time
+	// remaining, in milliseconds, until the deadline of an incoming
+	// request, at the time the request was received. The tag is only
+	// recorded if the request has a deadline.
+	DeadlineRemainingTag = "grpc_deadline_remaining_ms"
+
+	// TerminationTag is the transaction tag classifying how an incoming
+	// request terminated: "success", "deadline_exceeded" if the request's
+	// deadline was exceeded, "client_cancel" if the client cancelled the
+	// request, or "server_error" if the handler returned any other error.
+	TerminationTag = "grpc_termination"
 )
 
 // NewUnaryServerInterceptor returns a grpc.UnaryServerInterceptor that
@@ -17,12 +59,18 @@ import (
 // incoming request. The transaction will be added to the context, so
 // server methods can use elasticapm.StartSpan with the provided context.
 //
-// By default, the interceptor will trace with elasticapm.DefaultTracer,
-// and will not recover any panics. Use WithTracer to specify an
-// alternative tracer, and WithRecovery to enable panic recovery.
+// By default, the interceptor will trace with the tracer returned by
+// elasticapm.TracerFromContext for each call's context, which is
+// elasticapm.DefaultTracer unless another tracer has been selected,
+// e.g. by an earlier interceptor using elasticapm.ContextWithTracer.
+// The interceptor will not recover any panics by default. Use WithTracer
+// to specify a fixed tracer, and WithRecovery to enable panic recovery.
+//
+// If the incoming context already contains a transaction, e.g. because
+// another apmgrpc interceptor ran first, no new transaction is started.
+// Use WithServerTracedFunc to defer to other instrumentation.
 func NewUnaryServerInterceptor(o ...ServerOption) grpc.UnaryServerInterceptor {
 	opts := serverOptions{
-		tracer:  elasticapm.DefaultTracer,
 		recover: false,
 	}
 	for _, o := range o {
@@ -34,11 +82,28 @@ func NewUnaryServerInterceptor(o ...ServerOption) grpc.UnaryServerInterceptor {
 		info *grpc.UnaryServerInfo,
 		handler grpc.UnaryHandler,
 	) (resp interface{}, err error) {
-		if !opts.tracer.Active() {
+		tracer := opts.tracer
+		if tracer == nil {
+			tracer = elasticapm.TracerFromContext(ctx)
+		}
+		if !tracer.Active() {
+			return handler(ctx, req)
+		}
+		if elasticapm.TransactionFromContext(ctx) != nil {
+			// The request is already being traced, e.g. by another
+			// apmgrpc interceptor earlier in the chain.
 			return handler(ctx, req)
 		}
-		tx := opts.tracer.StartTransaction(info.FullMethod, "grpc")
+		if opts.traced != nil && opts.traced(ctx) {
+			return handler(ctx, req)
+		}
+		tx := startTransaction(ctx, tracer, info.FullMethod)
 		ctx = elasticapm.ContextWithTransaction(ctx, tx)
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if b := elasticapm.ParseBaggage(strings.Join(md[BaggageMetadataKey], ",")); len(b) != 0 {
+				ctx = elasticapm.ContextWithBaggage(ctx, b)
+			}
+		}
 		defer tx.End()
 
 		if tx.Sampled() {
@@ -54,12 +119,16 @@ func NewUnaryServerInterceptor(o ...ServerOption) grpc.UnaryServerInterceptor {
 				}
 				tx.Context.SetCustom("grpc", grpcContext)
 			}
+			if deadline, ok := ctx.Deadline(); ok {
+				remaining := time.Until(deadline) / time.Millisecond
+				tx.Context.SetTag(DeadlineRemainingTag, strconv.FormatInt(int64(remaining), 10))
+			}
 		}
 
 		defer func() {
 			r := recover()
 			if r != nil {
-				e := opts.tracer.Recovered(r, tx)
+				e := tracer.Recovered(r, tx)
 				e.Handled = opts.recover
 				e.Send()
 				if opts.recover {
@@ -71,15 +140,21 @@ func NewUnaryServerInterceptor(o ...ServerOption) grpc.UnaryServerInterceptor {
 		}()
 
 		resp, err = handler(ctx, req)
-		if err == nil {
-			tx.Result = codes.OK.String()
-		} else {
-			statusCode := codes.Unknown
+		statusCode := codes.OK
+		if err != nil {
+			statusCode = codes.Unknown
 			s, ok := status.FromError(err)
 			if ok {
 				statusCode = s.Code()
 			}
-			tx.Result = statusCode.String()
+		}
+		tx.SetResult(elasticapm.ResultInfo{
+			Result:     statusCode.String(),
+			StatusCode: int(statusCode),
+			Err:        err,
+		})
+		if tx.Sampled() {
+			tx.Context.SetTag(TerminationTag, termination(ctx, statusCode))
 		}
 		return resp, err
 	}
@@ -88,6 +163,7 @@ func NewUnaryServerInterceptor(o ...ServerOption) grpc.UnaryServerInterceptor {
 type serverOptions struct {
 	tracer  *elasticapm.Tracer
 	recover bool
+	traced  TracedFunc
 }
 
 // ServerOption sets options for server-side tracing.
@@ -116,3 +192,35 @@ func WithRecovery() ServerOption {
 		o.recover = true
 	}
 }
+
+// WithServerTracedFunc returns a ServerOption which sets f as the function
+// used to determine whether an incoming request is already being traced by
+// other instrumentation, such as otelgrpc. If f returns true, the
+// interceptor does not start a transaction for the request.
+func WithServerTracedFunc(f TracedFunc) ServerOption {
+	return func(o *serverOptions) {
+		o.traced = f
+	}
+}
+
+// termination classifies the termination of a request with the given
+// context and resulting status code, for TerminationTag.
+func termination(ctx context.Context, code codes.Code) string {
+	switch {
+	case ctx.Err() == context.DeadlineExceeded || code == codes.DeadlineExceeded:
+		return "deadline_exceeded"
+	case ctx.Err() == context.Canceled || code == codes.Canceled:
+		return "client_cancel"
+	case code != codes.OK:
+		return "server_error"
+	}
+	return "success"
+}
+
+func startTransaction(ctx context.Context, tracer *elasticapm.Tracer, name string) *elasticapm.Transaction {
+	var carrier instrumentation.Carrier
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		carrier = instrumentation.MetadataCarrier(md)
+	}
+	return instrumentation.StartTransaction(tracer, name, "grpc", carrier)
+}
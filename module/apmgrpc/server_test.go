@@ -88,6 +88,7 @@ func testServerTransactionHappy(t *testing.T, p testParams) {
 			Key:   "grpc",
 			Value: map[string]interface{}{},
 		}},
+		Tags: map[string]string{"grpc_termination": "success"},
 	}, tx.Context)
 }
 
@@ -117,6 +118,7 @@ func testServerTransactionStatusError(t *testing.T, p testParams) {
 	assert.Equal(t, "/helloworld.Greeter/SayHello", tx.Name)
 	assert.Equal(t, "grpc", tx.Type)
 	assert.Equal(t, "DataLoss", tx.Result)
+	assert.Equal(t, "server_error", tx.Context.Tags["grpc_termination"])
 }
 
 func testServerTransactionPanic(t *testing.T, p testParams) {
@@ -0,0 +1,58 @@
+package apmgrpc_test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/elastic/apm-agent-go/module/apmgrpc"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestServerInterceptorTermination(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	interceptor := apmgrpc.NewUnaryServerInterceptor(apmgrpc.WithTracer(tracer))
+	info := &grpc.UnaryServerInfo{FullMethod: "/foo.Bar/Baz"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	interceptor(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		<-ctx.Done()
+		return nil, status.Error(codes.DeadlineExceeded, ctx.Err().Error())
+	})
+
+	ctx, cancel = context.WithCancel(context.Background())
+	interceptor(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		cancel()
+		return nil, ctx.Err()
+	})
+
+	interceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.Internal, "boom")
+	})
+	interceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	tracer.Flush(nil)
+
+	transactions := transport.Payloads()[0].Transactions()
+	require.Len(t, transactions, 4)
+	var terminations []string
+	for _, tx := range transactions {
+		terminations = append(terminations, tx.Context.Tags["grpc_termination"])
+	}
+	assert.Equal(t, []string{"deadline_exceeded", "client_cancel", "server_error", "success"}, terminations)
+
+	remaining, err := strconv.Atoi(transactions[0].Context.Tags["grpc_deadline_remaining_ms"])
+	require.NoError(t, err)
+	assert.True(t, remaining > 0 && remaining <= 10, remaining)
+	assert.NotContains(t, transactions[1].Context.Tags, "grpc_deadline_remaining_ms")
+}
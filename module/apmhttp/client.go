@@ -1,9 +1,15 @@
 package apmhttp
 
 import (
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
 
 	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/instrumentation"
 )
 
 // WrapClient returns a new *http.Client with all fields copied
@@ -45,29 +51,255 @@ type roundTripper struct {
 	r              http.RoundTripper
 	requestName    RequestNameFunc
 	requestIgnorer RequestIgnorerFunc
+	serviceTarget  elasticapm.ServiceTargetSpanContext
+
+	// samplingPriority is the minimum sampling priority
+	// propagated to the server; see WithClientSamplingPriority.
+	samplingPriority int
+
+	captureTrailers     bool
+	captureServerTiming bool
+	captureRedirects    bool
 }
 
 // RoundTrip delegates to r.r, emitting a span if req's context
-// contains a transaction.
+// contains a sampled transaction. Baggage in the request context, and
+// feature flags marked for propagation in the transaction's context,
+// are added to the "baggage" header, the transaction's sampling
+// priority, if any, to the "Elastic-Apm-Sampling-Priority" header,
+// and its session ID, if any, to the "Elastic-Apm-Session-Id" header.
 func (r *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 	if r.requestIgnorer(req) {
 		return r.r.RoundTrip(req)
 	}
 	ctx := req.Context()
 	tx := elasticapm.TransactionFromContext(ctx)
-	if tx == nil || !tx.Sampled() {
+	if tx == nil {
+		return r.r.RoundTrip(req)
+	}
+	baggage := elasticapm.BaggageFromContext(ctx).Merge(
+		elasticapm.ParseBaggage(tx.Context.FeatureFlagBaggage()),
+	).String()
+	priority := tx.SamplingPriority()
+	if priority < r.samplingPriority {
+		priority = r.samplingPriority
+	}
+	sessionID := tx.SessionID()
+	if baggage != "" || priority > 0 || sessionID != "" {
+		req = requestWithPropagatedHeaders(req, baggage, priority, sessionID)
+	}
+	if !tx.Sampled() {
 		return r.r.RoundTrip(req)
 	}
 
 	name := r.requestName(req)
-	spanType := "ext.http"
-	span := tx.StartSpan(name, spanType, elasticapm.SpanFromContext(ctx))
-	defer span.End()
-
-	ctx = elasticapm.ContextWithSpan(ctx, span)
+	spanType := elasticapm.OverrideSpanType(ctx, "apmhttp", "ext.http", req.URL.Host)
+	span, ctx := elasticapm.StartExitSpan(ctx, name, spanType, r.serviceTarget)
+	if r.captureRedirects && !span.Dropped() {
+		setRedirectTags(span, req)
+	}
+	if !r.captureTrailers || span.Dropped() {
+		defer span.End()
+	}
 	req = RequestWithContext(ctx, req)
-	return r.r.RoundTrip(req)
+	resp, err := r.r.RoundTrip(req)
+	if r.captureServerTiming && err == nil && !span.Dropped() {
+		setServerTimingTags(span, resp.Header)
+	}
+	if r.captureRedirects && err == nil && !span.Dropped() && !r.captureTrailers {
+		span.Context.SetHTTP(elasticapm.HTTPSpanContext{
+			URL:         req.URL,
+			StatusCode:  resp.StatusCode,
+			HTTPVersion: fmt.Sprintf("%d.%d", resp.ProtoMajor, resp.ProtoMinor),
+		})
+	}
+	if r.captureTrailers && !span.Dropped() {
+		if err != nil || resp.StatusCode == http.StatusSwitchingProtocols {
+			span.End()
+		} else {
+			// Trailers are only available once the response body has
+			// been consumed, so defer ending the span until then.
+			resp.Body = &responseBody{
+				ReadCloser: resp.Body,
+				resp:       resp,
+				span:       span.Ref(),
+				captureURL: r.captureRedirects && resp.Request != nil,
+			}
+		}
+	}
+	return resp, err
+}
+
+// requestWithPropagatedHeaders returns a shallow copy of req, with the
+// given W3C Baggage members, if any, added to the "baggage" header, and
+// the given sampling priority, if greater than zero, set in the
+// "Elastic-Apm-Sampling-Priority" header, and the given session ID,
+// if non-empty, set in the "Elastic-Apm-Session-Id" header.
+func requestWithPropagatedHeaders(req *http.Request, baggage string, priority int, sessionID string) *http.Request {
+	reqCopy := *req
+	reqCopy.Header = make(http.Header, len(req.Header)+3)
+	for k, v := range req.Header {
+		reqCopy.Header[k] = v
+	}
+	if baggage != "" {
+		if existing := reqCopy.Header.Get("Baggage"); existing != "" {
+			baggage = existing + "," + baggage
+		}
+		reqCopy.Header.Set("Baggage", baggage)
+	}
+	if priority > 0 {
+		reqCopy.Header.Set(instrumentation.SamplingPriorityKey, strconv.Itoa(priority))
+	}
+	if sessionID != "" {
+		reqCopy.Header.Set(instrumentation.SessionIDKey, sessionID)
+	}
+	return &reqCopy
+}
+
+// responseBody wraps a client response body, ending the associated
+// span when the body has been read in its entirety, or closed.
+type responseBody struct {
+	io.ReadCloser
+	resp *http.Response
+	once sync.Once
+
+	// span refers to the client span, which is ended with
+	// the transaction if the body has not been consumed.
+	span *elasticapm.SpanRef
+
+	// captureURL records whether the request URL
+	// should be recorded in the span context.
+	captureURL bool
+}
+
+// Read reads from the wrapped body, ending the span on io.EOF.
+func (b *responseBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.endSpan()
+	}
+	return n, err
+}
+
+// Close closes the wrapped body, ending the span if it has
+// not already been ended.
+func (b *responseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.endSpan()
+	return err
+}
+
+func (b *responseBody) endSpan() {
+	b.once.Do(func() {
+		var requestURL *url.URL
+		if b.captureURL {
+			requestURL = b.resp.Request.URL
+		}
+		b.span.Do(func(span *elasticapm.Span) {
+			span.Context.SetHTTP(elasticapm.HTTPSpanContext{
+				URL:         requestURL,
+				StatusCode:  b.resp.StatusCode,
+				HTTPVersion: fmt.Sprintf("%d.%d", b.resp.ProtoMajor, b.resp.ProtoMinor),
+				Trailers:    b.resp.Trailer,
+			})
+			span.End()
+		})
+	})
 }
 
 // ClientOption sets options for tracing client requests.
 type ClientOption func(*roundTripper)
+
+// WithClientTrailers returns a ClientOption which enables capturing of
+// the HTTP response status code, protocol version, and trailers in the
+// client span context.
+//
+// Because trailers are only available once the response body has been
+// consumed, enabling this option causes client spans to be ended when
+// the response body is read to completion or closed, rather than when
+// the response headers are received. If the transaction ends first, the
+// span is truncated to the end of the transaction. HTTP/2 stream IDs are
+// not exposed by net/http, and so cannot be recorded.
+func WithClientTrailers() ClientOption {
+	return func(r *roundTripper) {
+		r.captureTrailers = true
+	}
+}
+
+// WithClientRedirects returns a ClientOption which enables capturing of
+// the request URL, response status code, and protocol version in the
+// client span context, and of the redirect chain of requests made by
+// following redirects.
+//
+// http.Client sends each request in a chain of redirects through the
+// RoundTripper separately, so each is reported as its own span. The span
+// for a request made by following a redirect records, in the tags
+// "http_redirects" and "http_original_url", the number of redirects
+// followed to reach it and the URL of the original request. The span for
+// the final request in the chain thus records the final URL and the
+// length of the redirect chain.
+func WithClientRedirects() ClientOption {
+	return func(r *roundTripper) {
+		r.captureRedirects = true
+	}
+}
+
+// setRedirectTags sets tags on span recording the number of redirects
+// followed to make req, and the URL of the original request, if req
+// was made by following a redirect.
+func setRedirectTags(span *elasticapm.Span, req *http.Request) {
+	var redirects int
+	original := req
+	for r := req; r.Response != nil && r.Response.Request != nil; r = r.Response.Request {
+		redirects++
+		original = r.Response.Request
+	}
+	if redirects == 0 {
+		return
+	}
+	originalURL := *original.URL
+	if originalURL.User != nil {
+		originalURL.User = url.User(originalURL.User.Username())
+	}
+	span.Context.SetTag("http_redirects", strconv.Itoa(redirects))
+	span.Context.SetTag("http_original_url", originalURL.String())
+}
+
+// WithClientSamplingPriority returns a ClientOption which sets the minimum
+// sampling priority propagated to the server in the
+// "Elastic-Apm-Sampling-Priority" header, regardless of the sampling
+// priority and sampling decision of the local transaction. Wrapping the
+// client used for a critical downstream service with a priority greater
+// than zero causes requests to it to be traced by the service, if it trusts
+// propagated sampling priorities, even when the local transaction is not
+// sampled. See elasticapm.Tracer.SetTrustSamplingPriority.
+//
+// Requests whose context contains no transaction are not affected.
+func WithClientSamplingPriority(priority int) ClientOption {
+	return func(rt *roundTripper) {
+		rt.samplingPriority = priority
+	}
+}
+
+// WithClientRequestName returns a ClientOption which sets r as the function
+// to use to obtain the span name for the given client request. For SOAP
+// clients, SOAPClientRequestName may be used to name spans by operation.
+func WithClientRequestName(r RequestNameFunc) ClientOption {
+	if r == nil {
+		panic("r == nil")
+	}
+	return func(rt *roundTripper) {
+		rt.requestName = r
+	}
+}
+
+// WithClientServiceTarget returns a ClientOption which sets the service
+// targeted by client spans, used for grouping dependencies in the APM UI.
+// This is useful for clients of HTTP-based services, such as
+// Elasticsearch, where the service is better identified by its type and
+// cluster name than by a host and port.
+func WithClientServiceTarget(target elasticapm.ServiceTargetSpanContext) ClientOption {
+	return func(rt *roundTripper) {
+		rt.serviceTarget = target
+	}
+}
@@ -2,8 +2,11 @@ package apmhttp_test
 
 import (
 	"context"
+	"io/ioutil"
+	"math/rand"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -11,6 +14,7 @@ import (
 	"golang.org/x/net/context/ctxhttp"
 
 	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/model"
 	"github.com/elastic/apm-agent-go/module/apmhttp"
 	"github.com/elastic/apm-agent-go/transport/transporttest"
 )
@@ -49,3 +53,339 @@ func TestClient(t *testing.T) {
 	assert.Equal(t, "ext.http", span.Type)
 	assert.Nil(t, span.Context)
 }
+
+func TestClientFeatureFlagBaggage(t *testing.T) {
+	tracer, _ := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	var baggage string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		baggage = req.Header.Get("Baggage")
+	}))
+	defer server.Close()
+
+	tx := tracer.StartTransaction("name", "type")
+	tx.Context.SetFeatureFlag("local", true)
+	tx.Context.PropagateFeatureFlag("variant", "b c")
+	ctx := elasticapm.ContextWithTransaction(context.Background(), tx)
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	req.Header.Set("Baggage", "foo=bar")
+	client := apmhttp.WrapClient(http.DefaultClient)
+	resp, err := client.Do(req.WithContext(ctx))
+	require.NoError(t, err)
+	resp.Body.Close()
+	tx.End()
+
+	assert.Equal(t, "foo=bar,variant=b%20c", baggage)
+	assert.Equal(t, "foo=bar", req.Header.Get("Baggage")) // original request unmodified
+}
+
+func TestClientContextBaggage(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetBaggageTags([]string{"tenant"})
+
+	var baggage string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		baggage = req.Header.Get("Baggage")
+	}))
+	defer backend.Close()
+
+	client := apmhttp.WrapClient(http.DefaultClient)
+	frontend := httptest.NewServer(apmhttp.Wrap(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			ctx := req.Context()
+			tx := elasticapm.TransactionFromContext(ctx)
+			tx.Context.PropagateFeatureFlag("variant", "b")
+			value, ok := elasticapm.BaggageFromContext(ctx).Get("tenant")
+			assert.True(t, ok)
+			assert.Equal(t, "acme corp", value)
+
+			req, _ = http.NewRequest("GET", backend.URL, nil)
+			resp, err := client.Do(req.WithContext(ctx))
+			require.NoError(t, err)
+			resp.Body.Close()
+		}),
+		apmhttp.WithTracer(tracer),
+	))
+	defer frontend.Close()
+
+	req, _ := http.NewRequest("GET", frontend.URL, nil)
+	req.Header.Set("Baggage", "tenant=acme%20corp,region=eu;ttl=1")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	tracer.Flush(nil)
+
+	assert.Equal(t, "tenant=acme%20corp,region=eu,variant=b", baggage)
+	tx := transport.Payloads()[0].Transactions()[0]
+	assert.Equal(t, "acme corp", tx.Context.Tags["baggage_tenant"])
+	assert.NotContains(t, tx.Context.Tags, "baggage_region")
+}
+
+func TestClientSamplingPriority(t *testing.T) {
+	tracer, _ := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	var priorities []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		priorities = append(priorities, req.Header.Get("Elastic-Apm-Sampling-Priority"))
+	}))
+	defer server.Close()
+
+	tx := tracer.StartTransaction("name", "type")
+	ctx := elasticapm.ContextWithTransaction(context.Background(), tx)
+	client := apmhttp.WrapClient(http.DefaultClient)
+	for i := 0; i < 2; i++ {
+		resp, err := ctxhttp.Get(ctx, client, server.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+		elasticapm.SetSamplingPriority(ctx, 2)
+	}
+	tx.End()
+
+	assert.Equal(t, []string{"", "2"}, priorities)
+}
+
+func TestClientMinimumSamplingPriority(t *testing.T) {
+	tracer, _ := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetSampler(elasticapm.NewRatioSampler(0, rand.NewSource(0)))
+
+	var priorities []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		priorities = append(priorities, req.Header.Get("Elastic-Apm-Sampling-Priority"))
+	}))
+	defer server.Close()
+
+	tx := tracer.StartTransaction("name", "type")
+	require.False(t, tx.Sampled())
+	ctx := elasticapm.ContextWithTransaction(context.Background(), tx)
+	client := apmhttp.WrapClient(http.DefaultClient, apmhttp.WithClientSamplingPriority(1))
+	for i := 0; i < 2; i++ {
+		resp, err := ctxhttp.Get(ctx, client, server.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+		elasticapm.SetSamplingPriority(ctx, 2)
+	}
+	tx.End()
+
+	assert.Equal(t, []string{"1", "2"}, priorities)
+}
+
+func TestClientSessionID(t *testing.T) {
+	tracer, _ := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	var sessionIDs []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		sessionIDs = append(sessionIDs, req.Header.Get("Elastic-Apm-Session-Id"))
+	}))
+	defer server.Close()
+
+	tx := tracer.StartTransaction("name", "type")
+	ctx := elasticapm.ContextWithTransaction(context.Background(), tx)
+	client := apmhttp.WrapClient(http.DefaultClient)
+	for i := 0; i < 2; i++ {
+		resp, err := ctxhttp.Get(ctx, client, server.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+		elasticapm.SetSessionID(ctx, "abc123")
+	}
+	tx.End()
+
+	assert.Equal(t, []string{"", "abc123"}, sessionIDs)
+}
+
+func TestClientServiceTarget(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	tx := tracer.StartTransaction("name", "type")
+	ctx := elasticapm.ContextWithTransaction(context.Background(), tx)
+	client := apmhttp.WrapClient(http.DefaultClient, apmhttp.WithClientServiceTarget(
+		elasticapm.ServiceTargetSpanContext{Type: "elasticsearch", Name: "logs-cluster"},
+	))
+	resp, err := ctxhttp.Get(ctx, client, server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	tx.End()
+	tracer.Flush(nil)
+
+	span := transport.Payloads()[0].Transactions()[0].Spans[0]
+	assert.Equal(t, &model.SpanContext{
+		Destination: &model.DestinationSpanContext{
+			Service: &model.DestinationServiceSpanContext{Resource: "elasticsearch/logs-cluster"},
+		},
+		Service: &model.ServiceSpanContext{
+			Target: &model.ServiceTargetSpanContext{Type: "elasticsearch", Name: "logs-cluster"},
+		},
+	}, span.Context)
+}
+
+func TestClientServerTiming(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Add("Server-Timing", `db;dur=53.2, cache.hit;desc="Cache, Read";dur=0.1`)
+		w.Header().Add("Server-Timing", `miss, app;dur=invalid;desc="\"main\""`)
+	}))
+	defer server.Close()
+
+	tx := tracer.StartTransaction("name", "type")
+	ctx := elasticapm.ContextWithTransaction(context.Background(), tx)
+	client := apmhttp.WrapClient(http.DefaultClient, apmhttp.WithClientServerTiming())
+	resp, err := ctxhttp.Get(ctx, client, server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	tx.End()
+	tracer.Flush(nil)
+
+	span := transport.Payloads()[0].Transactions()[0].Spans[0]
+	assert.Equal(t, map[string]string{
+		"server_timing_db":        "53.2",
+		"server_timing_cache_hit": "0.1",
+		"server_timing_miss":      "",
+		"server_timing_app":       `"main"`,
+	}, span.Context.Tags)
+}
+
+func TestClientSpanTypeOverride(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	tracer.SetSpanTypeOverrides([]elasticapm.SpanTypeOverride{
+		{Module: "apmhttp", Destination: serverURL.Host, Type: "external.billing"},
+	})
+
+	tx := tracer.StartTransaction("name", "type")
+	ctx := elasticapm.ContextWithTransaction(context.Background(), tx)
+	client := apmhttp.WrapClient(http.DefaultClient)
+	resp, err := ctxhttp.Get(ctx, client, server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	tx.End()
+	tracer.Flush(nil)
+
+	span := transport.Payloads()[0].Transactions()[0].Spans[0]
+	assert.Equal(t, "external.billing", span.Type)
+}
+
+func TestClientTrailers(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.Write([]byte("bar"))
+		w.Header().Set("Grpc-Status", "0")
+	}))
+	defer server.Close()
+
+	tx := tracer.StartTransaction("name", "type")
+	ctx := elasticapm.ContextWithTransaction(context.Background(), tx)
+	client := apmhttp.WrapClient(http.DefaultClient, apmhttp.WithClientTrailers())
+	resp, err := ctxhttp.Get(ctx, client, server.URL+"/foo")
+	require.NoError(t, err)
+	_, err = ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	tx.End()
+	tracer.Flush(nil)
+
+	transaction := transport.Payloads()[0].Transactions()[0]
+	require.Len(t, transaction.Spans, 1)
+	assert.Equal(t, &model.SpanContext{
+		HTTP: &model.HTTPSpanContext{
+			StatusCode:  http.StatusOK,
+			HTTPVersion: "1.1",
+			Trailers:    http.Header{"Grpc-Status": []string{"0"}},
+		},
+	}, transaction.Spans[0].Context)
+}
+
+func TestClientTrailersBodyClosedAfterTransaction(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.Write([]byte("bar"))
+		w.Header().Set("Grpc-Status", "0")
+	}))
+	defer server.Close()
+
+	tx := tracer.StartTransaction("name", "type")
+	ctx := elasticapm.ContextWithTransaction(context.Background(), tx)
+	client := apmhttp.WrapClient(http.DefaultClient, apmhttp.WithClientTrailers())
+	resp, err := ctxhttp.Get(ctx, client, server.URL+"/foo")
+	require.NoError(t, err)
+	tx.End()
+	tracer.Flush(nil)
+
+	// The span was truncated when the transaction ended, and must
+	// not be touched once the body is consumed, as it may be reused.
+	_, err = ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	transaction := transport.Payloads()[0].Transactions()[0]
+	require.Len(t, transaction.Spans, 1)
+	assert.Equal(t, "ext.http.truncated", transaction.Spans[0].Type)
+	assert.Nil(t, transaction.Spans[0].Context)
+}
+
+func TestClientRedirects(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	mux := http.NewServeMux()
+	mux.Handle("/login", http.RedirectHandler("/auth", http.StatusFound))
+	mux.Handle("/auth", http.RedirectHandler("/home", http.StatusSeeOther))
+	mux.Handle("/home", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tx := tracer.StartTransaction("name", "type")
+	ctx := elasticapm.ContextWithTransaction(context.Background(), tx)
+	client := apmhttp.WrapClient(http.DefaultClient, apmhttp.WithClientRedirects())
+	resp, err := ctxhttp.Get(ctx, client, server.URL+"/login")
+	require.NoError(t, err)
+	resp.Body.Close()
+	tx.End()
+	tracer.Flush(nil)
+
+	spans := transport.Payloads()[0].Transactions()[0].Spans
+	require.Len(t, spans, 3)
+	assert.Equal(t, &model.SpanContext{
+		HTTP: &model.HTTPSpanContext{
+			URL:         server.URL + "/login",
+			StatusCode:  http.StatusFound,
+			HTTPVersion: "1.1",
+		},
+	}, spans[0].Context)
+	assert.Equal(t, map[string]string{
+		"http_redirects":    "1",
+		"http_original_url": server.URL + "/login",
+	}, spans[1].Context.Tags)
+	assert.Equal(t, &model.SpanContext{
+		HTTP: &model.HTTPSpanContext{
+			URL:         server.URL + "/home",
+			StatusCode:  http.StatusOK,
+			HTTPVersion: "1.1",
+		},
+		Tags: map[string]string{
+			"http_redirects":    "2",
+			"http_original_url": server.URL + "/login",
+		},
+	}, spans[2].Context)
+}
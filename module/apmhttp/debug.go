@@ -0,0 +1,57 @@
+package apmhttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/elastic/apm-agent-go"
+)
+
+// DebugHandler returns an http.Handler which reports the tracer's
+// recently ended, sampled transactions as JSON, most recent first,
+// for support tooling. Transactions are recorded only once enabled
+// with elasticapm.Tracer.SetRecentTransactions; see
+// elasticapm.Tracer.RecentTransactions.
+//
+// The handler is intended to be served on an internal debug endpoint,
+// as transaction names may reveal details of the application.
+func DebugHandler(t *elasticapm.Tracer) http.Handler {
+	if t == nil {
+		panic("t == nil")
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != "GET" && req.Method != "HEAD" {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		recent := t.RecentTransactions()
+		out := debugResponse{RecentTransactions: make([]debugTransaction, len(recent))}
+		for i, tx := range recent {
+			out.RecentTransactions[i] = debugTransaction{
+				ID:        tx.ID,
+				Name:      tx.Name,
+				Type:      tx.Type,
+				Result:    tx.Result,
+				Timestamp: tx.Timestamp.UTC(),
+				Duration:  float64(tx.Duration) / float64(time.Millisecond),
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(out)
+	})
+}
+
+type debugResponse struct {
+	RecentTransactions []debugTransaction `json:"recent_transactions"`
+}
+
+type debugTransaction struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	Result    string    `json:"result,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	Duration  float64   `json:"duration_ms"`
+}
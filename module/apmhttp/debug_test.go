@@ -0,0 +1,57 @@
+package apmhttp_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go/module/apmhttp"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestDebugHandler(t *testing.T) {
+	tracer, _ := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetRecentTransactions(10)
+
+	tx := tracer.StartTransaction("GET /foo", "request")
+	tx.Result = "HTTP 2xx"
+	tx.Duration = 1500 * time.Microsecond
+	id := tx.ID()
+	tx.End()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://server.testing/debug/apm", nil)
+	apmhttp.DebugHandler(tracer).ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var out struct {
+		RecentTransactions []map[string]interface{} `json:"recent_transactions"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &out))
+	require.Len(t, out.RecentTransactions, 1)
+	recent := out.RecentTransactions[0]
+	assert.Equal(t, id, recent["id"])
+	assert.Equal(t, "GET /foo", recent["name"])
+	assert.Equal(t, "request", recent["type"])
+	assert.Equal(t, "HTTP 2xx", recent["result"])
+	assert.Equal(t, 1.5, recent["duration_ms"])
+	assert.Contains(t, recent, "timestamp")
+}
+
+func TestDebugHandlerMethodNotAllowed(t *testing.T) {
+	tracer, _ := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "http://server.testing/debug/apm", nil)
+	apmhttp.DebugHandler(tracer).ServeHTTP(w, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "GET, HEAD", w.Header().Get("Allow"))
+}
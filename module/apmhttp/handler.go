@@ -3,28 +3,43 @@ package apmhttp
 import (
 	"context"
 	"net/http"
+	"strings"
 
 	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/instrumentation"
 )
 
+// ForceSampleHeader is the name of the request header which, if its value
+// matches the tracer's force-sample secret, causes the request's transaction
+// to be sampled regardless of the sampling rate. See
+// elasticapm.Tracer.SetForceSampleSecret.
+const ForceSampleHeader = instrumentation.ForceSampleKey
+
 // Wrap returns an http.Handler wrapping h, reporting each request as
 // a transaction to Elastic APM.
 //
-// By default, the returned Handler will use elasticapm.DefaultTracer.
-// Use WithTracer to specify an alternative tracer.
+// By default, the returned Handler will use the tracer returned by
+// elasticapm.TracerFromContext for each request's context, which is
+// elasticapm.DefaultTracer unless another tracer has been selected,
+// e.g. by earlier middleware using elasticapm.ContextWithTracer. Use
+// WithTracer to specify a fixed tracer.
 //
 // By default, the returned Handler will recover panics, reporting
 // them to the configured tracer. To override this behaviour, use
 // WithRecovery.
+//
+// By default, CORS preflight requests and requests for static assets
+// are not traced; see DefaultIgnoreRules. To override this behaviour,
+// use WithServerIgnoreRules.
 func Wrap(h http.Handler, o ...ServerOption) http.Handler {
 	if h == nil {
 		panic("h == nil")
 	}
 	handler := &handler{
 		handler:        h,
-		tracer:         elasticapm.DefaultTracer,
 		requestName:    ServerRequestName,
 		requestIgnorer: ignoreNone,
+		ignoreRules:    DefaultIgnoreRules(),
 	}
 	for _, o := range o {
 		o(handler)
@@ -44,42 +59,79 @@ type handler struct {
 	recovery       RecoveryFunc
 	requestName    RequestNameFunc
 	requestIgnorer RequestIgnorerFunc
+	ignoreRules    IgnoreRules
+	captureBody    elasticapm.CaptureBodyFunc
+
+	captureTrailers bool
+	serverTiming    bool
 }
 
 // ServeHTTP delegates to h.Handler, tracing the transaction with
-// h.Tracer, or elasticapm.DefaultTracer if h.Tracer is nil.
+// h.Tracer, or the tracer in the request context if h.Tracer is nil.
 func (h *handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	if !h.tracer.Active() || h.requestIgnorer(req) {
+	tracer := h.tracer
+	if tracer == nil {
+		tracer = elasticapm.TracerFromContext(req.Context())
+	}
+	if !tracer.Active() || h.ignoreRules.Ignore(req) || h.requestIgnorer(req) {
 		h.handler.ServeHTTP(w, req)
 		return
 	}
-	tx := h.tracer.StartTransaction(h.requestName(req), "request")
+	tx := StartTransaction(tracer, h.requestName(req), req)
 	ctx := elasticapm.ContextWithTransaction(req.Context(), tx)
+	if b := elasticapm.ParseBaggage(req.Header.Get(instrumentation.BaggageKey)); len(b) != 0 {
+		ctx = elasticapm.ContextWithBaggage(ctx, b)
+	}
 	req = RequestWithContext(ctx, req)
 	defer tx.End()
 
 	finished := false
-	body := h.tracer.CaptureHTTPRequestBody(req)
-	w, resp := WrapResponseWriter(w)
+	body := tracer.CaptureHTTPRequestBodyFunc(req, h.captureBody)
+	var beforeWriteHeader func(http.Header)
+	if h.serverTiming {
+		beforeWriteHeader = func(header http.Header) {
+			addServerTimingHeader(header, tx)
+		}
+	}
+	w, resp := wrapResponseWriter(w, beforeWriteHeader)
 	defer func() {
 		if v := recover(); v != nil {
 			h.recovery(w, req, body, tx, v)
 			finished = true
 		}
 		SetTransactionContext(tx, req, resp, body, finished)
+		if h.captureTrailers && tx.Sampled() {
+			tx.Context.SetHTTPRequestTrailers(req.Trailer)
+			tx.Context.SetHTTPResponseTrailers(ResponseTrailers(resp.Headers))
+		}
 	}()
 	h.handler.ServeHTTP(w, req)
 	finished = true
 }
 
-// SetTransactionContext sets tx.Result and, if the transaction is being
-// sampled, sets tx.Context with information from req, resp, and finished.
+// StartTransaction starts a transaction with the given name for req,
+// with type "request". If req has a ForceSampleHeader header matching
+// the tracer's force-sample secret, the transaction will be sampled
+// regardless of the tracer's sampler.
+func StartTransaction(tracer *elasticapm.Tracer, name string, req *http.Request) *elasticapm.Transaction {
+	return instrumentation.StartTransaction(
+		tracer, name, instrumentation.TransactionTypeRequest,
+		instrumentation.HTTPHeaderCarrier(req.Header),
+	)
+}
+
+// SetTransactionContext sets tx.Result using Transaction.SetResult and,
+// if the transaction is being sampled, sets tx.Context with information
+// from req, resp, and finished.
 //
 // The finished property indicates that the response was not completely
 // written, e.g. because the handler panicked and we did not recover the
 // panic.
 func SetTransactionContext(tx *elasticapm.Transaction, req *http.Request, resp *Response, body *elasticapm.BodyCapturer, finished bool) {
-	tx.Result = StatusCodeResult(resp.StatusCode)
+	tx.SetResult(elasticapm.ResultInfo{
+		Result:     StatusCodeResult(resp.StatusCode),
+		StatusCode: resp.StatusCode,
+	})
 	if !tx.Sampled() {
 		return
 	}
@@ -112,12 +164,20 @@ func SetTransactionContext(tx *elasticapm.Transaction, req *http.Request, resp *
 // The returned http.ResponseWriter implements http.Pusher and http.Hijacker
 // if and only if the provided http.ResponseWriter does.
 func WrapResponseWriter(w http.ResponseWriter) (http.ResponseWriter, *Response) {
+	return wrapResponseWriter(w, nil)
+}
+
+// wrapResponseWriter is like WrapResponseWriter, additionally calling
+// beforeWriteHeader, if non-nil, with the response headers just before
+// they are written.
+func wrapResponseWriter(w http.ResponseWriter, beforeWriteHeader func(http.Header)) (http.ResponseWriter, *Response) {
 	rw := responseWriter{
 		ResponseWriter: w,
 		resp: Response{
 			StatusCode: http.StatusOK,
 			Headers:    w.Header(),
 		},
+		beforeWriteHeader: beforeWriteHeader,
 	}
 	h, _ := w.(http.Hijacker)
 	p, _ := w.(http.Pusher)
@@ -145,6 +205,35 @@ func WrapResponseWriter(w http.ResponseWriter) (http.ResponseWriter, *Response)
 	return &rw, &rw.resp
 }
 
+// ResponseTrailers returns the trailers set in the server response
+// headers h, which must be inspected only after the handler has returned.
+// Trailers may be declared up front with the "Trailer" header, or set
+// using keys prefixed with http.TrailerPrefix.
+func ResponseTrailers(h http.Header) http.Header {
+	var trailers http.Header
+	add := func(k string, v []string) {
+		if len(v) == 0 {
+			return
+		}
+		if trailers == nil {
+			trailers = make(http.Header)
+		}
+		trailers[http.CanonicalHeaderKey(k)] = v
+	}
+	for _, declared := range h["Trailer"] {
+		for _, k := range strings.Split(declared, ",") {
+			k = http.CanonicalHeaderKey(strings.TrimSpace(k))
+			add(k, h[k])
+		}
+	}
+	for k, v := range h {
+		if strings.HasPrefix(k, http.TrailerPrefix) {
+			add(k[len(http.TrailerPrefix):], v)
+		}
+	}
+	return trailers
+}
+
 // Response records details of the HTTP response.
 type Response struct {
 	// StatusCode records the HTTP status code set via WriteHeader.
@@ -160,12 +249,26 @@ type Response struct {
 type responseWriter struct {
 	http.ResponseWriter
 	resp Response
+
+	// beforeWriteHeader, if non-nil, is called with the
+	// response headers the first time they may be written.
+	beforeWriteHeader func(http.Header)
+}
+
+// writingHeader calls w.beforeWriteHeader, if it has not already
+// been called.
+func (w *responseWriter) writingHeader() {
+	if w.beforeWriteHeader != nil {
+		w.beforeWriteHeader(w.ResponseWriter.Header())
+		w.beforeWriteHeader = nil
+	}
 }
 
 // WriteHeader sets w.resp.StatusCode, and w.resp.HeadersWritten if there
 // are any headers set on the ResponseWriter, and calls through to the
 // embedded ResponseWriter.
 func (w *responseWriter) WriteHeader(statusCode int) {
+	w.writingHeader()
 	w.ResponseWriter.WriteHeader(statusCode)
 	w.resp.StatusCode = statusCode
 	w.resp.HeadersWritten = len(w.ResponseWriter.Header()) != 0
@@ -174,6 +277,7 @@ func (w *responseWriter) WriteHeader(statusCode int) {
 // Write sets w.resp.HeadersWritten if there are any headers set on the
 // ResponseWriter, and calls through to the embedded ResponseWriter.
 func (w *responseWriter) Write(data []byte) (int, error) {
+	w.writingHeader()
 	n, err := w.ResponseWriter.Write(data)
 	w.resp.HeadersWritten = len(w.ResponseWriter.Header()) != 0
 	return n, err
@@ -192,6 +296,7 @@ func (w *responseWriter) CloseNotify() <-chan bool {
 // it does nothing.
 func (w *responseWriter) Flush() {
 	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.writingHeader()
 		flusher.Flush()
 	}
 }
@@ -241,8 +346,32 @@ func WithRecovery(r RecoveryFunc) ServerOption {
 	}
 }
 
+// WithServerTrailers returns a ServerOption which enables capturing of
+// HTTP request and response trailers in the transaction context. This is
+// useful for debugging protocols that rely on trailers, such as gRPC over
+// HTTP/2. The HTTP protocol version is always recorded for sampled
+// transactions; HTTP/2 stream IDs are not exposed by net/http, and so
+// cannot be recorded.
+func WithServerTrailers() ServerOption {
+	return func(h *handler) {
+		h.captureTrailers = true
+	}
+}
+
+// WithServerCaptureBody returns a ServerOption which sets f as the function
+// to use to decide whether or not to capture the body of a server request,
+// overriding the tracer's configured capture mode. This can be used to
+// capture bodies only for specific endpoints or content types, or when
+// a debug header is present. If f is nil, the tracer's configured capture
+// mode is used.
+func WithServerCaptureBody(f elasticapm.CaptureBodyFunc) ServerOption {
+	return func(h *handler) {
+		h.captureBody = f
+	}
+}
+
 // RequestNameFunc is the type of a function for use in
-// WithServerRequestName.
+// WithServerRequestName and WithClientRequestName.
 type RequestNameFunc func(*http.Request) string
 
 // WithServerRequestName returns a ServerOption which sets r as the function
@@ -1,8 +1,11 @@
 package apmhttp_test
 
 import (
+	"bytes"
 	"crypto/tls"
 	"io"
+	"math/rand"
+	"mime/multipart"
 	"net"
 	"net/http"
 	"net/http/httptest"
@@ -10,6 +13,7 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -132,7 +136,38 @@ func TestHandlerHTTP2(t *testing.T) {
 	}, transaction.Context)
 }
 
+func TestHandlerTrailers(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	h := apmhttp.Wrap(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("Trailer", "Grpc-Status")
+			w.Write([]byte("bar"))
+			w.Header().Set("Grpc-Status", "0")
+			w.Header().Set(http.TrailerPrefix+"Grpc-Message", "ok")
+		}),
+		apmhttp.WithTracer(tracer),
+		apmhttp.WithServerTrailers(),
+	)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://server.testing/foo", nil)
+	req.Trailer = http.Header{"Checksum": []string{"abc"}}
+	h.ServeHTTP(w, req)
+	tracer.Flush(nil)
+
+	tx := transport.Payloads()[0].Transactions()[0]
+	assert.Equal(t, http.Header{"Checksum": []string{"abc"}}, tx.Context.Request.Trailers)
+	assert.Equal(t, http.Header{
+		"Grpc-Status":  []string{"0"},
+		"Grpc-Message": []string{"ok"},
+	}, tx.Context.Response.Trailers)
+}
+
 func TestHandlerCaptureBodyRaw(t *testing.T) {
+	if !elasticapm.BodyCaptureEnabled {
+		t.Skip("body capture is compiled out")
+	}
 	tracer, transport := transporttest.NewRecorderTracer()
 	defer tracer.Close()
 
@@ -146,6 +181,9 @@ func TestHandlerCaptureBodyRaw(t *testing.T) {
 }
 
 func TestHandlerCaptureBodyForm(t *testing.T) {
+	if !elasticapm.BodyCaptureEnabled {
+		t.Skip("body capture is compiled out")
+	}
 	tracer, transport := transporttest.NewRecorderTracer()
 	defer tracer.Close()
 
@@ -166,7 +204,61 @@ func TestHandlerCaptureBodyForm(t *testing.T) {
 	}, tx.Context.Request.Body)
 }
 
+func TestHandlerCaptureBodyMultipartForm(t *testing.T) {
+	if !elasticapm.BodyCaptureEnabled {
+		t.Skip("body capture is compiled out")
+	}
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	tracer.SetCaptureBody(elasticapm.CaptureBodyTransactions)
+	var form *multipart.Form
+	h := apmhttp.Wrap(
+		http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+			if err := req.ParseMultipartForm(1024); err != nil {
+				panic(err)
+			}
+			form = req.MultipartForm
+		}),
+		apmhttp.WithTracer(tracer),
+	)
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("name", "gopher")
+	mw.WriteField("password", "hunter2")
+	fw, _ := mw.CreateFormFile("upload", "gopher.png")
+	fw.Write(make([]byte, 4096))
+	mw.Close()
+
+	req, _ := http.NewRequest("POST", "http://server.testing/foo", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	// The file exceeds the handler's memory limit, so it is stored in
+	// a temporary file, which http.Server would otherwise remove.
+	defer form.RemoveAll()
+	tracer.Flush(nil)
+
+	tx := transport.Payloads()[0].Transactions()[0]
+	assert.Equal(t, &model.RequestBody{
+		Form: url.Values{
+			"name":     []string{"gopher"},
+			"password": []string{"[REDACTED]"},
+		},
+		Files: map[string][]model.RequestBodyFile{
+			"upload": {{
+				Filename:    "gopher.png",
+				Size:        4096,
+				ContentType: "application/octet-stream",
+			}},
+		},
+	}, tx.Context.Request.Body)
+}
+
 func TestHandlerCaptureBodyError(t *testing.T) {
+	if !elasticapm.BodyCaptureEnabled {
+		t.Skip("body capture is compiled out")
+	}
 	tracer, transport := transporttest.NewRecorderTracer()
 	defer tracer.Close()
 
@@ -192,6 +284,41 @@ func TestHandlerCaptureBodyErrorIgnored(t *testing.T) {
 	assert.Nil(t, e.Context.Request.Body) // only capturing for transactions
 }
 
+func TestHandlerCaptureBodyFunc(t *testing.T) {
+	if !elasticapm.BodyCaptureEnabled {
+		t.Skip("body capture is compiled out")
+	}
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	// Body capture is disabled by default, but
+	// enabled for requests with X-Debug set.
+	h := apmhttp.Wrap(
+		http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}),
+		apmhttp.WithTracer(tracer),
+		apmhttp.WithServerCaptureBody(func(req *http.Request, mode elasticapm.CaptureBodyMode) elasticapm.CaptureBodyMode {
+			assert.Equal(t, elasticapm.CaptureBodyOff, mode)
+			if req.Header.Get("X-Debug") != "" {
+				return elasticapm.CaptureBodyTransactions
+			}
+			return mode
+		}),
+	)
+	for _, debug := range []bool{false, true} {
+		req, _ := http.NewRequest("POST", "http://server.testing/foo", strings.NewReader("foo"))
+		if debug {
+			req.Header.Set("X-Debug", "1")
+		}
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	tracer.Flush(nil)
+
+	transactions := transport.Payloads()[0].Transactions()
+	require.Len(t, transactions, 2)
+	assert.Nil(t, transactions[0].Context.Request.Body)
+	assert.Equal(t, &model.RequestBody{Raw: "foo"}, transactions[1].Context.Request.Body)
+}
+
 func testPostTransaction(h http.Handler, tracer *elasticapm.Tracer, transport *transporttest.RecorderTransport, body io.Reader) model.Transaction {
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("POST", "http://server.testing/foo", body)
@@ -228,7 +355,10 @@ func TestHandlerRecovery(t *testing.T) {
 	error0 := payloads[0].Errors()[0]
 	transaction := payloads[1].Transactions()[0]
 
-	assert.Equal(t, "panicHandler", error0.Culprit)
+	if elasticapm.StacktraceEnabled {
+		// The culprit is derived from the stack trace.
+		assert.Equal(t, "panicHandler", error0.Culprit)
+	}
 	assert.Equal(t, "foo", error0.Exception.Message)
 
 	true_ := true
@@ -238,6 +368,34 @@ func TestHandlerRecovery(t *testing.T) {
 	}, transaction.Context.Response)
 }
 
+func TestHandlerContextTracer(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	h := apmhttp.Wrap(http.HandlerFunc(panicHandler))
+	selectTracer := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := elasticapm.ContextWithTracer(req.Context(), tracer)
+		h.ServeHTTP(w, req.WithContext(ctx))
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://server.testing/foo", nil)
+	selectTracer.ServeHTTP(w, req)
+	tracer.Flush(nil)
+
+	var errors, transactions int
+	for _, p := range transport.Payloads() {
+		switch p.Value.(type) {
+		case *model.ErrorsPayload:
+			errors += len(p.Errors())
+		case *model.TransactionsPayload:
+			transactions += len(p.Transactions())
+		}
+	}
+	assert.Equal(t, 1, errors)
+	assert.Equal(t, 1, transactions)
+}
+
 func TestHandlerRequestIgnorer(t *testing.T) {
 	tracer, transport := transporttest.NewRecorderTracer()
 	defer tracer.Close()
@@ -257,7 +415,112 @@ func TestHandlerRequestIgnorer(t *testing.T) {
 	assert.Empty(t, transport.Payloads())
 }
 
+func TestHandlerIgnoreRules(t *testing.T) {
+	newRequests := func() []*http.Request {
+		preflight, _ := http.NewRequest("OPTIONS", "http://server.testing/api/users", nil)
+		preflight.Header.Set("Origin", "http://client.testing")
+		preflight.Header.Set("Access-Control-Request-Method", "POST")
+		options, _ := http.NewRequest("OPTIONS", "http://server.testing/api/users", nil)
+		stylesheet, _ := http.NewRequest("GET", "http://server.testing/static/site.CSS", nil)
+		api, _ := http.NewRequest("GET", "http://server.testing/api/users", nil)
+		return []*http.Request{preflight, options, stylesheet, api}
+	}
+	transactionNames := func(opts ...apmhttp.ServerOption) []string {
+		tracer, transport := transporttest.NewRecorderTracer()
+		defer tracer.Close()
+		h := apmhttp.Wrap(http.NotFoundHandler(), append(opts, apmhttp.WithTracer(tracer))...)
+		for _, req := range newRequests() {
+			h.ServeHTTP(httptest.NewRecorder(), req)
+		}
+		tracer.Flush(nil)
+		var names []string
+		for _, tx := range transport.Payloads()[0].Transactions() {
+			names = append(names, tx.Name)
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{"OPTIONS /api/users", "GET /api/users"}, transactionNames())
+	assert.Equal(t, []string{
+		"OPTIONS /api/users", "OPTIONS /api/users", "GET /static/site.CSS", "GET /api/users",
+	}, transactionNames(apmhttp.WithServerIgnoreRules(apmhttp.IgnoreRules{})))
+}
+
 func panicHandler(w http.ResponseWriter, req *http.Request) {
 	w.WriteHeader(http.StatusTeapot)
 	panic("foo")
 }
+
+func TestHandlerForceSample(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetSampler(elasticapm.NewRatioSampler(0, rand.NewSource(0)))
+	tracer.SetForceSampleSecret("sesame")
+
+	h := apmhttp.Wrap(http.NotFoundHandler(), apmhttp.WithTracer(tracer))
+	for _, secret := range []string{"", "wrong", "sesame"} {
+		req, _ := http.NewRequest("GET", "http://server.testing/foo", nil)
+		if secret != "" {
+			req.Header.Set(apmhttp.ForceSampleHeader, secret)
+		}
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	tracer.Flush(nil)
+
+	transactions := transport.Payloads()[0].Transactions()
+	require.Len(t, transactions, 3)
+	assert.False(t, *transactions[0].Sampled)
+	assert.False(t, *transactions[1].Sampled)
+	assert.Nil(t, transactions[2].Sampled)
+	assert.NotNil(t, transactions[2].Context)
+}
+
+func TestHandlerServerTiming(t *testing.T) {
+	tracer, err := elasticapm.NewTracer("apmhttp_test", "")
+	require.NoError(t, err)
+	defer tracer.Close()
+	tracer.Transport = transporttest.Discard
+
+	var txID string
+	h := apmhttp.Wrap(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			txID = elasticapm.TransactionFromContext(req.Context()).ID()
+			w.Header().Set("Server-Timing", "db;dur=1")
+			w.Write([]byte("bar"))
+		}),
+		apmhttp.WithTracer(tracer),
+		apmhttp.WithServerTiming(),
+	)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://server.testing/foo", nil)
+	h.ServeHTTP(w, req)
+
+	values := w.HeaderMap["Server-Timing"]
+	require.Len(t, values, 2)
+	assert.Equal(t, "db;dur=1", values[0])
+	assert.Regexp(t, `^transaction;desc="`+txID+`", app;dur=\d+\.\d{3}$`, values[1])
+}
+
+func TestHandlerServerTimingClock(t *testing.T) {
+	tracer, err := elasticapm.NewTracer("apmhttp_test", "")
+	require.NoError(t, err)
+	defer tracer.Close()
+	tracer.Transport = transporttest.Discard
+
+	now := time.Unix(0, 0)
+	tracer.SetClock(elasticapm.ClockFunc(func() time.Time { return now }))
+
+	h := apmhttp.Wrap(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			now = now.Add(1500 * time.Microsecond)
+			w.Write([]byte("bar"))
+		}),
+		apmhttp.WithTracer(tracer),
+		apmhttp.WithServerTiming(),
+	)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://server.testing/foo", nil)
+	h.ServeHTTP(w, req)
+
+	assert.Regexp(t, `, app;dur=1\.500$`, w.HeaderMap.Get("Server-Timing"))
+}
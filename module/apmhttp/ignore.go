@@ -0,0 +1,68 @@
+package apmhttp
+
+import (
+	"net/http"
+	"path"
+	"strings"
+)
+
+// IgnoreRules holds built-in rules for ignoring server requests, shared
+// by the HTTP framework modules: apmhttp, apmgin, apmecho, apmgorilla,
+// apmhttprouter, and apmbuffalo. Ignored requests are not traced.
+//
+// The rules apply in addition to any request ignorer function, e.g. as
+// set with WithServerRequestIgnorer. By default, DefaultIgnoreRules are
+// used; to trace all requests, use the zero value.
+type IgnoreRules struct {
+	// Preflight controls whether CORS preflight requests, i.e.
+	// OPTIONS requests with an Access-Control-Request-Method
+	// header, are ignored. Browsers send a preflight request
+	// before many cross-origin requests, so preflight requests
+	// may otherwise dominate the number of transactions.
+	Preflight bool
+
+	// StaticExtensions holds the file extensions of static assets,
+	// including the leading '.', e.g. ".css". Requests whose path
+	// has one of the extensions, compared case-insensitively, are
+	// ignored.
+	StaticExtensions []string
+}
+
+// DefaultIgnoreRules returns the IgnoreRules used by default, which
+// ignore CORS preflight requests, and requests for common stylesheet,
+// script, image, and font files.
+func DefaultIgnoreRules() IgnoreRules {
+	return IgnoreRules{
+		Preflight: true,
+		StaticExtensions: []string{
+			".css", ".js", ".map",
+			".gif", ".ico", ".jpeg", ".jpg", ".png", ".svg", ".webp",
+			".eot", ".otf", ".ttf", ".woff", ".woff2",
+		},
+	}
+}
+
+// Ignore reports whether req should be ignored according to the rules.
+func (r IgnoreRules) Ignore(req *http.Request) bool {
+	if r.Preflight && req.Method == http.MethodOptions && req.Header.Get("Access-Control-Request-Method") != "" {
+		return true
+	}
+	if len(r.StaticExtensions) != 0 {
+		if ext := path.Ext(req.URL.Path); ext != "" {
+			for _, static := range r.StaticExtensions {
+				if strings.EqualFold(ext, static) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// WithServerIgnoreRules returns a ServerOption which sets the built-in
+// rules for ignoring server requests, overriding DefaultIgnoreRules.
+func WithServerIgnoreRules(rules IgnoreRules) ServerOption {
+	return func(h *handler) {
+		h.ignoreRules = rules
+	}
+}
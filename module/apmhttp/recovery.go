@@ -18,12 +18,10 @@ type RecoveryFunc func(
 // NewTraceRecovery returns a RecoveryFunc for use in WithRecovery.
 //
 // The returned RecoveryFunc will report recovered error to Elastic APM
-// using the given Tracer, or elasticapm.DefaultTracer if t is nil. The
-// error will be linked to the given transaction.
+// using the given Tracer, or if t is nil, the tracer returned by
+// elasticapm.TracerFromContext for the request's context. The error
+// will be linked to the given transaction.
 func NewTraceRecovery(t *elasticapm.Tracer) RecoveryFunc {
-	if t == nil {
-		t = elasticapm.DefaultTracer
-	}
 	return func(
 		w http.ResponseWriter,
 		req *http.Request,
@@ -31,7 +29,11 @@ func NewTraceRecovery(t *elasticapm.Tracer) RecoveryFunc {
 		tx *elasticapm.Transaction,
 		recovered interface{},
 	) {
-		e := t.Recovered(recovered, tx)
+		tracer := t
+		if tracer == nil {
+			tracer = elasticapm.TracerFromContext(req.Context())
+		}
+		e := tracer.Recovered(recovered, tx)
 		e.Context.SetHTTPRequest(req)
 		e.Context.SetHTTPRequestBody(body)
 		e.Send()
@@ -0,0 +1,170 @@
+package apmhttp
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/apm-agent-go"
+)
+
+// maxServerTimingMetrics is the maximum number of Server-Timing
+// metrics recorded for a client span.
+const maxServerTimingMetrics = 16
+
+// WithClientServerTiming returns a ClientOption which enables recording
+// of the metrics in the "Server-Timing" response header as client span
+// tags. This allows downstream services which are not instrumented, but
+// which report Server-Timing metrics, to contribute to traces.
+//
+// Each metric is recorded as a tag named "server_timing_<name>", with
+// the metric's duration in milliseconds as its value, or if the metric
+// has no duration, its description. At most 16 metrics are recorded
+// for each span.
+func WithClientServerTiming() ClientOption {
+	return func(rt *roundTripper) {
+		rt.captureServerTiming = true
+	}
+}
+
+// setServerTimingTags sets tags on span for the Server-Timing
+// metrics in the response header h.
+func setServerTimingTags(span *elasticapm.Span, h http.Header) {
+	values := h[http.CanonicalHeaderKey("Server-Timing")]
+	if len(values) == 0 {
+		return
+	}
+	for i, m := range parseServerTiming(values) {
+		if i == maxServerTimingMetrics {
+			break
+		}
+		value := m.desc
+		if m.dur != "" {
+			value = m.dur
+		}
+		span.Context.SetTag("server_timing_"+serverTimingTagKey(m.name), value)
+	}
+}
+
+// WithServerTiming returns a ServerOption which adds a "Server-Timing"
+// header to each traced response, so that browser developer tools and
+// upstream callers can correlate responses with their transactions
+// without the RUM agent.
+//
+// The header holds a "transaction" metric, whose description is the
+// transaction ID, and an "app" metric, whose duration is the time in
+// milliseconds between the start of the transaction and the writing
+// of the response headers. Any Server-Timing header values set by the
+// wrapped handler are retained.
+func WithServerTiming() ServerOption {
+	return func(h *handler) {
+		h.serverTiming = true
+	}
+}
+
+// addServerTimingHeader adds Server-Timing metrics for tx to the
+// response header h, which is about to be written.
+func addServerTimingHeader(h http.Header, tx *elasticapm.Transaction) {
+	dur := float64(tx.Elapsed()) / float64(time.Millisecond)
+	h.Add("Server-Timing", `transaction;desc="`+tx.ID()+`", app;dur=`+strconv.FormatFloat(dur, 'f', 3, 64))
+}
+
+type serverTimingMetric struct {
+	name string
+	dur  string
+	desc string
+}
+
+// parseServerTiming parses Server-Timing header values, as defined
+// by https://www.w3.org/TR/server-timing/. Metrics with invalid
+// durations have their durations ignored.
+func parseServerTiming(values []string) []serverTimingMetric {
+	var metrics []serverTimingMetric
+	for _, value := range values {
+		for _, entry := range splitQuoted(value, ',') {
+			params := splitQuoted(entry, ';')
+			m := serverTimingMetric{name: strings.TrimSpace(params[0])}
+			if m.name == "" {
+				continue
+			}
+			for _, param := range params[1:] {
+				i := strings.IndexRune(param, '=')
+				if i < 0 {
+					continue
+				}
+				key := strings.ToLower(strings.TrimSpace(param[:i]))
+				paramValue := unquote(strings.TrimSpace(param[i+1:]))
+				switch key {
+				case "dur":
+					if m.dur != "" {
+						continue
+					}
+					if _, err := strconv.ParseFloat(paramValue, 64); err == nil {
+						m.dur = paramValue
+					}
+				case "desc":
+					if m.desc == "" {
+						m.desc = paramValue
+					}
+				}
+			}
+			metrics = append(metrics, m)
+		}
+	}
+	return metrics
+}
+
+// splitQuoted splits s on sep, ignoring separators
+// within double-quoted strings.
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+	var quoted, escaped bool
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case escaped:
+			escaped = false
+		case quoted && c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case !quoted && c == sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// unquote returns s without surrounding double quotes,
+// and with backslash escapes removed.
+func unquote(s string) string {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return s
+	}
+	s = s[1 : len(s)-1]
+	if strings.IndexByte(s, '\\') < 0 {
+		return s
+	}
+	out := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		out = append(out, s[i])
+	}
+	return string(out)
+}
+
+// serverTimingTagKey returns name with characters
+// not permitted in tag keys replaced with '_'.
+func serverTimingTagKey(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', '*', '"':
+			return '_'
+		}
+		return r
+	}, name)
+}
@@ -0,0 +1,81 @@
+package apmhttp
+
+import (
+	"encoding/xml"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// maxSOAPEnvelopePeek is the maximum number of bytes of a SOAP request
+// body that SOAPClientRequestName will read when searching for the
+// operation name.
+const maxSOAPEnvelopePeek = 4096
+
+// SOAPClientRequestName returns the span name for the SOAP client
+// request, req, for use with WithClientRequestName. Requests to a SOAP
+// service are all sent to the same endpoint, so naming spans by URL
+// would collapse all operations into a single span name.
+//
+// The span name is "SOAP <operation>", where the operation is taken from
+// the first of:
+//   - the SOAPAction header (SOAP 1.1)
+//   - the "action" parameter of the Content-Type header (SOAP 1.2)
+//   - the first element within the envelope's Body element
+//
+// The envelope is only parsed if the request's GetBody field is set,
+// as it is by http.NewRequest for in-memory bodies, so the request body
+// is never consumed. If the operation cannot be determined, the name
+// returned by ClientRequestName is used.
+func SOAPClientRequestName(req *http.Request) string {
+	operation := soapActionOperation(req.Header.Get("SOAPAction"))
+	if operation == "" {
+		if _, params, err := mime.ParseMediaType(req.Header.Get("Content-Type")); err == nil {
+			operation = soapActionOperation(params["action"])
+		}
+	}
+	if operation == "" && req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			operation = soapEnvelopeOperation(io.LimitReader(body, maxSOAPEnvelopePeek))
+			body.Close()
+		}
+	}
+	if operation == "" {
+		return ClientRequestName(req)
+	}
+	return "SOAP " + operation
+}
+
+// soapActionOperation returns the operation name from a SOAP action
+// URI, which is typically of the form "http://example.com/Service/Op"
+// or "urn:example#Op", optionally quoted.
+func soapActionOperation(action string) string {
+	action = strings.Trim(strings.TrimSpace(action), `"`)
+	if i := strings.LastIndexAny(action, "/#:"); i >= 0 {
+		action = action[i+1:]
+	}
+	return action
+}
+
+// soapEnvelopeOperation returns the local name of the first element
+// within the SOAP envelope's Body element, or the empty string if it
+// cannot be found.
+func soapEnvelopeOperation(r io.Reader) string {
+	decoder := xml.NewDecoder(r)
+	var inBody bool
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return ""
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if inBody {
+			return start.Name.Local
+		}
+		inBody = start.Name.Local == "Body"
+	}
+}
@@ -0,0 +1,79 @@
+package apmhttp_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/module/apmhttp"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+const soapEnvelope = `<?xml version="1.0"?>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+  <soap:Header><auth:Token xmlns:auth="urn:auth">secret</auth:Token></soap:Header>
+  <soap:Body><m:GetStockPrice xmlns:m="urn:stocks"><m:Symbol>ELST</m:Symbol></m:GetStockPrice></soap:Body>
+</soap:Envelope>`
+
+func TestSOAPClientRequestName(t *testing.T) {
+	newRequest := func(body string) *http.Request {
+		req, err := http.NewRequest("POST", "http://soap.example/service", strings.NewReader(body))
+		require.NoError(t, err)
+		return req
+	}
+
+	req := newRequest("")
+	req.Header.Set("SOAPAction", `"http://soap.example/Stocks/GetStockPrice"`)
+	assert.Equal(t, "SOAP GetStockPrice", apmhttp.SOAPClientRequestName(req))
+
+	req = newRequest("")
+	req.Header.Set("SOAPAction", `"urn:stocks#GetStockQuote"`)
+	assert.Equal(t, "SOAP GetStockQuote", apmhttp.SOAPClientRequestName(req))
+
+	req = newRequest("")
+	req.Header.Set("Content-Type", `application/soap+xml; charset=utf-8; action="urn:stocks:GetStockVolume"`)
+	assert.Equal(t, "SOAP GetStockVolume", apmhttp.SOAPClientRequestName(req))
+
+	req = newRequest(soapEnvelope)
+	req.Header.Set("SOAPAction", `""`)
+	assert.Equal(t, "SOAP GetStockPrice", apmhttp.SOAPClientRequestName(req))
+
+	req = newRequest("not xml")
+	assert.Equal(t, "POST soap.example", apmhttp.SOAPClientRequestName(req))
+}
+
+func TestClientSOAPRequestName(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		data, err := ioutil.ReadAll(req.Body)
+		assert.NoError(t, err)
+		body = string(data)
+	}))
+	defer server.Close()
+
+	tx := tracer.StartTransaction("name", "type")
+	ctx := elasticapm.ContextWithTransaction(context.Background(), tx)
+	client := apmhttp.WrapClient(nil, apmhttp.WithClientRequestName(apmhttp.SOAPClientRequestName))
+	req, err := http.NewRequest("POST", server.URL, strings.NewReader(soapEnvelope))
+	require.NoError(t, err)
+	resp, err := client.Do(req.WithContext(ctx))
+	require.NoError(t, err)
+	resp.Body.Close()
+	tx.End()
+	tracer.Flush(nil)
+
+	assert.Equal(t, soapEnvelope, body) // body must not be consumed
+	spans := transport.Payloads()[0].Transactions()[0].Spans
+	require.Len(t, spans, 1)
+	assert.Equal(t, "SOAP GetStockPrice", spans[0].Name)
+}
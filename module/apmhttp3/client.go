@@ -0,0 +1,22 @@
+package apmhttp3
+
+import (
+	"net/http"
+
+	"github.com/quic-go/quic-go/http3"
+
+	"github.com/elastic/apm-agent-go/module/apmhttp"
+)
+
+// WrapTransport returns an http.RoundTripper wrapping t, reporting each
+// HTTP/3 request as a span to Elastic APM, if the request's context
+// contains a sampled transaction, as with apmhttp.WrapRoundTripper.
+//
+// If t is nil, then a new http3.Transport with default configuration
+// is wrapped.
+func WrapTransport(t *http3.Transport, o ...apmhttp.ClientOption) http.RoundTripper {
+	if t == nil {
+		t = &http3.Transport{}
+	}
+	return apmhttp.WrapRoundTripper(t, o...)
+}
@@ -0,0 +1,4 @@
+// Package apmhttp3 provides a tracing middleware http.Handler for
+// HTTP/3 servers, and a tracing http.RoundTripper for HTTP/3 clients,
+// based on github.com/quic-go/quic-go/http3.
+package apmhttp3
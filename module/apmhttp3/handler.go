@@ -0,0 +1,53 @@
+package apmhttp3
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/quic-go/quic-go/http3"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/module/apmhttp"
+)
+
+// Wrap returns an http.Handler wrapping h, reporting each HTTP/3
+// request as a transaction to Elastic APM, as with apmhttp.Wrap.
+//
+// In addition to the context recorded by apmhttp.Wrap, the transaction
+// will be tagged with the transport protocol ("quic") and the negotiated
+// ALPN protocol (e.g. "h3"). If the client's address has changed since
+// the QUIC connection was established, i.e. the connection has migrated,
+// the transaction will be tagged with "quic_migrated" and the client's
+// original address.
+func Wrap(h http.Handler, o ...apmhttp.ServerOption) http.Handler {
+	return apmhttp.Wrap(&handler{handler: h}, o...)
+}
+
+type handler struct {
+	handler http.Handler
+}
+
+// ServeHTTP tags the transaction in req's context, if any,
+// and then delegates to h.handler.
+func (h *handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if tx := elasticapm.TransactionFromContext(req.Context()); tx != nil && tx.Sampled() {
+		setTransactionTags(tx, req)
+	}
+	h.handler.ServeHTTP(w, req)
+}
+
+func setTransactionTags(tx *elasticapm.Transaction, req *http.Request) {
+	tx.Context.SetTag("network_transport", "quic")
+	if req.TLS != nil && req.TLS.NegotiatedProtocol != "" {
+		tx.Context.SetTag("alpn_protocol", req.TLS.NegotiatedProtocol)
+	}
+	// http3.RemoteAddrContextKey holds the client address at the
+	// time the connection was established, whereas req.RemoteAddr
+	// holds the client address at the time the request was received.
+	if initial, ok := req.Context().Value(http3.RemoteAddrContextKey).(net.Addr); ok {
+		if initial.String() != req.RemoteAddr {
+			tx.Context.SetTag("quic_migrated", "true")
+			tx.Context.SetTag("quic_initial_remote_addr", initial.String())
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package apmhttp3_test
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/quic-go/quic-go/http3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/apm-agent-go/module/apmhttp"
+	"github.com/elastic/apm-agent-go/module/apmhttp3"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestHandler(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	h := apmhttp3.Wrap(http.NotFoundHandler(), apmhttp.WithTracer(tracer))
+	req := newHTTP3Request("192.0.2.1:1234", "192.0.2.1:1234")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	tracer.Flush(nil)
+
+	tx := transport.Payloads()[0].Transactions()[0]
+	assert.Equal(t, "GET /foo", tx.Name)
+	assert.Equal(t, "3.0", tx.Context.Request.HTTPVersion)
+	assert.Equal(t, map[string]string{
+		"network_transport": "quic",
+		"alpn_protocol":     "h3",
+	}, tx.Context.Tags)
+}
+
+func TestHandlerConnectionMigration(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	h := apmhttp3.Wrap(http.NotFoundHandler(), apmhttp.WithTracer(tracer))
+	req := newHTTP3Request("192.0.2.1:1234", "198.51.100.1:5678")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	tracer.Flush(nil)
+
+	tx := transport.Payloads()[0].Transactions()[0]
+	assert.Equal(t, "true", tx.Context.Tags["quic_migrated"])
+	assert.Equal(t, "192.0.2.1:1234", tx.Context.Tags["quic_initial_remote_addr"])
+}
+
+// newHTTP3Request returns a request as constructed by http3.Server,
+// for a connection established from initialAddr, and a request
+// received from remoteAddr.
+func newHTTP3Request(initialAddr, remoteAddr string) *http.Request {
+	req, _ := http.NewRequest("GET", "https://server.testing/foo", nil)
+	req.Proto, req.ProtoMajor, req.ProtoMinor = "HTTP/3.0", 3, 0
+	req.RemoteAddr = remoteAddr
+	req.TLS = &tls.ConnectionState{NegotiatedProtocol: http3.NextProtoH3}
+	initial, err := net.ResolveUDPAddr("udp", initialAddr)
+	if err != nil {
+		panic(err)
+	}
+	ctx := context.WithValue(req.Context(), http3.RemoteAddrContextKey, net.Addr(initial))
+	return req.WithContext(ctx)
+}
@@ -12,15 +12,21 @@ import (
 // Wrap wraps h such that it will report requests as transactions
 // to Elastic APM, using route in the transaction name.
 //
-// By default, the returned Handle will use elasticapm.DefaultTracer.
-// Use WithTracer to specify an alternative tracer.
+// By default, the returned Handle will use the tracer returned by
+// elasticapm.TracerFromContext for each request's context, which is
+// elasticapm.DefaultTracer unless another tracer has been selected.
+// Use WithTracer to specify a fixed tracer.
 //
 // By default, the returned Handle will recover panics, reporting
 // them to the configured tracer. To override this behaviour, use
 // WithRecovery.
+//
+// By default, CORS preflight requests and requests for static assets
+// are not traced; see apmhttp.DefaultIgnoreRules. Use WithIgnoreRules
+// to override this behaviour.
 func Wrap(h httprouter.Handle, route string, o ...Option) httprouter.Handle {
 	opts := options{
-		tracer: elasticapm.DefaultTracer,
+		ignoreRules: apmhttp.DefaultIgnoreRules(),
 	}
 	for _, o := range o {
 		o(&opts)
@@ -29,17 +35,21 @@ func Wrap(h httprouter.Handle, route string, o ...Option) httprouter.Handle {
 		opts.recovery = apmhttp.NewTraceRecovery(opts.tracer)
 	}
 	return func(w http.ResponseWriter, req *http.Request, p httprouter.Params) {
-		if !opts.tracer.Active() {
+		tracer := opts.tracer
+		if tracer == nil {
+			tracer = elasticapm.TracerFromContext(req.Context())
+		}
+		if !tracer.Active() || opts.ignoreRules.Ignore(req) {
 			h(w, req, p)
 			return
 		}
-		tx := opts.tracer.StartTransaction(req.Method+" "+route, "request")
+		tx := apmhttp.StartTransaction(tracer, req.Method+" "+route, req)
 		ctx := elasticapm.ContextWithTransaction(req.Context(), tx)
 		req = apmhttp.RequestWithContext(ctx, req)
 		defer tx.End()
 
 		finished := false
-		body := opts.tracer.CaptureHTTPRequestBody(req)
+		body := tracer.CaptureHTTPRequestBody(req)
 		w, resp := apmhttp.WrapResponseWriter(w)
 		defer func() {
 			if v := recover(); v != nil {
@@ -54,8 +64,9 @@ func Wrap(h httprouter.Handle, route string, o ...Option) httprouter.Handle {
 }
 
 type options struct {
-	tracer   *elasticapm.Tracer
-	recovery apmhttp.RecoveryFunc
+	tracer      *elasticapm.Tracer
+	recovery    apmhttp.RecoveryFunc
+	ignoreRules apmhttp.IgnoreRules
 }
 
 // Option sets options for tracing.
@@ -82,3 +93,11 @@ func WithRecovery(r apmhttp.RecoveryFunc) Option {
 		o.recovery = r
 	}
 }
+
+// WithIgnoreRules returns an Option which sets the built-in rules for
+// ignoring requests, overriding apmhttp.DefaultIgnoreRules.
+func WithIgnoreRules(rules apmhttp.IgnoreRules) Option {
+	return func(o *options) {
+		o.ignoreRules = rules
+	}
+}
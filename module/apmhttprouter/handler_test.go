@@ -9,6 +9,7 @@ import (
 	"github.com/julienschmidt/httprouter"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/elastic/apm-agent-go"
 	"github.com/elastic/apm-agent-go/model"
 	"github.com/elastic/apm-agent-go/module/apmhttprouter"
 	"github.com/elastic/apm-agent-go/transport/transporttest"
@@ -92,7 +93,10 @@ func TestRecovery(t *testing.T) {
 	error0 := payloads[0].Errors()[0]
 	transaction := payloads[1].Transactions()[0]
 
-	assert.Equal(t, "panicHandler", error0.Culprit)
+	if elasticapm.StacktraceEnabled {
+		// The culprit is derived from the stack trace.
+		assert.Equal(t, "panicHandler", error0.Culprit)
+	}
 	assert.Equal(t, "foo", error0.Exception.Message)
 
 	true_ := true
@@ -0,0 +1,2 @@
+// Package apmhttputil provides tracing for net/http/httputil.ReverseProxy.
+package apmhttputil
@@ -0,0 +1,199 @@
+package apmhttputil
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/module/apmhttp"
+)
+
+// traceHeaders holds the names of trace context headers which are
+// removed from proxied requests when using StripHeaders.
+var traceHeaders = []string{
+	"Traceparent",
+	"Tracestate",
+	"Elastic-Apm-Traceparent",
+	"Elastic-Apm-Sampling-Priority",
+	"Elastic-Apm-Session-Id",
+	"Baggage",
+}
+
+// HeaderPolicy controls how trace context headers in incoming
+// requests are handled when proxying them upstream.
+type HeaderPolicy int
+
+const (
+	// PropagateHeaders passes trace context headers through
+	// to the upstream server unchanged.
+	PropagateHeaders HeaderPolicy = iota
+
+	// StripHeaders removes trace context headers from requests
+	// before they are sent to the upstream server.
+	StripHeaders
+)
+
+// Upstream error classifications, recorded in the "upstream_error"
+// transaction tag.
+const (
+	UpstreamErrorDial     = "dial"
+	UpstreamErrorTimeout  = "timeout"
+	UpstreamErrorCanceled = "canceled"
+	UpstreamError5xx      = "5xx"
+	UpstreamErrorOther    = "other"
+)
+
+// WrapReverseProxy returns an http.Handler which serves requests using a
+// copy of p, reporting each request as a transaction, and each proxied
+// request as a span within that transaction, to Elastic APM.
+//
+// The proxied request span records the upstream URL and response status
+// code. If the upstream request fails, or the upstream server responds
+// with a 5xx status code, the failure is classified as one of "dial",
+// "timeout", "canceled", "5xx", or "other", and recorded in the
+// transaction tag "upstream_error". Upstream request failures are also
+// reported as errors.
+//
+// By default, the handler will trace with the tracer returned by
+// elasticapm.TracerFromContext for each request's context, and trace
+// context headers will be propagated upstream. Use WithTracer to
+// specify a fixed tracer, and WithHeaderPolicy to strip trace context
+// headers.
+func WrapReverseProxy(p *httputil.ReverseProxy, o ...Option) http.Handler {
+	if p == nil {
+		panic("p == nil")
+	}
+	var opts options
+	for _, o := range o {
+		o(&opts)
+	}
+
+	proxy := *p
+	if opts.headerPolicy == StripHeaders {
+		director := proxy.Director
+		proxy.Director = func(req *http.Request) {
+			director(req)
+			for _, k := range traceHeaders {
+				req.Header.Del(k)
+			}
+		}
+	}
+	transport := proxy.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	proxy.Transport = &roundTripper{r: transport, tracer: opts.tracer}
+
+	var serverOpts []apmhttp.ServerOption
+	if opts.tracer != nil {
+		serverOpts = append(serverOpts, apmhttp.WithTracer(opts.tracer))
+	}
+	serverOpts = append(serverOpts, opts.serverOpts...)
+	return apmhttp.Wrap(&proxy, serverOpts...)
+}
+
+type roundTripper struct {
+	r      http.RoundTripper
+	tracer *elasticapm.Tracer
+}
+
+// RoundTrip delegates to r.r, emitting a span for the proxied request
+// if req's context contains a sampled transaction, and recording the
+// classification of any upstream failure in the transaction's context.
+func (r *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	tx := elasticapm.TransactionFromContext(ctx)
+	if tx == nil {
+		return r.r.RoundTrip(req)
+	}
+	spanType := elasticapm.OverrideSpanType(ctx, "apmhttputil", "ext.http", req.URL.Host)
+	target := elasticapm.ServiceTargetSpanContext{Type: "http", Name: req.URL.Host}
+	span := tx.StartExitSpan(apmhttp.ClientRequestName(req), spanType, elasticapm.SpanFromContext(ctx), target)
+	defer span.End()
+
+	resp, err := r.r.RoundTrip(req)
+	httpContext := elasticapm.HTTPSpanContext{URL: req.URL}
+	if err != nil {
+		tx.Context.SetTag("upstream_error", ClassifyError(err))
+		tracer := r.tracer
+		if tracer == nil {
+			tracer = elasticapm.TracerFromContext(ctx)
+		}
+		e := tracer.NewError(err)
+		e.Transaction = tx
+		e.Send()
+	} else {
+		httpContext.StatusCode = resp.StatusCode
+		if resp.StatusCode >= 500 {
+			tx.Context.SetTag("upstream_error", UpstreamError5xx)
+		}
+	}
+	if !span.Dropped() {
+		span.Context.SetHTTP(httpContext)
+	}
+	return resp, err
+}
+
+// ClassifyError classifies an error returned by an upstream request
+// as one of the UpstreamError* constants: "dial" if a connection to the
+// upstream server could not be established, "timeout" if the request
+// timed out, "canceled" if the request was canceled, and otherwise
+// "other".
+func ClassifyError(err error) string {
+	if opErr, ok := err.(*net.OpError); ok && opErr.Op == "dial" {
+		return UpstreamErrorDial
+	}
+	if urlErr, ok := err.(*url.Error); ok {
+		return ClassifyError(urlErr.Err)
+	}
+	switch err {
+	case context.DeadlineExceeded:
+		return UpstreamErrorTimeout
+	case context.Canceled:
+		return UpstreamErrorCanceled
+	}
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return UpstreamErrorTimeout
+	}
+	return UpstreamErrorOther
+}
+
+type options struct {
+	tracer       *elasticapm.Tracer
+	headerPolicy HeaderPolicy
+	serverOpts   []apmhttp.ServerOption
+}
+
+// Option sets options for tracing reverse proxies.
+type Option func(*options)
+
+// WithTracer returns an Option which sets t as the tracer
+// to use for tracing proxied requests.
+func WithTracer(t *elasticapm.Tracer) Option {
+	if t == nil {
+		panic("t == nil")
+	}
+	return func(o *options) {
+		o.tracer = t
+	}
+}
+
+// WithHeaderPolicy returns an Option which sets the policy for
+// handling trace context headers in proxied requests.
+func WithHeaderPolicy(p HeaderPolicy) Option {
+	return func(o *options) {
+		o.headerPolicy = p
+	}
+}
+
+// WithServerOptions returns an Option which passes the given
+// apmhttp.ServerOptions to apmhttp.Wrap, e.g. for naming
+// transactions with apmhttp.WithServerRequestName.
+func WithServerOptions(serverOpts ...apmhttp.ServerOption) Option {
+	return func(o *options) {
+		o.serverOpts = append(o.serverOpts, serverOpts...)
+	}
+}
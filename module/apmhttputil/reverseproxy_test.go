@@ -0,0 +1,119 @@
+package apmhttputil_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go/model"
+	"github.com/elastic/apm-agent-go/module/apmhttputil"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestReverseProxy(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	var upstreamHeader http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		upstreamHeader = req.Header
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer upstream.Close()
+	upstreamURL, err := url.Parse(upstream.URL)
+	require.NoError(t, err)
+
+	h := apmhttputil.WrapReverseProxy(
+		httputil.NewSingleHostReverseProxy(upstreamURL),
+		apmhttputil.WithTracer(tracer),
+		apmhttputil.WithHeaderPolicy(apmhttputil.StripHeaders),
+	)
+	req := httptest.NewRequest("GET", "/foo", nil)
+	req.Header.Set("Traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	req.Header.Set("Elastic-Apm-Sampling-Priority", "1")
+	req.Header.Set("Elastic-Apm-Session-Id", "abc123")
+	req.Header.Set("X-Custom", "value")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	tracer.Flush(nil)
+
+	assert.Equal(t, "value", upstreamHeader.Get("X-Custom"))
+	assert.Equal(t, "", upstreamHeader.Get("Traceparent"))
+	assert.Equal(t, "", upstreamHeader.Get("Elastic-Apm-Sampling-Priority"))
+	assert.Equal(t, "", upstreamHeader.Get("Elastic-Apm-Session-Id"))
+
+	tx := transport.Payloads()[0].Transactions()[0]
+	assert.Equal(t, "GET /foo", tx.Name)
+	assert.Equal(t, map[string]string{"upstream_error": "5xx", "session_id": "abc123"}, tx.Context.Tags)
+	require.Len(t, tx.Spans, 1)
+	assert.Equal(t, "GET "+upstreamURL.Host, tx.Spans[0].Name)
+	assert.Equal(t, &model.SpanContext{
+		HTTP: &model.HTTPSpanContext{
+			URL:        upstream.URL + "/foo",
+			StatusCode: http.StatusBadGateway,
+		},
+		Destination: &model.DestinationSpanContext{
+			Service: &model.DestinationServiceSpanContext{Resource: "http/" + upstreamURL.Host},
+		},
+		Service: &model.ServiceSpanContext{
+			Target: &model.ServiceTargetSpanContext{Type: "http", Name: upstreamURL.Host},
+		},
+	}, tx.Spans[0].Context)
+}
+
+func TestReverseProxyDialError(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	// Listen and immediately close, to obtain an address
+	// which will refuse connections.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ln.Close()
+
+	h := apmhttputil.WrapReverseProxy(
+		httputil.NewSingleHostReverseProxy(&url.URL{Scheme: "http", Host: ln.Addr().String()}),
+		apmhttputil.WithTracer(tracer),
+	)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/foo", nil))
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	tracer.Flush(nil)
+
+	var txs []model.Transaction
+	var errs []*model.Error
+	for _, p := range transport.Payloads() {
+		switch p := p.Value.(type) {
+		case *model.TransactionsPayload:
+			txs = append(txs, p.Transactions...)
+		case *model.ErrorsPayload:
+			errs = append(errs, p.Errors...)
+		}
+	}
+	require.Len(t, txs, 1)
+	require.Len(t, errs, 1)
+	assert.Equal(t, map[string]string{"upstream_error": "dial"}, txs[0].Context.Tags)
+}
+
+func TestClassifyError(t *testing.T) {
+	assert.Equal(t, "dial", apmhttputil.ClassifyError(&net.OpError{Op: "dial", Err: errors.New("refused")}))
+	assert.Equal(t, "timeout", apmhttputil.ClassifyError(context.DeadlineExceeded))
+	assert.Equal(t, "timeout", apmhttputil.ClassifyError(&url.Error{Err: timeoutError{}}))
+	assert.Equal(t, "canceled", apmhttputil.ClassifyError(context.Canceled))
+	assert.Equal(t, "other", apmhttputil.ClassifyError(errors.New("boom")))
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
@@ -47,7 +47,6 @@ func init() {
 // by the aws-lambda-go package.
 type Function struct {
 	client *rpc.Client
-	tracer *elasticapm.Tracer
 }
 
 // Ping pings the function implementation.
@@ -57,10 +56,14 @@ func (f *Function) Ping(req *messages.PingRequest, response *messages.PingRespon
 
 // Invoke invokes the Lambda function. This is our main trace point.
 func (f *Function) Invoke(req *messages.InvokeRequest, response *messages.InvokeResponse) error {
-	tx := f.tracer.StartTransaction(lambdacontext.FunctionName, "function")
-	defer f.tracer.Flush(nonBlocking)
+	// Invocations carry no context from which to select a tracer,
+	// so DefaultTracer is resolved here rather than at package
+	// initialisation, in case it is replaced before the first call.
+	tracer := elasticapm.DefaultTracer
+	tx := tracer.StartTransaction(lambdacontext.FunctionName, "function")
+	defer tracer.Flush(nonBlocking)
 	defer tx.End()
-	defer f.tracer.Recover(tx)
+	defer tracer.Recover(tx)
 	if tx.Sampled() {
 		tx.Context.SetCustom("lambda", &lambdaContext)
 	}
@@ -72,7 +75,7 @@ func (f *Function) Invoke(req *messages.InvokeRequest, response *messages.Invoke
 
 	err := f.client.Call("Function.Invoke", req, response)
 	if err != nil {
-		e := f.tracer.NewError(err)
+		e := tracer.NewError(err)
 		e.Context.SetCustom("lambda", &lambdaContext)
 		e.Transaction = tx
 		e.Send()
@@ -83,7 +86,7 @@ func (f *Function) Invoke(req *messages.InvokeRequest, response *messages.Invoke
 		lambdaContext.Response = formatPayload(response.Payload)
 	}
 	if response.Error != nil {
-		e := f.tracer.NewError(invokeResponseError{response.Error})
+		e := tracer.NewError(invokeResponseError{response.Error})
 		e.Context.SetCustom("lambda", &lambdaContext)
 		e.Transaction = tx
 		e.Send()
@@ -136,10 +139,7 @@ func init() {
 		log.Fatal(err)
 	}
 	srv := rpc.NewServer()
-	srv.Register(&Function{
-		client: rpcClient,
-		tracer: elasticapm.DefaultTracer,
-	})
+	srv.Register(&Function{client: rpcClient})
 	go srv.Accept(lis)
 
 	// Setting _LAMBDA_SERVER_PORT causes lambda.Start
@@ -0,0 +1,209 @@
+package apmmessaging
+
+import (
+	"context"
+
+	"github.com/elastic/apm-agent-go"
+)
+
+// Message describes a message received by a batch consumer.
+type Message struct {
+	// Name describes the message, e.g. the name of the topic or
+	// queue from which it was received. Name is used for naming
+	// the per-message spans of a batch transaction; if Name is
+	// empty, the consumer's name is used instead. Per-message
+	// transactions are always named with the consumer's name.
+	Name string
+
+	// Link holds the producer's deferred span, encoded with
+	// elasticapm.DeferredSpan.String, if the producer recorded
+	// one. Link may be empty.
+	Link string
+
+	// Value holds the consumer-specific message value, e.g.
+	// a *sarama.ConsumerMessage or an *sqs.Message.
+	Value interface{}
+}
+
+// Handler is the interface for handling a single message
+// in a batch.
+//
+// The context passed to the handler contains the transaction,
+// and the message span if the batch is traced with a single
+// transaction.
+type Handler interface {
+	HandleMessage(ctx context.Context, msg Message) error
+}
+
+// HandlerFunc is a function type implementing Handler.
+type HandlerFunc func(ctx context.Context, msg Message) error
+
+// HandleMessage calls f(ctx, msg).
+func (f HandlerFunc) HandleMessage(ctx context.Context, msg Message) error {
+	return f(ctx, msg)
+}
+
+// BatchConsumer traces the handling of batches of messages.
+//
+// By default, a single transaction is reported for each batch, with a
+// child span for each message in the batch. Use WithTransactionPerMessage
+// to report a transaction for each message instead.
+type BatchConsumer struct {
+	tracer            *elasticapm.Tracer
+	name              string
+	transactionType   string
+	transactionPerMsg bool
+}
+
+// NewBatchConsumer returns a new BatchConsumer which reports
+// transactions with the given name and type, e.g. "orders"
+// and "messaging".
+//
+// By default, the consumer will trace with the tracer returned by
+// elasticapm.TracerFromContext for the context passed to Consume.
+// Use WithTracer to specify a fixed tracer.
+func NewBatchConsumer(name, transactionType string, o ...Option) *BatchConsumer {
+	c := &BatchConsumer{
+		name:            name,
+		transactionType: transactionType,
+	}
+	for _, o := range o {
+		o(c)
+	}
+	return c
+}
+
+// Consume passes each message in msgs to h, in order, stopping at the
+// first error. If h returns an error, it is reported to Elastic APM and
+// returned by Consume.
+//
+// Links to the producers of the messages are recorded in the custom
+// context "links" of the batch transaction, or in the custom context
+// "deferred" of each per-message transaction (see
+// elasticapm.Tracer.StartDeferredTransaction).
+func (c *BatchConsumer) Consume(ctx context.Context, msgs []Message, h Handler) error {
+	tracer := c.tracer
+	if tracer == nil {
+		tracer = elasticapm.TracerFromContext(ctx)
+	}
+	if c.transactionPerMsg {
+		for _, msg := range msgs {
+			if err := c.consumeMessage(ctx, tracer, msg, h); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return c.consumeBatch(ctx, tracer, msgs, h)
+}
+
+func (c *BatchConsumer) consumeBatch(ctx context.Context, tracer *elasticapm.Tracer, msgs []Message, h Handler) error {
+	tx := tracer.StartTransaction(c.name, c.transactionType)
+	defer tx.End()
+	ctx = elasticapm.ContextWithTransaction(ctx, tx)
+
+	var links []interface{}
+	for _, msg := range msgs {
+		if link := parseLink(msg.Link); link != nil {
+			links = append(links, link)
+		}
+	}
+	if tx.Sampled() {
+		tx.Context.SetCustom("batch_size", len(msgs))
+		if len(links) > 0 {
+			tx.Context.SetCustom("links", links)
+		}
+	}
+
+	for _, msg := range msgs {
+		name := msg.Name
+		if name == "" {
+			name = c.name
+		}
+		span := tx.StartSpan(name, c.transactionType+".message", nil)
+		err := h.HandleMessage(elasticapm.ContextWithSpan(ctx, span), msg)
+		span.End()
+		if err != nil {
+			c.captureError(tracer, err, tx)
+			return err
+		}
+	}
+	tx.SetResult(elasticapm.ResultInfo{Result: "success"})
+	return nil
+}
+
+func (c *BatchConsumer) consumeMessage(ctx context.Context, tracer *elasticapm.Tracer, msg Message, h Handler) error {
+	var tx *elasticapm.Transaction
+	if d, ok := parseDeferredSpan(msg.Link); ok {
+		tx = tracer.StartDeferredTransaction(d)
+		tx.Name = c.name
+		tx.Type = c.transactionType
+	} else {
+		tx = tracer.StartTransaction(c.name, c.transactionType)
+	}
+	defer tx.End()
+
+	if err := h.HandleMessage(elasticapm.ContextWithTransaction(ctx, tx), msg); err != nil {
+		c.captureError(tracer, err, tx)
+		return err
+	}
+	tx.SetResult(elasticapm.ResultInfo{Result: "success"})
+	return nil
+}
+
+func (c *BatchConsumer) captureError(tracer *elasticapm.Tracer, err error, tx *elasticapm.Transaction) {
+	tx.SetResult(elasticapm.ResultInfo{Result: "error", Err: err})
+	e := tracer.NewError(err)
+	e.Transaction = tx
+	e.Send()
+}
+
+// parseLink parses the deferred span encoded in link, returning
+// a custom context value describing it, or nil if link is empty
+// or invalid, or does not refer to a producer transaction.
+func parseLink(link string) map[string]interface{} {
+	d, ok := parseDeferredSpan(link)
+	if !ok || d.TransactionID == "" {
+		return nil
+	}
+	out := map[string]interface{}{"transaction_id": d.TransactionID}
+	if d.SpanID >= 0 {
+		out["span_id"] = d.SpanID
+	}
+	return out
+}
+
+// parseDeferredSpan parses the deferred span encoded in link,
+// reporting false if link is empty or invalid.
+func parseDeferredSpan(link string) (elasticapm.DeferredSpan, bool) {
+	if link == "" {
+		return elasticapm.DeferredSpan{}, false
+	}
+	d, err := elasticapm.ParseDeferredSpan(link)
+	return d, err == nil
+}
+
+// Option sets options for a BatchConsumer.
+type Option func(*BatchConsumer)
+
+// WithTracer returns an Option which sets t as the tracer
+// to use for tracing batches of messages.
+func WithTracer(t *elasticapm.Tracer) Option {
+	if t == nil {
+		panic("t == nil")
+	}
+	return func(c *BatchConsumer) {
+		c.tracer = t
+	}
+}
+
+// WithTransactionPerMessage returns an Option which controls whether
+// a transaction is reported for each message, rather than for each
+// batch. When enabled, a transaction will be started for each message
+// using elasticapm.Tracer.StartDeferredTransaction if the message has
+// a valid Link, and no per-message spans will be reported.
+func WithTransactionPerMessage(enabled bool) Option {
+	return func(c *BatchConsumer) {
+		c.transactionPerMsg = enabled
+	}
+}
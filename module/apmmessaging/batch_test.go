@@ -0,0 +1,118 @@
+package apmmessaging_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/internal/uuid"
+	"github.com/elastic/apm-agent-go/model"
+	"github.com/elastic/apm-agent-go/module/apmmessaging"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestBatchConsumer(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	producerTx := tracer.StartTransaction("producer", "request")
+	link := producerTx.DeferSpan("publish orders", "messaging", nil).String()
+	producerTx.End()
+
+	msgs := []apmmessaging.Message{
+		{Name: "orders", Link: link},
+		{},
+	}
+	var handled int
+	consumer := apmmessaging.NewBatchConsumer("consume orders", "messaging", apmmessaging.WithTracer(tracer))
+	err := consumer.Consume(context.Background(), msgs, apmmessaging.HandlerFunc(
+		func(ctx context.Context, msg apmmessaging.Message) error {
+			assert.NotNil(t, elasticapm.TransactionFromContext(ctx))
+			assert.NotNil(t, elasticapm.SpanFromContext(ctx))
+			handled++
+			return nil
+		},
+	))
+	require.NoError(t, err)
+	assert.Equal(t, 2, handled)
+	tracer.Flush(nil)
+
+	txs := transport.Payloads()[0].Transactions()
+	require.Len(t, txs, 2)
+	tx := txs[1]
+	assert.Equal(t, "consume orders", tx.Name)
+	assert.Equal(t, "success", tx.Result)
+	require.Len(t, tx.Spans, 2)
+	assert.Equal(t, "orders", tx.Spans[0].Name)
+	assert.Equal(t, "messaging.message", tx.Spans[0].Type)
+	assert.Equal(t, "consume orders", tx.Spans[1].Name)
+
+	require.Len(t, tx.Context.Custom, 2)
+	assert.Equal(t, "batch_size", tx.Context.Custom[0].Key)
+	assert.Equal(t, float64(2), tx.Context.Custom[0].Value)
+	assert.Equal(t, "links", tx.Context.Custom[1].Key)
+	assert.Equal(t, []interface{}{map[string]interface{}{
+		"transaction_id": uuid.UUID(txs[0].ID).String(),
+		"span_id":        float64(0),
+	}}, tx.Context.Custom[1].Value)
+}
+
+func TestBatchConsumerTransactionPerMessage(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	producerTx := tracer.StartTransaction("producer", "request")
+	link := producerTx.DeferSpan("publish orders", "messaging", nil).String()
+	producerTx.End()
+
+	msgs := []apmmessaging.Message{
+		{Name: "orders", Link: link},
+		{Name: "orders"},
+		{Name: "orders"},
+	}
+	consumer := apmmessaging.NewBatchConsumer(
+		"consume orders", "messaging",
+		apmmessaging.WithTracer(tracer),
+		apmmessaging.WithTransactionPerMessage(true),
+	)
+	var handled int
+	err := consumer.Consume(context.Background(), msgs, apmmessaging.HandlerFunc(
+		func(ctx context.Context, msg apmmessaging.Message) error {
+			assert.Nil(t, elasticapm.SpanFromContext(ctx))
+			if handled++; handled == 2 {
+				return errors.New("boom")
+			}
+			return nil
+		},
+	))
+	assert.EqualError(t, err, "boom")
+	assert.Equal(t, 2, handled)
+	tracer.Flush(nil)
+
+	var errs []*model.Error
+	var txs []model.Transaction
+	for _, p := range transport.Payloads() {
+		switch p := p.Value.(type) {
+		case *model.ErrorsPayload:
+			errs = append(errs, p.Errors...)
+		case *model.TransactionsPayload:
+			txs = append(txs, p.Transactions...)
+		}
+	}
+	require.Len(t, errs, 1)
+	assert.Equal(t, "boom", errs[0].Exception.Message)
+
+	require.Len(t, txs, 3)
+	assert.Equal(t, "consume orders", txs[1].Name)
+	assert.Equal(t, "messaging", txs[1].Type)
+	assert.Equal(t, "success", txs[1].Result)
+	assert.Equal(t, map[string]string{
+		"deferred_transaction_id": uuid.UUID(txs[0].ID).String(),
+	}, txs[1].Context.Tags)
+	assert.Equal(t, "error", txs[2].Result)
+	assert.Nil(t, txs[2].Context)
+}
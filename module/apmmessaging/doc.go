@@ -0,0 +1,3 @@
+// Package apmmessaging provides tracing for message consumers,
+// such as Kafka or SQS consumers which poll for batches of messages.
+package apmmessaging
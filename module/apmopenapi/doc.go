@@ -0,0 +1,4 @@
+// Package apmopenapi provides transaction naming based on OpenAPI
+// specifications, for services such as reverse proxies which have no
+// router from which to derive route templates.
+package apmopenapi
@@ -0,0 +1,188 @@
+package apmopenapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/elastic/apm-agent-go/module/apmhttp"
+)
+
+// paramSegment replaces path parameter segments in operation paths.
+const paramSegment = "{}"
+
+// methods holds the OpenAPI path item fields which describe operations.
+var methods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// Spec holds the operations of an OpenAPI specification, for naming
+// transactions by matching requests to operations.
+type Spec struct {
+	basePath   string
+	operations []operation
+}
+
+type operation struct {
+	method   string
+	segments []string // paramSegment for path parameters
+	name     string
+	literals int
+}
+
+// Load loads an OpenAPI 3 or Swagger 2 specification, in JSON format,
+// from r. Specifications in YAML format must first be converted to JSON.
+//
+// For Swagger 2 specifications the "basePath" field, and for OpenAPI 3
+// specifications the path of the first server URL, is stripped from
+// request paths before matching them to operations. Variables in the
+// server URL are replaced with their default values.
+func Load(r io.Reader) (*Spec, error) {
+	var doc struct {
+		BasePath string                                `json:"basePath"`
+		Servers  []server                              `json:"servers"`
+		Paths    map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, errors.Wrap(err, "failed to decode OpenAPI specification")
+	}
+	spec := &Spec{basePath: doc.BasePath}
+	if len(doc.Servers) > 0 {
+		serverURL, err := doc.Servers[0].expandURL()
+		if err != nil {
+			return nil, err
+		}
+		u, err := url.Parse(serverURL)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse server URL")
+		}
+		spec.basePath = u.Path
+	}
+	spec.basePath = strings.TrimSuffix(spec.basePath, "/")
+
+	for path, item := range doc.Paths {
+		for _, method := range methods {
+			raw, ok := item[method]
+			if !ok {
+				continue
+			}
+			var op struct {
+				OperationID string `json:"operationId"`
+			}
+			if err := json.Unmarshal(raw, &op); err != nil {
+				return nil, errors.Wrapf(err, "failed to decode operation %s %s", method, path)
+			}
+			spec.operations = append(spec.operations, newOperation(method, path, op.OperationID))
+		}
+	}
+
+	// Order the operations such that those with more literal path
+	// segments are matched first, so "/pets/mine" takes precedence
+	// over "/pets/{petId}".
+	sort.Slice(spec.operations, func(i, j int) bool {
+		oi, oj := spec.operations[i], spec.operations[j]
+		if oi.literals != oj.literals {
+			return oi.literals > oj.literals
+		}
+		return oi.name < oj.name
+	})
+	return spec, nil
+}
+
+type server struct {
+	URL       string `json:"url"`
+	Variables map[string]struct {
+		Default string `json:"default"`
+	} `json:"variables"`
+}
+
+// expandURL returns the server URL with each {variable} template
+// replaced by the variable's default value.
+func (s *server) expandURL() (string, error) {
+	var buf bytes.Buffer
+	rest := s.URL
+	for {
+		i := strings.IndexByte(rest, '{')
+		if i < 0 {
+			break
+		}
+		j := strings.IndexByte(rest[i:], '}')
+		if j < 0 {
+			return "", errors.Errorf("failed to parse server URL %q: unterminated variable", s.URL)
+		}
+		name := rest[i+1 : i+j]
+		v, ok := s.Variables[name]
+		if !ok {
+			return "", errors.Errorf("failed to parse server URL %q: undefined variable %q", s.URL, name)
+		}
+		buf.WriteString(rest[:i])
+		buf.WriteString(v.Default)
+		rest = rest[i+j+1:]
+	}
+	buf.WriteString(rest)
+	return buf.String(), nil
+}
+
+func newOperation(method, path, operationID string) operation {
+	op := operation{
+		method:   strings.ToUpper(method),
+		segments: strings.Split(strings.Trim(path, "/"), "/"),
+		name:     operationID,
+	}
+	for i, segment := range op.segments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			op.segments[i] = paramSegment
+		} else {
+			op.literals++
+		}
+	}
+	if op.name == "" {
+		op.name = op.method + " " + path
+	}
+	return op
+}
+
+// RequestName returns the transaction name for the server request, req,
+// for use with apmhttp.WithServerRequestName.
+//
+// The transaction is named by the operationId of the operation matching
+// the request method and path, or by the method and path template if the
+// operation has no operationId. If no operation matches the request, the
+// name returned by apmhttp.ServerRequestName is used.
+func (s *Spec) RequestName(req *http.Request) string {
+	path := req.URL.Path
+	if s.basePath != "" {
+		rest := strings.TrimPrefix(path, s.basePath)
+		if len(rest) == len(path) || (rest != "" && rest[0] != '/') {
+			return apmhttp.ServerRequestName(req)
+		}
+		path = rest
+	}
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for _, op := range s.operations {
+		if op.method == req.Method && op.match(segments) {
+			return op.name
+		}
+	}
+	return apmhttp.ServerRequestName(req)
+}
+
+func (op *operation) match(segments []string) bool {
+	if len(segments) != len(op.segments) {
+		return false
+	}
+	for i, segment := range op.segments {
+		if segment == paramSegment {
+			if segments[i] == "" {
+				return false
+			}
+		} else if segment != segments[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,115 @@
+package apmopenapi_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go/module/apmhttp"
+	"github.com/elastic/apm-agent-go/module/apmopenapi"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+const petstore = `{
+  "openapi": "3.0.0",
+  "servers": [{"url": "https://petstore.example/v1"}],
+  "paths": {
+    "/": {"get": {"operationId": "root"}},
+    "/pets": {
+      "get": {"operationId": "listPets"},
+      "post": {"operationId": "createPets"}
+    },
+    "/pets/mine": {"get": {"operationId": "listMyPets"}},
+    "/pets/{petId}": {
+      "get": {"operationId": "showPetById"},
+      "delete": {}
+    }
+  }
+}`
+
+func TestSpecRequestName(t *testing.T) {
+	spec, err := apmopenapi.Load(strings.NewReader(petstore))
+	require.NoError(t, err)
+
+	for _, test := range []struct {
+		method, path, name string
+	}{
+		{"GET", "/v1", "root"},
+		{"GET", "/v1/", "root"},
+		{"GET", "/v1/pets", "listPets"},
+		{"POST", "/v1/pets/", "createPets"},
+		{"GET", "/v1/pets/mine", "listMyPets"},
+		{"GET", "/v1/pets/123", "showPetById"},
+		{"DELETE", "/v1/pets/123", "DELETE /pets/{petId}"},
+		{"PUT", "/v1/pets/123", "PUT /v1/pets/123"},
+		{"GET", "/v1/pets/123/toys", "GET /v1/pets/123/toys"},
+		{"GET", "/v2/pets", "GET /v2/pets"},
+		{"GET", "/v1pets", "GET /v1pets"},
+	} {
+		req := httptest.NewRequest(test.method, test.path, nil)
+		assert.Equal(t, test.name, spec.RequestName(req), "%s %s", test.method, test.path)
+	}
+}
+
+func TestSpecSwaggerBasePath(t *testing.T) {
+	spec, err := apmopenapi.Load(strings.NewReader(`{
+	  "swagger": "2.0",
+	  "basePath": "/api/",
+	  "paths": {"/users/{id}": {"get": {"operationId": "getUser"}}}
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, "getUser", spec.RequestName(httptest.NewRequest("GET", "/api/users/1", nil)))
+}
+
+func TestSpecServerURLVariables(t *testing.T) {
+	spec, err := apmopenapi.Load(strings.NewReader(`{
+	  "openapi": "3.0.0",
+	  "servers": [{
+	    "url": "{scheme}://{host}/api/{version}",
+	    "variables": {
+	      "scheme": {"default": "https", "enum": ["http", "https"]},
+	      "host": {"default": "petstore.example"},
+	      "version": {"default": "v2"}
+	    }
+	  }],
+	  "paths": {"/pets": {"get": {"operationId": "listPets"}}}
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, "listPets", spec.RequestName(httptest.NewRequest("GET", "/api/v2/pets", nil)))
+}
+
+func TestSpecServerURLVariableUndefined(t *testing.T) {
+	_, err := apmopenapi.Load(strings.NewReader(`{
+	  "openapi": "3.0.0",
+	  "servers": [{"url": "https://petstore.example/{version}"}],
+	  "paths": {}
+	}`))
+	assert.EqualError(t, err, `failed to parse server URL "https://petstore.example/{version}": undefined variable "version"`)
+}
+
+func TestLoadInvalid(t *testing.T) {
+	_, err := apmopenapi.Load(strings.NewReader("openapi: 3.0.0"))
+	assert.Error(t, err)
+}
+
+func TestSpecServerRequestName(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	spec, err := apmopenapi.Load(strings.NewReader(petstore))
+	require.NoError(t, err)
+	h := apmhttp.Wrap(
+		http.NotFoundHandler(),
+		apmhttp.WithTracer(tracer),
+		apmhttp.WithServerRequestName(spec.RequestName),
+	)
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1/pets/42", nil))
+	tracer.Flush(nil)
+
+	tx := transport.Payloads()[0].Transactions()[0]
+	assert.Equal(t, "showPetById", tx.Name)
+}
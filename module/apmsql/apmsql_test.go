@@ -5,13 +5,14 @@ import (
 	"database/sql"
 	"testing"
 
+	"github.com/mattn/go-sqlite3"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/elastic/apm-agent-go"
 	"github.com/elastic/apm-agent-go/model"
 	"github.com/elastic/apm-agent-go/module/apmsql"
-	_ "github.com/elastic/apm-agent-go/module/apmsql/sqlite3"
+	apmsqlite3 "github.com/elastic/apm-agent-go/module/apmsql/sqlite3"
 	"github.com/elastic/apm-agent-go/transport/transporttest"
 )
 
@@ -69,9 +70,91 @@ func TestQueryContext(t *testing.T) {
 			Statement: "SELECT * FROM foo",
 			Type:      "sql",
 		},
+		Destination: &model.DestinationSpanContext{
+			Service: &model.DestinationServiceSpanContext{Resource: "sqlite3/:memory:"},
+		},
+		Service: &model.ServiceSpanContext{
+			Target: &model.ServiceTargetSpanContext{Type: "sqlite3", Name: ":memory:"},
+		},
 	}, tx.Spans[0].Context)
 }
 
+func TestExecResults(t *testing.T) {
+	driver := apmsql.Wrap(
+		&sqlite3.SQLiteDriver{},
+		apmsql.WithDSNParser(apmsqlite3.ParseDSN),
+		apmsql.WithExecResults(),
+	)
+	sql.Register("apmsql_test_exec_results", driver)
+	db, err := sql.Open("apmsql_test_exec_results", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec("CREATE TABLE foo (bar INT)")
+	require.NoError(t, err)
+
+	tx := withTransaction(t, func(ctx context.Context) {
+		_, err := db.ExecContext(ctx, "INSERT INTO foo VALUES (1), (2)")
+		require.NoError(t, err)
+		stmt, err := db.PrepareContext(ctx, "UPDATE foo SET bar = 3 WHERE bar = ?")
+		require.NoError(t, err)
+		defer stmt.Close()
+		_, err = stmt.ExecContext(ctx, 1)
+		require.NoError(t, err)
+	})
+	require.Len(t, tx.Spans, 3)
+
+	insertSpan := tx.Spans[0]
+	require.NotNil(t, insertSpan.Context.Database.RowsAffected)
+	assert.Equal(t, int64(2), *insertSpan.Context.Database.RowsAffected)
+	assert.Equal(t, "true", insertSpan.Context.Tags["db_last_insert_id"])
+
+	updateSpan := tx.Spans[2]
+	assert.Equal(t, "UPDATE foo", updateSpan.Name)
+	require.NotNil(t, updateSpan.Context.Database.RowsAffected)
+	assert.Equal(t, int64(1), *updateSpan.Context.Database.RowsAffected)
+}
+
+func TestExecResultsDisabled(t *testing.T) {
+	db, err := apmsql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec("CREATE TABLE foo (bar INT)")
+	require.NoError(t, err)
+
+	tx := withTransaction(t, func(ctx context.Context) {
+		_, err := db.ExecContext(ctx, "INSERT INTO foo VALUES (1)")
+		require.NoError(t, err)
+	})
+	require.Len(t, tx.Spans, 1)
+	assert.Nil(t, tx.Spans[0].Context.Database.RowsAffected)
+	assert.Empty(t, tx.Spans[0].Context.Tags)
+}
+
+func TestServiceTarget(t *testing.T) {
+	driver := apmsql.Wrap(
+		&sqlite3.SQLiteDriver{},
+		apmsql.WithDSNParser(apmsqlite3.ParseDSN),
+		apmsql.WithServiceTarget(elasticapm.ServiceTargetSpanContext{Name: "orders-db"}),
+	)
+	sql.Register("apmsql_test_service_target", driver)
+	db, err := sql.Open("apmsql_test_service_target", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	db.Ping() // connect
+	tx := withTransaction(t, func(ctx context.Context) {
+		err := db.PingContext(ctx)
+		assert.NoError(t, err)
+	})
+	require.Len(t, tx.Spans, 1)
+	assert.Equal(t, &model.ServiceSpanContext{
+		Target: &model.ServiceTargetSpanContext{Type: "sqlite3", Name: "orders-db"},
+	}, tx.Spans[0].Context.Service)
+	assert.Equal(t, "sqlite3/orders-db", tx.Spans[0].Context.Destination.Service.Resource)
+}
+
 func TestPrepareContext(t *testing.T) {
 	db, err := apmsql.Open("sqlite3", ":memory:")
 	require.NoError(t, err)
@@ -176,3 +259,99 @@ func withTransaction(t *testing.T, f func(ctx context.Context)) model.Transactio
 	require.Len(t, transactions, 1)
 	return transactions[0]
 }
+
+func TestBeginTxCommit(t *testing.T) {
+	db, err := apmsql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec("CREATE TABLE foo (bar INT)")
+	require.NoError(t, err)
+
+	tx := withTransaction(t, func(ctx context.Context) {
+		dbtx, err := apmsql.BeginTx(ctx, db, nil)
+		require.NoError(t, err)
+		defer dbtx.Rollback()
+		_, err = dbtx.ExecContext(ctx, "INSERT INTO foo VALUES (1)")
+		require.NoError(t, err)
+		require.NoError(t, dbtx.Commit())
+	})
+	require.Len(t, tx.Spans, 3)
+	assert.Equal(t, "transaction", tx.Spans[0].Name)
+	assert.Equal(t, "db.sqlite3.transaction", tx.Spans[0].Type)
+	assert.Equal(t, "INSERT INTO foo", tx.Spans[1].Name)
+	assert.Equal(t, "COMMIT", tx.Spans[2].Name)
+	assert.Equal(t, "db.sqlite3.commit", tx.Spans[2].Type)
+	assert.Equal(t, tx.Spans[0].ID, tx.Spans[1].Parent)
+	assert.Equal(t, tx.Spans[0].ID, tx.Spans[2].Parent)
+}
+
+func TestBeginTxRollback(t *testing.T) {
+	db, err := apmsql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec("CREATE TABLE foo (bar INT)")
+	require.NoError(t, err)
+
+	tx := withTransaction(t, func(ctx context.Context) {
+		dbtx, err := apmsql.BeginTx(ctx, db, nil)
+		require.NoError(t, err)
+		rows, err := dbtx.Query("SELECT * FROM foo")
+		require.NoError(t, err)
+		rows.Close()
+		require.NoError(t, dbtx.Rollback())
+	})
+	require.Len(t, tx.Spans, 3)
+	assert.Equal(t, "transaction", tx.Spans[0].Name)
+	assert.Equal(t, "SELECT FROM foo", tx.Spans[1].Name)
+	assert.Equal(t, "ROLLBACK", tx.Spans[2].Name)
+	assert.Equal(t, "db.sqlite3.rollback", tx.Spans[2].Type)
+	assert.Equal(t, tx.Spans[0].ID, tx.Spans[2].Parent)
+}
+
+func TestStatementMetricsGatherer(t *testing.T) {
+	if !elasticapm.MetricsEnabled {
+		t.Skip("metrics are compiled out")
+	}
+	apmsql.Register("sqlite3_stmt_metrics", &sqlite3.SQLiteDriver{}, apmsql.WithDriverName("stmt_metrics"))
+	db, err := apmsql.Open("sqlite3_stmt_metrics", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	stmt, err := db.Prepare("SELECT 1")
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		rows, err := stmt.Query()
+		require.NoError(t, err)
+		rows.Close()
+	}
+	stmt.Close()
+
+	_, err = db.Exec("CREATE TABLE foo (bar INT)")
+	require.NoError(t, err)
+	stmt, err = db.Prepare("INSERT INTO foo VALUES (1)")
+	require.NoError(t, err)
+	_, err = stmt.Exec()
+	require.NoError(t, err)
+	stmt.Close()
+
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.RegisterMetricsGatherer(apmsql.StatementMetricsGatherer())
+	tracer.SendMetrics(nil)
+
+	var samples map[string]model.Metric
+	for _, m := range transport.Payloads()[0].Metrics() {
+		if len(m.Labels) == 1 && m.Labels[0].Value == "stmt_metrics" {
+			samples = m.Samples
+		}
+	}
+	require.NotNil(t, samples)
+	assert.Equal(t, 2.0, *samples["db.sql.stmt.prepared"].Value)
+	assert.Equal(t, 4.0, *samples["db.sql.stmt.executions"].Value)
+	assert.Equal(t, 2.0, *samples["db.sql.stmt.reused"].Value)
+	assert.Equal(t, 1.0, *samples["db.sql.stmt.single_use"].Value)
+	assert.Equal(t, 0.5, *samples["db.sql.stmt.reuse_ratio"].Value)
+}
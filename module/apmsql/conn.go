@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql/driver"
 	"errors"
+	"sync/atomic"
 
 	"github.com/elastic/apm-agent-go"
 )
@@ -11,6 +12,7 @@ import (
 func newConn(in driver.Conn, d *tracingDriver, dsnInfo DSNInfo) driver.Conn {
 	conn := &conn{Conn: in, driver: d}
 	conn.dsnInfo = dsnInfo
+	conn.serviceTarget = d.formatServiceTarget(dsnInfo)
 	conn.pinger, _ = in.(driver.Pinger)
 	conn.queryer, _ = in.(driver.Queryer)
 	conn.queryerContext, _ = in.(driver.QueryerContext)
@@ -28,8 +30,9 @@ func newConn(in driver.Conn, d *tracingDriver, dsnInfo DSNInfo) driver.Conn {
 type conn struct {
 	driver.Conn
 	connGo110
-	driver  *tracingDriver
-	dsnInfo DSNInfo
+	driver        *tracingDriver
+	dsnInfo       DSNInfo
+	serviceTarget elasticapm.ServiceTargetSpanContext
 
 	pinger             driver.Pinger
 	queryer            driver.Queryer
@@ -45,7 +48,8 @@ func (c *conn) startStmtSpan(ctx context.Context, stmt, spanType string) (*elast
 }
 
 func (c *conn) startSpan(ctx context.Context, name, spanType, stmt string) (*elasticapm.Span, context.Context) {
-	span, ctx := elasticapm.StartSpan(ctx, name, spanType)
+	spanType = elasticapm.OverrideSpanType(ctx, "apmsql", spanType, c.dsnInfo.Database)
+	span, ctx := elasticapm.StartExitSpan(ctx, name, spanType, c.serviceTarget)
 	if !span.Dropped() {
 		span.Context.SetDatabase(elasticapm.DatabaseSpanContext{
 			Instance:  c.dsnInfo.Database,
@@ -72,6 +76,20 @@ func (c *conn) finishSpan(ctx context.Context, span *elasticapm.Span, resultErro
 	}
 }
 
+// finishExecSpan records the result of an Exec operation in the
+// span, if enabled, and then finishes the span.
+func (c *conn) finishExecSpan(ctx context.Context, span *elasticapm.Span, result driver.Result, resultError error) {
+	if resultError == nil && result != nil && c.driver.captureExecResults && !span.Dropped() {
+		if n, err := result.RowsAffected(); err == nil {
+			span.Context.SetDatabaseRowsAffected(n)
+		}
+		if _, err := result.LastInsertId(); err == nil {
+			span.Context.SetTag("db_last_insert_id", "true")
+		}
+	}
+	c.finishSpan(ctx, span, resultError)
+}
+
 func (c *conn) Ping(ctx context.Context) (resultError error) {
 	if c.pinger == nil {
 		return nil
@@ -126,17 +144,20 @@ func (c *conn) PrepareContext(ctx context.Context, query string) (_ driver.Stmt,
 		}
 	}
 	if stmt != nil {
+		atomic.AddUint64(&c.driver.stmtStats.prepared, 1)
 		stmt = newStmt(stmt, c, query)
 	}
 	return stmt, err
 }
 
-func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (_ driver.Result, resultError error) {
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (result driver.Result, resultError error) {
 	if c.execerContext == nil && c.execer == nil {
 		return nil, driver.ErrSkip
 	}
 	span, ctx := c.startStmtSpan(ctx, query, c.driver.execSpanType)
-	defer c.finishSpan(ctx, span, resultError)
+	defer func() {
+		c.finishExecSpan(ctx, span, result, resultError)
+	}()
 
 	if c.execerContext != nil {
 		return c.execerContext.ExecContext(ctx, query, args)
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"reflect"
 	"strings"
+
+	"github.com/elastic/apm-agent-go"
 )
 
 // DriverPrefix should be used as a driver name prefix when
@@ -52,6 +54,10 @@ func Wrap(driver driver.Driver, opts ...WrapOption) driver.Driver {
 	d.prepareSpanType = d.formatSpanType("prepare")
 	d.querySpanType = d.formatSpanType("query")
 	d.execSpanType = d.formatSpanType("exec")
+	d.transactionSpanType = d.formatSpanType("transaction")
+	d.commitSpanType = d.formatSpanType("commit")
+	d.rollbackSpanType = d.formatSpanType("rollback")
+	d.stmtStats = driverStmtStats(d.driverName)
 	return d
 }
 
@@ -78,16 +84,61 @@ func WithDSNParser(f DSNParserFunc) WrapOption {
 	}
 }
 
+// WithServiceTarget returns a WrapOption which overrides the service
+// targeted by database spans, used for grouping dependencies in the
+// APM UI. If WithServiceTarget is not supplied to Wrap, or its fields
+// are empty, the target type defaults to the driver name, and the
+// target name defaults to the database name in the data source name.
+func WithServiceTarget(target elasticapm.ServiceTargetSpanContext) WrapOption {
+	return func(d *tracingDriver) {
+		d.serviceTarget = target
+	}
+}
+
+// WithExecResults returns a WrapOption which enables recording
+// the results of Exec operations in their spans. The number of rows
+// affected is recorded in the span's database context, and if the
+// driver reports a last insert ID, the tag "db_last_insert_id" is
+// set to "true". The last insert ID value itself is not recorded.
+//
+// Some drivers perform additional work to obtain these results,
+// so recording them is disabled by default.
+func WithExecResults() WrapOption {
+	return func(d *tracingDriver) {
+		d.captureExecResults = true
+	}
+}
+
 type tracingDriver struct {
 	driver.Driver
-	driverName string
-	dsnParser  DSNParserFunc
-
-	connectSpanType string
-	execSpanType    string
-	pingSpanType    string
-	prepareSpanType string
-	querySpanType   string
+	driverName    string
+	stmtStats     *stmtStats
+	dsnParser     DSNParserFunc
+	serviceTarget elasticapm.ServiceTargetSpanContext
+
+	captureExecResults bool
+
+	connectSpanType     string
+	execSpanType        string
+	pingSpanType        string
+	prepareSpanType     string
+	querySpanType       string
+	transactionSpanType string
+	commitSpanType      string
+	rollbackSpanType    string
+}
+
+// formatServiceTarget returns the service targeted by spans for
+// connections to the database described by dsnInfo.
+func (d *tracingDriver) formatServiceTarget(dsnInfo DSNInfo) elasticapm.ServiceTargetSpanContext {
+	target := d.serviceTarget
+	if target.Type == "" {
+		target.Type = d.driverName
+	}
+	if target.Name == "" {
+		target.Name = dsnInfo.Database
+	}
+	return target
 }
 
 func (d *tracingDriver) formatSpanType(suffix string) string {
@@ -30,9 +30,10 @@ type driverConnector struct {
 }
 
 func (d *driverConnector) Connect(ctx context.Context) (driver.Conn, error) {
-	span, ctx := elasticapm.StartSpan(ctx, "connect", d.driver.connectSpanType)
-	defer span.End()
 	dsnInfo := d.driver.dsnParser(d.name)
+	spanType := elasticapm.OverrideSpanType(ctx, "apmsql", d.driver.connectSpanType, dsnInfo.Database)
+	span, ctx := elasticapm.StartExitSpan(ctx, "connect", spanType, d.driver.formatServiceTarget(dsnInfo))
+	defer span.End()
 	if !span.Dropped() {
 		span.Context.SetDatabase(elasticapm.DatabaseSpanContext{
 			Instance: dsnInfo.Database,
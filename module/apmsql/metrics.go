@@ -0,0 +1,91 @@
+package apmsql
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/elastic/apm-agent-go"
+)
+
+var (
+	driverStatsMu sync.Mutex
+	driverStats   = make(map[string]*stmtStats)
+)
+
+// stmtStats holds prepared statement statistics for a driver.
+// The fields must be accessed atomically.
+type stmtStats struct {
+	// prepared holds the number of statements prepared.
+	prepared uint64
+
+	// executions holds the number of executions of
+	// prepared statements.
+	executions uint64
+
+	// reused holds the number of executions of prepared
+	// statements which had previously been executed.
+	reused uint64
+
+	// singleUse holds the number of prepared statements
+	// closed after being executed at most once.
+	singleUse uint64
+}
+
+// StatementMetricsGatherer returns an elasticapm.MetricsGatherer which
+// gathers prepared statement metrics for all drivers wrapped with Wrap
+// or registered with Register, labeled by driver name. The metrics of
+// drivers wrapped more than once with the same name are combined.
+//
+// The metrics are useful for identifying the anti-pattern of preparing
+// a statement for every execution. The counters db.sql.stmt.prepared and
+// db.sql.stmt.executions record the number of statements prepared and
+// executed respectively; database/sql prepares a statement once for each
+// connection on which it is executed. The counter db.sql.stmt.reused
+// records executions of statements that had already been executed, and
+// db.sql.stmt.single_use records statements closed after being executed
+// at most once. The gauge db.sql.stmt.reuse_ratio reports the ratio of
+// reused to total executions, i.e. the prepared statement cache hit rate.
+func StatementMetricsGatherer() elasticapm.MetricsGatherer {
+	return elasticapm.GatherMetricsFunc(gatherStatementMetrics)
+}
+
+func gatherStatementMetrics(ctx context.Context, m *elasticapm.Metrics) error {
+	driverStatsMu.Lock()
+	defer driverStatsMu.Unlock()
+	names := make([]string, 0, len(driverStats))
+	for name := range driverStats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		stats := driverStats[name]
+		labels := []elasticapm.MetricLabel{{Name: "driver", Value: name}}
+		executions := atomic.LoadUint64(&stats.executions)
+		reused := atomic.LoadUint64(&stats.reused)
+		m.AddCounter("db.sql.stmt.prepared", "", labels, float64(atomic.LoadUint64(&stats.prepared)))
+		m.AddCounter("db.sql.stmt.executions", "", labels, float64(executions))
+		m.AddCounter("db.sql.stmt.reused", "", labels, float64(reused))
+		m.AddCounter("db.sql.stmt.single_use", "", labels, float64(atomic.LoadUint64(&stats.singleUse)))
+		if executions > 0 {
+			m.AddGauge("db.sql.stmt.reuse_ratio", "", labels, float64(reused)/float64(executions))
+		}
+	}
+	return nil
+}
+
+// driverStmtStats returns the statement statistics for drivers with
+// the given name, creating them if they do not exist. Drivers wrapped
+// repeatedly with the same name share statistics, so the registry does
+// not grow with each call to Wrap.
+func driverStmtStats(driverName string) *stmtStats {
+	driverStatsMu.Lock()
+	defer driverStatsMu.Unlock()
+	stats, ok := driverStats[driverName]
+	if !ok {
+		stats = &stmtStats{}
+		driverStats[driverName] = stats
+	}
+	return stats
+}
@@ -0,0 +1,31 @@
+package apmsql
+
+import (
+	"database/sql/driver"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type nopDriver struct{}
+
+func (nopDriver) Open(name string) (driver.Conn, error) {
+	return nil, driver.ErrBadConn
+}
+
+func TestDriverStmtStatsShared(t *testing.T) {
+	d1 := Wrap(nopDriver{}, WithDriverName("stmt_stats_shared")).(*tracingDriver)
+	driverStatsMu.Lock()
+	n := len(driverStats)
+	driverStatsMu.Unlock()
+
+	// Wrapping again with the same name must not
+	// grow the registry, and shares the statistics.
+	for i := 0; i < 3; i++ {
+		d2 := Wrap(nopDriver{}, WithDriverName("stmt_stats_shared")).(*tracingDriver)
+		assert.True(t, d1.stmtStats == d2.stmtStats)
+	}
+	driverStatsMu.Lock()
+	assert.Equal(t, n, len(driverStats))
+	driverStatsMu.Unlock()
+}
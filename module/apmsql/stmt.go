@@ -3,6 +3,7 @@ package apmsql
 import (
 	"context"
 	"database/sql/driver"
+	"sync/atomic"
 
 	"github.com/elastic/apm-agent-go"
 )
@@ -22,6 +23,11 @@ func newStmt(in driver.Stmt, conn *conn, query string) driver.Stmt {
 }
 
 type stmt struct {
+	// executions holds the number of times the statement has been
+	// executed. This is first to ensure 64-bit alignment for atomic
+	// operations.
+	executions uint64
+
 	driver.Stmt
 	stmtGo19
 	conn      *conn
@@ -37,6 +43,22 @@ func (s *stmt) startSpan(ctx context.Context, spanType string) (*elasticapm.Span
 	return s.conn.startSpan(ctx, s.signature, spanType, s.query)
 }
 
+// executed records an execution of the statement.
+func (s *stmt) executed() {
+	stats := s.conn.driver.stmtStats
+	atomic.AddUint64(&stats.executions, 1)
+	if atomic.AddUint64(&s.executions, 1) > 1 {
+		atomic.AddUint64(&stats.reused, 1)
+	}
+}
+
+func (s *stmt) Close() error {
+	if atomic.LoadUint64(&s.executions) <= 1 {
+		atomic.AddUint64(&s.conn.driver.stmtStats.singleUse, 1)
+	}
+	return s.Stmt.Close()
+}
+
 func (s *stmt) ColumnConverter(idx int) driver.ValueConverter {
 	if s.columnConverter != nil {
 		return s.columnConverter.ColumnConverter(idx)
@@ -44,9 +66,12 @@ func (s *stmt) ColumnConverter(idx int) driver.ValueConverter {
 	return driver.DefaultParameterConverter
 }
 
-func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (_ driver.Result, resultError error) {
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (result driver.Result, resultError error) {
+	s.executed()
 	span, ctx := s.startSpan(ctx, s.conn.driver.execSpanType)
-	defer s.conn.finishSpan(ctx, span, resultError)
+	defer func() {
+		s.conn.finishExecSpan(ctx, span, result, resultError)
+	}()
 	if s.stmtExecContext != nil {
 		return s.stmtExecContext.ExecContext(ctx, args)
 	}
@@ -63,6 +88,7 @@ func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (_ dri
 }
 
 func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (_ driver.Rows, resultError error) {
+	s.executed()
 	span, ctx := s.startSpan(ctx, s.conn.driver.querySpanType)
 	defer s.conn.finishSpan(ctx, span, resultError)
 	if s.stmtQueryContext != nil {
@@ -0,0 +1,161 @@
+package apmsql
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+
+	"github.com/elastic/apm-agent-go"
+)
+
+const (
+	genericTransactionSpanType = "db.sql.transaction"
+	genericCommitSpanType      = "db.sql.commit"
+	genericRollbackSpanType    = "db.sql.rollback"
+)
+
+// Tx wraps a *sql.Tx, tracing the database transaction as a span
+// covering its lifetime, from BeginTx until Commit or Rollback.
+//
+// Statements executed using the Tx's methods are reported as
+// children of the database transaction span, and the commit or
+// rollback is reported as a final child span named "COMMIT" or
+// "ROLLBACK". If committing or rolling back fails, the error is
+// reported to Elastic APM.
+type Tx struct {
+	*sql.Tx
+	span *elasticapm.Span
+	ctx  context.Context
+
+	commitSpanType   string
+	rollbackSpanType string
+
+	mu    sync.Mutex
+	ended bool
+}
+
+// BeginTx starts a database transaction, as in db.BeginTx, returning
+// a Tx which traces the database transaction as a span of the Elastic
+// APM transaction in ctx, if any.
+//
+// For statement spans to be reported, db must have been opened with
+// a driver registered with Register.
+func BeginTx(ctx context.Context, db *sql.DB, opts *sql.TxOptions) (*Tx, error) {
+	spanType := genericTransactionSpanType
+	commitSpanType := genericCommitSpanType
+	rollbackSpanType := genericRollbackSpanType
+	if d, ok := db.Driver().(*tracingDriver); ok {
+		spanType = d.transactionSpanType
+		commitSpanType = d.commitSpanType
+		rollbackSpanType = d.rollbackSpanType
+	}
+	span, ctx := elasticapm.StartSpan(ctx, "transaction", spanType)
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		span.End()
+		if e := elasticapm.CaptureError(ctx, err); e != nil {
+			e.Send()
+		}
+		return nil, err
+	}
+	return &Tx{
+		Tx:               tx,
+		span:             span,
+		ctx:              ctx,
+		commitSpanType:   commitSpanType,
+		rollbackSpanType: rollbackSpanType,
+	}, nil
+}
+
+// Context returns a copy of ctx containing the database transaction
+// span, such that spans started with the returned context are reported
+// as children of the database transaction span.
+func (tx *Tx) Context(ctx context.Context) context.Context {
+	if tx.span.Dropped() {
+		return ctx
+	}
+	return elasticapm.ContextWithSpan(ctx, tx.span)
+}
+
+// Commit commits the transaction, as in sql.Tx.Commit.
+func (tx *Tx) Commit() error {
+	return tx.end("COMMIT", tx.commitSpanType, tx.Tx.Commit)
+}
+
+// Rollback aborts the transaction, as in sql.Tx.Rollback.
+func (tx *Tx) Rollback() error {
+	return tx.end("ROLLBACK", tx.rollbackSpanType, tx.Tx.Rollback)
+}
+
+// end calls f, reporting it as a child span of the database transaction
+// span with the given name and type, and then ends the database
+// transaction span. If the transaction has already been ended, then f
+// is called without tracing, so that deferred calls to Rollback after
+// Commit do not produce spurious spans.
+func (tx *Tx) end(name, spanType string, f func() error) error {
+	tx.mu.Lock()
+	ended := tx.ended
+	tx.ended = true
+	tx.mu.Unlock()
+	if ended {
+		return f()
+	}
+
+	span, ctx := elasticapm.StartSpan(tx.ctx, name, spanType)
+	err := f()
+	span.End()
+	tx.span.End()
+	if e := elasticapm.CaptureError(ctx, err); e != nil {
+		e.Send()
+	}
+	return err
+}
+
+// ExecContext executes a query, as in sql.Tx.ExecContext, reporting
+// it as a child of the database transaction span.
+func (tx *Tx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return tx.Tx.ExecContext(tx.Context(ctx), query, args...)
+}
+
+// Exec executes a query, as in sql.Tx.Exec, reporting it as
+// a child of the database transaction span.
+func (tx *Tx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return tx.Tx.ExecContext(tx.ctx, query, args...)
+}
+
+// QueryContext executes a query, as in sql.Tx.QueryContext,
+// reporting it as a child of the database transaction span.
+func (tx *Tx) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return tx.Tx.QueryContext(tx.Context(ctx), query, args...)
+}
+
+// Query executes a query, as in sql.Tx.Query, reporting it as
+// a child of the database transaction span.
+func (tx *Tx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return tx.Tx.QueryContext(tx.ctx, query, args...)
+}
+
+// QueryRowContext executes a query, as in sql.Tx.QueryRowContext,
+// reporting it as a child of the database transaction span.
+func (tx *Tx) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return tx.Tx.QueryRowContext(tx.Context(ctx), query, args...)
+}
+
+// QueryRow executes a query, as in sql.Tx.QueryRow, reporting it
+// as a child of the database transaction span.
+func (tx *Tx) QueryRow(query string, args ...interface{}) *sql.Row {
+	return tx.Tx.QueryRowContext(tx.ctx, query, args...)
+}
+
+// PrepareContext creates a prepared statement, as in
+// sql.Tx.PrepareContext, reporting it as a child of the
+// database transaction span.
+func (tx *Tx) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return tx.Tx.PrepareContext(tx.Context(ctx), query)
+}
+
+// Prepare creates a prepared statement, as in sql.Tx.Prepare,
+// reporting it as a child of the database transaction span.
+func (tx *Tx) Prepare(query string) (*sql.Stmt, error) {
+	return tx.Tx.PrepareContext(tx.ctx, query)
+}
@@ -0,0 +1,59 @@
+// Package apmtraefik provides a Traefik middleware plugin which reports
+// requests handled by Traefik as transactions to Elastic APM.
+//
+// The package follows the Traefik plugin conventions, exposing the
+// Config type and the CreateConfig and New functions. It cannot be
+// loaded by Traefik's Yaegi plugin interpreter, as the agent depends
+// on packages such as unsafe and syscall which Yaegi does not support,
+// so it must be compiled into a custom build of Traefik.
+package apmtraefik
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/module/apmhttp"
+	"github.com/elastic/apm-agent-go/transport"
+)
+
+// Config holds the plugin configuration.
+//
+// If ServiceName is empty, the tracer will be configured using the
+// ELASTIC_APM_* environment variables, as with elasticapm.DefaultTracer.
+// Likewise for ServerURL and SecretToken.
+type Config struct {
+	ServiceName string `json:"serviceName,omitempty"`
+	ServerURL   string `json:"serverURL,omitempty"`
+	SecretToken string `json:"secretToken,omitempty"`
+}
+
+// CreateConfig returns the default plugin configuration.
+func CreateConfig() *Config {
+	return &Config{}
+}
+
+// New returns an http.Handler which reports each request as a
+// transaction to Elastic APM, before passing it to next.
+func New(ctx context.Context, next http.Handler, config *Config, name string) (http.Handler, error) {
+	tracer, err := elasticapm.NewTracer(config.ServiceName, "")
+	if err != nil {
+		return nil, err
+	}
+	if config.ServerURL != "" || config.SecretToken != "" {
+		transport, err := transport.NewHTTPTransport(config.ServerURL, config.SecretToken)
+		if err != nil {
+			tracer.Close()
+			return nil, err
+		}
+		tracer.Transport = transport
+	}
+	go func() {
+		// Traefik cancels ctx when the middleware is
+		// discarded, e.g. due to a configuration reload.
+		<-ctx.Done()
+		tracer.Flush(nil)
+		tracer.Close()
+	}()
+	return apmhttp.Wrap(next, apmhttp.WithTracer(tracer)), nil
+}
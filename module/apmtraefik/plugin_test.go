@@ -0,0 +1,52 @@
+package apmtraefik_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go/module/apmtraefik"
+)
+
+func TestPlugin(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		paths = append(paths, req.URL.Path)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	config := apmtraefik.CreateConfig()
+	config.ServiceName = "traefik"
+	config.ServerURL = server.URL
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h, err := apmtraefik.New(ctx, http.NotFoundHandler(), config, "elasticapm")
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/foo", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Canceling the context flushes the tracer,
+	// sending the transaction to the server.
+	cancel()
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, path := range paths {
+			if path == "/v1/transactions" {
+				return true
+			}
+		}
+		return false
+	}, 10*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,183 @@
+package apmzap
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/elastic/apm-agent-go"
+)
+
+const (
+	// traceContextKey is the key of the field returned by TraceContext.
+	traceContextKey = "elasticapm.context"
+
+	// TransactionIDKey is the key of the field added to log entries
+	// associated with a transaction, holding the transaction ID.
+	TransactionIDKey = "transaction.id"
+)
+
+// TraceContext returns a zap.Field which, when supplied to a Logger
+// whose Core was wrapped with WrapCore, associates log entries with the
+// transaction in ctx, if any. The field is not encoded by other Cores.
+func TraceContext(ctx context.Context) zap.Field {
+	return zap.Field{Key: traceContextKey, Type: zapcore.SkipType, Interface: ctx}
+}
+
+// WrapCore returns a zapcore.Core wrapping c, which adds a
+// transaction.id field to log entries associated with a transaction
+// via a TraceContext field, and reports entries at error level or
+// above to Elastic APM.
+//
+// By default, errors are reported with the tracer returned by
+// elasticapm.TracerFromContext for the context of the entry's
+// TraceContext field, or elasticapm.DefaultTracer if there is none.
+// Use WithTracer to specify a fixed tracer.
+func WrapCore(c zapcore.Core, o ...CoreOption) zapcore.Core {
+	wrapped := &core{
+		Core:           c,
+		unsampledLevel: zapcore.DebugLevel,
+	}
+	for _, o := range o {
+		o(wrapped)
+	}
+	return wrapped
+}
+
+// CoreOption sets options for a Core wrapped with WrapCore.
+type CoreOption func(*core)
+
+// WithTracer returns a CoreOption which sets t as the tracer
+// to use for reporting errors.
+func WithTracer(t *elasticapm.Tracer) CoreOption {
+	if t == nil {
+		panic("t == nil")
+	}
+	return func(c *core) {
+		c.tracer = t
+	}
+}
+
+// WithUnsampledLevel returns a CoreOption which suppresses entries
+// below the given level that are associated with an unsampled
+// transaction. This may be used to reduce log volume in line with the
+// transaction sample rate, while still logging entries for the
+// transactions that are sampled. By default, no entries are suppressed.
+func WithUnsampledLevel(level zapcore.Level) CoreOption {
+	return func(c *core) {
+		c.unsampledLevel = level
+	}
+}
+
+type core struct {
+	zapcore.Core
+	tracer         *elasticapm.Tracer
+	unsampledLevel zapcore.Level
+
+	// ctx holds the context of the TraceContext field with which
+	// the core has been associated through a call to With, if any.
+	ctx context.Context
+
+	// unsampled records whether the core has been associated with
+	// an unsampled transaction through a call to With.
+	unsampled bool
+}
+
+// With returns a Core with the given fields added. If fields includes
+// a TraceContext field, all entries logged with the returned Core are
+// associated with the transaction in the field's context.
+func (c *core) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	ctx, fields := extractTraceContext(fields)
+	if ctx != nil {
+		clone.ctx = ctx
+		if tx := elasticapm.TransactionFromContext(ctx); tx != nil {
+			clone.unsampled = !tx.Sampled()
+			fields = append(fields, zap.String(TransactionIDKey, tx.ID()))
+		}
+	}
+	clone.Core = c.Core.With(fields)
+	return &clone
+}
+
+// Check determines whether the entry should be logged, and if so, adds c
+// to ce. Entries are suppressed according to WithUnsampledLevel if c was
+// associated with an unsampled transaction through a call to With.
+func (c *core) Check(entry zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.unsampled && entry.Level < c.unsampledLevel {
+		return ce
+	}
+	if c.Enabled(entry.Level) {
+		return ce.AddCore(entry, c)
+	}
+	return ce
+}
+
+// Write adds the transaction.id field to the entry if fields includes a
+// TraceContext field, and writes it to the wrapped Core. Entries at error
+// level or above are reported to Elastic APM, associated with the
+// transaction in the context of the entry's TraceContext field, or of
+// the TraceContext field with which c was associated through With.
+func (c *core) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	ctx, fields := extractTraceContext(fields)
+	var tx *elasticapm.Transaction
+	if ctx != nil {
+		if tx = elasticapm.TransactionFromContext(ctx); tx != nil {
+			if !tx.Sampled() && entry.Level < c.unsampledLevel {
+				return nil
+			}
+			fields = append(fields, zap.String(TransactionIDKey, tx.ID()))
+		}
+	} else if c.ctx != nil {
+		// The core was associated with the context through a call
+		// to With, which has already added the transaction.id field.
+		ctx = c.ctx
+		tx = elasticapm.TransactionFromContext(ctx)
+	}
+	if entry.Level >= zapcore.ErrorLevel {
+		tracer := c.tracer
+		if tracer == nil {
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			tracer = elasticapm.TracerFromContext(ctx)
+		}
+		e := tracer.NewErrorLog(elasticapm.ErrorLogRecord{
+			Message:    entry.Message,
+			Level:      entry.Level.String(),
+			LoggerName: entry.LoggerName,
+		})
+		e.Transaction = tx
+		e.Send()
+	}
+	return c.Core.Write(entry, fields)
+}
+
+// extractTraceContext returns the context of the first TraceContext
+// field in fields, if any, and a copy of fields with TraceContext fields
+// removed. If fields contains no TraceContext field, then
+// extractTraceContext returns nil and fields unchanged.
+func extractTraceContext(fields []zapcore.Field) (context.Context, []zapcore.Field) {
+	var ctx context.Context
+	var rest []zapcore.Field
+	for i, f := range fields {
+		if f.Type != zapcore.SkipType || f.Key != traceContextKey {
+			if rest != nil {
+				rest = append(rest, f)
+			}
+			continue
+		}
+		if rest == nil {
+			rest = make([]zapcore.Field, i, len(fields))
+			copy(rest, fields[:i])
+		}
+		if fctx, ok := f.Interface.(context.Context); ok && ctx == nil {
+			ctx = fctx
+		}
+	}
+	if rest == nil {
+		return nil, fields
+	}
+	return ctx, rest
+}
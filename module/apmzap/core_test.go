@@ -0,0 +1,121 @@
+package apmzap_test
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/module/apmzap"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestCoreTraceContext(t *testing.T) {
+	tracer, _ := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	observed, logs := observer.New(zapcore.DebugLevel)
+	logger := zap.New(apmzap.WrapCore(observed, apmzap.WithTracer(tracer)))
+
+	tx := tracer.StartTransaction("name", "type")
+	defer tx.End()
+	ctx := elasticapm.ContextWithTransaction(context.Background(), tx)
+
+	logger.Info("per-entry", apmzap.TraceContext(ctx), zap.Int("n", 1))
+	logger.With(apmzap.TraceContext(ctx)).Info("with")
+	logger.Info("uncorrelated")
+
+	entries := logs.AllUntimed()
+	require.Len(t, entries, 3)
+	assert.Equal(t, map[string]interface{}{
+		"n":              int64(1),
+		"transaction.id": tx.ID(),
+	}, entries[0].ContextMap())
+	assert.Equal(t, map[string]interface{}{
+		"transaction.id": tx.ID(),
+	}, entries[1].ContextMap())
+	assert.Empty(t, entries[2].ContextMap())
+}
+
+func TestCoreUnsampledLevel(t *testing.T) {
+	tracer, _ := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetSampler(elasticapm.NewRatioSampler(0, rand.NewSource(0)))
+
+	observed, logs := observer.New(zapcore.DebugLevel)
+	logger := zap.New(apmzap.WrapCore(
+		observed,
+		apmzap.WithTracer(tracer),
+		apmzap.WithUnsampledLevel(zapcore.WarnLevel),
+	))
+
+	tx := tracer.StartTransaction("name", "type")
+	defer tx.End()
+	require.False(t, tx.Sampled())
+	ctx := elasticapm.ContextWithTransaction(context.Background(), tx)
+
+	logger.Info("suppressed", apmzap.TraceContext(ctx))
+	logger.With(apmzap.TraceContext(ctx)).Debug("suppressed")
+	logger.Warn("logged", apmzap.TraceContext(ctx))
+	logger.Info("logged")
+
+	entries := logs.AllUntimed()
+	require.Len(t, entries, 2)
+	assert.Equal(t, zapcore.WarnLevel, entries[0].Level)
+	assert.Equal(t, zapcore.InfoLevel, entries[1].Level)
+}
+
+func TestCoreErrorCapture(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	observed, logs := observer.New(zapcore.DebugLevel)
+	logger := zap.New(apmzap.WrapCore(observed, apmzap.WithTracer(tracer))).Named("logger_name")
+
+	tx := tracer.StartTransaction("name", "type")
+	ctx := elasticapm.ContextWithTransaction(context.Background(), tx)
+	logger.Error("oh noes", apmzap.TraceContext(ctx))
+	logger.Warn("not an error")
+	tx.End()
+	tracer.Flush(nil)
+
+	assert.Len(t, logs.AllUntimed(), 2)
+	payloads := transport.Payloads()
+	require.Len(t, payloads, 2)
+	errors := payloads[0].Errors()
+	require.Len(t, errors, 1)
+	assert.Equal(t, "oh noes", errors[0].Log.Message)
+	assert.Equal(t, "error", errors[0].Log.Level)
+	assert.Equal(t, "logger_name", errors[0].Log.LoggerName)
+	transactions := payloads[1].Transactions()
+	require.Len(t, transactions, 1)
+	assert.Equal(t, transactions[0].ID, errors[0].Transaction.ID)
+}
+
+func TestCoreErrorCaptureWith(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	observed, _ := observer.New(zapcore.DebugLevel)
+	logger := zap.New(apmzap.WrapCore(observed, apmzap.WithTracer(tracer)))
+
+	tx := tracer.StartTransaction("name", "type")
+	ctx := elasticapm.ContextWithTransaction(context.Background(), tx)
+	logger.With(apmzap.TraceContext(ctx)).Error("oh noes")
+	tx.End()
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads, 2)
+	errors := payloads[0].Errors()
+	require.Len(t, errors, 1)
+	transactions := payloads[1].Transactions()
+	require.Len(t, transactions, 1)
+	assert.Equal(t, transactions[0].ID, errors[0].Transaction.ID)
+}
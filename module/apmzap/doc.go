@@ -0,0 +1,4 @@
+// Package apmzap provides a go.uber.org/zap Core for correlating
+// log entries with Elastic APM transactions, and for reporting
+// error-level log entries to Elastic APM.
+package apmzap
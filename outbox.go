@@ -0,0 +1,143 @@
+package elasticapm
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/elastic/apm-agent-go/internal/uuid"
+)
+
+// DeferredSpan describes an exit span, such as the publication of a
+// message, which is recorded by one transaction but completed later,
+// possibly by another process.
+//
+// DeferredSpan is intended for use with the transactional outbox
+// pattern: a message is written to an outbox table in the same database
+// transaction as the business data, and later published by a relay
+// process. The DeferredSpan should be encoded with String and stored in
+// the outbox row, and the relay should decode it with ParseDeferredSpan
+// and pass it to Tracer.StartDeferredTransaction when publishing the
+// message.
+type DeferredSpan struct {
+	// TransactionID holds the ID of the transaction which recorded
+	// the deferred span, or the empty string if the transaction was
+	// nil or not sampled.
+	TransactionID string
+
+	// SpanID holds the ID of the span within the transaction, or -1
+	// if the span was dropped.
+	SpanID int64
+
+	// Name holds the name of the deferred span, e.g. "publish orders".
+	Name string
+
+	// Type holds the type of the deferred span, e.g. "messaging.kafka".
+	Type string
+
+	// Timestamp holds the time at which the deferred span was recorded.
+	Timestamp time.Time
+}
+
+// DeferSpan records a deferred exit span within the transaction, with
+// the specified name, type, and optional parent span, and returns a
+// DeferredSpan which may be used to complete it later.
+//
+// A zero-duration span is recorded in tx, marking the point at which
+// the deferred operation was requested. DeferSpan may be called with a
+// nil or non-sampled transaction, in which case no span is recorded,
+// but the returned DeferredSpan may still be used to report the
+// completion of the operation.
+func (tx *Transaction) DeferSpan(name, spanType string, parent *Span) DeferredSpan {
+	d := DeferredSpan{
+		SpanID:    -1,
+		Name:      name,
+		Type:      spanType,
+		Timestamp: tx.now(),
+	}
+	span := tx.StartSpan(name, spanType, parent)
+	if !span.Dropped() {
+		d.TransactionID = uuid.UUID(tx.id).String()
+		d.SpanID = span.id
+		span.Timestamp = d.Timestamp
+		span.Duration = 0
+	}
+	span.End()
+	return d
+}
+
+// String encodes d as a string, suitable for storing alongside the
+// deferred operation, e.g. in an outbox table row. The result may be
+// decoded with ParseDeferredSpan.
+func (d DeferredSpan) String() string {
+	values := make(url.Values)
+	if d.TransactionID != "" {
+		values.Set("tx", d.TransactionID)
+	}
+	if d.SpanID >= 0 {
+		values.Set("span", strconv.FormatInt(d.SpanID, 10))
+	}
+	values.Set("name", d.Name)
+	values.Set("type", d.Type)
+	values.Set("ts", strconv.FormatInt(d.Timestamp.UnixNano(), 10))
+	return values.Encode()
+}
+
+// ParseDeferredSpan decodes a DeferredSpan previously encoded with
+// DeferredSpan.String.
+func ParseDeferredSpan(s string) (DeferredSpan, error) {
+	values, err := url.ParseQuery(s)
+	if err != nil {
+		return DeferredSpan{}, errors.Wrap(err, "failed to parse deferred span")
+	}
+	d := DeferredSpan{
+		TransactionID: values.Get("tx"),
+		SpanID:        -1,
+		Name:          values.Get("name"),
+		Type:          values.Get("type"),
+	}
+	if d.TransactionID != "" {
+		if _, err := uuid.FromString(d.TransactionID); err != nil {
+			return DeferredSpan{}, errors.Wrap(err, "invalid deferred span transaction ID")
+		}
+	}
+	if v := values.Get("span"); v != "" {
+		if d.SpanID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return DeferredSpan{}, errors.Wrap(err, "invalid deferred span ID")
+		}
+	}
+	ts, err := strconv.ParseInt(values.Get("ts"), 10, 64)
+	if err != nil {
+		return DeferredSpan{}, errors.Wrap(err, "invalid deferred span timestamp")
+	}
+	d.Timestamp = time.Unix(0, ts)
+	return d, nil
+}
+
+// StartDeferredTransaction returns a new Transaction for completing the
+// deferred span d, e.g. when a relay process publishes a message read
+// from an outbox table. The transaction takes its name and type from d,
+// and its start time is set to the current time.
+//
+// The transaction is linked to the deferred span by recording the
+// originating transaction and span IDs in the tag
+// "deferred_transaction_id" and the custom context "deferred". The
+// custom context also records the time, in milliseconds, for which the
+// operation was deferred.
+func (t *Tracer) StartDeferredTransaction(d DeferredSpan, opts ...TransactionOption) *Transaction {
+	tx := t.StartTransaction(d.Name, d.Type, opts...)
+	deferred := map[string]interface{}{
+		"queue_duration": float64(nonNegative(tx.Timestamp.Sub(d.Timestamp))) / float64(time.Millisecond),
+	}
+	if d.TransactionID != "" {
+		tx.Context.SetTag("deferred_transaction_id", d.TransactionID)
+		deferred["transaction_id"] = d.TransactionID
+	}
+	if d.SpanID >= 0 {
+		deferred["span_id"] = d.SpanID
+	}
+	tx.Context.SetCustom("deferred", deferred)
+	return tx
+}
@@ -0,0 +1,73 @@
+package elasticapm_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/internal/uuid"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestDeferredSpan(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	tx := tracer.StartTransaction("create order", "request")
+	deferred := tx.DeferSpan("publish orders", "messaging.kafka", nil)
+	tx.End()
+	tracer.Flush(nil)
+
+	encoded := deferred.String()
+	decoded, err := elasticapm.ParseDeferredSpan(encoded)
+	require.NoError(t, err)
+	assert.Equal(t, deferred.TransactionID, decoded.TransactionID)
+	assert.Equal(t, int64(0), decoded.SpanID)
+	assert.Equal(t, "publish orders", decoded.Name)
+	assert.Equal(t, "messaging.kafka", decoded.Type)
+	assert.True(t, deferred.Timestamp.Equal(decoded.Timestamp))
+
+	relayTx := tracer.StartDeferredTransaction(decoded)
+	relayTx.End()
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads, 2)
+	origin := payloads[0].Transactions()[0]
+	assert.Equal(t, deferred.TransactionID, uuid.UUID(origin.ID).String())
+	require.Len(t, origin.Spans, 1)
+	assert.Equal(t, "publish orders", origin.Spans[0].Name)
+	assert.Equal(t, float64(0), origin.Spans[0].Duration)
+
+	relay := payloads[1].Transactions()[0]
+	assert.Equal(t, "publish orders", relay.Name)
+	assert.Equal(t, "messaging.kafka", relay.Type)
+	assert.Equal(t, map[string]string{
+		"deferred_transaction_id": deferred.TransactionID,
+	}, relay.Context.Tags)
+	require.Len(t, relay.Context.Custom, 1)
+	assert.Equal(t, "deferred", relay.Context.Custom[0].Key)
+	custom := relay.Context.Custom[0].Value.(map[string]interface{})
+	assert.Equal(t, deferred.TransactionID, custom["transaction_id"])
+	assert.Equal(t, float64(0), custom["span_id"])
+}
+
+func TestDeferredSpanNilTransaction(t *testing.T) {
+	var tx *elasticapm.Transaction
+	deferred := tx.DeferSpan("publish orders", "messaging", nil)
+	assert.Equal(t, "", deferred.TransactionID)
+	assert.Equal(t, int64(-1), deferred.SpanID)
+
+	decoded, err := elasticapm.ParseDeferredSpan(deferred.String())
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), decoded.SpanID)
+}
+
+func TestParseDeferredSpanInvalid(t *testing.T) {
+	_, err := elasticapm.ParseDeferredSpan("tx=invalid&ts=0")
+	assert.Error(t, err)
+	_, err = elasticapm.ParseDeferredSpan("name=foo")
+	assert.EqualError(t, err, `invalid deferred span timestamp: strconv.ParseInt: parsing "": invalid syntax`)
+}
@@ -0,0 +1,112 @@
+package elasticapm
+
+import (
+	"context"
+)
+
+// transactionsPipeline holds the state for sending batches of
+// transactions asynchronously, so that the next batch may be built
+// and encoded while previous requests are in flight.
+type transactionsPipeline struct {
+	inflight int
+	pending  bool
+	results  chan *pipelinedBatch
+	free     []*pipelinedBatch
+}
+
+// pipelinedBatch is a batch of transactions being sent asynchronously.
+type pipelinedBatch struct {
+	transactions []*Transaction
+	buf          transactionsBuffer
+	err          error
+}
+
+// idle reports whether there are no batches in flight or pending.
+func (p *transactionsPipeline) idle() bool {
+	return p.inflight == 0 && !p.pending
+}
+
+// sendTransactionsAsync builds a payload for transactions, and sends it
+// in a new goroutine, returning the batch's now-empty transactions slice
+// to be used for enqueuing subsequent transactions. The result will be
+// delivered on p.results.
+//
+// If all transactions are intentionally excluded from the payload, then
+// no request is sent, and the transactions are recycled immediately.
+func (s *sender) sendTransactionsAsync(ctx context.Context, transactions []*Transaction, p *transactionsPipeline) []*Transaction {
+	s.workers.yield()
+	var b *pipelinedBatch
+	if n := len(p.free); n > 0 {
+		b = p.free[n-1]
+		p.free = p.free[:n-1]
+	} else {
+		b = &pipelinedBatch{}
+	}
+	self := s.startSelfTransaction("send transactions")
+	span := startSelfSpan(self, "build payload")
+	built := s.buildTransactionsPayload(ctx, transactions, &b.buf)
+	endSelfSpan(span)
+	if !built {
+		endSelfTransaction(self, nil)
+		s.recordUnsentTransactions(&b.buf)
+		s.recycleTransactions(transactions)
+		p.free = append(p.free, b)
+		return transactions[:0]
+	}
+	b.transactions, transactions = transactions, b.transactions[:0]
+	p.inflight++
+
+	transport := s.tracer.Transport
+	closing := s.tracer.closing
+	go func() {
+		span := startSelfSpan(self, "send payload")
+		b.err = transport.SendTransactions(ctx, &b.buf.payload)
+		endSelfSpan(span)
+		endSelfTransaction(self, b.err)
+		select {
+		case p.results <- b:
+		case <-closing:
+		}
+	}()
+	return transactions
+}
+
+// pipelinedTransactionsSent records the result of sending a batch of
+// transactions asynchronously, recycling the transactions that were
+// sent, and returning those that were not. The caller is responsible
+// for enqueuing the returned transactions to be resent.
+func (s *sender) pipelinedTransactionsSent(b *pipelinedBatch, p *transactionsPipeline) []*Transaction {
+	p.inflight--
+	n := s.transactionsSent(&b.buf, len(b.transactions), b.err)
+	s.recycleTransactions(b.transactions[:n])
+	b.err = nil
+	return b.transactions[n:]
+}
+
+// releaseBatch makes b available for reuse.
+func (p *transactionsPipeline) releaseBatch(b *pipelinedBatch) {
+	b.transactions = b.transactions[:0]
+	p.free = append(p.free, b)
+}
+
+func (s *sender) recycleTransactions(transactions []*Transaction) {
+	for _, tx := range transactions {
+		tx.reset()
+		s.tracer.transactionPool.Put(tx)
+	}
+}
+
+// SetPipelineDepth sets the maximum number of requests for sending
+// transactions that may be in flight concurrently. While requests are
+// in flight, the tracer continues to build and encode the next batch
+// of transactions, improving throughput when sending to a remote APM
+// server over a high-latency link.
+//
+// If n is less than or equal to one, which is the default, transactions
+// are sent one request at a time. If n is greater than one, the tracer's
+// Transport must be safe for concurrent use.
+func (t *Tracer) SetPipelineDepth(n int) {
+	t.sendConfigCommand(func(cfg *tracerConfig) {
+		cfg.pipelineDepth = n
+	})
+}
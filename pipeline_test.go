@@ -0,0 +1,119 @@
+package elasticapm_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/model"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestTracerPipelineDepth(t *testing.T) {
+	tracer, err := elasticapm.NewTracer("tracer_testing", "")
+	require.NoError(t, err)
+	defer tracer.Close()
+
+	var transport blockingTransport
+	transport.init()
+	tracer.Transport = &transport
+	tracer.SetMaxTransactionQueueSize(1)
+	tracer.SetPipelineDepth(2)
+
+	// With a queue size of 1, each transaction is sent in its own
+	// request. Two requests may be in flight at a time; the third
+	// transaction must wait to be sent.
+	for i := 0; i < 3; i++ {
+		tracer.StartTransaction("name", "type").End()
+	}
+	<-transport.started
+	<-transport.started
+	select {
+	case <-transport.started:
+		t.Fatal("unexpected request")
+	default:
+	}
+
+	flushed := make(chan struct{})
+	go func() {
+		defer close(flushed)
+		tracer.Flush(nil)
+	}()
+	close(transport.release)
+	<-flushed
+
+	assert.Equal(t, 2, transport.maxInflight)
+	assert.Equal(t, uint64(3), tracer.Stats().TransactionsSent)
+}
+
+func TestTracerPipelineDepthRetry(t *testing.T) {
+	tracer, err := elasticapm.NewTracer("tracer_testing", "")
+	require.NoError(t, err)
+	defer tracer.Close()
+	tracer.SetPipelineDepth(2)
+	tracer.SetFlushInterval(10 * time.Millisecond)
+
+	var mu sync.Mutex
+	var fail = true
+	var sent []string
+	tracer.Transport = transporttest.CallbackTransport{
+		Transactions: func(ctx context.Context, p *model.TransactionsPayload) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if fail {
+				fail = false
+				return errors.New("nope")
+			}
+			for _, tx := range p.Transactions {
+				sent = append(sent, tx.Name)
+			}
+			return nil
+		},
+	}
+
+	tracer.StartTransaction("first", "type").End()
+	tracer.Flush(nil)
+	assert.Equal(t, uint64(1), tracer.Stats().Errors.SendTransactions)
+
+	tracer.StartTransaction("second", "type").End()
+	tracer.Flush(nil)
+	assert.Equal(t, []string{"first", "second"}, sent)
+}
+
+// blockingTransport is a transport which blocks sending transactions
+// until released, recording the maximum number of concurrent requests.
+type blockingTransport struct {
+	transporttest.RecorderTransport
+	started chan struct{}
+	release chan struct{}
+
+	mu          sync.Mutex
+	inflight    int
+	maxInflight int
+}
+
+func (t *blockingTransport) init() {
+	t.started = make(chan struct{}, 10)
+	t.release = make(chan struct{})
+}
+
+func (t *blockingTransport) SendTransactions(ctx context.Context, p *model.TransactionsPayload) error {
+	t.mu.Lock()
+	t.inflight++
+	if t.inflight > t.maxInflight {
+		t.maxInflight = t.inflight
+	}
+	t.mu.Unlock()
+	t.started <- struct{}{}
+	<-t.release
+	t.mu.Lock()
+	t.inflight--
+	t.mu.Unlock()
+	return nil
+}
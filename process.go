@@ -0,0 +1,72 @@
+package elasticapm
+
+import (
+	"os"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/apm-agent-go/model"
+)
+
+// ChildProcessEnv returns environment variables, in the form "key=value",
+// which should be added to the environment of worker processes started by
+// the current process, e.g. by appending to os/exec.Cmd.Env. This is
+// intended for pre-fork style deployments, where a supervisor process
+// starts and manages a pool of workers.
+//
+// A tracer in the worker process will report the supervisor's process ID
+// in its process metadata, and will report the supervisor's service name
+// unless the worker's service name is otherwise configured.
+func (t *Tracer) ChildProcessEnv() []string {
+	return []string{
+		envSupervisorPid + "=" + strconv.Itoa(os.Getpid()),
+		envSupervisorServiceName + "=" + t.Service.Name,
+	}
+}
+
+// newProcess returns the process metadata to report for a tracer
+// created with the given options.
+func newProcess(opts options) *model.Process {
+	process := currentProcess
+	process.Argv = sanitizeArgv(process.Argv, opts.sanitizedFieldNames)
+	process.Supervisor = opts.supervisor
+	process.GOMAXPROCS = runtime.GOMAXPROCS(0)
+	return &process
+}
+
+// sanitizeArgv returns a copy of args, redacting the values of flags
+// whose names match the given regular expression. Both "-flag=value"
+// and "-flag value" forms are recognised.
+func sanitizeArgv(args []string, re *regexp.Regexp) []string {
+	if re == nil || len(args) == 0 {
+		return args
+	}
+	out := make([]string, len(args))
+	out[0] = args[0]
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		out[i] = arg
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name := strings.TrimLeft(arg, "-")
+		if name == "" {
+			// "--" terminates the flags.
+			copy(out[i+1:], args[i+1:])
+			break
+		}
+		if eq := strings.IndexRune(name, '='); eq >= 0 {
+			if re.MatchString(name[:eq]) {
+				out[i] = arg[:len(arg)-len(name)+eq+1] + redacted
+			}
+			continue
+		}
+		if re.MatchString(name) && i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+			i++
+			out[i] = redacted
+		}
+	}
+	return out
+}
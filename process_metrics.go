@@ -0,0 +1,60 @@
+package elasticapm
+
+import (
+	"errors"
+	"time"
+)
+
+// errProcessMetricsUnsupported is returned by readProcessMetrics on
+// platforms for which process and system metrics are not implemented.
+var errProcessMetricsUnsupported = errors.New("process metrics not supported on this platform")
+
+// processMetrics holds process and system metrics, read using
+// platform-specific mechanisms.
+type processMetrics struct {
+	// cpuTotal holds the total user and system CPU time
+	// consumed by the process.
+	cpuTotal time.Duration
+
+	// memorySize and memoryRSS hold the virtual memory size
+	// and resident set size of the process, in bytes, or zero
+	// if unknown.
+	memorySize uint64
+	memoryRSS  uint64
+
+	// handles holds the number of open handles (Windows)
+	// or file descriptors (Unix) of the process, or -1 if
+	// unknown.
+	handles int
+
+	// systemMemoryTotal and systemMemoryFree hold the total
+	// and available physical memory of the system, in bytes,
+	// or zero if unknown.
+	systemMemoryTotal uint64
+	systemMemoryFree  uint64
+}
+
+func (g *builtinMetricsGatherer) gatherProcessMetrics(m *Metrics) error {
+	pm := processMetrics{handles: -1}
+	if err := readProcessMetrics(&pm); err != nil {
+		if err == errProcessMetricsUnsupported {
+			return nil
+		}
+		return err
+	}
+	const unitByte = "byte"
+	m.AddCounter("system.process.cpu.total", "sec", nil, pm.cpuTotal.Seconds())
+	addBytesGauge := func(name string, v uint64) {
+		if v != 0 {
+			m.AddGauge(name, unitByte, nil, float64(v))
+		}
+	}
+	addBytesGauge("system.process.memory.size", pm.memorySize)
+	addBytesGauge("system.process.memory.rss.bytes", pm.memoryRSS)
+	if pm.handles >= 0 {
+		m.AddGauge("system.process.handles", "", nil, float64(pm.handles))
+	}
+	addBytesGauge("system.memory.total", pm.systemMemoryTotal)
+	addBytesGauge("system.memory.actual.free", pm.systemMemoryFree)
+	return nil
+}
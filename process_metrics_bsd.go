@@ -0,0 +1,75 @@
+// +build freebsd openbsd
+
+package elasticapm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"runtime"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+func readProcessMetrics(pm *processMetrics) error {
+	var rusage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &rusage); err != nil {
+		return err
+	}
+	pm.cpuTotal = time.Duration(rusage.Utime.Nano() + rusage.Stime.Nano())
+
+	physmem, err := sysctlUint64("hw.physmem")
+	if err != nil {
+		return err
+	}
+	pm.systemMemoryTotal = physmem
+
+	if runtime.GOOS == "freebsd" {
+		// OpenBSD exposes free memory only via the vm.uvmexp
+		// structure, which the syscall package cannot query
+		// by name; it is omitted there.
+		freePages, err := syscall.SysctlUint32("vm.stats.vm.v_free_count")
+		if err != nil {
+			return err
+		}
+		pageSize, err := syscall.SysctlUint32("hw.pagesize")
+		if err != nil {
+			return err
+		}
+		pm.systemMemoryFree = uint64(freePages) * uint64(pageSize)
+	}
+	return nil
+}
+
+// nativeEndian is the byte order of the host, in which
+// sysctl integer values are encoded.
+var nativeEndian binary.ByteOrder = binary.LittleEndian
+
+func init() {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 0 {
+		nativeEndian = binary.BigEndian
+	}
+}
+
+// sysctlUint64 returns the value of the named integer sysctl, which
+// may be either 32 or 64 bits wide.
+func sysctlUint64(name string) (uint64, error) {
+	value, err := syscall.Sysctl(name)
+	if err != nil {
+		return 0, err
+	}
+	// syscall.Sysctl strips a trailing NUL byte, so the value
+	// may be shorter than the integer's width. The stripped byte
+	// is always the last, so padding the value back to its width
+	// restores it, whatever the byte order.
+	var buf [8]byte
+	copy(buf[:], value)
+	switch {
+	case len(value) <= 4:
+		return uint64(nativeEndian.Uint32(buf[:4])), nil
+	case len(value) <= 8:
+		return nativeEndian.Uint64(buf[:]), nil
+	}
+	return 0, fmt.Errorf("unexpected size for sysctl %s: %d", name, len(value))
+}
@@ -0,0 +1,115 @@
+package elasticapm
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// userHZ is the number of clock ticks per second used for reporting
+// CPU times in /proc. This is fixed at 100 on all supported
+// architectures, and cannot be queried without cgo.
+const userHZ = 100
+
+func readProcessMetrics(pm *processMetrics) error {
+	if err := readProcSelfStat(pm); err != nil {
+		return err
+	}
+	if fds, err := ioutil.ReadDir("/proc/self/fd"); err == nil {
+		pm.handles = len(fds)
+	}
+	return readProcMeminfo(pm)
+}
+
+func readProcSelfStat(pm *processMetrics) error {
+	data, err := ioutil.ReadFile("/proc/self/stat")
+	if err != nil {
+		return err
+	}
+	// The process name, field 2, is enclosed in parentheses and
+	// may contain spaces; the remaining fields follow the last ')'.
+	i := bytes.LastIndexByte(data, ')')
+	if i == -1 {
+		return fmt.Errorf("failed to parse /proc/self/stat")
+	}
+	// fields[0] is field 3 (state).
+	fields := strings.Fields(string(data[i+1:]))
+	if len(fields) < 22 {
+		return fmt.Errorf("failed to parse /proc/self/stat: too few fields")
+	}
+	parseField := func(field int) (uint64, error) {
+		return strconv.ParseUint(fields[field-3], 10, 64)
+	}
+	utime, err := parseField(14)
+	if err != nil {
+		return err
+	}
+	stime, err := parseField(15)
+	if err != nil {
+		return err
+	}
+	vsize, err := parseField(23)
+	if err != nil {
+		return err
+	}
+	rss, err := parseField(24)
+	if err != nil {
+		return err
+	}
+	pm.cpuTotal = time.Duration(utime+stime) * time.Second / userHZ
+	pm.memorySize = vsize
+	pm.memoryRSS = rss * uint64(os.Getpagesize())
+	return nil
+}
+
+func readProcMeminfo(pm *processMetrics) error {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var haveAvailable bool
+	var free, buffers, cached uint64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		if len(fields) == 3 && fields[2] == "kB" {
+			value *= 1024
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			pm.systemMemoryTotal = value
+		case "MemAvailable:":
+			pm.systemMemoryFree = value
+			haveAvailable = true
+		case "MemFree:":
+			free = value
+		case "Buffers:":
+			buffers = value
+		case "Cached:":
+			cached = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if !haveAvailable {
+		// MemAvailable was introduced in Linux 3.14;
+		// approximate it for older kernels.
+		pm.systemMemoryFree = free + buffers + cached
+	}
+	return nil
+}
@@ -0,0 +1,7 @@
+// +build !linux,!windows,!freebsd,!openbsd
+
+package elasticapm
+
+func readProcessMetrics(*processMetrics) error {
+	return errProcessMetricsUnsupported
+}
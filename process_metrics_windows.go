@@ -0,0 +1,92 @@
+package elasticapm
+
+import (
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+var (
+	modkernel32 = syscall.NewLazyDLL("kernel32.dll")
+	modpsapi    = syscall.NewLazyDLL("psapi.dll")
+
+	procGetProcessHandleCount = modkernel32.NewProc("GetProcessHandleCount")
+	procGlobalMemoryStatusEx  = modkernel32.NewProc("GlobalMemoryStatusEx")
+	procGetProcessMemoryInfo  = modpsapi.NewProc("GetProcessMemoryInfo")
+)
+
+// processMemoryCounters is PROCESS_MEMORY_COUNTERS.
+type processMemoryCounters struct {
+	cb                         uint32
+	PageFaultCount             uint32
+	PeakWorkingSetSize         uintptr
+	WorkingSetSize             uintptr
+	QuotaPeakPagedPoolUsage    uintptr
+	QuotaPagedPoolUsage        uintptr
+	QuotaPeakNonPagedPoolUsage uintptr
+	QuotaNonPagedPoolUsage     uintptr
+	PagefileUsage              uintptr
+	PeakPagefileUsage          uintptr
+}
+
+// memoryStatusEx is MEMORYSTATUSEX.
+type memoryStatusEx struct {
+	length               uint32
+	MemoryLoad           uint32
+	TotalPhys            uint64
+	AvailPhys            uint64
+	TotalPageFile        uint64
+	AvailPageFile        uint64
+	TotalVirtual         uint64
+	AvailVirtual         uint64
+	AvailExtendedVirtual uint64
+}
+
+func readProcessMetrics(pm *processMetrics) error {
+	// The pseudo handle returned by GetCurrentProcess
+	// need not be closed.
+	process, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return err
+	}
+
+	var creation, exit, kernel, user syscall.Filetime
+	if err := syscall.GetProcessTimes(process, &creation, &exit, &kernel, &user); err != nil {
+		return err
+	}
+	pm.cpuTotal = filetimeDuration(kernel) + filetimeDuration(user)
+
+	counters := processMemoryCounters{cb: uint32(unsafe.Sizeof(processMemoryCounters{}))}
+	if r1, _, err := procGetProcessMemoryInfo.Call(
+		uintptr(process),
+		uintptr(unsafe.Pointer(&counters)),
+		uintptr(counters.cb),
+	); r1 == 0 {
+		return err
+	}
+	pm.memorySize = uint64(counters.PagefileUsage)
+	pm.memoryRSS = uint64(counters.WorkingSetSize)
+
+	var handles uint32
+	if r1, _, _ := procGetProcessHandleCount.Call(
+		uintptr(process),
+		uintptr(unsafe.Pointer(&handles)),
+	); r1 != 0 {
+		pm.handles = int(handles)
+	}
+
+	status := memoryStatusEx{length: uint32(unsafe.Sizeof(memoryStatusEx{}))}
+	if r1, _, err := procGlobalMemoryStatusEx.Call(uintptr(unsafe.Pointer(&status))); r1 == 0 {
+		return err
+	}
+	pm.systemMemoryTotal = status.TotalPhys
+	pm.systemMemoryFree = status.AvailPhys
+	return nil
+}
+
+// filetimeDuration converts a FILETIME holding a time interval,
+// in units of 100 nanoseconds, to a time.Duration.
+func filetimeDuration(ft syscall.Filetime) time.Duration {
+	n := int64(ft.HighDateTime)<<32 | int64(ft.LowDateTime)
+	return time.Duration(n * 100)
+}
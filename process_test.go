@@ -0,0 +1,85 @@
+package elasticapm_test
+
+import (
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/model"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestTracerProcessMetadata(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.StartTransaction("name", "type").End()
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads, 1)
+	p := payloads[0].Value.(*model.TransactionsPayload).Process
+	require.NotNil(t, p)
+	cwd, err := os.Getwd()
+	require.NoError(t, err)
+	assert.Equal(t, os.Getpid(), p.Pid)
+	assert.Equal(t, cwd, p.Cwd)
+	assert.Equal(t, runtime.GOMAXPROCS(0), p.GOMAXPROCS)
+	assert.Nil(t, p.Supervisor)
+
+	system := payloads[0].Value.(*model.TransactionsPayload).System
+	require.NotNil(t, system)
+	assert.Equal(t, runtime.NumCPU(), system.CPUCount)
+}
+
+func TestTracerProcessArgvSanitized(t *testing.T) {
+	os.Setenv("ELASTIC_APM_SANITIZE_FIELD_NAMES", `test\..*`)
+	defer os.Unsetenv("ELASTIC_APM_SANITIZE_FIELD_NAMES")
+
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.StartTransaction("name", "type").End()
+	tracer.Flush(nil)
+
+	p := transport.Payloads()[0].Value.(*model.TransactionsPayload).Process
+	require.Len(t, p.Argv, len(os.Args))
+	for i, arg := range os.Args[1:] {
+		if strings.HasPrefix(arg, "-test.") && strings.Contains(arg, "=") {
+			assert.Equal(t, arg[:strings.IndexRune(arg, '=')+1]+"[REDACTED]", p.Argv[i+1])
+		}
+	}
+}
+
+func TestTracerChildProcessEnv(t *testing.T) {
+	tracer, err := elasticapm.NewTracer("supervisor", "")
+	require.NoError(t, err)
+	defer tracer.Close()
+
+	// Simulate starting a worker process, with the
+	// environment returned by ChildProcessEnv.
+	for _, kv := range tracer.ChildProcessEnv() {
+		i := strings.IndexRune(kv, '=')
+		os.Setenv(kv[:i], kv[i+1:])
+		defer os.Unsetenv(kv[:i])
+	}
+
+	worker, transport := transporttest.NewRecorderTracer()
+	defer worker.Close()
+	worker.StartTransaction("name", "type").End()
+	worker.Flush(nil)
+
+	p := transport.Payloads()[0].Value.(*model.TransactionsPayload).Process
+	assert.Equal(t, &model.ProcessSupervisor{
+		Pid:         os.Getpid(),
+		ServiceName: "supervisor",
+	}, p.Supervisor)
+
+	inherited, err := elasticapm.NewTracer("", "")
+	require.NoError(t, err)
+	defer inherited.Close()
+	assert.Equal(t, "supervisor", inherited.Service.Name)
+}
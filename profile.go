@@ -0,0 +1,96 @@
+package elasticapm
+
+import (
+	"strings"
+
+	"github.com/elastic/apm-agent-go/internal/apmconfig"
+	"github.com/elastic/apm-agent-go/transport"
+)
+
+// RegisterProfile registers a named configuration profile, such as
+// "prod", "dev", or "load-test", which is selected by setting the
+// ELASTIC_APM_PROFILE environment variable to the profile's name.
+// This allows vetted agent settings to be shipped in a shared library,
+// rather than as a long list of environment variables for each
+// deployment.
+//
+// The settings map ELASTIC_APM_* environment variable names to values.
+// The values are used as defaults for tracers and transports created
+// while the profile is selected; environment variables that are set
+// take precedence. If a profile with the same name is already
+// registered, it is replaced. RegisterProfile will panic if a setting
+// is not an ELASTIC_APM_* environment variable, or is
+// ELASTIC_APM_PROFILE itself.
+//
+// This must not be called concurrently with any other functions or
+// methods in this package; it is expected to be used by init functions.
+// DefaultTracer and transport.Default are created before any other
+// package is initialized, so when the selected profile is registered,
+// transport.Default is recreated, and the profile is applied to
+// DefaultTracer in place, with the exception of ELASTIC_APM_ACTIVE and
+// the ELASTIC_APM_DEBUG settings. If the resulting configuration is
+// invalid, RegisterProfile returns an error, and DefaultTracer and
+// transport.Default are left unchanged.
+func RegisterProfile(name string, settings map[string]string) error {
+	for k := range settings {
+		if !strings.HasPrefix(k, "ELASTIC_APM_") || k == apmconfig.EnvProfile {
+			panic("invalid profile setting " + k)
+		}
+	}
+	apmconfig.RegisterProfile(name, settings)
+	if apmconfig.Profile() != name {
+		return nil
+	}
+	var opts options
+	if err := opts.init(false); err != nil {
+		return err
+	}
+	oldTransport := transport.Default
+	newTransport, err := transport.InitDefault()
+	if err != nil {
+		transport.Default = oldTransport
+		return err
+	}
+	DefaultTracer.applyOptions(opts, oldTransport, newTransport)
+	return nil
+}
+
+// applyOptions applies opts to the running tracer t, replacing its
+// transport with newTransport if it is using oldTransport.
+func (t *Tracer) applyOptions(opts options, oldTransport, newTransport transport.Transport) {
+	t.SetMaxSpans(opts.maxSpans)
+	t.SetSpanSamplingThreshold(opts.spanSamplingThreshold)
+	t.SetRecentTransactions(opts.recentTransactions)
+	t.SetSampler(opts.sampler)
+	t.SetCaptureBody(opts.captureBody)
+	t.SetCaptureHeaders(opts.captureHeaders)
+	t.SetHeaderCaptureFilter(opts.headerCaptureFilter)
+	t.SetSpanFramesMinDuration(opts.spanFramesMinDuration)
+	t.SetMemoryBudget(opts.memoryBudget)
+	t.SetForceSampleSecret(opts.forceSampleSecret)
+	t.SetTrustSamplingPriority(opts.trustSamplingPriority)
+	t.SetSchedulerLatency(opts.schedulerLatency)
+	t.SetSyntheticUserAgents(opts.syntheticUserAgents)
+	t.SetSessionIDHeader(opts.sessionIDHeader)
+	t.SetSessionIDCookie(opts.sessionIDCookie)
+	t.SetBaggageTags(opts.baggageTags)
+	t.SetBreakdownMetrics(opts.breakdownMetrics)
+	t.SetUserAgentParsing(opts.userAgentParsing)
+	t.SetSpanDeadlineBudget(opts.spanDeadlineBudget)
+	t.SetResultMapper(opts.resultMapper)
+	t.SetFailureCapture(opts.failureCapture)
+	t.SetSpanTypeOverrides(opts.spanTypeOverrides)
+	t.setRecordMetrics(opts.metricsInterval)
+	t.sendConfigCommand(func(cfg *tracerConfig) {
+		// The transport, service and process are
+		// only accessed by the tracer's goroutine.
+		opts.setTracerConfig(cfg)
+		if sameTransport(t.Transport, oldTransport) {
+			t.Transport = newTransport
+		}
+		t.Service.Name = opts.serviceName
+		t.Service.Version = opts.serviceVersion
+		t.Service.Environment = opts.serviceEnvironment
+		t.process = newProcess(opts)
+	})
+}
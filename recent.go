@@ -0,0 +1,117 @@
+package elasticapm
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RecentTransaction describes a recently ended, sampled transaction.
+type RecentTransaction struct {
+	// ID holds the transaction ID, which may be used to find
+	// the transaction in the APM UI.
+	ID string
+
+	// Name and Type hold the transaction's name and type.
+	Name string
+	Type string
+
+	// Result holds the transaction's result, e.g. "HTTP 2xx".
+	Result string
+
+	// Timestamp holds the time at which the transaction started.
+	Timestamp time.Time
+
+	// Duration holds the transaction's duration.
+	Duration time.Duration
+}
+
+// SetRecentTransactions sets the number of recently ended, sampled
+// transactions recorded by the tracer, as returned by RecentTransactions.
+// If n is zero, which is the default, no transactions are recorded.
+//
+// Recording a transaction takes a lock shared by all transactions
+// ending concurrently, so recording should be enabled only while
+// it is needed, such as while reproducing an issue.
+//
+// The number may also be set with the ELASTIC_APM_RECENT_TRANSACTIONS
+// environment variable. SetRecentTransactions discards any transactions
+// already recorded.
+func (t *Tracer) SetRecentTransactions(n int) {
+	t.recent.setSize(n)
+}
+
+// RecentTransactions returns the most recently ended, sampled
+// transactions, most recent first. This helps to find a concrete
+// transaction in the APM UI right after reproducing an issue, rather
+// than searching by time range. The transactions may not yet have been
+// sent to the server. See SetRecentTransactions.
+func (t *Tracer) RecentTransactions() []RecentTransaction {
+	return t.recent.list()
+}
+
+// recentTransactions holds a ring of recently ended transactions.
+type recentTransactions struct {
+	// size holds the length of ring, so that add need not take mu
+	// when recording is disabled. size is accessed atomically.
+	size uint32
+
+	mu   sync.Mutex
+	ring []RecentTransaction
+	next int
+	full bool
+}
+
+// setSize discards any recorded transactions, and
+// sets the number of transactions to record to n.
+func (r *recentTransactions) setSize(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ring = nil
+	if n > 0 {
+		r.ring = make([]RecentTransaction, n)
+	}
+	r.next = 0
+	r.full = false
+	atomic.StoreUint32(&r.size, uint32(len(r.ring)))
+}
+
+// add records the ended transaction tx,
+// replacing the least recent one if full.
+func (r *recentTransactions) add(tx *Transaction) {
+	if atomic.LoadUint32(&r.size) == 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.ring) == 0 {
+		return
+	}
+	r.ring[r.next] = RecentTransaction{
+		ID:        tx.ID(),
+		Name:      tx.Name,
+		Type:      tx.Type,
+		Result:    tx.Result,
+		Timestamp: tx.Timestamp,
+		Duration:  tx.Duration,
+	}
+	r.next = (r.next + 1) % len(r.ring)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// list returns the recorded transactions, most recent first.
+func (r *recentTransactions) list() []RecentTransaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := r.next
+	if r.full {
+		n = len(r.ring)
+	}
+	out := make([]RecentTransaction, n)
+	for i := range out {
+		out[i] = r.ring[(r.next-1-i+len(r.ring))%len(r.ring)]
+	}
+	return out
+}
@@ -0,0 +1,66 @@
+package elasticapm_test
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestTracerRecentTransactions(t *testing.T) {
+	tracer, _ := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetRecentTransactions(2)
+	assert.Empty(t, tracer.RecentTransactions())
+
+	var ids []string
+	for _, name := range []string{"one", "two", "three"} {
+		tx := tracer.StartTransaction(name, "type")
+		tx.Result = "success"
+		tx.Duration = time.Second
+		ids = append(ids, tx.ID())
+		tx.End()
+	}
+
+	recent := tracer.RecentTransactions()
+	require.Len(t, recent, 2)
+	assert.Equal(t, ids[2], recent[0].ID)
+	assert.Equal(t, "three", recent[0].Name)
+	assert.Equal(t, "type", recent[0].Type)
+	assert.Equal(t, "success", recent[0].Result)
+	assert.Equal(t, time.Second, recent[0].Duration)
+	assert.Equal(t, ids[1], recent[1].ID)
+	assert.Equal(t, "two", recent[1].Name)
+}
+
+func TestTracerRecentTransactionsUnsampled(t *testing.T) {
+	tracer, _ := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetRecentTransactions(10)
+	tracer.SetSampler(elasticapm.NewRatioSampler(0, rand.NewSource(0)))
+
+	tracer.StartTransaction("name", "type").End()
+	assert.Empty(t, tracer.RecentTransactions())
+}
+
+func TestTracerRecentTransactionsDisabled(t *testing.T) {
+	tracer, _ := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	// Recording is disabled by default.
+	tracer.StartTransaction("name", "type").End()
+	assert.Empty(t, tracer.RecentTransactions())
+
+	tracer.SetRecentTransactions(10)
+	tracer.StartTransaction("name", "type").End()
+	assert.Len(t, tracer.RecentTransactions(), 1)
+	tracer.SetRecentTransactions(0)
+
+	tracer.StartTransaction("name", "type").End()
+	assert.Empty(t, tracer.RecentTransactions())
+}
@@ -0,0 +1,72 @@
+package elasticapm
+
+// ResultInfo describes how a transaction completed, for mapping
+// to a Transaction.Result value with a ResultMapper.
+type ResultInfo struct {
+	// Result holds the result determined by the instrumentation,
+	// e.g. "HTTP 2xx" for HTTP servers, or "Unavailable" for gRPC
+	// servers.
+	Result string
+
+	// StatusCode holds the protocol-specific status code, if any,
+	// e.g. the HTTP response status code, or the gRPC status code.
+	StatusCode int
+
+	// Err holds the error with which the transaction completed,
+	// if any.
+	Err error
+}
+
+// ResultMapper is the type of a function for mapping a ResultInfo
+// to the value recorded in Transaction.Result. If the function
+// returns an empty string, ResultInfo.Result will be recorded.
+type ResultMapper func(ResultInfo) string
+
+// RenameResults returns a ResultMapper which replaces each result
+// that is a key of m with its corresponding value. Other results
+// are recorded unchanged.
+//
+// For example, to record both 2xx and 3xx HTTP responses as
+// "success", use RenameResults(map[string]string{"HTTP 2xx":
+// "success", "HTTP 3xx": "success"}).
+func RenameResults(m map[string]string) ResultMapper {
+	return func(info ResultInfo) string {
+		return m[info.Result]
+	}
+}
+
+// SetResultMapper sets the function used by Transaction.SetResult
+// for mapping results, or removes the mapping if m is nil. This allows
+// results to be standardized across services, e.g. by collapsing HTTP
+// status code classes, or by mapping application-specific errors to
+// their own results.
+//
+// The mapper may also be configured with the
+// ELASTIC_APM_TRANSACTION_RESULT_MAP environment variable, a
+// comma-separated list of "result=replacement" pairs, as described
+// for RenameResults.
+func (t *Tracer) SetResultMapper(m ResultMapper) {
+	t.updateTransactionConfig(func(cfg *transactionConfig) {
+		cfg.resultMapper = m
+	})
+}
+
+// SetResult sets tx.Result to the value returned by the tracer's
+// ResultMapper for info, or info.Result if there is no mapper, or
+// it returns an empty string. If info describes an error or an HTTP
+// 5xx status, the transaction is marked failed; see MarkFailed.
+// Instrumentation modules should use
+// SetResult rather than setting tx.Result directly, so that results
+// are mapped consistently.
+func (tx *Transaction) SetResult(info ResultInfo) {
+	if isFailureResult(info) {
+		tx.MarkFailed()
+	}
+	if tx.resultMapper != nil {
+		if result := tx.resultMapper(info); result != "" {
+			tx.Result = result
+			return
+		}
+	}
+	tx.Result = info.Result
+}
@@ -0,0 +1,50 @@
+package elasticapm_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+var errPaymentDeclined = errors.New("payment declined")
+
+func TestTransactionSetResult(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	tx := tracer.StartTransaction("name", "type")
+	tx.SetResult(elasticapm.ResultInfo{Result: "HTTP 2xx", StatusCode: 200})
+	tx.End()
+
+	rename := elasticapm.RenameResults(map[string]string{
+		"HTTP 2xx": "success",
+		"HTTP 3xx": "success",
+	})
+	tracer.SetResultMapper(func(info elasticapm.ResultInfo) string {
+		if info.Err == errPaymentDeclined {
+			return "payment_declined"
+		}
+		return rename(info)
+	})
+	for _, info := range []elasticapm.ResultInfo{
+		{Result: "HTTP 2xx", StatusCode: 200},
+		{Result: "HTTP 3xx", StatusCode: 304},
+		{Result: "HTTP 4xx", StatusCode: 402, Err: errPaymentDeclined},
+		{Result: "HTTP 5xx", StatusCode: 500},
+	} {
+		tx := tracer.StartTransaction("name", "type")
+		tx.SetResult(info)
+		tx.End()
+	}
+	tracer.Flush(nil)
+
+	var results []string
+	for _, tx := range transport.Payloads()[0].Transactions() {
+		results = append(results, tx.Result)
+	}
+	assert.Equal(t, []string{"HTTP 2xx", "success", "success", "payment_declined", "HTTP 5xx"}, results)
+}
@@ -0,0 +1,82 @@
+package elasticapm
+
+import "context"
+
+// SetSamplingPriority sets the sampling priority of the transaction in
+// ctx, if any. See Transaction.SetSamplingPriority.
+//
+// This is intended to be called early in the handling of a request,
+// once it is known to be business-critical: for example, after
+// identifying a paying customer, or a checkout flow.
+func SetSamplingPriority(ctx context.Context, priority int) {
+	if tx := TransactionFromContext(ctx); tx != nil {
+		tx.SetSamplingPriority(priority)
+	}
+}
+
+// SetSamplingPriority sets the sampling priority of the transaction.
+// If priority is greater than zero, the transaction is upgraded to
+// sampled, regardless of the tracer's sampler. Spans started before
+// the upgrade remain dropped, so SetSamplingPriority should be called
+// as early as possible, and before the transaction is used by other
+// goroutines. Upgraded transactions record baggage tags and scheduler
+// latency as if they had been sampled when started, with scheduler
+// latency measured from the upgrade.
+//
+// A sampling priority of zero or less has no effect on sampling; an
+// already sampled transaction is never downgraded, as its spans may
+// already have been recorded.
+//
+// The sampling priority is propagated to downstream services by
+// module/apmhttp and module/apmgrpc clients, and honoured by services
+// which trust it; see Tracer.SetTrustSamplingPriority.
+func (tx *Transaction) SetSamplingPriority(priority int) {
+	tx.samplingPriority = priority
+	if priority > 0 && !tx.sampled {
+		tx.sampled = true
+		tx.startSampled()
+	}
+}
+
+// SamplingPriority returns the transaction's sampling priority, as set
+// with SetSamplingPriority or WithSamplingPriority. The default is zero.
+func (tx *Transaction) SamplingPriority() int {
+	return tx.samplingPriority
+}
+
+// WithSamplingPriority returns a TransactionOption which sets the
+// transaction's sampling priority. See Transaction.SetSamplingPriority.
+func WithSamplingPriority(priority int) TransactionOption {
+	return func(o *transactionOptions) {
+		o.samplingPriority = priority
+	}
+}
+
+// SetTrustSamplingPriority sets whether or not sampling priorities
+// propagated from upstream services are honoured when starting
+// transactions for incoming requests. By default they are not, as
+// otherwise any client could cause its requests to be fully traced;
+// it should only be enabled for services reached by trusted clients,
+// such as internal services behind a gateway that removes the header.
+//
+// Propagated sampling priorities are checked by instrumentation modules
+// using TrustSamplingPriority. For example, module/apmhttp checks the
+// "Elastic-Apm-Sampling-Priority" request header.
+func (t *Tracer) SetTrustSamplingPriority(trust bool) {
+	t.trustSamplingPriorityMu.Lock()
+	t.trustSamplingPriority = trust
+	t.trustSamplingPriorityMu.Unlock()
+}
+
+// TrustSamplingPriority reports whether or not sampling priorities
+// propagated from upstream services should be honoured, as set with
+// SetTrustSamplingPriority or the ELASTIC_APM_TRUST_SAMPLING_PRIORITY
+// environment variable.
+//
+// Instrumentation modules should pass WithSamplingPriority to
+// StartTransaction if TrustSamplingPriority returns true.
+func (t *Tracer) TrustSamplingPriority() bool {
+	t.trustSamplingPriorityMu.RLock()
+	defer t.trustSamplingPriorityMu.RUnlock()
+	return t.trustSamplingPriority
+}
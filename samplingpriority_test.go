@@ -0,0 +1,88 @@
+package elasticapm_test
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestSetSamplingPriority(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetSampler(elasticapm.NewRatioSampler(0, rand.NewSource(0)))
+
+	tx := tracer.StartTransaction("name", "type")
+	ctx := elasticapm.ContextWithTransaction(context.Background(), tx)
+	span, _ := elasticapm.StartSpan(ctx, "before", "type")
+	assert.True(t, span.Dropped())
+	span.End()
+
+	elasticapm.SetSamplingPriority(ctx, 0)
+	assert.False(t, tx.Sampled())
+	elasticapm.SetSamplingPriority(ctx, 1)
+	assert.True(t, tx.Sampled())
+	assert.Equal(t, 1, tx.SamplingPriority())
+
+	span, _ = elasticapm.StartSpan(ctx, "after", "type")
+	assert.False(t, span.Dropped())
+	span.End()
+	tx.End()
+	tracer.Flush(nil)
+
+	transactions := transport.Payloads()[0].Transactions()
+	require.Len(t, transactions, 1)
+	require.Len(t, transactions[0].Spans, 1)
+	assert.Equal(t, "after", transactions[0].Spans[0].Name)
+
+	// Lowering the priority never unsamples the transaction.
+	tx = tracer.StartTransaction("name", "type", elasticapm.WithSamplingPriority(2))
+	assert.True(t, tx.Sampled())
+	tx.SetSamplingPriority(-1)
+	assert.True(t, tx.Sampled())
+	tx.Discard()
+
+	// No transaction in the context.
+	elasticapm.SetSamplingPriority(context.Background(), 1)
+}
+
+func TestSetSamplingPriorityBaggageTags(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetSampler(elasticapm.NewRatioSampler(0, rand.NewSource(0)))
+	tracer.SetBaggageTags([]string{"tenant"})
+
+	b := elasticapm.Baggage{{Key: "tenant", Value: "acme"}}
+	tx := tracer.StartTransaction("name", "type", elasticapm.WithBaggage(b))
+	assert.False(t, tx.Sampled())
+	tx.SetSamplingPriority(1)
+	tx.End()
+	tracer.Flush(nil)
+
+	transactions := transport.Payloads()[0].Transactions()
+	require.Len(t, transactions, 1)
+	require.NotNil(t, transactions[0].Context)
+	assert.Equal(t, map[string]string{"baggage_tenant": "acme"}, transactions[0].Context.Tags)
+}
+
+func TestTracerTrustSamplingPriorityEnv(t *testing.T) {
+	tracer, err := elasticapm.NewTracer("tracer_testing", "")
+	require.NoError(t, err)
+	assert.False(t, tracer.TrustSamplingPriority())
+	tracer.SetTrustSamplingPriority(true)
+	assert.True(t, tracer.TrustSamplingPriority())
+	tracer.Close()
+
+	os.Setenv("ELASTIC_APM_TRUST_SAMPLING_PRIORITY", "true")
+	defer os.Unsetenv("ELASTIC_APM_TRUST_SAMPLING_PRIORITY")
+	tracer, err = elasticapm.NewTracer("tracer_testing", "")
+	require.NoError(t, err)
+	defer tracer.Close()
+	assert.True(t, tracer.TrustSamplingPriority())
+}
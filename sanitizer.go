@@ -2,6 +2,7 @@ package elasticapm
 
 import (
 	"bytes"
+	"net/http"
 	"regexp"
 
 	"github.com/elastic/apm-agent-go/model"
@@ -9,9 +10,75 @@ import (
 
 const redacted = "[REDACTED]"
 
-// sanitizeRequest sanitizes HTTP request data, redacting
-// the values of cookies and forms whose corresponding keys
+// sanitizeContext sanitizes the HTTP request and response
+// data in c; see sanitizeRequest and sanitizeResponse.
+func sanitizeContext(c *model.Context, re *regexp.Regexp) {
+	if c.Request != nil {
+		sanitizeRequest(c.Request, re)
+	}
+	if c.Response != nil {
+		sanitizeResponse(c.Response, re)
+	}
+}
+
+// sanitizeSpanContext sanitizes the HTTP data in c, redacting
+// the values of captured trailers whose corresponding keys
 // match the given regular expression.
+func sanitizeSpanContext(c *model.SpanContext, re *regexp.Regexp) {
+	if c.HTTP != nil {
+		c.HTTP.Trailers = sanitizeHeader(c.HTTP.Trailers, re)
+	}
+}
+
+// sanitizeResponse sanitizes HTTP response data, redacting
+// the values of captured headers and trailers whose
+// corresponding keys match the given regular expression.
+func sanitizeResponse(r *model.Response, re *regexp.Regexp) {
+	if r.Headers != nil {
+		sanitizeStringMap(r.Headers.Other, re)
+	}
+	r.Trailers = sanitizeHeader(r.Trailers, re)
+}
+
+// sanitizeHeader returns h with the values whose corresponding
+// keys match the given regular expression redacted. Captured
+// headers are owned by the application, so h is copied rather
+// than modified if any values are redacted.
+func sanitizeHeader(h http.Header, re *regexp.Regexp) http.Header {
+	var sanitized http.Header
+	for k := range h {
+		if !re.MatchString(k) {
+			continue
+		}
+		if sanitized == nil {
+			sanitized = make(http.Header, len(h))
+			for k, v := range h {
+				sanitized[k] = v
+			}
+		}
+		sanitized[k] = []string{redacted}
+	}
+	if sanitized == nil {
+		return h
+	}
+	return sanitized
+}
+
+// sanitizeStringMap redacts the values in m whose
+// corresponding keys match the given regular expression.
+func sanitizeStringMap(m model.StringMap, re *regexp.Regexp) {
+	for i, item := range m {
+		if re.MatchString(item.Key) {
+			m[i].Value = redacted
+		}
+	}
+}
+
+// sanitizeRequest sanitizes HTTP request data, redacting the
+// values of cookies, forms, and captured headers and trailers whose
+// corresponding keys match the given regular expression.
+// The names of files in multipart forms are redacted if the
+// form field name matches.
 func sanitizeRequest(r *model.Request, re *regexp.Regexp) {
 	var anyCookiesRedacted bool
 	for _, c := range r.Cookies {
@@ -31,6 +98,10 @@ func sanitizeRequest(r *model.Request, re *regexp.Regexp) {
 		}
 		r.Headers.Cookie = b.String()
 	}
+	if r.Headers != nil {
+		sanitizeStringMap(r.Headers.Other, re)
+	}
+	r.Trailers = sanitizeHeader(r.Trailers, re)
 	if r.Body != nil && r.Body.Form != nil {
 		for key, values := range r.Body.Form {
 			if !re.MatchString(key) {
@@ -40,5 +111,13 @@ func sanitizeRequest(r *model.Request, re *regexp.Regexp) {
 				values[i] = redacted
 			}
 		}
+		for key, files := range r.Body.Files {
+			if !re.MatchString(key) {
+				continue
+			}
+			for i := range files {
+				files[i].Filename = redacted
+			}
+		}
 	}
 }
@@ -1,6 +1,9 @@
 package elasticapm_test
 
 import (
+	"context"
+	"errors"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -8,6 +11,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/elastic/apm-agent-go"
 	"github.com/elastic/apm-agent-go/model"
 	"github.com/elastic/apm-agent-go/module/apmhttp"
 	"github.com/elastic/apm-agent-go/transport/transporttest"
@@ -54,6 +58,102 @@ func TestSanitizeRequest(t *testing.T) {
 	)
 }
 
+func TestSanitizeErrorRequestHeaders(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetHeaderCaptureFilter(elasticapm.HeaderCaptureFilter{Include: []string{"X-Api-Key", "X-Request-Id"}})
+
+	req, _ := http.NewRequest("GET", "http://server.testing/", nil)
+	req.Header.Set("X-Api-Key", "hunter2")
+	req.Header.Set("X-Request-Id", "123")
+	req.AddCookie(&http.Cookie{Name: "secret", Value: "top"})
+	e := tracer.NewError(errors.New("boom"))
+	e.Context.SetHTTPRequest(req)
+	e.Send()
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads, 1)
+	errs := payloads[0].Errors()
+	require.Len(t, errs, 1)
+	request := errs[0].Context.Request
+	assert.Equal(t, model.StringMap{
+		{Key: "x-api-key", Value: "[REDACTED]"},
+		{Key: "x-request-id", Value: "123"},
+	}, request.Headers.Other)
+	assert.Equal(t, model.Cookies{{Name: "secret", Value: "[REDACTED]"}}, request.Cookies)
+}
+
+func TestSanitizeResponseHeaders(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetHeaderCaptureFilter(elasticapm.HeaderCaptureFilter{Include: []string{"X-Auth-Token", "X-Request-Id"}})
+
+	h := apmhttp.Wrap(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("X-Auth-Token", "hunter2")
+		w.Header().Set("X-Request-Id", "123")
+	}), apmhttp.WithTracer(tracer))
+	req, _ := http.NewRequest("GET", "http://server.testing/", nil)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads, 1)
+	transactions := payloads[0].Transactions()
+	require.Len(t, transactions, 1)
+	assert.Equal(t, model.StringMap{
+		{Key: "x-auth-token", Value: "[REDACTED]"},
+		{Key: "x-request-id", Value: "123"},
+	}, transactions[0].Context.Response.Headers.Other)
+}
+
+func TestSanitizeTrailers(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	server := httptest.NewServer(apmhttp.Wrap(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Trailer", "X-Auth-Token, X-Request-Id")
+		w.Write([]byte("bar"))
+		w.Header().Set("X-Auth-Token", "hunter2")
+		w.Header().Set("X-Request-Id", "123")
+	}), apmhttp.WithTracer(tracer), apmhttp.WithServerTrailers()))
+	defer server.Close()
+
+	tx := tracer.StartTransaction("name", "type")
+	ctx := elasticapm.ContextWithTransaction(context.Background(), tx)
+	client := apmhttp.WrapClient(http.DefaultClient, apmhttp.WithClientTrailers())
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	resp, err := client.Do(req.WithContext(ctx))
+	require.NoError(t, err)
+	_, err = ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	tx.End()
+	tracer.Flush(nil)
+
+	// The application's trailers must not be modified.
+	assert.Equal(t, "hunter2", resp.Trailer.Get("X-Auth-Token"))
+
+	expected := http.Header{
+		"X-Auth-Token": {"[REDACTED]"},
+		"X-Request-Id": {"123"},
+	}
+	var serverTx, clientTx model.Transaction
+	for _, p := range transport.Payloads() {
+		for _, tx := range p.Transactions() {
+			if tx.Name == "name" {
+				clientTx = tx
+			} else {
+				serverTx = tx
+			}
+		}
+	}
+	require.Len(t, clientTx.Spans, 1)
+	assert.Equal(t, expected, clientTx.Spans[0].Context.HTTP.Trailers)
+	require.NotNil(t, serverTx.Context)
+	assert.Equal(t, expected, serverTx.Context.Response.Trailers)
+}
+
 func TestSetSanitizedFieldNamesNone(t *testing.T) {
 	testSetSanitizedFieldNames(t, "top")
 }
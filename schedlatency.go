@@ -0,0 +1,50 @@
+package elasticapm
+
+import "time"
+
+// schedLatencyMarkGroup is the group of the transaction marks
+// recording scheduler latency. See Tracer.SetSchedulerLatency.
+const schedLatencyMarkGroup = "scheduler_latency"
+
+// schedLatencyStats holds scheduler latency statistics
+// derived from the difference between two snapshots.
+type schedLatencyStats struct {
+	mean time.Duration
+	p99  time.Duration
+	max  time.Duration
+}
+
+// SetSchedulerLatency sets whether or not sampled transactions record
+// the Go scheduler's latency while they run: the time goroutines spent
+// runnable, but waiting to run. This helps to explain transactions which
+// are slow without any span accounting for the time, which is frequently
+// due to scheduler starvation, e.g. CPU throttling or too few Ps for the
+// number of runnable goroutines.
+//
+// The latency is recorded as the transaction marks "mean", "p99", and
+// "max" in the "scheduler_latency" group. The runtime measures latency
+// for all goroutines in the process, so the marks describe the scheduler
+// as a whole while the transaction ran, rather than the transaction's
+// own goroutines. Marks are recorded only if goroutines were scheduled
+// while the transaction ran.
+//
+// Scheduler latency requires Go 1.17 or newer; with older versions of
+// Go, SetSchedulerLatency has no effect. By default, scheduler latency
+// is not recorded.
+func (t *Tracer) SetSchedulerLatency(enabled bool) {
+	t.updateTransactionConfig(func(cfg *transactionConfig) {
+		cfg.schedulerLatency = enabled
+	})
+}
+
+// markSchedLatency records the scheduler latency since the transaction
+// started as transaction marks.
+func (tx *Transaction) markSchedLatency() {
+	stats, ok := schedLatencySince(tx.schedLatencyStart)
+	if !ok {
+		return
+	}
+	tx.SetMark(schedLatencyMarkGroup, "mean", stats.mean)
+	tx.SetMark(schedLatencyMarkGroup, "p99", stats.p99)
+	tx.SetMark(schedLatencyMarkGroup, "max", stats.max)
+}
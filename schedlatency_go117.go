@@ -0,0 +1,77 @@
+// +build go1.17
+
+package elasticapm
+
+import (
+	"math"
+	"runtime/metrics"
+	"time"
+)
+
+const schedLatencyMetric = "/sched/latencies:seconds"
+
+// schedLatencySnapshot holds the runtime's scheduler latency histogram.
+type schedLatencySnapshot struct {
+	counts  []uint64
+	buckets []float64
+}
+
+// readSchedLatency returns a snapshot of the runtime's scheduler
+// latency histogram, or nil if it is unavailable.
+func readSchedLatency() *schedLatencySnapshot {
+	sample := []metrics.Sample{{Name: schedLatencyMetric}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindFloat64Histogram {
+		return nil
+	}
+	h := sample[0].Value.Float64Histogram()
+	return &schedLatencySnapshot{counts: h.Counts, buckets: h.Buckets}
+}
+
+// schedLatencySince returns statistics for the scheduler latencies
+// recorded since the start snapshot was taken. The statistics are
+// estimated from the histogram buckets, and ok is false if no
+// latencies have been recorded.
+func schedLatencySince(start *schedLatencySnapshot) (stats schedLatencyStats, ok bool) {
+	end := readSchedLatency()
+	if end == nil || len(end.counts) != len(start.counts) {
+		return schedLatencyStats{}, false
+	}
+	delta := make([]uint64, len(end.counts))
+	var total uint64
+	for i, count := range end.counts {
+		delta[i] = count - start.counts[i]
+		total += delta[i]
+	}
+	if total == 0 {
+		return schedLatencyStats{}, false
+	}
+
+	var sum float64
+	var cumulative uint64
+	p99Count := uint64(math.Ceil(float64(total) * 0.99))
+	for i, count := range delta {
+		if count == 0 {
+			continue
+		}
+		lower, upper := end.buckets[i], end.buckets[i+1]
+		if math.IsInf(lower, -1) {
+			lower = upper
+		}
+		if math.IsInf(upper, 1) {
+			upper = lower
+		}
+		sum += float64(count) * (lower + upper) / 2
+		if cumulative < p99Count && cumulative+count >= p99Count {
+			stats.p99 = secondsDuration(upper)
+		}
+		cumulative += count
+		stats.max = secondsDuration(upper)
+	}
+	stats.mean = secondsDuration(sum / float64(total))
+	return stats, true
+}
+
+func secondsDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
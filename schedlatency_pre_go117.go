@@ -0,0 +1,15 @@
+// +build !go1.17
+
+package elasticapm
+
+// schedLatencySnapshot is empty, as the runtime does not expose
+// scheduler latency before Go 1.17.
+type schedLatencySnapshot struct{}
+
+func readSchedLatency() *schedLatencySnapshot {
+	return nil
+}
+
+func schedLatencySince(start *schedLatencySnapshot) (schedLatencyStats, bool) {
+	return schedLatencyStats{}, false
+}
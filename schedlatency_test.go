@@ -0,0 +1,80 @@
+// +build go1.17
+
+package elasticapm_test
+
+import (
+	"math/rand"
+	"os"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestTracerSchedulerLatency(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	tx := tracer.StartTransaction("disabled", "type")
+	tx.End()
+
+	tracer.SetSchedulerLatency(true)
+	tx = tracer.StartTransaction("enabled", "type")
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runtime.Gosched()
+		}()
+	}
+	wg.Wait()
+	tx.End()
+	tracer.Flush(nil)
+
+	transactions := transport.Payloads()[0].Transactions()
+	require.Len(t, transactions, 2)
+	assert.NotContains(t, transactions[0].Marks, "scheduler_latency")
+	require.Contains(t, transactions[1].Marks, "scheduler_latency")
+	marks := transactions[1].Marks["scheduler_latency"]
+	assert.Contains(t, marks, "mean")
+	assert.True(t, marks["p99"] <= marks["max"])
+}
+
+func TestTracerSchedulerLatencySamplingPriority(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetSchedulerLatency(true)
+	tracer.SetSampler(elasticapm.NewRatioSampler(0, rand.NewSource(0)))
+
+	tx := tracer.StartTransaction("name", "type")
+	tx.SetSamplingPriority(1)
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runtime.Gosched()
+		}()
+	}
+	wg.Wait()
+	tx.End()
+	tracer.Flush(nil)
+
+	transactions := transport.Payloads()[0].Transactions()
+	require.Len(t, transactions, 1)
+	assert.Contains(t, transactions[0].Marks, "scheduler_latency")
+}
+
+func TestTracerSchedulerLatencyEnvInvalid(t *testing.T) {
+	os.Setenv("ELASTIC_APM_SCHEDULER_LATENCY", "maybe")
+	defer os.Unsetenv("ELASTIC_APM_SCHEDULER_LATENCY")
+
+	_, err := elasticapm.NewTracer("tracer_testing", "")
+	assert.EqualError(t, err, `failed to parse ELASTIC_APM_SCHEDULER_LATENCY: strconv.ParseBool: parsing "maybe": invalid syntax`)
+}
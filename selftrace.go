@@ -0,0 +1,101 @@
+package elasticapm
+
+import (
+	"context"
+	"math"
+
+	"github.com/elastic/apm-agent-go/model"
+	"github.com/elastic/apm-agent-go/transport"
+)
+
+const (
+	// selfTracingServiceSuffix is appended to the service name
+	// of the traced application to form the service name used
+	// for the agent's own transactions.
+	selfTracingServiceSuffix = "-apm-agent"
+
+	// selfTracingTransactionType is the transaction type used
+	// for the agent's own transactions.
+	selfTracingTransactionType = "apm-agent"
+)
+
+// newSelfTracer returns a new Tracer for tracing the operations of t,
+// such as building and sending payloads, and gathering metrics.
+//
+// The self-tracer reports to the same server as t, using t.Transport,
+// under a service name derived from t's. The self-tracer does not trace
+// itself, does not report metrics, and does not capture stack traces.
+func newSelfTracer(t *Tracer, opts options) *Tracer {
+	opts.selfTracing = false
+	opts.serviceName = t.Service.Name + selfTracingServiceSuffix
+	opts.metricsInterval = 0
+	opts.sampler = nil
+	opts.reportDependencies = false
+	opts.pipelineDepth = 1
+	opts.spanFramesMinDuration = math.MaxInt64
+	self := newTracer(opts)
+	self.Transport = selfTracerTransport{t}
+	return self
+}
+
+// selfTracerTransport is a transport.Transport which sends
+// the self-tracer's payloads using the traced tracer's Transport,
+// so that changes to the latter are honoured.
+type selfTracerTransport struct {
+	tracer *Tracer
+}
+
+func (t selfTracerTransport) SendTransactions(ctx context.Context, p *model.TransactionsPayload) error {
+	return t.tracer.Transport.SendTransactions(ctx, p)
+}
+
+func (t selfTracerTransport) SendErrors(ctx context.Context, p *model.ErrorsPayload) error {
+	return t.tracer.Transport.SendErrors(ctx, p)
+}
+
+func (t selfTracerTransport) SendMetrics(ctx context.Context, p *model.MetricsPayload) error {
+	return t.tracer.Transport.SendMetrics(ctx, p)
+}
+
+var _ transport.Transport = selfTracerTransport{}
+
+// startSelfTransaction starts a transaction with the given name in
+// the self-tracer, if self-tracing is enabled. If self-tracing is
+// disabled, startSelfTransaction returns nil.
+func (s *sender) startSelfTransaction(name string) *Transaction {
+	if s.tracer.self == nil {
+		return nil
+	}
+	return s.tracer.self.StartTransaction(name, selfTracingTransactionType)
+}
+
+// startSelfSpan starts a span with the given name in tx, which may be
+// nil if self-tracing is disabled. The span must be ended with
+// endSelfSpan.
+func startSelfSpan(tx *Transaction, name string) *Span {
+	if tx == nil {
+		return nil
+	}
+	return tx.StartSpan(name, selfTracingTransactionType, nil)
+}
+
+// endSelfSpan ends span, if it is non-nil.
+func endSelfSpan(span *Span) {
+	if span != nil {
+		span.End()
+	}
+}
+
+// endSelfTransaction sets the result of tx according to err,
+// and ends tx, if it is non-nil.
+func endSelfTransaction(tx *Transaction, err error) {
+	if tx == nil {
+		return
+	}
+	if err != nil {
+		tx.Result = "failure"
+	} else {
+		tx.Result = "success"
+	}
+	tx.End()
+}
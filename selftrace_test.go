@@ -0,0 +1,54 @@
+package elasticapm_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/internal/apmdebug"
+	"github.com/elastic/apm-agent-go/model"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestTracerSelfTracing(t *testing.T) {
+	apmdebug.SelfTracing = true
+	defer func() { apmdebug.SelfTracing = false }()
+
+	tracer, err := elasticapm.NewTracer("tracer_testing", "")
+	require.NoError(t, err)
+	defer tracer.Close()
+	var transport transporttest.RecorderTransport
+	tracer.Transport = &transport
+
+	tracer.StartTransaction("name", "type").End()
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads, 2)
+	p0 := payloads[0].Value.(*model.TransactionsPayload)
+	p1 := payloads[1].Value.(*model.TransactionsPayload)
+	assert.Equal(t, "tracer_testing", p0.Service.Name)
+	assert.Equal(t, "tracer_testing-apm-agent", p1.Service.Name)
+	require.Len(t, p1.Transactions, 1)
+
+	tx := p1.Transactions[0]
+	assert.Equal(t, "send transactions", tx.Name)
+	assert.Equal(t, "apm-agent", tx.Type)
+	assert.Equal(t, "success", tx.Result)
+	require.Len(t, tx.Spans, 2)
+	assert.Equal(t, "build payload", tx.Spans[0].Name)
+	assert.Equal(t, "send payload", tx.Spans[1].Name)
+	assert.Empty(t, tx.Spans[0].Stacktrace)
+	assert.Empty(t, tx.Spans[1].Stacktrace)
+}
+
+func TestTracerSelfTracingDisabled(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	tracer.StartTransaction("name", "type").End()
+	tracer.Flush(nil)
+	assert.Len(t, transport.Payloads(), 1)
+}
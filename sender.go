@@ -5,8 +5,11 @@ import (
 	"sync"
 	"time"
 
+	"github.com/pkg/errors"
+
 	"github.com/elastic/apm-agent-go/model"
 	"github.com/elastic/apm-agent-go/stacktrace"
+	"github.com/elastic/apm-agent-go/transport"
 )
 
 type sender struct {
@@ -15,31 +18,133 @@ type sender struct {
 	stats   *TracerStats
 	metrics Metrics
 
-	modelTransactions []model.Transaction
-	modelSpans        []model.Span
-	modelStacktrace   []model.StacktraceFrame
+	serverVersion serverVersionCache
+
+	// tagValues records the distinct values of each tag key,
+	// for enforcing TagValueLimits.MaxCardinality.
+	tagValues map[string]map[string]struct{}
+
+	// dependenciesReported records whether the service's
+	// dependencies have been sent to the server.
+	dependenciesReported bool
+
+	transactionsBuffer transactionsBuffer
+	stacktraces        stacktraceCache
+	spanCompressor     spanCompressor
+
+	workers backgroundWorkers
+	breaker circuitBreaker
 }
 
 // sendTransactions attempts to send enqueued transactions to the APM server,
-// returning true if the transactions were successfully sent.
-func (s *sender) sendTransactions(ctx context.Context, transactions []*Transaction) bool {
+// returning the number of transactions, from the start of transactions,
+// which were sent or intentionally excluded from the payload. The caller
+// is responsible for recycling those transactions; the remainder should
+// be sent again.
+func (s *sender) sendTransactions(ctx context.Context, transactions []*Transaction) int {
 	if len(transactions) == 0 {
-		return false
+		return 0
 	}
+	s.workers.yield()
+	self := s.startSelfTransaction("send transactions")
+	buf := &s.transactionsBuffer
+	span := startSelfSpan(self, "build payload")
+	built := s.buildTransactionsPayload(ctx, transactions, buf)
+	endSelfSpan(span)
+	if !built {
+		s.recordUnsentTransactions(buf)
+		endSelfTransaction(self, nil)
+		return len(transactions)
+	}
+	span = startSelfSpan(self, "send payload")
+	err := s.tracer.Transport.SendTransactions(ctx, &buf.payload)
+	endSelfSpan(span)
+	endSelfTransaction(self, err)
+	return s.transactionsSent(buf, len(transactions), err)
+}
 
-	s.modelTransactions = s.modelTransactions[:0]
-	s.modelSpans = s.modelSpans[:0]
-	s.modelStacktrace = s.modelStacktrace[:0]
+// transactionsBuffer holds the model values for a transactions payload,
+// so they may be reused for subsequent payloads.
+type transactionsBuffer struct {
+	transactions []model.Transaction
+	spans        []model.Span
+	stacktrace   []model.StacktraceFrame
+	service      model.Service
+	payload      model.TransactionsPayload
+
+	// unsent holds the number of transactions intentionally
+	// excluded from the payload, and dropped the number dropped
+	// due to their timestamps. timestampsOutOfRange holds the
+	// number with timestamps outside the limits.
+	unsent               uint64
+	dropped              uint64
+	timestampsOutOfRange uint64
+
+	// marks holds a transactionsMark for each transaction in
+	// the payload, in order.
+	marks []transactionsMark
+}
+
+// transactionsMark records the index of a transaction in the payload
+// within the enqueued transactions, and the number of transactions
+// excluded from the payload before it. If only the transactions before
+// it are sent, the mark identifies the transactions to retry, and the
+// exclusions to record.
+type transactionsMark struct {
+	index                int
+	unsent               uint64
+	dropped              uint64
+	timestampsOutOfRange uint64
+}
+
+// buildTransactionsPayload builds the payload for sending transactions
+// in buf.payload, returning false if there are no transactions to send.
+func (s *sender) buildTransactionsPayload(ctx context.Context, transactions []*Transaction, buf *transactionsBuffer) bool {
+	buf.transactions = buf.transactions[:0]
+	buf.spans = buf.spans[:0]
+	buf.stacktrace = buf.stacktrace[:0]
+	buf.marks = buf.marks[:0]
+	buf.unsent = 0
+	buf.dropped = 0
+	buf.timestampsOutOfRange = 0
+	if s.stacktraces == nil {
+		s.stacktraces = make(stacktraceCache)
+	}
+	defer s.stacktraces.reset()
 	var spanOffset int
 	var stacktraceOffset int
 
-	for _, tx := range transactions {
-		s.modelTransactions = append(s.modelTransactions, model.Transaction{
+	dropUnsampled := s.dropUnsampled(ctx)
+	features := s.spanContextFeatures(ctx)
+	droppedSpansStats := s.serverSupports(ctx, featureDroppedSpansStats)
+	timestamps := s.newTimestampAdjuster()
+	spanCompression := s.cfg.spanCompression
+	if spanCompression.enabled && !s.serverSupports(ctx, featureCompositeSpans) {
+		spanCompression.enabled = false
+	}
+	for i, tx := range transactions {
+		if dropUnsampled && !tx.Sampled() {
+			buf.unsent++
+			continue
+		}
+		mark := transactionsMark{
+			index:                i,
+			unsent:               buf.unsent,
+			dropped:              buf.dropped,
+			timestampsOutOfRange: timestamps.outOfRange,
+		}
+		timestamp, ok := timestamps.adjust(tx.Timestamp)
+		if !ok {
+			buf.dropped++
+			continue
+		}
+		buf.marks = append(buf.marks, mark)
+		buf.transactions = append(buf.transactions, model.Transaction{
 			Name:      truncateString(tx.Name),
 			Type:      truncateString(tx.Type),
 			ID:        tx.id,
 			Result:    truncateString(tx.Result),
-			Timestamp: model.Time(tx.Timestamp.UTC()),
+			Timestamp: model.Time(timestamp.UTC()),
 			Duration:  tx.Duration.Seconds() * 1000,
 			SpanCount: model.SpanCount{
 				Dropped: model.SpanCountDropped{
@@ -47,70 +152,171 @@ func (s *sender) sendTransactions(ctx context.Context, transactions []*Transacti
 				},
 			},
 		})
-		modelTx := &s.modelTransactions[len(s.modelTransactions)-1]
+		modelTx := &buf.transactions[len(buf.transactions)-1]
 		if tx.Sampled() {
 			modelTx.Context = tx.Context.build()
-			if s.cfg.sanitizedFieldNames != nil && modelTx.Context != nil && modelTx.Context.Request != nil {
-				sanitizeRequest(modelTx.Context.Request, s.cfg.sanitizedFieldNames)
+			if s.cfg.sanitizedFieldNames != nil && modelTx.Context != nil {
+				sanitizeContext(modelTx.Context, s.cfg.sanitizedFieldNames)
+			}
+			if modelTx.Context != nil {
+				s.limitTagValues(modelTx.Context.Tags)
 			}
+			modelTx.Marks = tx.buildMarks()
+			if droppedSpansStats {
+				tx.mu.Lock()
+				modelTx.DroppedSpansStats = tx.buildDroppedSpansStats()
+				tx.mu.Unlock()
+			}
+			s.spanCompressor.reset(spanCompression, tx)
 			for _, span := range tx.spans {
-				s.modelSpans = append(s.modelSpans, model.Span{
+				if s.spanCompressor.compress(span) {
+					continue
+				}
+				buf.spans = append(buf.spans, model.Span{
 					ID:       &span.id,
 					Name:     truncateString(span.Name),
 					Type:     truncateString(span.Type),
 					Start:    span.Timestamp.Sub(tx.Timestamp).Seconds() * 1000,
 					Duration: span.Duration.Seconds() * 1000,
-					Context:  span.Context.build(),
+					Context:  features.filter(span.Context.build()),
 				})
-				modelSpan := &s.modelSpans[len(s.modelSpans)-1]
+				modelSpan := &buf.spans[len(buf.spans)-1]
+				s.spanCompressor.added(span, modelSpan)
+				if s.cfg.sanitizedFieldNames != nil && modelSpan.Context != nil {
+					sanitizeSpanContext(modelSpan.Context, s.cfg.sanitizedFieldNames)
+				}
+				if modelSpan.Context != nil {
+					s.limitTagValues(modelSpan.Context.Tags)
+				}
 				if span.parent != -1 {
 					modelSpan.Parent = &span.parent
 				}
-				s.modelStacktrace = appendModelStacktraceFrames(s.modelStacktrace, span.stacktrace)
-				modelSpan.Stacktrace = s.modelStacktrace[stacktraceOffset:]
+				if cached := s.stacktraces.get(span.stacktrace); cached != nil {
+					modelSpan.Stacktrace = cached
+					continue
+				}
+				buf.stacktrace = appendModelStacktraceFrames(buf.stacktrace, span.stacktrace)
+				modelSpan.Stacktrace = buf.stacktrace[stacktraceOffset:]
 				stacktraceOffset += len(span.stacktrace)
 				s.setStacktraceContext(modelSpan.Stacktrace)
+				if len(span.stacktrace) != 0 {
+					s.stacktraces.put(span.stacktrace, modelSpan.Stacktrace)
+				}
 			}
-			modelTx.Spans = s.modelSpans[spanOffset:]
-			spanOffset += len(tx.spans)
+			modelTx.Spans = buf.spans[spanOffset:]
+			spanOffset = len(buf.spans)
 		} else {
 			modelTx.Sampled = &tx.sampled
 		}
 	}
+	buf.timestampsOutOfRange = timestamps.outOfRange
+	if len(buf.transactions) == 0 {
+		return false
+	}
 
-	service := makeService(s.tracer.Service.Name, s.tracer.Service.Version, s.tracer.Service.Environment)
-	payload := model.TransactionsPayload{
-		Service:      &service,
+	buf.service = makeService(s.tracer.Service.Name, s.tracer.Service.Version, s.tracer.Service.Environment)
+	s.setServiceDependencies(&buf.service)
+	buf.payload = model.TransactionsPayload{
+		Service:      &buf.service,
 		Process:      s.tracer.process,
 		System:       s.tracer.system,
-		Transactions: s.modelTransactions,
+		Transactions: buf.transactions,
 	}
+	return true
+}
 
-	if err := s.tracer.Transport.SendTransactions(ctx, &payload); err != nil {
-		if s.cfg.logger != nil {
-			s.cfg.logger.Debugf("sending transactions failed: %s", err)
-		}
+// transactionsSent records the result of sending the transactions
+// payload in buf, built from n enqueued transactions. transactionsSent
+// returns the number of enqueued transactions, from the start, which
+// were sent or intentionally excluded from the payload: n if the payload
+// was sent successfully, and fewer if it was only partially sent.
+// Transactions spooled by the transport are counted separately from
+// those sent, but are not sent again.
+func (s *sender) transactionsSent(buf *transactionsBuffer, n int, err error) int {
+	spooled, err := spooledEvents(err)
+	if err != nil {
+		s.sendFailed("transactions", err)
 		s.stats.Errors.SendTransactions++
-		return false
+		partial, ok := err.(*transport.PartialSendError)
+		if !ok || partial.Sent <= 0 || partial.Sent >= len(buf.marks) {
+			return 0
+		}
+		mark := buf.marks[partial.Sent]
+		s.serviceSent(&buf.service)
+		s.stats.TransactionsSent += uint64(partial.Sent - partial.Spooled)
+		s.stats.TransactionsSpooled += uint64(partial.Spooled)
+		s.stats.TransactionsUnsent += mark.unsent
+		s.stats.TransactionsDropped += mark.dropped
+		s.stats.TimestampsOutOfRange += mark.timestampsOutOfRange
+		return mark.index
 	}
-	s.stats.TransactionsSent += uint64(len(transactions))
-	return true
+	s.serviceSent(&buf.service)
+	s.stats.TransactionsSent += uint64(len(buf.transactions) - spooled)
+	s.stats.TransactionsSpooled += uint64(spooled)
+	s.recordUnsentTransactions(buf)
+	return n
+}
+
+// spooledEvents returns the number of events reported as spooled by
+// err, if it is a *transport.SpooledError, and otherwise returns err.
+// Spooled events will be sent by the transport, and so are handled by
+// the caller as if they had been sent.
+func spooledEvents(err error) (int, error) {
+	if err, ok := err.(*transport.SpooledError); ok {
+		return err.Spooled, nil
+	}
+	return 0, err
+}
+
+// recordUnsentTransactions records the transactions excluded from
+// the payload in buf. This is done only once the payload has been
+// sent, or if there is nothing to send, as the transactions are
+// otherwise retried and would be counted again.
+func (s *sender) recordUnsentTransactions(buf *transactionsBuffer) {
+	s.stats.TransactionsUnsent += buf.unsent
+	s.stats.TransactionsDropped += buf.dropped
+	s.stats.TimestampsOutOfRange += buf.timestampsOutOfRange
 }
 
 // sendErrors attempts to send enqueued errors to the APM server,
-// returning true if the errors were successfully sent.
-func (s *sender) sendErrors(ctx context.Context, errors []*Error) bool {
+// returning the number of errors, from the start of errors, which
+// were sent or dropped. The caller is responsible for recycling
+// those errors; the remainder should be sent again.
+func (s *sender) sendErrors(ctx context.Context, errors []*Error) int {
 	if len(errors) == 0 {
-		return false
+		return 0
 	}
+	s.workers.yield()
+	s.discoverServerVersion(ctx)
+	self := s.startSelfTransaction("send errors")
+	span := startSelfSpan(self, "build payload")
 	service := makeService(s.tracer.Service.Name, s.tracer.Service.Version, s.tracer.Service.Environment)
+	s.setServiceDependencies(&service)
 	payload := model.ErrorsPayload{
 		Service: &service,
 		Process: s.tracer.process,
 		System:  s.tracer.system,
-		Errors:  make([]*model.Error, len(errors)),
+		Errors:  make([]*model.Error, 0, len(errors)),
+	}
+	timestamps := s.newTimestampAdjuster()
+	var dropped uint64
+
+	// marks records, for each error in the payload, its index in
+	// errors and the counts of errors dropped before it, in case
+	// the payload is only partially sent.
+	type errorsMark struct {
+		index                         int
+		dropped, timestampsOutOfRange uint64
 	}
+	marks := make([]errorsMark, 0, len(errors))
 	for i, e := range errors {
+		mark := errorsMark{index: i, dropped: dropped, timestampsOutOfRange: timestamps.outOfRange}
+		timestamp, ok := timestamps.adjust(e.Timestamp)
+		if !ok {
+			dropped++
+			continue
+		}
+		marks = append(marks, mark)
 		if e.Transaction != nil {
 			e.model.Transaction.ID = e.Transaction.id
 		}
@@ -118,20 +324,54 @@ func (s *sender) sendErrors(ctx context.Context, errors []*Error) bool {
 		e.setStacktrace()
 		e.setCulprit()
 		e.model.ID = e.ID
-		e.model.Timestamp = model.Time(e.Timestamp.UTC())
+		e.model.Timestamp = model.Time(timestamp.UTC())
 		e.model.Context = e.Context.build()
+		if s.cfg.sanitizedFieldNames != nil && e.model.Context != nil {
+			sanitizeContext(e.model.Context, s.cfg.sanitizedFieldNames)
+		}
+		if e.model.Context != nil {
+			s.limitTagValues(e.model.Context.Tags)
+		}
 		e.model.Exception.Handled = e.Handled
-		payload.Errors[i] = &e.model
+		payload.Errors = append(payload.Errors, &e.model)
 	}
-	if err := s.tracer.Transport.SendErrors(ctx, &payload); err != nil {
-		if s.cfg.logger != nil {
-			s.cfg.logger.Debugf("sending errors failed: %s", err)
-		}
+	endSelfSpan(span)
+	// Dropped errors are recorded only once the payload has been
+	// sent, as the errors are otherwise retried.
+	recordDropped := func() {
+		s.stats.ErrorsDropped += dropped
+		s.stats.TimestampsOutOfRange += timestamps.outOfRange
+	}
+	if len(payload.Errors) == 0 {
+		recordDropped()
+		endSelfTransaction(self, nil)
+		return len(errors)
+	}
+	span = startSelfSpan(self, "send payload")
+	err := s.tracer.Transport.SendErrors(ctx, &payload)
+	endSelfSpan(span)
+	endSelfTransaction(self, err)
+	spooled, err := spooledEvents(err)
+	if err != nil {
+		s.sendFailed("errors", err)
 		s.stats.Errors.SendErrors++
-		return false
+		partial, ok := err.(*transport.PartialSendError)
+		if !ok || partial.Sent <= 0 || partial.Sent >= len(marks) {
+			return 0
+		}
+		mark := marks[partial.Sent]
+		s.serviceSent(&service)
+		s.stats.ErrorsSent += uint64(partial.Sent - partial.Spooled)
+		s.stats.ErrorsSpooled += uint64(partial.Spooled)
+		s.stats.ErrorsDropped += mark.dropped
+		s.stats.TimestampsOutOfRange += mark.timestampsOutOfRange
+		return mark.index
 	}
-	s.stats.ErrorsSent += uint64(len(errors))
-	return true
+	s.serviceSent(&service)
+	s.stats.ErrorsSent += uint64(len(payload.Errors) - spooled)
+	s.stats.ErrorsSpooled += uint64(spooled)
+	recordDropped()
+	return len(errors)
 }
 
 // gatherMetrics gathers metrics from each of the registered
@@ -143,14 +383,16 @@ func (s *sender) gatherMetrics(ctx context.Context, gathered chan<- struct{}) {
 	// copy of the current config.
 	logger := s.cfg.logger
 
+	self := s.startSelfTransaction("gather metrics")
 	timestamp := model.Time(time.Now().UTC())
 	var group sync.WaitGroup
 	for _, g := range s.cfg.metricsGatherers {
+		g := g
 		group.Add(1)
-		go func(g MetricsGatherer) {
+		s.workers.goFunc(func() {
 			defer group.Done()
 			gatherMetrics(ctx, g, &s.metrics, logger)
-		}(g)
+		})
 	}
 
 	go func() {
@@ -158,6 +400,7 @@ func (s *sender) gatherMetrics(ctx context.Context, gathered chan<- struct{}) {
 		for _, m := range s.metrics.metrics {
 			m.Timestamp = timestamp
 		}
+		endSelfTransaction(self, nil)
 		gathered <- struct{}{}
 	}()
 }
@@ -169,21 +412,45 @@ func (s *sender) sendMetrics(ctx context.Context) {
 	if len(s.metrics.metrics) == 0 {
 		return
 	}
+	s.workers.yield()
+	s.discoverServerVersion(ctx)
+	self := s.startSelfTransaction("send metrics")
 	service := makeService(s.tracer.Service.Name, s.tracer.Service.Version, s.tracer.Service.Environment)
+	s.setServiceDependencies(&service)
+	if timestamps := s.newTimestampAdjuster(); timestamps.offset != 0 {
+		for _, m := range s.metrics.metrics {
+			m.Timestamp = model.Time(time.Time(m.Timestamp).Add(timestamps.offset))
+		}
+	}
 	payload := model.MetricsPayload{
 		Service: &service,
 		Process: s.tracer.process,
 		System:  s.tracer.system,
 		Metrics: s.metrics.metrics,
 	}
-	if err := s.tracer.Transport.SendMetrics(ctx, &payload); err != nil {
-		if s.cfg.logger != nil {
-			s.cfg.logger.Debugf("sending metrics failed: %s", err)
-		}
+	span := startSelfSpan(self, "send payload")
+	err := s.tracer.Transport.SendMetrics(ctx, &payload)
+	endSelfSpan(span)
+	endSelfTransaction(self, err)
+	if err != nil {
+		s.sendFailed("metrics", err)
+	} else {
+		s.serviceSent(&service)
 	}
 	s.metrics.reset()
 }
 
+// sendFailed logs the failure to send a payload, and reports
+// it to the tracer's transport error handler, if any.
+func (s *sender) sendFailed(kind string, err error) {
+	if s.cfg.logger != nil {
+		s.cfg.logger.Debugf("sending %s failed: %s", kind, err)
+	}
+	if s.cfg.transportErrorHandler != nil {
+		s.cfg.transportErrorHandler(errors.Wrapf(err, "sending %s failed", kind))
+	}
+}
+
 func (s *sender) setStacktraceContext(stack []model.StacktraceFrame) {
 	if s.cfg.contextSetter == nil || len(stack) == 0 {
 		return
@@ -0,0 +1,253 @@
+package elasticapm
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/elastic/apm-agent-go/model"
+	"github.com/elastic/apm-agent-go/transport"
+)
+
+const (
+	// serverVersionRetryInterval is the minimum amount of time to wait
+	// before retrying server version discovery after a failure.
+	serverVersionRetryInterval = time.Minute
+
+	// serverVersionTimeout is the maximum amount of time to wait
+	// for each attempt to discover the server version.
+	serverVersionTimeout = 10 * time.Second
+
+	// serverVersionWait is the maximum amount of time the first send
+	// waits for server version discovery to complete. Discovery
+	// continues in the background if it takes longer, and payloads
+	// are sent with all fields in the meantime.
+	serverVersionWait = time.Second
+)
+
+// serverFeature identifies an intake field or behaviour which is
+// not supported by older versions of the APM server.
+type serverFeature struct {
+	major, minor int
+}
+
+var (
+	// featureSpanDestination is the span context
+	// "destination" field.
+	featureSpanDestination = serverFeature{7, 7}
+
+	// featureSpanServiceTarget is the span context
+	// "service.target" field.
+	featureSpanServiceTarget = serverFeature{8, 3}
+
+	// featureDroppedSpansStats is the transaction
+	// "dropped_spans_stats" field.
+	featureDroppedSpansStats = serverFeature{8, 0}
+
+	// featureCompositeSpans is the span "composite"
+	// field, used for span compression.
+	featureCompositeSpans = serverFeature{7, 15}
+)
+
+// ServerVersion returns the version of the APM server, e.g. "7.7.0",
+// as discovered through the tracer's Transport, or the empty string if
+// the version is not yet known.
+//
+// The server version is discovered in the background when the first
+// payload is sent, if the Transport implements transport.ServerVersioner.
+// Fields in the payloads which are not supported by the discovered version
+// of the server are omitted; until the version is discovered, or if it
+// cannot be discovered, all fields are sent.
+func (t *Tracer) ServerVersion() string {
+	t.serverVersionMu.RLock()
+	defer t.serverVersionMu.RUnlock()
+	return t.serverVersion
+}
+
+// serverVersionCache holds the version of the APM server,
+// as discovered through the tracer's Transport.
+type serverVersionCache struct {
+	transport    transport.Transport
+	major, minor int
+	retry        time.Time
+	pending      chan serverVersionResult // discovery in progress
+	waited       bool
+}
+
+type serverVersionResult struct {
+	version string
+	err     error
+}
+
+// discoverServerVersion discovers the version of the APM server,
+// if it is not already known, and it has not failed too recently.
+//
+// Discovery is performed in the background, with a timeout, so that
+// an unreachable server never blocks sending for long. Only the first
+// call for a transport waits for discovery, for up to serverVersionWait;
+// later calls pick up the result if it is available.
+func (s *sender) discoverServerVersion(ctx context.Context) {
+	cache := &s.serverVersion
+	if !sameTransport(cache.transport, s.tracer.Transport) {
+		*cache = serverVersionCache{transport: s.tracer.Transport}
+		s.setServerVersion("")
+	}
+	if cache.major != 0 {
+		return
+	}
+	if cache.pending == nil {
+		if time.Now().Before(cache.retry) {
+			return
+		}
+		versioner, ok := s.tracer.Transport.(transport.ServerVersioner)
+		if !ok {
+			cache.retry = time.Now().Add(serverVersionRetryInterval)
+			return
+		}
+		pending := make(chan serverVersionResult, 1)
+		go func() {
+			ctx, cancel := context.WithTimeout(ctx, serverVersionTimeout)
+			defer cancel()
+			version, err := versioner.ServerVersion(ctx)
+			pending <- serverVersionResult{version: version, err: err}
+		}()
+		cache.pending = pending
+	}
+
+	var wait time.Duration
+	if !cache.waited {
+		cache.waited = true
+		wait = serverVersionWait
+	}
+	result, ok := receiveServerVersion(ctx, cache.pending, wait)
+	if !ok {
+		return
+	}
+	cache.pending = nil
+	version, err := result.version, result.err
+	if err == nil {
+		cache.major, cache.minor, err = parseServerVersion(version)
+	}
+	if err != nil {
+		if s.cfg.logger != nil {
+			s.cfg.logger.Debugf("discovering server version failed: %s", err)
+		}
+		cache.retry = time.Now().Add(serverVersionRetryInterval)
+		return
+	}
+	s.setServerVersion(version)
+}
+
+// receiveServerVersion receives the result of server version discovery
+// from pending, waiting for up to wait, returning false if there is no
+// result in that time or ctx is canceled.
+func receiveServerVersion(ctx context.Context, pending <-chan serverVersionResult, wait time.Duration) (serverVersionResult, bool) {
+	if wait <= 0 {
+		select {
+		case result := <-pending:
+			return result, true
+		default:
+			return serverVersionResult{}, false
+		}
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case result := <-pending:
+		return result, true
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	return serverVersionResult{}, false
+}
+
+func (s *sender) setServerVersion(version string) {
+	s.tracer.serverVersionMu.Lock()
+	s.tracer.serverVersion = version
+	s.tracer.serverVersionMu.Unlock()
+}
+
+// serverVersionAtLeast reports whether the APM server's version is
+// known, and is at least major.minor.
+func (s *sender) serverVersionAtLeast(ctx context.Context, major, minor int) bool {
+	s.discoverServerVersion(ctx)
+	return s.serverVersion.major != 0 && s.serverVersion.atLeast(major, minor)
+}
+
+// serverSupports reports whether the APM server supports the given
+// feature. If the server version is unknown, all features are assumed
+// to be supported.
+func (s *sender) serverSupports(ctx context.Context, f serverFeature) bool {
+	s.discoverServerVersion(ctx)
+	return s.serverVersion.major == 0 || s.serverVersion.atLeast(f.major, f.minor)
+}
+
+func (c *serverVersionCache) atLeast(major, minor int) bool {
+	return c.major > major || c.major == major && c.minor >= minor
+}
+
+// spanContextFeatures records which of the span context fields
+// gated by server version may be sent.
+type spanContextFeatures struct {
+	destination   bool
+	serviceTarget bool
+}
+
+func (s *sender) spanContextFeatures(ctx context.Context) spanContextFeatures {
+	return spanContextFeatures{
+		destination:   s.serverSupports(ctx, featureSpanDestination),
+		serviceTarget: s.serverSupports(ctx, featureSpanServiceTarget),
+	}
+}
+
+// filter returns c, or a copy of c without the fields
+// which the server does not support.
+func (f spanContextFeatures) filter(c *model.SpanContext) *model.SpanContext {
+	if c == nil {
+		return nil
+	}
+	dropDestination := !f.destination && c.Destination != nil
+	dropServiceTarget := !f.serviceTarget && c.Service != nil
+	if !dropDestination && !dropServiceTarget {
+		return c
+	}
+	filtered := *c
+	if dropDestination {
+		filtered.Destination = nil
+	}
+	if dropServiceTarget {
+		filtered.Service = nil
+	}
+	return &filtered
+}
+
+// parseServerVersion parses the major and minor
+// components of a version such as "7.7.0".
+func parseServerVersion(version string) (major, minor int, err error) {
+	parts := strings.SplitN(version, ".", 3)
+	major, err = strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, errors.Wrapf(err, "invalid server version %q", version)
+	}
+	if len(parts) > 1 {
+		if minor, err = strconv.Atoi(parts[1]); err != nil {
+			return 0, 0, errors.Wrapf(err, "invalid server version %q", version)
+		}
+	}
+	return major, minor, nil
+}
+
+// sameTransport reports whether a and b are the same transport. Transports
+// of uncomparable types, e.g. structs with func fields, are never reported
+// as the same, so the server version is rediscovered for them.
+func sameTransport(a, b transport.Transport) bool {
+	t := reflect.TypeOf(a)
+	if t == nil || t != reflect.TypeOf(b) || !t.Comparable() {
+		return false
+	}
+	return a == b
+}
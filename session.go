@@ -0,0 +1,82 @@
+package elasticapm
+
+import "context"
+
+// SessionIDTag is the tag with which a transaction's session ID is
+// recorded, enabling queries for all transactions in a user session.
+const SessionIDTag = "session_id"
+
+// SetSessionID sets the session ID of the transaction in ctx, if any.
+// See Transaction.SetSessionID.
+func SetSessionID(ctx context.Context, id string) {
+	if tx := TransactionFromContext(ctx); tx != nil {
+		tx.SetSessionID(id)
+	}
+}
+
+// SetSessionID sets the ID of the user session to which the transaction
+// belongs, recording it in the SessionIDTag tag of the transaction and
+// of errors captured with it using CaptureError or Tracer.Recovered.
+//
+// The session ID is propagated to downstream services by module/apmhttp
+// and module/apmgrpc clients, so that their transactions are recorded
+// with the same session ID.
+func (tx *Transaction) SetSessionID(id string) {
+	tx.sessionID = id
+	if id != "" {
+		tx.Context.SetTag(SessionIDTag, id)
+	}
+}
+
+// SessionID returns the transaction's session ID, as set with
+// SetSessionID or WithSessionID. The default is the empty string.
+func (tx *Transaction) SessionID() string {
+	return tx.sessionID
+}
+
+// WithSessionID returns a TransactionOption which sets the
+// transaction's session ID. See Transaction.SetSessionID.
+func WithSessionID(id string) TransactionOption {
+	return func(o *transactionOptions) {
+		o.sessionID = id
+	}
+}
+
+// SetSessionIDHeader sets the name of the request header from which
+// instrumentation modules take the session ID of transactions started
+// for incoming requests, e.g. "X-Session-Id". If name is empty, which is
+// the default, no header is used.
+//
+// A session ID propagated by an upstream service's instrumentation
+// takes precedence over the header.
+func (t *Tracer) SetSessionIDHeader(name string) {
+	t.sessionIDMu.Lock()
+	t.sessionIDHeader = name
+	t.sessionIDMu.Unlock()
+}
+
+// SetSessionIDCookie sets the name of the HTTP cookie from which
+// instrumentation modules take the session ID of transactions started
+// for incoming requests, e.g. "JSESSIONID". If name is empty, which is
+// the default, no cookie is used.
+//
+// The session ID header, if set with SetSessionIDHeader and present
+// in the request, takes precedence over the cookie.
+func (t *Tracer) SetSessionIDCookie(name string) {
+	t.sessionIDMu.Lock()
+	t.sessionIDCookie = name
+	t.sessionIDMu.Unlock()
+}
+
+// SessionIDSource returns the names of the request header and cookie
+// from which session IDs should be taken, as set with SetSessionIDHeader
+// and SetSessionIDCookie, or the ELASTIC_APM_SESSION_ID_HEADER and
+// ELASTIC_APM_SESSION_ID_COOKIE environment variables.
+//
+// Instrumentation modules should pass WithSessionID to StartTransaction
+// with the session ID found in the request, if any.
+func (t *Tracer) SessionIDSource() (header, cookie string) {
+	t.sessionIDMu.RLock()
+	defer t.sessionIDMu.RUnlock()
+	return t.sessionIDHeader, t.sessionIDCookie
+}
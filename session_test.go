@@ -0,0 +1,59 @@
+package elasticapm_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestSetSessionID(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	tx := tracer.StartTransaction("name", "type", elasticapm.WithSessionID("abc"))
+	assert.Equal(t, "abc", tx.SessionID())
+	ctx := elasticapm.ContextWithTransaction(context.Background(), tx)
+	elasticapm.SetSessionID(ctx, "def")
+	assert.Equal(t, "def", tx.SessionID())
+	elasticapm.CaptureError(ctx, errors.New("boom")).Send()
+	tx.End()
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads, 2)
+	errs := payloads[0].Errors()
+	require.Len(t, errs, 1)
+	assert.Equal(t, "def", errs[0].Context.Tags[elasticapm.SessionIDTag])
+	transactions := payloads[1].Transactions()
+	require.Len(t, transactions, 1)
+	assert.Equal(t, "def", transactions[0].Context.Tags[elasticapm.SessionIDTag])
+
+	// No transaction in the context.
+	elasticapm.SetSessionID(context.Background(), "abc")
+}
+
+func TestTracerSessionIDSourceEnv(t *testing.T) {
+	os.Setenv("ELASTIC_APM_SESSION_ID_HEADER", "X-Session-Id")
+	defer os.Unsetenv("ELASTIC_APM_SESSION_ID_HEADER")
+	os.Setenv("ELASTIC_APM_SESSION_ID_COOKIE", "sid")
+	defer os.Unsetenv("ELASTIC_APM_SESSION_ID_COOKIE")
+
+	tracer, err := elasticapm.NewTracer("tracer_testing", "")
+	require.NoError(t, err)
+	defer tracer.Close()
+	header, cookie := tracer.SessionIDSource()
+	assert.Equal(t, "X-Session-Id", header)
+	assert.Equal(t, "sid", cookie)
+
+	tracer.SetSessionIDHeader("")
+	header, cookie = tracer.SessionIDSource()
+	assert.Equal(t, "", header)
+	assert.Equal(t, "sid", cookie)
+}
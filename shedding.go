@@ -0,0 +1,50 @@
+package elasticapm
+
+// QueueSheddingMode holds a value indicating which transactions a tracer
+// discards when its transaction queue is full.
+type QueueSheddingMode int
+
+const (
+	// QueueSheddingOldest discards the oldest queued transaction to
+	// make room for each new transaction. This is the default mode.
+	QueueSheddingOldest QueueSheddingMode = iota
+
+	// QueueSheddingPriority discards unsampled transactions before
+	// sampled ones: the oldest queued unsampled transaction is
+	// discarded first, then the new transaction if it is unsampled,
+	// and only then the oldest sampled transaction. Sampled
+	// transactions carry spans and context, so are the most valuable
+	// for diagnosing problems.
+	QueueSheddingPriority
+)
+
+// SetQueueShedding sets the mode with which the tracer chooses which
+// transactions to discard when its transaction queue is full, e.g.
+// because the APM server is unavailable or cannot keep up. Errors are
+// queued separately from transactions, so are never discarded to make
+// room for transactions.
+//
+// The mode may also be configured with the ELASTIC_APM_QUEUE_SHEDDING
+// environment variable.
+func (t *Tracer) SetQueueShedding(mode QueueSheddingMode) {
+	t.sendConfigCommand(func(cfg *tracerConfig) {
+		cfg.queueShedding = mode
+	})
+}
+
+// shedUnsampled makes room in the full queue for tx by discarding the
+// oldest queued unsampled transaction, or tx itself if it is unsampled.
+// shedUnsampled returns the queue and the discarded transaction, which
+// is nil if no transaction could be discarded.
+func shedUnsampled(queue []*Transaction, tx *Transaction) ([]*Transaction, *Transaction) {
+	for i, queued := range queue {
+		if !queued.sampled {
+			copy(queue[i:], queue[i+1:])
+			return queue[:len(queue)-1], queued
+		}
+	}
+	if !tx.sampled {
+		return queue, tx
+	}
+	return queue, nil
+}
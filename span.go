@@ -9,7 +9,8 @@ import (
 
 // droppedSpanPool holds *Spans which are used when the span
 // is created for a nil or non-sampled Transaction, or one
-// whose max spans limit has been reached.
+// whose max spans limit has been reached, or when the span
+// is not sampled within its transaction.
 var droppedSpanPool sync.Pool
 
 // StartSpan starts and returns a new Span within the transaction,
@@ -20,18 +21,57 @@ var droppedSpanPool sync.Pool
 // StartSpan always returns a non-nil Span. Its End method must
 // be called when the span completes.
 func (tx *Transaction) StartSpan(name, spanType string, parent *Span) *Span {
+	return tx.startSpan(name, spanType, parent, false, ServiceTargetSpanContext{})
+}
+
+// StartExitSpan starts and returns a new exit span within the transaction,
+// as with StartSpan. An exit span describes an operation on an external
+// service, such as a database query or an outgoing HTTP request, and its
+// context is set to target the specified service.
+//
+// If the span is dropped due to the transaction's span limits, it is still
+// recorded in the transaction's dropped span statistics, grouped by span
+// type and target service, along with its duration once it is ended.
+func (tx *Transaction) StartExitSpan(name, spanType string, parent *Span, target ServiceTargetSpanContext) *Span {
+	return tx.startSpan(name, spanType, parent, true, target)
+}
+
+func (tx *Transaction) startSpan(name, spanType string, parent *Span, exit bool, target ServiceTargetSpanContext) *Span {
+	auditStartSpan(tx, name, parent)
 	if tx == nil || !tx.Sampled() {
 		return newDroppedSpan()
 	}
 
 	var span *Span
 	tx.mu.Lock()
-	if tx.maxSpans > 0 && len(tx.spans) >= tx.maxSpans {
-		tx.spansDropped++
+	if !tx.failureCaptured(FailureCaptureSpans) && (tx.maxSpans > 0 && len(tx.spans) >= tx.maxSpans || !tx.sampleSpan()) {
+		var key droppedSpansKey
+		if exit {
+			key = droppedSpansKey{spanType: spanType, resource: serviceTargetResource(target)}
+		} else {
+			key = droppedSpansKey{spanType: spanType}
+		}
+		var ref *droppedExitSpansRef
+		if tx.dropSpan(key) && exit {
+			if tx.droppedExitSpans == nil {
+				tx.droppedExitSpans = &droppedExitSpansRef{tx: tx}
+			}
+			ref = tx.droppedExitSpans
+		}
 		tx.mu.Unlock()
-		return newDroppedSpan()
+		span := newDroppedSpan()
+		span.parent = parentSpanID(parent)
+		if ref != nil {
+			span.droppedRef = ref
+			span.droppedKey = key
+			span.Timestamp = tx.clock.Now()
+			span.Duration = -1
+		}
+		return span
+	}
+	if !auditEnabled {
+		span, _ = tx.tracer.spanPool.Get().(*Span)
 	}
-	span, _ = tx.tracer.spanPool.Get().(*Span)
 	if span == nil {
 		span = &Span{
 			Duration: -1,
@@ -45,10 +85,14 @@ func (tx *Transaction) StartSpan(name, spanType string, parent *Span) *Span {
 
 	span.Name = name
 	span.Type = spanType
-	span.Timestamp = time.Now()
-	if parent != nil {
-		span.parent = parent.id
+	span.Timestamp = tx.clock.Now()
+	span.parent = parentSpanID(parent)
+	if exit {
+		span.exit = true
+		span.Context.SetServiceTarget(target)
 	}
+	tx.tracer.leaks.track(span, "span", name, 1)
+	auditSpanStarted(span)
 	return span
 }
 
@@ -63,8 +107,25 @@ type Span struct {
 	Duration  time.Duration
 	Context   SpanContext
 
+	// deadlineRemaining holds the time remaining until the
+	// context deadline when the span started, if deadline
+	// is true. See Tracer.SetSpanDeadlineBudget.
+	deadlineRemaining time.Duration
+	deadline          bool
+
+	// exit records whether the span is an exit span.
+	// See Transaction.StartExitSpan.
+	exit bool
+
+	// droppedRef and droppedKey are set for exit spans dropped
+	// due to the transaction's span limits, so their duration
+	// can be recorded in the dropped span statistics.
+	droppedRef *droppedExitSpansRef
+	droppedKey droppedSpansKey
+
 	mu         sync.Mutex
 	stacktrace []stacktrace.Frame
+	audit      spanAudit
 }
 
 func newDroppedSpan() *Span {
@@ -72,15 +133,31 @@ func newDroppedSpan() *Span {
 	if span == nil {
 		span = &Span{}
 	}
+	span.parent = -1
 	return span
 }
 
+// parentSpanID returns the ID of the nearest recorded ancestor of
+// a span started with the given parent, or -1 if there is none.
+// Dropped spans hold the ID of their own nearest recorded ancestor,
+// so the children of a dropped span are attributed to it.
+func parentSpanID(parent *Span) int64 {
+	if parent == nil {
+		return -1
+	}
+	if parent.Dropped() {
+		return parent.parent
+	}
+	return parent.id
+}
+
 func (s *Span) reset() {
 	*s = Span{
 		Context:    s.Context,
 		Duration:   -1,
 		parent:     -1,
 		stacktrace: s.stacktrace[:0],
+		audit:      s.audit,
 	}
 	s.Context.reset()
 }
@@ -89,7 +166,7 @@ func (s *Span) reset() {
 // skipping the first skip number of frames,
 // excluding the SetStacktrace function.
 func (s *Span) SetStacktrace(skip int) {
-	if s.Dropped() {
+	if !stacktraceEnabled || s.Dropped() {
 		return
 	}
 	s.stacktrace = stacktrace.AppendStacktrace(s.stacktrace[:0], skip+1, -1)
@@ -106,23 +183,80 @@ func (s *Span) Dropped() bool {
 	return s.tx == nil
 }
 
+// IsExitSpan indicates whether or not the span is an exit span,
+// started with Transaction.StartExitSpan or StartExitSpan. Dropped
+// spans are never reported as exit spans.
+func (s *Span) IsExitSpan() bool {
+	return s.exit
+}
+
 // End marks the s as being complete; s must not be used after this.
 //
 // If s.Duration has not been set, End will set it to the elapsed time
 // since s.Timestamp.
 func (s *Span) End() {
 	if s.Dropped() {
+		if s.droppedRef != nil {
+			s.endDroppedExitSpan()
+		}
 		droppedSpanPool.Put(s)
 		return
 	}
+	s.tx.tracer.leaks.untrack(s)
+	auditSpanEnded(s)
 	s.mu.Lock()
 	if s.Duration < 0 {
-		s.Duration = time.Since(s.Timestamp)
+		s.Duration = elapsed(s.tx.clock, s.Timestamp)
 	}
-	if len(s.stacktrace) == 0 && s.Duration >= s.tx.spanFramesMinDuration {
+	if len(s.stacktrace) == 0 && s.wantStacktrace() && !s.tx.tracer.memory.exceeded() {
 		s.SetStacktrace(1)
 	}
+	var lintIssues []SpanLintIssue
+	if s.tx.spanLinter != nil {
+		lintIssues = lintSpan(s)
+	}
 	s.mu.Unlock()
+	if s.deadline {
+		s.setDeadlineTags()
+	}
+	for _, issue := range lintIssues {
+		s.tx.spanLinter(issue)
+	}
+}
+
+// wantStacktrace reports whether a stacktrace should be recorded
+// for the ended span, due either to its duration, or to the failure
+// of its transaction. See FailureCaptureStacktraces.
+func (s *Span) wantStacktrace() bool {
+	if s.Duration >= s.tx.spanFramesMinDuration {
+		return true
+	}
+	if s.tx.failureCapture&FailureCaptureStacktraces == 0 {
+		return false
+	}
+	s.tx.mu.Lock()
+	defer s.tx.mu.Unlock()
+	return s.tx.failureCaptured(FailureCaptureStacktraces)
+}
+
+// endDroppedExitSpan records the duration of a dropped exit span
+// in its transaction's dropped span statistics, unless the
+// transaction has already ended.
+func (s *Span) endDroppedExitSpan() {
+	ref := s.droppedRef
+	ref.mu.Lock()
+	if tx := ref.tx; tx != nil {
+		d := s.Duration
+		if d < 0 {
+			d = elapsed(tx.clock, s.Timestamp)
+		}
+		tx.mu.Lock()
+		tx.recordDroppedSpanDuration(s.droppedKey, d)
+		tx.mu.Unlock()
+	}
+	ref.mu.Unlock()
+	s.droppedRef = nil
+	s.droppedKey = droppedSpansKey{}
 }
 
 func (s *Span) finalize(end time.Time) {
@@ -131,7 +265,8 @@ func (s *Span) finalize(end time.Time) {
 		// s.End was never called, so mark it as truncated and
 		// truncate its duration to the end of the transaction.
 		s.Type += ".truncated"
-		s.Duration = end.Sub(s.Timestamp)
+		s.Duration = nonNegative(end.Sub(s.Timestamp))
+		s.tx.tracer.leaks.untrack(s)
 	}
 	s.mu.Unlock()
 }
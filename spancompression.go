@@ -0,0 +1,168 @@
+package elasticapm
+
+import (
+	"time"
+
+	"github.com/elastic/apm-agent-go/model"
+)
+
+const (
+	compressionStrategyExactMatch = "exact_match"
+	compressionStrategySameKind   = "same_kind"
+
+	defaultSpanCompressionExactMatchMaxDuration = 50 * time.Millisecond
+)
+
+// spanCompressionConfig holds the tracer's span compression configuration.
+type spanCompressionConfig struct {
+	enabled               bool
+	exactMatchMaxDuration time.Duration
+	sameKindMaxDuration   time.Duration
+}
+
+// SetSpanCompression configures the compression of consecutive, similar
+// exit spans into composite spans, reducing the number of spans recorded
+// for code which makes many fast calls to the same database or service,
+// such as N+1 queries or Redis pipelines.
+//
+// Consecutive sibling spans with the same type and destination service,
+// as set with SpanContext.SetServiceTarget or by an instrumentation module,
+// are compressed when their transaction is sent:
+//
+//   - if they have the same name, and each has a duration of at most
+//     exactMatchMaxDuration, they are compressed with the "exact_match"
+//     strategy, keeping the name;
+//   - otherwise, if each has a duration of at most sameKindMaxDuration,
+//     they are compressed with the "same_kind" strategy, and named
+//     "Calls to <destination>".
+//
+// A composite span records the number of spans compressed and the sum of
+// their durations, and takes the context and stack trace of the first span.
+// Spans with child spans are never compressed.
+//
+// Span compression is disabled by default, and requires APM Server 7.15 or
+// newer; if the server is known to be older, spans are not compressed. It
+// may also be configured with the ELASTIC_APM_SPAN_COMPRESSION_ENABLED,
+// ELASTIC_APM_SPAN_COMPRESSION_EXACT_MATCH_MAX_DURATION, and
+// ELASTIC_APM_SPAN_COMPRESSION_SAME_KIND_MAX_DURATION environment variables.
+func (t *Tracer) SetSpanCompression(enabled bool, exactMatchMaxDuration, sameKindMaxDuration time.Duration) {
+	t.sendConfigCommand(func(cfg *tracerConfig) {
+		cfg.spanCompression = spanCompressionConfig{
+			enabled:               enabled,
+			exactMatchMaxDuration: exactMatchMaxDuration,
+			sameKindMaxDuration:   sameKindMaxDuration,
+		}
+	})
+}
+
+// spanCompressor compresses the spans of a transaction
+// as they are added to a payload.
+type spanCompressor struct {
+	cfg spanCompressionConfig
+
+	// hasChildren records, by span ID, whether each of
+	// the transaction's spans is the parent of another.
+	hasChildren []bool
+
+	// composite holds the span most recently added to
+	// the payload, into which later spans may be compressed.
+	composite            *model.Span
+	compositeParent      int64
+	compositeResource    string
+	compositeName        string
+	compositeStart       time.Time
+	compositeEnd         time.Time
+	compositeMaxDuration time.Duration
+	nextID               int64
+}
+
+// reset prepares c for compressing the spans of tx.
+func (c *spanCompressor) reset(cfg spanCompressionConfig, tx *Transaction) {
+	c.cfg = cfg
+	c.composite = nil
+	c.hasChildren = c.hasChildren[:0]
+	if !cfg.enabled {
+		return
+	}
+	for range tx.spans {
+		c.hasChildren = append(c.hasChildren, false)
+	}
+	for _, span := range tx.spans {
+		if span.parent >= 0 && span.parent < int64(len(c.hasChildren)) {
+			c.hasChildren[span.parent] = true
+		}
+	}
+}
+
+// compress compresses span into the composite span, returning false if
+// the span cannot be compressed and must be added to the payload.
+func (c *spanCompressor) compress(span *Span) bool {
+	if c.composite == nil || span.id != c.nextID || span.parent != c.compositeParent ||
+		c.hasChildren[span.id] || truncateString(span.Type) != c.composite.Type ||
+		spanDestinationResource(span) != c.compositeResource {
+		return false
+	}
+	maxDuration := c.compositeMaxDuration
+	if span.Duration > maxDuration {
+		maxDuration = span.Duration
+	}
+	strategy := compressionStrategySameKind
+	if span.Name == c.compositeName && maxDuration <= c.cfg.exactMatchMaxDuration {
+		if c.composite.Composite == nil || c.composite.Composite.CompressionStrategy == compressionStrategyExactMatch {
+			strategy = compressionStrategyExactMatch
+		}
+	}
+	if strategy == compressionStrategySameKind && maxDuration > c.cfg.sameKindMaxDuration {
+		return false
+	}
+
+	if c.composite.Composite == nil {
+		c.composite.Composite = &model.CompositeSpan{Count: 1, Sum: c.composite.Duration}
+	}
+	composite := c.composite.Composite
+	composite.Count++
+	composite.Sum += span.Duration.Seconds() * 1000
+	composite.CompressionStrategy = strategy
+	if strategy == compressionStrategySameKind {
+		c.composite.Name = truncateString("Calls to " + c.compositeResource)
+	}
+	if end := span.Timestamp.Add(span.Duration); end.After(c.compositeEnd) {
+		c.compositeEnd = end
+	}
+	c.composite.Duration = c.compositeEnd.Sub(c.compositeStart).Seconds() * 1000
+	c.compositeMaxDuration = maxDuration
+	c.nextID = span.id + 1
+	return true
+}
+
+// added records that span was added to the payload as modelSpan,
+// making it the composite span into which later spans may be
+// compressed, if it is a compressible exit span.
+func (c *spanCompressor) added(span *Span, modelSpan *model.Span) {
+	c.composite = nil
+	if !c.cfg.enabled || c.hasChildren[span.id] {
+		return
+	}
+	resource := spanDestinationResource(span)
+	if resource == "" {
+		return
+	}
+	c.composite = modelSpan
+	c.compositeParent = span.parent
+	c.compositeResource = resource
+	c.compositeName = span.Name
+	c.compositeStart = span.Timestamp
+	c.compositeEnd = span.Timestamp.Add(span.Duration)
+	c.compositeMaxDuration = span.Duration
+	c.nextID = span.id + 1
+}
+
+// spanDestinationResource returns the destination service
+// resource of span, or the empty string if it has none.
+func spanDestinationResource(span *Span) string {
+	destination := span.Context.model.Destination
+	if destination == nil || destination.Service == nil {
+		return ""
+	}
+	return destination.Service.Resource
+}
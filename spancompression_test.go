@@ -0,0 +1,140 @@
+package elasticapm_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/model"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestSpanCompression(t *testing.T) {
+	tracer, recorder := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetSpanCompression(true, 50*time.Millisecond, 10*time.Millisecond)
+
+	tx := tracer.StartTransaction("name", "type")
+	start := tx.Timestamp
+	startSpan := func(name, target string, offset, duration time.Duration) {
+		span := tx.StartSpan(name, "db.mysql.query", nil)
+		span.Timestamp = start.Add(offset)
+		span.Duration = duration
+		span.Context.SetServiceTarget(elasticapm.ServiceTargetSpanContext{Type: "mysql", Name: target})
+		span.End()
+	}
+	// Exact matches.
+	startSpan("SELECT FROM users", "users", 0, 5*time.Millisecond)
+	startSpan("SELECT FROM users", "users", 10*time.Millisecond, 20*time.Millisecond)
+	startSpan("SELECT FROM users", "users", 40*time.Millisecond, 5*time.Millisecond)
+	// Different destination.
+	startSpan("SELECT FROM orders", "orders", 50*time.Millisecond, time.Millisecond)
+	// Same kind.
+	startSpan("SELECT FROM items", "orders", 60*time.Millisecond, time.Millisecond)
+	// Too slow to compress.
+	startSpan("SELECT FROM items", "orders", 70*time.Millisecond, 100*time.Millisecond)
+	// Not an exit span.
+	tx.StartSpan("compute", "app.internal", nil).End()
+	tx.End()
+	tracer.Flush(nil)
+
+	payloads := recorder.Payloads()
+	require.Len(t, payloads, 1)
+	spans := payloads[0].Transactions()[0].Spans
+	require.Len(t, spans, 4)
+
+	assert.Equal(t, "SELECT FROM users", spans[0].Name)
+	assert.Equal(t, &model.CompositeSpan{
+		Count:               3,
+		Sum:                 30,
+		CompressionStrategy: "exact_match",
+	}, spans[0].Composite)
+	assert.InDelta(t, 45, spans[0].Duration, 0.001)
+
+	assert.Equal(t, "Calls to mysql/orders", spans[1].Name)
+	assert.Equal(t, &model.CompositeSpan{
+		Count:               2,
+		Sum:                 2,
+		CompressionStrategy: "same_kind",
+	}, spans[1].Composite)
+	assert.InDelta(t, 50, spans[1].Start, 0.001)
+	assert.InDelta(t, 11, spans[1].Duration, 0.001)
+
+	assert.Nil(t, spans[2].Composite)
+	assert.Equal(t, "compute", spans[3].Name)
+	assert.Nil(t, spans[3].Composite)
+}
+
+func TestSpanCompressionParent(t *testing.T) {
+	tracer, recorder := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetSpanCompression(true, time.Hour, time.Hour)
+
+	tx := tracer.StartTransaction("name", "type")
+	var spans []*elasticapm.Span
+	for i := 0; i < 3; i++ {
+		span := tx.StartSpan("GET /", "external.http", nil)
+		span.Context.SetServiceTarget(elasticapm.ServiceTargetSpanContext{Type: "http", Name: "backend"})
+		spans = append(spans, span)
+	}
+	// The second span has a child, so cannot be compressed.
+	tx.StartSpan("child", "app.internal", spans[1]).End()
+	for _, span := range spans {
+		span.End()
+	}
+	tx.End()
+	tracer.Flush(nil)
+
+	modelSpans := recorder.Payloads()[0].Transactions()[0].Spans
+	require.Len(t, modelSpans, 4)
+	for _, span := range modelSpans {
+		assert.Nil(t, span.Composite)
+	}
+}
+
+func TestSpanCompressionDisabled(t *testing.T) {
+	os.Setenv("ELASTIC_APM_SPAN_COMPRESSION_ENABLED", "false")
+	defer os.Unsetenv("ELASTIC_APM_SPAN_COMPRESSION_ENABLED")
+	tracer, err := elasticapm.NewTracer("tracer_testing", "")
+	require.NoError(t, err)
+	defer tracer.Close()
+	recorder := &transporttest.RecorderTransport{}
+	tracer.Transport = recorder
+
+	tx := tracer.StartTransaction("name", "type")
+	for i := 0; i < 2; i++ {
+		span := tx.StartSpan("GET /", "external.http", nil)
+		span.Context.SetServiceTarget(elasticapm.ServiceTargetSpanContext{Type: "http"})
+		span.End()
+	}
+	tx.End()
+	tracer.Flush(nil)
+	assert.Len(t, recorder.Payloads()[0].Transactions()[0].Spans, 2)
+
+	os.Setenv("ELASTIC_APM_SPAN_COMPRESSION_ENABLED", "yes please")
+	_, err = elasticapm.NewTracer("tracer_testing", "")
+	assert.EqualError(t, err, `failed to parse ELASTIC_APM_SPAN_COMPRESSION_ENABLED: strconv.ParseBool: parsing "yes please": invalid syntax`)
+}
+
+func TestSpanCompressionServerVersion(t *testing.T) {
+	for version, expected := range map[string]int{"7.14.0": 2, "7.15.0": 1} {
+		tracer, recorder := transporttest.NewRecorderTracer()
+		tracer.Transport = versionedTransport{RecorderTransport: recorder, version: version}
+		tracer.SetSpanCompression(true, time.Hour, 0)
+
+		tx := tracer.StartTransaction("name", "type")
+		for i := 0; i < 2; i++ {
+			span := tx.StartSpan("GET /", "external.http", nil)
+			span.Context.SetServiceTarget(elasticapm.ServiceTargetSpanContext{Type: "http"})
+			span.End()
+		}
+		tx.End()
+		tracer.Flush(nil)
+		assert.Len(t, recorder.Payloads()[0].Transactions()[0].Spans, expected, "version %s", version)
+		tracer.Close()
+	}
+}
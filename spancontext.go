@@ -1,13 +1,22 @@
 package elasticapm
 
 import (
+	"net/http"
+	"net/url"
+
 	"github.com/elastic/apm-agent-go/model"
 )
 
 // SpanContext provides methods for setting span context.
 type SpanContext struct {
-	model    model.SpanContext
-	database model.DatabaseSpanContext
+	model              model.SpanContext
+	database           model.DatabaseSpanContext
+	http               model.HTTPSpanContext
+	destination        model.DestinationSpanContext
+	destinationService model.DestinationServiceSpanContext
+	service            model.ServiceSpanContext
+	serviceTarget      model.ServiceTargetSpanContext
+	rowsAffected       int64
 }
 
 // DatabaseSpanContext holds database span context.
@@ -24,11 +33,46 @@ type DatabaseSpanContext struct {
 
 	// User holds the username used for database access.
 	User string
+
+	// RowsAffected holds the number of rows affected by the
+	// database operation, if known.
+	RowsAffected *int64
+}
+
+// HTTPSpanContext holds HTTP client request span context.
+type HTTPSpanContext struct {
+	// URL holds the URL of the HTTP request, if known. Any
+	// password in the URL will not be recorded.
+	URL *url.URL
+
+	// StatusCode holds the HTTP response status code.
+	StatusCode int
+
+	// HTTPVersion holds the HTTP protocol version of the
+	// response, e.g. "2.0".
+	HTTPVersion string
+
+	// Trailers holds the HTTP response trailers, if any.
+	Trailers http.Header
+}
+
+// ServiceTargetSpanContext identifies the service targeted by an
+// exit span, used for grouping dependencies in the APM UI.
+type ServiceTargetSpanContext struct {
+	// Type holds the target service type, e.g. "postgresql".
+	Type string
+
+	// Name holds the target service name, e.g. "orders-db".
+	// This is optional.
+	Name string
 }
 
 func (c *SpanContext) build() *model.SpanContext {
 	switch {
 	case c.model.Database != nil:
+	case c.model.HTTP != nil:
+	case c.model.Service != nil:
+	case c.model.Tags != nil:
 	default:
 		return nil
 	}
@@ -39,8 +83,74 @@ func (c *SpanContext) reset() {
 	*c = SpanContext{}
 }
 
+// SetTag sets a tag in the span context. If the key is invalid
+// (contains '.', '*', or '"'), or the context already has
+// MaxTags tags and key is not one of them, the call is a no-op.
+// Keys and values longer than 1024 characters are truncated.
+func (c *SpanContext) SetTag(key, value string) {
+	c.model.Tags = setTag(c.model.Tags, key, value)
+}
+
 // SetDatabase sets the span context for database-related operations.
 func (c *SpanContext) SetDatabase(db DatabaseSpanContext) {
 	c.database = model.DatabaseSpanContext(db)
 	c.model.Database = &c.database
 }
+
+// SetDatabaseRowsAffected records the number of rows affected by
+// the database operation, e.g. an SQL INSERT or UPDATE statement.
+// SetDatabaseRowsAffected must be called after SetDatabase.
+func (c *SpanContext) SetDatabaseRowsAffected(n int64) {
+	c.rowsAffected = n
+	c.database.RowsAffected = &c.rowsAffected
+}
+
+// SetHTTP sets the span context for HTTP client request operations.
+func (c *SpanContext) SetHTTP(http HTTPSpanContext) {
+	c.http = model.HTTPSpanContext{
+		StatusCode:  http.StatusCode,
+		HTTPVersion: http.HTTPVersion,
+		Trailers:    http.Trailers,
+	}
+	if http.URL != nil {
+		u := *http.URL
+		if u.User != nil {
+			u.User = url.User(u.User.Username())
+		}
+		c.http.URL = u.String()
+	}
+	c.model.HTTP = &c.http
+}
+
+// SetServiceTarget sets the service targeted by an exit span, overriding
+// any target set previously, e.g. by an instrumentation module.
+//
+// The target is recorded both as a structured type and name, and as the
+// legacy destination service resource, "<type>/<name>", or just "<type>"
+// if the name is empty.
+func (c *SpanContext) SetServiceTarget(target ServiceTargetSpanContext) {
+	if target.Type == "" {
+		c.model.Service = nil
+		c.model.Destination = nil
+		return
+	}
+	c.serviceTarget = model.ServiceTargetSpanContext(target)
+	c.service.Target = &c.serviceTarget
+	c.model.Service = &c.service
+
+	resource := serviceTargetResource(target)
+	c.destinationService = model.DestinationServiceSpanContext{Resource: resource}
+	c.destination.Service = &c.destinationService
+	c.model.Destination = &c.destination
+}
+
+// serviceTargetResource returns the legacy destination service
+// resource for target: "<type>/<name>", or just "<type>" if the
+// name is empty.
+func serviceTargetResource(target ServiceTargetSpanContext) string {
+	resource := target.Type
+	if target.Name != "" {
+		resource += "/" + target.Name
+	}
+	return resource
+}
@@ -0,0 +1,134 @@
+package elasticapm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SpanLintIssue describes a problem with the type or context of a span,
+// found by the span linter enabled with Tracer.SetSpanLinter.
+type SpanLintIssue struct {
+	// Name holds the name of the span.
+	Name string
+
+	// Type holds the type of the span.
+	Type string
+
+	// Problem describes the problem found with the span.
+	Problem string
+}
+
+// Error returns a description of the issue, including the span
+// name and type.
+func (i SpanLintIssue) Error() string {
+	return fmt.Sprintf("span %q of type %q: %s", i.Name, i.Type, i.Problem)
+}
+
+// SpanLintFunc is the type of a function called with issues found by
+// the span linter.
+type SpanLintFunc func(SpanLintIssue)
+
+// LogSpanLintIssues is a SpanLintFunc which logs issues using the
+// tracer's Logger, if any. See Tracer.SetLogger.
+func (t *Tracer) LogSpanLintIssues(issue SpanLintIssue) {
+	if logger := t.loadTransactionConfig().logger; logger != nil {
+		logger.Errorf("span lint: %s", issue.Error())
+	}
+}
+
+// PanicSpanLintIssues is a SpanLintFunc which panics with the issue.
+// This is intended for use in tests.
+func PanicSpanLintIssues(issue SpanLintIssue) {
+	panic(issue)
+}
+
+// SetSpanLinter sets f as the function to call for each problem found
+// with the taxonomy of spans when they are ended, or disables span
+// linting if f is nil. Span linting is disabled by default.
+//
+// The span linter reports spans with a missing type or subtype, types
+// that are not of the form "type.subtype[.action]" with lower-case
+// alphanumeric or underscore components, and database and external
+// spans that do not identify their destination service, other than those
+// started with Transaction.StartExitSpan, whose target may be unknown. The
+// linter is intended for use during development and in tests, to keep
+// span taxonomy consistent across services; f is called synchronously
+// by Span.End, so it may panic, or report a test failure.
+//
+// Span linting may also be enabled by setting the ELASTIC_APM_DEBUG
+// environment variable to "spanlint=log" or "spanlint=panic", to log
+// issues using the tracer's Logger, or panic, respectively.
+func (t *Tracer) SetSpanLinter(f SpanLintFunc) {
+	t.updateTransactionConfig(func(cfg *transactionConfig) {
+		cfg.spanLinter = f
+	})
+}
+
+// exitSpanTypes holds the span types which are considered exit spans,
+// and are expected to identify their destination service.
+var exitSpanTypes = []string{"db", "cache", "ext", "external", "grpc", "messaging", "storage"}
+
+// isExitSpanType reports whether the first component
+// of spanType is one of exitSpanTypes.
+func isExitSpanType(spanType string) bool {
+	if i := strings.IndexRune(spanType, '.'); i >= 0 {
+		spanType = spanType[:i]
+	}
+	for _, t := range exitSpanTypes {
+		if spanType == t {
+			return true
+		}
+	}
+	return false
+}
+
+// lintSpan returns the problems found with s. s.mu must be held.
+func lintSpan(s *Span) []SpanLintIssue {
+	var issues []SpanLintIssue
+	report := func(format string, args ...interface{}) {
+		issues = append(issues, SpanLintIssue{Name: s.Name, Type: s.Type, Problem: fmt.Sprintf(format, args...)})
+	}
+	if s.Type == "" {
+		report("missing type")
+		return issues
+	}
+	components := strings.Split(s.Type, ".")
+	for _, c := range components {
+		if !isSpanTypeComponent(c) {
+			report("type component %q is not lower-case alphanumeric or underscore", c)
+			return issues
+		}
+	}
+	switch {
+	case len(components) < 2:
+		report("missing subtype")
+	case len(components) > 3:
+		report("type has more than three components, expected type.subtype[.action]")
+	}
+
+	// Exit spans started with StartExitSpan declare their service
+	// target explicitly, and may have none if it is unknown, as with
+	// the default apmhttp client; only other spans are expected to
+	// identify their destination service.
+	exit := s.Context.model.Database != nil || s.Context.model.HTTP != nil || isExitSpanType(s.Type)
+	if exit && !s.exit && s.Context.model.Destination == nil {
+		report("exit span does not identify its destination service")
+	}
+	return issues
+}
+
+func isSpanTypeComponent(c string) bool {
+	if c == "" {
+		return false
+	}
+	for _, r := range c {
+		switch {
+		case r >= 'a' && r <= 'z':
+		case r >= '0' && r <= '9':
+		case r == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,83 @@
+package elasticapm_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestTracerSpanLinter(t *testing.T) {
+	tracer, _ := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	var issues []string
+	tracer.SetSpanLinter(func(issue elasticapm.SpanLintIssue) {
+		issues = append(issues, issue.Error())
+	})
+
+	tx := tracer.StartTransaction("name", "type")
+	tx.StartSpan("ok", "template.html.render", nil).End()
+	tx.StartSpan("empty", "", nil).End()
+	tx.StartSpan("nosubtype", "custom", nil).End()
+	tx.StartSpan("uppercase", "Template.HTML", nil).End()
+	tx.StartSpan("toolong", "a.b.c.d", nil).End()
+	tx.StartSpan("emptycomponent", "a..b", nil).End()
+	tx.StartSpan("nodestination", "db.postgresql.query", nil).End()
+
+	span := tx.StartSpan("destination", "db.postgresql.query", nil)
+	span.Context.SetServiceTarget(elasticapm.ServiceTargetSpanContext{Type: "postgresql"})
+	span.End()
+
+	span = tx.StartSpan("httpnodestination", "net.http", nil)
+	span.Context.SetHTTP(elasticapm.HTTPSpanContext{StatusCode: 200})
+	span.End()
+
+	span = tx.StartExitSpan("exitnotarget", "external.http", nil, elasticapm.ServiceTargetSpanContext{})
+	span.Context.SetHTTP(elasticapm.HTTPSpanContext{StatusCode: 200})
+	span.End()
+	tx.End()
+
+	assert.Equal(t, []string{
+		`span "empty" of type "": missing type`,
+		`span "nosubtype" of type "custom": missing subtype`,
+		`span "uppercase" of type "Template.HTML": type component "Template" is not lower-case alphanumeric or underscore`,
+		`span "toolong" of type "a.b.c.d": type has more than three components, expected type.subtype[.action]`,
+		`span "emptycomponent" of type "a..b": type component "" is not lower-case alphanumeric or underscore`,
+		`span "nodestination" of type "db.postgresql.query": exit span does not identify its destination service`,
+		`span "httpnodestination" of type "net.http": exit span does not identify its destination service`,
+	}, issues)
+}
+
+func TestTracerSpanLinterPanic(t *testing.T) {
+	tracer, _ := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetSpanLinter(elasticapm.PanicSpanLintIssues)
+
+	tx := tracer.StartTransaction("name", "type")
+	defer tx.End()
+	span := tx.StartSpan("name", "custom", nil)
+	assert.Panics(t, span.End)
+}
+
+func TestTracerSpanLinterLog(t *testing.T) {
+	tracer, _ := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetSpanLinter(tracer.LogSpanLintIssues)
+
+	// Without a logger, issues are not logged.
+	tx := tracer.StartTransaction("name", "type")
+	tx.StartSpan("name", "", nil).End()
+	tx.End()
+
+	var logger recordingLogger
+	tracer.SetLogger(&logger)
+	tx = tracer.StartTransaction("name", "type")
+	tx.StartSpan("name", "custom", nil).End()
+	tx.End()
+	assert.Equal(t, []string{
+		`span lint: span "name" of type "custom": missing subtype`,
+	}, logger.messages())
+}
@@ -0,0 +1,61 @@
+package elasticapm
+
+import "sync"
+
+// SpanRef is a reference to a span which may outlive the span's
+// transaction, such as a span describing an HTTP response whose body
+// is consumed after the request handler returns. Spans are reused once
+// their transaction has ended, so a span must not be used directly
+// after then; a SpanRef is instead detached from its span when the
+// transaction ends or is discarded.
+type SpanRef struct {
+	mu   sync.Mutex
+	span *Span // nil once the transaction has ended
+}
+
+// Ref returns a new SpanRef referring to s. If s is dropped, or its
+// transaction has ended, the returned SpanRef is already detached.
+func (s *Span) Ref() *SpanRef {
+	ref := &SpanRef{}
+	if s.Dropped() {
+		return ref
+	}
+	tx := s.tx
+	tx.mu.Lock()
+	if !tx.ended {
+		ref.span = s
+		tx.spanRefs = append(tx.spanRefs, ref)
+	}
+	tx.mu.Unlock()
+	return ref
+}
+
+// Do calls f with the referenced span and returns true, or returns
+// false without calling f if the span's transaction has ended. The
+// transaction's End method blocks until f returns, so f may update
+// and end the span.
+func (r *SpanRef) Do(f func(*Span)) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.span == nil {
+		return false
+	}
+	f(r.span)
+	return true
+}
+
+// detachSpanRefs detaches the SpanRefs created for the transaction's
+// spans, once it has ended or been discarded and may be reused. Any
+// referenced spans that have not been ended are truncated when the
+// transaction ends.
+func (tx *Transaction) detachSpanRefs() {
+	tx.mu.Lock()
+	refs := tx.spanRefs
+	tx.spanRefs = nil
+	tx.mu.Unlock()
+	for _, ref := range refs {
+		ref.mu.Lock()
+		ref.span = nil
+		ref.mu.Unlock()
+	}
+}
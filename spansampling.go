@@ -0,0 +1,153 @@
+package elasticapm
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/elastic/apm-agent-go/model"
+)
+
+// droppedSpansStatsLimit is the maximum number of distinct span types
+// for which dropped span statistics are recorded in a transaction.
+// Spans of further types are counted only in the total.
+const droppedSpansStatsLimit = 128
+
+// SetSpanSamplingThreshold sets the number of spans after which spans
+// within a transaction are sampled, rather than all being recorded. If
+// set to a non-positive value, which is the default, span sampling is
+// disabled, and spans are recorded until the max spans limit is reached.
+//
+// Once a transaction has started n spans, where n is the threshold,
+// each further span is recorded with probability n/(s+1), where s is
+// the number of spans started so far. This keeps the number of spans
+// recorded for very large transactions small, while still recording
+// spans from throughout the transaction, rather than only from its
+// start. The max spans limit still applies. Dropped spans are counted
+// by type in the transaction's dropped span statistics.
+//
+// The threshold may also be set with the ELASTIC_APM_SPAN_SAMPLING_THRESHOLD
+// environment variable.
+func (t *Tracer) SetSpanSamplingThreshold(n int) {
+	t.updateTransactionConfig(func(cfg *transactionConfig) {
+		cfg.spanSamplingThreshold = n
+	})
+}
+
+// sampleSpan reports whether a new span should be recorded, according
+// to the transaction's span sampling threshold. tx.mu must be held.
+func (tx *Transaction) sampleSpan() bool {
+	if tx.spanSamplingThreshold <= 0 {
+		return true
+	}
+	started := len(tx.spans) + tx.spansDropped
+	if started < tx.spanSamplingThreshold {
+		return true
+	}
+	return tx.rand.Intn(started+1) < tx.spanSamplingThreshold
+}
+
+// droppedSpansKey identifies a group of dropped spans in
+// a transaction's dropped span statistics. The resource is
+// set only for exit spans.
+type droppedSpansKey struct {
+	spanType string
+	resource string
+}
+
+// droppedSpansGroup holds statistics on a group of dropped spans.
+type droppedSpansGroup struct {
+	count int
+
+	// durationCount and durationSum hold the number and total
+	// duration of ended spans in the group. Durations are only
+	// recorded for exit spans.
+	durationCount int
+	durationSum   time.Duration
+}
+
+// dropSpan records that a span has been dropped from the
+// transaction, and reports whether it was recorded in the
+// transaction's dropped span statistics. tx.mu must be held.
+func (tx *Transaction) dropSpan(key droppedSpansKey) bool {
+	tx.spansDropped++
+	group, ok := tx.droppedSpans[key]
+	if !ok {
+		if len(tx.droppedSpans) >= droppedSpansStatsLimit {
+			return false
+		}
+		if tx.droppedSpans == nil {
+			tx.droppedSpans = make(map[droppedSpansKey]droppedSpansGroup)
+		}
+	}
+	group.count++
+	tx.droppedSpans[key] = group
+	return true
+}
+
+// recordDroppedSpanDuration records the duration of an ended,
+// dropped exit span. tx.mu must be held.
+func (tx *Transaction) recordDroppedSpanDuration(key droppedSpansKey, d time.Duration) {
+	group, ok := tx.droppedSpans[key]
+	if !ok {
+		return
+	}
+	group.durationCount++
+	group.durationSum += d
+	tx.droppedSpans[key] = group
+}
+
+// droppedExitSpansRef is shared by the dropped exit spans of a
+// transaction, through which they record their durations. It is
+// not pooled with the transaction, so spans ended after the
+// transaction can safely observe that it has ended.
+type droppedExitSpansRef struct {
+	mu sync.Mutex
+	tx *Transaction // nil once the transaction has ended
+}
+
+// detachDroppedExitSpans prevents the transaction's open dropped
+// exit spans from recording their durations, once it has ended or
+// been discarded and may be reused.
+func (tx *Transaction) detachDroppedExitSpans() {
+	tx.mu.Lock()
+	ref := tx.droppedExitSpans
+	tx.droppedExitSpans = nil
+	tx.mu.Unlock()
+	if ref != nil {
+		ref.mu.Lock()
+		ref.tx = nil
+		ref.mu.Unlock()
+	}
+}
+
+// buildDroppedSpansStats returns the transaction's dropped span
+// statistics, ordered by span type and destination resource.
+// tx.mu must be held.
+func (tx *Transaction) buildDroppedSpansStats() []model.DroppedSpansStats {
+	if len(tx.droppedSpans) == 0 {
+		return nil
+	}
+	stats := make([]model.DroppedSpansStats, 0, len(tx.droppedSpans))
+	for key, group := range tx.droppedSpans {
+		s := model.DroppedSpansStats{
+			Type:                       truncateString(key.spanType),
+			DestinationServiceResource: truncateString(key.resource),
+			Count:                      group.count,
+		}
+		if group.durationCount > 0 {
+			s.Duration = &model.DroppedSpansDuration{
+				Count: group.durationCount,
+				Sum:   model.DroppedSpansDurationSum{US: int64(group.durationSum / time.Microsecond)},
+			}
+		}
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Type != stats[j].Type {
+			return stats[i].Type < stats[j].Type
+		}
+		return stats[i].DestinationServiceResource < stats[j].DestinationServiceResource
+	})
+	return stats
+}
@@ -0,0 +1,181 @@
+package elasticapm
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// moduleSpanTypesLimit is the maximum number of distinct module span
+// types recorded for review with Tracer.ModuleSpanTypes.
+const moduleSpanTypesLimit = 1000
+
+// SpanTypeOverride re-classifies the spans started by instrumentation
+// modules for a matching destination, e.g. to record the spans for an
+// internal HTTP API as "external.billing" rather than "ext.http".
+type SpanTypeOverride struct {
+	// Module holds the name of the instrumentation module whose
+	// spans the override applies to, e.g. "apmhttp". If Module is
+	// empty, the override applies to spans from all modules.
+	Module string
+
+	// Destination holds the destination to match, such as an HTTP
+	// host ("billing.internal:8080"), a gRPC target, or a database
+	// name. Destinations are matched case-insensitively, and a
+	// Destination ending with "*" matches all destinations with the
+	// preceding prefix. If Destination is empty, the override
+	// applies to all destinations.
+	Destination string
+
+	// Type holds the span type to record instead of the module's
+	// default type, e.g. "external.billing".
+	Type string
+}
+
+// ModuleSpanType describes a span type used by an instrumentation
+// module for a destination, as reported by Tracer.ModuleSpanTypes.
+type ModuleSpanType struct {
+	// Module holds the name of the instrumentation module.
+	Module string
+
+	// Type holds the module's default span type.
+	Type string
+
+	// Destination holds the destination of the spans.
+	Destination string
+
+	// Override holds the span type recorded instead of Type,
+	// due to a SpanTypeOverride, or the empty string if the
+	// default type is recorded.
+	Override string
+}
+
+// spanTypeOverrides is an immutable snapshot of the
+// tracer's span type overrides.
+type spanTypeOverrides []SpanTypeOverride
+
+func newSpanTypeOverrides(overrides []SpanTypeOverride) spanTypeOverrides {
+	if len(overrides) == 0 {
+		return nil
+	}
+	out := make(spanTypeOverrides, len(overrides))
+	for i, o := range overrides {
+		o.Destination = strings.ToLower(o.Destination)
+		out[i] = o
+	}
+	return out
+}
+
+// find returns the type of the first override matching the module
+// and destination, or the empty string if there is none.
+func (overrides spanTypeOverrides) find(module, destination string) string {
+	if len(overrides) == 0 {
+		return ""
+	}
+	destination = strings.ToLower(destination)
+	for _, o := range overrides {
+		if o.Module != "" && o.Module != module {
+			continue
+		}
+		if strings.HasSuffix(o.Destination, "*") {
+			if !strings.HasPrefix(destination, o.Destination[:len(o.Destination)-1]) {
+				continue
+			}
+		} else if o.Destination != "" && o.Destination != destination {
+			continue
+		}
+		return o.Type
+	}
+	return ""
+}
+
+// SetSpanTypeOverrides sets the overrides for the span types recorded
+// by instrumentation modules, replacing any set previously. Overrides
+// are checked in order, and the first matching override is applied.
+// There are no overrides by default.
+//
+// Overrides may also be configured with the ELASTIC_APM_SPAN_TYPE_OVERRIDES
+// environment variable, a comma-separated list of "destination=type"
+// pairs, applying to all modules.
+func (t *Tracer) SetSpanTypeOverrides(overrides []SpanTypeOverride) {
+	t.updateTransactionConfig(func(cfg *transactionConfig) {
+		cfg.spanTypeOverrides = newSpanTypeOverrides(overrides)
+	})
+}
+
+// ModuleSpanTypes returns the span types used by instrumentation modules
+// for each destination, and any overrides applied to them, since the
+// tracer was created. This may be used to review the span types recorded
+// by modules, and to find the destinations to override. At most 1000
+// span types are recorded.
+func (t *Tracer) ModuleSpanTypes() []ModuleSpanType {
+	t.moduleSpanTypesMu.RLock()
+	types := make([]ModuleSpanType, 0, len(t.moduleSpanTypes))
+	for _, mst := range t.moduleSpanTypes {
+		types = append(types, mst)
+	}
+	t.moduleSpanTypesMu.RUnlock()
+	sort.Slice(types, func(i, j int) bool {
+		if types[i].Module != types[j].Module {
+			return types[i].Module < types[j].Module
+		}
+		if types[i].Type != types[j].Type {
+			return types[i].Type < types[j].Type
+		}
+		return types[i].Destination < types[j].Destination
+	})
+	return types
+}
+
+// OverrideSpanType returns the span type with which the named instrumentation
+// module should start a span for the given destination, in place of its
+// default spanType. If the tracer of the transaction in ctx has a matching
+// SpanTypeOverride, then its type is returned; otherwise spanType is
+// returned.
+//
+// Instrumentation modules should call OverrideSpanType to obtain the type
+// passed to StartSpan, so that users may re-classify the spans without
+// forking the module.
+func OverrideSpanType(ctx context.Context, module, spanType, destination string) string {
+	tx := TransactionFromContext(ctx)
+	if tx == nil {
+		return spanType
+	}
+	override := tx.spanTypeOverrides.find(module, destination)
+	tx.tracer.recordModuleSpanType(ModuleSpanType{
+		Module:      module,
+		Type:        spanType,
+		Destination: destination,
+		Override:    override,
+	})
+	if override != "" {
+		return override
+	}
+	return spanType
+}
+
+func (t *Tracer) recordModuleSpanType(mst ModuleSpanType) {
+	key := moduleSpanTypeKey{mst.Module, mst.Type, mst.Destination}
+	t.moduleSpanTypesMu.RLock()
+	existing, ok := t.moduleSpanTypes[key]
+	full := len(t.moduleSpanTypes) >= moduleSpanTypesLimit
+	t.moduleSpanTypesMu.RUnlock()
+	if (ok && existing == mst) || (!ok && full) {
+		return
+	}
+	t.moduleSpanTypesMu.Lock()
+	defer t.moduleSpanTypesMu.Unlock()
+	if _, ok := t.moduleSpanTypes[key]; !ok && len(t.moduleSpanTypes) >= moduleSpanTypesLimit {
+		return
+	}
+	if t.moduleSpanTypes == nil {
+		t.moduleSpanTypes = make(map[moduleSpanTypeKey]ModuleSpanType)
+	}
+	t.moduleSpanTypes[key] = mst
+}
+
+type moduleSpanTypeKey struct {
+	module      string
+	spanType    string
+	destination string
+}
@@ -0,0 +1,58 @@
+package elasticapm_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestOverrideSpanType(t *testing.T) {
+	tracer, _ := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetSpanTypeOverrides([]elasticapm.SpanTypeOverride{
+		{Module: "apmsql", Type: "db.legacy.query"},
+		{Destination: "Billing.Internal*", Type: "external.billing"},
+	})
+
+	tx := tracer.StartTransaction("name", "type")
+	defer tx.End()
+	ctx := elasticapm.ContextWithTransaction(context.Background(), tx)
+
+	assert.Equal(t, "db.legacy.query", elasticapm.OverrideSpanType(ctx, "apmsql", "db.mysql.query", "orders"))
+	assert.Equal(t, "external.billing", elasticapm.OverrideSpanType(ctx, "apmhttp", "ext.http", "billing.internal:8080"))
+	assert.Equal(t, "ext.http", elasticapm.OverrideSpanType(ctx, "apmhttp", "ext.http", "example.com"))
+	assert.Equal(t, "ext.http", elasticapm.OverrideSpanType(context.Background(), "apmhttp", "ext.http", "billing.internal"))
+
+	assert.Equal(t, []elasticapm.ModuleSpanType{{
+		Module:      "apmhttp",
+		Type:        "ext.http",
+		Destination: "billing.internal:8080",
+		Override:    "external.billing",
+	}, {
+		Module:      "apmhttp",
+		Type:        "ext.http",
+		Destination: "example.com",
+	}, {
+		Module:      "apmsql",
+		Type:        "db.mysql.query",
+		Destination: "orders",
+		Override:    "db.legacy.query",
+	}}, tracer.ModuleSpanTypes())
+}
+
+func TestOverrideSpanTypeSnapshot(t *testing.T) {
+	tracer, _ := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	tx := tracer.StartTransaction("name", "type")
+	defer tx.End()
+	ctx := elasticapm.ContextWithTransaction(context.Background(), tx)
+
+	// Overrides affect only transactions started after they are set.
+	tracer.SetSpanTypeOverrides([]elasticapm.SpanTypeOverride{{Type: "external.other"}})
+	assert.Equal(t, "ext.http", elasticapm.OverrideSpanType(ctx, "apmhttp", "ext.http", "example.com"))
+}
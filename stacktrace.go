@@ -33,3 +33,73 @@ func modelStacktraceFrame(in stacktrace.Frame) model.StacktraceFrame {
 		LibraryFrame: stacktrace.IsLibraryPackage(packagePath),
 	}
 }
+
+// stacktraceCache records the model stack traces built for spans
+// in a single batch of transactions, so that spans with identical
+// stack traces, e.g. those created at the same call site, share
+// the same model frames. This avoids repeatedly building frames
+// and setting source context for the same call sites.
+//
+// The cache does not reduce the size of the payload: the intake API
+// has no means of referring to frames sent for another span, so the
+// shared frames are encoded once for each span. Repeated frames are
+// left to the transport's compression.
+type stacktraceCache map[uint64][]cachedStacktrace
+
+type cachedStacktrace struct {
+	frames []stacktrace.Frame
+	model  []model.StacktraceFrame
+}
+
+// get returns the model stack trace previously recorded for frames,
+// or nil if there is none.
+func (c stacktraceCache) get(frames []stacktrace.Frame) []model.StacktraceFrame {
+	for _, cached := range c[hashStacktrace(frames)] {
+		if equalStacktraces(cached.frames, frames) {
+			return cached.model
+		}
+	}
+	return nil
+}
+
+// put records the model stack trace for frames.
+func (c stacktraceCache) put(frames []stacktrace.Frame, modelFrames []model.StacktraceFrame) {
+	h := hashStacktrace(frames)
+	c[h] = append(c[h], cachedStacktrace{frames: frames, model: modelFrames})
+}
+
+// reset removes all entries from the cache.
+func (c stacktraceCache) reset() {
+	for h := range c {
+		delete(c, h)
+	}
+}
+
+// hashStacktrace returns the 64-bit FNV-1a hash of frames.
+func hashStacktrace(frames []stacktrace.Frame) uint64 {
+	const prime = 1099511628211
+	h := uint64(14695981039346656037)
+	hashString := func(s string) {
+		for i := 0; i < len(s); i++ {
+			h = (h ^ uint64(s[i])) * prime
+		}
+	}
+	for _, f := range frames {
+		hashString(f.Function)
+		hashString(f.File)
+		h = (h ^ uint64(f.Line)) * prime
+	}
+	return h
+}
+
+func equalStacktraces(a, b []stacktrace.Frame) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,116 @@
+package elasticapm
+
+import "strings"
+
+// SyntheticTransactionType is the type of transactions marked as
+// synthetic with Transaction.MarkSynthetic.
+const SyntheticTransactionType = "synthetic"
+
+// syntheticSourceTag is the tag key under which the source of a
+// synthetic transaction is recorded.
+const syntheticSourceTag = "synthetic_source"
+
+// defaultSyntheticUserAgents holds the user-agent patterns of common
+// health probes and uptime monitors.
+var defaultSyntheticUserAgents = []string{
+	"kube-probe/*",
+	"ELB-HealthChecker/*",
+	"GoogleHC/*",
+	"Consul Health Check",
+	"Pingdom.com_bot*",
+	"UptimeRobot/*",
+	"*Elastic/Synthetics*",
+}
+
+// MarkSynthetic marks the transaction as synthetic traffic, such as a
+// health probe, smoke test, or scheduled uptime check, by setting its
+// type to SyntheticTransactionType. Synthetic transactions are still
+// reported, so they remain visible for availability monitoring, but
+// their distinct type enables them to be excluded from latency SLO
+// computations.
+//
+// If source is non-empty, it is recorded in the tag "synthetic_source",
+// e.g. the probe's user-agent, or the name of a scheduled check.
+func (tx *Transaction) MarkSynthetic(source string) {
+	tx.Type = SyntheticTransactionType
+	if source != "" {
+		tx.Context.SetTag(syntheticSourceTag, source)
+	}
+}
+
+// SetSyntheticUserAgents sets the user-agent patterns identifying
+// synthetic requests, replacing any set previously. Patterns are
+// matched case-insensitively, and may begin or end with "*" to match
+// by suffix or prefix, or both to match a substring. By default, the
+// user-agents of common health probes and uptime monitors are matched,
+// such as "kube-probe/*" and "ELB-HealthChecker/*"; passing an empty
+// list disables detection.
+//
+// The patterns may also be set with the ELASTIC_APM_SYNTHETIC_USER_AGENTS
+// environment variable, a comma-separated list replacing the defaults.
+func (t *Tracer) SetSyntheticUserAgents(patterns []string) {
+	t.syntheticUserAgentsMu.Lock()
+	t.syntheticUserAgents = newUserAgentPatterns(patterns)
+	t.syntheticUserAgentsMu.Unlock()
+}
+
+// IsSyntheticUserAgent reports whether userAgent matches one of the
+// patterns set with SetSyntheticUserAgents.
+//
+// Instrumentation modules should call Transaction.MarkSynthetic for
+// requests with a synthetic user-agent.
+func (t *Tracer) IsSyntheticUserAgent(userAgent string) bool {
+	if userAgent == "" {
+		return false
+	}
+	t.syntheticUserAgentsMu.RLock()
+	patterns := t.syntheticUserAgents
+	t.syntheticUserAgentsMu.RUnlock()
+	return patterns.match(userAgent)
+}
+
+// userAgentPatterns is an immutable list of lower-cased
+// user-agent patterns.
+type userAgentPatterns []string
+
+func newUserAgentPatterns(patterns []string) userAgentPatterns {
+	if len(patterns) == 0 {
+		return nil
+	}
+	out := make(userAgentPatterns, len(patterns))
+	for i, p := range patterns {
+		out[i] = strings.ToLower(p)
+	}
+	return out
+}
+
+// match reports whether userAgent matches any of the patterns.
+func (patterns userAgentPatterns) match(userAgent string) bool {
+	if len(patterns) == 0 {
+		return false
+	}
+	userAgent = strings.ToLower(userAgent)
+	for _, p := range patterns {
+		prefix := strings.HasPrefix(p, "*")
+		suffix := len(p) > 1 && strings.HasSuffix(p, "*")
+		switch {
+		case p == "*":
+			return true
+		case prefix && suffix:
+			if strings.Contains(userAgent, p[1:len(p)-1]) {
+				return true
+			}
+		case prefix:
+			if strings.HasSuffix(userAgent, p[1:]) {
+				return true
+			}
+		case suffix:
+			if strings.HasPrefix(userAgent, p[:len(p)-1]) {
+				return true
+			}
+		case userAgent == p:
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package elasticapm_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestTransactionMarkSynthetic(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	tx := tracer.StartTransaction("smoke test", "request")
+	tx.MarkSynthetic("checkout-smoke-test")
+	tx.End()
+	tx = tracer.StartTransaction("name", "request")
+	tx.MarkSynthetic("")
+	tx.End()
+	tracer.Flush(nil)
+
+	transactions := transport.Payloads()[0].Transactions()
+	require.Len(t, transactions, 2)
+	assert.Equal(t, "synthetic", transactions[0].Type)
+	assert.Equal(t, "checkout-smoke-test", transactions[0].Context.Tags["synthetic_source"])
+	assert.Equal(t, "synthetic", transactions[1].Type)
+	assert.Nil(t, transactions[1].Context)
+}
+
+func TestTracerIsSyntheticUserAgent(t *testing.T) {
+	tracer, err := elasticapm.NewTracer("tracer_testing", "")
+	require.NoError(t, err)
+	defer tracer.Close()
+
+	assert.True(t, tracer.IsSyntheticUserAgent("kube-probe/1.27"))
+	assert.True(t, tracer.IsSyntheticUserAgent("ELB-HealthChecker/2.0"))
+	assert.True(t, tracer.IsSyntheticUserAgent("Mozilla/5.0 (X11; Linux x86_64) Elastic/Synthetics"))
+	assert.False(t, tracer.IsSyntheticUserAgent("Mozilla/5.0 (X11; Linux x86_64)"))
+	assert.False(t, tracer.IsSyntheticUserAgent(""))
+
+	tracer.SetSyntheticUserAgents([]string{"smoke-test", "*-probe", "Monitor*"})
+	assert.True(t, tracer.IsSyntheticUserAgent("Smoke-Test"))
+	assert.True(t, tracer.IsSyntheticUserAgent("grpc-probe"))
+	assert.True(t, tracer.IsSyntheticUserAgent("monitor/1.0"))
+	assert.False(t, tracer.IsSyntheticUserAgent("smoke-test/1.0"))
+	assert.False(t, tracer.IsSyntheticUserAgent("kube-probe/1.27"))
+
+	tracer.SetSyntheticUserAgents(nil)
+	assert.False(t, tracer.IsSyntheticUserAgent("kube-probe/1.27"))
+}
+
+func TestTracerSyntheticUserAgentsEnv(t *testing.T) {
+	os.Setenv("ELASTIC_APM_SYNTHETIC_USER_AGENTS", "smoke-test/*, canary")
+	defer os.Unsetenv("ELASTIC_APM_SYNTHETIC_USER_AGENTS")
+
+	tracer, err := elasticapm.NewTracer("tracer_testing", "")
+	require.NoError(t, err)
+	defer tracer.Close()
+	assert.True(t, tracer.IsSyntheticUserAgent("smoke-test/1.0"))
+	assert.True(t, tracer.IsSyntheticUserAgent("canary"))
+	assert.False(t, tracer.IsSyntheticUserAgent("kube-probe/1.27"))
+}
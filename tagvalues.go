@@ -0,0 +1,108 @@
+package elasticapm
+
+import (
+	"fmt"
+	"hash/fnv"
+)
+
+// tagValueOverflow is the value used in place of tag values
+// which exceed the configured maximum cardinality.
+const tagValueOverflow = "_other"
+
+// maxTagValueKeys is the maximum number of tag keys for which
+// distinct values are tracked, when a maximum cardinality is set.
+// Values of tags with keys beyond the limit are replaced with
+// tagValueOverflow, so that tags keyed by user input cannot grow
+// the tracked values without bound.
+const maxTagValueKeys = 1000
+
+// TagValueLimits holds limits on the values of tags, protecting
+// the APM server and Elasticsearch from an explosion in the number
+// of distinct tag values, e.g. due to tagging with request IDs or
+// user input.
+type TagValueLimits struct {
+	// MaxLength, if positive, is the maximum length of a tag value.
+	// Longer values are replaced with a fixed-length hash of the
+	// value, of the form "hash:<hex>".
+	MaxLength int
+
+	// MaxCardinality, if positive, is the maximum number of distinct
+	// values recorded for each tag key. Once the limit has been
+	// reached for a key, previously unseen values are replaced with
+	// the value "_other". Distinct values are tracked for at most
+	// 1000 tag keys; values of tags with other keys are likewise
+	// replaced with "_other".
+	MaxCardinality int
+
+	// ExactKeys holds the keys of tags whose values are always
+	// recorded exactly, regardless of the limits.
+	ExactKeys []string
+}
+
+// SetTagValueLimits sets the limits on tag values recorded for
+// transactions and errors. The limits are applied when events are
+// sent to the APM server. By default there are no limits.
+func (t *Tracer) SetTagValueLimits(limits TagValueLimits) {
+	exactKeys := makeTagValueExactKeys(limits.ExactKeys)
+	t.sendConfigCommand(func(cfg *tracerConfig) {
+		cfg.tagValueLimits = limits
+		cfg.tagValueExactKeys = exactKeys
+	})
+}
+
+func makeTagValueExactKeys(keys []string) map[string]bool {
+	if len(keys) == 0 {
+		return nil
+	}
+	exactKeys := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		exactKeys[k] = true
+	}
+	return exactKeys
+}
+
+// limitTagValues replaces values in tags which exceed the configured
+// tag value limits, in place.
+func (s *sender) limitTagValues(tags map[string]string) {
+	limits := s.cfg.tagValueLimits
+	if limits.MaxLength <= 0 && limits.MaxCardinality <= 0 {
+		return
+	}
+	for k, v := range tags {
+		if s.cfg.tagValueExactKeys[k] {
+			continue
+		}
+		if limits.MaxLength > 0 && len(v) > limits.MaxLength {
+			v = hashTagValue(v)
+			tags[k] = v
+		}
+		if limits.MaxCardinality > 0 {
+			seen := s.tagValues[k]
+			if _, ok := seen[v]; ok {
+				continue
+			}
+			if len(seen) >= limits.MaxCardinality {
+				tags[k] = tagValueOverflow
+				continue
+			}
+			if seen == nil {
+				if len(s.tagValues) >= maxTagValueKeys {
+					tags[k] = tagValueOverflow
+					continue
+				}
+				if s.tagValues == nil {
+					s.tagValues = make(map[string]map[string]struct{})
+				}
+				seen = make(map[string]struct{})
+				s.tagValues[k] = seen
+			}
+			seen[v] = struct{}{}
+		}
+	}
+}
+
+func hashTagValue(v string) string {
+	h := fnv.New64a()
+	h.Write([]byte(v))
+	return fmt.Sprintf("hash:%016x", h.Sum64())
+}
@@ -0,0 +1,107 @@
+package elasticapm_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/model"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestTracerTagValueLimits(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetTagValueLimits(elasticapm.TagValueLimits{
+		MaxLength:      16,
+		MaxCardinality: 2,
+		ExactKeys:      []string{"exact"},
+	})
+
+	long := strings.Repeat("x", 17)
+	for _, v := range []string{"a", "b", "a", "c", long} {
+		tx := tracer.StartTransaction("name", "type")
+		tx.Context.SetTag("key", v)
+		tx.Context.SetTag("long", long)
+		tx.Context.SetTag("exact", v+long)
+		tx.End()
+	}
+	tracer.Flush(nil)
+
+	e := tracer.NewError(errors.New("boom"))
+	e.Context.SetTag("key", "d")
+	e.Send()
+	tracer.Flush(nil)
+
+	var values []string
+	var errorValues []string
+	for _, p := range transport.Payloads() {
+		switch p := p.Value.(type) {
+		case *model.TransactionsPayload:
+			for _, tx := range p.Transactions {
+				values = append(values, tx.Context.Tags["key"])
+				assert.Regexp(t, "^hash:[0-9a-f]{16}$", tx.Context.Tags["long"])
+				assert.True(t, strings.HasSuffix(tx.Context.Tags["exact"], long))
+			}
+		case *model.ErrorsPayload:
+			for _, e := range p.Errors {
+				errorValues = append(errorValues, e.Context.Tags["key"])
+			}
+		}
+	}
+	require.Len(t, values, 5)
+	assert.Equal(t, []string{"a", "b", "a", "_other", "_other"}, values)
+	assert.Equal(t, []string{"_other"}, errorValues)
+}
+
+func TestTracerTagValueLimitsKeys(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetTagValueLimits(elasticapm.TagValueLimits{MaxCardinality: 1})
+
+	// Values are tracked for at most 1000 distinct keys.
+	for i := 0; i < 10; i++ {
+		tx := tracer.StartTransaction("name", "type")
+		for j := 0; j < 100; j++ {
+			tx.Context.SetTag(fmt.Sprintf("key%d", i*100+j), "value")
+		}
+		tx.End()
+	}
+	tx := tracer.StartTransaction("name", "type")
+	tx.Context.SetTag("key0", "value")
+	tx.Context.SetTag("new", "value")
+	tx.End()
+	tracer.Flush(nil)
+
+	txs := transport.Payloads()[0].Transactions()
+	require.Len(t, txs, 11)
+	assert.Equal(t, map[string]string{"key0": "value", "new": "_other"}, txs[10].Context.Tags)
+}
+
+func TestContextSetTagLimits(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	tx := tracer.StartTransaction("name", "type")
+	for i := 0; i < elasticapm.MaxTags+1; i++ {
+		tx.Context.SetTag(fmt.Sprintf("key%d", i), "value")
+	}
+	tx.Context.SetTag("key0", "updated")
+	tx.Context.SetTag(strings.Repeat("k", 1025), "value")
+	span := tx.StartSpan("name", "type", nil)
+	span.Context.SetTag(strings.Repeat("k", 1025), "value")
+	span.End()
+	tx.End()
+	tracer.Flush(nil)
+
+	modelTx := transport.Payloads()[0].Transactions()[0]
+	assert.Len(t, modelTx.Context.Tags, elasticapm.MaxTags)
+	assert.Equal(t, "updated", modelTx.Context.Tags["key0"])
+	assert.NotContains(t, modelTx.Context.Tags, fmt.Sprintf("key%d", elasticapm.MaxTags))
+	assert.Equal(t, map[string]string{strings.Repeat("k", 1024): "value"}, modelTx.Spans[0].Context.Tags)
+}
@@ -0,0 +1,111 @@
+package elasticapm
+
+import (
+	"time"
+
+	"github.com/elastic/apm-agent-go/transport"
+)
+
+// minClockSkewCorrection is the minimum offset between the APM server's
+// clock and the local clock which is corrected. Smaller offsets are within
+// the error of the estimate, which is based on the one-second resolution
+// HTTP Date header.
+const minClockSkewCorrection = 5 * time.Second
+
+// TimestampLimits holds limits on the timestamps of transactions and
+// errors sent to the APM server, for validating events created with
+// explicit historical timestamps, e.g. when importing data.
+type TimestampLimits struct {
+	// MaxAge, if positive, is the maximum age of an event's timestamp
+	// when the event is sent.
+	MaxAge time.Duration
+
+	// MaxFuture, if positive, is the maximum amount of time by which
+	// an event's timestamp may be later than the time it is sent.
+	MaxFuture time.Duration
+
+	// Clamp controls what happens to events with timestamps outside
+	// the limits. If Clamp is true, their timestamps are replaced with
+	// the nearest timestamp within the limits; otherwise the events are
+	// dropped, counted in TracerStats.TransactionsDropped and
+	// TracerStats.ErrorsDropped.
+	Clamp bool
+}
+
+// SetTimestampLimits sets the limits on the timestamps of transactions
+// and errors. The limits are applied when events are sent to the APM
+// server, after any clock skew correction, and events with timestamps
+// outside the limits are counted in TracerStats.TimestampsOutOfRange.
+// By default there are no limits.
+//
+// The limits may also be set with the ELASTIC_APM_TIMESTAMP_MAX_AGE,
+// ELASTIC_APM_TIMESTAMP_MAX_FUTURE, and ELASTIC_APM_CLAMP_TIMESTAMPS
+// environment variables.
+func (t *Tracer) SetTimestampLimits(limits TimestampLimits) {
+	t.sendConfigCommand(func(cfg *tracerConfig) {
+		cfg.timestampLimits = limits
+	})
+}
+
+// SetClockSkewCorrection sets whether the timestamps of transactions,
+// errors, and metrics are corrected for gross differences between the
+// local clock and the APM server's clock, e.g. on devices without time
+// synchronization. The offset is learned from the server's responses,
+// if the tracer's Transport implements transport.StatsReporter and
+// reports Stats.ServerClockOffset, as the default HTTP transport does.
+// Offsets of less than five seconds are not corrected.
+//
+// Clock skew correction is disabled by default. It may also be enabled
+// by setting the ELASTIC_APM_CLOCK_SKEW_CORRECTION environment variable
+// to "true".
+func (t *Tracer) SetClockSkewCorrection(enabled bool) {
+	t.sendConfigCommand(func(cfg *tracerConfig) {
+		cfg.clockSkewCorrection = enabled
+	})
+}
+
+// timestampAdjuster corrects and validates the timestamps
+// of events in a payload.
+type timestampAdjuster struct {
+	limits TimestampLimits
+	offset time.Duration
+	now    time.Time
+
+	// outOfRange holds the number of timestamps
+	// found to be outside the limits.
+	outOfRange uint64
+}
+
+// newTimestampAdjuster returns a timestampAdjuster for a payload
+// built now, according to the tracer's configuration.
+func (s *sender) newTimestampAdjuster() timestampAdjuster {
+	a := timestampAdjuster{limits: s.cfg.timestampLimits}
+	if s.cfg.clockSkewCorrection {
+		if reporter, ok := s.tracer.Transport.(transport.StatsReporter); ok {
+			offset := reporter.TransportStats().ServerClockOffset
+			if offset >= minClockSkewCorrection || offset <= -minClockSkewCorrection {
+				a.offset = offset
+			}
+		}
+	}
+	a.now = time.Now().Add(a.offset)
+	return a
+}
+
+// adjust returns timestamp corrected for clock skew and clamped to the
+// limits, and reports whether the event should be sent. Events with
+// timestamps outside the limits are counted in a.outOfRange.
+func (a *timestampAdjuster) adjust(timestamp time.Time) (time.Time, bool) {
+	timestamp = timestamp.Add(a.offset)
+	var limit time.Time
+	switch {
+	case a.limits.MaxAge > 0 && timestamp.Before(a.now.Add(-a.limits.MaxAge)):
+		limit = a.now.Add(-a.limits.MaxAge)
+	case a.limits.MaxFuture > 0 && timestamp.After(a.now.Add(a.limits.MaxFuture)):
+		limit = a.now.Add(a.limits.MaxFuture)
+	default:
+		return timestamp, true
+	}
+	a.outOfRange++
+	return limit, a.limits.Clamp
+}
@@ -0,0 +1,144 @@
+package elasticapm_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/model"
+	"github.com/elastic/apm-agent-go/transport"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestTracerTimestampLimits(t *testing.T) {
+	tracer, recorder := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetTimestampLimits(elasticapm.TimestampLimits{MaxAge: time.Hour, MaxFuture: time.Minute})
+
+	historical := time.Now().Add(-2 * time.Hour)
+	tx := tracer.StartTransaction("historical", "import")
+	tx.Timestamp = historical
+	tx.End()
+	tracer.StartTransaction("current", "request").End()
+	e := tracer.NewError(errors.New("boom"))
+	e.Timestamp = time.Now().Add(time.Hour)
+	e.Send()
+	tracer.Flush(nil)
+
+	// Events with timestamps outside the limits are dropped.
+	payloads := recorder.Payloads()
+	require.Len(t, payloads, 1)
+	transactions := payloads[0].Transactions()
+	require.Len(t, transactions, 1)
+	assert.Equal(t, "current", transactions[0].Name)
+	stats := tracer.Stats()
+	assert.Equal(t, uint64(2), stats.TimestampsOutOfRange)
+	assert.Equal(t, uint64(1), stats.TransactionsDropped)
+	assert.Equal(t, uint64(1), stats.ErrorsDropped)
+
+	// With Clamp, they are sent with the nearest valid timestamp.
+	tracer.SetTimestampLimits(elasticapm.TimestampLimits{MaxAge: time.Hour, Clamp: true})
+	tx = tracer.StartTransaction("historical", "import")
+	tx.Timestamp = historical
+	tx.End()
+	tracer.Flush(nil)
+	payloads = recorder.Payloads()
+	require.Len(t, payloads, 2)
+	transactions = payloads[1].Transactions()
+	require.Len(t, transactions, 1)
+	assert.WithinDuration(t, time.Now().Add(-time.Hour), time.Time(transactions[0].Timestamp), time.Minute)
+	assert.Equal(t, uint64(3), tracer.Stats().TimestampsOutOfRange)
+}
+
+func TestTracerTimestampLimitsRetry(t *testing.T) {
+	tracer, err := elasticapm.NewTracer("tracer_testing", "")
+	require.NoError(t, err)
+	defer tracer.Close()
+	tracer.SetFlushInterval(time.Millisecond)
+	tracer.SetTimestampLimits(elasticapm.TimestampLimits{MaxAge: time.Hour})
+
+	var attempts int
+	tracer.Transport = transporttest.CallbackTransport{
+		Transactions: func(context.Context, *model.TransactionsPayload) error {
+			if attempts++; attempts < 3 {
+				return errors.New("nope")
+			}
+			return nil
+		},
+	}
+	tx := tracer.StartTransaction("historical", "import")
+	tx.Timestamp = time.Now().Add(-2 * time.Hour)
+	tx.End()
+	tracer.StartTransaction("current", "request").End()
+	tracer.Flush(nil)
+
+	// Dropped events are counted once the payload
+	// has been sent, and not for each attempt.
+	assert.Equal(t, 3, attempts)
+	stats := tracer.Stats()
+	assert.Equal(t, uint64(1), stats.TimestampsOutOfRange)
+	assert.Equal(t, uint64(1), stats.TransactionsDropped)
+}
+
+func TestTracerClockSkewCorrection(t *testing.T) {
+	tracer, recorder := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.Transport = statsTransport{
+		Transport: recorder,
+		stats:     transport.Stats{ServerClockOffset: time.Hour},
+	}
+
+	start := time.Now()
+	tracer.StartTransaction("name", "type").End()
+	tracer.Flush(nil)
+	tracer.SetClockSkewCorrection(true)
+	tracer.StartTransaction("name", "type").End()
+	tracer.Flush(nil)
+
+	payloads := recorder.Payloads()
+	require.Len(t, payloads, 2)
+	assert.WithinDuration(t, start, time.Time(payloads[0].Transactions()[0].Timestamp), time.Minute)
+	assert.WithinDuration(t, start.Add(time.Hour), time.Time(payloads[1].Transactions()[0].Timestamp), time.Minute)
+
+	// Small offsets are within the error of the estimate, and are ignored.
+	tracer.Transport = statsTransport{
+		Transport: recorder,
+		stats:     transport.Stats{ServerClockOffset: time.Second},
+	}
+	tracer.StartTransaction("name", "type").End()
+	tracer.Flush(nil)
+	payloads = recorder.Payloads()
+	require.Len(t, payloads, 3)
+	assert.WithinDuration(t, start, time.Time(payloads[2].Transactions()[0].Timestamp), time.Minute)
+}
+
+func TestTracerTimestampLimitsEnv(t *testing.T) {
+	os.Setenv("ELASTIC_APM_TIMESTAMP_MAX_AGE", "3600")
+	defer os.Unsetenv("ELASTIC_APM_TIMESTAMP_MAX_AGE")
+	os.Setenv("ELASTIC_APM_CLAMP_TIMESTAMPS", "true")
+	defer os.Unsetenv("ELASTIC_APM_CLAMP_TIMESTAMPS")
+
+	tracer, err := elasticapm.NewTracer("tracer_testing", "")
+	require.NoError(t, err)
+	defer tracer.Close()
+	recorder := &transporttest.RecorderTransport{}
+	tracer.Transport = recorder
+
+	tx := tracer.StartTransaction("historical", "import")
+	tx.Timestamp = time.Now().Add(-2 * time.Hour)
+	tx.End()
+	tracer.Flush(nil)
+	payloads := recorder.Payloads()
+	require.Len(t, payloads, 1)
+	assert.WithinDuration(t, time.Now().Add(-time.Hour), time.Time(payloads[0].Transactions()[0].Timestamp), time.Minute)
+
+	os.Setenv("ELASTIC_APM_CLAMP_TIMESTAMPS", "maybe")
+	_, err = elasticapm.NewTracer("tracer_testing", "")
+	assert.EqualError(t, err, `failed to parse ELASTIC_APM_CLAMP_TIMESTAMPS: strconv.ParseBool: parsing "maybe": invalid syntax`)
+}
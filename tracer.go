@@ -7,8 +7,11 @@ import (
 	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/elastic/apm-agent-go/internal/apmconfig"
+	"github.com/elastic/apm-agent-go/internal/apmdebug"
 	"github.com/elastic/apm-agent-go/model"
 	"github.com/elastic/apm-agent-go/stacktrace"
 	"github.com/elastic/apm-agent-go/transport"
@@ -49,10 +52,42 @@ type options struct {
 	metricsInterval         time.Duration
 	maxTransactionQueueSize int
 	maxSpans                int
+	spanSamplingThreshold   int
+	recentTransactions      int
 	sampler                 Sampler
 	sanitizedFieldNames     *regexp.Regexp
 	captureBody             CaptureBodyMode
+	captureHeaders          bool
+	headerCaptureFilter     HeaderCaptureFilter
 	spanFramesMinDuration   time.Duration
+	memoryBudget            int64
+	dropUnsampled           dropUnsampledMode
+	tagValueLimits          TagValueLimits
+	supervisor              *model.ProcessSupervisor
+	reportDependencies      bool
+	metricsWorkers          int
+	lowPriority             bool
+	pipelineDepth           int
+	queueShedding           QueueSheddingMode
+	circuitThreshold        int
+	circuitOpenDuration     time.Duration
+	timestampLimits         TimestampLimits
+	clockSkewCorrection     bool
+	spanCompression         spanCompressionConfig
+	selfTracing             bool
+	forceSampleSecret       string
+	trustSamplingPriority   bool
+	schedulerLatency        bool
+	syntheticUserAgents     []string
+	sessionIDHeader         string
+	sessionIDCookie         string
+	baggageTags             []string
+	breakdownMetrics        BreakdownMetricsMode
+	userAgentParsing        UserAgentParsingMode
+	spanDeadlineBudget      float64
+	resultMapper            ResultMapper
+	failureCapture          FailureCaptureMode
+	spanTypeOverrides       []SpanTypeOverride
 	serviceName             string
 	serviceVersion          string
 	serviceEnvironment      string
@@ -85,6 +120,17 @@ func (opts *options) init(continueOnError bool) error {
 		errs = append(errs, err)
 	}
 
+	spanSamplingThreshold, err := initialSpanSamplingThreshold()
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	recentTransactions, err := initialRecentTransactions()
+	if err != nil {
+		recentTransactions = defaultRecentTransactions
+		errs = append(errs, err)
+	}
+
 	sampler, err := initialSampler()
 	if err != nil {
 		sampler = nil
@@ -103,12 +149,134 @@ func (opts *options) init(continueOnError bool) error {
 		errs = append(errs, err)
 	}
 
+	captureHeaders, err := initialCaptureHeaders()
+	if err != nil {
+		captureHeaders = true
+		errs = append(errs, err)
+	}
+
 	spanFramesMinDuration, err := initialSpanFramesMinDuration()
 	if err != nil {
 		spanFramesMinDuration = defaultSpanFramesMinDuration
 		errs = append(errs, err)
 	}
 
+	breakdownMetrics, err := initialBreakdownMetrics()
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	userAgentParsing, err := initialUserAgentParsing()
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	trustSamplingPriority, err := initialTrustSamplingPriority()
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	schedulerLatency, err := initialSchedulerLatency()
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	spanDeadlineBudget, err := initialSpanDeadlineBudget()
+	if err != nil {
+		spanDeadlineBudget = 0
+		errs = append(errs, err)
+	}
+
+	resultMapper, err := initialResultMapper()
+	if err != nil {
+		resultMapper = nil
+		errs = append(errs, err)
+	}
+
+	failureCapture, err := initialFailureCapture()
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	spanTypeOverrides, err := initialSpanTypeOverrides()
+	if err != nil {
+		spanTypeOverrides = nil
+		errs = append(errs, err)
+	}
+
+	memoryBudget, err := initialMemoryBudget()
+	if err != nil {
+		memoryBudget = defaultMemoryBudget
+		errs = append(errs, err)
+	}
+
+	dropUnsampled, err := initialDropUnsampled()
+	if err != nil {
+		dropUnsampled = dropUnsampledAuto
+		errs = append(errs, err)
+	}
+
+	tagValueLimits, err := initialTagValueLimits()
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	supervisor, err := initialSupervisor()
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	reportDependencies, err := initialReportDependencies()
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	metricsWorkers, err := initialMetricsWorkers()
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	lowPriority, err := initialLowPriority()
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	pipelineDepth, err := initialPipelineDepth()
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	queueShedding, err := initialQueueShedding()
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	circuitThreshold, err := initialCircuitBreakerThreshold()
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	circuitOpenDuration, err := initialCircuitBreakerOpenDuration()
+	if err != nil {
+		circuitOpenDuration = defaultCircuitBreakerOpenDuration
+		errs = append(errs, err)
+	}
+
+	timestampLimits, err := initialTimestampLimits()
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	clockSkewCorrection, err := initialClockSkewCorrection()
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	spanCompression, err := initialSpanCompression()
+	if err != nil {
+		errs = append(errs, err)
+	}
+
 	active, err := initialActive()
 	if err != nil {
 		active = true
@@ -126,10 +294,41 @@ func (opts *options) init(continueOnError bool) error {
 	opts.metricsInterval = metricsInterval
 	opts.maxTransactionQueueSize = maxTransactionQueueSize
 	opts.maxSpans = maxSpans
+	opts.spanSamplingThreshold = spanSamplingThreshold
+	opts.recentTransactions = recentTransactions
 	opts.sampler = sampler
 	opts.sanitizedFieldNames = sanitizedFieldNames
 	opts.captureBody = captureBody
+	opts.captureHeaders = captureHeaders
+	opts.headerCaptureFilter = initialHeaderCaptureFilter()
 	opts.spanFramesMinDuration = spanFramesMinDuration
+	opts.spanDeadlineBudget = spanDeadlineBudget
+	opts.resultMapper = resultMapper
+	opts.failureCapture = failureCapture
+	opts.spanTypeOverrides = spanTypeOverrides
+	opts.memoryBudget = memoryBudget
+	opts.dropUnsampled = dropUnsampled
+	opts.tagValueLimits = tagValueLimits
+	opts.supervisor = supervisor
+	opts.reportDependencies = reportDependencies
+	opts.metricsWorkers = metricsWorkers
+	opts.lowPriority = lowPriority
+	opts.pipelineDepth = pipelineDepth
+	opts.queueShedding = queueShedding
+	opts.circuitThreshold = circuitThreshold
+	opts.circuitOpenDuration = circuitOpenDuration
+	opts.timestampLimits = timestampLimits
+	opts.clockSkewCorrection = clockSkewCorrection
+	opts.spanCompression = spanCompression
+	opts.selfTracing = apmdebug.SelfTracing
+	opts.forceSampleSecret = initialForceSampleSecret()
+	opts.trustSamplingPriority = trustSamplingPriority
+	opts.schedulerLatency = schedulerLatency
+	opts.syntheticUserAgents = initialSyntheticUserAgents()
+	opts.sessionIDHeader, opts.sessionIDCookie = initialSessionIDSource()
+	opts.baggageTags = splitEnvList(envBaggageToTags)
+	opts.breakdownMetrics = breakdownMetrics
+	opts.userAgentParsing = userAgentParsing
 	opts.serviceName, opts.serviceVersion, opts.serviceEnvironment = initialService()
 	opts.active = active
 	return nil
@@ -143,7 +342,7 @@ func (opts *options) init(continueOnError bool) error {
 // the maximum transaction queue size is reached. Failure to
 // send will be periodically retried. Once the queue limit has
 // been reached, new transactions will replace older ones in
-// the queue.
+// the queue, or as configured with SetQueueShedding.
 //
 // Errors are sent as soon as possible, but will buffered and
 // later sent in bulk if the tracer is busy, or otherwise cannot
@@ -152,6 +351,10 @@ func (opts *options) init(continueOnError bool) error {
 // once that limit has been reached, new errors will be dropped
 // until the queue is drained.
 //
+// Configuration recorded in transactions, such as the max spans limit,
+// the sampler, and the span linter, is copied when each transaction is
+// started, so changes affect only transactions started afterwards.
+//
 // The exported fields be altered or replaced any time up until
 // any Tracer methods have been invoked.
 type Tracer struct {
@@ -177,18 +380,48 @@ type Tracer struct {
 	statsMu sync.Mutex
 	stats   TracerStats
 
-	maxSpansMu sync.RWMutex
-	maxSpans   int
+	// transactionConfig holds the *transactionConfig copied into
+	// transactions and errors. See updateTransactionConfig.
+	transactionConfigMu sync.Mutex
+	transactionConfig   atomic.Value
 
-	spanFramesMinDurationMu sync.RWMutex
-	spanFramesMinDuration   time.Duration
+	forceSampleSecretMu sync.RWMutex
+	forceSampleSecret   string
+
+	trustSamplingPriorityMu sync.RWMutex
+	trustSamplingPriority   bool
+
+	syntheticUserAgentsMu sync.RWMutex
+	syntheticUserAgents   userAgentPatterns
 
-	samplerMu sync.RWMutex
-	sampler   Sampler
+	sessionIDMu     sync.RWMutex
+	sessionIDHeader string
+	sessionIDCookie string
+
+	moduleSpanTypesMu sync.RWMutex
+	moduleSpanTypes   map[moduleSpanTypeKey]ModuleSpanType
 
 	captureBodyMu sync.RWMutex
 	captureBody   CaptureBodyMode
 
+	serverVersionMu sync.RWMutex
+	serverVersion   string
+
+	leaks              leakDetector
+	memory             memoryBudget
+	recent             recentTransactions
+	transactionMetrics transactionMetrics
+	breakdownMetrics   breakdownMetrics
+
+	// recordMetrics is non-zero if the metrics interval is positive,
+	// and so transaction and breakdown metrics should be recorded.
+	// It must be accessed atomically.
+	recordMetrics uint32
+
+	// self holds the Tracer used for tracing this Tracer's
+	// own operations, or nil if self-tracing is disabled.
+	self *Tracer
+
 	errorPool       sync.Pool
 	spanPool        sync.Pool
 	transactionPool sync.Pool
@@ -201,11 +434,18 @@ type Tracer struct {
 //
 // If serviceName is empty, then the service name will be defined
 // using the ELASTIC_APM_SERVER_NAME environment variable.
+//
+// If ELASTIC_APM_PROFILE names a configuration profile, NewTracer
+// takes defaults from it; NewTracer returns an error if the profile
+// has not been registered. See RegisterProfile.
 func NewTracer(serviceName, serviceVersion string) (*Tracer, error) {
 	var opts options
 	if err := opts.init(false); err != nil {
 		return nil, err
 	}
+	if err := apmconfig.CheckProfile(); err != nil {
+		return nil, err
+	}
 	if serviceName != "" {
 		if err := validateServiceName(serviceName); err != nil {
 			return nil, err
@@ -219,7 +459,7 @@ func NewTracer(serviceName, serviceVersion string) (*Tracer, error) {
 func newTracer(opts options) *Tracer {
 	t := &Tracer{
 		Transport:             transport.Default,
-		process:               &currentProcess,
+		process:               newProcess(opts),
 		system:                &localSystem,
 		closing:               make(chan struct{}),
 		closed:                make(chan struct{}),
@@ -228,35 +468,90 @@ func newTracer(opts options) *Tracer {
 		configCommands:        make(chan tracerConfigCommand),
 		transactions:          make(chan *Transaction, transactionsChannelCap),
 		errors:                make(chan *Error, errorsChannelCap),
-		maxSpans:              opts.maxSpans,
-		sampler:               opts.sampler,
 		captureBody:           opts.captureBody,
-		spanFramesMinDuration: opts.spanFramesMinDuration,
 		active:                opts.active,
+		forceSampleSecret:     opts.forceSampleSecret,
+		trustSamplingPriority: opts.trustSamplingPriority,
+		syntheticUserAgents:   newUserAgentPatterns(opts.syntheticUserAgents),
+		sessionIDHeader:       opts.sessionIDHeader,
+		sessionIDCookie:       opts.sessionIDCookie,
+	}
+	txConfig := &transactionConfig{
+		maxSpans:              opts.maxSpans,
+		spanSamplingThreshold: opts.spanSamplingThreshold,
+		spanFramesMinDuration: opts.spanFramesMinDuration,
+		sampler:               opts.sampler,
+		schedulerLatency:      opts.schedulerLatency,
+		baggageTags:           opts.baggageTags,
+		breakdownMetricsMode:  opts.breakdownMetrics,
+		userAgentParsing:      opts.userAgentParsing,
+		spanDeadlineBudget:    opts.spanDeadlineBudget,
+		resultMapper:          opts.resultMapper,
+		failureCapture:        opts.failureCapture,
+		spanTypeOverrides:     newSpanTypeOverrides(opts.spanTypeOverrides),
+		clock:                 systemClock{},
+		captureHeaders:        opts.captureHeaders,
+		headerCaptureFilter:   opts.headerCaptureFilter,
+		headerCapture:         newHeaderCapture(opts.captureHeaders, opts.headerCaptureFilter),
 	}
+	switch apmdebug.SpanLint {
+	case "log":
+		txConfig.spanLinter = t.LogSpanLintIssues
+	case "panic":
+		txConfig.spanLinter = PanicSpanLintIssues
+	}
+	t.transactionConfig.Store(txConfig)
 	t.Service.Name = opts.serviceName
 	t.Service.Version = opts.serviceVersion
 	t.Service.Environment = opts.serviceEnvironment
+	t.leaks.setThreshold(apmdebug.LeakDetectionThreshold)
+	t.setRecordMetrics(opts.metricsInterval)
+	t.recent.setSize(opts.recentTransactions)
+	t.memory.limit = opts.memoryBudget
 
 	if !t.active {
 		close(t.closed)
 		return t
 	}
+	if opts.selfTracing {
+		t.self = newSelfTracer(t, opts)
+	}
 
 	go t.loop()
 	t.configCommands <- func(cfg *tracerConfig) {
-		cfg.metricsInterval = opts.metricsInterval
-		cfg.flushInterval = opts.flushInterval
-		cfg.maxTransactionQueueSize = opts.maxTransactionQueueSize
 		cfg.maxErrorQueueSize = defaultMaxErrorQueueSize
-		cfg.sanitizedFieldNames = opts.sanitizedFieldNames
 		cfg.preContext = defaultPreContext
 		cfg.postContext = defaultPostContext
-		cfg.metricsGatherers = []MetricsGatherer{&builtinMetricsGatherer{tracer: t}}
+		if metricsEnabled {
+			cfg.metricsGatherers = []MetricsGatherer{&builtinMetricsGatherer{tracer: t}}
+		}
+		cfg.leakDetectionInterval = apmdebug.LeakDetectionThreshold
+		opts.setTracerConfig(cfg)
 	}
 	return t
 }
 
+// setTracerConfig sets the fields of cfg which are taken from opts.
+func (opts *options) setTracerConfig(cfg *tracerConfig) {
+	cfg.flushInterval = opts.flushInterval
+	cfg.metricsInterval = opts.metricsInterval
+	cfg.maxTransactionQueueSize = opts.maxTransactionQueueSize
+	cfg.sanitizedFieldNames = opts.sanitizedFieldNames
+	cfg.dropUnsampled = opts.dropUnsampled
+	cfg.tagValueLimits = opts.tagValueLimits
+	cfg.tagValueExactKeys = makeTagValueExactKeys(opts.tagValueLimits.ExactKeys)
+	cfg.reportDependencies = opts.reportDependencies
+	cfg.metricsWorkers = opts.metricsWorkers
+	cfg.lowPriority = opts.lowPriority
+	cfg.pipelineDepth = opts.pipelineDepth
+	cfg.queueShedding = opts.queueShedding
+	cfg.circuitThreshold = opts.circuitThreshold
+	cfg.circuitOpenDuration = opts.circuitOpenDuration
+	cfg.timestampLimits = opts.timestampLimits
+	cfg.clockSkewCorrection = opts.clockSkewCorrection
+	cfg.spanCompression = opts.spanCompression
+}
+
 // Close closes the Tracer, preventing transactions from being
 // sent to the APM server.
 func (t *Tracer) Close() {
@@ -266,6 +561,9 @@ func (t *Tracer) Close() {
 		close(t.closing)
 	}
 	<-t.closed
+	if t.self != nil {
+		t.self.Close()
+	}
 }
 
 // Flush waits for the Tracer to flush any transactions and errors it currently
@@ -280,8 +578,12 @@ func (t *Tracer) Flush(abort <-chan struct{}) {
 		case <-flushed:
 		case <-t.closed:
 		}
+	case <-abort:
 	case <-t.closed:
 	}
+	if t.self != nil {
+		t.self.Flush(abort)
+	}
 }
 
 // Active reports whether the tracer is active. If the tracer is inactive,
@@ -299,13 +601,27 @@ func (t *Tracer) SetFlushInterval(d time.Duration) {
 }
 
 // SetMetricsInterval sets the metrics interval -- the amount of time in
-// between metrics samples being gathered.
+// between metrics samples being gathered. Transaction duration and
+// breakdown metrics are recorded only while the interval is positive.
 func (t *Tracer) SetMetricsInterval(d time.Duration) {
+	t.setRecordMetrics(d)
 	t.sendConfigCommand(func(cfg *tracerConfig) {
 		cfg.metricsInterval = d
 	})
 }
 
+// setRecordMetrics records whether transaction metrics should be
+// recorded, given the metrics interval d. A non-positive interval
+// disables metrics, so ending a transaction need not take the
+// metrics locks.
+func (t *Tracer) setRecordMetrics(d time.Duration) {
+	var record uint32
+	if d > 0 {
+		record = 1
+	}
+	atomic.StoreUint32(&t.recordMetrics, record)
+}
+
 // SetMaxTransactionQueueSize sets the maximum transaction queue size -- the
 // maximum number of transactions to buffer before flushing to the APM server.
 // If set to a non-positive value, the queue size is unlimited.
@@ -324,6 +640,31 @@ func (t *Tracer) SetMaxErrorQueueSize(n int) {
 	})
 }
 
+// PauseSending pauses sending of transactions, errors and metrics to the
+// APM server, e.g. while the server is being upgraded, or to isolate the
+// application from the network during an incident.
+//
+// While sending is paused, transactions and errors are buffered up to the
+// maximum queue sizes (see SetMaxTransactionQueueSize and
+// SetMaxErrorQueueSize); beyond that the oldest transactions, and the
+// newest errors, are dropped and recorded in the tracer's stats. Metrics
+// are not gathered while sending is paused. Calls to Flush will block
+// until sending is resumed, or the abort channel is signaled.
+func (t *Tracer) PauseSending() {
+	t.sendConfigCommand(func(cfg *tracerConfig) {
+		cfg.sendingPaused = true
+	})
+}
+
+// ResumeSending resumes sending to the APM server after a call to
+// PauseSending, immediately sending any buffered transactions and
+// errors.
+func (t *Tracer) ResumeSending() {
+	t.sendConfigCommand(func(cfg *tracerConfig) {
+		cfg.sendingPaused = false
+	})
+}
+
 // SetContextSetter sets the stacktrace.ContextSetter to be used for
 // setting stacktrace source context. If nil (which is the initial
 // value), no context will be set.
@@ -335,12 +676,36 @@ func (t *Tracer) SetContextSetter(setter stacktrace.ContextSetter) {
 
 // SetLogger sets the Logger to be used for logging the operation of
 // the tracer.
+//
+// If GOMAXPROCS exceeds the CPU quota of the process's container, a
+// warning is logged when the logger is set.
 func (t *Tracer) SetLogger(logger Logger) {
+	if logger != nil {
+		checkGOMAXPROCS(logger, t.system)
+	}
+	t.updateTransactionConfig(func(cfg *transactionConfig) {
+		cfg.logger = logger
+	})
 	t.sendConfigCommand(func(cfg *tracerConfig) {
 		cfg.logger = logger
 	})
 }
 
+// SetTransportErrorHandler sets a function to be called when the tracer
+// fails to send transactions, errors, or metrics to the APM server, so
+// that applications may surface intake failures in their own monitoring.
+// The error passed to the handler wraps the error returned by the
+// transport, which may be obtained with errors.Cause.
+//
+// The handler is called from the tracer's goroutine, so it must not
+// block, or call Tracer methods which change the tracer's configuration.
+// A nil handler disables reporting.
+func (t *Tracer) SetTransportErrorHandler(handler func(error)) {
+	t.sendConfigCommand(func(cfg *tracerConfig) {
+		cfg.transportErrorHandler = handler
+	})
+}
+
 // SetSanitizedFieldNames sets the patterns that will be used to match
 // cookie and form field names for sanitization. Fields matching any
 // of the the supplied patterns will have their values redacted. If
@@ -366,7 +731,13 @@ func (t *Tracer) SetSanitizedFieldNames(patterns ...string) error {
 //
 // RegisterMetricsGatherer returns a function which will deregister g.
 // It may safely be called multiple times.
+//
+// If the agent is built with the elasticapm_nometrics build tag,
+// RegisterMetricsGatherer does nothing.
 func (t *Tracer) RegisterMetricsGatherer(g MetricsGatherer) func() {
+	if !metricsEnabled {
+		return func() {}
+	}
 	// Wrap g in a pointer-to-struct, so we can safely compare.
 	wrapped := &struct{ MetricsGatherer }{MetricsGatherer: g}
 	t.sendConfigCommand(func(cfg *tracerConfig) {
@@ -399,26 +770,26 @@ func (t *Tracer) sendConfigCommand(cmd tracerConfigCommand) {
 // SetSampler sets the sampler the tracer. It is valid to pass nil,
 // in which case all transactions will be sampled.
 func (t *Tracer) SetSampler(s Sampler) {
-	t.samplerMu.Lock()
-	t.sampler = s
-	t.samplerMu.Unlock()
+	t.updateTransactionConfig(func(cfg *transactionConfig) {
+		cfg.sampler = s
+	})
 }
 
 // SetMaxSpans sets the maximum number of spans that will be added
 // to a transaction before dropping. If set to a non-positive value,
 // the number of spans is unlimited.
 func (t *Tracer) SetMaxSpans(n int) {
-	t.maxSpansMu.Lock()
-	t.maxSpans = n
-	t.maxSpansMu.Unlock()
+	t.updateTransactionConfig(func(cfg *transactionConfig) {
+		cfg.maxSpans = n
+	})
 }
 
 // SetSpanFramesMinDuration sets the minimum duration for a span after which
 // we will capture its stack frames.
 func (t *Tracer) SetSpanFramesMinDuration(d time.Duration) {
-	t.spanFramesMinDurationMu.Lock()
-	t.spanFramesMinDuration = d
-	t.spanFramesMinDurationMu.Unlock()
+	t.updateTransactionConfig(func(cfg *transactionConfig) {
+		cfg.spanFramesMinDuration = d
+	})
 }
 
 // SetCaptureBody sets the HTTP request body capture mode.
@@ -450,6 +821,7 @@ func (t *Tracer) Stats() TracerStats {
 	t.statsMu.Lock()
 	stats := t.stats
 	t.statsMu.Unlock()
+	stats.MemoryUsage, stats.MemoryBudget = t.memory.usage()
 	return stats
 }
 
@@ -471,13 +843,18 @@ func (t *Tracer) loop() {
 	var sendMetricsC <-chan time.Time
 	var gatheringMetrics bool
 	var flushC <-chan time.Time
+	var leakDetectionC <-chan time.Time
 	var transactions []*Transaction
 	var errors []*Error
 	var statsUpdates TracerStats
 	sender := sender{
-		tracer: t,
-		cfg:    &cfg,
-		stats:  &statsUpdates,
+		tracer:  t,
+		cfg:     &cfg,
+		stats:   &statsUpdates,
+		breaker: circuitBreaker{tracer: t},
+	}
+	pipeline := transactionsPipeline{
+		results: make(chan *pipelinedBatch),
 	}
 
 	errorsC := t.errors
@@ -492,6 +869,10 @@ func (t *Tracer) loop() {
 	if !metricsTimer.Stop() {
 		<-metricsTimer.C
 	}
+	leakDetectionTimer := time.NewTimer(0)
+	if !leakDetectionTimer.Stop() {
+		<-leakDetectionTimer.C
+	}
 	startTimer := func(ch *<-chan time.Time, timer *time.Timer, interval time.Duration) {
 		if *ch != nil {
 			// Timer already started.
@@ -514,10 +895,27 @@ func (t *Tracer) loop() {
 		startTimer(&flushC, flushTimer, cfg.flushInterval)
 	}
 	startMetricsTimer := func() {
-		startTimer(&sendMetricsC, metricsTimer, cfg.metricsInterval)
+		if metricsEnabled {
+			startTimer(&sendMetricsC, metricsTimer, cfg.metricsInterval)
+		}
+	}
+	startLeakDetectionTimer := func() {
+		startTimer(&leakDetectionC, leakDetectionTimer, cfg.leakDetectionInterval)
 	}
 
 	receivedTransaction := func(tx *Transaction, stats *TracerStats) {
+		if cfg.queueShedding == QueueSheddingPriority && cfg.maxTransactionQueueSize > 0 && len(transactions) >= cfg.maxTransactionQueueSize {
+			var shed *Transaction
+			transactions, shed = shedUnsampled(transactions, tx)
+			if shed != nil {
+				shed.reset()
+				t.transactionPool.Put(shed)
+				stats.TransactionsDropped++
+				if shed == tx {
+					return
+				}
+			}
+		}
 		if cfg.maxTransactionQueueSize > 0 && len(transactions) >= cfg.maxTransactionQueueSize {
 			// The queue is full, so pop the oldest item.
 			// TODO(axw) use container/ring? implement
@@ -543,11 +941,27 @@ func (t *Tracer) loop() {
 		case <-t.closing:
 			return
 		case cmd := <-t.configCommands:
+			wasPaused := cfg.sendingPaused
 			cmd(&cfg)
+			sender.workers.configure(cfg.metricsWorkers, cfg.lowPriority)
 			if cfg.maxErrorQueueSize <= 0 || len(errors) < cfg.maxErrorQueueSize {
 				errorsC = t.errors
 			}
 			startMetricsTimer()
+			startLeakDetectionTimer()
+			if !wasPaused || cfg.sendingPaused {
+				continue
+			}
+			// Sending has been resumed; send anything
+			// buffered while it was paused.
+			flushC = nil
+			sendTransactions = true
+		case <-leakDetectionC:
+			leakDetectionC = nil
+			if cfg.logger != nil {
+				t.leaks.check(cfg.logger)
+			}
+			startLeakDetectionTimer()
 			continue
 		case e := <-errorsC:
 			errors = append(errors, e)
@@ -596,6 +1010,15 @@ func (t *Tracer) loop() {
 		case <-gatheredMetrics:
 			gatheringMetrics = false
 			sendMetrics = true
+		case b := <-pipeline.results:
+			// Enqueue any transactions not sent to be
+			// resent when the retry timer fires.
+			for _, tx := range sender.pipelinedTransactionsSent(b, &pipeline) {
+				receivedTransaction(tx, &statsUpdates)
+			}
+			pipeline.releaseBatch(b)
+			sendTransactions = pipeline.pending
+			pipeline.pending = false
 		}
 
 		if remainder := cfg.maxErrorQueueSize - len(errors); remainder > 0 {
@@ -605,25 +1028,95 @@ func (t *Tracer) loop() {
 				remainder--
 			}
 		}
-		if sender.sendErrors(ctx, errors) {
+		if cfg.sendingPaused {
+			// Keep buffering transactions and errors until sending
+			// is resumed. Metrics are not retried, so discard them.
+			if cfg.maxErrorQueueSize > 0 && len(errors) >= cfg.maxErrorQueueSize {
+				errorsC = nil
+			}
+			if sendMetrics {
+				sender.metrics.reset()
+			}
+			if gatherMetrics || sendMetrics {
+				if forceSentMetrics != nil {
+					forceSentMetrics <- struct{}{}
+					forceSentMetrics = nil
+					forceSendMetrics = t.forceSendMetrics
+				}
+				startMetricsTimer()
+			}
+			if !statsUpdates.isZero() {
+				t.statsMu.Lock()
+				t.stats.accumulate(statsUpdates)
+				t.statsMu.Unlock()
+			}
+			continue
+		}
+		if sender.breaker.open() {
+			// The circuit is open, so discard events rather
+			// than attempting to send them.
 			for _, e := range errors {
 				e.reset()
 				t.errorPool.Put(e)
 			}
+			statsUpdates.ErrorsDropped += uint64(len(errors))
 			errors = errors[:0]
 			errorsC = t.errors
+			if sendTransactions {
+				sender.recycleTransactions(transactions)
+				statsUpdates.TransactionsDropped += uint64(len(transactions))
+				transactions = transactions[:0]
+				if flushed != nil {
+					forceFlush = t.forceFlush
+					flushed <- struct{}{}
+					flushed = nil
+				}
+			}
+			if sendMetrics {
+				sender.metrics.reset()
+			}
+			if gatherMetrics || sendMetrics {
+				if forceSentMetrics != nil {
+					forceSentMetrics <- struct{}{}
+					forceSentMetrics = nil
+					forceSendMetrics = t.forceSendMetrics
+				}
+				startMetricsTimer()
+			}
+			if !statsUpdates.isZero() {
+				t.statsMu.Lock()
+				t.stats.accumulate(statsUpdates)
+				t.statsMu.Unlock()
+			}
+			continue
+		}
+		if n := sender.sendErrors(ctx, errors); n > 0 {
+			for _, e := range errors[:n] {
+				e.reset()
+				t.errorPool.Put(e)
+			}
+			errors = errors[:copy(errors, errors[n:])]
+			errorsC = t.errors
 		} else if len(errors) == cfg.maxErrorQueueSize {
 			errorsC = nil
 		}
+		pipelined := cfg.pipelineDepth > 1 || pipeline.inflight > 0
 		if sendTransactions {
-			if sender.sendTransactions(ctx, transactions) {
-				for _, tx := range transactions {
-					tx.reset()
-					t.transactionPool.Put(tx)
+			if cfg.pipelineDepth > 1 {
+				if pipeline.inflight < cfg.pipelineDepth {
+					if len(transactions) > 0 {
+						transactions = sender.sendTransactionsAsync(ctx, transactions, &pipeline)
+					}
+				} else {
+					// Send when an in-flight request completes.
+					pipeline.pending = true
 				}
-				transactions = transactions[:0]
+			} else if n := sender.sendTransactions(ctx, transactions); n > 0 {
+				sender.recycleTransactions(transactions[:n])
+				transactions = transactions[:copy(transactions, transactions[n:])]
 			}
 		}
+		sender.breaker.record(&cfg, &statsUpdates)
 		if !statsUpdates.isZero() {
 			t.statsMu.Lock()
 			t.stats.accumulate(statsUpdates)
@@ -652,7 +1145,13 @@ func (t *Tracer) loop() {
 			startFlushTimer()
 			continue
 		}
-		if sendTransactions && flushed != nil {
+		flushDone := sendTransactions
+		if pipelined {
+			// When pipelining, the flush is complete once there
+			// are no transactions queued or in flight.
+			flushDone = pipeline.idle() && len(transactions) == 0
+		}
+		if flushDone && flushed != nil {
 			forceFlush = t.forceFlush
 			flushed <- struct{}{}
 			flushed = nil
@@ -668,10 +1167,26 @@ type tracerConfig struct {
 	maxTransactionQueueSize int
 	maxErrorQueueSize       int
 	logger                  Logger
+	transportErrorHandler   func(error)
 	metricsGatherers        []MetricsGatherer
 	contextSetter           stacktrace.ContextSetter
 	preContext, postContext int
 	sanitizedFieldNames     *regexp.Regexp
+	leakDetectionInterval   time.Duration
+	dropUnsampled           dropUnsampledMode
+	tagValueLimits          TagValueLimits
+	tagValueExactKeys       map[string]bool
+	reportDependencies      bool
+	metricsWorkers          int
+	lowPriority             bool
+	pipelineDepth           int
+	queueShedding           QueueSheddingMode
+	circuitThreshold        int
+	circuitOpenDuration     time.Duration
+	timestampLimits         TimestampLimits
+	clockSkewCorrection     bool
+	spanCompression         spanCompressionConfig
+	sendingPaused           bool
 }
 
 type tracerConfigCommand func(*tracerConfig)
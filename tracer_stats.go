@@ -7,6 +7,38 @@ type TracerStats struct {
 	ErrorsDropped       uint64
 	TransactionsSent    uint64
 	TransactionsDropped uint64
+
+	// TransactionsUnsent holds the number of unsampled transactions
+	// which were intentionally not sent to the server. See
+	// Tracer.SetDropUnsampledTransactions.
+	TransactionsUnsent uint64
+
+	// TransactionsSpooled and ErrorsSpooled hold the number of
+	// transactions and errors which could not be sent, and were
+	// instead spooled by the transport to be sent later. They are
+	// not included in TransactionsSent and ErrorsSent. See
+	// transport.HTTPTransport.SetSpoolDir.
+	TransactionsSpooled uint64
+	ErrorsSpooled       uint64
+
+	// MemoryUsage holds the estimated number of bytes consumed by
+	// queued events, and MemoryBudget the configured limit. These
+	// are only reported by Tracer.Stats, and MemoryUsage is only
+	// accounted when MemoryBudget is positive.
+	MemoryUsage  int64
+	MemoryBudget int64
+
+	// CircuitBreakerOpened holds the number of times the circuit
+	// breaker has been opened, and CircuitBreakerOpen whether it is
+	// currently open, or awaiting a successful send to be closed.
+	// See Tracer.SetCircuitBreaker.
+	CircuitBreakerOpened uint64
+	CircuitBreakerOpen   bool
+
+	// TimestampsOutOfRange holds the number of transactions and errors
+	// with timestamps outside the limits set with Tracer.SetTimestampLimits,
+	// which were either clamped or dropped.
+	TimestampsOutOfRange uint64
 }
 
 // TracerStatsErrors holds error statistics for a Tracer.
@@ -30,4 +62,9 @@ func (s *TracerStats) accumulate(rhs TracerStats) {
 	s.ErrorsDropped += rhs.ErrorsDropped
 	s.TransactionsSent += rhs.TransactionsSent
 	s.TransactionsDropped += rhs.TransactionsDropped
+	s.TransactionsUnsent += rhs.TransactionsUnsent
+	s.TransactionsSpooled += rhs.TransactionsSpooled
+	s.ErrorsSpooled += rhs.ErrorsSpooled
+	s.CircuitBreakerOpened += rhs.CircuitBreakerOpened
+	s.TimestampsOutOfRange += rhs.TimestampsOutOfRange
 }
@@ -1,14 +1,21 @@
 package elasticapm_test
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/model"
+	"github.com/elastic/apm-agent-go/transport"
 	"github.com/elastic/apm-agent-go/transport/transporttest"
 )
 
@@ -81,6 +88,190 @@ func TestTracerMaxQueueSize(t *testing.T) {
 	}, tracer.Stats())
 }
 
+func TestTracerQueueSheddingPriority(t *testing.T) {
+	tracer, err := elasticapm.NewTracer("tracer_testing", "")
+	assert.NoError(t, err)
+	defer tracer.Close()
+
+	// Prevent any transactions from being sent.
+	tracer.Transport = transporttest.ErrorTransport{Error: errors.New("nope")}
+	tracer.SetSampler(namePrefixSampler("sampled"))
+	tracer.SetMaxTransactionQueueSize(3)
+	tracer.SetQueueShedding(elasticapm.QueueSheddingPriority)
+
+	// Once the queue is full, the queued unsampled transaction
+	// is discarded first, and then new unsampled transactions.
+	for _, name := range []string{"sampled1", "unsampled1", "sampled2", "sampled3", "unsampled2"} {
+		tracer.StartTransaction(name, "type").End()
+	}
+	for tracer.Stats().TransactionsDropped < 2 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	var recorder transporttest.RecorderTransport
+	tracer.Transport = &recorder
+	tracer.Flush(nil)
+
+	var names []string
+	for _, tx := range recorder.Payloads()[0].Transactions() {
+		names = append(names, tx.Name)
+	}
+	assert.Equal(t, []string{"sampled1", "sampled2", "sampled3"}, names)
+	assert.Equal(t, uint64(2), tracer.Stats().TransactionsDropped)
+}
+
+// namePrefixSampler samples transactions whose names have the given prefix.
+type namePrefixSampler string
+
+func (s namePrefixSampler) Sample(tx *elasticapm.Transaction) bool {
+	return strings.HasPrefix(tx.Name, string(s))
+}
+
+func TestTracerMemoryBudget(t *testing.T) {
+	tracer, err := elasticapm.NewTracer("tracer_testing", "")
+	assert.NoError(t, err)
+	defer tracer.Close()
+
+	// Prevent any transactions from being sent.
+	tracer.Transport = transporttest.ErrorTransport{Error: errors.New("nope")}
+
+	// Each transaction is estimated to consume at least 512 bytes,
+	// so only the first transaction fits within the budget.
+	tracer.SetMemoryBudget(1000)
+	for i := 0; i < 10; i++ {
+		tracer.StartTransaction("name", "type").End()
+	}
+	stats := tracer.Stats()
+	assert.Equal(t, uint64(9), stats.TransactionsDropped)
+	assert.Equal(t, int64(1000), stats.MemoryBudget)
+	assert.InDelta(t, 512, stats.MemoryUsage, 100)
+
+	// Once the queued transaction is sent, the memory is released.
+	tracer.Transport = transporttest.Discard
+	tracer.Flush(nil)
+	assert.Equal(t, int64(0), tracer.Stats().MemoryUsage)
+}
+
+func TestTracerDropUnsampledTransactions(t *testing.T) {
+	for _, test := range []struct {
+		version string
+		set     func(*elasticapm.Tracer)
+		sent    int
+	}{
+		{version: "7.17.0", sent: 2},
+		{version: "8.0.0", sent: 1},
+		{version: "8.0.0", set: func(t *elasticapm.Tracer) { t.SetDropUnsampledTransactions(false) }, sent: 2},
+		{version: "7.17.0", set: func(t *elasticapm.Tracer) { t.SetDropUnsampledTransactions(true) }, sent: 1},
+	} {
+		tracer, recorder := transporttest.NewRecorderTracer()
+		tracer.Transport = versionedTransport{RecorderTransport: recorder, version: test.version}
+		if test.set != nil {
+			test.set(tracer)
+		}
+
+		sampled := tracer.StartTransaction("sampled", "type")
+		tracer.SetSampler(elasticapm.NewRatioSampler(0, rand.NewSource(0)))
+		unsampled := tracer.StartTransaction("unsampled", "type")
+		assert.False(t, unsampled.Sampled())
+		sampled.End()
+		unsampled.End()
+		tracer.Flush(nil)
+
+		transactions := recorder.Payloads()[0].Transactions()
+		assert.Len(t, transactions, test.sent, "version %s", test.version)
+		stats := tracer.Stats()
+		assert.Equal(t, uint64(test.sent), stats.TransactionsSent)
+		assert.Equal(t, uint64(2-test.sent), stats.TransactionsUnsent)
+		tracer.Close()
+	}
+}
+
+func TestTracerServerVersionFeatures(t *testing.T) {
+	for _, test := range []struct {
+		version       string
+		destination   bool
+		serviceTarget bool
+	}{
+		{version: "", destination: true, serviceTarget: true},
+		{version: "7.6.0", destination: false, serviceTarget: false},
+		{version: "8.2.1", destination: true, serviceTarget: false},
+		{version: "8.3.0", destination: true, serviceTarget: true},
+	} {
+		tracer, recorder := transporttest.NewRecorderTracer()
+		if test.version != "" {
+			tracer.Transport = versionedTransport{RecorderTransport: recorder, version: test.version}
+		}
+
+		tx := tracer.StartTransaction("name", "type")
+		span := tx.StartSpan("SELECT FROM foo", "db.postgresql.query", nil)
+		span.Context.SetTag("tag", "value")
+		span.Context.SetServiceTarget(elasticapm.ServiceTargetSpanContext{Type: "postgresql", Name: "orders"})
+		span.End()
+		tx.End()
+		tracer.Flush(nil)
+		assert.Equal(t, test.version, tracer.ServerVersion())
+
+		spans := recorder.Payloads()[0].Transactions()[0].Spans
+		require.Len(t, spans, 1)
+		assert.Equal(t, test.destination, spans[0].Context.Destination != nil, "version %s", test.version)
+		assert.Equal(t, test.serviceTarget, spans[0].Context.Service != nil, "version %s", test.version)
+		assert.Equal(t, map[string]string{"tag": "value"}, spans[0].Context.Tags)
+		tracer.Close()
+	}
+}
+
+type versionedTransport struct {
+	*transporttest.RecorderTransport
+	version string
+}
+
+func (t versionedTransport) ServerVersion(context.Context) (string, error) {
+	return t.version, nil
+}
+
+func TestTracerServerVersionSlow(t *testing.T) {
+	tracer, recorder := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	release := make(chan struct{})
+	tracer.Transport = slowVersionedTransport{
+		versionedTransport: versionedTransport{RecorderTransport: recorder, version: "7.6.0"},
+		release:            release,
+	}
+
+	// The first send waits a limited time for the
+	// server version, and then sends all fields.
+	before := time.Now()
+	tracer.StartTransaction("name", "type").End()
+	tracer.Flush(nil)
+	assert.WithinDuration(t, before, time.Now(), 5*time.Second)
+	assert.Equal(t, "", tracer.ServerVersion())
+	require.Len(t, recorder.Payloads(), 1)
+
+	// Discovery continues in the background, and the
+	// version is picked up by a later send.
+	close(release)
+	for i := 0; i < 100 && tracer.ServerVersion() == ""; i++ {
+		time.Sleep(10 * time.Millisecond)
+		tracer.StartTransaction("name", "type").End()
+		tracer.Flush(nil)
+	}
+	assert.Equal(t, "7.6.0", tracer.ServerVersion())
+}
+
+type slowVersionedTransport struct {
+	versionedTransport
+	release chan struct{}
+}
+
+func (t slowVersionedTransport) ServerVersion(ctx context.Context) (string, error) {
+	select {
+	case <-t.release:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	return t.versionedTransport.ServerVersion(ctx)
+}
+
 func TestTracerRetryTimer(t *testing.T) {
 	tracer, err := elasticapm.NewTracer("tracer_testing", "")
 	assert.NoError(t, err)
@@ -159,6 +350,157 @@ func TestTracerRetryTimerFlush(t *testing.T) {
 	}
 }
 
+func TestTracerRetryPartialSend(t *testing.T) {
+	tracer, err := elasticapm.NewTracer("tracer_testing", "")
+	assert.NoError(t, err)
+	defer tracer.Close()
+	tracer.SetFlushInterval(100 * time.Millisecond)
+	transactions := make(chan transporttest.SendTransactionsRequest)
+	tracer.Transport = &transporttest.ChannelTransport{Transactions: transactions}
+
+	for _, name := range []string{"a", "b", "c"} {
+		tracer.StartTransaction(name, "type").End()
+	}
+	cancel := make(chan struct{})
+	defer close(cancel)
+	go tracer.Flush(cancel)
+
+	// The first request sends only two of the transactions,
+	// so only the third should be sent again.
+	var names [][]string
+	for _, err := range []error{&transport.PartialSendError{Sent: 2, Err: errors.New("nope")}, nil} {
+		select {
+		case req := <-transactions:
+			var batch []string
+			for _, tx := range req.Payload.Transactions {
+				batch = append(batch, tx.Name)
+			}
+			names = append(names, batch)
+			req.Result <- err
+		case <-time.After(10 * time.Second):
+			t.Fatal("timed out waiting for transactions to be sent")
+		}
+	}
+	assert.Equal(t, [][]string{{"a", "b", "c"}, {"c"}}, names)
+	for tracer.Stats().TransactionsSent < 3 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, uint64(1), tracer.Stats().Errors.SendTransactions)
+}
+
+func TestTracerSpooledSend(t *testing.T) {
+	tracer, err := elasticapm.NewTracer("tracer_testing", "")
+	assert.NoError(t, err)
+	defer tracer.Close()
+	var requests int
+	tracer.Transport = &transporttest.CallbackTransport{
+		Transactions: func(ctx context.Context, p *model.TransactionsPayload) error {
+			requests++
+			return &transport.SpooledError{Spooled: len(p.Transactions)}
+		},
+	}
+
+	// Spooled transactions are not counted as sent, or as
+	// send errors, and are not sent again.
+	tracer.StartTransaction("a", "type").End()
+	tracer.StartTransaction("b", "type").End()
+	tracer.Flush(nil)
+	tracer.Flush(nil)
+	stats := tracer.Stats()
+	assert.Equal(t, uint64(2), stats.TransactionsSpooled)
+	assert.Equal(t, uint64(0), stats.TransactionsSent)
+	assert.Equal(t, uint64(0), stats.Errors.SendTransactions)
+	assert.Equal(t, 1, requests)
+}
+
+func TestTracerPauseSending(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetMaxTransactionQueueSize(5)
+	tracer.PauseSending()
+
+	for i := 0; i < 10; i++ {
+		tracer.StartTransaction("name", "type").End()
+	}
+	tracer.NewError(errors.New("boom")).Send()
+	for tracer.Stats().TransactionsDropped < 5 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Flush blocks while sending is paused.
+	abort := make(chan struct{})
+	time.AfterFunc(50*time.Millisecond, func() { close(abort) })
+	tracer.Flush(abort)
+	assert.Empty(t, transport.Payloads())
+
+	tracer.ResumeSending()
+	tracer.Flush(nil)
+	payloads := transport.Payloads()
+	require.Len(t, payloads, 2)
+	assert.Len(t, payloads[0].Errors(), 1)
+	assert.Len(t, payloads[1].Transactions(), 5)
+	assert.Equal(t, uint64(5), tracer.Stats().TransactionsDropped)
+}
+
+func TestTracerTransportErrorHandler(t *testing.T) {
+	if !elasticapm.MetricsEnabled {
+		t.Skip("metrics are compiled out")
+	}
+	tracer, err := elasticapm.NewTracer("tracer_testing", "")
+	require.NoError(t, err)
+	defer tracer.Close()
+	tracer.Transport = transporttest.ErrorTransport{Error: errors.New("nope")}
+
+	errs := make(chan error, 10)
+	tracer.SetTransportErrorHandler(func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	})
+	tracer.NewError(errors.New("boom")).Send()
+	tracer.SendMetrics(nil)
+
+	// Failed errors remain queued and may be resent
+	// before metrics are sent, so wait for the latter.
+	messages := make(map[string]bool)
+	for !messages["sending metrics failed: nope"] {
+		select {
+		case err := <-errs:
+			messages[err.Error()] = true
+		case <-time.After(10 * time.Second):
+			t.Fatal("timed out waiting for transport errors")
+		}
+	}
+	assert.True(t, messages["sending errors failed: nope"])
+}
+
+func TestTracerConfigConcurrent(t *testing.T) {
+	tracer, _ := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			tracer.SetMaxSpans(i)
+			tracer.SetSpanFramesMinDuration(time.Duration(i))
+			tracer.SetCaptureHeaders(i%2 == 0)
+			tracer.SetHeaderCaptureFilter(elasticapm.HeaderCaptureFilter{Include: []string{"X-Request-Id"}})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			tx := tracer.StartTransaction("name", "type")
+			tx.StartSpan("name", "type", nil).End()
+			tx.Discard()
+		}
+	}()
+	wg.Wait()
+}
+
 func TestTracerMaxSpans(t *testing.T) {
 	tracer, r := transporttest.NewRecorderTracer()
 	defer tracer.Close()
@@ -187,7 +529,162 @@ func TestTracerMaxSpans(t *testing.T) {
 	assert.Len(t, transaction.Spans, 2)
 }
 
+func TestTracerSpanSampling(t *testing.T) {
+	tracer, r := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetMaxSpans(0)
+	tracer.SetSpanSamplingThreshold(10)
+
+	tx := tracer.StartTransaction("name", "type")
+	var tail int
+	for i := 0; i < 1000; i++ {
+		span := tx.StartSpan("name", "db.query", nil)
+		if i < 10 {
+			assert.False(t, span.Dropped())
+		} else if i >= 100 && !span.Dropped() {
+			tail++
+		}
+		span.End()
+	}
+	tx.End()
+	tracer.Flush(nil)
+
+	// Spans are still recorded after the threshold,
+	// but with decreasing probability.
+	assert.NotZero(t, tail)
+	transaction := r.Payloads()[0].Transactions()[0]
+	assert.True(t, len(transaction.Spans) < 200, "%d spans recorded", len(transaction.Spans))
+	dropped := 1000 - len(transaction.Spans)
+	assert.Equal(t, dropped, transaction.SpanCount.Dropped.Total)
+	assert.Equal(t, []model.DroppedSpansStats{{Type: "db.query", Count: dropped}}, transaction.DroppedSpansStats)
+}
+
+func TestTracerDroppedParentSpan(t *testing.T) {
+	tracer, r := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetMaxSpans(2)
+	tracer.SetFailureCapture(elasticapm.FailureCaptureSpans)
+
+	tx := tracer.StartTransaction("name", "type")
+	root := tx.StartSpan("root", "type", nil)
+	a := tx.StartSpan("a", "type", root)
+	b := tx.StartSpan("b", "type", a)
+	x := tx.StartSpan("x", "type", nil)
+	require.True(t, b.Dropped())
+	require.True(t, x.Dropped())
+	tx.MarkFailed()
+	c := tx.StartSpan("c", "type", b)
+	d := tx.StartSpan("d", "type", x)
+	require.False(t, c.Dropped())
+	require.False(t, d.Dropped())
+	for _, span := range []*elasticapm.Span{d, c, x, b, a, root} {
+		span.End()
+	}
+	tx.End()
+	tracer.Flush(nil)
+
+	// The children of a dropped span are attributed
+	// to its nearest recorded ancestor, if any.
+	spans := r.Payloads()[0].Transactions()[0].Spans
+	require.Len(t, spans, 4)
+	assert.Equal(t, "c", spans[2].Name)
+	require.NotNil(t, spans[2].Parent)
+	assert.Equal(t, int64(1), *spans[2].Parent)
+	assert.Equal(t, "d", spans[3].Name)
+	assert.Nil(t, spans[3].Parent)
+}
+
+func TestTracerDroppedExitSpans(t *testing.T) {
+	tracer, r := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetMaxSpans(1)
+
+	target := elasticapm.ServiceTargetSpanContext{Type: "mysql", Name: "orders"}
+	tx := tracer.StartTransaction("name", "type")
+	span := tx.StartExitSpan("SELECT FROM foo", "db.mysql.query", nil, target)
+	assert.False(t, span.Dropped())
+	assert.True(t, span.IsExitSpan())
+	span.End()
+	for i := 0; i < 3; i++ {
+		span := tx.StartExitSpan("SELECT FROM foo", "db.mysql.query", nil, target)
+		assert.True(t, span.Dropped())
+		assert.False(t, span.IsExitSpan())
+		span.Duration = 10 * time.Millisecond
+		span.End()
+	}
+	tx.StartSpan("name", "custom", nil).End()
+	tx.End()
+	tracer.Flush(nil)
+
+	transaction := r.Payloads()[0].Transactions()[0]
+	require.Len(t, transaction.Spans, 1)
+	assert.Equal(t, &model.DestinationSpanContext{
+		Service: &model.DestinationServiceSpanContext{Resource: "mysql/orders"},
+	}, transaction.Spans[0].Context.Destination)
+	assert.Equal(t, 4, transaction.SpanCount.Dropped.Total)
+	assert.Equal(t, []model.DroppedSpansStats{{
+		Type:  "custom",
+		Count: 1,
+	}, {
+		Type:                       "db.mysql.query",
+		DestinationServiceResource: "mysql/orders",
+		Count:                      3,
+		Duration: &model.DroppedSpansDuration{
+			Count: 3,
+			Sum:   model.DroppedSpansDurationSum{US: 30000},
+		},
+	}}, transaction.DroppedSpansStats)
+}
+
+func TestTracerDroppedExitSpanEndedAfterTransaction(t *testing.T) {
+	tracer, r := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetMaxSpans(1)
+
+	target := elasticapm.ServiceTargetSpanContext{Type: "mysql"}
+	tx := tracer.StartTransaction("name", "type")
+	tx.StartSpan("name", "custom", nil).End()
+	span := tx.StartExitSpan("SELECT FROM foo", "db.mysql.query", nil, target)
+	tx.End()
+	span.End() // must not be recorded in the ended transaction
+	tracer.Flush(nil)
+
+	transaction := r.Payloads()[0].Transactions()[0]
+	assert.Equal(t, []model.DroppedSpansStats{{
+		Type:                       "db.mysql.query",
+		DestinationServiceResource: "mysql",
+		Count:                      1,
+	}}, transaction.DroppedSpansStats)
+}
+
+func TestTracerSpanRef(t *testing.T) {
+	tracer, r := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	tx := tracer.StartTransaction("name", "type")
+	ended := tx.StartSpan("ended", "custom", nil).Ref()
+	truncated := tx.StartSpan("truncated", "custom", nil).Ref()
+	assert.True(t, ended.Do(func(span *elasticapm.Span) { span.End() }))
+	tx.End()
+	assert.False(t, truncated.Do(func(span *elasticapm.Span) {
+		t.Error("span used after transaction ended")
+	}))
+	tracer.Flush(nil)
+
+	spans := r.Payloads()[0].Transactions()[0].Spans
+	require.Len(t, spans, 2)
+	assert.Equal(t, "custom", spans[0].Type)
+	assert.Equal(t, "custom.truncated", spans[1].Type)
+
+	var noTx *elasticapm.Transaction
+	dropped := noTx.StartSpan("dropped", "custom", nil)
+	assert.False(t, dropped.Ref().Do(func(*elasticapm.Span) {}))
+}
+
 func TestTracerErrors(t *testing.T) {
+	if !elasticapm.StacktraceEnabled {
+		t.Skip("stack traces are compiled out")
+	}
 	tracer, r := transporttest.NewRecorderTracer()
 	defer tracer.Close()
 
@@ -274,6 +771,38 @@ func TestTracerRecover(t *testing.T) {
 	assert.Equal(t, transaction.ID, error0.Transaction.ID)
 }
 
+func TestTracerRecoverStructured(t *testing.T) {
+	if !elasticapm.StacktraceEnabled {
+		t.Skip("stack traces are compiled out")
+	}
+	tracer, r := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	capturePanic(tracer, panicCode(42))
+	tracer.Flush(nil)
+
+	error0 := r.Payloads()[0].Errors()[0]
+	assert.Equal(t, "code 42", error0.Exception.Message)
+	assert.Equal(t, "github.com/elastic/apm-agent-go_test", error0.Exception.Module)
+	assert.Equal(t, "panicCode", error0.Exception.Type)
+	assert.Equal(t, map[string]interface{}{
+		"panic_value_type":   "elasticapm_test.panicCode",
+		"panic_value_string": "code 42",
+		"panic_value":        float64(42), // decoded from JSON
+	}, error0.Exception.Attributes)
+
+	// The stacktrace should begin at the panic site.
+	require.NotEmpty(t, error0.Exception.Stacktrace)
+	assert.Equal(t, "capturePanic", error0.Exception.Stacktrace[0].Function)
+	assert.Equal(t, "capturePanic", error0.Culprit)
+}
+
+type panicCode int
+
+func (c panicCode) String() string {
+	return fmt.Sprintf("code %d", int(c))
+}
+
 func capturePanic(tracer *elasticapm.Tracer, v interface{}) {
 	tx := tracer.StartTransaction("name", "type")
 	defer tx.End()
@@ -287,6 +816,9 @@ func TestTracerServiceNameValidation(t *testing.T) {
 }
 
 func TestSpanStackTrace(t *testing.T) {
+	if !elasticapm.StacktraceEnabled {
+		t.Skip("stack traces are compiled out")
+	}
 	tracer, r := transporttest.NewRecorderTracer()
 	defer tracer.Close()
 	tracer.SetSpanFramesMinDuration(10 * time.Millisecond)
@@ -323,3 +855,45 @@ func TestSpanStackTrace(t *testing.T) {
 	assert.NotNil(t, span2.Stacktrace)
 	assert.Equal(t, span2.Stacktrace[0].Function, "TestSpanStackTrace")
 }
+
+func TestSpanStackTraceShared(t *testing.T) {
+	if !elasticapm.StacktraceEnabled {
+		t.Skip("stack traces are compiled out")
+	}
+	tracer, r := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	var setter countingContextSetter
+	tracer.SetContextSetter(&setter)
+
+	tx := tracer.StartTransaction("name", "type")
+	for i := 0; i < 3; i++ {
+		s := tx.StartSpan("name", "type", nil)
+		s.SetStacktrace(0)
+		s.End()
+	}
+	s := tx.StartSpan("name", "type", nil)
+	s.SetStacktrace(0)
+	s.End()
+	tx.End()
+	tracer.Flush(nil)
+
+	transaction := r.Payloads()[0].Transactions()[0]
+	require.Len(t, transaction.Spans, 4)
+	stacktrace := transaction.Spans[0].Stacktrace
+	require.NotEmpty(t, stacktrace)
+	assert.Equal(t, stacktrace, transaction.Spans[1].Stacktrace)
+	assert.Equal(t, stacktrace, transaction.Spans[2].Stacktrace)
+	assert.NotEqual(t, stacktrace, transaction.Spans[3].Stacktrace)
+
+	// Source context is set once for each distinct stack trace.
+	assert.Equal(t, len(stacktrace)+len(transaction.Spans[3].Stacktrace), setter.n)
+}
+
+type countingContextSetter struct {
+	n int
+}
+
+func (s *countingContextSetter) SetContext(*model.StacktraceFrame, int, int) error {
+	s.n++
+	return nil
+}
@@ -0,0 +1,65 @@
+package elasticapm
+
+import (
+	"context"
+	"sync"
+)
+
+var (
+	tracersMu sync.RWMutex
+	tracers   map[string]*Tracer
+)
+
+// RegisterTracer registers t with the given name, replacing any tracer
+// previously registered with the name. If t is nil, any tracer registered
+// with the name is unregistered.
+//
+// Named tracers allow middleware to select a tracer per tenant or
+// component, e.g. with ContextWithTracer(ctx, RegisteredTracer(tenant)),
+// while library code obtains the tracer with TracerFromContext.
+func RegisterTracer(name string, t *Tracer) {
+	tracersMu.Lock()
+	defer tracersMu.Unlock()
+	if t == nil {
+		delete(tracers, name)
+		return
+	}
+	if tracers == nil {
+		tracers = make(map[string]*Tracer)
+	}
+	tracers[name] = t
+}
+
+// RegisteredTracer returns the tracer registered with the given
+// name using RegisterTracer, or nil if there is none.
+func RegisteredTracer(name string) *Tracer {
+	tracersMu.RLock()
+	defer tracersMu.RUnlock()
+	return tracers[name]
+}
+
+// ContextWithTracer returns a copy of parent in which the given tracer
+// is stored, for use by TracerFromContext. If t is nil, parent is
+// returned unmodified.
+func ContextWithTracer(parent context.Context, t *Tracer) context.Context {
+	if t == nil {
+		return parent
+	}
+	return context.WithValue(parent, contextTracerKey{}, t)
+}
+
+// TracerFromContext returns the tracer to use for ctx: the tracer added
+// to the context previously using ContextWithTracer, if any; otherwise
+// the tracer of the transaction in the context, if any; and otherwise
+// DefaultTracer.
+func TracerFromContext(ctx context.Context) *Tracer {
+	if t, ok := ctx.Value(contextTracerKey{}).(*Tracer); ok {
+		return t
+	}
+	if tx := TransactionFromContext(ctx); tx != nil {
+		return tx.tracer
+	}
+	return DefaultTracer
+}
+
+type contextTracerKey struct{}
@@ -0,0 +1,42 @@
+package elasticapm_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestRegisterTracer(t *testing.T) {
+	tracer, _ := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	assert.Nil(t, elasticapm.RegisteredTracer("tenant"))
+	elasticapm.RegisterTracer("tenant", tracer)
+	assert.Equal(t, tracer, elasticapm.RegisteredTracer("tenant"))
+	elasticapm.RegisterTracer("tenant", nil)
+	assert.Nil(t, elasticapm.RegisteredTracer("tenant"))
+}
+
+func TestTracerFromContext(t *testing.T) {
+	tracer1, _ := transporttest.NewRecorderTracer()
+	defer tracer1.Close()
+	tracer2, _ := transporttest.NewRecorderTracer()
+	defer tracer2.Close()
+
+	ctx := context.Background()
+	assert.Equal(t, elasticapm.DefaultTracer, elasticapm.TracerFromContext(ctx))
+	assert.Equal(t, ctx, elasticapm.ContextWithTracer(ctx, nil))
+
+	tx := tracer1.StartTransaction("name", "type")
+	defer tx.End()
+	txCtx := elasticapm.ContextWithTransaction(ctx, tx)
+	assert.Equal(t, tracer1, elasticapm.TracerFromContext(txCtx))
+
+	// A tracer stored in the context takes precedence
+	// over the tracer of the transaction in the context.
+	assert.Equal(t, tracer2, elasticapm.TracerFromContext(elasticapm.ContextWithTracer(txCtx, tracer2)))
+}
@@ -5,13 +5,19 @@ import (
 	"encoding/binary"
 	"math/rand"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/elastic/apm-agent-go/internal/uuid"
 )
 
 // StartTransaction returns a new Transaction with the specified
 // name and type, and with the start time set to the current time.
 func (t *Tracer) StartTransaction(name, transactionType string, opts ...TransactionOption) *Transaction {
-	tx, _ := t.transactionPool.Get().(*Transaction)
+	var tx *Transaction
+	if !auditEnabled {
+		tx, _ = t.transactionPool.Get().(*Transaction)
+	}
 	if tx == nil {
 		tx = &Transaction{
 			tracer:   t,
@@ -28,6 +34,9 @@ func (t *Tracer) StartTransaction(name, transactionType string, opts ...Transact
 	}
 	tx.Name = name
 	tx.Type = transactionType
+	cfg := t.loadTransactionConfig()
+	tx.Context.headerCapture = cfg.headerCapture
+	tx.Context.userAgentParsing = cfg.userAgentParsing
 
 	var txOpts transactionOptions
 	for _, o := range opts {
@@ -38,28 +47,56 @@ func (t *Tracer) StartTransaction(name, transactionType string, opts ...Transact
 	binary.LittleEndian.PutUint64(tx.id[:8], tx.rand.Uint64())
 	binary.LittleEndian.PutUint64(tx.id[8:], tx.rand.Uint64())
 
-	// Take a snapshot of the max spans config to ensure
-	// that once the maximum is reached, all future span
+	// Take a snapshot of the tracer's configuration, so that it
+	// is consistent for the lifetime of the transaction; e.g. so
+	// that once the max spans limit is reached, all future span
 	// creations are dropped.
-	t.maxSpansMu.RLock()
-	tx.maxSpans = t.maxSpans
-	t.maxSpansMu.RUnlock()
+	tx.maxSpans = cfg.maxSpans
+	tx.spanSamplingThreshold = cfg.spanSamplingThreshold
+	tx.spanFramesMinDuration = cfg.spanFramesMinDuration
+	tx.spanLinter = cfg.spanLinter
+	tx.spanDeadlineBudget = cfg.spanDeadlineBudget
+	tx.resultMapper = cfg.resultMapper
+	tx.failureCapture = cfg.failureCapture
+	tx.spanTypeOverrides = cfg.spanTypeOverrides
+	tx.clock = cfg.clock
+	tx.breakdownMetricsMode = cfg.breakdownMetricsMode
+	tx.baggageTags = cfg.baggageTags
+	tx.schedulerLatency = cfg.schedulerLatency
 
-	t.spanFramesMinDurationMu.RLock()
-	tx.spanFramesMinDuration = t.spanFramesMinDuration
-	t.spanFramesMinDurationMu.RUnlock()
-
-	t.samplerMu.RLock()
-	sampler := t.sampler
-	t.samplerMu.RUnlock()
 	tx.sampled = true
-	if sampler != nil && !sampler.Sample(tx) {
+	tx.samplingPriority = txOpts.samplingPriority
+	if !txOpts.forceSample && tx.samplingPriority <= 0 && cfg.sampler != nil && !cfg.sampler.Sample(tx) {
 		tx.sampled = false
 	}
-	tx.Timestamp = time.Now()
+	if txOpts.sessionID != "" {
+		tx.SetSessionID(txOpts.sessionID)
+	}
+	for name, value := range txOpts.correlationIDs {
+		tx.SetCorrelationID(name, value)
+	}
+	tx.baggage = txOpts.baggage
+	if tx.sampled {
+		tx.startSampled()
+	}
+	tx.Timestamp = tx.clock.Now()
+	t.leaks.track(tx, "transaction", name, 1)
 	return tx
 }
 
+// startSampled sets up the sampled transaction, when it is started
+// or upgraded to sampled by SetSamplingPriority: recording baggage
+// tags, and the scheduler latency at the start of the transaction.
+func (tx *Transaction) startSampled() {
+	if len(tx.baggage) != 0 {
+		tx.setBaggageTags(tx.baggage, tx.baggageTags)
+		tx.baggage = nil
+	}
+	if tx.schedulerLatency {
+		tx.schedLatencyStart = readSchedLatency()
+	}
+}
+
 // Transaction describes an event occurring in the monitored service.
 type Transaction struct {
 	Name      string
@@ -72,18 +109,55 @@ type Transaction struct {
 
 	tracer                *Tracer
 	sampled               bool
+	samplingPriority      int
+	sessionID             string
 	maxSpans              int
+	spanSamplingThreshold int
 	spanFramesMinDuration time.Duration
+	spanLinter            SpanLintFunc
+	spanDeadlineBudget    float64
+	resultMapper          ResultMapper
+	failureCapture        FailureCaptureMode
+	spanTypeOverrides     spanTypeOverrides
+	breakdownMetricsMode  BreakdownMetricsMode
+	clock                 Clock
+	baggageTags           []string
+	schedulerLatency      bool
+	schedLatencyStart     *schedLatencySnapshot
+
+	// baggage holds the baggage with which a non-sampled transaction
+	// was started, for recording baggage tags if it is upgraded to
+	// sampled by SetSamplingPriority.
+	baggage Baggage
 
 	mu           sync.Mutex
 	spans        []*Span
 	spansDropped int
+	failed       bool
+	ended        bool
+	droppedSpans map[droppedSpansKey]droppedSpansGroup
+	marks        map[string]map[string]time.Duration
 	rand         *rand.Rand // for ID generation
+
+	// droppedExitSpans is shared by the transaction's dropped
+	// exit spans, and is detached when the transaction ends.
+	droppedExitSpans *droppedExitSpansRef
+
+	// spanRefs holds the SpanRefs created for the transaction's
+	// spans, which are detached when the transaction ends.
+	spanRefs []*SpanRef
+
+	audit transactionAudit
+
+	// memoryReserved holds the number of bytes reserved from
+	// the tracer's memory budget when the transaction was enqueued.
+	memoryReserved int64
 }
 
 // reset resets the Transaction back to its zero state, so it can be reused
 // in the transaction pool.
 func (tx *Transaction) reset() {
+	tx.tracer.memory.release(tx.memoryReserved)
 	for _, s := range tx.spans {
 		s.reset()
 		tx.tracer.spanPool.Put(s)
@@ -94,6 +168,7 @@ func (tx *Transaction) reset() {
 		Context:  tx.Context,
 		Duration: -1,
 		rand:     tx.rand,
+		audit:    tx.audit,
 	}
 	tx.Context.reset()
 }
@@ -101,6 +176,10 @@ func (tx *Transaction) reset() {
 // Discard discards a previously started transaction. The Transaction
 // must not be used after this.
 func (tx *Transaction) Discard() {
+	tx.tracer.leaks.untrack(tx)
+	auditTransactionEnded(tx)
+	tx.detachDroppedExitSpans()
+	tx.detachSpanRefs()
 	tx.reset()
 	tx.tracer.transactionPool.Put(tx)
 }
@@ -110,35 +189,83 @@ func (tx *Transaction) Sampled() bool {
 	return tx.sampled
 }
 
+// ID returns the transaction's unique identifier, formatted as a UUID
+// string. This may be used for correlating logs with the transaction.
+func (tx *Transaction) ID() string {
+	return uuid.UUID(tx.id).String()
+}
+
 // End enqueues tx for sending to the Elastic APM server; tx must not
 // be used after this.
 //
 // If tx.Duration has not been set, End will set it to the elapsed
 // time since tx.Timestamp.
 func (tx *Transaction) End() {
+	tx.tracer.leaks.untrack(tx)
+	auditTransactionEnded(tx)
+	tx.mu.Lock()
+	tx.ended = true
+	tx.mu.Unlock()
+	tx.detachSpanRefs()
 	if tx.Duration < 0 {
-		tx.Duration = time.Since(tx.Timestamp)
+		tx.Duration = elapsed(tx.clock, tx.Timestamp)
 	}
 	for _, s := range tx.spans {
 		s.finalize(tx.Timestamp.Add(tx.Duration))
 	}
+	tx.detachDroppedExitSpans()
+	if tx.schedLatencyStart != nil {
+		tx.markSchedLatency()
+	}
+	if metricsEnabled && atomic.LoadUint32(&tx.tracer.recordMetrics) != 0 {
+		tx.tracer.transactionMetrics.record(tx)
+		tx.tracer.breakdownMetrics.record(tx, tx.breakdownMetricsMode)
+	}
+	if tx.sampled {
+		tx.tracer.recent.add(tx)
+	}
 	tx.enqueue()
 }
 
 func (tx *Transaction) enqueue() {
+	reserved, ok := tx.tracer.memory.reserve(tx.estimateMemory())
+	if !ok {
+		tx.drop()
+		return
+	}
+	tx.memoryReserved = reserved
 	select {
 	case tx.tracer.transactions <- tx:
 	default:
 		// Enqueuing a transaction should never block.
-		tx.tracer.statsMu.Lock()
-		tx.tracer.stats.TransactionsDropped++
-		tx.tracer.statsMu.Unlock()
-		tx.reset()
-		tx.tracer.transactionPool.Put(tx)
+		tx.drop()
 	}
 }
 
+// drop discards the ended transaction, recording it as dropped.
+func (tx *Transaction) drop() {
+	tx.tracer.statsMu.Lock()
+	tx.tracer.stats.TransactionsDropped++
+	tx.tracer.statsMu.Unlock()
+	tx.reset()
+	tx.tracer.transactionPool.Put(tx)
+}
+
 // TransactionOption sets options when starting a transaction.
 type TransactionOption func(*transactionOptions)
 
-type transactionOptions struct{}
+type transactionOptions struct {
+	forceSample      bool
+	samplingPriority int
+	sessionID        string
+	correlationIDs   map[string]string
+	baggage          Baggage
+}
+
+// ForceSample returns a TransactionOption which causes the transaction
+// to be sampled, regardless of the tracer's sampler.
+func ForceSample() TransactionOption {
+	return func(o *transactionOptions) {
+		o.forceSample = true
+	}
+}
@@ -0,0 +1,102 @@
+package elasticapm
+
+import (
+	"sync"
+	"time"
+
+	"github.com/elastic/apm-agent-go/internal/uuid"
+)
+
+// transactionMetricsLimit is the maximum number of distinct transaction
+// name and type groups for which duration metrics are recorded in each
+// metrics interval. Transactions in further groups are not recorded.
+const transactionMetricsLimit = 1000
+
+// transactionMetrics aggregates the durations of ended transactions,
+// grouped by transaction name and type, between metrics gatherings.
+type transactionMetrics struct {
+	mu     sync.Mutex
+	groups map[transactionGroupKey]*transactionGroup
+}
+
+type transactionGroupKey struct {
+	name            string
+	transactionType string
+}
+
+// transactionGroup holds the aggregated durations of a group of
+// transactions, and the longest sampled transaction as an exemplar.
+type transactionGroup struct {
+	count uint64
+	sum   time.Duration
+	max   time.Duration
+
+	exemplar          bool
+	exemplarID        [16]byte
+	exemplarDuration  time.Duration
+	exemplarTimestamp time.Time
+}
+
+// record records the duration of the ended transaction tx.
+func (m *transactionMetrics) record(tx *Transaction) {
+	key := transactionGroupKey{name: tx.Name, transactionType: tx.Type}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	g, ok := m.groups[key]
+	if !ok {
+		if len(m.groups) >= transactionMetricsLimit {
+			return
+		}
+		if m.groups == nil {
+			m.groups = make(map[transactionGroupKey]*transactionGroup)
+		}
+		g = &transactionGroup{}
+		m.groups[key] = g
+	}
+	g.count++
+	g.sum += tx.Duration
+	if tx.Duration > g.max {
+		g.max = tx.Duration
+	}
+	// Only sampled transactions are sent with their full
+	// details, so only those are useful as exemplars.
+	if tx.sampled && (!g.exemplar || tx.Duration > g.exemplarDuration) {
+		g.exemplar = true
+		g.exemplarID = tx.id
+		g.exemplarDuration = tx.Duration
+		g.exemplarTimestamp = tx.Timestamp
+	}
+}
+
+// gather adds a "transaction.duration" summary metric to out for each
+// group of transactions recorded since the last call to gather, and
+// then resets the groups.
+func (m *transactionMetrics) gather(out *Metrics) {
+	m.mu.Lock()
+	groups := m.groups
+	m.groups = nil
+	m.mu.Unlock()
+
+	for key, g := range groups {
+		max := g.max.Seconds()
+		summary := SummaryMetric{
+			Count: g.count,
+			Sum:   g.sum.Seconds(),
+			Max:   &max,
+		}
+		if g.exemplar {
+			summary.Exemplar = &MetricExemplar{
+				Value:     g.exemplarDuration.Seconds(),
+				Timestamp: g.exemplarTimestamp,
+				Labels: []MetricLabel{{
+					Name:  "transaction_id",
+					Value: uuid.UUID(g.exemplarID).String(),
+				}},
+			}
+		}
+		out.AddSummary("transaction.duration", "sec", []MetricLabel{
+			{Name: "transaction_name", Value: key.name},
+			{Name: "transaction_type", Value: key.transactionType},
+		}, summary)
+	}
+}
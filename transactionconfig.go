@@ -0,0 +1,46 @@
+package elasticapm
+
+import "time"
+
+// transactionConfig holds the tracer configuration which is copied into
+// each transaction when it is started, and into each error when it is
+// created, along with the logger, for reporting problems found with
+// transactions and spans outside the tracer's goroutine. A stored transactionConfig is never modified: the tracer's
+// setters store a modified copy, so that starting a transaction requires
+// only a single atomic load, rather than acquiring a lock per setting.
+type transactionConfig struct {
+	maxSpans              int
+	spanSamplingThreshold int
+	spanFramesMinDuration time.Duration
+	sampler               Sampler
+	spanLinter            SpanLintFunc
+	schedulerLatency      bool
+	baggageTags           []string
+	breakdownMetricsMode  BreakdownMetricsMode
+	userAgentParsing      UserAgentParsingMode
+	spanDeadlineBudget    float64
+	resultMapper          ResultMapper
+	failureCapture        FailureCaptureMode
+	spanTypeOverrides     spanTypeOverrides
+	clock                 Clock
+	captureHeaders        bool
+	headerCaptureFilter   HeaderCaptureFilter
+	headerCapture         *headerCapture
+	logger                Logger
+}
+
+// loadTransactionConfig returns the tracer's current transaction
+// configuration, which must not be modified.
+func (t *Tracer) loadTransactionConfig() *transactionConfig {
+	return t.transactionConfig.Load().(*transactionConfig)
+}
+
+// updateTransactionConfig stores a copy of the tracer's transaction
+// configuration, modified by f.
+func (t *Tracer) updateTransactionConfig(f func(cfg *transactionConfig)) {
+	t.transactionConfigMu.Lock()
+	defer t.transactionConfigMu.Unlock()
+	cfg := *t.loadTransactionConfig()
+	f(&cfg)
+	t.transactionConfig.Store(&cfg)
+}
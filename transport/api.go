@@ -18,3 +18,11 @@ type Transport interface {
 	// SendTransactions sends the transactions payload to the server.
 	SendTransactions(context.Context, *model.TransactionsPayload) error
 }
+
+// ServerVersioner is an optional interface that may be implemented by a
+// Transport, for discovering the version of the APM server.
+type ServerVersioner interface {
+	// ServerVersion returns the version of the APM server,
+	// e.g. "8.0.0".
+	ServerVersion(context.Context) (string, error)
+}
@@ -0,0 +1,148 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/elastic/apm-agent-go/internal/fastjson"
+	"github.com/elastic/apm-agent-go/model"
+)
+
+// WithMaxRequestSize returns an HTTPTransportOption which sets the
+// maximum size, in bytes, of the uncompressed body of each request to
+// the APM server. Payloads which would exceed the maximum are split
+// into multiple requests, each holding a subset of the payload's
+// events, to avoid "413 Request Entity Too Large" responses from the
+// APM server or proxies in front of it. The maximum may also be set
+// with the ELASTIC_APM_MAX_REQUEST_SIZE environment variable.
+//
+// A payload holding a single event larger than the maximum is sent
+// as is. If any request for a split payload fails, the remaining
+// requests are not made. If earlier requests succeeded, the error is
+// returned as a *PartialSendError, so that only the events that were
+// not sent are retried.
+//
+// If size is zero, which is the default, payloads are not split.
+func WithMaxRequestSize(size int64) HTTPTransportOption {
+	return func(o *httpTransportOptions) {
+		o.maxRequestSize = &size
+	}
+}
+
+// splitPayload reports whether the encoded payload in e, holding
+// n events, should be split into multiple requests.
+func (t *HTTPTransport) splitPayload(e *encoder, n int) bool {
+	return t.maxRequestSize > 0 && n > 1 && int64(e.jsonWriter.Size()) > t.maxRequestSize
+}
+
+func (t *HTTPTransport) sendTransactions(ctx context.Context, p *model.TransactionsPayload, compact bool) error {
+	return t.sendSplit(ctx, "transactions", "SendTransactions", len(p.Transactions), compact, func(w *fastjson.Writer, i, j int) {
+		chunk := *p
+		chunk.Transactions = p.Transactions[i:j]
+		chunk.MarshalFastJSON(w)
+	})
+}
+
+func (t *HTTPTransport) sendErrors(ctx context.Context, p *model.ErrorsPayload, compact bool) error {
+	return t.sendSplit(ctx, "errors", "SendErrors", len(p.Errors), compact, func(w *fastjson.Writer, i, j int) {
+		chunk := *p
+		chunk.Errors = p.Errors[i:j]
+		chunk.MarshalFastJSON(w)
+	})
+}
+
+func (t *HTTPTransport) sendMetrics(ctx context.Context, p *model.MetricsPayload, compact bool) error {
+	return t.sendSplit(ctx, "metrics", "SendMetrics", len(p.Metrics), compact, func(w *fastjson.Writer, i, j int) {
+		chunk := *p
+		chunk.Metrics = p.Metrics[i:j]
+		chunk.MarshalFastJSON(w)
+	})
+}
+
+// sendSplit sends a payload holding n events, of the given kind.
+// encode encodes the payload holding the events [i, j) to w; it is
+// used to encode each request when the payload is split.
+func (t *HTTPTransport) sendSplit(
+	ctx context.Context,
+	kind, op string,
+	n int,
+	compact bool,
+	encode func(w *fastjson.Writer, i, j int),
+) error {
+	sent, spooled, err := t.sendRange(ctx, kind, op, 0, n, compact, encode)
+	if err != nil {
+		if sent > 0 {
+			return &PartialSendError{Sent: sent, Spooled: spooled, Err: err}
+		}
+		return err
+	}
+	if spooled > 0 {
+		return &SpooledError{Spooled: spooled}
+	}
+	return nil
+}
+
+// sendRange sends the events [i, j) of a payload, halving the range
+// recursively while its encoding exceeds the maximum request size. It
+// returns the number of events, from i, which were sent or spooled
+// before any request failed, and how many of those were spooled.
+func (t *HTTPTransport) sendRange(
+	ctx context.Context,
+	kind, op string,
+	i, j int,
+	compact bool,
+	encode func(w *fastjson.Writer, i, j int),
+) (sent, spooled int, err error) {
+	e := t.encoders.Get().(*encoder)
+	e.jsonWriter.Reset()
+	encode(&e.jsonWriter, i, j)
+	if t.splitPayload(e, j-i) {
+		t.encoders.Put(e)
+		half := i + (j-i)/2
+		sent, spooled, err = t.sendRange(ctx, kind, op, i, half, compact, encode)
+		if err != nil {
+			return sent, spooled, err
+		}
+		sent2, spooled2, err := t.sendRange(ctx, kind, op, half, j, compact, encode)
+		return sent + sent2, spooled + spooled2, err
+	}
+	defer t.encoders.Put(e)
+	t.dump(kind, e)
+	err = t.sendPayloadRetry(ctx, kind, e.jsonWriter.Bytes(), e, op, compact)
+	wasSpooled, err := t.spoolPayload(kind, e, compact, err)
+	if err != nil {
+		return 0, 0, err
+	}
+	if wasSpooled {
+		return j - i, j - i, nil
+	}
+	return j - i, 0, nil
+}
+
+// PartialSendError is returned by HTTPTransport when a payload split
+// into multiple requests is only partially sent; see WithMaxRequestSize.
+// Requests are made in order, so the events that were sent are those at
+// the start of the payload.
+type PartialSendError struct {
+	// Sent holds the number of events, from the start of the
+	// payload, which were sent successfully or spooled.
+	Sent int
+
+	// Spooled holds the number of the events counted in Sent
+	// which were spooled rather than sent; see SetSpoolDir.
+	Spooled int
+
+	// Err holds the error with which sending the remaining
+	// events failed.
+	Err error
+}
+
+// Error returns the message of e.Err, noting the number of events sent.
+func (e *PartialSendError) Error() string {
+	return fmt.Sprintf("%s (%d events sent)", e.Err, e.Sent)
+}
+
+// Cause returns e.Err, for use with github.com/pkg/errors.Cause.
+func (e *PartialSendError) Cause() error {
+	return e.Err
+}
@@ -0,0 +1,47 @@
+package transport
+
+import (
+	"crypto/tls"
+
+	"github.com/pkg/errors"
+
+	"github.com/elastic/apm-agent-go/internal/apmconfig"
+)
+
+// WithClientCertificate returns an HTTPTransportOption which sets the
+// certificate presented to APM servers which require TLS client
+// authentication (mutual TLS). The certificate may also be loaded from
+// the files named by the ELASTIC_APM_SERVER_CLIENT_CERT and
+// ELASTIC_APM_SERVER_CLIENT_KEY environment variables.
+//
+// A certificate may be loaded from PEM-encoded files with
+// tls.LoadX509KeyPair.
+func WithClientCertificate(cert tls.Certificate) HTTPTransportOption {
+	return func(o *httpTransportOptions) {
+		o.clientCert = &cert
+	}
+}
+
+// initialClientCertificate returns the client certificate loaded from
+// the files named by the ELASTIC_APM_SERVER_CLIENT_CERT and
+// ELASTIC_APM_SERVER_CLIENT_KEY environment variables, or nil if no
+// certificate file is specified. If no key file is specified, the
+// key is read from the certificate file.
+func initialClientCertificate() (*tls.Certificate, error) {
+	certFile := apmconfig.Getenv(envServerClientCert)
+	keyFile := apmconfig.Getenv(envServerClientKey)
+	if certFile == "" {
+		if keyFile != "" {
+			return nil, errors.Errorf("%s specified without %s", envServerClientKey, envServerClientCert)
+		}
+		return nil, nil
+	}
+	if keyFile == "" {
+		keyFile = certFile
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load client certificate")
+	}
+	return &cert, nil
+}
@@ -0,0 +1,58 @@
+package transport
+
+import (
+	"github.com/elastic/apm-agent-go/model"
+)
+
+// compactContentType is the Content-Type used for payloads sent in compact
+// mode. Gateways that do not understand compact payloads are expected to
+// respond with 415 (Unsupported Media Type), in which case the transport
+// will revert to sending full payloads.
+const compactContentType = "application/vnd.elastic.apm.compact+json"
+
+// compactTransactionsPayload trims p down to the compact field set:
+// process and system metadata, transaction and span context, and
+// span stack traces are all omitted.
+//
+// The transactions and spans are modified in place.
+func compactTransactionsPayload(p *model.TransactionsPayload) *model.TransactionsPayload {
+	out := *p
+	out.Process = nil
+	out.System = nil
+	for i := range out.Transactions {
+		tx := &out.Transactions[i]
+		tx.Context = nil
+		for j := range tx.Spans {
+			span := &tx.Spans[j]
+			span.Context = nil
+			span.Stacktrace = nil
+		}
+	}
+	return &out
+}
+
+// compactErrorsPayload trims p down to the compact field set: process
+// and system metadata, error context, and stack traces are all omitted.
+// The error culprit, which is derived from the stack trace, is retained.
+//
+// The errors are modified in place.
+func compactErrorsPayload(p *model.ErrorsPayload) *model.ErrorsPayload {
+	out := *p
+	out.Process = nil
+	out.System = nil
+	for _, e := range out.Errors {
+		e.Context = nil
+		e.Exception.Stacktrace = nil
+		e.Log.Stacktrace = nil
+	}
+	return &out
+}
+
+// compactMetricsPayload trims p down to the compact field set: process
+// and system metadata are omitted.
+func compactMetricsPayload(p *model.MetricsPayload) *model.MetricsPayload {
+	out := *p
+	out.Process = nil
+	out.System = nil
+	return &out
+}
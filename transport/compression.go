@@ -0,0 +1,115 @@
+package transport
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/elastic/apm-agent-go/internal/apmconfig"
+)
+
+// Compression identifies an algorithm with which request bodies
+// are compressed, and is used as the Content-Encoding header.
+type Compression string
+
+const (
+	// CompressionGzip compresses request bodies with gzip.
+	// This is the default.
+	CompressionGzip Compression = "gzip"
+
+	// CompressionDeflate compresses request bodies with deflate,
+	// in the zlib format, as required for HTTP.
+	CompressionDeflate Compression = "deflate"
+)
+
+// WithCompression returns an HTTPTransportOption which sets the algorithm
+// and level with which request bodies are compressed. The level ranges from
+// 1 (fastest) to 9 (best compression), or is -1 for the algorithm's default
+// level; level 0 disables compression. The algorithm and level may also be
+// set with the ELASTIC_APM_COMPRESSION and ELASTIC_APM_COMPRESSION_LEVEL
+// environment variables.
+//
+// The APM server accepts only gzip and deflate compressed requests, hence
+// other algorithms, such as zstd, are not supported.
+func WithCompression(compression Compression, level int) HTTPTransportOption {
+	return func(o *httpTransportOptions) {
+		o.compression = &compressionConfig{compression, level}
+	}
+}
+
+// compressionConfig holds the compression algorithm and level.
+type compressionConfig struct {
+	compression Compression
+	level       int
+}
+
+// validate returns an error if the algorithm or level is unsupported.
+func (c compressionConfig) validate() error {
+	if err := validateCompression(c.compression); err != nil {
+		return err
+	}
+	return validateCompressionLevel(c.level)
+}
+
+func validateCompression(c Compression) error {
+	switch c {
+	case CompressionGzip, CompressionDeflate:
+		return nil
+	}
+	return errors.Errorf("unsupported compression %q", c)
+}
+
+func validateCompressionLevel(level int) error {
+	if level < flate.DefaultCompression || level > flate.BestCompression {
+		return errors.Errorf("invalid compression level %d", level)
+	}
+	return nil
+}
+
+// compressWriter is implemented by *gzip.Writer and *zlib.Writer.
+type compressWriter interface {
+	io.WriteCloser
+	Reset(io.Writer)
+}
+
+// newWriter returns a compressWriter writing to w, or nil if
+// compression is disabled. The configuration must be valid.
+func (c compressionConfig) newWriter(w io.Writer) compressWriter {
+	if c.level == 0 {
+		return nil
+	}
+	if c.compression == CompressionDeflate {
+		zw, _ := zlib.NewWriterLevel(w, c.level)
+		return zw
+	}
+	gw, _ := gzip.NewWriterLevel(w, c.level)
+	return gw
+}
+
+// initialCompression returns the compression configuration from the
+// ELASTIC_APM_COMPRESSION and ELASTIC_APM_COMPRESSION_LEVEL environment
+// variables, defaulting to gzip at the default level.
+func initialCompression() (compressionConfig, error) {
+	config := compressionConfig{compression: CompressionGzip, level: flate.DefaultCompression}
+	if value := apmconfig.Getenv(envCompression); value != "" {
+		config.compression = Compression(value)
+		if err := validateCompression(config.compression); err != nil {
+			return compressionConfig{}, errors.Wrapf(err, "failed to parse %s", envCompression)
+		}
+	}
+	if value := apmconfig.Getenv(envCompressionLevel); value != "" {
+		level, err := strconv.Atoi(value)
+		if err == nil {
+			err = validateCompressionLevel(level)
+		}
+		if err != nil {
+			return compressionConfig{}, errors.Wrapf(err, "failed to parse %s", envCompressionLevel)
+		}
+		config.level = level
+	}
+	return config, nil
+}
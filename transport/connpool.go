@@ -0,0 +1,65 @@
+package transport
+
+import (
+	"net/http"
+	"time"
+)
+
+// ConnectionPool controls how HTTPTransport's default client reuses
+// connections to the APM server. Zero fields take the values used by
+// http.DefaultTransport.
+type ConnectionPool struct {
+	// MaxIdleConns holds the maximum number of idle connections
+	// kept open across all APM servers.
+	MaxIdleConns int
+
+	// MaxIdleConnsPerHost holds the maximum number of idle connections
+	// kept open to each APM server. Services sending many payloads
+	// concurrently, e.g. with Tracer.SetPipelineDepth, may need to
+	// raise this from net/http's default of two.
+	MaxIdleConnsPerHost int
+
+	// IdleConnTimeout holds the maximum amount of time an idle
+	// connection is kept open.
+	IdleConnTimeout time.Duration
+
+	// TLSHandshakeTimeout holds the maximum amount of time
+	// to wait for a TLS handshake with the APM server.
+	TLSHandshakeTimeout time.Duration
+
+	// DisableKeepAlives disables connection reuse, so that
+	// each request is sent on a new connection.
+	DisableKeepAlives bool
+}
+
+// WithConnectionPool returns an HTTPTransportOption which sets the
+// connection pool and keep-alive configuration of the transport's
+// default client, so that it can be tuned without replacing the
+// Client field's Transport. The option has no effect if the Client
+// field is later modified or replaced.
+func WithConnectionPool(pool ConnectionPool) HTTPTransportOption {
+	return func(o *httpTransportOptions) {
+		o.connectionPool = &pool
+	}
+}
+
+// apply sets the connection pool configuration on transport,
+// leaving the defaults for zero fields.
+func (p *ConnectionPool) apply(transport *http.Transport) {
+	if p == nil {
+		return
+	}
+	if p.MaxIdleConns != 0 {
+		transport.MaxIdleConns = p.MaxIdleConns
+	}
+	if p.MaxIdleConnsPerHost != 0 {
+		transport.MaxIdleConnsPerHost = p.MaxIdleConnsPerHost
+	}
+	if p.IdleConnTimeout != 0 {
+		transport.IdleConnTimeout = p.IdleConnTimeout
+	}
+	if p.TLSHandshakeTimeout != 0 {
+		transport.TLSHandshakeTimeout = p.TLSHandshakeTimeout
+	}
+	transport.DisableKeepAlives = p.DisableKeepAlives
+}
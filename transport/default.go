@@ -1,6 +1,7 @@
 package transport
 
 import (
+	"github.com/elastic/apm-agent-go/internal/apmconfig"
 	"github.com/elastic/apm-agent-go/internal/apmdebug"
 )
 
@@ -8,6 +9,9 @@ var (
 	// Default is the default Transport, using the
 	// ELASTIC_APM_* environment variables.
 	//
+	// If ELASTIC_APM_SERVER_URL is a "file" URL, Default
+	// will be a FileTransport writing to that path.
+	//
 	// If ELASTIC_APM_SERVER_URL is set to an invalid
 	// location, Default will be set to a transport
 	// returning an error for every operation.
@@ -36,6 +40,15 @@ func InitDefault() (Transport, error) {
 }
 
 func getDefault() (Transport, error) {
+	if apmconfig.Getenv(envServerURLs) == "" {
+		if path, ok := fileURLPath(apmconfig.Getenv(envServerURL)); ok {
+			t, err := NewFileTransport(path)
+			if err != nil {
+				return discardTransport{err}, err
+			}
+			return t, nil
+		}
+	}
 	t, err := NewHTTPTransport("", "")
 	if err != nil {
 		return discardTransport{err}, err
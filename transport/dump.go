@@ -0,0 +1,144 @@
+package transport
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// payloadDumpInterval is the minimum interval between
+	// payload dumps; payloads sent more frequently are not
+	// dumped.
+	payloadDumpInterval = time.Second
+
+	// payloadDumpMaxBytes is the maximum total size of the
+	// payloads dumped by a transport. Once this is reached,
+	// no more payloads are dumped.
+	payloadDumpMaxBytes = 64 * 1024 * 1024
+
+	redacted = "[REDACTED]"
+)
+
+// payloadDumpSanitizedKeys matches the keys of JSON object members
+// whose values are redacted in dumped payloads.
+var payloadDumpSanitizedKeys = regexp.MustCompile(
+	"(?i:^(password|passwd|pwd|secret|.*key|.*token|.*session.*|.*credit.*|.*card.*|authorization|cookie)$)",
+)
+
+// payloadDumper writes payloads to files in a directory, for debugging.
+type payloadDumper struct {
+	dir     string
+	secrets []string
+
+	mu      sync.Mutex
+	seq     int
+	last    time.Time
+	written int64
+	full    bool
+}
+
+// SetPayloadDumpDir sets the directory to which the transport writes
+// the payloads it sends, for debugging serialization problems. If dir
+// is empty, which is the default, payloads are not written. Payloads
+// may also be dumped by setting the ELASTIC_APM_DEBUG environment
+// variable to "payloaddump=<dir>".
+//
+// Each payload is written, before compression, to a file named with a
+// sequence number and the payload type, e.g. "000001-transactions.json".
+// Payloads are written at most once per second, and no more than 64MiB
+// of payloads are written in total. Before writing, the values of object
+// members with sensitive names such as "password" or "token", and any
+// occurrence of the secret token or API key, are redacted. The payload is decoded
+// and re-encoded to do this, so the order of object members may differ
+// from the payload sent. Payloads which cannot be dumped are counted in
+// the transport's Stats.PayloadDumpFailures, and are otherwise sent as
+// usual.
+func (t *HTTPTransport) SetPayloadDumpDir(dir string) {
+	var dumper *payloadDumper
+	if dir != "" {
+		dumper = &payloadDumper{dir: dir}
+		for _, secret := range []string{t.secretToken, t.apiKey} {
+			if secret != "" {
+				dumper.secrets = append(dumper.secrets, secret)
+			}
+		}
+	}
+	t.mu.Lock()
+	t.dumper = dumper
+	t.mu.Unlock()
+}
+
+// dump writes payload to a file for the given payload kind, subject to
+// the rate and size limits. An error is returned if the payload could
+// not be scrubbed or written; payloads skipped due to the limits are
+// not errors.
+func (d *payloadDumper) dump(kind string, payload []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	if d.full || now.Sub(d.last) < payloadDumpInterval {
+		return nil
+	}
+	scrubbed, err := d.scrub(payload)
+	if err != nil {
+		return err
+	}
+	if d.written+int64(len(scrubbed)) > payloadDumpMaxBytes {
+		d.full = true
+		return nil
+	}
+	if err := os.MkdirAll(d.dir, 0700); err != nil {
+		return err
+	}
+	d.seq++
+	filename := filepath.Join(d.dir, fmt.Sprintf("%06d-%s.json", d.seq, kind))
+	if err := ioutil.WriteFile(filename, scrubbed, 0600); err != nil {
+		return err
+	}
+	d.last = now
+	d.written += int64(len(scrubbed))
+	return nil
+}
+
+// scrub returns a copy of payload, indented, with sensitive values redacted.
+func (d *payloadDumper) scrub(payload []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+	v = d.scrubValue(v)
+	return json.MarshalIndent(v, "", "  ")
+}
+
+func (d *payloadDumper) scrubValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, mv := range v {
+			if payloadDumpSanitizedKeys.MatchString(k) {
+				v[k] = redacted
+				continue
+			}
+			v[k] = d.scrubValue(mv)
+		}
+	case []interface{}:
+		for i, av := range v {
+			v[i] = d.scrubValue(av)
+		}
+	case string:
+		for _, secret := range d.secrets {
+			v = strings.Replace(v, secret, redacted, -1)
+		}
+		return v
+	}
+	return v
+}
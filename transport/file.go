@@ -0,0 +1,94 @@
+package transport
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/elastic/apm-agent-go/internal/fastjson"
+	"github.com/elastic/apm-agent-go/model"
+)
+
+// FileTransport is an implementation of Transport which writes payloads
+// to a file, or to stderr, rather than sending them to an APM server.
+// This is intended for debugging payloads locally, and in environments
+// without access to an APM server.
+//
+// Payloads are written as newline-delimited JSON, one payload per line,
+// in the same encoding as they would be sent to the server. The kind
+// of each payload can be identified by its "transactions", "errors",
+// or "metrics" member.
+type FileTransport struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+	json   fastjson.Writer
+}
+
+// NewFileTransport returns a new FileTransport which appends payloads
+// to the file at the specified path, creating it if necessary. If path
+// is "/dev/stderr" or "/dev/stdout", payloads are written to the
+// process's stderr or stdout respectively.
+//
+// When ELASTIC_APM_SERVER_URL is set to a URL of the form
+// "file:///path/to/file", the default transport is a FileTransport
+// writing to that path.
+func NewFileTransport(path string) (*FileTransport, error) {
+	switch path {
+	case "/dev/stderr":
+		return &FileTransport{w: os.Stderr}, nil
+	case "/dev/stdout":
+		return &FileTransport{w: os.Stdout}, nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open payload file")
+	}
+	return &FileTransport{w: f, closer: f}, nil
+}
+
+// Close closes the file, if the transport opened one.
+func (t *FileTransport) Close() error {
+	if t.closer == nil {
+		return nil
+	}
+	return t.closer.Close()
+}
+
+// SendTransactions writes the transactions payload to the file.
+func (t *FileTransport) SendTransactions(ctx context.Context, p *model.TransactionsPayload) error {
+	return t.write(p)
+}
+
+// SendErrors writes the errors payload to the file.
+func (t *FileTransport) SendErrors(ctx context.Context, p *model.ErrorsPayload) error {
+	return t.write(p)
+}
+
+// SendMetrics writes the metrics payload to the file.
+func (t *FileTransport) SendMetrics(ctx context.Context, p *model.MetricsPayload) error {
+	return t.write(p)
+}
+
+func (t *FileTransport) write(p fastjson.Marshaler) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.json.Reset()
+	p.MarshalFastJSON(&t.json)
+	t.json.RawByte('\n')
+	_, err := t.w.Write(t.json.Bytes())
+	return err
+}
+
+// fileURLPath returns the path of serverURL if it is a "file" URL.
+func fileURLPath(serverURL string) (string, bool) {
+	u, err := url.Parse(serverURL)
+	if err != nil || u.Scheme != "file" {
+		return "", false
+	}
+	return u.Path, true
+}
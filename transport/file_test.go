@@ -0,0 +1,86 @@
+package transport_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go/model"
+	"github.com/elastic/apm-agent-go/transport"
+)
+
+func TestFileTransport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "elasticapm-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "payloads.ndjson")
+
+	tr, err := transport.NewFileTransport(path)
+	require.NoError(t, err)
+	service := &model.Service{Name: "file_testing"}
+	err = tr.SendTransactions(context.Background(), &model.TransactionsPayload{
+		Service:      service,
+		Transactions: []model.Transaction{{Name: "name", Type: "type"}},
+	})
+	require.NoError(t, err)
+	err = tr.SendErrors(context.Background(), &model.ErrorsPayload{
+		Service: service,
+		Errors:  []*model.Error{{Log: model.Log{Message: "boom"}}},
+	})
+	require.NoError(t, err)
+	require.NoError(t, tr.Close())
+
+	lines := readPayloadLines(t, path)
+	require.Len(t, lines, 2)
+	assert.Contains(t, lines[0], "transactions")
+	assert.Contains(t, lines[1], "errors")
+}
+
+func TestInitDefaultFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "elasticapm-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "payloads.ndjson")
+	defer patchEnv("ELASTIC_APM_SERVER_URL", "file://"+filepath.ToSlash(path))()
+
+	tr, err := transport.InitDefault()
+	require.NoError(t, err)
+	require.IsType(t, &transport.FileTransport{}, tr)
+	defer tr.(*transport.FileTransport).Close()
+
+	err = tr.SendMetrics(context.Background(), &model.MetricsPayload{
+		Service: &model.Service{Name: "file_testing"},
+	})
+	require.NoError(t, err)
+	lines := readPayloadLines(t, path)
+	require.Len(t, lines, 1)
+	assert.Contains(t, lines[0], "metrics")
+}
+
+func TestNewHTTPTransportFileURL(t *testing.T) {
+	_, err := transport.NewHTTPTransport("file:///tmp/payloads.ndjson", "")
+	assert.EqualError(t, err, `invalid server URL "file:///tmp/payloads.ndjson": file URLs are only supported by FileTransport`)
+}
+
+func readPayloadLines(t *testing.T, path string) []map[string]interface{} {
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		lines = append(lines, line)
+	}
+	require.NoError(t, scanner.Err())
+	return lines
+}
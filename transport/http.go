@@ -2,19 +2,26 @@ package transport
 
 import (
 	"bytes"
-	"compress/gzip"
 	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
-	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/pkg/errors"
 
+	"github.com/elastic/apm-agent-go/internal/apmconfig"
+	"github.com/elastic/apm-agent-go/internal/apmdebug"
+	"github.com/elastic/apm-agent-go/internal/apmstrings"
 	"github.com/elastic/apm-agent-go/internal/fastjson"
 	"github.com/elastic/apm-agent-go/model"
 )
@@ -25,12 +32,28 @@ const (
 	metricsPath      = "/v1/metrics"
 
 	envSecretToken      = "ELASTIC_APM_SECRET_TOKEN"
+	envAPIKey           = "ELASTIC_APM_API_KEY"
 	envServerURL        = "ELASTIC_APM_SERVER_URL"
+	envServerURLs       = "ELASTIC_APM_SERVER_URLS"
 	envVerifyServerCert = "ELASTIC_APM_VERIFY_SERVER_CERT"
+	envCompactEncoding  = "ELASTIC_APM_COMPACT_ENCODING"
+	envSpoolDir         = "ELASTIC_APM_SPOOL_DIR"
+	envSpoolSize        = "ELASTIC_APM_SPOOL_SIZE"
+	envSendMaxAttempts  = "ELASTIC_APM_SEND_MAX_ATTEMPTS"
+	envProxyURL         = "ELASTIC_APM_PROXY_URL"
+	envCompression      = "ELASTIC_APM_COMPRESSION"
+	envCompressionLevel = "ELASTIC_APM_COMPRESSION_LEVEL"
+	envServerClientCert = "ELASTIC_APM_SERVER_CLIENT_CERT"
+	envServerClientKey  = "ELASTIC_APM_SERVER_CLIENT_KEY"
+	envServerCACertFile = "ELASTIC_APM_SERVER_CA_CERT_FILE"
+	envServerCert       = "ELASTIC_APM_SERVER_CERT"
+	envGlobalHeaders    = "ELASTIC_APM_GLOBAL_HEADERS"
+	envMaxRequestSize   = "ELASTIC_APM_MAX_REQUEST_SIZE"
+	envServerH2C        = "ELASTIC_APM_SERVER_H2C"
 
-	// gzipThresholdBytes is the minimum size of the uncompressed
-	// payload before we'll consider gzip-compressing it.
-	gzipThresholdBytes = 1024
+	// compressThresholdBytes is the minimum size of the uncompressed
+	// payload before we'll consider compressing it.
+	compressThresholdBytes = 1024
 )
 
 var (
@@ -43,17 +66,52 @@ var (
 
 // HTTPTransport is an implementation of Transport, sending payloads via
 // a net/http client.
+//
+// The Send methods may be called concurrently; each payload is encoded
+// with its own buffers, so a payload may be encoded while another is
+// being sent.
 type HTTPTransport struct {
-	Client          *http.Client
-	baseURL         *url.URL
-	transactionsURL *url.URL
-	errorsURL       *url.URL
-	metricsURL      *url.URL
-	headers         http.Header
-	gzipHeaders     http.Header
-	jsonWriter      fastjson.Writer
-	gzipWriter      *gzip.Writer
-	gzipBuffer      bytes.Buffer
+	// stats is accessed atomically, so must be
+	// 64-bit aligned; keep it first.
+	stats Stats
+
+	Client                   *http.Client
+	unixSockets              bool     // Client dials Unix domain sockets
+	proxyURL                 *url.URL // overrides the environment's proxy
+	headers                  http.Header
+	compressedHeaders        http.Header
+	compactHeaders           http.Header
+	compactCompressedHeaders http.Header
+	compression              compressionConfig
+	encoders                 sync.Pool
+	secretToken              string
+	apiKey                   string
+	connectionPool           *ConnectionPool
+	maxRequestSize           int64
+	h2c                      bool // Client uses HTTP/2 for http:// URLs
+	secretTokenProvider      SecretTokenProvider
+
+	mu            sync.Mutex
+	servers       []*server
+	compact       bool
+	serverVersion string
+	dumper        *payloadDumper
+	recorder      *payloadRecorder
+	spool         *spool
+	retryPolicy   RetryPolicy
+}
+
+// encoder holds the buffers used for encoding a payload.
+type encoder struct {
+	jsonWriter     fastjson.Writer
+	compressWriter compressWriter // nil if compression is disabled
+	compressBuffer bytes.Buffer
+}
+
+func (t *HTTPTransport) newEncoder() interface{} {
+	e := &encoder{}
+	e.compressWriter = t.compression.newWriter(&e.compressBuffer)
+	return e
 }
 
 // NewHTTPTransport returns a new HTTPTransport, which can be used for sending
@@ -66,158 +124,493 @@ type HTTPTransport struct {
 // default URL "http://localhost:8200". The URL must be the base server URL,
 // excluding any transactions or errors path. e.g. "http://server.example:8200".
 //
+// A server URL of the form "unix:///path/to/socket" specifies an APM server
+// listening on the Unix domain socket at that path. Requests to the server
+// are made over HTTP, and are never proxied.
+//
+// If serverURL is the empty string and ELASTIC_APM_SERVER_URLS is set to a
+// comma-separated list of URLs, then payloads are sent to those servers, with
+// failover on connection errors; see SetServerURLs. ELASTIC_APM_SERVER_URLS
+// takes precedence over ELASTIC_APM_SERVER_URL.
+//
 // If the secret token specified is the empty string, then NewHTTPTransport
 // will use the value of the ELASTIC_APM_SECRET_TOKEN environment variable, if
 // defined; if the environment variable is also undefined, then requests will
 // not be authenticated.
 //
+// An API key may be specified with the WithAPIKey option, or if that is not
+// specified, with the ELASTIC_APM_API_KEY environment variable. If an API key
+// is specified by either means, requests are authenticated with it, and the
+// secret token is ignored: the API key takes precedence, regardless of
+// whether the secret token was passed explicitly or taken from the
+// environment.
+//
+// A proxy may be specified with the WithProxy option, or if that is not
+// specified, with the ELASTIC_APM_PROXY_URL environment variable; see
+// WithProxy. Otherwise, the proxy is taken from the HTTP_PROXY, HTTPS_PROXY,
+// and NO_PROXY environment variables.
+//
 // If ELASTIC_APM_VERIFY_SERVER_CERT is set to "false", then the transport
-// will not verify the APM server's TLS certificate.
+// will not verify the APM server's TLS certificate. This may not be
+// combined with a pinned server certificate.
+//
+// A client certificate for authenticating with APM servers that require
+// mutual TLS may be specified with the WithClientCertificate option, or if
+// that is not specified, with the ELASTIC_APM_SERVER_CLIENT_CERT and
+// ELASTIC_APM_SERVER_CLIENT_KEY environment variables.
+//
+// The APM server's certificate is verified against the system's root CAs,
+// or against the CA certificates specified with the WithServerCACertificates
+// option or the ELASTIC_APM_SERVER_CA_CERT_FILE environment variable. The
+// server's certificate may instead be pinned with the WithServerCertificate
+// option or the ELASTIC_APM_SERVER_CERT environment variable.
+//
+// If ELASTIC_APM_GLOBAL_HEADERS is set to a comma-separated list of
+// name=value pairs, then those headers are added to every request; see
+// SetHeader.
+//
+// If ELASTIC_APM_COMPACT_ENCODING is set to "true", then the transport
+// will initially send compact payloads; see SetCompact.
+//
+// If ELASTIC_APM_SPOOL_DIR is set, then payloads that cannot be sent are
+// stored in that directory, up to ELASTIC_APM_SPOOL_SIZE, and sent later;
+// see SetSpoolDir.
+//
+// If ELASTIC_APM_SEND_MAX_ATTEMPTS is set to a number greater than one,
+// and no retry policy is specified with the WithRetryPolicy option, then
+// failed requests are retried up to that many attempts in total, with
+// the default backoff intervals; see RetryPolicy.
+//
+// If ELASTIC_APM_MAX_REQUEST_SIZE is set, and no maximum is specified with
+// the WithMaxRequestSize option, then payloads larger than that size are
+// split into multiple requests; see WithMaxRequestSize.
+//
+// The Client's connection pool and keep-alive behaviour may be tuned with
+// the WithConnectionPool option. Requests to https:// URLs use HTTP/2 when
+// the server supports it; see WithH2C for cleartext HTTP/2.
 //
 // The Client field will be initialized with a new http.Client configured from
 // ELASTIC_APM_* environment variables. The Client field may be modified or
-// replaced, e.g. in order to specify TLS root CAs.
-func NewHTTPTransport(serverURL, secretToken string) (*HTTPTransport, error) {
+// replaced, e.g. in order to customize the TLS configuration further.
+//
+// When compiled for WebAssembly with GOOS=js, the default http.Client sends
+// requests using the browser's Fetch API, so the APM Server must allow
+// cross-origin requests from the page's origin. With GOOS=wasip1, the standard
+// library cannot open network connections; the Client field's Transport must
+// be replaced with one provided by the host environment.
+func NewHTTPTransport(serverURL, secretToken string, opts ...HTTPTransportOption) (*HTTPTransport, error) {
+	var o httpTransportOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	serverURLs := []string{serverURL}
 	if serverURL == "" {
-		serverURL = os.Getenv(envServerURL)
-		if serverURL == "" {
-			serverURL = defaultServerURL
+		serverURLs = nil
+		for _, serverURL := range strings.Split(apmconfig.Getenv(envServerURLs), ",") {
+			if serverURL = strings.TrimSpace(serverURL); serverURL != "" {
+				serverURLs = append(serverURLs, serverURL)
+			}
+		}
+		if len(serverURLs) == 0 {
+			serverURL = apmconfig.Getenv(envServerURL)
+			if serverURL == "" {
+				serverURL = defaultServerURL
+			}
+			serverURLs = []string{serverURL}
 		}
 	}
-	req, err := http.NewRequest("POST", serverURL, nil)
+	servers, err := newServers(serverURLs)
 	if err != nil {
 		return nil, err
 	}
 
+	clientCert := o.clientCert
+	if clientCert == nil {
+		if clientCert, err = initialClientCertificate(); err != nil {
+			return nil, err
+		}
+	}
+
+	serverCAs := o.serverCAs
+	if serverCAs == nil {
+		if serverCAs, err = initialServerCACertificates(); err != nil {
+			return nil, err
+		}
+	}
+	serverCert := o.serverCert
+	if serverCert == nil {
+		if serverCert, err = initialServerCertificate(); err != nil {
+			return nil, err
+		}
+	}
+
+	verifyServerCert := apmconfig.Getenv(envVerifyServerCert) != "false"
+	if !verifyServerCert && serverCert != nil {
+		return nil, errors.Errorf(
+			"%s=false conflicts with the pinned server certificate; unset one of them",
+			envVerifyServerCert,
+		)
+	}
+
+	// The TLS configuration is applied regardless of the initial
+	// servers' schemes, as https:// servers may be added later
+	// with SetServerURLs.
 	client := &http.Client{}
-	if req.URL.Scheme == "https" && os.Getenv(envVerifyServerCert) == "false" {
-		tlsConfig := &tls.Config{
+	var tlsConfig *tls.Config
+	if !verifyServerCert {
+		tlsConfig = &tls.Config{
 			InsecureSkipVerify: true,
 		}
-		client.Transport = &http.Transport{
-			Proxy:                 defaultHTTPTransport.Proxy,
-			DialContext:           defaultHTTPTransport.DialContext,
-			MaxIdleConns:          defaultHTTPTransport.MaxIdleConns,
-			IdleConnTimeout:       defaultHTTPTransport.IdleConnTimeout,
-			TLSHandshakeTimeout:   defaultHTTPTransport.TLSHandshakeTimeout,
-			ExpectContinueTimeout: defaultHTTPTransport.ExpectContinueTimeout,
-			TLSClientConfig:       tlsConfig,
+	} else if serverCert != nil {
+		tlsConfig = &tls.Config{}
+		pinServerCertificate(tlsConfig, serverCert)
+	} else if serverCAs != nil {
+		tlsConfig = &tls.Config{RootCAs: serverCAs}
+	}
+	if clientCert != nil {
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{}
 		}
+		tlsConfig.Certificates = []tls.Certificate{*clientCert}
 	}
 
 	headers := make(http.Header)
 	headers.Set("Content-Type", "application/json")
 	if secretToken == "" {
-		secretToken = os.Getenv(envSecretToken)
+		secretToken = apmconfig.Getenv(envSecretToken)
+	}
+	apiKey := o.apiKey
+	if apiKey == "" {
+		apiKey = apmconfig.Getenv(envAPIKey)
 	}
-	if secretToken != "" {
+	if apiKey != "" {
+		headers.Set("Authorization", "ApiKey "+apiKey)
+	} else if secretToken != "" {
 		headers.Set("Authorization", "Bearer "+secretToken)
 	}
+	globalHeaders, err := initialGlobalHeaders()
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range globalHeaders {
+		headers[k] = v
+	}
 
-	gzipHeaders := make(http.Header)
-	for k, v := range headers {
-		gzipHeaders[k] = v
+	var compression compressionConfig
+	if o.compression != nil {
+		compression = *o.compression
+		if err := compression.validate(); err != nil {
+			return nil, err
+		}
+	} else if compression, err = initialCompression(); err != nil {
+		return nil, err
 	}
-	gzipHeaders.Set("Content-Encoding", "gzip")
+	compressedHeaders := cloneHeaders(headers)
+	compressedHeaders.Set("Content-Encoding", string(compression.compression))
+	compactHeaders := cloneHeaders(headers)
+	compactHeaders.Set("Content-Type", compactContentType)
+	compactCompressedHeaders := cloneHeaders(compressedHeaders)
+	compactCompressedHeaders.Set("Content-Type", compactContentType)
 
 	t := &HTTPTransport{
-		Client:          client,
-		baseURL:         req.URL,
-		transactionsURL: urlWithPath(req.URL, transactionsPath),
-		errorsURL:       urlWithPath(req.URL, errorsPath),
-		metricsURL:      urlWithPath(req.URL, metricsPath),
-		headers:         headers,
-		gzipHeaders:     gzipHeaders,
-	}
-	t.gzipWriter = gzip.NewWriter(&t.gzipBuffer)
+		Client:                   client,
+		servers:                  servers,
+		headers:                  headers,
+		compressedHeaders:        compressedHeaders,
+		compact:                  apmconfig.Getenv(envCompactEncoding) == "true",
+		compactHeaders:           compactHeaders,
+		compactCompressedHeaders: compactCompressedHeaders,
+		compression:              compression,
+		secretToken:              secretToken,
+		apiKey:                   apiKey,
+		unixSockets:              hasUnixSocketServer(servers),
+		proxyURL:                 o.proxyURL,
+		connectionPool:           o.connectionPool,
+		h2c:                      o.h2c || apmconfig.Getenv(envServerH2C) == "true",
+		secretTokenProvider:      o.secretTokenProvider,
+	}
+	t.encoders.New = t.newEncoder
+	if t.proxyURL == nil {
+		if value := apmconfig.Getenv(envProxyURL); value != "" {
+			if t.proxyURL, err = parseProxyURL(value); err != nil {
+				return nil, errors.Wrapf(err, "failed to parse %s", envProxyURL)
+			}
+		}
+	}
+	if t.h2c && !h2cSupported {
+		return nil, errors.New("h2c requires Go 1.24 or newer")
+	}
+	if tlsConfig != nil || t.unixSockets || t.proxyURL != nil || t.connectionPool != nil || t.h2c {
+		client.Transport = t.newClientTransport(tlsConfig)
+	}
+	if o.retryPolicy != nil {
+		t.retryPolicy = *o.retryPolicy
+	} else if value := apmconfig.Getenv(envSendMaxAttempts); value != "" {
+		maxAttempts, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %s", envSendMaxAttempts)
+		}
+		t.retryPolicy.MaxAttempts = maxAttempts
+	}
+	if o.maxRequestSize != nil {
+		t.maxRequestSize = *o.maxRequestSize
+	} else if value := apmconfig.Getenv(envMaxRequestSize); value != "" {
+		if t.maxRequestSize, err = apmstrings.ParseSize(value); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %s", envMaxRequestSize)
+		}
+	}
+	if apmdebug.PayloadDumpDir != "" {
+		t.SetPayloadDumpDir(apmdebug.PayloadDumpDir)
+	}
+	if apmdebug.PayloadRecordDir != "" {
+		t.SetPayloadRecordDir(apmdebug.PayloadRecordDir, apmdebug.PayloadRecordSize)
+	}
+	if spoolDir := apmconfig.Getenv(envSpoolDir); spoolDir != "" {
+		var spoolSize int64
+		if value := apmconfig.Getenv(envSpoolSize); value != "" {
+			spoolSize, err = apmstrings.ParseSize(value)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to parse %s", envSpoolSize)
+			}
+		}
+		if err := t.SetSpoolDir(spoolDir, spoolSize); err != nil {
+			return nil, err
+		}
+	}
 	return t, nil
 }
 
+// HTTPTransportOption sets options for NewHTTPTransport.
+type HTTPTransportOption func(*httpTransportOptions)
+
+type httpTransportOptions struct {
+	apiKey      string
+	retryPolicy *RetryPolicy
+	proxyURL    *url.URL
+	compression *compressionConfig
+	clientCert  *tls.Certificate
+	serverCAs   *x509.CertPool
+	serverCert  *x509.Certificate
+
+	connectionPool *ConnectionPool
+	maxRequestSize *int64
+	h2c            bool
+
+	secretTokenProvider SecretTokenProvider
+}
+
+// WithAPIKey returns an HTTPTransportOption which sets the API key used
+// for authenticating requests to the APM server. The key must be the
+// base64-encoded "id:api_key" credentials, as returned by the
+// Elasticsearch create API key API, and is sent in the Authorization
+// header as "ApiKey <key>".
+//
+// The API key takes precedence over any secret token.
+func WithAPIKey(apiKey string) HTTPTransportOption {
+	return func(o *httpTransportOptions) {
+		o.apiKey = apiKey
+	}
+}
+
 // SetUserAgent sets the User-Agent header that will be
 // sent with each request.
 func (t *HTTPTransport) SetUserAgent(ua string) {
 	t.headers.Set("User-Agent", ua)
-	t.gzipHeaders.Set("User-Agent", ua)
+	t.compressedHeaders.Set("User-Agent", ua)
+	t.compactHeaders.Set("User-Agent", ua)
+	t.compactCompressedHeaders.Set("User-Agent", ua)
+}
+
+// SetHeader sets a header that will be sent with each request,
+// replacing any existing values for the header. This may be used
+// to attach tenant IDs or routing headers for gateways fronting
+// the APM server. SetHeader should be called before the transport
+// is used; it must not be called concurrently with the Send methods.
+//
+// The Authorization, Content-Type and Content-Encoding headers are
+// set by the transport, and cannot be overridden.
+func (t *HTTPTransport) SetHeader(key, value string) {
+	if reservedHeader(key) {
+		return
+	}
+	t.headers.Set(key, value)
+	t.compressedHeaders.Set(key, value)
+	t.compactHeaders.Set(key, value)
+	t.compactCompressedHeaders.Set(key, value)
+}
+
+// SetCompact sets whether or not the transport should send compact
+// payloads, for use with gateways fronting the APM server in bandwidth
+// and CPU constrained environments, such as IoT and edge devices.
+//
+// Compact payloads omit process and system metadata, transaction, span
+// and error context, and stack traces. They are sent with the Content-Type
+// "application/vnd.elastic.apm.compact+json"; if the server responds
+// with 415 (Unsupported Media Type), the transport will disable compact
+// mode and return an error, so that the payload may be resent in full.
+//
+// Compact mode modifies the payloads passed to the Send methods in place.
+func (t *HTTPTransport) SetCompact(compact bool) {
+	t.mu.Lock()
+	t.compact = compact
+	t.mu.Unlock()
+}
+
+func (t *HTTPTransport) isCompact() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.compact
 }
 
 // SendTransactions sends the transactions payload over HTTP.
 func (t *HTTPTransport) SendTransactions(ctx context.Context, p *model.TransactionsPayload) error {
-	t.jsonWriter.Reset()
-	p.MarshalFastJSON(&t.jsonWriter)
-	req := requestWithContext(ctx, t.newTransactionsRequest())
-	return t.sendPayload(req, "SendTransactions")
+	compact := t.isCompact()
+	if compact {
+		p = compactTransactionsPayload(p)
+	}
+	return t.sendTransactions(ctx, p, compact)
 }
 
 // SendErrors sends the errors payload over HTTP.
 func (t *HTTPTransport) SendErrors(ctx context.Context, p *model.ErrorsPayload) error {
-	t.jsonWriter.Reset()
-	p.MarshalFastJSON(&t.jsonWriter)
-	req := requestWithContext(ctx, t.newErrorsRequest())
-	return t.sendPayload(req, "SendErrors")
+	compact := t.isCompact()
+	if compact {
+		p = compactErrorsPayload(p)
+	}
+	return t.sendErrors(ctx, p, compact)
 }
 
 // SendMetrics sends the metrics payload over HTTP.
 func (t *HTTPTransport) SendMetrics(ctx context.Context, p *model.MetricsPayload) error {
-	t.jsonWriter.Reset()
-	p.MarshalFastJSON(&t.jsonWriter)
-	req := requestWithContext(ctx, t.newMetricsRequest())
-	return t.sendPayload(req, "SendMetrics")
+	compact := t.isCompact()
+	if compact {
+		p = compactMetricsPayload(p)
+	}
+	return t.sendMetrics(ctx, p, compact)
+}
+
+// ServerVersion returns the version of the APM server, by querying the
+// server information endpoint at the base server URL. The version is
+// cached after it has been successfully obtained.
+func (t *HTTPTransport) ServerVersion(ctx context.Context) (string, error) {
+	t.mu.Lock()
+	version := t.serverVersion
+	t.mu.Unlock()
+	if version != "" {
+		return version, nil
+	}
+	authorize, err := t.authorizer(ctx)
+	if err != nil {
+		return "", err
+	}
+	req := requestWithContext(ctx, t.newRequest(t.orderedServers()[0].baseURL))
+	req.Method = "GET"
+	if authorize != nil {
+		authorize(req)
+	}
+	resp, err := t.Client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "querying server information failed")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", &HTTPError{Op: "ServerVersion", Response: resp}
+	}
+	var info struct {
+		Version string `json:"version"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return "", errors.Wrap(err, "decoding server information failed")
+	}
+	if info.Version == "" {
+		return "", errors.New("server information does not include version")
+	}
+	t.mu.Lock()
+	t.serverVersion = info.Version
+	t.mu.Unlock()
+	return info.Version, nil
 }
 
-func (t *HTTPTransport) sendPayload(req *http.Request, op string) error {
-	buf := t.jsonWriter.Bytes()
+// dump writes the payload encoded in e to the payload dump
+// and record directories, if configured.
+func (t *HTTPTransport) dump(kind string, e *encoder) {
+	t.mu.Lock()
+	dumper := t.dumper
+	recorder := t.recorder
+	t.mu.Unlock()
+	if dumper != nil {
+		if err := dumper.dump(kind, e.jsonWriter.Bytes()); err != nil {
+			atomic.AddUint64(&t.stats.PayloadDumpFailures, 1)
+		}
+	}
+	if recorder != nil {
+		if err := recorder.record(kind, e.jsonWriter.Bytes()); err != nil {
+			atomic.AddUint64(&t.stats.PayloadRecordFailures, 1)
+		}
+	}
+}
+
+// sendRequest sends the encoded payload buf with req, using the
+// compression buffers in e to compress it if it is large enough.
+// If authorize is non-nil, it is called to authorize the request.
+func (t *HTTPTransport) sendRequest(req *http.Request, buf []byte, e *encoder, op string, compact bool, authorize func(*http.Request)) error {
+	if compact {
+		req.Header = t.compactHeaders
+	}
 	var body io.Reader = bytes.NewReader(buf)
 	req.ContentLength = int64(len(buf))
-	if req.ContentLength >= gzipThresholdBytes {
-		t.gzipBuffer.Reset()
-		t.gzipWriter.Reset(&t.gzipBuffer)
-		if _, err := io.Copy(t.gzipWriter, body); err != nil {
+	if e.compressWriter != nil && req.ContentLength >= compressThresholdBytes {
+		e.compressBuffer.Reset()
+		e.compressWriter.Reset(&e.compressBuffer)
+		if _, err := io.Copy(e.compressWriter, body); err != nil {
 			return err
 		}
-		if err := t.gzipWriter.Flush(); err != nil {
+		if err := e.compressWriter.Close(); err != nil {
 			return err
 		}
-		req.ContentLength = int64(t.gzipBuffer.Len())
-		body = &t.gzipBuffer
-		req.Header = t.gzipHeaders
+		req.ContentLength = int64(e.compressBuffer.Len())
+		body = &e.compressBuffer
+		req.Header = t.compressedHeaders
+		if compact {
+			req.Header = t.compactCompressedHeaders
+		}
 	}
 	req.Body = ioutil.NopCloser(body)
+	if authorize != nil {
+		authorize(req)
+	}
 
+	atomic.AddUint64(&t.stats.Requests, 1)
+	start := time.Now()
 	resp, err := t.Client.Do(req)
 	if err != nil {
+		atomic.AddUint64(&t.stats.RequestFailures, 1)
 		return errors.Wrapf(err, "sending request for %s failed", op)
 	}
 	defer resp.Body.Close()
+	atomic.AddUint64(&t.stats.BytesSent, uint64(req.ContentLength))
 	switch resp.StatusCode {
 	case http.StatusOK, http.StatusAccepted:
+		t.recordServerClockOffset(resp.Header.Get("Date"), start, time.Now())
 		return nil
+	case http.StatusUnsupportedMediaType:
+		if compact {
+			// The server does not support compact payloads;
+			// revert to full payloads for subsequent requests.
+			t.SetCompact(false)
+		}
 	}
 
 	// apm-server will return 503 Service Unavailable
 	// if the data cannot be published to Elasticsearch,
 	// but there is no Retry-After header included, so
 	// we treat it as any other internal server error.
+	atomic.AddUint64(&t.stats.RequestFailures, 1)
 	bodyContents, err := ioutil.ReadAll(resp.Body)
 	if err == nil {
 		resp.Body = ioutil.NopCloser(bytes.NewReader(bodyContents))
 	}
-	return &HTTPError{
-		Op:       op,
-		Response: resp,
-		Message:  strings.TrimSpace(string(bodyContents)),
-	}
-}
-
-func (t *HTTPTransport) newTransactionsRequest() *http.Request {
-	return t.newRequest(t.transactionsURL)
-}
-
-func (t *HTTPTransport) newErrorsRequest() *http.Request {
-	return t.newRequest(t.errorsURL)
-}
-
-func (t *HTTPTransport) newMetricsRequest() *http.Request {
-	return t.newRequest(t.metricsURL)
+	return newHTTPError(op, resp, bodyContents)
 }
 
 func (t *HTTPTransport) newRequest(url *url.URL) *http.Request {
@@ -233,6 +626,52 @@ func (t *HTTPTransport) newRequest(url *url.URL) *http.Request {
 	return req
 }
 
+// initialGlobalHeaders returns the headers specified by the
+// ELASTIC_APM_GLOBAL_HEADERS environment variable, as a
+// comma-separated list of name=value pairs.
+func initialGlobalHeaders() (http.Header, error) {
+	value := apmconfig.Getenv(envGlobalHeaders)
+	if value == "" {
+		return nil, nil
+	}
+	headers := make(http.Header)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		i := strings.IndexRune(item, '=')
+		if i <= 0 {
+			return nil, errors.Errorf("invalid %s value %q: expected name=value", envGlobalHeaders, item)
+		}
+		name := http.CanonicalHeaderKey(strings.TrimSpace(item[:i]))
+		if reservedHeader(name) {
+			return nil, errors.Errorf("invalid %s value %q: %s cannot be overridden", envGlobalHeaders, item, name)
+		}
+		headers.Set(name, strings.TrimSpace(item[i+1:]))
+	}
+	return headers, nil
+}
+
+// reservedHeader reports whether the header with the given name is
+// set by the transport, from its secret token or API key, and payload
+// encoding, and so cannot be set with SetHeader or global headers.
+func reservedHeader(name string) bool {
+	switch http.CanonicalHeaderKey(name) {
+	case "Authorization", "Content-Type", "Content-Encoding":
+		return true
+	}
+	return false
+}
+
+func cloneHeaders(h http.Header) http.Header {
+	clone := make(http.Header, len(h))
+	for k, v := range h {
+		clone[k] = append([]string(nil), v...)
+	}
+	return clone
+}
+
 func urlWithPath(url *url.URL, p string) *url.URL {
 	urlCopy := *url
 	urlCopy.Path += p
@@ -242,11 +681,63 @@ func urlWithPath(url *url.URL, p string) *url.URL {
 	return &urlCopy
 }
 
+// maxEventErrorMessages is the maximum number of per-event
+// error messages included in the text of an HTTPError.
+const maxEventErrorMessages = 5
+
 // HTTPError is an error returned by HTTPTransport methods when requests fail.
 type HTTPError struct {
 	Op       string
 	Response *http.Response
-	Message  string
+
+	// Message holds the error message in the response body. If the
+	// body is a JSON error response, Message holds its "error"
+	// field, and is empty if there is none.
+	Message string
+
+	// Accepted holds the number of events accepted by the server,
+	// as described by a JSON error response.
+	Accepted int
+
+	// Errors holds the per-event errors described by a JSON error
+	// response, such as validation failures and oversized events.
+	Errors []EventError
+}
+
+// EventError describes an event rejected by the APM server.
+type EventError struct {
+	// Message describes why the event was rejected.
+	Message string `json:"message"`
+
+	// Document holds the rejected event, if the
+	// server included it in the response.
+	Document string `json:"document,omitempty"`
+}
+
+// newHTTPError returns an HTTPError for the failed response resp,
+// with the given body contents. JSON error responses are parsed
+// for per-event errors; other bodies are recorded as the message.
+func newHTTPError(op string, resp *http.Response, body []byte) *HTTPError {
+	e := &HTTPError{Op: op, Response: resp}
+	var intakeResponse struct {
+		Accepted int          `json:"accepted"`
+		Error    string       `json:"error"`
+		Errors   []EventError `json:"errors"`
+	}
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '{' && json.Unmarshal(body, &intakeResponse) == nil {
+		e.Message = intakeResponse.Error
+		e.Accepted = intakeResponse.Accepted
+		e.Errors = intakeResponse.Errors
+		if e.Message == "" && len(e.Errors) == 0 {
+			// The body is JSON, but not an intake response,
+			// e.g. from a proxy; report it verbatim.
+			e.Message = string(body)
+		}
+	} else {
+		e.Message = string(body)
+	}
+	return e
 }
 
 func (e *HTTPError) Error() string {
@@ -254,6 +745,20 @@ func (e *HTTPError) Error() string {
 	if e.Message != "" {
 		msg += ": " + e.Message
 	}
+	if len(e.Errors) > 0 {
+		msg += fmt.Sprintf(" (%d events rejected: ", len(e.Errors))
+		for i, eventErr := range e.Errors {
+			if i == maxEventErrorMessages {
+				msg += fmt.Sprintf("; and %d more", len(e.Errors)-i)
+				break
+			}
+			if i > 0 {
+				msg += "; "
+			}
+			msg += eventErr.Message
+		}
+		msg += ")"
+	}
 	return msg
 }
 
@@ -0,0 +1,37 @@
+package transport
+
+import "net/http"
+
+// WithH2C returns an HTTPTransportOption which makes the transport's
+// default client send requests to http:// APM server URLs using
+// HTTP/2 without TLS ("h2c"), with prior knowledge that the server
+// supports it. This is intended for APM servers behind service mesh
+// proxies which accept cleartext HTTP/2, so that requests are
+// multiplexed over a single connection to each server rather than
+// opening a connection per concurrent request. h2c may also be
+// enabled by setting the ELASTIC_APM_SERVER_H2C environment variable
+// to "true".
+//
+// When h2c is enabled, HTTP/1.1 is not used for any server, so all
+// configured APM servers must support HTTP/2. h2c requires Go 1.24
+// or newer; with older versions of Go, NewHTTPTransport returns an
+// error if h2c is enabled.
+//
+// Requests to https:// APM server URLs use HTTP/2 whenever the server
+// negotiates it with TLS ALPN, regardless of this option.
+func WithH2C() HTTPTransportOption {
+	return func(o *httpTransportOptions) {
+		o.h2c = true
+	}
+}
+
+// configureHTTP2 configures transport to attempt HTTP/2 for https
+// URLs, which net/http does not do by default for transports with
+// a custom dialer or TLS configuration, and to use h2c for http
+// URLs if h2c is true.
+func configureHTTP2(transport *http.Transport, h2c bool) {
+	forceAttemptHTTP2(transport)
+	if h2c {
+		enableH2C(transport)
+	}
+}
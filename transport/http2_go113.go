@@ -0,0 +1,13 @@
+// +build go1.13,!go1.24
+
+package transport
+
+import "net/http"
+
+const h2cSupported = false
+
+func forceAttemptHTTP2(transport *http.Transport) {
+	transport.ForceAttemptHTTP2 = true
+}
+
+func enableH2C(transport *http.Transport) {}
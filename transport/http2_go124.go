@@ -0,0 +1,20 @@
+// +build go1.24
+
+package transport
+
+import "net/http"
+
+const h2cSupported = true
+
+func forceAttemptHTTP2(transport *http.Transport) {
+	transport.ForceAttemptHTTP2 = true
+}
+
+func enableH2C(transport *http.Transport) {
+	// Without HTTP1, net/http sends requests for http:// URLs
+	// using unencrypted HTTP/2 with prior knowledge.
+	var protocols http.Protocols
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(true)
+	transport.Protocols = &protocols
+}
@@ -0,0 +1,14 @@
+// +build !go1.13
+
+package transport
+
+import "net/http"
+
+const h2cSupported = false
+
+// forceAttemptHTTP2 is a no-op before Go 1.13, which
+// has no way of enabling HTTP/2 for custom transports
+// without importing golang.org/x/net/http2.
+func forceAttemptHTTP2(transport *http.Transport) {}
+
+func enableH2C(transport *http.Transport) {}
@@ -0,0 +1,75 @@
+// +build go1.24
+
+package transport_test
+
+import (
+	"context"
+	"crypto/x509"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go/model"
+	"github.com/elastic/apm-agent-go/transport"
+)
+
+func TestHTTPTransportHTTP2(t *testing.T) {
+	var h recordingHandler
+	server := httptest.NewUnstartedServer(&h)
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	// Configuring the server CA gives the client a custom TLS
+	// configuration, for which net/http would not otherwise
+	// attempt HTTP/2.
+	certificate, err := x509.ParseCertificate(server.TLS.Certificates[0].Certificate[0])
+	require.NoError(t, err)
+	certpool := x509.NewCertPool()
+	certpool.AddCert(certificate)
+	tr, err := transport.NewHTTPTransport(server.URL, "", transport.WithServerCACertificates(certpool))
+	require.NoError(t, err)
+	assert.NoError(t, tr.SendTransactions(context.Background(), &model.TransactionsPayload{}))
+	assert.NoError(t, tr.SendErrors(context.Background(), &model.ErrorsPayload{}))
+
+	require.Len(t, h.requests, 2)
+	for _, req := range h.requests {
+		assert.Equal(t, 2, req.ProtoMajor)
+	}
+	assert.Equal(t, h.requests[0].RemoteAddr, h.requests[1].RemoteAddr)
+}
+
+func TestHTTPTransportH2C(t *testing.T) {
+	var h recordingHandler
+	server := httptest.NewUnstartedServer(&h)
+	server.Config.Protocols = new(http.Protocols)
+	server.Config.Protocols.SetHTTP1(true)
+	server.Config.Protocols.SetUnencryptedHTTP2(true)
+	server.Start()
+	defer server.Close()
+
+	tr, err := transport.NewHTTPTransport(server.URL, "")
+	require.NoError(t, err)
+	assert.NoError(t, tr.SendTransactions(context.Background(), &model.TransactionsPayload{}))
+
+	tr, err = transport.NewHTTPTransport(server.URL, "", transport.WithH2C())
+	require.NoError(t, err)
+	assert.NoError(t, tr.SendTransactions(context.Background(), &model.TransactionsPayload{}))
+
+	// h2c may be enabled in the environment.
+	defer patchEnv("ELASTIC_APM_SERVER_H2C", "true")()
+	tr, err = transport.NewHTTPTransport(server.URL, "")
+	require.NoError(t, err)
+	assert.NoError(t, tr.SendTransactions(context.Background(), &model.TransactionsPayload{}))
+
+	require.Len(t, h.requests, 3)
+	assert.Equal(t, 1, h.requests[0].ProtoMajor)
+	assert.Equal(t, 2, h.requests[1].ProtoMajor)
+	assert.Equal(t, 2, h.requests[2].ProtoMajor)
+}
@@ -3,18 +3,30 @@ package transport_test
 import (
 	"bytes"
 	"compress/gzip"
+	"compress/zlib"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"io"
 	"io/ioutil"
 	"log"
+	"math/big"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"path/filepath"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -27,8 +39,19 @@ import (
 func init() {
 	// Don't let the environment influence tests.
 	os.Setenv("ELASTIC_APM_SERVER_URL", "")
+	os.Setenv("ELASTIC_APM_SERVER_URLS", "")
+	os.Setenv("ELASTIC_APM_PROXY_URL", "")
+	os.Setenv("ELASTIC_APM_COMPRESSION", "")
+	os.Setenv("ELASTIC_APM_COMPRESSION_LEVEL", "")
+	os.Setenv("ELASTIC_APM_SERVER_CLIENT_CERT", "")
+	os.Setenv("ELASTIC_APM_SERVER_CLIENT_KEY", "")
+	os.Setenv("ELASTIC_APM_SERVER_CA_CERT_FILE", "")
+	os.Setenv("ELASTIC_APM_SERVER_CERT", "")
+	os.Setenv("ELASTIC_APM_GLOBAL_HEADERS", "")
 	os.Setenv("ELASTIC_APM_SECRET_TOKEN", "")
 	os.Setenv("ELASTIC_APM_VERIFY_SERVER_CERT", "")
+	os.Setenv("ELASTIC_APM_MAX_REQUEST_SIZE", "")
+	os.Setenv("ELASTIC_APM_SERVER_H2C", "")
 }
 
 func TestNewHTTPTransportDefaultURL(t *testing.T) {
@@ -112,6 +135,148 @@ func TestHTTPTransportEnvSecretToken(t *testing.T) {
 	assertAuthorization(t, h.requests[0], "hunter2")
 }
 
+func TestHTTPTransportSecretTokenProvider(t *testing.T) {
+	var h recordingHandler
+	server := httptest.NewServer(&h)
+	defer server.Close()
+
+	type contextKey struct{}
+	tokens := []string{"hunter2", "hunter3"}
+	var providerErr error
+	tr, err := transport.NewHTTPTransport(server.URL, "static", transport.WithSecretTokenProvider(
+		func(ctx context.Context) (string, error) {
+			assert.Equal(t, "value", ctx.Value(contextKey{}))
+			if providerErr != nil {
+				return "", providerErr
+			}
+			token := tokens[0]
+			tokens = tokens[1:]
+			return token, nil
+		},
+	))
+	require.NoError(t, err)
+
+	ctx := context.WithValue(context.Background(), contextKey{}, "value")
+	require.NoError(t, tr.SendTransactions(ctx, &model.TransactionsPayload{}))
+	require.NoError(t, tr.SendErrors(ctx, &model.ErrorsPayload{}))
+	require.Len(t, h.requests, 2)
+	assertAuthorization(t, h.requests[0], "hunter2")
+	assertAuthorization(t, h.requests[1], "hunter3")
+
+	// Requests are not sent if the provider fails.
+	providerErr = errors.New("vault sealed")
+	err = tr.SendTransactions(ctx, &model.TransactionsPayload{})
+	assert.EqualError(t, err, "failed to obtain secret token: vault sealed")
+	assert.Len(t, h.requests, 2)
+}
+
+func TestHTTPTransportSecretTokenProviderError(t *testing.T) {
+	var h1, h2 recordingHandler
+	server1 := httptest.NewServer(&h1)
+	defer server1.Close()
+	server2 := httptest.NewServer(&h2)
+	defer server2.Close()
+
+	dir, err := ioutil.TempDir("", "elasticapm")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var calls int
+	providerErr := errors.New("vault sealed")
+	tr, err := transport.NewHTTPTransport(server1.URL, "",
+		transport.WithRetryPolicy(transport.RetryPolicy{MaxAttempts: 3, InitialInterval: time.Millisecond}),
+		transport.WithSecretTokenProvider(func(ctx context.Context) (string, error) {
+			calls++
+			return "hunter2", providerErr
+		}),
+	)
+	require.NoError(t, err)
+	require.NoError(t, tr.SetServerURLs(server1.URL, server2.URL))
+	require.NoError(t, tr.SetSpoolDir(dir, 0))
+
+	// The provider is called once, and its error is neither retried,
+	// spooled, nor counted against the servers.
+	err = tr.SendTransactions(context.Background(), &model.TransactionsPayload{})
+	assert.EqualError(t, err, "failed to obtain secret token: vault sealed")
+	assert.Equal(t, 1, calls)
+	stats := tr.TransportStats()
+	assert.Equal(t, uint64(0), stats.Failovers)
+	assert.Equal(t, uint64(0), stats.Requests)
+	infos, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, infos, 0)
+
+	// The first server is still healthy, so it is used next.
+	providerErr = nil
+	require.NoError(t, tr.SendTransactions(context.Background(), &model.TransactionsPayload{}))
+	assert.Len(t, h1.requests, 1)
+	assert.Len(t, h2.requests, 0)
+}
+
+func TestHTTPTransportSetHeader(t *testing.T) {
+	var h recordingHandler
+	server := httptest.NewServer(&h)
+	defer server.Close()
+	defer patchEnv("ELASTIC_APM_GLOBAL_HEADERS", "X-Tenant-Id=abc, x-route = eu-west")()
+
+	transport, err := transport.NewHTTPTransport(server.URL, "")
+	require.NoError(t, err)
+	transport.SetHeader("X-Tenant-Id", "def")
+	transport.SetHeader("Content-Type", "text/plain")
+	transport.SetHeader("authorization", "Basic Zm9vOmJhcg==")
+	err = transport.SendTransactions(context.Background(), &model.TransactionsPayload{})
+	assert.NoError(t, err)
+
+	require.Len(t, h.requests, 1)
+	assert.Equal(t, []string{"def"}, h.requests[0].Header["X-Tenant-Id"])
+	assert.Equal(t, []string{"eu-west"}, h.requests[0].Header["X-Route"])
+	assert.Equal(t, "application/json", h.requests[0].Header.Get("Content-Type"))
+	assert.Empty(t, h.requests[0].Header.Get("Authorization"))
+}
+
+func TestHTTPTransportGlobalHeadersInvalid(t *testing.T) {
+	defer patchEnv("ELASTIC_APM_GLOBAL_HEADERS", "X-Tenant-Id")()
+	_, err := transport.NewHTTPTransport("", "")
+	assert.EqualError(t, err, `invalid ELASTIC_APM_GLOBAL_HEADERS value "X-Tenant-Id": expected name=value`)
+
+	defer patchEnv("ELASTIC_APM_GLOBAL_HEADERS", "Content-Type=text/plain")()
+	_, err = transport.NewHTTPTransport("", "")
+	assert.EqualError(t, err, `invalid ELASTIC_APM_GLOBAL_HEADERS value "Content-Type=text/plain": Content-Type cannot be overridden`)
+
+	defer patchEnv("ELASTIC_APM_GLOBAL_HEADERS", "authorization=Bearer hunter2")()
+	_, err = transport.NewHTTPTransport("", "")
+	assert.EqualError(t, err, `invalid ELASTIC_APM_GLOBAL_HEADERS value "authorization=Bearer hunter2": Authorization cannot be overridden`)
+}
+
+func TestHTTPTransportAPIKey(t *testing.T) {
+	var h recordingHandler
+	server := httptest.NewServer(&h)
+	defer server.Close()
+
+	// The API key takes precedence over the secret token.
+	transport, err := transport.NewHTTPTransport(server.URL, "hunter2", transport.WithAPIKey("aWQ6a2V5"))
+	assert.NoError(t, err)
+	transport.SendTransactions(context.Background(), &model.TransactionsPayload{})
+
+	assert.Len(t, h.requests, 1)
+	assert.Equal(t, []string{"ApiKey aWQ6a2V5"}, h.requests[0].Header["Authorization"])
+}
+
+func TestHTTPTransportEnvAPIKey(t *testing.T) {
+	var h recordingHandler
+	server := httptest.NewServer(&h)
+	defer server.Close()
+	defer patchEnv("ELASTIC_APM_SECRET_TOKEN", "hunter2")()
+	defer patchEnv("ELASTIC_APM_API_KEY", "aWQ6a2V5")()
+
+	transport, err := transport.NewHTTPTransport(server.URL, "")
+	assert.NoError(t, err)
+	transport.SendTransactions(context.Background(), &model.TransactionsPayload{})
+
+	assert.Len(t, h.requests, 1)
+	assert.Equal(t, []string{"ApiKey aWQ6a2V5"}, h.requests[0].Header["Authorization"])
+}
+
 func TestHTTPTransportNoSecretToken(t *testing.T) {
 	var h recordingHandler
 	transport, server := newHTTPTransport(t, &h)
@@ -157,6 +322,199 @@ func TestHTTPTransportTLS(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestHTTPTransportConnectionPool(t *testing.T) {
+	var h recordingHandler
+	server := httptest.NewServer(&h)
+	defer server.Close()
+
+	tr, err := transport.NewHTTPTransport(server.URL, "", transport.WithConnectionPool(transport.ConnectionPool{
+		MaxIdleConnsPerHost: 8,
+		IdleConnTimeout:     time.Minute,
+		DisableKeepAlives:   true,
+	}))
+	require.NoError(t, err)
+	require.IsType(t, &http.Transport{}, tr.Client.Transport)
+	httpTransport := tr.Client.Transport.(*http.Transport)
+	assert.Equal(t, 8, httpTransport.MaxIdleConnsPerHost)
+	assert.Equal(t, time.Minute, httpTransport.IdleConnTimeout)
+	assert.True(t, httpTransport.DisableKeepAlives)
+
+	// Zero fields take the defaults.
+	defaultTransport := http.DefaultTransport.(*http.Transport)
+	assert.Equal(t, defaultTransport.MaxIdleConns, httpTransport.MaxIdleConns)
+	assert.Equal(t, defaultTransport.TLSHandshakeTimeout, httpTransport.TLSHandshakeTimeout)
+
+	assert.NoError(t, tr.SendTransactions(context.Background(), &model.TransactionsPayload{}))
+}
+
+func TestHTTPTransportMaxRequestSize(t *testing.T) {
+	var h recordingHandler
+	server := httptest.NewServer(&h)
+	defer server.Close()
+
+	tr, err := transport.NewHTTPTransport(server.URL, "", transport.WithMaxRequestSize(1024))
+	require.NoError(t, err)
+
+	payload := &model.TransactionsPayload{Transactions: make([]model.Transaction, 64)}
+	for i := range payload.Transactions {
+		payload.Transactions[i].Name = "GET /"
+	}
+	var jw fastjson.Writer
+	payload.MarshalFastJSON(&jw)
+	require.True(t, jw.Size() > 1024)
+	require.NoError(t, tr.SendTransactions(context.Background(), payload))
+	assert.True(t, len(h.requests) > 1, "expected multiple requests, got %d", len(h.requests))
+
+	var total int
+	for _, req := range h.requests {
+		body := io.Reader(req.Body)
+		if req.Header.Get("Content-Encoding") == "gzip" {
+			r, err := gzip.NewReader(body)
+			require.NoError(t, err)
+			body = r
+		}
+		data, err := ioutil.ReadAll(body)
+		require.NoError(t, err)
+		assert.True(t, len(data) <= 1024, "request body size %d exceeds maximum", len(data))
+
+		var decoded struct {
+			Transactions []json.RawMessage `json:"transactions"`
+		}
+		require.NoError(t, json.Unmarshal(data, &decoded))
+		total += len(decoded.Transactions)
+	}
+	assert.Equal(t, len(payload.Transactions), total)
+}
+
+func TestHTTPTransportMaxRequestSizePartial(t *testing.T) {
+	var requests int
+	var sent int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if requests++; requests > 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var decoded struct {
+			Transactions []json.RawMessage `json:"transactions"`
+		}
+		body := io.Reader(req.Body)
+		if req.Header.Get("Content-Encoding") == "gzip" {
+			r, err := gzip.NewReader(body)
+			if err != nil {
+				panic(err)
+			}
+			body = r
+		}
+		if err := json.NewDecoder(body).Decode(&decoded); err != nil {
+			panic(err)
+		}
+		sent = len(decoded.Transactions)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	tr, err := transport.NewHTTPTransport(server.URL, "", transport.WithMaxRequestSize(1024))
+	require.NoError(t, err)
+
+	payload := &model.TransactionsPayload{Transactions: make([]model.Transaction, 64)}
+	for i := range payload.Transactions {
+		payload.Transactions[i].Name = "GET /"
+	}
+	err = tr.SendTransactions(context.Background(), payload)
+	require.IsType(t, &transport.PartialSendError{}, err)
+	partial := err.(*transport.PartialSendError)
+	assert.NotZero(t, sent)
+	assert.Equal(t, sent, partial.Sent)
+	assert.IsType(t, &transport.HTTPError{}, partial.Err)
+}
+
+func TestHTTPTransportMaxRequestSizeInvalid(t *testing.T) {
+	defer patchEnv("ELASTIC_APM_MAX_REQUEST_SIZE", "1 furlong")()
+	_, err := transport.NewHTTPTransport("", "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to parse ELASTIC_APM_MAX_REQUEST_SIZE")
+}
+
+func TestHTTPTransportServerCACertificates(t *testing.T) {
+	var h recordingHandler
+	server := httptest.NewUnstartedServer(&h)
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+
+	certificate, err := x509.ParseCertificate(server.TLS.Certificates[0].Certificate[0])
+	require.NoError(t, err)
+	certpool := x509.NewCertPool()
+	certpool.AddCert(certificate)
+	tr, err := transport.NewHTTPTransport(server.URL, "", transport.WithServerCACertificates(certpool))
+	require.NoError(t, err)
+	assert.NoError(t, tr.SendTransactions(context.Background(), &model.TransactionsPayload{}))
+
+	// The CA certificates may be specified in the environment.
+	caFile := writeCertificateFile(t, certificate)
+	defer os.Remove(caFile)
+	defer patchEnv("ELASTIC_APM_SERVER_CA_CERT_FILE", caFile)()
+	tr, err = transport.NewHTTPTransport(server.URL, "")
+	require.NoError(t, err)
+	assert.NoError(t, tr.SendTransactions(context.Background(), &model.TransactionsPayload{}))
+}
+
+func TestHTTPTransportServerCertificatePinned(t *testing.T) {
+	var h recordingHandler
+	server := httptest.NewUnstartedServer(&h)
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+
+	certificate, err := x509.ParseCertificate(server.TLS.Certificates[0].Certificate[0])
+	require.NoError(t, err)
+	certFile := writeCertificateFile(t, certificate)
+	defer os.Remove(certFile)
+	defer patchEnv("ELASTIC_APM_SERVER_CERT", certFile)()
+	tr, err := transport.NewHTTPTransport(server.URL, "")
+	require.NoError(t, err)
+	assert.NoError(t, tr.SendTransactions(context.Background(), &model.TransactionsPayload{}))
+
+	// Any other certificate is rejected, even if signed by a trusted CA.
+	otherPEM, _ := newClientCertificate(t, "other")
+	block, _ := pem.Decode(otherPEM)
+	other, err := x509.ParseCertificate(block.Bytes)
+	require.NoError(t, err)
+	certpool := x509.NewCertPool()
+	certpool.AddCert(certificate)
+	tr, err = transport.NewHTTPTransport(server.URL, "",
+		transport.WithServerCACertificates(certpool),
+		transport.WithServerCertificate(other),
+	)
+	require.NoError(t, err)
+	err = tr.SendTransactions(context.Background(), &model.TransactionsPayload{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "server certificate does not match the pinned certificate")
+}
+
+func TestHTTPTransportServerCertificateInvalid(t *testing.T) {
+	defer patchEnv("ELASTIC_APM_SERVER_CA_CERT_FILE", "testdata/missing.pem")()
+	_, err := transport.NewHTTPTransport("https://testing.invalid", "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to load server CA certificates")
+
+	defer patchEnv("ELASTIC_APM_SERVER_CA_CERT_FILE", "")()
+	defer patchEnv("ELASTIC_APM_SERVER_CERT", "testdata/missing.pem")()
+	_, err = transport.NewHTTPTransport("https://testing.invalid", "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to load server certificate")
+}
+
+// writeCertificateFile writes cert to a temporary PEM
+// file, and returns the file's path.
+func writeCertificateFile(t *testing.T, cert *x509.Certificate) string {
+	f, err := ioutil.TempFile("", "elasticapm-test")
+	require.NoError(t, err)
+	defer f.Close()
+	require.NoError(t, pem.Encode(f, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+	return f.Name()
+}
+
 func TestHTTPTransportEnvVerifyServerCert(t *testing.T) {
 	var h recordingHandler
 	server := httptest.NewTLSServer(&h)
@@ -177,6 +535,100 @@ func TestHTTPTransportEnvVerifyServerCert(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestHTTPTransportEnvVerifyServerCertPinned(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+	certificate, err := x509.ParseCertificate(server.TLS.Certificates[0].Certificate[0])
+	require.NoError(t, err)
+
+	defer patchEnv("ELASTIC_APM_VERIFY_SERVER_CERT", "false")()
+	_, err = transport.NewHTTPTransport(server.URL, "", transport.WithServerCertificate(certificate))
+	assert.EqualError(t, err, "ELASTIC_APM_VERIFY_SERVER_CERT=false conflicts with the pinned server certificate; unset one of them")
+}
+
+func TestHTTPTransportSetServerURLsTLS(t *testing.T) {
+	var h recordingHandler
+	server := httptest.NewUnstartedServer(&h)
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+	certificate, err := x509.ParseCertificate(server.TLS.Certificates[0].Certificate[0])
+	require.NoError(t, err)
+
+	// The pinned certificate applies to https:// servers set after
+	// the transport is created with an http:// server.
+	tr, err := transport.NewHTTPTransport("http://server.invalid", "", transport.WithServerCertificate(certificate))
+	require.NoError(t, err)
+	require.NoError(t, tr.SetServerURLs(server.URL))
+	assert.NoError(t, tr.SendTransactions(context.Background(), &model.TransactionsPayload{}))
+	assert.Len(t, h.requests, 1)
+}
+
+func TestHTTPTransportClientCertificate(t *testing.T) {
+	var commonNames []string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		commonNames = append(commonNames, req.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+	defer patchEnv("ELASTIC_APM_VERIFY_SERVER_CERT", "false")()
+
+	certPEM, keyPEM := newClientCertificate(t, "agent")
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+	tr, err := transport.NewHTTPTransport(server.URL, "", transport.WithClientCertificate(cert))
+	require.NoError(t, err)
+	assert.NoError(t, tr.SendTransactions(context.Background(), &model.TransactionsPayload{}))
+
+	// Certificate and key files may be specified in the environment,
+	// and the key may be in the certificate file.
+	dir, err := ioutil.TempDir("", "elasticapm-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	certFile := filepath.Join(dir, "agent.pem")
+	require.NoError(t, ioutil.WriteFile(certFile, append(certPEM, keyPEM...), 0600))
+	defer patchEnv("ELASTIC_APM_SERVER_CLIENT_CERT", certFile)()
+	tr, err = transport.NewHTTPTransport(server.URL, "")
+	require.NoError(t, err)
+	assert.NoError(t, tr.SendTransactions(context.Background(), &model.TransactionsPayload{}))
+
+	assert.Equal(t, []string{"agent", "agent"}, commonNames)
+}
+
+func TestHTTPTransportClientCertificateInvalid(t *testing.T) {
+	defer patchEnv("ELASTIC_APM_SERVER_CLIENT_KEY", "key.pem")()
+	_, err := transport.NewHTTPTransport("https://testing.invalid", "")
+	assert.EqualError(t, err, "ELASTIC_APM_SERVER_CLIENT_KEY specified without ELASTIC_APM_SERVER_CLIENT_CERT")
+
+	defer patchEnv("ELASTIC_APM_SERVER_CLIENT_CERT", "testdata/missing.pem")()
+	_, err = transport.NewHTTPTransport("https://testing.invalid", "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to load client certificate")
+}
+
+// newClientCertificate returns a PEM-encoded, self-signed client
+// certificate with the given common name, and its private key.
+func newClientCertificate(t *testing.T, commonName string) (certPEM, keyPEM []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM
+}
+
 func TestHTTPError(t *testing.T) {
 	h := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 		http.Error(w, "error-message", http.StatusInternalServerError)
@@ -188,6 +640,52 @@ func TestHTTPError(t *testing.T) {
 	assert.EqualError(t, err, "SendTransactions failed with 500 Internal Server Error: error-message")
 }
 
+func TestHTTPErrorEvents(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"accepted": 1, "errors": [
+			{"message": "failed to validate transaction: missing name", "document": "{}"},
+			{"message": "event exceeded the permitted size"}
+		]}`))
+	})
+	tr, server := newHTTPTransport(t, h)
+	defer server.Close()
+
+	err := tr.SendTransactions(context.Background(), &model.TransactionsPayload{})
+	assert.EqualError(t, err, "SendTransactions failed with 400 Bad Request (2 events rejected: "+
+		"failed to validate transaction: missing name; event exceeded the permitted size)")
+	httpErr, ok := err.(*transport.HTTPError)
+	require.True(t, ok)
+	assert.Equal(t, 1, httpErr.Accepted)
+	assert.Equal(t, []transport.EventError{
+		{Message: "failed to validate transaction: missing name", Document: "{}"},
+		{Message: "event exceeded the permitted size"},
+	}, httpErr.Errors)
+}
+
+func TestHTTPErrorJSONMessage(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, `{"error": "queue is full"}`, http.StatusServiceUnavailable)
+	})
+	tr, server := newHTTPTransport(t, h)
+	defer server.Close()
+
+	err := tr.SendErrors(context.Background(), &model.ErrorsPayload{})
+	assert.EqualError(t, err, "SendErrors failed with 503 Service Unavailable: queue is full")
+}
+
+func TestHTTPErrorJSONNonIntake(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, `{"message": "bad gateway"}`, http.StatusBadGateway)
+	})
+	tr, server := newHTTPTransport(t, h)
+	defer server.Close()
+
+	err := tr.SendErrors(context.Background(), &model.ErrorsPayload{})
+	assert.EqualError(t, err, `SendErrors failed with 502 Bad Gateway: {"message": "bad gateway"}`)
+}
+
 func TestHTTPTransportSmallUncompressed(t *testing.T) {
 	var h recordingHandler
 	server := httptest.NewServer(&h)
@@ -229,6 +727,92 @@ func TestHTTPTransportLargeCompressed(t *testing.T) {
 	assert.Equal(t, string(jw.Bytes()), decoded.String())
 }
 
+func TestHTTPTransportCompact(t *testing.T) {
+	var h recordingHandler
+	tr, server := newHTTPTransport(t, &h)
+	defer server.Close()
+	tr.SetCompact(true)
+
+	span := model.Span{
+		Name:       "span",
+		Stacktrace: []model.StacktraceFrame{{Function: "main"}},
+	}
+	payload := &model.TransactionsPayload{
+		Service: &model.Service{Name: "service"},
+		Process: &model.Process{Pid: 1},
+		Transactions: []model.Transaction{{
+			Name:    "tx",
+			Context: &model.Context{Tags: map[string]string{"foo": "bar"}},
+			Spans:   []model.Span{span},
+		}},
+	}
+	err := tr.SendTransactions(context.Background(), payload)
+	require.NoError(t, err)
+
+	require.Len(t, h.requests, 1)
+	assert.Equal(t, "application/vnd.elastic.apm.compact+json", h.requests[0].Header.Get("Content-Type"))
+
+	span.Stacktrace = nil
+	var jw fastjson.Writer
+	expected := model.TransactionsPayload{
+		Service:      payload.Service,
+		Transactions: []model.Transaction{{Name: "tx", Spans: []model.Span{span}}},
+	}
+	expected.MarshalFastJSON(&jw)
+	body, err := ioutil.ReadAll(h.requests[0].Body)
+	require.NoError(t, err)
+	assert.Equal(t, string(jw.Bytes()), string(body))
+}
+
+func TestHTTPTransportCompactUnsupported(t *testing.T) {
+	var contentTypes []string
+	h := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		contentTypes = append(contentTypes, req.Header.Get("Content-Type"))
+		if req.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+		}
+	})
+	tr, server := newHTTPTransport(t, h)
+	defer server.Close()
+	tr.SetCompact(true)
+
+	err := tr.SendErrors(context.Background(), &model.ErrorsPayload{})
+	assert.EqualError(t, err, "SendErrors failed with 415 Unsupported Media Type")
+	err = tr.SendErrors(context.Background(), &model.ErrorsPayload{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"application/vnd.elastic.apm.compact+json",
+		"application/json",
+	}, contentTypes)
+}
+
+func TestHTTPTransportServerVersion(t *testing.T) {
+	var requests int
+	h := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		assert.Equal(t, "GET", req.Method)
+		assert.Equal(t, "/", req.URL.Path)
+		w.Write([]byte(`{"build_date":"2022-01-01T00:00:00Z","build_sha":"abc","version":"8.0.0"}`))
+	})
+	tr, server := newHTTPTransport(t, h)
+	defer server.Close()
+
+	for i := 0; i < 2; i++ {
+		version, err := tr.ServerVersion(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "8.0.0", version)
+	}
+	assert.Equal(t, 1, requests) // cached
+}
+
+func TestHTTPTransportServerVersionUnavailable(t *testing.T) {
+	tr, server := newHTTPTransport(t, nopHandler{})
+	defer server.Close()
+
+	_, err := tr.ServerVersion(context.Background())
+	assert.EqualError(t, err, "decoding server information failed: EOF")
+}
+
 func newHTTPTransport(t *testing.T, handler http.Handler) (*transport.HTTPTransport, *httptest.Server) {
 	server := httptest.NewServer(handler)
 	transport, err := transport.NewHTTPTransport(server.URL, "")
@@ -294,3 +878,702 @@ func patchEnv(key, value string) func() {
 		}
 	}
 }
+
+func TestHTTPTransportPayloadDump(t *testing.T) {
+	var h recordingHandler
+	server := httptest.NewServer(&h)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "elasticapm")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	transport, err := transport.NewHTTPTransport(server.URL, "hunter2")
+	require.NoError(t, err)
+	transport.SetPayloadDumpDir(dir)
+
+	payload := &model.TransactionsPayload{
+		Transactions: []model.Transaction{{
+			Name: "name",
+			Context: &model.Context{
+				Custom: model.IfaceMap{
+					{Key: "password", Value: "swordfish"},
+					{Key: "note", Value: "the token is hunter2"},
+				},
+			},
+		}},
+	}
+	transport.SendTransactions(context.Background(), payload)
+	// Payloads sent within a second of the last dump are not dumped.
+	transport.SendErrors(context.Background(), &model.ErrorsPayload{})
+	assert.Len(t, h.requests, 2)
+
+	infos, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, infos, 1)
+	assert.Equal(t, "000001-transactions.json", infos[0].Name())
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, infos[0].Name()))
+	require.NoError(t, err)
+	var dumped struct {
+		Transactions []struct {
+			Name    string
+			Context struct {
+				Custom map[string]string
+			}
+		}
+	}
+	require.NoError(t, json.Unmarshal(data, &dumped))
+	require.Len(t, dumped.Transactions, 1)
+	assert.Equal(t, "name", dumped.Transactions[0].Name)
+	assert.Equal(t, map[string]string{
+		"password": "[REDACTED]",
+		"note":     "the token is [REDACTED]",
+	}, dumped.Transactions[0].Context.Custom)
+}
+
+func TestHTTPTransportPayloadDumpFailure(t *testing.T) {
+	var h recordingHandler
+	server := httptest.NewServer(&h)
+	defer server.Close()
+
+	f, err := ioutil.TempFile("", "elasticapm")
+	require.NoError(t, err)
+	f.Close()
+	defer os.Remove(f.Name())
+
+	// The dump directory cannot be created, as a file exists
+	// at its path, but the payload is still sent.
+	transport, err := transport.NewHTTPTransport(server.URL, "")
+	require.NoError(t, err)
+	transport.SetPayloadDumpDir(f.Name())
+	require.NoError(t, transport.SendErrors(context.Background(), &model.ErrorsPayload{}))
+	assert.Len(t, h.requests, 1)
+	assert.Equal(t, uint64(1), transport.TransportStats().PayloadDumpFailures)
+}
+
+func TestHTTPTransportPayloadRecord(t *testing.T) {
+	var h recordingHandler
+	server := httptest.NewServer(&h)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "elasticapm")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	transport, err := transport.NewHTTPTransport(server.URL, "")
+	require.NoError(t, err)
+	transport.SetPayloadRecordDir(dir, 1)
+
+	payload := &model.TransactionsPayload{
+		Transactions: []model.Transaction{{
+			Name:    "name",
+			Context: &model.Context{Custom: model.IfaceMap{{Key: "password", Value: "swordfish"}}},
+		}},
+	}
+	require.NoError(t, transport.SendTransactions(context.Background(), payload))
+	infos, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, infos, 1)
+	assert.Regexp(t, "^[0-9]{8}T[0-9]{6}-000001-transactions.json$", infos[0].Name())
+
+	// Every request is recorded exactly as sent.
+	data, err := ioutil.ReadFile(filepath.Join(dir, infos[0].Name()))
+	require.NoError(t, err)
+	require.Len(t, h.requests, 1)
+	body, err := ioutil.ReadAll(h.requests[0].Body)
+	require.NoError(t, err)
+	assert.Equal(t, string(body), string(data))
+
+	// The oldest files are removed once the maximum size is exceeded.
+	require.NoError(t, transport.SendErrors(context.Background(), &model.ErrorsPayload{}))
+	infos, err = ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, infos, 1)
+	assert.Regexp(t, "-000002-errors.json$", infos[0].Name())
+	assert.Equal(t, uint64(0), transport.TransportStats().PayloadRecordFailures)
+}
+
+func TestHTTPTransportPayloadRecordFailure(t *testing.T) {
+	var h recordingHandler
+	server := httptest.NewServer(&h)
+	defer server.Close()
+
+	f, err := ioutil.TempFile("", "elasticapm")
+	require.NoError(t, err)
+	f.Close()
+	defer os.Remove(f.Name())
+
+	// The record directory cannot be created, as a file exists
+	// at its path, but the payload is still sent.
+	transport, err := transport.NewHTTPTransport(server.URL, "")
+	require.NoError(t, err)
+	transport.SetPayloadRecordDir(f.Name(), 0)
+	require.NoError(t, transport.SendErrors(context.Background(), &model.ErrorsPayload{}))
+	assert.Len(t, h.requests, 1)
+	assert.Equal(t, uint64(1), transport.TransportStats().PayloadRecordFailures)
+}
+
+func TestHTTPTransportSpool(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	status := http.StatusServiceUnavailable
+	h := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		paths = append(paths, req.URL.Path)
+		w.WriteHeader(status)
+	})
+	tr, server := newHTTPTransport(t, h)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "elasticapm")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, tr.SetSpoolDir(dir, 0))
+
+	// The server is unavailable, so the payloads are spooled.
+	err = tr.SendTransactions(context.Background(), &model.TransactionsPayload{
+		Transactions: []model.Transaction{{}, {}},
+	})
+	assert.Equal(t, &transport.SpooledError{Spooled: 2}, err)
+	tr.SetCompact(true)
+	err = tr.SendMetrics(context.Background(), &model.MetricsPayload{})
+	assert.NoError(t, err)
+	tr.SetCompact(false)
+
+	infos, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, infos, 2)
+	assert.Equal(t, "0000000001-transactions.json", infos[0].Name())
+	assert.Equal(t, "0000000002-metrics-compact.json", infos[1].Name())
+
+	// Spooled payloads are loaded by a new transport using the
+	// same directory, and sent in the background after the next
+	// successful send.
+	tr, err = transport.NewHTTPTransport(server.URL, "")
+	require.NoError(t, err)
+	require.NoError(t, tr.SetSpoolDir(dir, 0))
+	mu.Lock()
+	status = http.StatusAccepted
+	mu.Unlock()
+	err = tr.SendErrors(context.Background(), &model.ErrorsPayload{})
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		infos, err := ioutil.ReadDir(dir)
+		return err == nil && len(infos) == 0
+	}, 10*time.Second, 10*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{
+		"/v1/transactions", "/v1/metrics",
+		"/v1/errors", "/v1/transactions", "/v1/metrics",
+	}, paths)
+}
+
+func TestHTTPTransportSpoolClientError(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	})
+	tr, server := newHTTPTransport(t, h)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "elasticapm")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, tr.SetSpoolDir(dir, 0))
+
+	// Client errors are not retryable, so the payload is not spooled.
+	err = tr.SendErrors(context.Background(), &model.ErrorsPayload{})
+	assert.EqualError(t, err, "SendErrors failed with 400 Bad Request")
+	infos, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, infos, 0)
+}
+
+func TestHTTPTransportSpoolDiscarded(t *testing.T) {
+	var mu sync.Mutex
+	status := http.StatusServiceUnavailable
+	h := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if status == http.StatusServiceUnavailable || req.URL.Path == "/v1/transactions" {
+			w.WriteHeader(status)
+		}
+	})
+	tr, server := newHTTPTransport(t, h)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "elasticapm")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, tr.SetSpoolDir(dir, 0))
+	assert.NoError(t, tr.SendTransactions(context.Background(), &model.TransactionsPayload{}))
+
+	// The spooled payload is rejected with a client error when
+	// it is replayed, so it is discarded.
+	mu.Lock()
+	status = http.StatusBadRequest
+	mu.Unlock()
+	assert.NoError(t, tr.SendErrors(context.Background(), &model.ErrorsPayload{}))
+	assert.Eventually(t, func() bool {
+		return tr.TransportStats().SpoolDiscarded == 1
+	}, 10*time.Second, 10*time.Millisecond)
+	infos, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, infos, 0)
+	assert.Equal(t, uint64(0), tr.TransportStats().SpoolFailures)
+}
+
+func TestHTTPTransportSpoolFailure(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	tr, server := newHTTPTransport(t, h)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "elasticapm")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, tr.SetSpoolDir(dir, 0))
+
+	// Replace the spool directory with a file, so payloads
+	// cannot be written to it.
+	require.NoError(t, os.Remove(dir))
+	require.NoError(t, ioutil.WriteFile(dir, nil, 0600))
+	err = tr.SendErrors(context.Background(), &model.ErrorsPayload{})
+	assert.EqualError(t, err, "SendErrors failed with 503 Service Unavailable")
+	stats := tr.TransportStats()
+	assert.Equal(t, uint64(1), stats.SpoolFailures)
+	assert.Equal(t, uint64(1), stats.PayloadsFailed)
+}
+
+func TestHTTPTransportSpoolFull(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	tr, server := newHTTPTransport(t, h)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "elasticapm")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, tr.SetSpoolDir(dir, 1))
+
+	err = tr.SendErrors(context.Background(), &model.ErrorsPayload{})
+	assert.EqualError(t, err, "SendErrors failed with 503 Service Unavailable")
+}
+
+func TestHTTPTransportEnvSpoolSizeInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "elasticapm")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer patchEnv("ELASTIC_APM_SPOOL_DIR", dir)()
+	defer patchEnv("ELASTIC_APM_SPOOL_SIZE", "lots")()
+
+	_, err = transport.NewHTTPTransport("", "")
+	assert.EqualError(t, err, `failed to parse ELASTIC_APM_SPOOL_SIZE: strconv.ParseInt: parsing "LOTS": invalid syntax`)
+}
+
+func TestHTTPTransportRetry(t *testing.T) {
+	var requests int
+	h := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		if requests < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	})
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	tr, err := transport.NewHTTPTransport(server.URL, "", transport.WithRetryPolicy(transport.RetryPolicy{
+		MaxAttempts:     3,
+		InitialInterval: time.Millisecond,
+	}))
+	require.NoError(t, err)
+	err = tr.SendErrors(context.Background(), &model.ErrorsPayload{})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, requests)
+
+	// Once MaxAttempts is reached, the last error is returned.
+	requests = 0
+	tr.SetRetryPolicy(transport.RetryPolicy{MaxAttempts: 2, InitialInterval: time.Millisecond})
+	err = tr.SendErrors(context.Background(), &model.ErrorsPayload{})
+	assert.EqualError(t, err, "SendErrors failed with 503 Service Unavailable")
+	assert.Equal(t, 2, requests)
+}
+
+func TestHTTPTransportStats(t *testing.T) {
+	var requests int
+	h := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		if requests%3 != 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	})
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	tr, err := transport.NewHTTPTransport(server.URL, "", transport.WithRetryPolicy(transport.RetryPolicy{
+		MaxAttempts:     3,
+		InitialInterval: time.Millisecond,
+	}))
+	require.NoError(t, err)
+	err = tr.SendErrors(context.Background(), &model.ErrorsPayload{})
+	assert.NoError(t, err)
+
+	tr.SetRetryPolicy(transport.RetryPolicy{MaxAttempts: 1})
+	err = tr.SendErrors(context.Background(), &model.ErrorsPayload{})
+	assert.Error(t, err)
+
+	stats := tr.TransportStats()
+	assert.NotZero(t, stats.BytesSent)
+	assert.InDelta(t, 0, stats.ServerClockOffset, float64(2*time.Second))
+	stats.BytesSent = 0
+	stats.ServerClockOffset = 0
+	assert.Equal(t, transport.Stats{
+		Requests:        4,
+		RequestFailures: 3,
+		Retries:         2,
+		PayloadsFailed:  1,
+	}, stats)
+}
+
+func TestHTTPTransportServerClockOffset(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Date", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	})
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	tr, err := transport.NewHTTPTransport(server.URL, "")
+	require.NoError(t, err)
+	assert.Zero(t, tr.TransportStats().ServerClockOffset)
+	require.NoError(t, tr.SendErrors(context.Background(), &model.ErrorsPayload{}))
+	assert.InDelta(t, time.Hour, tr.TransportStats().ServerClockOffset, float64(2*time.Second))
+}
+
+func TestHTTPTransportRetryClientError(t *testing.T) {
+	var requests int
+	h := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusBadRequest)
+	})
+	tr, server := newHTTPTransport(t, h)
+	defer server.Close()
+	tr.SetRetryPolicy(transport.RetryPolicy{MaxAttempts: 3, InitialInterval: time.Millisecond})
+
+	err := tr.SendErrors(context.Background(), &model.ErrorsPayload{})
+	assert.EqualError(t, err, "SendErrors failed with 400 Bad Request")
+	assert.Equal(t, 1, requests)
+}
+
+func TestHTTPTransportRetryContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var requests int
+	h := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	tr, server := newHTTPTransport(t, h)
+	defer server.Close()
+	tr.SetRetryPolicy(transport.RetryPolicy{MaxAttempts: 3, InitialInterval: time.Hour, MaxInterval: time.Hour})
+
+	// Cancel the context once the first response has been
+	// received, while waiting to retry.
+	tr.Client.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		defer cancel()
+		return http.DefaultTransport.RoundTrip(req)
+	})
+
+	err := tr.SendErrors(ctx, &model.ErrorsPayload{})
+	assert.EqualError(t, err, "SendErrors failed with 503 Service Unavailable")
+	assert.Equal(t, 1, requests)
+}
+
+func TestHTTPTransportRetryMaxElapsedTime(t *testing.T) {
+	var requests int
+	h := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	tr, server := newHTTPTransport(t, h)
+	defer server.Close()
+	tr.SetRetryPolicy(transport.RetryPolicy{
+		MaxAttempts:     3,
+		MaxElapsedTime:  time.Minute,
+		InitialInterval: time.Hour,
+		MaxInterval:     time.Hour,
+	})
+
+	err := tr.SendErrors(context.Background(), &model.ErrorsPayload{})
+	assert.EqualError(t, err, "SendErrors failed with 503 Service Unavailable")
+	assert.Equal(t, 1, requests)
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestHTTPTransportEnvSendMaxAttemptsInvalid(t *testing.T) {
+	defer patchEnv("ELASTIC_APM_SEND_MAX_ATTEMPTS", "many")()
+
+	_, err := transport.NewHTTPTransport("", "")
+	assert.EqualError(t, err, `failed to parse ELASTIC_APM_SEND_MAX_ATTEMPTS: strconv.Atoi: parsing "many": invalid syntax`)
+}
+
+func TestHTTPTransportServerFailover(t *testing.T) {
+	var h1, h2 recordingHandler
+	server1 := httptest.NewServer(&h1)
+	defer server1.Close()
+	server2 := httptest.NewServer(&h2)
+	defer server2.Close()
+
+	tr, err := transport.NewHTTPTransport(server1.URL, "")
+	require.NoError(t, err)
+	require.NoError(t, tr.SetServerURLs(server1.URL, server2.URL))
+
+	err = tr.SendTransactions(context.Background(), &model.TransactionsPayload{})
+	assert.NoError(t, err)
+	assert.Len(t, h1.requests, 1)
+	assert.Len(t, h2.requests, 0)
+
+	// Requests to the first server fail with a connection error,
+	// so the payload is sent to the second server instead.
+	var requests []string
+	tr.Client.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		requests = append(requests, req.URL.Host)
+		if req.URL.Host == server1.Listener.Addr().String() {
+			return nil, errors.New("connection refused")
+		}
+		return http.DefaultTransport.RoundTrip(req)
+	})
+	err = tr.SendErrors(context.Background(), &model.ErrorsPayload{})
+	assert.NoError(t, err)
+	assert.Len(t, h2.requests, 1)
+	assert.Equal(t, "/v1/errors", h2.requests[0].URL.Path)
+
+	// The first server is skipped while it is unhealthy.
+	err = tr.SendErrors(context.Background(), &model.ErrorsPayload{})
+	assert.NoError(t, err)
+	assert.Len(t, h2.requests, 2)
+	assert.Equal(t, []string{
+		server1.Listener.Addr().String(),
+		server2.Listener.Addr().String(),
+		server2.Listener.Addr().String(),
+	}, requests)
+	assert.Equal(t, uint64(1), tr.TransportStats().Failovers)
+}
+
+func TestHTTPTransportServerFailoverAllUnhealthy(t *testing.T) {
+	tr, err := transport.NewHTTPTransport("", "")
+	require.NoError(t, err)
+	require.NoError(t, tr.SetServerURLs("http://server1.invalid", "http://server2.invalid"))
+
+	var requests []string
+	tr.Client.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		requests = append(requests, req.URL.Host)
+		return nil, errors.New("connection refused")
+	})
+	err = tr.SendErrors(context.Background(), &model.ErrorsPayload{})
+	assert.Error(t, err)
+
+	// All servers are unhealthy, so they are tried again,
+	// least recently failed first.
+	err = tr.SendErrors(context.Background(), &model.ErrorsPayload{})
+	assert.Error(t, err)
+	assert.Equal(t, []string{
+		"server1.invalid", "server2.invalid",
+		"server1.invalid", "server2.invalid",
+	}, requests)
+	assert.Equal(t, uint64(2), tr.TransportStats().Failovers)
+}
+
+func TestHTTPTransportServerNoFailoverHTTPError(t *testing.T) {
+	var requests int
+	h := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	server1 := httptest.NewServer(h)
+	defer server1.Close()
+	var h2 recordingHandler
+	server2 := httptest.NewServer(&h2)
+	defer server2.Close()
+
+	tr, err := transport.NewHTTPTransport("", "")
+	require.NoError(t, err)
+	require.NoError(t, tr.SetServerURLs(server1.URL, server2.URL))
+	err = tr.SendErrors(context.Background(), &model.ErrorsPayload{})
+	assert.EqualError(t, err, "SendErrors failed with 503 Service Unavailable")
+	assert.Equal(t, 1, requests)
+	assert.Len(t, h2.requests, 0)
+}
+
+func TestHTTPTransportEnvServerURLs(t *testing.T) {
+	var h1, h2 recordingHandler
+	server1 := httptest.NewServer(&h1)
+	defer server1.Close()
+	server2 := httptest.NewServer(&h2)
+	defer server2.Close()
+	defer patchEnv("ELASTIC_APM_SERVER_URL", "http://server.invalid")()
+	defer patchEnv("ELASTIC_APM_SERVER_URLS", server1.URL+", "+server2.URL)()
+
+	tr, err := transport.NewHTTPTransport("", "")
+	require.NoError(t, err)
+	server1.Close()
+
+	err = tr.SendTransactions(context.Background(), &model.TransactionsPayload{})
+	assert.NoError(t, err)
+	assert.Len(t, h1.requests, 0)
+	assert.Len(t, h2.requests, 1)
+}
+
+func TestHTTPTransportSetServerURLsEmpty(t *testing.T) {
+	tr, err := transport.NewHTTPTransport("", "")
+	require.NoError(t, err)
+	assert.EqualError(t, tr.SetServerURLs(), "no server URLs specified")
+}
+
+func TestHTTPTransportUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "elasticapm")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	socketPath := filepath.Join(dir, "apm-server.sock")
+	lis, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Skipf("cannot listen on Unix domain socket: %s", err)
+	}
+	var h recordingHandler
+	server := httptest.NewUnstartedServer(&h)
+	server.Listener.Close()
+	server.Listener = lis
+	server.Start()
+	defer server.Close()
+
+	tr, err := transport.NewHTTPTransport("unix://"+socketPath, "")
+	require.NoError(t, err)
+	err = tr.SendErrors(context.Background(), &model.ErrorsPayload{})
+	assert.NoError(t, err)
+	require.Len(t, h.requests, 1)
+	assert.Equal(t, "/v1/errors", h.requests[0].URL.Path)
+
+	// Unix domain sockets may be used alongside TCP servers.
+	var h2 recordingHandler
+	server2 := httptest.NewServer(&h2)
+	defer server2.Close()
+	require.NoError(t, tr.SetServerURLs(server2.URL, "unix://"+socketPath))
+	err = tr.SendErrors(context.Background(), &model.ErrorsPayload{})
+	assert.NoError(t, err)
+	assert.Len(t, h2.requests, 1)
+}
+
+func TestHTTPTransportUnixSocketInvalid(t *testing.T) {
+	_, err := transport.NewHTTPTransport("unix://", "")
+	assert.EqualError(t, err, "missing socket path in unix server URL")
+
+	tr, err := transport.NewHTTPTransport("http://localhost:8200", "")
+	require.NoError(t, err)
+	err = tr.SetServerURLs("unix:///var/run/apm-server.sock")
+	assert.EqualError(t, err, "unix server URLs require the transport to be created with one")
+}
+
+func TestHTTPTransportProxy(t *testing.T) {
+	var h recordingHandler
+	proxy := httptest.NewServer(&h)
+	defer proxy.Close()
+	proxyURL, err := url.Parse(proxy.URL)
+	require.NoError(t, err)
+	proxyURL.User = url.UserPassword("user", "pass")
+
+	tr, err := transport.NewHTTPTransport("http://apm-server.invalid:8200", "", transport.WithProxy(proxyURL))
+	require.NoError(t, err)
+	err = tr.SendErrors(context.Background(), &model.ErrorsPayload{})
+	assert.NoError(t, err)
+	require.Len(t, h.requests, 1)
+	req := h.requests[0]
+	assert.Equal(t, "http://apm-server.invalid:8200/v1/errors", req.RequestURI)
+	assert.Equal(t, "Basic dXNlcjpwYXNz", req.Header.Get("Proxy-Authorization"))
+}
+
+func TestHTTPTransportProxyConnect(t *testing.T) {
+	var connectRequests []*http.Request
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		connectRequests = append(connectRequests, req)
+		w.WriteHeader(http.StatusProxyAuthRequired)
+	}))
+	defer proxy.Close()
+
+	defer patchEnv("ELASTIC_APM_PROXY_URL", "http://user:pass@"+proxy.Listener.Addr().String())()
+	tr, err := transport.NewHTTPTransport("https://apm-server.invalid:8200", "")
+	require.NoError(t, err)
+	err = tr.SendErrors(context.Background(), &model.ErrorsPayload{})
+	assert.Error(t, err)
+	require.Len(t, connectRequests, 1)
+	req := connectRequests[0]
+	assert.Equal(t, "CONNECT", req.Method)
+	assert.Equal(t, "apm-server.invalid:8200", req.Host)
+	assert.Equal(t, "Basic dXNlcjpwYXNz", req.Header.Get("Proxy-Authorization"))
+}
+
+func TestHTTPTransportEnvProxyURLInvalid(t *testing.T) {
+	defer patchEnv("ELASTIC_APM_PROXY_URL", "ftp://proxy:21")()
+
+	_, err := transport.NewHTTPTransport("", "")
+	assert.EqualError(t, err, `failed to parse ELASTIC_APM_PROXY_URL: unsupported proxy scheme "ftp"`)
+}
+
+func TestHTTPTransportCompressionDeflate(t *testing.T) {
+	var h recordingHandler
+	server := httptest.NewServer(&h)
+	defer server.Close()
+
+	tr, err := transport.NewHTTPTransport(server.URL, "", transport.WithCompression(transport.CompressionDeflate, 1))
+	require.NoError(t, err)
+	payload := &model.TransactionsPayload{
+		Transactions: make([]model.Transaction, 1024),
+	}
+	err = tr.SendTransactions(context.Background(), payload)
+	assert.NoError(t, err)
+
+	require.Len(t, h.requests, 1)
+	assert.Equal(t, "deflate", h.requests[0].Header.Get("Content-Encoding"))
+
+	var jw fastjson.Writer
+	payload.MarshalFastJSON(&jw)
+	r, err := zlib.NewReader(h.requests[0].Body)
+	require.NoError(t, err)
+	defer r.Close()
+	decoded, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, string(jw.Bytes()), string(decoded))
+}
+
+func TestHTTPTransportCompressionDisabled(t *testing.T) {
+	var h recordingHandler
+	server := httptest.NewServer(&h)
+	defer server.Close()
+	defer patchEnv("ELASTIC_APM_COMPRESSION_LEVEL", "0")()
+
+	tr, err := transport.NewHTTPTransport(server.URL, "")
+	require.NoError(t, err)
+	err = tr.SendTransactions(context.Background(), &model.TransactionsPayload{
+		Transactions: make([]model.Transaction, 1024),
+	})
+	assert.NoError(t, err)
+	require.Len(t, h.requests, 1)
+	assert.Equal(t, "", h.requests[0].Header.Get("Content-Encoding"))
+}
+
+func TestHTTPTransportCompressionInvalid(t *testing.T) {
+	_, err := transport.NewHTTPTransport("", "", transport.WithCompression("zstd", 1))
+	assert.EqualError(t, err, `unsupported compression "zstd"`)
+
+	defer patchEnv("ELASTIC_APM_COMPRESSION", "deflate")()
+	defer patchEnv("ELASTIC_APM_COMPRESSION_LEVEL", "10")()
+	_, err = transport.NewHTTPTransport("", "")
+	assert.EqualError(t, err, "failed to parse ELASTIC_APM_COMPRESSION_LEVEL: invalid compression level 10")
+}
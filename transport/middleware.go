@@ -0,0 +1,95 @@
+package transport
+
+import (
+	"context"
+)
+
+// Middleware wraps a Transport, returning a Transport which may add
+// behaviour around the wrapped transport's methods, such as request
+// signing, auditing, or custom telemetry.
+//
+// The simplest way to implement middleware is with a struct type
+// embedding the next Transport, overriding only the methods of
+// interest:
+//
+//	type auditTransport struct {
+//		transport.Transport
+//	}
+//
+//	func (t auditTransport) SendErrors(ctx context.Context, p *model.ErrorsPayload) error {
+//		err := t.Transport.SendErrors(ctx, p)
+//		audit(len(p.Errors), err)
+//		return err
+//	}
+//
+//	tracer.Transport = transport.Wrap(tracer.Transport, func(next transport.Transport) transport.Transport {
+//		return auditTransport{next}
+//	})
+type Middleware func(next Transport) Transport
+
+// Wrap returns t wrapped with the given middleware. The first
+// middleware is the outermost, so it is called first and returns
+// last.
+//
+// If t implements ServerVersioner or StatsReporter, then so does
+// the returned Transport, even if the middleware does not; calls
+// to those methods are passed directly to t.
+func Wrap(t Transport, middleware ...Middleware) Transport {
+	wrapped := t
+	for i := len(middleware) - 1; i >= 0; i-- {
+		wrapped = middleware[i](wrapped)
+	}
+	versioner, wrappedVersioner := wrapped.(ServerVersioner)
+	if !wrappedVersioner {
+		versioner, _ = t.(ServerVersioner)
+	}
+	reporter, wrappedReporter := wrapped.(StatsReporter)
+	if !wrappedReporter {
+		reporter, _ = t.(StatsReporter)
+	}
+	switch {
+	case (wrappedVersioner || versioner == nil) && (wrappedReporter || reporter == nil):
+		return wrapped
+	case reporter == nil:
+		return versionedTransport{Transport: wrapped, versioner: versioner}
+	case versioner == nil:
+		return statsTransport{Transport: wrapped, reporter: reporter}
+	}
+	return versionedStatsTransport{
+		versionedTransport: versionedTransport{Transport: wrapped, versioner: versioner},
+		reporter:           reporter,
+	}
+}
+
+// versionedTransport is a Transport which passes
+// ServerVersion calls to another ServerVersioner.
+type versionedTransport struct {
+	Transport
+	versioner ServerVersioner
+}
+
+func (t versionedTransport) ServerVersion(ctx context.Context) (string, error) {
+	return t.versioner.ServerVersion(ctx)
+}
+
+// statsTransport is a Transport which passes
+// TransportStats calls to another StatsReporter.
+type statsTransport struct {
+	Transport
+	reporter StatsReporter
+}
+
+func (t statsTransport) TransportStats() Stats {
+	return t.reporter.TransportStats()
+}
+
+// versionedStatsTransport is a versionedTransport which also
+// passes TransportStats calls to another StatsReporter.
+type versionedStatsTransport struct {
+	versionedTransport
+	reporter StatsReporter
+}
+
+func (t versionedStatsTransport) TransportStats() Stats {
+	return t.reporter.TransportStats()
+}
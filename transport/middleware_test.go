@@ -0,0 +1,87 @@
+package transport_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go/model"
+	"github.com/elastic/apm-agent-go/transport"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestWrap(t *testing.T) {
+	var calls []string
+	middleware := func(name string) transport.Middleware {
+		return func(next transport.Transport) transport.Transport {
+			return recordingTransport{Transport: next, name: name, calls: &calls}
+		}
+	}
+	var recorder transporttest.RecorderTransport
+	tr := transport.Wrap(&recorder, middleware("outer"), middleware("inner"))
+
+	err := tr.SendErrors(context.Background(), &model.ErrorsPayload{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"outer", "inner"}, calls)
+	assert.Len(t, recorder.Payloads(), 1)
+
+	// recordingTransport only overrides SendErrors.
+	err = tr.SendTransactions(context.Background(), &model.TransactionsPayload{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"outer", "inner"}, calls)
+	assert.Len(t, recorder.Payloads(), 2)
+
+	_, ok := tr.(transport.ServerVersioner)
+	assert.False(t, ok)
+}
+
+func TestWrapServerVersioner(t *testing.T) {
+	tr := transport.Wrap(versionTransport{transport.Discard}, func(next transport.Transport) transport.Transport {
+		return recordingTransport{Transport: next, calls: new([]string)}
+	})
+	versioner, ok := tr.(transport.ServerVersioner)
+	require.True(t, ok)
+	version, err := versioner.ServerVersion(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "6.5.0", version)
+}
+
+func TestWrapStatsReporter(t *testing.T) {
+	tr := transport.Wrap(versionStatsTransport{versionTransport{transport.Discard}}, func(next transport.Transport) transport.Transport {
+		return recordingTransport{Transport: next, calls: new([]string)}
+	})
+	_, ok := tr.(transport.ServerVersioner)
+	assert.True(t, ok)
+	reporter, ok := tr.(transport.StatsReporter)
+	require.True(t, ok)
+	assert.Equal(t, transport.Stats{Requests: 1}, reporter.TransportStats())
+}
+
+type recordingTransport struct {
+	transport.Transport
+	name  string
+	calls *[]string
+}
+
+func (t recordingTransport) SendErrors(ctx context.Context, p *model.ErrorsPayload) error {
+	*t.calls = append(*t.calls, t.name)
+	return t.Transport.SendErrors(ctx, p)
+}
+
+type versionTransport struct {
+	transport.Transport
+}
+
+func (versionTransport) ServerVersion(context.Context) (string, error) {
+	return "6.5.0", nil
+}
+
+type versionStatsTransport struct {
+	versionTransport
+}
+
+func (versionStatsTransport) TransportStats() transport.Stats {
+	return transport.Stats{Requests: 1}
+}
@@ -0,0 +1,9 @@
+// Package otlp provides a transport.Transport which exports data over
+// OTLP/gRPC, enabling the agent to send directly to OpenTelemetry
+// collectors without an Elastic APM server.
+//
+// Transactions and their spans are exported as OTLP spans, with the
+// transaction ID as the trace ID. Errors are exported as OTLP log
+// records, correlated with their transaction, and metrics as OTLP
+// gauges, cumulative sums, and summaries.
+package otlp
@@ -0,0 +1,103 @@
+package otlp
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+
+	"github.com/elastic/apm-agent-go/model"
+)
+
+func errorsResourceLogs(p *model.ErrorsPayload) []*logspb.ResourceLogs {
+	records := make([]*logspb.LogRecord, len(p.Errors))
+	for i, e := range p.Errors {
+		records[i] = newLogRecord(e)
+	}
+	return []*logspb.ResourceLogs{{
+		Resource: newResource(p.Service, p.Process, p.System),
+		ScopeLogs: []*logspb.ScopeLogs{{
+			Scope:      newScope(p.Service),
+			LogRecords: records,
+		}},
+	}}
+}
+
+// newLogRecord returns an OTLP log record for the error, following
+// the semantic conventions for exceptions. If the error is related
+// to a transaction, the record refers to the transaction's span.
+func newLogRecord(e *model.Error) *logspb.LogRecord {
+	var attrs attributes
+	attrs.addString("error.id", e.ID)
+	attrs.addString("error.culprit", e.Culprit)
+
+	message := e.Log.Message
+	severityText := strings.ToUpper(e.Log.Level)
+	stacktrace := e.Log.Stacktrace
+	if e.Exception.Message != "" || e.Exception.Type != "" {
+		message = e.Exception.Message
+		stacktrace = e.Exception.Stacktrace
+		attrs.addString("exception.type", exceptionType(e.Exception))
+		attrs.addString("exception.message", e.Exception.Message)
+		if e.Exception.Code.String != "" {
+			attrs.addString("error.code", e.Exception.Code.String)
+		} else if e.Exception.Code.Number != 0 {
+			attrs.addString("error.code", strconv.FormatFloat(e.Exception.Code.Number, 'f', -1, 64))
+		}
+	}
+	if len(stacktrace) > 0 {
+		attrs.addString("exception.stacktrace", formatStacktrace(stacktrace))
+	}
+	if e.Context != nil {
+		addContextAttributes(&attrs, e.Context)
+	}
+	if severityText == "" {
+		severityText = "ERROR"
+	}
+
+	record := &logspb.LogRecord{
+		TimeUnixNano:   unixNano(e.Timestamp),
+		SeverityNumber: logspb.SeverityNumber_SEVERITY_NUMBER_ERROR,
+		SeverityText:   severityText,
+		Body:           &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: message}},
+		Attributes:     attrs,
+	}
+	if e.Transaction.ID != (model.UUID{}) {
+		record.TraceId = e.Transaction.ID[:]
+		record.SpanId = transactionSpanID(e.Transaction.ID)
+	}
+	return record
+}
+
+// exceptionType returns the fully qualified type of the exception.
+func exceptionType(e model.Exception) string {
+	if e.Module == "" {
+		return e.Type
+	}
+	return e.Module + "." + e.Type
+}
+
+// formatStacktrace formats the frames in the style
+// of a Go panic's stack trace.
+func formatStacktrace(frames []model.StacktraceFrame) string {
+	var buf bytes.Buffer
+	for _, f := range frames {
+		if f.Module != "" {
+			buf.WriteString(f.Module)
+			buf.WriteByte('.')
+		}
+		buf.WriteString(f.Function)
+		buf.WriteString("\n\t")
+		if f.AbsolutePath != "" {
+			buf.WriteString(f.AbsolutePath)
+		} else {
+			buf.WriteString(f.File)
+		}
+		buf.WriteByte(':')
+		buf.WriteString(strconv.Itoa(f.Line))
+		buf.WriteByte('\n')
+	}
+	return buf.String()
+}
@@ -0,0 +1,89 @@
+package otlp
+
+import (
+	"sort"
+
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+
+	"github.com/elastic/apm-agent-go/model"
+)
+
+func metricsResourceMetrics(p *model.MetricsPayload) []*metricspb.ResourceMetrics {
+	var metrics []*metricspb.Metric
+	for _, m := range p.Metrics {
+		metrics = appendMetrics(metrics, m)
+	}
+	return []*metricspb.ResourceMetrics{{
+		Resource: newResource(p.Service, p.Process, p.System),
+		ScopeMetrics: []*metricspb.ScopeMetrics{{
+			Scope:   newScope(p.Service),
+			Metrics: metrics,
+		}},
+	}}
+}
+
+// appendMetrics appends an OTLP metric for each of the samples in m
+// to out, returning the extended slice. Gauges are exported as OTLP
+// gauges, counters as cumulative monotonic sums, and summaries as
+// OTLP summaries. Samples of other types, or without values, are
+// ignored.
+func appendMetrics(out []*metricspb.Metric, m *model.Metrics) []*metricspb.Metric {
+	var attrs attributes
+	attrs.addStringMap(m.Labels)
+	timestamp := unixNano(m.Timestamp)
+
+	names := make([]string, 0, len(m.Samples))
+	for name := range m.Samples {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		sample := m.Samples[name]
+		metric := &metricspb.Metric{Name: name, Unit: sample.Unit}
+		switch sample.Type {
+		case "gauge", "counter":
+			if sample.Value == nil {
+				continue
+			}
+			points := []*metricspb.NumberDataPoint{{
+				Attributes:   attrs,
+				TimeUnixNano: timestamp,
+				Value:        &metricspb.NumberDataPoint_AsDouble{AsDouble: *sample.Value},
+			}}
+			if sample.Type == "gauge" {
+				metric.Data = &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{DataPoints: points}}
+			} else {
+				metric.Data = &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+					DataPoints:             points,
+					AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+					IsMonotonic:            true,
+				}}
+			}
+		case "summary":
+			if sample.Count == nil {
+				continue
+			}
+			point := &metricspb.SummaryDataPoint{
+				Attributes:   attrs,
+				TimeUnixNano: timestamp,
+				Count:        *sample.Count,
+			}
+			if sample.Sum != nil {
+				point.Sum = *sample.Sum
+			}
+			for _, q := range sample.Quantiles {
+				point.QuantileValues = append(point.QuantileValues, &metricspb.SummaryDataPoint_ValueAtQuantile{
+					Quantile: q.Quantile,
+					Value:    q.Value,
+				})
+			}
+			metric.Data = &metricspb.Metric_Summary{Summary: &metricspb.Summary{
+				DataPoints: []*metricspb.SummaryDataPoint{point},
+			}}
+		default:
+			continue
+		}
+		out = append(out, metric)
+	}
+	return out
+}
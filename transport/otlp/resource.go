@@ -0,0 +1,96 @@
+package otlp
+
+import (
+	"time"
+
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+
+	"github.com/elastic/apm-agent-go/model"
+)
+
+// scopeName is the name of the instrumentation scope
+// with which all data is exported.
+const scopeName = "github.com/elastic/apm-agent-go"
+
+// newResource returns the OTLP resource describing the
+// service, process, and system of a payload.
+func newResource(service *model.Service, process *model.Process, system *model.System) *resourcepb.Resource {
+	var attrs attributes
+	if service != nil {
+		attrs.addString("service.name", service.Name)
+		attrs.addString("service.version", service.Version)
+		attrs.addString("deployment.environment.name", service.Environment)
+		attrs.addString("telemetry.sdk.name", "elastic-apm-agent-go")
+		attrs.addString("telemetry.sdk.language", "go")
+		attrs.addString("telemetry.sdk.version", service.Agent.Version)
+	}
+	if process != nil {
+		attrs.addInt("process.pid", int64(process.Pid))
+		if process.Ppid != nil {
+			attrs.addInt("process.parent_pid", int64(*process.Ppid))
+		}
+		attrs.addString("process.executable.name", process.Title)
+	}
+	if system != nil {
+		attrs.addString("host.name", system.Hostname)
+		attrs.addString("host.arch", system.Architecture)
+		attrs.addString("os.type", system.Platform)
+	}
+	return &resourcepb.Resource{Attributes: attrs}
+}
+
+// newScope returns the instrumentation scope for a payload.
+func newScope(service *model.Service) *commonpb.InstrumentationScope {
+	scope := &commonpb.InstrumentationScope{Name: scopeName}
+	if service != nil {
+		scope.Version = service.Agent.Version
+	}
+	return scope
+}
+
+// attributes is a list of OTLP attributes.
+type attributes []*commonpb.KeyValue
+
+// addString adds a string attribute, if value is non-empty.
+func (attrs *attributes) addString(key, value string) {
+	if value == "" {
+		return
+	}
+	*attrs = append(*attrs, &commonpb.KeyValue{
+		Key:   key,
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}},
+	})
+}
+
+// addInt adds an integer attribute.
+func (attrs *attributes) addInt(key string, value int64) {
+	*attrs = append(*attrs, &commonpb.KeyValue{
+		Key:   key,
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: value}},
+	})
+}
+
+// addTags adds the tags as string attributes.
+func (attrs *attributes) addTags(tags map[string]string) {
+	for k, v := range tags {
+		attrs.addString(k, v)
+	}
+}
+
+// addStringMap adds the map's items as string attributes.
+func (attrs *attributes) addStringMap(m model.StringMap) {
+	for _, item := range m {
+		attrs.addString(item.Key, item.Value)
+	}
+}
+
+// unixNano returns t as nanoseconds since the Unix epoch.
+func unixNano(t model.Time) uint64 {
+	return uint64(time.Time(t).UnixNano())
+}
+
+// millis returns the duration for a number of milliseconds.
+func millis(ms float64) time.Duration {
+	return time.Duration(ms * float64(time.Millisecond))
+}
@@ -0,0 +1,193 @@
+package otlp
+
+import (
+	"encoding/binary"
+	"strconv"
+	"strings"
+	"time"
+
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+
+	"github.com/elastic/apm-agent-go/model"
+)
+
+func transactionsResourceSpans(p *model.TransactionsPayload) []*tracepb.ResourceSpans {
+	var spans []*tracepb.Span
+	for i := range p.Transactions {
+		spans = appendTransactionSpans(spans, &p.Transactions[i])
+	}
+	return []*tracepb.ResourceSpans{{
+		Resource: newResource(p.Service, p.Process, p.System),
+		ScopeSpans: []*tracepb.ScopeSpans{{
+			Scope: newScope(p.Service),
+			Spans: spans,
+		}},
+	}}
+}
+
+// appendTransactionSpans appends the OTLP spans for the transaction
+// and its spans to out, returning the extended slice.
+//
+// Transactions have no trace ID, so the transaction ID is used as the
+// trace ID. The transaction's span ID is taken from the latter half of
+// its ID, and the span IDs of its spans are derived from that and their
+// index within the transaction.
+func appendTransactionSpans(out []*tracepb.Span, tx *model.Transaction) []*tracepb.Span {
+	traceID := tx.ID[:]
+	txSpanID := transactionSpanID(tx.ID)
+	start := time.Time(tx.Timestamp)
+	end := start.Add(millis(tx.Duration))
+
+	var attrs attributes
+	attrs.addString("transaction.type", tx.Type)
+	attrs.addString("transaction.result", tx.Result)
+	if tx.SpanCount.Dropped.Total > 0 {
+		attrs.addInt("span_count.dropped", int64(tx.SpanCount.Dropped.Total))
+	}
+	status := &tracepb.Status{}
+	if tx.Context != nil {
+		addContextAttributes(&attrs, tx.Context)
+		if tx.Context.Response != nil && tx.Context.Response.StatusCode >= 500 {
+			status.Code = tracepb.Status_STATUS_CODE_ERROR
+		}
+	}
+
+	var events []*tracepb.Span_Event
+	for group, marks := range tx.Marks {
+		for name, offset := range marks {
+			events = append(events, &tracepb.Span_Event{
+				Name:         group + "." + name,
+				TimeUnixNano: uint64(start.Add(millis(offset)).UnixNano()),
+			})
+		}
+	}
+
+	out = append(out, &tracepb.Span{
+		TraceId:           traceID,
+		SpanId:            txSpanID,
+		Name:              tx.Name,
+		Kind:              transactionSpanKind(tx.Type),
+		StartTimeUnixNano: uint64(start.UnixNano()),
+		EndTimeUnixNano:   uint64(end.UnixNano()),
+		Attributes:        attrs,
+		Events:            events,
+		Status:            status,
+	})
+	for i := range tx.Spans {
+		out = append(out, newSpan(traceID, txSpanID, start, &tx.Spans[i], i))
+	}
+	return out
+}
+
+func newSpan(traceID, txSpanID []byte, txStart time.Time, span *model.Span, index int) *tracepb.Span {
+	id := int64(index)
+	if span.ID != nil {
+		id = *span.ID
+	}
+	parentSpanID := txSpanID
+	if span.Parent != nil {
+		parentSpanID = spanID(txSpanID, *span.Parent)
+	}
+	start := txStart.Add(millis(span.Start))
+	end := start.Add(millis(span.Duration))
+
+	var attrs attributes
+	attrs.addString("span.type", span.Type)
+	kind := tracepb.Span_SPAN_KIND_INTERNAL
+	status := &tracepb.Status{}
+	if ctx := span.Context; ctx != nil {
+		if ctx.Database != nil {
+			kind = tracepb.Span_SPAN_KIND_CLIENT
+			attrs.addString("db.system", ctx.Database.Type)
+			attrs.addString("db.namespace", ctx.Database.Instance)
+			attrs.addString("db.query.text", ctx.Database.Statement)
+		}
+		if ctx.HTTP != nil {
+			kind = tracepb.Span_SPAN_KIND_CLIENT
+			attrs.addString("url.full", ctx.HTTP.URL)
+			if ctx.HTTP.StatusCode != 0 {
+				attrs.addInt("http.response.status_code", int64(ctx.HTTP.StatusCode))
+				if ctx.HTTP.StatusCode >= 400 {
+					status.Code = tracepb.Status_STATUS_CODE_ERROR
+				}
+			}
+		}
+		if ctx.Service != nil && ctx.Service.Target != nil {
+			kind = tracepb.Span_SPAN_KIND_CLIENT
+			attrs.addString("service.target.type", ctx.Service.Target.Type)
+			attrs.addString("service.target.name", ctx.Service.Target.Name)
+		}
+		if ctx.Destination != nil && ctx.Destination.Service != nil {
+			kind = tracepb.Span_SPAN_KIND_CLIENT
+			attrs.addString("span.destination.service.resource", ctx.Destination.Service.Resource)
+		}
+		attrs.addTags(ctx.Tags)
+	}
+	return &tracepb.Span{
+		TraceId:           traceID,
+		SpanId:            spanID(txSpanID, id),
+		ParentSpanId:      parentSpanID,
+		Name:              span.Name,
+		Kind:              kind,
+		StartTimeUnixNano: uint64(start.UnixNano()),
+		EndTimeUnixNano:   uint64(end.UnixNano()),
+		Attributes:        attrs,
+		Status:            status,
+	}
+}
+
+// addContextAttributes adds attributes for the transaction
+// or error context's request, response, user, and tags.
+func addContextAttributes(attrs *attributes, ctx *model.Context) {
+	if req := ctx.Request; req != nil {
+		attrs.addString("http.request.method", req.Method)
+		attrs.addString("url.full", req.URL.Full)
+		if req.Headers != nil {
+			attrs.addString("user_agent.original", req.Headers.UserAgent)
+		}
+		if req.Socket != nil {
+			attrs.addString("client.address", req.Socket.RemoteAddress)
+		}
+	}
+	if resp := ctx.Response; resp != nil && resp.StatusCode != 0 {
+		attrs.addInt("http.response.status_code", int64(resp.StatusCode))
+	}
+	if user := ctx.User; user != nil {
+		if user.ID.String != "" {
+			attrs.addString("user.id", user.ID.String)
+		} else if user.ID.Number != 0 {
+			attrs.addString("user.id", strconv.FormatFloat(user.ID.Number, 'f', -1, 64))
+		}
+		attrs.addString("user.name", user.Username)
+		attrs.addString("user.email", user.Email)
+	}
+	attrs.addTags(ctx.Tags)
+}
+
+func transactionSpanKind(transactionType string) tracepb.Span_SpanKind {
+	switch {
+	case transactionType == "request":
+		return tracepb.Span_SPAN_KIND_SERVER
+	case transactionType == "messaging", strings.HasPrefix(transactionType, "messaging."):
+		return tracepb.Span_SPAN_KIND_CONSUMER
+	}
+	return tracepb.Span_SPAN_KIND_INTERNAL
+}
+
+// transactionSpanID returns the span ID for the transaction
+// with the given ID.
+func transactionSpanID(id model.UUID) []byte {
+	out := make([]byte, 8)
+	copy(out, id[8:])
+	return out
+}
+
+// spanID returns the span ID for the span with the given ID
+// within the transaction with the given span ID. Distinct
+// span IDs within a transaction produce distinct span IDs,
+// none of which are equal to the transaction's span ID.
+func spanID(txSpanID []byte, id int64) []byte {
+	out := make([]byte, 8)
+	binary.BigEndian.PutUint64(out, binary.BigEndian.Uint64(txSpanID)^uint64(id+1))
+	return out
+}
@@ -0,0 +1,113 @@
+package otlp
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/elastic/apm-agent-go/model"
+)
+
+// Transport is an implementation of transport.Transport, exporting
+// transactions and spans as OTLP spans, errors as OTLP log records,
+// and metrics as OTLP metrics, over gRPC.
+type Transport struct {
+	traces  coltracepb.TraceServiceClient
+	logs    collogspb.LogsServiceClient
+	metrics colmetricspb.MetricsServiceClient
+	headers metadata.MD
+}
+
+// NewTransport returns a new Transport which exports to the OTLP/gRPC
+// endpoint, such as an OpenTelemetry collector, at the other end of
+// conn. The caller is responsible for dialing the endpoint with the
+// appropriate transport credentials, and for closing conn once the
+// tracer using the Transport has been closed.
+func NewTransport(conn *grpc.ClientConn, o ...Option) *Transport {
+	var opts options
+	for _, o := range o {
+		o(&opts)
+	}
+	t := &Transport{
+		traces:  coltracepb.NewTraceServiceClient(conn),
+		logs:    collogspb.NewLogsServiceClient(conn),
+		metrics: colmetricspb.NewMetricsServiceClient(conn),
+	}
+	if len(opts.headers) != 0 {
+		t.headers = metadata.New(opts.headers)
+	}
+	return t
+}
+
+// Option sets options for a Transport.
+type Option func(*options)
+
+type options struct {
+	headers map[string]string
+}
+
+// WithHeaders returns an Option which sets gRPC metadata to send with
+// each export request, e.g. for authenticating with the endpoint.
+func WithHeaders(headers map[string]string) Option {
+	return func(o *options) {
+		o.headers = headers
+	}
+}
+
+// SendTransactions exports the transactions, and their spans, as
+// OTLP spans.
+func (t *Transport) SendTransactions(ctx context.Context, p *model.TransactionsPayload) error {
+	req := &coltracepb.ExportTraceServiceRequest{
+		ResourceSpans: transactionsResourceSpans(p),
+	}
+	resp, err := t.traces.Export(t.outgoingContext(ctx), req)
+	if err != nil {
+		return errors.Wrap(err, "failed to export spans")
+	}
+	if ps := resp.GetPartialSuccess(); ps.GetRejectedSpans() > 0 {
+		return errors.Errorf("%d spans rejected: %s", ps.GetRejectedSpans(), ps.GetErrorMessage())
+	}
+	return nil
+}
+
+// SendErrors exports the errors as OTLP log records.
+func (t *Transport) SendErrors(ctx context.Context, p *model.ErrorsPayload) error {
+	req := &collogspb.ExportLogsServiceRequest{
+		ResourceLogs: errorsResourceLogs(p),
+	}
+	resp, err := t.logs.Export(t.outgoingContext(ctx), req)
+	if err != nil {
+		return errors.Wrap(err, "failed to export log records")
+	}
+	if ps := resp.GetPartialSuccess(); ps.GetRejectedLogRecords() > 0 {
+		return errors.Errorf("%d log records rejected: %s", ps.GetRejectedLogRecords(), ps.GetErrorMessage())
+	}
+	return nil
+}
+
+// SendMetrics exports the metrics as OTLP metrics.
+func (t *Transport) SendMetrics(ctx context.Context, p *model.MetricsPayload) error {
+	req := &colmetricspb.ExportMetricsServiceRequest{
+		ResourceMetrics: metricsResourceMetrics(p),
+	}
+	resp, err := t.metrics.Export(t.outgoingContext(ctx), req)
+	if err != nil {
+		return errors.Wrap(err, "failed to export metrics")
+	}
+	if ps := resp.GetPartialSuccess(); ps.GetRejectedDataPoints() > 0 {
+		return errors.Errorf("%d data points rejected: %s", ps.GetRejectedDataPoints(), ps.GetErrorMessage())
+	}
+	return nil
+}
+
+func (t *Transport) outgoingContext(ctx context.Context) context.Context {
+	if t.headers == nil {
+		return ctx
+	}
+	return metadata.NewOutgoingContext(ctx, t.headers)
+}
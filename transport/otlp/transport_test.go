@@ -0,0 +1,229 @@
+package otlp_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/model"
+	"github.com/elastic/apm-agent-go/transport/otlp"
+)
+
+func TestTransportTransactions(t *testing.T) {
+	collector, conn := newCollector(t)
+	defer collector.server.Stop()
+	defer conn.Close()
+
+	tracer, err := elasticapm.NewTracer("otlp_testing", "1.0")
+	require.NoError(t, err)
+	defer tracer.Close()
+	tracer.Transport = otlp.NewTransport(conn, otlp.WithHeaders(map[string]string{"authorization": "secret"}))
+
+	tx := tracer.StartTransaction("GET /", "request")
+	tx.Context.SetTag("tier", "gold")
+	span := tx.StartSpan("SELECT FROM foo", "db.postgresql.query", nil)
+	span.Context.SetDatabase(elasticapm.DatabaseSpanContext{Type: "postgresql", Statement: "SELECT FROM foo"})
+	child := tx.StartSpan("child", "custom", span)
+	child.End()
+	span.End()
+	e := tracer.NewError(errors.New("boom"))
+	e.Transaction = tx
+	e.Send()
+	tx.End()
+	tracer.Flush(nil)
+
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	require.Len(t, collector.traces, 1)
+	assert.Equal(t, []string{"secret"}, collector.authorization)
+
+	rs := collector.traces[0].ResourceSpans[0]
+	assert.Contains(t, rs.Resource.Attributes, stringAttr("service.name", "otlp_testing"))
+	assert.Contains(t, rs.Resource.Attributes, stringAttr("service.version", "1.0"))
+	spans := rs.ScopeSpans[0].Spans
+	require.Len(t, spans, 3)
+
+	txSpan, dbSpan, childSpan := spans[0], spans[1], spans[2]
+	assert.Equal(t, "GET /", txSpan.Name)
+	assert.Equal(t, tracepb.Span_SPAN_KIND_SERVER, txSpan.Kind)
+	assert.Len(t, txSpan.TraceId, 16)
+	assert.Len(t, txSpan.SpanId, 8)
+	assert.Empty(t, txSpan.ParentSpanId)
+	assert.Contains(t, txSpan.Attributes, stringAttr("tier", "gold"))
+
+	assert.Equal(t, "SELECT FROM foo", dbSpan.Name)
+	assert.Equal(t, tracepb.Span_SPAN_KIND_CLIENT, dbSpan.Kind)
+	assert.Equal(t, txSpan.TraceId, dbSpan.TraceId)
+	assert.Equal(t, txSpan.SpanId, dbSpan.ParentSpanId)
+	assert.NotEqual(t, txSpan.SpanId, dbSpan.SpanId)
+	assert.Contains(t, dbSpan.Attributes, stringAttr("db.system", "postgresql"))
+	assert.Contains(t, dbSpan.Attributes, stringAttr("db.query.text", "SELECT FROM foo"))
+	assert.True(t, dbSpan.EndTimeUnixNano >= dbSpan.StartTimeUnixNano)
+
+	assert.Equal(t, tracepb.Span_SPAN_KIND_INTERNAL, childSpan.Kind)
+	assert.Equal(t, dbSpan.SpanId, childSpan.ParentSpanId)
+	assert.NotEqual(t, dbSpan.SpanId, childSpan.SpanId)
+
+	require.Len(t, collector.logs, 1)
+	record := collector.logs[0].ResourceLogs[0].ScopeLogs[0].LogRecords[0]
+	assert.Equal(t, "boom", record.Body.GetStringValue())
+	assert.Contains(t, record.Attributes, stringAttr("exception.message", "boom"))
+	assert.Contains(t, record.Attributes, stringAttr("exception.type", "errors.errorString"))
+	assert.Equal(t, txSpan.TraceId, record.TraceId)
+	assert.Equal(t, txSpan.SpanId, record.SpanId)
+}
+
+func TestTransportMetrics(t *testing.T) {
+	collector, conn := newCollector(t)
+	defer collector.server.Stop()
+	defer conn.Close()
+	transport := otlp.NewTransport(conn)
+
+	value := 1.5
+	count := uint64(3)
+	sum := 4.5
+	err := transport.SendMetrics(context.Background(), &model.MetricsPayload{
+		Service: &model.Service{Name: "otlp_testing"},
+		Metrics: []*model.Metrics{{
+			Timestamp: model.Time(time.Unix(123, 0)),
+			Labels:    model.StringMap{{Key: "k", Value: "v"}},
+			Samples: map[string]model.Metric{
+				"a_gauge":   {Type: "gauge", Value: &value},
+				"b_counter": {Type: "counter", Unit: "byte", Value: &value},
+				"c_summary": {Type: "summary", Count: &count, Sum: &sum, Quantiles: []model.Quantile{{Quantile: 0.5, Value: 1}}},
+			},
+		}},
+	})
+	require.NoError(t, err)
+
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	require.Len(t, collector.metrics, 1)
+	metrics := collector.metrics[0].ResourceMetrics[0].ScopeMetrics[0].Metrics
+	require.Len(t, metrics, 3)
+
+	gauge := metrics[0].GetGauge().DataPoints[0]
+	assert.Equal(t, 1.5, gauge.GetAsDouble())
+	assert.Equal(t, uint64(123e9), gauge.TimeUnixNano)
+	assert.Contains(t, gauge.Attributes, stringAttr("k", "v"))
+
+	assert.Equal(t, "byte", metrics[1].Unit)
+	assert.True(t, metrics[1].GetSum().IsMonotonic)
+	assert.Equal(t, 1.5, metrics[1].GetSum().DataPoints[0].GetAsDouble())
+
+	summary := metrics[2].GetSummary().DataPoints[0]
+	assert.Equal(t, uint64(3), summary.Count)
+	assert.Equal(t, 4.5, summary.Sum)
+	require.Len(t, summary.QuantileValues, 1)
+	assert.Equal(t, 0.5, summary.QuantileValues[0].Quantile)
+}
+
+func TestTransportPartialSuccess(t *testing.T) {
+	collector, conn := newCollector(t)
+	defer collector.server.Stop()
+	defer conn.Close()
+	collector.rejectedSpans = 1
+
+	transport := otlp.NewTransport(conn)
+	err := transport.SendTransactions(context.Background(), &model.TransactionsPayload{
+		Service:      &model.Service{Name: "otlp_testing"},
+		Transactions: []model.Transaction{{Name: "name", Type: "type"}},
+	})
+	assert.EqualError(t, err, "1 spans rejected: invalid span")
+}
+
+func stringAttr(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{
+		Key:   key,
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}},
+	}
+}
+
+// collector records the requests received by a gRPC server
+// implementing the OTLP collector services.
+type collector struct {
+	server *grpc.Server
+
+	mu            sync.Mutex
+	traces        []*coltracepb.ExportTraceServiceRequest
+	logs          []*collogspb.ExportLogsServiceRequest
+	metrics       []*colmetricspb.ExportMetricsServiceRequest
+	authorization []string
+	rejectedSpans int64
+}
+
+func newCollector(t *testing.T) (*collector, *grpc.ClientConn) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	c := &collector{}
+	server := grpc.NewServer()
+	coltracepb.RegisterTraceServiceServer(server, traceService{collector: c})
+	collogspb.RegisterLogsServiceServer(server, logsService{collector: c})
+	colmetricspb.RegisterMetricsServiceServer(server, metricsService{collector: c})
+	go server.Serve(lis)
+	c.server = server
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	require.NoError(t, err)
+	return c, conn
+}
+
+type traceService struct {
+	coltracepb.UnimplementedTraceServiceServer
+	*collector
+}
+
+func (s traceService) Export(ctx context.Context, req *coltracepb.ExportTraceServiceRequest) (*coltracepb.ExportTraceServiceResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.traces = append(s.traces, req)
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		s.authorization = md.Get("authorization")
+	}
+	resp := &coltracepb.ExportTraceServiceResponse{}
+	if s.rejectedSpans > 0 {
+		resp.PartialSuccess = &coltracepb.ExportTracePartialSuccess{
+			RejectedSpans: s.rejectedSpans,
+			ErrorMessage:  "invalid span",
+		}
+	}
+	return resp, nil
+}
+
+type logsService struct {
+	collogspb.UnimplementedLogsServiceServer
+	*collector
+}
+
+func (s logsService) Export(ctx context.Context, req *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logs = append(s.logs, req)
+	return &collogspb.ExportLogsServiceResponse{}, nil
+}
+
+type metricsService struct {
+	colmetricspb.UnimplementedMetricsServiceServer
+	*collector
+}
+
+func (s metricsService) Export(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) (*colmetricspb.ExportMetricsServiceResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.metrics = append(s.metrics, req)
+	return &colmetricspb.ExportMetricsServiceResponse{}, nil
+}
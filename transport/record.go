@@ -0,0 +1,98 @@
+package transport
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// defaultPayloadRecordMaxBytes is the default maximum total size
+// of the files written by a payload recorder.
+const defaultPayloadRecordMaxBytes = 100 * 1024 * 1024
+
+// payloadRecorder writes every request body sent by a transport to
+// files in a directory, removing the oldest files to stay within a
+// maximum total size.
+type payloadRecorder struct {
+	dir     string
+	prefix  string
+	maxSize int64
+
+	mu    sync.Mutex
+	seq   int
+	files []recordedFile
+	size  int64
+}
+
+type recordedFile struct {
+	name string
+	size int64
+}
+
+// SetPayloadRecordDir sets the directory to which the transport writes
+// the body of every request it sends to the APM server, for attaching to
+// bug reports about payload schema or validation errors. If dir is empty,
+// which is the default, requests are not recorded. Requests may also be
+// recorded by setting the ELASTIC_APM_DEBUG environment variable to
+// "payloadrecord=<dir>", and optionally "payloadrecordsize=<size>".
+//
+// Each request body is written exactly as sent, before compression, to a
+// file named with the time recording started, a sequence number, and the
+// payload type, e.g. "20060102T150405-000001-transactions.json". When the
+// total size of the files written exceeds maxSize, the oldest files are
+// removed. If maxSize is less than or equal to zero, a maximum of 100MB
+// is used.
+//
+// Unlike SetPayloadDumpDir, recorded payloads are not rate limited, and
+// sensitive values are not redacted, so recording should only be enabled
+// while troubleshooting. Payloads which cannot be recorded are counted in
+// the transport's Stats.PayloadRecordFailures, and are otherwise sent as
+// usual.
+func (t *HTTPTransport) SetPayloadRecordDir(dir string, maxSize int64) {
+	var recorder *payloadRecorder
+	if dir != "" {
+		if maxSize <= 0 {
+			maxSize = defaultPayloadRecordMaxBytes
+		}
+		recorder = &payloadRecorder{
+			dir:     dir,
+			prefix:  time.Now().UTC().Format("20060102T150405"),
+			maxSize: maxSize,
+		}
+	}
+	t.mu.Lock()
+	t.recorder = recorder
+	t.mu.Unlock()
+}
+
+// record writes payload to a new file for the given payload kind,
+// and removes the oldest files if the maximum size is exceeded. An
+// error is returned if the payload could not be recorded, or an old
+// file could not be removed.
+func (r *payloadRecorder) record(kind string, payload []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := os.MkdirAll(r.dir, 0700); err != nil {
+		return err
+	}
+	r.seq++
+	filename := filepath.Join(r.dir, fmt.Sprintf("%s-%06d-%s.json", r.prefix, r.seq, kind))
+	if err := ioutil.WriteFile(filename, payload, 0600); err != nil {
+		return err
+	}
+	r.files = append(r.files, recordedFile{name: filename, size: int64(len(payload))})
+	r.size += int64(len(payload))
+	var removeErr error
+	for r.size > r.maxSize && len(r.files) > 1 {
+		oldest := r.files[0]
+		if err := os.Remove(oldest.name); err != nil && !os.IsNotExist(err) {
+			removeErr = err
+		}
+		r.files = r.files[1:]
+		r.size -= oldest.size
+	}
+	return removeErr
+}
@@ -0,0 +1,104 @@
+package transport
+
+import (
+	"context"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultRetryInitialInterval = 100 * time.Millisecond
+	defaultRetryMaxInterval     = 10 * time.Second
+)
+
+// RetryPolicy controls how HTTPTransport retries requests that fail
+// with a transient error: when the request cannot be sent, or the APM
+// server responds with a server error such as 503 Service Unavailable.
+// Requests rejected with a client error are never retried.
+//
+// Retries are delayed with exponential backoff and jitter: the nth
+// retry is made after a random delay of between half and one and a
+// half times InitialInterval*2^(n-1), capped at MaxInterval.
+type RetryPolicy struct {
+	// MaxAttempts holds the maximum number of attempts to send each
+	// request, including the first. If MaxAttempts is less than two,
+	// requests are not retried.
+	MaxAttempts int
+
+	// MaxElapsedTime holds the maximum time to spend sending a
+	// request, including retries. A retry which would start after
+	// this time is not made. If MaxElapsedTime is zero, retries are
+	// limited only by MaxAttempts.
+	MaxElapsedTime time.Duration
+
+	// InitialInterval holds the base delay before the first retry.
+	// If InitialInterval is zero, 100ms is used.
+	InitialInterval time.Duration
+
+	// MaxInterval holds the maximum delay before any retry.
+	// If MaxInterval is zero, 10s is used.
+	MaxInterval time.Duration
+}
+
+// WithRetryPolicy returns an HTTPTransportOption which sets the policy
+// for retrying failed requests. By default, failed requests are not
+// retried; the tracer keeps the events and sends them again later,
+// subject to its queue limits.
+func WithRetryPolicy(policy RetryPolicy) HTTPTransportOption {
+	return func(o *httpTransportOptions) {
+		o.retryPolicy = &policy
+	}
+}
+
+// SetRetryPolicy sets the policy for retrying failed requests.
+// See WithRetryPolicy.
+func (t *HTTPTransport) SetRetryPolicy(policy RetryPolicy) {
+	t.mu.Lock()
+	t.retryPolicy = policy
+	t.mu.Unlock()
+}
+
+func (t *HTTPTransport) loadRetryPolicy() RetryPolicy {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.retryPolicy
+}
+
+// sendPayloadRetry sends the encoded payload buf as with sendPayload,
+// retrying according to the transport's retry policy. Waiting between
+// retries is aborted if ctx is canceled.
+func (t *HTTPTransport) sendPayloadRetry(ctx context.Context, kind string, buf []byte, e *encoder, op string, compact bool) error {
+	policy := t.loadRetryPolicy()
+	start := time.Now()
+	interval := policy.InitialInterval
+	if interval <= 0 {
+		interval = defaultRetryInitialInterval
+	}
+	maxInterval := policy.MaxInterval
+	if maxInterval <= 0 {
+		maxInterval = defaultRetryMaxInterval
+	}
+	for attempt := 1; ; attempt++ {
+		err := t.sendPayload(ctx, kind, buf, e, op, compact)
+		if err == nil || attempt >= policy.MaxAttempts || !isRetryable(err) {
+			return err
+		}
+		if interval > maxInterval {
+			interval = maxInterval
+		}
+		delay := interval/2 + time.Duration(rand.Int63n(int64(interval)))
+		if policy.MaxElapsedTime > 0 && time.Since(start)+delay > policy.MaxElapsedTime {
+			return err
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		atomic.AddUint64(&t.stats.Retries, 1)
+		interval *= 2
+	}
+}
@@ -0,0 +1,97 @@
+package transport
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+
+	"github.com/elastic/apm-agent-go/internal/apmconfig"
+)
+
+// WithServerCACertificates returns an HTTPTransportOption which sets the
+// CA certificates used to verify the APM server's TLS certificate, in
+// place of the system's root CAs. The certificates may also be loaded
+// from the PEM-encoded file named by the ELASTIC_APM_SERVER_CA_CERT_FILE
+// environment variable.
+func WithServerCACertificates(pool *x509.CertPool) HTTPTransportOption {
+	return func(o *httpTransportOptions) {
+		o.serverCAs = pool
+	}
+}
+
+// WithServerCertificate returns an HTTPTransportOption which pins the
+// APM server's TLS certificate: connections are accepted only if the
+// server presents exactly this certificate, which need not be signed
+// by a trusted CA. The certificate may also be loaded from the
+// PEM-encoded file named by the ELASTIC_APM_SERVER_CERT environment
+// variable.
+func WithServerCertificate(cert *x509.Certificate) HTTPTransportOption {
+	return func(o *httpTransportOptions) {
+		o.serverCert = cert
+	}
+}
+
+// initialServerCACertificates returns the CA certificates loaded from
+// the file named by the ELASTIC_APM_SERVER_CA_CERT_FILE environment
+// variable, or nil if no file is specified.
+func initialServerCACertificates() (*x509.CertPool, error) {
+	file := apmconfig.Getenv(envServerCACertFile)
+	if file == "" {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load server CA certificates")
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.Errorf("failed to load server CA certificates: no certificates found in %s", file)
+	}
+	return pool, nil
+}
+
+// initialServerCertificate returns the pinned server certificate loaded
+// from the file named by the ELASTIC_APM_SERVER_CERT environment
+// variable, or nil if no file is specified.
+func initialServerCertificate() (*x509.Certificate, error) {
+	file := apmconfig.Getenv(envServerCert)
+	if file == "" {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load server certificate")
+	}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, errors.Errorf("failed to load server certificate: no certificate found in %s", file)
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to load server certificate")
+		}
+		return cert, nil
+	}
+}
+
+// pinServerCertificate configures tlsConfig to accept only connections
+// to servers presenting cert. Chain and hostname verification are
+// replaced by the comparison with the pinned certificate.
+func pinServerCertificate(tlsConfig *tls.Config, cert *x509.Certificate) {
+	tlsConfig.InsecureSkipVerify = true
+	tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 || !bytes.Equal(rawCerts[0], cert.Raw) {
+			return errors.New("server certificate does not match the pinned certificate")
+		}
+		return nil
+	}
+}
@@ -0,0 +1,189 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// defaultServerCooldown is the period for which a server is skipped
+// after a request to it fails with a connection error.
+const defaultServerCooldown = 30 * time.Second
+
+// server holds the URLs for an APM server, and its health.
+type server struct {
+	rawURL          string // as configured
+	socketPath      string // for unix:// URLs
+	baseURL         *url.URL
+	transactionsURL *url.URL
+	errorsURL       *url.URL
+	metricsURL      *url.URL
+
+	mu             sync.Mutex
+	unhealthyUntil time.Time
+}
+
+func newServers(serverURLs []string) ([]*server, error) {
+	if len(serverURLs) == 0 {
+		return nil, errors.New("no server URLs specified")
+	}
+	servers := make([]*server, len(serverURLs))
+	for i, serverURL := range serverURLs {
+		req, err := http.NewRequest("POST", serverURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		baseURL := req.URL
+		if baseURL.Scheme == "file" {
+			return nil, errors.Errorf("invalid server URL %q: file URLs are only supported by FileTransport", serverURL)
+		}
+		var socketPath string
+		if baseURL.Scheme == "unix" {
+			socketPath = baseURL.Path
+			if baseURL, err = unixSocketURL(socketPath); err != nil {
+				return nil, err
+			}
+		}
+		servers[i] = &server{
+			rawURL:          serverURL,
+			socketPath:      socketPath,
+			baseURL:         baseURL,
+			transactionsURL: urlWithPath(baseURL, transactionsPath),
+			errorsURL:       urlWithPath(baseURL, errorsPath),
+			metricsURL:      urlWithPath(baseURL, metricsPath),
+		}
+	}
+	return servers, nil
+}
+
+// url returns the URL to which payloads of the given kind are sent.
+func (s *server) url(kind string) *url.URL {
+	switch kind {
+	case "errors":
+		return s.errorsURL
+	case "metrics":
+		return s.metricsURL
+	}
+	return s.transactionsURL
+}
+
+func (s *server) unhealthy(now time.Time) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.unhealthyUntil, now.Before(s.unhealthyUntil)
+}
+
+func (s *server) setHealthy(healthy bool) {
+	s.mu.Lock()
+	if healthy {
+		s.unhealthyUntil = time.Time{}
+	} else {
+		s.unhealthyUntil = time.Now().Add(defaultServerCooldown)
+	}
+	s.mu.Unlock()
+}
+
+// SetServerURLs sets the URLs of the APM servers to which payloads are
+// sent, replacing the URL passed to NewHTTPTransport. The server URLs
+// may also be set with the ELASTIC_APM_SERVER_URLS environment variable,
+// a comma-separated list of URLs.
+//
+// Payloads are sent to the first server. If a request to a server fails
+// with a connection error, the payload is sent to the next server, and
+// the failed server is skipped for 30 seconds. If all servers have
+// failed recently, they are all tried again, least recently failed first.
+// Servers responding with an HTTP error are not skipped.
+//
+// URLs of the form "unix:///path/to/socket" may be specified only if
+// NewHTTPTransport was also given such a URL, as the transport's Client
+// must be configured to connect to Unix domain sockets. The TLS
+// configuration of NewHTTPTransport applies to all https:// servers,
+// including those set with SetServerURLs.
+func (t *HTTPTransport) SetServerURLs(serverURLs ...string) error {
+	servers, err := newServers(serverURLs)
+	if err != nil {
+		return err
+	}
+	if hasUnixSocketServer(servers) && !t.unixSockets {
+		return errors.New("unix server URLs require the transport to be created with one")
+	}
+	t.mu.Lock()
+	t.servers = servers
+	t.mu.Unlock()
+	return nil
+}
+
+// orderedServers returns the servers in the order in which they should be
+// tried: the healthy servers in the configured order, followed by the
+// unhealthy servers in the order in which they will become healthy.
+func (t *HTTPTransport) orderedServers() []*server {
+	t.mu.Lock()
+	servers := t.servers
+	t.mu.Unlock()
+	if len(servers) == 1 {
+		return servers
+	}
+
+	type unhealthyServer struct {
+		*server
+		until time.Time
+	}
+	now := time.Now()
+	ordered := make([]*server, 0, len(servers))
+	var unhealthy []unhealthyServer
+	for _, s := range servers {
+		if until, ok := s.unhealthy(now); ok {
+			unhealthy = append(unhealthy, unhealthyServer{s, until})
+			continue
+		}
+		ordered = append(ordered, s)
+	}
+	sort.SliceStable(unhealthy, func(i, j int) bool {
+		return unhealthy[i].until.Before(unhealthy[j].until)
+	})
+	for _, s := range unhealthy {
+		ordered = append(ordered, s.server)
+	}
+	return ordered
+}
+
+// sendPayload sends the encoded payload buf of the given kind, failing
+// over to the next server if a request fails with a connection error.
+// The compression buffers in e are used to compress the payload if it is large
+// enough.
+func (t *HTTPTransport) sendPayload(ctx context.Context, kind string, buf []byte, e *encoder, op string, compact bool) error {
+	// The secret token is obtained before trying any server, so
+	// that a failing token provider does not count against the
+	// servers' health.
+	authorize, err := t.authorizer(ctx)
+	if err != nil {
+		return err
+	}
+	servers := t.orderedServers()
+	for i, s := range servers {
+		req := requestWithContext(ctx, t.newRequest(s.url(kind)))
+		err = t.sendRequest(req, buf, e, op, compact, authorize)
+		if _, ok := err.(*HTTPError); ok || err == nil {
+			s.setHealthy(true)
+			return err
+		}
+		if ctx.Err() != nil {
+			// The request was canceled, so the server
+			// may not be at fault; don't fail over.
+			return err
+		}
+		if len(servers) > 1 {
+			s.setHealthy(false)
+			if i+1 < len(servers) {
+				atomic.AddUint64(&t.stats.Failovers, 1)
+			}
+		}
+	}
+	return err
+}
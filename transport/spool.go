@@ -0,0 +1,324 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// defaultSpoolSize is the default maximum total size of the
+	// payloads held in the spool directory.
+	defaultSpoolSize = 100 * 1024 * 1024
+)
+
+// errSpoolFull is returned by spool.add when adding the
+// payload would exceed the spool's maximum size.
+var errSpoolFull = errors.New("spool is full")
+
+// spoolFileRegexp matches the names of spooled payload files, capturing
+// the sequence number, payload kind, and whether the payload is compact.
+var spoolFileRegexp = regexp.MustCompile(`^(\d+)-(transactions|errors|metrics)(-compact)?\.json$`)
+
+// spool holds serialized payloads in a directory while the APM server
+// is unreachable, so they can be sent once it becomes reachable again.
+type spool struct {
+	dir     string
+	maxSize int64
+
+	mu        sync.Mutex
+	files     []spoolFile // oldest first
+	size      int64
+	seq       uint64
+	replaying bool
+}
+
+// spoolFile describes a payload file in the spool directory.
+type spoolFile struct {
+	name    string
+	kind    string
+	compact bool
+	size    int64
+}
+
+// SetSpoolDir sets the directory in which the transport stores payloads
+// that could not be sent because the APM server was unreachable, or
+// responded with a server error. If dir is empty, which is the default,
+// payloads are not spooled, and the error is returned to the caller.
+// The spool directory may also be set with the ELASTIC_APM_SPOOL_DIR
+// environment variable.
+//
+// Once a payload has been spooled, the Send method returns a
+// *SpooledError, so that the caller can account for the events
+// separately from those sent, and does not send them again. Spooled
+// payloads are sent, oldest first, in the background after the next
+// payload is sent successfully. Payloads left in the directory by a
+// previous process are sent too, so the directory must not be shared
+// by concurrently running processes.
+//
+// The total size of the spooled payloads is limited to maxSize bytes,
+// or 100MiB if maxSize is zero or negative. When the spool is full, the
+// Send methods return errors as they would without a spool.
+//
+// Failures to write, read, or remove spooled payloads are counted in
+// Stats.SpoolFailures, and spooled payloads that are discarded, e.g.
+// because the server rejected them, in Stats.SpoolDiscarded.
+func (t *HTTPTransport) SetSpoolDir(dir string, maxSize int64) error {
+	var s *spool
+	if dir != "" {
+		if maxSize <= 0 {
+			maxSize = defaultSpoolSize
+		}
+		s = &spool{dir: dir, maxSize: maxSize}
+		if err := s.load(); err != nil {
+			return errors.Wrap(err, "failed to load spool directory")
+		}
+	}
+	t.mu.Lock()
+	t.spool = s
+	t.mu.Unlock()
+	return nil
+}
+
+func (t *HTTPTransport) loadSpool() *spool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.spool
+}
+
+// SpooledError is returned by HTTPTransport's Send methods when events
+// could not be sent, but were spooled to be sent later; see SetSpoolDir.
+// The payload's other events, if any, were sent successfully. The
+// spooled events must not be sent again by the caller.
+type SpooledError struct {
+	// Spooled holds the number of events spooled.
+	Spooled int
+}
+
+// Error returns a message reporting the number of events spooled.
+func (e *SpooledError) Error() string {
+	return fmt.Sprintf("%d events spooled", e.Spooled)
+}
+
+// spoolPayload records the result of sending the payload of the given
+// kind encoded in e. If sending failed with a retryable error and the
+// payload was spooled, spoolPayload returns true and a nil error;
+// otherwise it returns err. If sending succeeded, previously spooled
+// payloads are sent in the background. The background replay is not
+// bound to the context of the send that triggered it, which may be
+// cancelled as soon as that send returns.
+func (t *HTTPTransport) spoolPayload(kind string, e *encoder, compact bool, err error) (bool, error) {
+	s := t.loadSpool()
+	if s == nil {
+		if err != nil {
+			atomic.AddUint64(&t.stats.PayloadsFailed, 1)
+		}
+		return false, err
+	}
+	if err != nil {
+		if !isRetryable(err) {
+			atomic.AddUint64(&t.stats.PayloadsFailed, 1)
+			return false, err
+		}
+		if spoolErr := s.add(kind, compact, e.jsonWriter.Bytes()); spoolErr != nil {
+			if spoolErr != errSpoolFull {
+				atomic.AddUint64(&t.stats.SpoolFailures, 1)
+			}
+			atomic.AddUint64(&t.stats.PayloadsFailed, 1)
+			return false, err
+		}
+		return true, nil
+	}
+	if s.startReplay() {
+		go func() {
+			defer s.endReplay()
+			t.replaySpool(context.Background(), s)
+		}()
+	}
+	return false, nil
+}
+
+// replaySpool sends the payloads in s, oldest first, stopping at the
+// first retryable error. Payloads rejected by the server with a client
+// error are logged and discarded, as they would never be accepted.
+// The caller must have started the replay with s.startReplay.
+func (t *HTTPTransport) replaySpool(ctx context.Context, s *spool) {
+	e := t.encoders.Get().(*encoder)
+	defer t.encoders.Put(e)
+	for {
+		f, ok := s.oldest()
+		if !ok {
+			return
+		}
+		payload, err := ioutil.ReadFile(filepath.Join(s.dir, f.name))
+		if err != nil {
+			atomic.AddUint64(&t.stats.SpoolFailures, 1)
+			atomic.AddUint64(&t.stats.SpoolDiscarded, 1)
+			t.removeSpooled(s, f)
+			continue
+		}
+		op := "SendTransactions"
+		switch f.kind {
+		case "errors":
+			op = "SendErrors"
+		case "metrics":
+			op = "SendMetrics"
+		}
+		if err := t.sendPayload(ctx, f.kind, payload, e, op, f.compact); err != nil {
+			if _, ok := err.(*secretTokenError); ok || isRetryable(err) {
+				// The payload was not rejected by the
+				// server, so keep it for the next replay.
+				return
+			}
+			atomic.AddUint64(&t.stats.SpoolDiscarded, 1)
+		}
+		t.removeSpooled(s, f)
+	}
+}
+
+// isRetryable reports whether err, returned by sendRequest, may succeed
+// if the request is retried later: either the request could not be
+// sent, or the server responded with a server error.
+func isRetryable(err error) bool {
+	switch err := err.(type) {
+	case *HTTPError:
+		return err.Response.StatusCode >= 500
+	case *secretTokenError:
+		return false
+	}
+	return true
+}
+
+// load creates the spool directory if it does not exist, and records
+// the payload files already in it.
+func (s *spool) load() error {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+	infos, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	type seqFile struct {
+		seq uint64
+		spoolFile
+	}
+	var files []seqFile
+	for _, info := range infos {
+		m := spoolFileRegexp.FindStringSubmatch(info.Name())
+		if m == nil || !info.Mode().IsRegular() {
+			continue
+		}
+		seq, err := strconv.ParseUint(m[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		files = append(files, seqFile{seq, spoolFile{
+			name:    info.Name(),
+			kind:    m[2],
+			compact: m[3] != "",
+			size:    info.Size(),
+		}})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].seq < files[j].seq
+	})
+	for _, f := range files {
+		s.files = append(s.files, f.spoolFile)
+		s.size += f.size
+		s.seq = f.seq
+	}
+	return nil
+}
+
+// add writes payload to a new file in the spool directory.
+func (s *spool) add(kind string, compact bool, payload []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	size := int64(len(payload))
+	if s.size+size > s.maxSize {
+		return errSpoolFull
+	}
+	var suffix string
+	if compact {
+		suffix = "-compact"
+	}
+	name := fmt.Sprintf("%010d-%s%s.json", s.seq+1, kind, suffix)
+	filename := filepath.Join(s.dir, name)
+
+	// Write to a temporary file and rename it, so a partially
+	// written payload is never loaded after a crash.
+	tmp := filename + ".tmp"
+	if err := ioutil.WriteFile(tmp, payload, 0600); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, filename); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	s.seq++
+	s.size += size
+	s.files = append(s.files, spoolFile{name: name, kind: kind, compact: compact, size: size})
+	return nil
+}
+
+// oldest returns the oldest spooled file, if any.
+func (s *spool) oldest() (spoolFile, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.files) == 0 {
+		return spoolFile{}, false
+	}
+	return s.files[0], true
+}
+
+// removeSpooled removes f, which must be the oldest file in s,
+// counting any failure to remove the file in t's stats.
+func (t *HTTPTransport) removeSpooled(s *spool, f spoolFile) {
+	if err := s.remove(f); err != nil {
+		atomic.AddUint64(&t.stats.SpoolFailures, 1)
+	}
+}
+
+// remove removes f, which must be the oldest spooled file. The file is
+// no longer tracked even if it could not be removed, in which case the
+// error is returned.
+func (s *spool) remove(f spoolFile) error {
+	err := os.Remove(filepath.Join(s.dir, f.name))
+	if os.IsNotExist(err) {
+		err = nil
+	}
+	s.mu.Lock()
+	s.files = s.files[1:]
+	s.size -= f.size
+	s.mu.Unlock()
+	return err
+}
+
+// startReplay reports whether the caller may replay the spool,
+// which is the case if it is not already being replayed.
+func (s *spool) startReplay() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.replaying || len(s.files) == 0 {
+		return false
+	}
+	s.replaying = true
+	return true
+}
+
+func (s *spool) endReplay() {
+	s.mu.Lock()
+	s.replaying = false
+	s.mu.Unlock()
+}
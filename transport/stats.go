@@ -0,0 +1,108 @@
+package transport
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Stats holds statistics on a transport's requests to the APM server.
+type Stats struct {
+	// BytesSent holds the number of request body bytes sent,
+	// after compression, for requests which received a response.
+	BytesSent uint64
+
+	// Requests holds the number of requests made, including
+	// retries, failovers, and replays of spooled payloads.
+	Requests uint64
+
+	// RequestFailures holds the number of requests which
+	// failed, either because no response was received, or
+	// because the server responded with an error.
+	RequestFailures uint64
+
+	// Retries holds the number of requests which were
+	// retried according to the transport's RetryPolicy.
+	Retries uint64
+
+	// Failovers holds the number of times a request failed with
+	// a connection error and was sent to the next server instead.
+	// See SetServerURLs.
+	Failovers uint64
+
+	// PayloadsFailed holds the number of payloads which could not be
+	// sent, after any retries, and which were not spooled. The tracer
+	// may send the events in such payloads again later.
+	PayloadsFailed uint64
+
+	// PayloadDumpFailures and PayloadRecordFailures hold the number
+	// of payloads which could not be dumped or recorded. See
+	// SetPayloadDumpDir and SetPayloadRecordDir.
+	PayloadDumpFailures   uint64
+	PayloadRecordFailures uint64
+
+	// SpoolFailures holds the number of times a payload could not
+	// be written to, read from, or removed from the spool directory.
+	// See SetSpoolDir.
+	SpoolFailures uint64
+
+	// SpoolDiscarded holds the number of spooled payloads which
+	// were discarded because the server rejected them with a
+	// client error, or because they could not be read.
+	SpoolDiscarded uint64
+
+	// ServerClockOffset holds the difference between the APM server's
+	// clock and the local clock, estimated from the Date header of the
+	// most recent successful response: positive if the server's clock
+	// is ahead. The Date header has a resolution of one second, so the
+	// estimate is accurate only to within a second or so. If no response
+	// with a Date header has been received, ServerClockOffset is zero.
+	ServerClockOffset time.Duration
+}
+
+// StatsReporter is an optional interface that may be implemented by a
+// Transport, for reporting statistics on its requests to the APM server.
+// The tracer reports these statistics in its builtin metrics.
+type StatsReporter interface {
+	// TransportStats returns the transport's statistics.
+	TransportStats() Stats
+}
+
+// TransportStats returns the transport's statistics.
+func (t *HTTPTransport) TransportStats() Stats {
+	return Stats{
+		BytesSent:       atomic.LoadUint64(&t.stats.BytesSent),
+		Requests:        atomic.LoadUint64(&t.stats.Requests),
+		RequestFailures: atomic.LoadUint64(&t.stats.RequestFailures),
+		Retries:         atomic.LoadUint64(&t.stats.Retries),
+		Failovers:       atomic.LoadUint64(&t.stats.Failovers),
+		PayloadsFailed:  atomic.LoadUint64(&t.stats.PayloadsFailed),
+
+		PayloadDumpFailures:   atomic.LoadUint64(&t.stats.PayloadDumpFailures),
+		PayloadRecordFailures: atomic.LoadUint64(&t.stats.PayloadRecordFailures),
+		SpoolFailures:         atomic.LoadUint64(&t.stats.SpoolFailures),
+		SpoolDiscarded:        atomic.LoadUint64(&t.stats.SpoolDiscarded),
+
+		ServerClockOffset: time.Duration(atomic.LoadInt64((*int64)(&t.stats.ServerClockOffset))),
+	}
+}
+
+// recordServerClockOffset records the offset of the server's clock
+// from the local clock, given the Date header of a response to a
+// request sent at start and received at end.
+func (t *HTTPTransport) recordServerClockOffset(date string, start, end time.Time) {
+	if date == "" {
+		return
+	}
+	serverTime, err := http.ParseTime(date)
+	if err != nil {
+		return
+	}
+	// The Date header is truncated to the second, and the server
+	// generated it at some point while the request was in flight;
+	// compare the middle of both intervals.
+	serverTime = serverTime.Add(500 * time.Millisecond)
+	localTime := start.Add(end.Sub(start) / 2)
+	offset := serverTime.Sub(localTime)
+	atomic.StoreInt64((*int64)(&t.stats.ServerClockOffset), int64(offset))
+}
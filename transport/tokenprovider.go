@@ -0,0 +1,70 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// SecretTokenProvider returns the secret token with which to authorize
+// a request to the APM server. The context is that of the request.
+type SecretTokenProvider func(context.Context) (string, error)
+
+// WithSecretTokenProvider returns an HTTPTransportOption which sets a
+// function to call for the secret token before each request to the APM
+// server, for secret tokens that are rotated, e.g. by a secrets manager
+// such as Vault. The provider may be called concurrently, and should
+// cache the token rather than fetching it for every request.
+//
+// The provider is called once for each payload, before any request is
+// sent to any of the transport's servers. If the provider returns an
+// error, no request is sent, and the error is returned by the Send
+// method; the error does not count against the servers' health, and the
+// payload is neither retried nor spooled. If the provider returns an
+// empty token, the request is sent without authorization.
+//
+// The provider takes precedence over any secret token or API key.
+func WithSecretTokenProvider(provider SecretTokenProvider) HTTPTransportOption {
+	return func(o *httpTransportOptions) {
+		o.secretTokenProvider = provider
+	}
+}
+
+// secretTokenError is returned by sendPayload when the secret token
+// provider fails. No request is sent, so the error is not retryable.
+type secretTokenError struct {
+	err error
+}
+
+func (e *secretTokenError) Error() string {
+	return e.err.Error()
+}
+
+// Cause returns the error returned by the secret token provider.
+func (e *secretTokenError) Cause() error {
+	return errors.Cause(e.err)
+}
+
+// authorizer returns a function which sets the Authorization header
+// of a request using the token returned by the transport's secret
+// token provider, copying the headers so that those shared by requests
+// are not modified. If the transport has no provider, authorizer
+// returns nil.
+func (t *HTTPTransport) authorizer(ctx context.Context) (func(req *http.Request), error) {
+	if t.secretTokenProvider == nil {
+		return nil, nil
+	}
+	token, err := t.secretTokenProvider(ctx)
+	if err != nil {
+		return nil, &secretTokenError{errors.Wrap(err, "failed to obtain secret token")}
+	}
+	return func(req *http.Request) {
+		req.Header = cloneHeaders(req.Header)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		} else {
+			req.Header.Del("Authorization")
+		}
+	}, nil
+}
@@ -0,0 +1,81 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// unixSocketHostPrefix is the prefix of the host names used in requests
+// to APM servers listening on Unix domain sockets. The remainder of the
+// host name is a hash of the socket path, so connections to different
+// sockets are never pooled together.
+const unixSocketHostPrefix = "unix-socket-"
+
+// unixSocketURL returns the http URL with which requests are made to the
+// APM server listening on the Unix domain socket at socketPath.
+func unixSocketURL(socketPath string) (*url.URL, error) {
+	if socketPath == "" {
+		return nil, errors.New("missing socket path in unix server URL")
+	}
+	h := fnv.New64a()
+	h.Write([]byte(socketPath))
+	return &url.URL{
+		Scheme: "http",
+		Host:   fmt.Sprintf("%s%x", unixSocketHostPrefix, h.Sum64()),
+	}, nil
+}
+
+func hasUnixSocketServer(servers []*server) bool {
+	for _, s := range servers {
+		if s.socketPath != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// newClientTransport returns an http.Transport for the transport's Client,
+// which connects to APM servers on Unix domain sockets, and otherwise uses
+// the default dialer, the configured proxy, the given TLS configuration,
+// the configured connection pool, and HTTP/2 where available.
+func (t *HTTPTransport) newClientTransport(tlsConfig *tls.Config) *http.Transport {
+	transport := &http.Transport{
+		Proxy:                 t.proxy,
+		DialContext:           t.dialContext,
+		MaxIdleConns:          defaultHTTPTransport.MaxIdleConns,
+		IdleConnTimeout:       defaultHTTPTransport.IdleConnTimeout,
+		TLSHandshakeTimeout:   defaultHTTPTransport.TLSHandshakeTimeout,
+		ExpectContinueTimeout: defaultHTTPTransport.ExpectContinueTimeout,
+		TLSClientConfig:       tlsConfig,
+	}
+	t.connectionPool.apply(transport)
+	configureHTTP2(transport, t.h2c)
+	return transport
+}
+
+// dialContext dials addr, connecting to the Unix domain socket of the
+// APM server if addr is for a server configured with a unix:// URL.
+func (t *HTTPTransport) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil || !strings.HasPrefix(host, unixSocketHostPrefix) {
+		return defaultHTTPTransport.DialContext(ctx, network, addr)
+	}
+	t.mu.Lock()
+	servers := t.servers
+	t.mu.Unlock()
+	for _, s := range servers {
+		if s.socketPath != "" && s.baseURL.Host == host {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", s.socketPath)
+		}
+	}
+	return nil, errors.Errorf("no Unix domain socket for %q", host)
+}
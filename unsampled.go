@@ -0,0 +1,50 @@
+package elasticapm
+
+import (
+	"context"
+)
+
+// dropUnsampledMode controls whether or not unsampled transactions
+// are sent to the server.
+type dropUnsampledMode int
+
+const (
+	// dropUnsampledAuto drops unsampled transactions if the server
+	// version is known to be 8.0 or greater. Such servers extrapolate
+	// metrics from sampled transactions, so do not need unsampled ones.
+	dropUnsampledAuto dropUnsampledMode = iota
+
+	// dropUnsampledAlways always drops unsampled transactions.
+	dropUnsampledAlways
+
+	// dropUnsampledNever always sends unsampled transactions.
+	dropUnsampledNever
+)
+
+// SetDropUnsampledTransactions sets whether or not unsampled transactions
+// are sent to the APM server, overriding the default behaviour.
+//
+// By default, unsampled transactions are not sent if the tracer's
+// Transport implements transport.ServerVersioner, and reports a server
+// version of 8.0 or greater. Otherwise, unsampled transactions are sent.
+func (t *Tracer) SetDropUnsampledTransactions(drop bool) {
+	mode := dropUnsampledNever
+	if drop {
+		mode = dropUnsampledAlways
+	}
+	t.sendConfigCommand(func(cfg *tracerConfig) {
+		cfg.dropUnsampled = mode
+	})
+}
+
+// dropUnsampled reports whether or not unsampled transactions should
+// be dropped, rather than sent to the server.
+func (s *sender) dropUnsampled(ctx context.Context) bool {
+	switch s.cfg.dropUnsampled {
+	case dropUnsampledAlways:
+		return true
+	case dropUnsampledNever:
+		return false
+	}
+	return s.serverVersionAtLeast(ctx, 8, 0)
+}
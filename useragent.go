@@ -0,0 +1,187 @@
+package elasticapm
+
+import (
+	"strings"
+)
+
+// UserAgentParsingMode holds a value indicating how the User-Agent
+// header of HTTP requests is parsed.
+type UserAgentParsingMode int
+
+const (
+	// UserAgentParsingOff disables user-agent parsing. The User-Agent
+	// header is recorded as configured by SetCaptureHeaders. This is
+	// the default mode.
+	UserAgentParsingOff UserAgentParsingMode = iota
+
+	// UserAgentParsingClient parses the User-Agent header in the
+	// agent, recording the client's name, version, operating system,
+	// and device type as the tags "user_agent_name",
+	// "user_agent_version", "user_agent_os", and "user_agent_device".
+	UserAgentParsingClient
+
+	// UserAgentParsingServer records the User-Agent header even if
+	// header capture is disabled, so that the APM server's user-agent
+	// ingest pipeline can parse it.
+	UserAgentParsingServer
+)
+
+// SetUserAgentParsing sets the mode with which the User-Agent header of
+// HTTP requests recorded with Context.SetHTTPRequest is parsed. This can
+// be used to break down latency and errors by client version, e.g. for
+// APIs with their own client libraries.
+//
+// Client-side parsing recognizes common browsers and operating systems;
+// for other clients, such as "okhttp/4.9.0" or "MyApp/2.3.1", the name
+// and version are taken from the first product in the header.
+//
+// The mode may also be configured with the ELASTIC_APM_USER_AGENT_PARSING
+// environment variable. SetUserAgentParsing affects only transactions and
+// errors created after it is called.
+func (t *Tracer) SetUserAgentParsing(mode UserAgentParsingMode) {
+	t.updateTransactionConfig(func(cfg *transactionConfig) {
+		cfg.userAgentParsing = mode
+	})
+}
+
+// userAgent holds the details parsed from a User-Agent header.
+type userAgent struct {
+	name    string
+	version string
+	os      string
+	device  string
+}
+
+// userAgentBrowsers holds the product tokens identifying browsers, in
+// order of precedence: browsers based on Chrome also report "Chrome",
+// and almost all browsers report "Safari".
+var userAgentBrowsers = []struct {
+	product string
+	name    string
+}{
+	{"Edg", "Edge"},
+	{"Edge", "Edge"},
+	{"OPR", "Opera"},
+	{"SamsungBrowser", "Samsung Internet"},
+	{"Firefox", "Firefox"},
+	{"FxiOS", "Firefox"},
+	{"CriOS", "Chrome"},
+	{"Chrome", "Chrome"},
+}
+
+// parseUserAgent parses the User-Agent header value ua.
+func parseUserAgent(ua string) userAgent {
+	products, comments := splitUserAgent(ua)
+	var out userAgent
+	for _, b := range userAgentBrowsers {
+		if version, ok := products[b.product]; ok {
+			out.name, out.version = b.name, version
+			break
+		}
+	}
+	if out.name == "" {
+		if _, ok := products["Safari"]; ok {
+			out.name, out.version = "Safari", products["Version"]
+		} else if i := strings.Index(comments, "MSIE "); i >= 0 {
+			out.name, out.version = "Internet Explorer", userAgentToken(comments[i+len("MSIE "):])
+		} else if strings.Contains(comments, "Trident/") {
+			out.name = "Internet Explorer"
+			if i := strings.Index(comments, "rv:"); i >= 0 {
+				out.version = userAgentToken(comments[i+len("rv:"):])
+			}
+		} else {
+			out.name, out.version = firstUserAgentProduct(ua)
+		}
+	}
+
+	switch {
+	case strings.Contains(comments, "iPhone"), strings.Contains(comments, "iPod"):
+		out.os, out.device = "iOS", "mobile"
+	case strings.Contains(comments, "iPad"):
+		out.os, out.device = "iOS", "tablet"
+	case strings.Contains(comments, "Android"):
+		out.os, out.device = "Android", "tablet"
+		if strings.Contains(ua, "Mobile") {
+			out.device = "mobile"
+		}
+	case strings.Contains(comments, "Windows"):
+		out.os, out.device = "Windows", "desktop"
+	case strings.Contains(comments, "Mac OS X"), strings.Contains(comments, "Macintosh"):
+		out.os, out.device = "macOS", "desktop"
+	case strings.Contains(comments, "CrOS"):
+		out.os, out.device = "Chrome OS", "desktop"
+	case strings.Contains(comments, "Linux"):
+		out.os, out.device = "Linux", "desktop"
+	default:
+		out.device = "other"
+	}
+	return out
+}
+
+// splitUserAgent splits ua into its product tokens, mapping product
+// names to versions, and the concatenation of its comments.
+func splitUserAgent(ua string) (map[string]string, string) {
+	products := make(map[string]string)
+	var comments []string
+	for len(ua) > 0 {
+		ua = strings.TrimLeft(ua, " ")
+		if strings.HasPrefix(ua, "(") {
+			end := strings.IndexByte(ua, ')')
+			if end < 0 {
+				end = len(ua) - 1
+			}
+			comments = append(comments, ua[1:end])
+			ua = ua[end+1:]
+			continue
+		}
+		end := strings.IndexAny(ua, " (")
+		if end < 0 {
+			end = len(ua)
+		}
+		token := ua[:end]
+		ua = ua[end:]
+		if i := strings.IndexByte(token, '/'); i > 0 {
+			if _, ok := products[token[:i]]; !ok {
+				products[token[:i]] = token[i+1:]
+			}
+		}
+	}
+	return products, strings.Join(comments, "; ")
+}
+
+// firstUserAgentProduct returns the name and version
+// of the first product token in ua.
+func firstUserAgentProduct(ua string) (name, version string) {
+	token := userAgentToken(strings.TrimSpace(ua))
+	if i := strings.IndexByte(token, '/'); i >= 0 {
+		return token[:i], token[i+1:]
+	}
+	return token, ""
+}
+
+// userAgentToken returns the prefix of s up to
+// the first space, semicolon, or parenthesis.
+func userAgentToken(s string) string {
+	if i := strings.IndexAny(s, " ;()"); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+// setUserAgentTags sets tags on c with the details parsed from ua.
+func (c *Context) setUserAgentTags(ua string) {
+	if ua == "" {
+		return
+	}
+	parsed := parseUserAgent(ua)
+	if parsed.name != "" {
+		c.SetTag("user_agent_name", parsed.name)
+	}
+	if parsed.version != "" {
+		c.SetTag("user_agent_version", parsed.version)
+	}
+	if parsed.os != "" {
+		c.SetTag("user_agent_os", parsed.os)
+	}
+	c.SetTag("user_agent_device", parsed.device)
+}
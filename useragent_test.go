@@ -0,0 +1,81 @@
+package elasticapm_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/model"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestTracerUserAgentParsingClient(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetUserAgentParsing(elasticapm.UserAgentParsingClient)
+
+	userAgents := []string{
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/14.1.1 Safari/605.1.15",
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 14_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/14.1.1 Mobile/15E148 Safari/604.1",
+		"Mozilla/5.0 (Linux; Android 11; SM-T870) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.120 Safari/537.36 Edg/91.0.864.59",
+		"Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:89.0) Gecko/20100101 Firefox/89.0",
+		"MyApp/2.3.1 (Android 11; Mobile) okhttp/4.9.0",
+		"curl/7.64.1",
+	}
+	for _, ua := range userAgents {
+		req, _ := http.NewRequest("GET", "http://server.testing/", nil)
+		req.Header.Set("User-Agent", ua)
+		tx := tracer.StartTransaction("name", "type")
+		tx.Context.SetHTTPRequest(req)
+		tx.End()
+	}
+	tracer.Flush(nil)
+
+	var tags []map[string]string
+	for _, tx := range transport.Payloads()[0].Transactions() {
+		tags = append(tags, tx.Context.Tags)
+	}
+	tag := func(name, version, os, device string) map[string]string {
+		m := map[string]string{"user_agent_name": name, "user_agent_device": device}
+		if version != "" {
+			m["user_agent_version"] = version
+		}
+		if os != "" {
+			m["user_agent_os"] = os
+		}
+		return m
+	}
+	assert.Equal(t, []map[string]string{
+		tag("Chrome", "91.0.4472.124", "Windows", "desktop"),
+		tag("Safari", "14.1.1", "macOS", "desktop"),
+		tag("Safari", "14.1.1", "iOS", "mobile"),
+		tag("Edge", "91.0.864.59", "Android", "tablet"),
+		tag("Firefox", "89.0", "Linux", "desktop"),
+		tag("MyApp", "2.3.1", "Android", "mobile"),
+		tag("curl", "7.64.1", "", "other"),
+	}, tags)
+}
+
+func TestTracerUserAgentParsingServer(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetCaptureHeaders(false)
+	tracer.SetUserAgentParsing(elasticapm.UserAgentParsingServer)
+
+	req, _ := http.NewRequest("GET", "http://server.testing/", nil)
+	req.Header.Set("User-Agent", "MyApp/2.3.1")
+	req.Header.Set("Cookie", "foo=bar")
+	tx := tracer.StartTransaction("name", "type")
+	tx.Context.SetHTTPRequest(req)
+	tx.End()
+	tracer.Flush(nil)
+
+	// The User-Agent header is recorded for parsing by the
+	// server, even though header capture is disabled.
+	context := transport.Payloads()[0].Transactions()[0].Context
+	assert.Equal(t, &model.RequestHeaders{UserAgent: "MyApp/2.3.1"}, context.Request.Headers)
+	assert.Empty(t, context.Tags)
+}
@@ -1,6 +1,7 @@
 package elasticapm
 
 import (
+	"math"
 	"os"
 	"regexp"
 	"runtime"
@@ -8,6 +9,7 @@ import (
 
 	"github.com/pkg/errors"
 
+	"github.com/elastic/apm-agent-go/internal/apmconfig"
 	"github.com/elastic/apm-agent-go/internal/apmstrings"
 	"github.com/elastic/apm-agent-go/model"
 )
@@ -39,11 +41,13 @@ func getCurrentProcess() model.Process {
 	if err != nil {
 		title = os.Args[0]
 	}
+	cwd, _ := os.Getwd()
 	return model.Process{
 		Pid:   os.Getpid(),
 		Ppid:  &ppid,
 		Title: truncateString(title),
 		Argv:  os.Args,
+		Cwd:   truncateString(cwd),
 	}
 }
 
@@ -62,14 +66,23 @@ func getLocalSystem() model.System {
 	system := model.System{
 		Architecture: runtime.GOARCH,
 		Platform:     runtime.GOOS,
+		CPUCount:     runtime.NumCPU(),
 	}
-	system.Hostname = os.Getenv(envHostname)
+	if quota, ok := cgroupCPUQuota(); ok {
+		system.CPUQuota = quota
+	}
+	system.Hostname = apmconfig.Getenv(envHostname)
 	if system.Hostname == "" {
 		if hostname, err := os.Hostname(); err == nil {
 			system.Hostname = hostname
 		}
 	}
 	system.Hostname = truncateString(system.Hostname)
+	containerID, podUID := cgroupContainer()
+	if containerID != "" {
+		system.Container = &model.Container{ID: truncateString(containerID)}
+	}
+	system.Kubernetes = getKubernetesMetadata(podUID)
 	return system
 }
 
@@ -77,6 +90,31 @@ func validTagKey(k string) bool {
 	return !strings.ContainsAny(k, `.*"`)
 }
 
+// MaxTags is the maximum number of tags recorded for a transaction,
+// span, or error. Tags with new keys are ignored once the limit is
+// reached, so that tags keyed by user input, such as propagated
+// baggage, cannot grow events without bound.
+const MaxTags = 128
+
+// setTag sets the tag with the given key and value in tags, allocating
+// tags if it is nil, and returns tags. The key and value are truncated,
+// and invalid keys and keys beyond the MaxTags limit are ignored.
+func setTag(tags map[string]string, key, value string) map[string]string {
+	if !validTagKey(key) {
+		return tags
+	}
+	key = truncateString(key)
+	value = truncateString(value)
+	if tags == nil {
+		return map[string]string{key: value}
+	}
+	if _, ok := tags[key]; !ok && len(tags) >= MaxTags {
+		return tags
+	}
+	tags[key] = value
+	return tags
+}
+
 func validateServiceName(name string) error {
 	idx := serviceNameInvalidRegexp.FindStringIndex(name)
 	if idx == nil {
@@ -96,3 +134,22 @@ func truncateString(s string) string {
 	// At the time of writing, all length limits are 1024.
 	return apmstrings.Truncate(s, 1024)
 }
+
+// checkGOMAXPROCS logs a warning if GOMAXPROCS exceeds the CPU quota of
+// the process's control group, rounded up to a whole number of CPUs. The
+// Go runtime sizes GOMAXPROCS by the number of CPUs on the host, not the
+// container's quota, so a container with a small quota on a large host
+// will be throttled, increasing latency.
+func checkGOMAXPROCS(logger Logger, system *model.System) {
+	if system.CPUQuota <= 0 {
+		return
+	}
+	gomaxprocs := runtime.GOMAXPROCS(0)
+	if quota := math.Ceil(system.CPUQuota); float64(gomaxprocs) > quota {
+		logger.Errorf(
+			"GOMAXPROCS (%d) exceeds the container CPU quota (%g); "+
+				"consider setting GOMAXPROCS=%d to avoid CPU throttling",
+			gomaxprocs, system.CPUQuota, int(quota),
+		)
+	}
+}
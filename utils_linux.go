@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"syscall"
 	"unsafe"
+
+	"github.com/elastic/apm-agent-go/internal/cgroup"
 )
 
 func currentProcessTitle() (string, error) {
@@ -21,3 +23,24 @@ func currentProcessTitle() (string, error) {
 	}
 	return string(buf[:bytes.IndexByte(buf[:], 0)]), nil
 }
+
+// cgroupCPUQuota returns the CPU quota of the process's control
+// group in cores, or false if it has no quota or it is unknown.
+func cgroupCPUQuota() (float64, bool) {
+	quota, ok, err := cgroup.CPUQuota("/proc/self/cgroup", "/sys/fs/cgroup")
+	if err != nil {
+		return 0, false
+	}
+	return quota, ok
+}
+
+// cgroupContainer returns the ID of the container in which the
+// process is running, and the UID of the Kubernetes pod to which
+// the container belongs, if known.
+func cgroupContainer() (containerID, podUID string) {
+	info, err := cgroup.Container("/proc/self/cgroup", "/proc/self/mountinfo")
+	if err != nil {
+		return "", ""
+	}
+	return info.ID, info.PodUID
+}
@@ -6,3 +6,11 @@ func currentProcessTitle() (string, error) {
 	// TODO(axw)
 	return "", nil
 }
+
+func cgroupCPUQuota() (float64, bool) {
+	return 0, false
+}
+
+func cgroupContainer() (containerID, podUID string) {
+	return "", ""
+}
@@ -0,0 +1,87 @@
+package elasticapm
+
+import (
+	"runtime"
+)
+
+// backgroundWorkers limits the goroutines used by the tracer for
+// gathering metrics, and schedules the tracer's other background work
+// in low priority mode, so that the tracer does not compete with the
+// application on saturated hosts.
+type backgroundWorkers struct {
+	n           int
+	lowPriority bool
+	sem         chan struct{}
+}
+
+// defaultMetricsWorkers returns the default maximum number of
+// concurrent metrics gatherers: half of GOMAXPROCS, and at least one.
+func defaultMetricsWorkers() int {
+	n := runtime.GOMAXPROCS(0) / 2
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// configure updates the worker limit and priority. In low priority
+// mode, work started with goFunc is serialized onto a single worker.
+func (w *backgroundWorkers) configure(n int, lowPriority bool) {
+	if n <= 0 {
+		n = defaultMetricsWorkers()
+	}
+	if lowPriority {
+		n = 1
+	}
+	if w.sem != nil && w.n == n && w.lowPriority == lowPriority {
+		return
+	}
+	// Goroutines already started will continue to use the
+	// old semaphore, so there is no need to synchronise.
+	w.n = n
+	w.lowPriority = lowPriority
+	w.sem = make(chan struct{}, n)
+}
+
+// goFunc calls f in a new goroutine, once a worker is available.
+func (w *backgroundWorkers) goFunc(f func()) {
+	sem, lowPriority := w.sem, w.lowPriority
+	go func() {
+		sem <- struct{}{}
+		defer func() { <-sem }()
+		if lowPriority {
+			runtime.Gosched()
+		}
+		f()
+	}()
+}
+
+// yield yields the processor if the workers are in low priority mode,
+// allowing other goroutines to run before the caller continues with
+// background work.
+func (w *backgroundWorkers) yield() {
+	if w.lowPriority {
+		runtime.Gosched()
+	}
+}
+
+// SetMetricsWorkers sets the maximum number of metrics gatherers the
+// tracer runs concurrently. If n is non-positive, the limit is half of
+// GOMAXPROCS, and at least one. Pipelined requests are not limited by
+// this; see SetPipelineDepth.
+func (t *Tracer) SetMetricsWorkers(n int) {
+	t.sendConfigCommand(func(cfg *tracerConfig) {
+		cfg.metricsWorkers = n
+	})
+}
+
+// SetLowPriority sets whether or not the tracer runs its background
+// work in low priority mode. In low priority mode, metrics gatherers
+// are run one at a time, and the tracer yields the processor to other
+// goroutines before each unit of work, such as sending a batch of
+// events or gathering metrics.
+func (t *Tracer) SetLowPriority(lowPriority bool) {
+	t.sendConfigCommand(func(cfg *tracerConfig) {
+		cfg.lowPriority = lowPriority
+	})
+}
@@ -0,0 +1,85 @@
+package elasticapm_test
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestTracerMetricsWorkers(t *testing.T) {
+	if !elasticapm.MetricsEnabled {
+		t.Skip("metrics are compiled out")
+	}
+	tracer, _ := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetMetricsWorkers(2)
+	assert.Equal(t, 2, maxConcurrentGatherers(tracer, 4))
+}
+
+func TestTracerLowPriority(t *testing.T) {
+	if !elasticapm.MetricsEnabled {
+		t.Skip("metrics are compiled out")
+	}
+	tracer, _ := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetMetricsWorkers(4)
+	tracer.SetLowPriority(true)
+	assert.Equal(t, 1, maxConcurrentGatherers(tracer, 4))
+}
+
+func TestTracerLowPriorityEnv(t *testing.T) {
+	if !elasticapm.MetricsEnabled {
+		t.Skip("metrics are compiled out")
+	}
+	os.Setenv("ELASTIC_APM_LOW_PRIORITY", "true")
+	defer os.Unsetenv("ELASTIC_APM_LOW_PRIORITY")
+
+	tracer, _ := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetMetricsWorkers(4)
+	assert.Equal(t, 1, maxConcurrentGatherers(tracer, 4))
+}
+
+func TestTracerMetricsWorkersEnvInvalid(t *testing.T) {
+	os.Setenv("ELASTIC_APM_METRICS_WORKERS", "lots")
+	defer os.Unsetenv("ELASTIC_APM_METRICS_WORKERS")
+
+	_, err := elasticapm.NewTracer("tracer_testing", "")
+	assert.EqualError(t, err, "failed to parse ELASTIC_APM_METRICS_WORKERS: strconv.Atoi: parsing \"lots\": invalid syntax")
+}
+
+// maxConcurrentGatherers registers n metrics gatherers with tracer,
+// gathers metrics, and returns the maximum number of gatherers that
+// ran concurrently.
+func maxConcurrentGatherers(tracer *elasticapm.Tracer, n int) int {
+	var mu sync.Mutex
+	var current, max int
+	for i := 0; i < n; i++ {
+		tracer.RegisterMetricsGatherer(elasticapm.GatherMetricsFunc(
+			func(ctx context.Context, m *elasticapm.Metrics) error {
+				mu.Lock()
+				current++
+				if current > max {
+					max = current
+				}
+				mu.Unlock()
+				time.Sleep(10 * time.Millisecond)
+				mu.Lock()
+				current--
+				mu.Unlock()
+				return nil
+			},
+		))
+	}
+	tracer.SendMetrics(nil)
+	mu.Lock()
+	defer mu.Unlock()
+	return max
+}